@@ -13,10 +13,12 @@ import (
 	"sync"
 	"time"
 
+	"config"
 	"xbase/sync2"
 	"xcontext"
 
 	"github.com/pkg/errors"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
@@ -71,6 +73,58 @@ func (txn *BackupTxn) SetMaxResult(max int) {
 	txn.maxResult = max
 }
 
+// MaxResult returns the txn max result.
+func (txn *BackupTxn) MaxResult() int {
+	return txn.maxResult
+}
+
+// SetSpillConfig not implemented, the backup txn never spills.
+func (txn *BackupTxn) SetSpillConfig(conf *config.SpillConfig) {
+}
+
+// SpillConfig returns nil, the backup txn never spills.
+func (txn *BackupTxn) SpillConfig() *config.SpillConfig {
+	return nil
+}
+
+// SetInsertSelectLimits not implemented.
+func (txn *BackupTxn) SetInsertSelectLimits(batchRows int, maxRows int) {
+}
+
+// InsertSelectLimits returns zeros, the backup txn never writes.
+func (txn *BackupTxn) InsertSelectLimits() (int, int) {
+	return 0, 0
+}
+
+// SetMultiWrite not implemented, the backup txn never writes.
+func (txn *BackupTxn) SetMultiWrite() {
+}
+
+// Savepoint not implemented, the backup txn never writes.
+func (txn *BackupTxn) Savepoint(name string) error {
+	return nil
+}
+
+// RollbackToSavepoint not implemented, the backup txn never writes.
+func (txn *BackupTxn) RollbackToSavepoint(name string) error {
+	return nil
+}
+
+// ReleaseSavepoint not implemented, the backup txn never writes.
+func (txn *BackupTxn) ReleaseSavepoint(name string) error {
+	return nil
+}
+
+// BeginSnapshot not implemented, the backup txn never runs in twopc mode.
+func (txn *BackupTxn) BeginSnapshot(backends []string) error {
+	return nil
+}
+
+// TwoPC returns false, the backup txn never runs in twopc mode.
+func (txn *BackupTxn) TwoPC() bool {
+	return false
+}
+
 // TxID returns txn id.
 func (txn *BackupTxn) TxID() uint64 {
 	return txn.id
@@ -143,6 +197,16 @@ func (txn *BackupTxn) Execute(req *xcontext.RequestContext) (*sqltypes.Result, e
 	return nil, fmt.Errorf("backup.txn.execute.not.implemented")
 }
 
+// ExecuteOrderedMerge not implemented.
+func (txn *BackupTxn) ExecuteOrderedMerge(req *xcontext.RequestContext, lessFn MergeLessFunc, limit int) (*sqltypes.Result, error) {
+	return nil, fmt.Errorf("backup.txn.execute.ordered.merge.not.implemented")
+}
+
+// ExecuteRowStream not implemented.
+func (txn *BackupTxn) ExecuteRowStream(req *xcontext.RequestContext, callback func(fields []*querypb.Field, rows [][]sqltypes.Value) error, batchRows int) error {
+	return fmt.Errorf("backup.txn.execute.row.stream.not.implemented")
+}
+
 // Begin not implemented.
 func (txn *BackupTxn) Begin() error {
 	return fmt.Errorf("backup.txn.begin.not.implemented")
@@ -0,0 +1,91 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package backend
+
+import (
+	"github.com/xelabs/go-mysqlstack/driver"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+// MergeLessFunc builds the less function of the ordered merge by the fields of the shard results.
+type MergeLessFunc func(fields []*querypb.Field) (func(a, b []sqltypes.Value) bool, error)
+
+// shardCursor is one shard result of the stream, the rows are read from
+// the stream cursor one by one, or from the buffered rows if the cursor is nil.
+type shardCursor struct {
+	name   string
+	fields []*querypb.Field
+	cursor driver.Rows
+	rows   [][]sqltypes.Value
+	row    []sqltypes.Value
+}
+
+// next moves the cursor to the next row, returns false if the cursor is finished.
+func (c *shardCursor) next() (bool, error) {
+	if c.cursor == nil {
+		if len(c.rows) == 0 {
+			return false, nil
+		}
+		c.row, c.rows = c.rows[0], c.rows[1:]
+		return true, nil
+	}
+
+	if !c.cursor.Next() {
+		return false, c.cursor.LastError()
+	}
+	row, err := c.cursor.RowValues()
+	if err != nil {
+		return false, err
+	}
+	c.row = row
+	return true, nil
+}
+
+// close drains and closes the stream cursor.
+func (c *shardCursor) close() error {
+	if c.cursor != nil {
+		return c.cursor.Close()
+	}
+	return nil
+}
+
+// mergeHeap is a min-heap of the cursors ordered by their current rows.
+type mergeHeap struct {
+	cursors []*shardCursor
+	less    func(a, b []sqltypes.Value) bool
+}
+
+// Len is part of heap.Interface.
+func (h *mergeHeap) Len() int {
+	return len(h.cursors)
+}
+
+// Less is part of heap.Interface.
+func (h *mergeHeap) Less(i, j int) bool {
+	return h.less(h.cursors[i].row, h.cursors[j].row)
+}
+
+// Swap is part of heap.Interface.
+func (h *mergeHeap) Swap(i, j int) {
+	h.cursors[i], h.cursors[j] = h.cursors[j], h.cursors[i]
+}
+
+// Push is part of heap.Interface.
+func (h *mergeHeap) Push(x interface{}) {
+	h.cursors = append(h.cursors, x.(*shardCursor))
+}
+
+// Pop is part of heap.Interface.
+func (h *mergeHeap) Pop() interface{} {
+	n := len(h.cursors)
+	c := h.cursors[n-1]
+	h.cursors = h.cursors[:n-1]
+	return c
+}
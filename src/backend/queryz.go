@@ -15,6 +15,12 @@ import (
 	"time"
 
 	"xbase"
+	"xbase/sync2"
+)
+
+const (
+	// spillAddress is the address of the QueryDetail which is executed in the proxy.
+	spillAddress = "proxy"
 )
 
 // QueryDetail is a simple wrapper for Query
@@ -24,6 +30,11 @@ type QueryDetail struct {
 	query  string
 	conn   Connection
 	start  time.Time
+
+	// The spill usage of the query executed in the proxy.
+	spillRuns  sync2.AtomicInt64
+	spillRows  sync2.AtomicInt64
+	spillBytes sync2.AtomicInt64
 }
 
 // NewQueryDetail creates a new QueryDetail
@@ -32,6 +43,30 @@ func NewQueryDetail(conn Connection, query string) *QueryDetail {
 	return &QueryDetail{conn: conn, connID: conn.ID(), query: q, start: time.Now()}
 }
 
+// NewSpillQueryDetail creates a new QueryDetail for the query which spills to disk in the proxy,
+// it's not bound to any backend connection.
+func NewSpillQueryDetail(query string) *QueryDetail {
+	q := xbase.TruncateQuery(query, 256)
+	return &QueryDetail{query: q, start: time.Now()}
+}
+
+// AddSpill adds the usage of one spilled run.
+func (qd *QueryDetail) AddSpill(rows int, bytes int) {
+	qd.spillRuns.Add(1)
+	qd.spillRows.Add(int64(rows))
+	qd.spillBytes.Add(int64(bytes))
+}
+
+// AddQueryDetail adds a QueryDetail to the queryz.
+func AddQueryDetail(qd *QueryDetail) {
+	qz.Add(qd)
+}
+
+// RemoveQueryDetail removes a QueryDetail from the queryz.
+func RemoveQueryDetail(qd *QueryDetail) {
+	qz.Remove(qd)
+}
+
 // Queryz holds a thread safe list of QueryDetails
 type Queryz struct {
 	ID           uint64
@@ -68,6 +103,10 @@ type QueryDetailzRow struct {
 	Query    string
 	Address  string
 	Color    string
+
+	SpillRuns  int64
+	SpillRows  int64
+	SpillBytes int64
 }
 
 type byStartTime []QueryDetailzRow
@@ -82,11 +121,17 @@ func (qz *Queryz) GetQueryzRows() []QueryDetailzRow {
 	rows := []QueryDetailzRow{}
 	for _, qd := range qz.queryDetails {
 		row := QueryDetailzRow{
-			Query:    qd.query,
-			Address:  qd.conn.Address(),
-			Start:    qd.start,
-			Duration: time.Since(qd.start),
-			ConnID:   qd.connID,
+			Query:      qd.query,
+			Address:    spillAddress,
+			Start:      qd.start,
+			Duration:   time.Since(qd.start),
+			ConnID:     qd.connID,
+			SpillRuns:  qd.spillRuns.Get(),
+			SpillRows:  qd.spillRows.Get(),
+			SpillBytes: qd.spillBytes.Get(),
+		}
+		if qd.conn != nil {
+			row.Address = qd.conn.Address()
 		}
 		if row.Duration < 10*time.Millisecond {
 			row.Color = "low"
@@ -40,6 +40,14 @@ func (scatter *Scatter) Txnz() *Txnz {
 	return tz
 }
 
+// XaRecoverz returns the results of the XA recovery on startup.
+func (scatter *Scatter) XaRecoverz() []XaRecoverResult {
+	if xaCheck := scatter.txnMgr.xaCheck; xaCheck != nil {
+		return xaCheck.GetXaRecoverResults()
+	}
+	return nil
+}
+
 // MySQLStats returns the mysql stats.
 func (scatter *Scatter) MySQLStats() *stats.Timings {
 	return mysqlStats
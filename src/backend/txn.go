@@ -9,9 +9,13 @@
 package backend
 
 import (
+	"container/heap"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
+
+	"config"
 	"xcontext"
 
 	"xbase/sync2"
@@ -19,6 +23,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/xelabs/go-mysqlstack/driver"
 	"github.com/xelabs/go-mysqlstack/sqldb"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
@@ -44,6 +49,8 @@ var (
 
 var (
 	xaMaxRetryNum = 20
+
+	errSnapshotWrite = errors.New("unsupported: write.in.consistent.snapshot.transaction")
 )
 
 type txnState int32
@@ -76,6 +83,10 @@ const (
 	txnXAStateRollbackFinished
 	txnXAStateRecover
 	txnXAStateRecoverFinished
+	txnXAStateSavepoint
+	txnXAStateSavepointFinished
+	txnXAStateSnapshot
+	txnXAStateSnapshotFinished
 )
 
 // Transaction interface.
@@ -93,8 +104,22 @@ type Transaction interface {
 
 	SetTimeout(timeout int)
 	SetMaxResult(max int)
+	MaxResult() int
+	SetSpillConfig(conf *config.SpillConfig)
+	SpillConfig() *config.SpillConfig
+	SetInsertSelectLimits(batchRows int, maxRows int)
+	InsertSelectLimits() (int, int)
+	TwoPC() bool
+	SetMultiWrite()
+
+	Savepoint(name string) error
+	RollbackToSavepoint(name string) error
+	ReleaseSavepoint(name string) error
+	BeginSnapshot(backends []string) error
 
 	Execute(req *xcontext.RequestContext) (*sqltypes.Result, error)
+	ExecuteOrderedMerge(req *xcontext.RequestContext, lessFn MergeLessFunc, limit int) (*sqltypes.Result, error)
+	ExecuteRowStream(req *xcontext.RequestContext, callback func(fields []*querypb.Field, rows [][]sqltypes.Value) error, batchRows int) error
 	ExecuteRaw(database string, query string) (*sqltypes.Result, error)
 }
 
@@ -108,12 +133,20 @@ type Txn struct {
 	req               *xcontext.RequestContext
 	txnd              *TxnDetail
 	twopc             bool
+	multiWrite        bool
+	xaBackends        map[string]bool
+	savepoints        []*txnSavepoint
+	snapshot          bool
+	snapshotBackends  map[string]bool
 	start             time.Time
 	state             sync2.AtomicInt32
 	xaState           sync2.AtomicInt32
 	backends          map[string]*Pool
 	timeout           int
 	maxResult         int
+	spillConf         *config.SpillConfig
+	batchRows         int
+	maxRows           int
 	errors            int
 	twopcConnections  map[string]Connection
 	normalConnections []Connection
@@ -130,6 +163,7 @@ func NewTxn(log *xlog.Log, txid uint64, mgr *TxnManager, backends map[string]*Po
 		backends:          backends,
 		start:             time.Now(),
 		twopcConnections:  make(map[string]Connection),
+		xaBackends:        make(map[string]bool),
 		normalConnections: make([]Connection, 0, 8),
 		state:             sync2.NewAtomicInt32(int32(txnStateLive)),
 	}
@@ -150,6 +184,43 @@ func (txn *Txn) SetMaxResult(max int) {
 	txn.maxResult = max
 }
 
+// MaxResult returns the txn max result.
+func (txn *Txn) MaxResult() int {
+	return txn.maxResult
+}
+
+// SetSpillConfig used to set the spill config of the txn.
+func (txn *Txn) SetSpillConfig(conf *config.SpillConfig) {
+	txn.spillConf = conf
+}
+
+// SpillConfig returns the txn spill config, nil means the spill is disabled.
+func (txn *Txn) SpillConfig() *config.SpillConfig {
+	return txn.spillConf
+}
+
+// SetInsertSelectLimits used to set the batch rows and the max rows of the INSERT ... SELECT.
+func (txn *Txn) SetInsertSelectLimits(batchRows int, maxRows int) {
+	txn.batchRows = batchRows
+	txn.maxRows = maxRows
+}
+
+// InsertSelectLimits returns the batch rows and the max rows of the INSERT ... SELECT.
+func (txn *Txn) InsertSelectLimits() (int, int) {
+	return txn.batchRows, txn.maxRows
+}
+
+// TwoPC returns true if the txn is in twopc mode, the connection to every backend is shared.
+func (txn *Txn) TwoPC() bool {
+	return txn.twopc
+}
+
+// SetMultiWrite marks the txn as doing several writes in one XA, every backend written joins
+// the XA even if the writes go to only one backend.
+func (txn *Txn) SetMultiWrite() {
+	txn.multiWrite = true
+}
+
 // TxID returns txn id.
 func (txn *Txn) TxID() uint64 {
 	return txn.id
@@ -243,18 +314,42 @@ func (txn *Txn) fetchOneConnection(back string) (Connection, error) {
 	return conn, nil
 }
 
+// xaStart starts the XA on the backends of the request which haven't joined it.
+// The XA is only started when the writes go to more than one backend, unless the txn is multi-write
+// or the XA has been started by the former writes.
 func (txn *Txn) xaStart() error {
+	if txn.req.Mode != xcontext.ReqNormal {
+		return nil
+	}
+	backends := make(map[string]bool)
+	for _, query := range txn.req.Querys {
+		if !txn.xaBackends[query.Backend] {
+			backends[query.Backend] = true
+		}
+	}
+	if len(backends) == 0 {
+		return nil
+	}
+	if len(txn.xaBackends) == 0 {
+		if len(backends) < 2 && !txn.multiWrite {
+			return nil
+		}
+		txn.xid = fmt.Sprintf("%s%v-%v", txn.mgr.XidPrefix(), time.Now().Format("20060102150405"), txn.id)
+	}
+
 	txnCounters.Add(txnCounterXaStart, 1)
 	txn.xaState.Set(int32(txnXAStateStart))
 	defer func() { txn.xaState.Set(int32(txnXAStateStartFinished)) }()
 
-	txn.xid = fmt.Sprintf("RXID-%v-%v", time.Now().Format("20060102150405"), txn.id)
 	start := fmt.Sprintf("XA START '%v'", txn.xid)
-	if err := txn.executeXACommand(start, txnXAStateStart); err != nil {
+	if err := txn.executeXA(start, txnXAStateStart, backends); err != nil {
 		txnCounters.Add(txnCounterXaStartError, 1)
 		txn.incErrors()
 		return err
 	}
+	for back := range backends {
+		txn.xaBackends[back] = true
+	}
 	return nil
 }
 
@@ -334,14 +429,21 @@ func (txn *Txn) Begin() error {
 // Commit does:
 // 1. XA END
 // 2. XA PREPARE
-// 3. XA COMMIT
+// 3. write the commit decision
+// 4. XA COMMIT
 func (txn *Txn) Commit() error {
+	log := txn.log
 	txn.state.Set(int32(txnStateCommitting))
 
-	// Here, we only handle the write-txn.
+	// The snapshot txn is read-only, ends it.
+	if txn.snapshot {
+		return txn.endSnapshot("COMMIT")
+	}
+
+	// Here, we only handle the backends joined the XA.
 	// Commit nothing for read-txn.
-	switch txn.req.TxnMode {
-	case xcontext.TxnWrite:
+	if len(txn.xaBackends) > 0 {
+		defer txn.xaReset()
 		// 1. XA END.
 		if err := txn.xaEnd(); err != nil {
 			return err
@@ -352,7 +454,15 @@ func (txn *Txn) Commit() error {
 			return err
 		}
 
-		// 3. XA COMMIT
+		// 3. Write the commit decision, the XA is committed by the recovery if radon crashes.
+		if err := txn.WriteXaDecision(); err != nil {
+			log.Error("txn.xa.WriteXaDecision.xid[%v].error[%T]:%+v", txn.xid, err, err)
+			txn.xaRollback()
+			return err
+		}
+		defer txn.FinishXaDecision()
+
+		// 4. XA COMMIT
 		txn.xaCommit()
 	}
 	return nil
@@ -364,10 +474,14 @@ func (txn *Txn) Rollback() error {
 	log := txn.log
 	txn.state.Set(int32(txnStateRollbacking))
 
-	// Here, we only handle the write-txn.
+	if txn.snapshot {
+		return txn.endSnapshot("ROLLBACK")
+	}
+
+	// Here, we only handle the backends joined the XA.
 	// Rollback nothing for read-txn.
-	switch txn.req.TxnMode {
-	case xcontext.TxnWrite:
+	if len(txn.xaBackends) > 0 {
+		defer txn.xaReset()
 		log.Warning("txn.rollback.xid[%v]", txn.xid)
 		// 1. XA END.
 		if err := txn.xaEnd(); err != nil {
@@ -385,6 +499,219 @@ func (txn *Txn) Rollback() error {
 	return nil
 }
 
+// txnSavepoint tuple.
+// The backends are the ones joined the XA when the savepoint is set, the others join later.
+type txnSavepoint struct {
+	name     string
+	backends map[string]bool
+}
+
+func savepointQuery(action string, name string) string {
+	return fmt.Sprintf("%s `%s`", action, strings.Replace(name, "`", "``", -1))
+}
+
+// findSavepoint returns the index of the savepoint, -1 if not found.
+// The savepoint name is case-insensitive as MySQL.
+func (txn *Txn) findSavepoint(name string) int {
+	for i, sp := range txn.savepoints {
+		if strings.EqualFold(sp.name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// executeSavepoint used to execute the savepoint statement on the backends joined the XA.
+func (txn *Txn) executeSavepoint(query string, backends map[string]bool) error {
+	if len(backends) == 0 {
+		return nil
+	}
+	txn.xaState.Set(int32(txnXAStateSavepoint))
+	defer func() { txn.xaState.Set(int32(txnXAStateSavepointFinished)) }()
+
+	if err := txn.executeXA(query, txnXAStateSavepoint, backends); err != nil {
+		txn.incErrors()
+		return err
+	}
+	return nil
+}
+
+// Savepoint sets the savepoint on the backends joined the XA, and records them.
+// The savepoint with the same name is replaced.
+func (txn *Txn) Savepoint(name string) error {
+	if idx := txn.findSavepoint(name); idx >= 0 {
+		txn.savepoints = append(txn.savepoints[:idx], txn.savepoints[idx+1:]...)
+	}
+
+	backends := make(map[string]bool, len(txn.xaBackends))
+	for back := range txn.xaBackends {
+		backends[back] = true
+	}
+	if err := txn.executeSavepoint(savepointQuery("SAVEPOINT", name), backends); err != nil {
+		return err
+	}
+	txn.savepoints = append(txn.savepoints, &txnSavepoint{name: name, backends: backends})
+	return nil
+}
+
+// RollbackToSavepoint rollbacks the backends joined the XA before the savepoint to it,
+// the backends joined after the savepoint have nothing to keep, their XA branches are
+// rollbacked and they leave the XA. The savepoints set later are removed.
+func (txn *Txn) RollbackToSavepoint(name string) error {
+	idx := txn.findSavepoint(name)
+	if idx < 0 {
+		return sqldb.NewSQLError(sqldb.ER_SP_DOES_NOT_EXIST, "", "SAVEPOINT", name)
+	}
+	sp := txn.savepoints[idx]
+
+	joined := make(map[string]bool)
+	late := make(map[string]bool)
+	for back := range txn.xaBackends {
+		if sp.backends[back] {
+			joined[back] = true
+		} else {
+			late[back] = true
+		}
+	}
+	if err := txn.executeSavepoint(savepointQuery("ROLLBACK TO SAVEPOINT", sp.name), joined); err != nil {
+		return err
+	}
+	if len(late) > 0 {
+		if err := txn.xaDetach(late); err != nil {
+			return err
+		}
+	}
+	txn.savepoints = txn.savepoints[:idx+1]
+	return nil
+}
+
+// ReleaseSavepoint removes the savepoint and the ones set later.
+func (txn *Txn) ReleaseSavepoint(name string) error {
+	idx := txn.findSavepoint(name)
+	if idx < 0 {
+		return sqldb.NewSQLError(sqldb.ER_SP_DOES_NOT_EXIST, "", "SAVEPOINT", name)
+	}
+	sp := txn.savepoints[idx]
+
+	backends := make(map[string]bool)
+	for back := range txn.xaBackends {
+		if sp.backends[back] {
+			backends[back] = true
+		}
+	}
+	if err := txn.executeSavepoint(savepointQuery("RELEASE SAVEPOINT", sp.name), backends); err != nil {
+		return err
+	}
+	txn.savepoints = txn.savepoints[:idx]
+	return nil
+}
+
+// xaDetach used to rollback the XA branches of the backends, the backends leave the XA
+// and join it again by XA START if they are written later.
+// 1. XA END
+// 2. XA PREPARE
+// 3. XA ROLLBACK
+func (txn *Txn) xaDetach(backends map[string]bool) error {
+	log := txn.log
+	log.Warning("txn.xa.detach.xid[%v].backends[%v]", txn.xid, backends)
+
+	end := fmt.Sprintf("XA END '%v'", txn.xid)
+	if err := txn.executeXA(end, txnXAStateEnd, backends); err != nil {
+		txn.incErrors()
+		return err
+	}
+	prepare := fmt.Sprintf("XA PREPARE '%v'", txn.xid)
+	if err := txn.executeXA(prepare, txnXAStatePrepare, backends); err != nil {
+		txn.incErrors()
+		return err
+	}
+	rollback := fmt.Sprintf("XA ROLLBACK '%v'", txn.xid)
+	if err := txn.executeXA(rollback, txnXAStateRollback, backends); err != nil {
+		txn.incErrors()
+		return err
+	}
+	for back := range backends {
+		delete(txn.xaBackends, back)
+	}
+	return nil
+}
+
+// BeginSnapshot used to start the consistent snapshot on the backends read by the txn, the txn becomes
+// read-only and the reads run in the snapshot until the txn is committed or rollbacked, the reads of
+// the other backends are rejected.
+// The snapshots are started holding the commit read-lock, so no XA COMMIT is in flight and
+// every backend sees the same distributed transactions committed.
+func (txn *Txn) BeginSnapshot(backends []string) error {
+	if !txn.twopc {
+		return errors.New("txn.snapshot.must.begin.first")
+	}
+	if len(txn.xaBackends) > 0 {
+		return errSnapshotWrite
+	}
+
+	snapshotBackends := make(map[string]bool, len(backends))
+	for _, back := range backends {
+		if _, ok := txn.backends[back]; !ok {
+			return errors.Errorf("txn.snapshot.can.not.find.backend[%s]", back)
+		}
+		snapshotBackends[back] = true
+	}
+
+	txn.mgr.CommitRLock()
+	defer txn.mgr.CommitRUnlock()
+	txn.xaState.Set(int32(txnXAStateSnapshot))
+	defer func() { txn.xaState.Set(int32(txnXAStateSnapshotFinished)) }()
+
+	txn.snapshot = true
+	txn.snapshotBackends = snapshotBackends
+	if err := txn.executeXA("START TRANSACTION WITH CONSISTENT SNAPSHOT", txnXAStateSnapshot, snapshotBackends); err != nil {
+		txn.incErrors()
+		return err
+	}
+	return nil
+}
+
+// checkSnapshot returns error if the read goes to the backend out of the snapshot.
+func (txn *Txn) checkSnapshot(req *xcontext.RequestContext) error {
+	backends := make([]string, 0, len(req.Querys))
+	if req.Mode == xcontext.ReqNormal {
+		for _, query := range req.Querys {
+			backends = append(backends, query.Backend)
+		}
+	} else {
+		for back := range txn.backends {
+			backends = append(backends, back)
+		}
+	}
+	for _, back := range backends {
+		if !txn.snapshotBackends[back] {
+			return errors.Errorf("unsupported: backend[%s].is.not.in.the.consistent.snapshot", back)
+		}
+	}
+	return nil
+}
+
+// endSnapshot used to end the snapshot on the backends.
+func (txn *Txn) endSnapshot(query string) error {
+	txn.xaState.Set(int32(txnXAStateSnapshot))
+	defer func() { txn.xaState.Set(int32(txnXAStateSnapshotFinished)) }()
+
+	backends := make(map[string]bool, len(txn.twopcConnections))
+	txn.twopcConnMu.RLock()
+	for back := range txn.twopcConnections {
+		backends[back] = true
+	}
+	txn.twopcConnMu.RUnlock()
+
+	if err := txn.executeXA(query, txnXAStateSnapshot, backends); err != nil {
+		txn.incErrors()
+		return err
+	}
+	txn.snapshot = false
+	txn.snapshotBackends = nil
+	return nil
+}
+
 // ExecuteRaw used to execute raw query, txn not implemented.
 func (txn *Txn) ExecuteRaw(database string, query string) (*sqltypes.Result, error) {
 	return nil, fmt.Errorf("txn.ExecuteRaw.not.implemented")
@@ -397,10 +724,18 @@ func (txn *Txn) Execute(req *xcontext.RequestContext) (*sqltypes.Result, error)
 		txn.req = req
 		switch req.TxnMode {
 		case xcontext.TxnRead:
+			if txn.snapshot {
+				if err := txn.checkSnapshot(req); err != nil {
+					return nil, err
+				}
+			}
 			// read-txn acquires the commit read-lock.
 			txn.mgr.CommitRLock()
 			defer txn.mgr.CommitRUnlock()
 		case xcontext.TxnWrite:
+			if txn.snapshot {
+				return nil, errSnapshotWrite
+			}
 			// write-txn xa starts.
 			if err := txn.xaStart(); err != nil {
 				return nil, err
@@ -515,18 +850,19 @@ func (txn *Txn) execute(req *xcontext.RequestContext) (*sqltypes.Result, error)
 	return qr, err
 }
 
-// executeXACommand used to execute XA statements.
+// executeXACommand used to execute XA statements on the backends joined the XA.
 func (txn *Txn) executeXACommand(query string, state txnXAState) error {
-	rctx := &xcontext.RequestContext{
-		RawQuery: query,
-		Mode:     txn.req.Mode,
-		Querys:   txn.req.Querys,
-	}
-	return txn.executeXA(rctx, state)
+	return txn.executeXA(query, state, txn.xaBackends)
+}
+
+// xaReset clears the backends joined the XA and the savepoints after it's committed or rollbacked.
+func (txn *Txn) xaReset() {
+	txn.xaBackends = make(map[string]bool)
+	txn.savepoints = nil
 }
 
-// executeXA only used to execute the 'XA START','XA END', 'XA PREPARE', 'XA COMMIT'/'XA ROLLBACK' statements.
-func (txn *Txn) executeXA(req *xcontext.RequestContext, state txnXAState) error {
+// executeXA only used to execute the 'XA START','XA END', 'XA PREPARE', 'XA COMMIT'/'XA ROLLBACK' statements on the backends.
+func (txn *Txn) executeXA(query string, state txnXAState, backends map[string]bool) error {
 	var err error
 	var mu sync.Mutex
 	var wg sync.WaitGroup
@@ -542,7 +878,7 @@ func (txn *Txn) executeXA(req *xcontext.RequestContext, state txnXAState) error
 		defer wg.Done()
 
 		switch state {
-		case txnXAStateStart, txnXAStateEnd, txnXAStatePrepare:
+		case txnXAStateStart, txnXAStateEnd, txnXAStatePrepare, txnXAStateSavepoint, txnXAStateSnapshot:
 			if c, x = txn.twopcConnection(back); x != nil {
 				log.Error("txn.xa.fetch.connection.state[%v].on[%s].query[%v].error:%+v", state, back, query, x)
 			} else {
@@ -593,31 +929,15 @@ func (txn *Txn) executeXA(req *xcontext.RequestContext, state txnXAState) error
 		}
 	}
 
-	switch req.Mode {
-	case xcontext.ReqNormal:
-		backends := make(map[string]bool)
-		for _, query := range req.Querys {
-			_, ok := backends[query.Backend]
-			if !ok {
-				backends[query.Backend] = true
-			}
-		}
-
-		// Only do XA when backends numbers larger than one.
-		beLen := len(backends)
-		if beLen > 1 {
-			switch state {
-			case txnXAStateCommit, txnXAStateRollback:
-				// Acquire the commit lock if the txn is write.
-				txn.mgr.CommitLock()
-				defer txn.mgr.CommitUnlock()
-			}
-
-			for back := range backends {
-				wg.Add(1)
-				go oneShard(state, back, txn, req.RawQuery)
-			}
-		}
+	switch state {
+	case txnXAStateCommit, txnXAStateRollback:
+		// Acquire the commit lock if the txn is write.
+		txn.mgr.CommitLock()
+		defer txn.mgr.CommitUnlock()
+	}
+	for back := range backends {
+		wg.Add(1)
+		go oneShard(state, back, txn, query)
 	}
 
 	wg.Wait()
@@ -741,6 +1061,307 @@ func (txn *Txn) ExecuteStreamFetch(req *xcontext.RequestContext, callback func(*
 	return callback(finishQr)
 }
 
+// ExecuteOrderedMerge used to execute the querys whose results are already ordered by the shards.
+// Every shard result is read through a stream cursor and merged with a heap, the merge stops as soon
+// as limit rows are produced, so the memory is bounded by the shard count instead of the rows returned.
+// If limit is less than 0, all the rows are merged.
+func (txn *Txn) ExecuteOrderedMerge(req *xcontext.RequestContext, lessFn MergeLessFunc, limit int) (*sqltypes.Result, error) {
+	release, err := txn.beginStream(req)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	qr, err := txn.executeOrderedMerge(req, lessFn, limit)
+	if err != nil {
+		txn.incErrors()
+		return nil, err
+	}
+	return qr, err
+}
+
+func (txn *Txn) executeOrderedMerge(req *xcontext.RequestContext, lessFn MergeLessFunc, limit int) (*sqltypes.Result, error) {
+	log := txn.log
+	if txn.twopc {
+		defer queryStats.Record("txn.2pc.merge.execute", time.Now())
+	} else {
+		defer queryStats.Record("txn.normal.merge.execute", time.Now())
+	}
+
+	timer, timeout := txn.killOnTimeout()
+	defer timer.Stop()
+	cursors, err := txn.openCursors(req)
+	defer closeCursors(cursors)
+	if err != nil {
+		return nil, txn.streamError(timeout, err)
+	}
+
+	qr := &sqltypes.Result{}
+	if len(cursors) == 0 {
+		return qr, nil
+	}
+	qr.Fields = cursors[0].fields
+	less, err := lessFn(qr.Fields)
+	if err != nil {
+		return nil, err
+	}
+
+	// Merge the cursors.
+	h := &mergeHeap{less: less}
+	for _, cursor := range cursors {
+		ok, err := cursor.next()
+		if err != nil {
+			log.Error("txn.merge.cursor[%s].next.error:%+v", cursor.name, err)
+			return nil, txn.streamError(timeout, err)
+		}
+		if ok {
+			h.cursors = append(h.cursors, cursor)
+		}
+	}
+	heap.Init(h)
+
+	byteCount := 0
+	for h.Len() > 0 && (limit < 0 || len(qr.Rows) < limit) {
+		cursor := h.cursors[0]
+		qr.Rows = append(qr.Rows, cursor.row)
+		byteCount += sqltypes.Values(cursor.row).Len()
+		if txn.maxResult > 0 && byteCount > txn.maxResult {
+			return nil, fmt.Errorf("Query execution was interrupted, max memory usage[%d bytes] exceeded", txn.maxResult)
+		}
+
+		ok, err := cursor.next()
+		if err != nil {
+			log.Error("txn.merge.cursor[%s].next.error:%+v", cursor.name, err)
+			return nil, txn.streamError(timeout, err)
+		}
+		if ok {
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+	}
+	qr.RowsAffected = uint64(len(qr.Rows))
+	return qr, nil
+}
+
+// ExecuteRowStream used to execute the querys and passes the rows of all the shards to the callback
+// batch by batch, the shard cursors are read in turn with at most batchRows rows per batch.
+// The first callback passes the fields without rows.
+// The rows are not limited by the max result, the callback is responsible for the memory usage.
+func (txn *Txn) ExecuteRowStream(req *xcontext.RequestContext, callback func(fields []*querypb.Field, rows [][]sqltypes.Value) error, batchRows int) error {
+	release, err := txn.beginStream(req)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if err := txn.executeRowStream(req, callback, batchRows); err != nil {
+		txn.incErrors()
+		return err
+	}
+	return nil
+}
+
+func (txn *Txn) executeRowStream(req *xcontext.RequestContext, callback func(fields []*querypb.Field, rows [][]sqltypes.Value) error, batchRows int) error {
+	log := txn.log
+	if txn.twopc {
+		defer queryStats.Record("txn.2pc.stream.execute", time.Now())
+	} else {
+		defer queryStats.Record("txn.normal.stream.execute", time.Now())
+	}
+
+	timer, timeout := txn.killOnTimeout()
+	defer timer.Stop()
+	cursors, err := txn.openCursors(req)
+	defer closeCursors(cursors)
+	if err != nil {
+		return txn.streamError(timeout, err)
+	}
+
+	if len(cursors) == 0 {
+		return nil
+	}
+	if err := callback(cursors[0].fields, nil); err != nil {
+		return err
+	}
+
+	if batchRows <= 0 {
+		batchRows = 1
+	}
+	active := cursors
+	batch := make([][]sqltypes.Value, 0, batchRows)
+	for len(active) > 0 {
+		remains := active[:0]
+		for _, cursor := range active {
+			finished := false
+			batch = batch[:0]
+			for len(batch) < batchRows {
+				ok, err := cursor.next()
+				if err != nil {
+					log.Error("txn.stream.cursor[%s].next.error:%+v", cursor.name, err)
+					return txn.streamError(timeout, err)
+				}
+				if !ok {
+					finished = true
+					break
+				}
+				batch = append(batch, cursor.row)
+			}
+			if len(batch) > 0 {
+				if err := callback(cursor.fields, batch); err != nil {
+					return err
+				}
+			}
+			if !finished {
+				remains = append(remains, cursor)
+			}
+		}
+		active = remains
+	}
+	return nil
+}
+
+// beginStream acquires the commit read-lock for the read-txn or starts the xa for the write-txn
+// in twopc mode, the returned function releases the read-lock.
+func (txn *Txn) beginStream(req *xcontext.RequestContext) (func(), error) {
+	if txn.twopc {
+		txn.req = req
+		txn.state.Set(int32(txnStateExecutingTwoPC))
+		switch req.TxnMode {
+		case xcontext.TxnRead:
+			if txn.snapshot {
+				if err := txn.checkSnapshot(req); err != nil {
+					return nil, err
+				}
+			}
+			// read-txn acquires the commit read-lock.
+			txn.mgr.CommitRLock()
+			return txn.mgr.CommitRUnlock, nil
+		case xcontext.TxnWrite:
+			if txn.snapshot {
+				return nil, errSnapshotWrite
+			}
+			// write-txn xa starts.
+			if err := txn.xaStart(); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		txn.state.Set(int32(txnStateExecutingNormal))
+	}
+	return func() {}, nil
+}
+
+// openCursors opens one cursor for every query.
+// In twopc mode the querys on one backend share the same connection and only the last
+// statement can be streamed, so the others are buffered before the cursor is opened.
+// The opened cursors are returned even if there is an error, they must be closed by the caller.
+func (txn *Txn) openCursors(req *xcontext.RequestContext) ([]*shardCursor, error) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	log := txn.log
+	allErrors := make([]error, 0, 8)
+	cursors := make([]*shardCursor, len(req.Querys))
+
+	oneShard := func(back string, idxs []int) {
+		var x error
+		defer wg.Done()
+
+		for k := len(idxs) - 1; k >= 0; k-- {
+			var c Connection
+			i := idxs[k]
+			query := req.Querys[i].Query
+
+			if c, x = txn.fetchOneConnection(back); x != nil {
+				log.Error("txn.stream.fetch.connection.on[%s].query[%v].error:%+v", back, query, x)
+				break
+			}
+			if txn.twopc && k > 0 {
+				var qr *sqltypes.Result
+				if qr, x = c.ExecuteWithLimits(query, txn.timeout, txn.maxResult); x != nil {
+					log.Error("txn.stream.execute.on[%v].query[%v].error:%+v", c.Address(), query, x)
+					break
+				}
+				cursors[i] = &shardCursor{name: back, fields: qr.Fields, rows: qr.Rows}
+				continue
+			}
+
+			var rows driver.Rows
+			if rows, x = c.ExecuteStreamFetch(query); x != nil {
+				log.Error("txn.stream.on[%v].query[%v].error:%+v", c.Address(), query, x)
+				break
+			}
+			cursors[i] = &shardCursor{name: back, fields: rows.Fields(), cursor: rows}
+		}
+
+		if x != nil {
+			mu.Lock()
+			allErrors = append(allErrors, x)
+			mu.Unlock()
+		}
+	}
+
+	queryMap := make(map[string][]int)
+	for i, query := range req.Querys {
+		queryMap[query.Backend] = append(queryMap[query.Backend], i)
+	}
+	for back, idxs := range queryMap {
+		wg.Add(1)
+		go oneShard(back, idxs)
+	}
+	wg.Wait()
+	if len(allErrors) > 0 {
+		return cursors, allErrors[0]
+	}
+	return cursors, nil
+}
+
+// closeCursors drains and closes the opened cursors.
+func closeCursors(cursors []*shardCursor) {
+	for _, cursor := range cursors {
+		if cursor != nil {
+			cursor.close()
+		}
+	}
+}
+
+// killOnTimeout kills the connections of the txn once the txn timeout is exceeded,
+// the returned flag tells whether the timer is fired.
+func (txn *Txn) killOnTimeout() (*time.Timer, *sync2.AtomicBool) {
+	fired := sync2.NewAtomicBool(false)
+	if txn.timeout <= 0 {
+		// A stopped timer.
+		timer := time.NewTimer(time.Hour)
+		timer.Stop()
+		return timer, &fired
+	}
+	timer := time.AfterFunc(time.Duration(txn.timeout)*time.Millisecond, func() {
+		fired.Set(true)
+		var conns []Connection
+		txn.normalConnMu.Lock()
+		conns = append(conns, txn.normalConnections...)
+		txn.normalConnMu.Unlock()
+		txn.twopcConnMu.RLock()
+		for _, conn := range txn.twopcConnections {
+			conns = append(conns, conn)
+		}
+		txn.twopcConnMu.RUnlock()
+		for _, conn := range conns {
+			conn.Kill("stream.timeout")
+		}
+	})
+	return timer, &fired
+}
+
+// streamError returns the timeout error if the stream is killed by the timer.
+func (txn *Txn) streamError(timeout *sync2.AtomicBool, err error) error {
+	if timeout.Get() {
+		return fmt.Errorf("Query execution was interrupted, timeout[%dms] exceeded", txn.timeout)
+	}
+	return err
+}
+
 // ExecuteScatter used to execute query on all shards.
 func (txn *Txn) ExecuteScatter(query string) (*sqltypes.Result, error) {
 	rctx := &xcontext.RequestContext{
@@ -792,8 +1413,9 @@ func (txn *Txn) Finish() error {
 	txn.state.Set(int32(txnStateFinshing))
 
 	// 2pc connections.
+	// The snapshot not ended is still open on the connections, they can't be reused.
 	for id, conn := range txn.twopcConnections {
-		if txn.errors > 0 {
+		if txn.errors > 0 || txn.snapshot {
 			conn.Close()
 		} else {
 			conn.Recycle()
@@ -847,6 +1469,23 @@ func (txn *Txn) Abort() error {
 	return nil
 }
 
+// WriteXaDecision used to write the commit decision of the XA to the log before the XA COMMIT.
+func (txn *Txn) WriteXaDecision() error {
+	if txn.mgr.xaCheck == nil {
+		return nil
+	}
+	return txn.mgr.xaCheck.WriteXaDecision(txn)
+}
+
+// FinishXaDecision used to remove the commit decision of the XA after the XA COMMIT,
+// the XA failed to commit is retried by the xacheck.
+func (txn *Txn) FinishXaDecision() {
+	if txn.mgr.xaCheck == nil {
+		return
+	}
+	txn.mgr.xaCheck.FinishXaDecision(txn)
+}
+
 // WriteXaCommitErrLog used to write the error xaid to the log.
 func (txn *Txn) WriteXaCommitErrLog(state string) error {
 	return txn.mgr.xaCheck.WriteXaCommitErrLog(txn, state)
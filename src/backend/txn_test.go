@@ -202,6 +202,245 @@ func TestTxnExecuteStreamFetch(t *testing.T) {
 	}
 }
 
+func TestTxnExecuteOrderedMerge(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedb, txnMgr, backends, _, addrs, cleanup := MockTxnMgr(log, 2)
+	defer cleanup()
+
+	querys := []xcontext.QueryTuple{
+		xcontext.QueryTuple{Query: "select * from node1 order by id", Backend: addrs[0]},
+		xcontext.QueryTuple{Query: "select * from node2 order by id", Backend: addrs[1]},
+		xcontext.QueryTuple{Query: "select * from node3 order by id", Backend: addrs[1]},
+	}
+	fields := []*querypb.Field{
+		{Name: "id", Type: querypb.Type_INT32},
+	}
+	mockResult := func(ids ...string) *sqltypes.Result {
+		qr := &sqltypes.Result{Fields: fields}
+		for _, id := range ids {
+			qr.Rows = append(qr.Rows, []sqltypes.Value{sqltypes.MakeTrusted(querypb.Type_INT32, []byte(id))})
+		}
+		return qr
+	}
+	lessFn := func(fields []*querypb.Field) (func(a, b []sqltypes.Value) bool, error) {
+		return func(a, b []sqltypes.Value) bool {
+			x, _ := a[0].ParseInt64()
+			y, _ := b[0].ParseInt64()
+			return x < y
+		}, nil
+	}
+	fakedb.AddQueryStream(querys[0].Query, mockResult("1", "4", "7", "10"))
+	fakedb.AddQueryStream(querys[1].Query, mockResult("2", "5", "8"))
+	fakedb.AddQueryStream(querys[2].Query, mockResult("3", "6"))
+
+	// normal execute.
+	{
+		txn, err := txnMgr.CreateTxn(backends)
+		assert.Nil(t, err)
+		defer txn.Finish()
+
+		rctx := &xcontext.RequestContext{
+			Mode:   xcontext.ReqNormal,
+			Querys: querys,
+		}
+		got, err := txn.ExecuteOrderedMerge(rctx, lessFn, 5)
+		assert.Nil(t, err)
+		assert.Equal(t, "[[1] [2] [3] [4] [5]]", fmt.Sprintf("%v", got.Rows))
+
+		got, err = txn.ExecuteOrderedMerge(rctx, lessFn, -1)
+		assert.Nil(t, err)
+		assert.Equal(t, "[[1] [2] [3] [4] [5] [6] [7] [8] [10]]", fmt.Sprintf("%v", got.Rows))
+	}
+
+	// twopc execute.
+	{
+		fakedb.AddQueryPattern("XA .*", result1)
+		txn, err := txnMgr.CreateTxn(backends)
+		assert.Nil(t, err)
+		defer txn.Finish()
+
+		err = txn.Begin()
+		assert.Nil(t, err)
+		rctx := &xcontext.RequestContext{
+			Mode:    xcontext.ReqNormal,
+			TxnMode: xcontext.TxnRead,
+			Querys:  querys,
+		}
+		got, err := txn.ExecuteOrderedMerge(rctx, lessFn, 7)
+		assert.Nil(t, err)
+		assert.Equal(t, "[[1] [2] [3] [4] [5] [6] [7]]", fmt.Sprintf("%v", got.Rows))
+		txn.Rollback()
+	}
+
+	// max result exceeded.
+	{
+		txn, err := txnMgr.CreateTxn(backends)
+		assert.Nil(t, err)
+		defer txn.Finish()
+
+		txn.SetMaxResult(2)
+		rctx := &xcontext.RequestContext{
+			Mode:   xcontext.ReqNormal,
+			Querys: querys,
+		}
+		_, err = txn.ExecuteOrderedMerge(rctx, lessFn, 5)
+		assert.Equal(t, "Query execution was interrupted, max memory usage[2 bytes] exceeded", err.Error())
+	}
+
+	// less function error.
+	{
+		txn, err := txnMgr.CreateTxn(backends)
+		assert.Nil(t, err)
+		defer txn.Finish()
+
+		rctx := &xcontext.RequestContext{
+			Mode:   xcontext.ReqNormal,
+			Querys: querys,
+		}
+		_, err = txn.ExecuteOrderedMerge(rctx, func(fields []*querypb.Field) (func(a, b []sqltypes.Value) bool, error) {
+			return nil, errors.New("mock.less.error")
+		}, 5)
+		assert.Equal(t, "mock.less.error", err.Error())
+	}
+
+	// execute error.
+	{
+		fakedb.AddQueryError(querys[0].Query, errors.New("mock.stream.query.error"))
+		txn, err := txnMgr.CreateTxn(backends)
+		assert.Nil(t, err)
+		defer txn.Finish()
+
+		rctx := &xcontext.RequestContext{
+			Mode:   xcontext.ReqNormal,
+			Querys: querys,
+		}
+		_, err = txn.ExecuteOrderedMerge(rctx, lessFn, 5)
+		assert.Equal(t, "mock.stream.query.error (errno 1105) (sqlstate HY000)", err.Error())
+	}
+}
+
+func TestTxnExecuteRowStream(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedb, txnMgr, backends, _, addrs, cleanup := MockTxnMgr(log, 2)
+	defer cleanup()
+
+	querys := []xcontext.QueryTuple{
+		xcontext.QueryTuple{Query: "select * from node1", Backend: addrs[0]},
+		xcontext.QueryTuple{Query: "select * from node2", Backend: addrs[1]},
+		xcontext.QueryTuple{Query: "select * from node3", Backend: addrs[1]},
+	}
+	mockResult := func(n int) *sqltypes.Result {
+		qr := &sqltypes.Result{Fields: []*querypb.Field{{Name: "id", Type: querypb.Type_INT32}}}
+		for i := 0; i < n; i++ {
+			qr.Rows = append(qr.Rows, []sqltypes.Value{sqltypes.MakeTrusted(querypb.Type_INT32, []byte(fmt.Sprintf("%d", i)))})
+		}
+		return qr
+	}
+	fakedb.AddQueryStream(querys[0].Query, mockResult(1000))
+	fakedb.AddQueryStream(querys[1].Query, mockResult(10))
+	fakedb.AddQueryStream(querys[2].Query, mockResult(0))
+
+	for _, twopc := range []bool{false, true} {
+		txn, err := txnMgr.CreateTxn(backends)
+		assert.Nil(t, err)
+		defer txn.Finish()
+
+		if twopc {
+			fakedb.AddQueryPattern("XA .*", result1)
+			err = txn.Begin()
+			assert.Nil(t, err)
+		}
+		// The max result doesn't limit the stream.
+		txn.SetMaxResult(8)
+		rctx := &xcontext.RequestContext{
+			Mode:    xcontext.ReqNormal,
+			TxnMode: xcontext.TxnRead,
+			Querys:  querys,
+		}
+		rows, batches := 0, 0
+		var fields []*querypb.Field
+		err = txn.ExecuteRowStream(rctx, func(f []*querypb.Field, batch [][]sqltypes.Value) error {
+			fields = f
+			rows += len(batch)
+			batches++
+			assert.True(t, len(batch) <= 64)
+			return nil
+		}, 64)
+		assert.Nil(t, err)
+		assert.Equal(t, "id", fields[0].Name)
+		assert.Equal(t, 1010, rows)
+		// The fields batch, 16 batches of node1 and 1 batch of node2.
+		assert.Equal(t, 18, batches)
+		if twopc {
+			txn.Rollback()
+		}
+	}
+
+	// callback error.
+	{
+		txn, err := txnMgr.CreateTxn(backends)
+		assert.Nil(t, err)
+		defer txn.Finish()
+
+		rctx := &xcontext.RequestContext{
+			Mode:   xcontext.ReqNormal,
+			Querys: querys,
+		}
+		err = txn.ExecuteRowStream(rctx, func(f []*querypb.Field, batch [][]sqltypes.Value) error {
+			if len(batch) > 0 {
+				return errors.New("mock.callback.error")
+			}
+			return nil
+		}, 64)
+		assert.Equal(t, "mock.callback.error", err.Error())
+	}
+
+	// execute error.
+	{
+		fakedb.AddQueryError(querys[1].Query, errors.New("mock.stream.query.error"))
+		txn, err := txnMgr.CreateTxn(backends)
+		assert.Nil(t, err)
+		defer txn.Finish()
+
+		rctx := &xcontext.RequestContext{
+			Mode:   xcontext.ReqNormal,
+			Querys: querys,
+		}
+		err = txn.ExecuteRowStream(rctx, func(f []*querypb.Field, batch [][]sqltypes.Value) error {
+			return nil
+		}, 64)
+		assert.Equal(t, "mock.stream.query.error (errno 1105) (sqlstate HY000)", err.Error())
+	}
+}
+
+func TestTxnExecuteRowStreamTimeout(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedb, txnMgr, backends, _, addrs, cleanup := MockTxnMgr(log, 2)
+	defer cleanup()
+
+	querys := []xcontext.QueryTuple{
+		xcontext.QueryTuple{Query: "select * from node1", Backend: addrs[0]},
+	}
+	fakedb.AddQueryDelay(querys[0].Query, result1, 1000)
+
+	txn, err := txnMgr.CreateTxn(backends)
+	assert.Nil(t, err)
+	defer txn.Finish()
+
+	txn.SetTimeout(50)
+	rctx := &xcontext.RequestContext{
+		Mode:   xcontext.ReqNormal,
+		Querys: querys,
+	}
+	err = txn.ExecuteRowStream(rctx, func(f []*querypb.Field, batch [][]sqltypes.Value) error {
+		return nil
+	}, 1)
+	assert.Equal(t, "Query execution was interrupted, timeout[50ms] exceeded", err.Error())
+}
+
 func TestTxnNormalError(t *testing.T) {
 	defer leaktest.Check(t)()
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
@@ -799,6 +1038,220 @@ func TestTxnTwoPCExecuteWrite(t *testing.T) {
 	}
 }
 
+func TestTxnTwoPCExecuteMultiWrite(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedb, txnMgr, backends, _, addrs, cleanup := MockTxnMgr(log, 2)
+	defer cleanup()
+
+	fakedb.AddQueryPattern("XA .*", result1)
+	fakedb.AddQueryPattern("select .*", result1)
+	fakedb.AddQueryPattern("insert .*", result2)
+
+	txn, err := txnMgr.CreateTxn(backends)
+	assert.Nil(t, err)
+	defer txn.Finish()
+
+	err = txn.Begin()
+	assert.Nil(t, err)
+	txn.SetMultiWrite()
+
+	// The writes on one backend start the XA, the later ones join it.
+	writes := [][]xcontext.QueryTuple{
+		{{Query: "select * from node1 for update", Backend: addrs[0]}},
+		{{Query: "insert into node1 values(1)", Backend: addrs[0]}},
+		{{Query: "insert into node2 values(1)", Backend: addrs[1]}, {Query: "insert into node1 values(2)", Backend: addrs[0]}},
+	}
+	for _, querys := range writes {
+		rctx := &xcontext.RequestContext{
+			TxnMode: xcontext.TxnWrite,
+			Querys:  querys,
+		}
+		_, err := txn.Execute(rctx)
+		assert.Nil(t, err)
+	}
+	xid := txn.XID()
+
+	// A read after the writes doesn't stop the commit.
+	{
+		rctx := &xcontext.RequestContext{
+			TxnMode: xcontext.TxnRead,
+			Querys:  []xcontext.QueryTuple{{Query: "select * from node2", Backend: addrs[1]}},
+		}
+		_, err := txn.Execute(rctx)
+		assert.Nil(t, err)
+	}
+
+	err = txn.Commit()
+	assert.Nil(t, err)
+	for _, xa := range []string{"XA START", "XA END", "XA PREPARE", "XA COMMIT"} {
+		assert.Equal(t, 2, fakedb.GetQueryCalledNum(fmt.Sprintf("%s '%s'", xa, xid)))
+	}
+}
+
+func TestTxnTwoPCSavepoint(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedb, txnMgr, backends, _, addrs, cleanup := MockTxnMgr(log, 3)
+	defer cleanup()
+
+	fakedb.AddQueryPattern("XA .*", result1)
+	fakedb.AddQueryPattern("insert .*", result2)
+	fakedb.AddQueryPattern("savepoint .*", result2)
+	fakedb.AddQueryPattern("rollback to savepoint .*", result2)
+	fakedb.AddQueryPattern("release savepoint .*", result2)
+
+	txn, err := txnMgr.CreateTxn(backends)
+	assert.Nil(t, err)
+	defer txn.Finish()
+
+	err = txn.Begin()
+	assert.Nil(t, err)
+	txn.SetMultiWrite()
+
+	write := func(backend string) {
+		rctx := &xcontext.RequestContext{
+			TxnMode: xcontext.TxnWrite,
+			Querys:  []xcontext.QueryTuple{{Query: "insert into node values(1)", Backend: backend}},
+		}
+		_, err := txn.Execute(rctx)
+		assert.Nil(t, err)
+	}
+
+	// No backend joins the XA, the savepoint is only recorded.
+	err = txn.Savepoint("sp0")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, fakedb.GetQueryCalledNum("savepoint `sp0`"))
+
+	write(addrs[0])
+	xid := txn.XID()
+	err = txn.Savepoint("sp1")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, fakedb.GetQueryCalledNum("savepoint `sp1`"))
+
+	write(addrs[1])
+	err = txn.Savepoint("sp2")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, fakedb.GetQueryCalledNum("savepoint `sp2`"))
+	write(addrs[2])
+
+	// The backends joined after sp1 leave the XA.
+	err = txn.RollbackToSavepoint("SP1")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, fakedb.GetQueryCalledNum("rollback to savepoint `sp1`"))
+	assert.Equal(t, 2, fakedb.GetQueryCalledNum(fmt.Sprintf("XA ROLLBACK '%s'", xid)))
+
+	// sp2 is removed by the rollback.
+	err = txn.ReleaseSavepoint("sp2")
+	assert.NotNil(t, err)
+	assert.Equal(t, "SAVEPOINT sp2 does not exist (errno 1305) (sqlstate 42000)", err.Error())
+	err = txn.RollbackToSavepoint("sp2")
+	assert.NotNil(t, err)
+
+	// The detached backend joins the XA again.
+	write(addrs[1])
+	assert.Equal(t, 4, fakedb.GetQueryCalledNum(fmt.Sprintf("XA START '%s'", xid)))
+
+	err = txn.ReleaseSavepoint("sp1")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, fakedb.GetQueryCalledNum("release savepoint `sp1`"))
+	err = txn.ReleaseSavepoint("sp0")
+	assert.Nil(t, err)
+
+	err = txn.Commit()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, fakedb.GetQueryCalledNum(fmt.Sprintf("XA COMMIT '%s'", xid)))
+}
+
+func TestTxnTwoPCSnapshot(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedb, txnMgr, backends, _, addrs, cleanup := MockTxnMgr(log, 2)
+	defer cleanup()
+
+	fakedb.AddQuery("start transaction with consistent snapshot", result2)
+	fakedb.AddQuery("commit", result2)
+	fakedb.AddQuery("rollback", result2)
+	fakedb.AddQueryPattern("select .*", result1)
+	fakedb.AddQueryPattern("XA .*", result1)
+
+	// The txn must begin first.
+	{
+		txn, err := txnMgr.CreateTxn(backends)
+		assert.Nil(t, err)
+		err = txn.BeginSnapshot(addrs)
+		assert.NotNil(t, err)
+		txn.Finish()
+	}
+
+	// The backend must be in the txn.
+	{
+		txn, err := txnMgr.CreateTxn(backends)
+		assert.Nil(t, err)
+		err = txn.Begin()
+		assert.Nil(t, err)
+		err = txn.BeginSnapshot([]string{"xx"})
+		assert.Equal(t, "txn.snapshot.can.not.find.backend[xx]", err.Error())
+		txn.Finish()
+	}
+
+	txn, err := txnMgr.CreateTxn(backends)
+	assert.Nil(t, err)
+	defer txn.Finish()
+
+	err = txn.Begin()
+	assert.Nil(t, err)
+	err = txn.BeginSnapshot(addrs[:1])
+	assert.Nil(t, err)
+	assert.Equal(t, 1, fakedb.GetQueryCalledNum("start transaction with consistent snapshot"))
+
+	// The reads run in the snapshot.
+	{
+		rctx := &xcontext.RequestContext{
+			TxnMode: xcontext.TxnRead,
+			Querys: []xcontext.QueryTuple{
+				{Query: "select * from node1", Backend: addrs[0]},
+				{Query: "select * from node1", Backend: addrs[0]},
+			},
+		}
+		qr, err := txn.Execute(rctx)
+		assert.Nil(t, err)
+		assert.Equal(t, 2*len(result1.Rows), len(qr.Rows))
+	}
+
+	// The reads out of the snapshot are rejected.
+	{
+		rctx := &xcontext.RequestContext{
+			TxnMode: xcontext.TxnRead,
+			Querys: []xcontext.QueryTuple{
+				{Query: "select * from node1", Backend: addrs[0]},
+				{Query: "select * from node2", Backend: addrs[1]},
+			},
+		}
+		_, err := txn.Execute(rctx)
+		want := fmt.Sprintf("unsupported: backend[%s].is.not.in.the.consistent.snapshot", addrs[1])
+		assert.Equal(t, want, err.Error())
+		assert.Equal(t, 0, fakedb.GetQueryCalledNum("select * from node2"))
+	}
+
+	// The writes are unsupported.
+	{
+		rctx := &xcontext.RequestContext{
+			TxnMode: xcontext.TxnWrite,
+			Querys:  []xcontext.QueryTuple{{Query: "select * from node1 for update", Backend: addrs[0]}},
+		}
+		_, err := txn.Execute(rctx)
+		assert.NotNil(t, err)
+		assert.Equal(t, "unsupported: write.in.consistent.snapshot.transaction", err.Error())
+		assert.Equal(t, 0, fakedb.GetQueryCalledNum(fmt.Sprintf("XA START '%s'", txn.XID())))
+	}
+
+	err = txn.Commit()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, fakedb.GetQueryCalledNum("commit"))
+	assert.Equal(t, 0, fakedb.GetQueryCalledNum("rollback"))
+}
+
 func TestTxnTwoPCExecuteScatterOnOneBackend(t *testing.T) {
 	defer leaktest.Check(t)()
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
@@ -53,6 +53,14 @@ func (mgr *TxnManager) Close() {
 	}
 }
 
+// XidPrefix returns the prefix of the xids generated by the txns.
+func (mgr *TxnManager) XidPrefix() string {
+	if mgr.xaCheck != nil {
+		return mgr.xaCheck.XidPrefix()
+	}
+	return xaRecoverXidPrefix
+}
+
 // GetID returns a new txnid.
 func (mgr *TxnManager) GetID() uint64 {
 	return atomic.AddUint64(&mgr.txnid, 1)
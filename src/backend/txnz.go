@@ -84,19 +84,23 @@ var (
 	}
 
 	xaStates = map[int32]string{
-		int32(txnXAStateNone):             "txnXAStateNone",
-		int32(txnXAStateStart):            "txnXAStateStart",
-		int32(txnXAStateStartFinished):    "txnXAStateStartFinished",
-		int32(txnXAStateEnd):              "txnXAStateEnd",
-		int32(txnXAStateEndFinished):      "txnXAStateEndFinished",
-		int32(txnXAStatePrepare):          "txnXAStatePrepare",
-		int32(txnXAStatePrepareFinished):  "txnXAStatePrepareFinished",
-		int32(txnXAStateCommit):           "txnXAStateCommit",
-		int32(txnXAStateCommitFinished):   "txnXAStateCommitFinished",
-		int32(txnXAStateRollback):         "txnXAStateRollback",
-		int32(txnXAStateRollbackFinished): "txnXAStateRollbackFinished",
-		int32(txnXAStateRecover):          "txnXAStateRecover",
-		int32(txnXAStateRecoverFinished):  "txnXAStateRecoverFinished",
+		int32(txnXAStateNone):              "txnXAStateNone",
+		int32(txnXAStateStart):             "txnXAStateStart",
+		int32(txnXAStateStartFinished):     "txnXAStateStartFinished",
+		int32(txnXAStateEnd):               "txnXAStateEnd",
+		int32(txnXAStateEndFinished):       "txnXAStateEndFinished",
+		int32(txnXAStatePrepare):           "txnXAStatePrepare",
+		int32(txnXAStatePrepareFinished):   "txnXAStatePrepareFinished",
+		int32(txnXAStateCommit):            "txnXAStateCommit",
+		int32(txnXAStateCommitFinished):    "txnXAStateCommitFinished",
+		int32(txnXAStateRollback):          "txnXAStateRollback",
+		int32(txnXAStateRollbackFinished):  "txnXAStateRollbackFinished",
+		int32(txnXAStateRecover):           "txnXAStateRecover",
+		int32(txnXAStateRecoverFinished):   "txnXAStateRecoverFinished",
+		int32(txnXAStateSavepoint):         "txnXAStateSavepoint",
+		int32(txnXAStateSavepointFinished): "txnXAStateSavepointFinished",
+		int32(txnXAStateSnapshot):          "txnXAStateSnapshot",
+		int32(txnXAStateSnapshotFinished):  "txnXAStateSnapshotFinished",
 	}
 )
 
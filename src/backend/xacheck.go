@@ -54,21 +54,28 @@ type XaCheck struct {
 	dir     string
 	scatter *Scatter
 	retrys  map[string]*XaCommitErr
-	done    chan bool
-	ticker  *time.Ticker
-	wg      sync.WaitGroup
-	mu      sync.RWMutex
+	// nodeID is the id of this radon in the xid.
+	nodeID string
+	// decisions is the commit decisions log of the 2PC.
+	decisions *XaDecisionLog
+	// recovers are the results of the XA recovery on startup.
+	recovers []*XaRecoverResult
+	done     chan bool
+	ticker   *time.Ticker
+	wg       sync.WaitGroup
+	mu       sync.RWMutex
 }
 
 // NewXaCheck creates the XaCheck tuple.
 func NewXaCheck(scatter *Scatter, conf *config.ScatterConfig) *XaCheck {
 	return &XaCheck{
-		log:     scatter.log,
-		dir:     conf.XaCheckDir,
-		scatter: scatter,
-		retrys:  make(map[string]*XaCommitErr),
-		done:    make(chan bool),
-		ticker:  time.NewTicker(time.Duration(time.Second * time.Duration(conf.XaCheckInterval))),
+		log:       scatter.log,
+		dir:       conf.XaCheckDir,
+		scatter:   scatter,
+		retrys:    make(map[string]*XaCommitErr),
+		decisions: NewXaDecisionLog(scatter.log, conf.XaCheckDir),
+		done:      make(chan bool),
+		ticker:    time.NewTicker(time.Duration(time.Second * time.Duration(conf.XaCheckInterval))),
 	}
 }
 
@@ -82,10 +89,20 @@ func (xc *XaCheck) Init() error {
 		return err
 	}
 
+	if err := xc.loadXaNodeID(); err != nil {
+		return err
+	}
+
 	if err := xc.LoadXaCommitErrLogs(); err != nil {
 		return err
 	}
 
+	if err := xc.decisions.Init(); err != nil {
+		return err
+	}
+	// Recover the in-doubt XAs before serving.
+	xc.xaRecover()
+
 	xc.wg.Add(1)
 	go func(dc *XaCheck) {
 		defer dc.wg.Done()
@@ -318,6 +335,17 @@ func (xc *XaCheck) LoadXaCommitErrLogs() error {
 func (xc *XaCheck) Close() {
 	close(xc.done)
 	xc.wg.Wait()
+	xc.decisions.Close()
+}
+
+// WriteXaDecision is used to write the commit decision of the txn into the decision log.
+func (xc *XaCheck) WriteXaDecision(txn *Txn) error {
+	return xc.decisions.Write(txn.xid, txnXACommitErrStateCommit)
+}
+
+// FinishXaDecision is used to remove the commit decision of the txn after the XA COMMIT.
+func (xc *XaCheck) FinishXaDecision(txn *Txn) {
+	xc.decisions.Finish(txn.xid)
 }
 
 // GetXaCheckFile get the XaCheck log file
@@ -0,0 +1,290 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package backend
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"xbase"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+const (
+	xadecisionLogFile = "xadecision.log"
+
+	// xadecisionCompactRecords is the number of the records appended to compact the log.
+	xadecisionCompactRecords = 10000
+)
+
+// XaDecision tuple.
+// It's the commit decision of the XA, made after all the branches are prepared.
+type XaDecision struct {
+	Time  string `json:"time"`
+	Xaid  string `json:"xaid"`
+	State string `json:"state"`
+}
+
+// XaDecisionLog tuple.
+// The decisions are appended and synced to the log before the XA COMMIT, so the
+// XA prepared before radon crashes can be committed by the recovery. The XA without
+// decision is rollbacked(presumed abort).
+// The decisions written concurrently are grouped into one batch and synced once,
+// the commits don't wait for the fsyncs of each other one by one.
+type XaDecisionLog struct {
+	log     *xlog.Log
+	file    string
+	fd      *os.File
+	records int
+	// pending are the decisions whose XA COMMIT is not finished.
+	pending map[string]*XaDecision
+	// loaded are the decisions read from the log on startup, they are kept
+	// until the in-doubt XAs on all the backends are recovered.
+	loaded map[string]*XaDecision
+	// batch collects the decisions waiting for the next sync.
+	batch *xadecisionBatch
+	// syncing is true if one writer is syncing the batches, or the log is compacting.
+	syncing bool
+	mu      sync.Mutex
+}
+
+// xadecisionBatch is a group of decisions synced to the log together.
+type xadecisionBatch struct {
+	buf       bytes.Buffer
+	decisions []*XaDecision
+	err       error
+	done      chan struct{}
+}
+
+func newXaDecisionBatch() *xadecisionBatch {
+	return &xadecisionBatch{
+		done: make(chan struct{}),
+	}
+}
+
+// NewXaDecisionLog creates the XaDecisionLog tuple.
+func NewXaDecisionLog(log *xlog.Log, dir string) *XaDecisionLog {
+	return &XaDecisionLog{
+		log:     log,
+		file:    path.Join(dir, xadecisionLogFile),
+		pending: make(map[string]*XaDecision),
+		loaded:  make(map[string]*XaDecision),
+		batch:   newXaDecisionBatch(),
+	}
+}
+
+// Init used to load the decisions from the log and open it for appending.
+func (dl *XaDecisionLog) Init() error {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+
+	if err := dl.load(); err != nil {
+		return err
+	}
+	return dl.open()
+}
+
+func (dl *XaDecisionLog) load() error {
+	log := dl.log
+	if _, err := os.Stat(dl.file); os.IsNotExist(err) {
+		return nil
+	}
+	data, err := ioutil.ReadFile(dl.file)
+	if err != nil {
+		log.Error("xadecision.load.readfile[%v].error:%v", dl.file, err)
+		return err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		decision := &XaDecision{}
+		if err := json.Unmarshal(line, decision); err != nil {
+			// The last record may be written partially if radon crashes, the XA is not committed.
+			log.Warning("xadecision.load.record[%s].invalid.skip:%v", line, err)
+			continue
+		}
+		dl.loaded[decision.Xaid] = decision
+	}
+	log.Info("xadecision.load.decisions:%v", len(dl.loaded))
+	return scanner.Err()
+}
+
+func (dl *XaDecisionLog) open() error {
+	fd, err := os.OpenFile(dl.file, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	dl.fd = fd
+	return nil
+}
+
+// Write used to append the decision of the xid to the log and sync it.
+// The writer finding no sync in progress syncs the batches until there is none left,
+// the others wait for the batch they joined.
+func (dl *XaDecisionLog) Write(xid string, state string) error {
+	decision := &XaDecision{
+		Time:  time.Now().Format("20060102150405"),
+		Xaid:  xid,
+		State: state,
+	}
+	line, err := json.Marshal(decision)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	dl.mu.Lock()
+	if dl.fd == nil {
+		dl.mu.Unlock()
+		return errors.New("xadecision.log.closed")
+	}
+	batch := dl.batch
+	batch.buf.Write(line)
+	batch.buf.WriteByte('\n')
+	batch.decisions = append(batch.decisions, decision)
+	leader := !dl.syncing
+	dl.syncing = true
+	dl.mu.Unlock()
+
+	if leader {
+		dl.sync()
+	}
+	<-batch.done
+	return batch.err
+}
+
+// sync used to write and sync the batches one by one until no decision is waiting.
+// The decisions are added to the pending before the batch is done, so the compaction
+// never drops a decision already synced.
+func (dl *XaDecisionLog) sync() {
+	for {
+		dl.mu.Lock()
+		batch := dl.batch
+		if len(batch.decisions) == 0 {
+			dl.syncing = false
+			dl.mu.Unlock()
+			return
+		}
+		dl.batch = newXaDecisionBatch()
+		fd := dl.fd
+		dl.mu.Unlock()
+
+		if fd == nil {
+			batch.err = errors.New("xadecision.log.closed")
+		} else if _, err := fd.Write(batch.buf.Bytes()); err != nil {
+			batch.err = errors.WithStack(err)
+		} else if err := fd.Sync(); err != nil {
+			batch.err = errors.WithStack(err)
+		}
+
+		dl.mu.Lock()
+		if batch.err == nil {
+			for _, decision := range batch.decisions {
+				dl.pending[decision.Xaid] = decision
+			}
+			dl.records += len(batch.decisions)
+		}
+		dl.mu.Unlock()
+		close(batch.done)
+	}
+}
+
+// Finish used to remove the decision of the xid after its XA COMMIT is finished.
+// The log is compacted to the decisions still needed if it grows too long.
+func (dl *XaDecisionLog) Finish(xid string) {
+	log := dl.log
+
+	dl.mu.Lock()
+	delete(dl.pending, xid)
+	compact := dl.records >= xadecisionCompactRecords
+	dl.mu.Unlock()
+	if compact {
+		if err := dl.tryCompact(); err != nil {
+			log.Error("xadecision.compact.error:%+v", err)
+		}
+	}
+}
+
+// Get returns the decision of the xid loaded on startup, nil if there is none.
+func (dl *XaDecisionLog) Get(xid string) *XaDecision {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	return dl.loaded[xid]
+}
+
+// Recovered used to drop the decisions loaded on startup after the in-doubt XAs are recovered.
+func (dl *XaDecisionLog) Recovered() error {
+	dl.mu.Lock()
+	dl.loaded = make(map[string]*XaDecision)
+	dl.mu.Unlock()
+	return dl.tryCompact()
+}
+
+// tryCompact used to compact the log if no batch is syncing, the decisions written
+// during the compaction are synced to the new log after it.
+func (dl *XaDecisionLog) tryCompact() error {
+	dl.mu.Lock()
+	if dl.syncing {
+		dl.mu.Unlock()
+		return nil
+	}
+	dl.syncing = true
+	err := dl.compact()
+	dl.mu.Unlock()
+
+	dl.sync()
+	return err
+}
+
+// compact used to rewrite the log with the pending and loaded decisions.
+func (dl *XaDecisionLog) compact() error {
+	var buf bytes.Buffer
+	for _, decisions := range []map[string]*XaDecision{dl.loaded, dl.pending} {
+		for _, decision := range decisions {
+			line, err := json.Marshal(decision)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			buf.Write(line)
+			buf.WriteByte('\n')
+		}
+	}
+
+	tmp := dl.file + ".tmp"
+	if err := xbase.WriteFile(tmp, buf.Bytes()); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dl.file); err != nil {
+		return errors.WithStack(err)
+	}
+	if dl.fd != nil {
+		dl.fd.Close()
+		dl.fd = nil
+	}
+	dl.records = 0
+	return dl.open()
+}
+
+// Close used to close the log.
+func (dl *XaDecisionLog) Close() {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	if dl.fd != nil {
+		dl.fd.Close()
+		dl.fd = nil
+	}
+}
@@ -0,0 +1,175 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package backend
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"fakedb"
+	"xcontext"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestXaDecisionLog(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	dir := fakedb.GetTmpDir("/tmp", "xadecision", log)
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, xadecisionLogFile)
+
+	dl := NewXaDecisionLog(log, dir)
+	err := dl.Init()
+	assert.Nil(t, err)
+	err = dl.Write("RXID-20180903103145-1", txnXACommitErrStateCommit)
+	assert.Nil(t, err)
+	err = dl.Write("RXID-20180903103145-2", txnXACommitErrStateCommit)
+	assert.Nil(t, err)
+	dl.Finish("RXID-20180903103145-1")
+	dl.Close()
+
+	// The record written partially is skipped.
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND, 0644)
+	assert.Nil(t, err)
+	f.WriteString(`{"time":"20180903103145","xaid":"RXID-2018`)
+	f.Close()
+
+	// The decisions are loaded on startup.
+	{
+		dl := NewXaDecisionLog(log, dir)
+		err := dl.Init()
+		assert.Nil(t, err)
+		assert.NotNil(t, dl.Get("RXID-20180903103145-1"))
+		assert.NotNil(t, dl.Get("RXID-20180903103145-2"))
+		assert.Equal(t, 2, len(dl.loaded))
+
+		err = dl.Recovered()
+		assert.Nil(t, err)
+		assert.Nil(t, dl.Get("RXID-20180903103145-1"))
+		data, err := ioutil.ReadFile(file)
+		assert.Nil(t, err)
+		assert.Equal(t, "", string(data))
+
+		// The log is compacted to the pending decisions.
+		err = dl.Write("RXID-20180903103145-3", txnXACommitErrStateCommit)
+		assert.Nil(t, err)
+		err = dl.Write("RXID-20180903103145-4", txnXACommitErrStateCommit)
+		assert.Nil(t, err)
+		dl.records = xadecisionCompactRecords
+		dl.Finish("RXID-20180903103145-3")
+		data, err = ioutil.ReadFile(file)
+		assert.Nil(t, err)
+		assert.False(t, strings.Contains(string(data), "RXID-20180903103145-3"))
+		assert.True(t, strings.Contains(string(data), "RXID-20180903103145-4"))
+		dl.Close()
+
+		// Write after closed.
+		err = dl.Write("RXID-20180903103145-5", txnXACommitErrStateCommit)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestXaDecisionLogGroupCommit(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	dir := fakedb.GetTmpDir("/tmp", "xadecision", log)
+	defer os.RemoveAll(dir)
+
+	dl := NewXaDecisionLog(log, dir)
+	err := dl.Init()
+	assert.Nil(t, err)
+	defer dl.Close()
+
+	var wg sync.WaitGroup
+	n := 64
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := dl.Write(fmt.Sprintf("RXID-20180903103145-%d", i), txnXACommitErrStateCommit)
+			assert.Nil(t, err)
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, n, len(dl.pending))
+	assert.Equal(t, n, dl.records)
+	assert.False(t, dl.syncing)
+
+	data, err := ioutil.ReadFile(path.Join(dir, xadecisionLogFile))
+	assert.Nil(t, err)
+	assert.Equal(t, n, strings.Count(string(data), "\n"))
+}
+
+func TestTxnTwoPCCommitDecision(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	scatter, fakedb, cleanup := MockScatter(log, 2)
+	defer cleanup()
+
+	conf := MockScatterDefault(log)
+	defer os.RemoveAll(conf.XaCheckDir)
+	err := scatter.Init(conf)
+	assert.Nil(t, err)
+	backends := scatter.Backends()
+
+	fakedb.AddQueryPattern("XA .*", result1)
+	fakedb.AddQueryPattern("insert .*", result2)
+
+	write := func(txn *Txn) {
+		err := txn.Begin()
+		assert.Nil(t, err)
+		rctx := &xcontext.RequestContext{
+			TxnMode: xcontext.TxnWrite,
+			Querys: []xcontext.QueryTuple{
+				{Query: "insert into node1 values(1)", Backend: backends[0]},
+				{Query: "insert into node2 values(1)", Backend: backends[1]},
+			},
+		}
+		_, err = txn.Execute(rctx)
+		assert.Nil(t, err)
+	}
+
+	// The decision is written before the XA COMMIT.
+	{
+		txn, err := scatter.CreateTransaction()
+		assert.Nil(t, err)
+		defer txn.Finish()
+		write(txn)
+		xid := txn.XID()
+		assert.True(t, strings.HasPrefix(xid, scatter.txnMgr.xaCheck.XidPrefix()))
+
+		err = txn.Commit()
+		assert.Nil(t, err)
+		assert.Equal(t, 2, fakedb.GetQueryCalledNum(fmt.Sprintf("XA COMMIT '%s'", xid)))
+		data, err := ioutil.ReadFile(path.Join(conf.XaCheckDir, xadecisionLogFile))
+		assert.Nil(t, err)
+		assert.True(t, strings.Contains(string(data), xid))
+	}
+
+	// The XA is rollbacked if the decision fails to write.
+	{
+		txn, err := scatter.CreateTransaction()
+		assert.Nil(t, err)
+		defer txn.Finish()
+		write(txn)
+		xid := txn.XID()
+
+		scatter.txnMgr.xaCheck.decisions.Close()
+		err = txn.Commit()
+		assert.NotNil(t, err)
+		assert.Equal(t, 0, fakedb.GetQueryCalledNum(fmt.Sprintf("XA COMMIT '%s'", xid)))
+		assert.Equal(t, 2, fakedb.GetQueryCalledNum(fmt.Sprintf("XA ROLLBACK '%s'", xid)))
+	}
+}
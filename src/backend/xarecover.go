@@ -0,0 +1,205 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package backend
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"xbase"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// xaRecoverXidPrefix is the prefix of the xid generated by radon.
+	xaRecoverXidPrefix = "RXID-"
+
+	// xaNodeIDFile keeps the node id of the radon, it's part of the xid to
+	// tell the XAs of this node from the XAs of the other radons sharing the backends.
+	xaNodeIDFile = "xanode.id"
+
+	xaRecoverActionRecover = "recover"
+)
+
+// XaRecoverResult tuple.
+// It's the result of the in-doubt XA recovered on the backend, or the XA RECOVER error
+// of the backend if the Action is 'recover'.
+type XaRecoverResult struct {
+	Time    string `json:"time"`
+	Backend string `json:"backend"`
+	Xaid    string `json:"xaid"`
+	Action  string `json:"action"`
+	Error   string `json:"error"`
+}
+
+// loadXaNodeID used to load the node id from the xacheck dir, a random one is
+// generated and persisted on the first startup.
+func (xc *XaCheck) loadXaNodeID() error {
+	log := xc.log
+	file := path.Join(xc.dir, xaNodeIDFile)
+	if _, err := os.Stat(file); err == nil {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		nodeID := strings.TrimSpace(string(data))
+		if nodeID == "" || strings.Contains(nodeID, "-") {
+			return errors.Errorf("xacheck.invalid.node.id[%s].in.file[%v]", nodeID, file)
+		}
+		xc.nodeID = nodeID
+		return nil
+	}
+
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return errors.WithStack(err)
+	}
+	nodeID := hex.EncodeToString(buf)
+	if err := xbase.WriteFile(file, []byte(nodeID)); err != nil {
+		return err
+	}
+	log.Info("xacheck.generate.node.id[%v]", nodeID)
+	xc.nodeID = nodeID
+	return nil
+}
+
+// XidPrefix returns the prefix of the xids generated by this node.
+func (xc *XaCheck) XidPrefix() string {
+	return fmt.Sprintf("%s%s-", xaRecoverXidPrefix, xc.nodeID)
+}
+
+// xaRecover used to recover the XAs prepared but not finished before radon restarts.
+// 1. XA RECOVER on every backend to find the in-doubt XAs of this node(by the xid prefix)
+// 2. XA COMMIT the XA has the commit decision in the log, or else XA ROLLBACK(presumed abort)
+// The XAs of the other radons sharing the backends are in flight and left to their owners.
+// The XA failed to finish is retried by the xacheck, the decisions are dropped only if all the
+// backends are recovered.
+func (xc *XaCheck) xaRecover() {
+	log := xc.log
+	scatter := xc.scatter
+
+	var results []*XaRecoverResult
+	addResult := func(backend, xid, action string, err error) {
+		result := &XaRecoverResult{
+			Time:    time.Now().Format("20060102150405"),
+			Backend: backend,
+			Xaid:    xid,
+			Action:  action,
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+
+	recovered := true
+	defer func() {
+		if recovered {
+			if err := xc.decisions.Recovered(); err != nil {
+				log.Error("xacheck.xa.recover.decisions.compact.error:%+v", err)
+			}
+		}
+		xc.mu.Lock()
+		xc.recovers = results
+		xc.mu.Unlock()
+	}()
+
+	txn, err := scatter.CreateTransaction()
+	if err != nil {
+		log.Error("xacheck.xa.recover.create.transaction.error:[%v]", err)
+		recovered = false
+		return
+	}
+	defer txn.Finish()
+
+	prefix := xc.XidPrefix()
+	for _, backend := range scatter.Backends() {
+		result, err := txn.ExecuteOnThisBackend(backend, "XA RECOVER")
+		if err != nil {
+			log.Error("xacheck.xa.recover.backend[%v].error:[%v]", backend, err)
+			addResult(backend, "", xaRecoverActionRecover, err)
+			recovered = false
+			continue
+		}
+		if len(result.Fields) != 4 {
+			continue
+		}
+
+		for _, row := range result.Rows {
+			xid := string(row[3].Raw())
+			if !strings.HasPrefix(xid, prefix) {
+				continue
+			}
+
+			xc.mu.Lock()
+			_, retry := xc.retrys[xid]
+			xc.mu.Unlock()
+			// The xacheck retries the XA failed to commit or rollback.
+			if retry {
+				continue
+			}
+
+			state := txnXACommitErrStateRollback
+			if decision := xc.decisions.Get(xid); decision != nil && decision.State == txnXACommitErrStateCommit {
+				state = txnXACommitErrStateCommit
+			}
+			query := fmt.Sprintf("XA %s '%s'", strings.ToUpper(state), xid)
+			if _, err := txn.ExecuteOnThisBackend(backend, query); err != nil {
+				log.Error("xacheck.xa.recover.backend[%v].query[%v].error:[%v]", backend, query, err)
+				addResult(backend, xid, state, err)
+				xc.addXaRecoverRetry(xid, state)
+				continue
+			}
+			log.Warning("xacheck.xa.recover.backend[%v].query[%v].done", backend, query)
+			addResult(backend, xid, state, nil)
+		}
+	}
+}
+
+// addXaRecoverRetry used to add the XA failed to recover to the xacheck retrys.
+func (xc *XaCheck) addXaRecoverRetry(xid string, state string) {
+	log := xc.log
+	xaCommitErr := &XaCommitErr{
+		Time:  time.Now().Format("20060102150405"),
+		Xaid:  xid,
+		State: state,
+	}
+
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	if _, ok := xc.retrys[xid]; ok {
+		return
+	}
+	if err := xc.addXaCommitErrLog(xaCommitErr); err != nil {
+		log.Error("xacheck.xa.recover.add.retry.error:%+v", err)
+		return
+	}
+	if err := xc.flushXaCommitErrLog(); err != nil {
+		log.Error("xacheck.xa.recover.flush.retry.error:%+v", err)
+	}
+}
+
+// GetXaRecoverResults returns the results of the XA recovery on startup.
+func (xc *XaCheck) GetXaRecoverResults() []XaRecoverResult {
+	xc.mu.RLock()
+	defer xc.mu.RUnlock()
+
+	results := make([]XaRecoverResult, 0, len(xc.recovers))
+	for _, result := range xc.recovers {
+		results = append(results, *result)
+	}
+	return results
+}
@@ -0,0 +1,196 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package backend
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"fakedb"
+
+	"github.com/fortytw2/leaktest"
+	"github.com/stretchr/testify/assert"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestXaRecover(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+
+	data := `{"time":"20180903103145","xaid":"RXID-n1-20180903103145-1","state":"commit"}
+{"time":"20180903103145","xaid":"RXID-n1-20180903103145-3","state":"commit"}
+`
+	dir := fakedb.GetTmpDir("/tmp", "xacheck", log)
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, xadecisionLogFile)
+	ioutil.WriteFile(file, []byte(data), 0644)
+	ioutil.WriteFile(path.Join(dir, xaNodeIDFile), []byte("n1"), 0644)
+
+	xaRecoverResult := &sqltypes.Result{
+		RowsAffected: 4,
+		Fields: []*querypb.Field{
+			{Name: "formatID", Type: querypb.Type_INT64},
+			{Name: "gtrid_length", Type: querypb.Type_INT64},
+			{Name: "bqual_length", Type: querypb.Type_INT64},
+			{Name: "data", Type: querypb.Type_VARCHAR},
+		},
+		Rows: [][]sqltypes.Value{
+			{
+				sqltypes.MakeTrusted(querypb.Type_INT64, []byte("1")),
+				sqltypes.MakeTrusted(querypb.Type_INT64, []byte("21")),
+				sqltypes.MakeTrusted(querypb.Type_INT64, []byte("0")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("RXID-n1-20180903103145-1")),
+			},
+			{
+				sqltypes.MakeTrusted(querypb.Type_INT64, []byte("1")),
+				sqltypes.MakeTrusted(querypb.Type_INT64, []byte("21")),
+				sqltypes.MakeTrusted(querypb.Type_INT64, []byte("0")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("RXID-n1-20180903103145-2")),
+			},
+			{
+				sqltypes.MakeTrusted(querypb.Type_INT64, []byte("1")),
+				sqltypes.MakeTrusted(querypb.Type_INT64, []byte("6")),
+				sqltypes.MakeTrusted(querypb.Type_INT64, []byte("0")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("other1")),
+			},
+			{
+				sqltypes.MakeTrusted(querypb.Type_INT64, []byte("1")),
+				sqltypes.MakeTrusted(querypb.Type_INT64, []byte("24")),
+				sqltypes.MakeTrusted(querypb.Type_INT64, []byte("0")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("RXID-n2-20180903103145-2")),
+			},
+		},
+	}
+
+	// XA RECOVER fails, the decisions are kept.
+	{
+		scatter, fakedb, cleanup := MockScatter(log, 2)
+		fakedb.AddQueryError("XA RECOVER", errors.New("mock.xa.recover.error"))
+		err := scatter.Init(MockScatterDefault2(dir))
+		assert.Nil(t, err)
+
+		results := scatter.XaRecoverz()
+		assert.Equal(t, 2, len(results))
+		for _, result := range results {
+			assert.Equal(t, xaRecoverActionRecover, result.Action)
+			assert.Equal(t, "mock.xa.recover.error (errno 1105) (sqlstate HY000)", result.Error)
+		}
+		cleanup()
+
+		got, err := ioutil.ReadFile(file)
+		assert.Nil(t, err)
+		assert.Equal(t, data, string(got))
+	}
+
+	// The XA with commit decision is committed, the others are rollbacked.
+	{
+		scatter, fakedb, cleanup := MockScatter(log, 2)
+		defer cleanup()
+		fakedb.AddQuery("XA RECOVER", xaRecoverResult)
+		fakedb.AddQueryPattern("XA COMMIT .*", result1)
+		fakedb.AddQueryPattern("XA ROLLBACK .*", result1)
+		err := scatter.Init(MockScatterDefault2(dir))
+		assert.Nil(t, err)
+
+		assert.Equal(t, 2, fakedb.GetQueryCalledNum("XA COMMIT 'RXID-n1-20180903103145-1'"))
+		assert.Equal(t, 2, fakedb.GetQueryCalledNum("XA ROLLBACK 'RXID-n1-20180903103145-2'"))
+		assert.Equal(t, 0, fakedb.GetQueryCalledNum("XA ROLLBACK 'other1'"))
+		// The XA of the other radon is left to its owner.
+		assert.Equal(t, 0, fakedb.GetQueryCalledNum("XA ROLLBACK 'RXID-n2-20180903103145-2'"))
+
+		results := scatter.XaRecoverz()
+		assert.Equal(t, 4, len(results))
+		for _, result := range results {
+			switch result.Xaid {
+			case "RXID-n1-20180903103145-1":
+				assert.Equal(t, "commit", result.Action)
+			case "RXID-n1-20180903103145-2":
+				assert.Equal(t, "rollback", result.Action)
+			}
+			assert.Equal(t, "", result.Error)
+		}
+
+		// All the backends are recovered, the decisions are dropped.
+		got, err := ioutil.ReadFile(file)
+		assert.Nil(t, err)
+		assert.Equal(t, "", string(got))
+	}
+}
+
+func TestXaRecoverRetry(t *testing.T) {
+	defer leaktest.Check(t)()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+
+	dir := fakedb.GetTmpDir("/tmp", "xacheck", log)
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(path.Join(dir, xaNodeIDFile), []byte("n1"), 0644)
+
+	xaRecoverResult := &sqltypes.Result{
+		RowsAffected: 1,
+		Fields: []*querypb.Field{
+			{Name: "formatID", Type: querypb.Type_INT64},
+			{Name: "gtrid_length", Type: querypb.Type_INT64},
+			{Name: "bqual_length", Type: querypb.Type_INT64},
+			{Name: "data", Type: querypb.Type_VARCHAR},
+		},
+		Rows: [][]sqltypes.Value{
+			{
+				sqltypes.MakeTrusted(querypb.Type_INT64, []byte("1")),
+				sqltypes.MakeTrusted(querypb.Type_INT64, []byte("24")),
+				sqltypes.MakeTrusted(querypb.Type_INT64, []byte("0")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("RXID-n1-20180903103145-1")),
+			},
+		},
+	}
+
+	scatter, fakedb, cleanup := MockScatter(log, 2)
+	defer cleanup()
+	fakedb.AddQuery("XA RECOVER", xaRecoverResult)
+	fakedb.AddQueryErrorPattern("XA ROLLBACK .*", errors.New("mock.xa.rollback.error"))
+	err := scatter.Init(MockScatterDefault2(dir))
+	assert.Nil(t, err)
+
+	// The XA failed to rollback is retried by the xacheck on all the backends.
+	results := scatter.XaRecoverz()
+	assert.Equal(t, 1, len(results))
+	assert.Equal(t, "rollback", results[0].Action)
+	assert.NotEqual(t, "", results[0].Error)
+	assert.Equal(t, 1, scatter.txnMgr.xaCheck.GetRetrysLen())
+}
+
+func TestXaNodeID(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	dir := fakedb.GetTmpDir("/tmp", "xacheck", log)
+	defer os.RemoveAll(dir)
+
+	scatter, _, cleanup := MockScatter(log, 2)
+	defer cleanup()
+	xc := NewXaCheck(scatter, MockScatterDefault2(dir))
+	defer xc.ticker.Stop()
+
+	// The node id is generated on the first startup and kept.
+	err := xc.loadXaNodeID()
+	assert.Nil(t, err)
+	prefix := xc.XidPrefix()
+	assert.True(t, strings.HasPrefix(prefix, xaRecoverXidPrefix))
+	err = xc.loadXaNodeID()
+	assert.Nil(t, err)
+	assert.Equal(t, prefix, xc.XidPrefix())
+
+	// Invalid node id.
+	ioutil.WriteFile(path.Join(dir, xaNodeIDFile), []byte("n-1"), 0644)
+	err = xc.loadXaNodeID()
+	assert.NotNil(t, err)
+}
@@ -31,6 +31,10 @@ type ProxyConfig struct {
 	PeerAddress         string `json:"peer-address,omitempty"`
 	BackupDefaultEngine string `json:"backup-default-engine"`
 	LongQueryTime       int    `json:"long-query-time"`
+	SubqueryMaxRows     int    `json:"subquery-max-rows"`
+
+	InsertSelectBatchRows int `json:"insert-select-batch-rows"`
+	InsertSelectMaxRows   int `json:"insert-select-max-rows"`
 }
 
 // DefaultProxyConfig returns default proxy config.
@@ -45,6 +49,10 @@ func DefaultProxyConfig() *ProxyConfig {
 		PeerAddress:         "127.0.0.1:8080",
 		BackupDefaultEngine: "TokuDB", // Default MySQL storage engine for backup.
 		LongQueryTime:       5,        // 5 seconds
+		SubqueryMaxRows:     10000,    // The max rows of the subquery result substituted in the query.
+
+		InsertSelectBatchRows: 1000,    // The rows of one batch inserted by INSERT ... SELECT.
+		InsertSelectMaxRows:   1000000, // The max rows inserted by INSERT ... SELECT.
 	}
 }
 
@@ -192,14 +200,51 @@ type PartitionConfig struct {
 	Table   string `json:"table"`
 	Segment string `json:"segment"`
 	Backend string `json:"backend"`
+	// Bound is the upper bound(exclusive) of the RANGE partition, empty means MAXVALUE.
+	Bound string `json:"bound,omitempty"`
+	// ListValues are the values of the LIST partition.
+	ListValues []string `json:"listvalues,omitempty"`
+	// Default is true if it's the DEFAULT partition of LIST, which holds all the unlisted values.
+	Default bool `json:"default,omitempty"`
 }
 
 // TableConfig tuple.
 type TableConfig struct {
-	Name       string             `json:"name"`
-	ShardType  string             `json:"shardtype"`
-	ShardKey   string             `json:"shardkey"`
-	Partitions []*PartitionConfig `json:"partitions"`
+	Name      string `json:"name"`
+	ShardType string `json:"shardtype"`
+	// ShardKey is the sharding key column, the composite key columns are joined by comma.
+	ShardKey string `json:"shardkey"`
+	// ShardKeyType is the column type of the RANGE/LIST sharding key such as int or varchar,
+	// which decides how the partition values are compared.
+	ShardKeyType string             `json:"shardkey-type,omitempty"`
+	Partitions   []*PartitionConfig `json:"partitions"`
+	// Group is the table group, the tables in the same group have the same partition layout.
+	Group string `json:"group,omitempty"`
+	// AutoIncrement is the sequence of the AUTO_INCREMENT column, the name is the column.
+	AutoIncrement *SequenceConfig `json:"auto-increment,omitempty"`
+	// Columns are the columns in the table order, which locate the AUTO_INCREMENT column
+	// of the INSERT without the column list.
+	Columns []string `json:"columns,omitempty"`
+	// UniqueKey is the primary or unique key which identifies the rows, the composite key
+	// columns are joined by comma. UniqueKeyName is its index name.
+	UniqueKey     string `json:"unique-key,omitempty"`
+	UniqueKeyName string `json:"unique-key-name,omitempty"`
+}
+
+// SequenceConfig tuple.
+type SequenceConfig struct {
+	Name      string `json:"name"`
+	Increment int64  `json:"increment"`
+	// Cache is the number of the values reserved by one proxy at a time.
+	Cache int64 `json:"cache"`
+	// Next is the first value which isn't reserved by any proxy.
+	Next int64 `json:"next"`
+}
+
+// SequenceSchemaConfig tuple.
+type SequenceSchemaConfig struct {
+	DB        string            `json:"database"`
+	Sequences []*SequenceConfig `json:"sequences"`
 }
 
 // SchemaConfig tuple.
@@ -258,6 +303,43 @@ func (c *ScatterConfig) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+const (
+	// SpillDirName is the name of the spill directory under the meta-dir, it's not synced to the peers.
+	SpillDirName = "spill"
+)
+
+// SpillConfig tuple.
+type SpillConfig struct {
+	// Enable spills the rows of the sorts and aggregations in the proxy to disk once the memory budget is exceeded.
+	Enable bool `json:"enable"`
+	// MemoryBudget is the memory(in bytes) one query can hold before spilling.
+	MemoryBudget int `json:"memory-budget"`
+	// MaxDiskSize is the max disk usage(in bytes) of all the spilled files, 0 means no limits.
+	MaxDiskSize int `json:"max-disk-size"`
+	// Dir is the spill directory, it's the 'spill' directory under the meta-dir.
+	Dir string `json:"-"`
+}
+
+// DefaultSpillConfig returns default spill config.
+func DefaultSpillConfig() *SpillConfig {
+	return &SpillConfig{
+		Enable:       false,
+		MemoryBudget: 64 * 1024 * 1024,        // 64MB
+		MaxDiskSize:  10 * 1024 * 1024 * 1024, // 10GB
+	}
+}
+
+// UnmarshalJSON interface on SpillConfig.
+func (c *SpillConfig) UnmarshalJSON(b []byte) error {
+	type confAlias *SpillConfig
+	conf := confAlias(DefaultSpillConfig())
+	if err := json.Unmarshal(b, conf); err != nil {
+		return err
+	}
+	*c = SpillConfig(*conf)
+	return nil
+}
+
 // Config tuple.
 type Config struct {
 	Proxy   *ProxyConfig   `json:"proxy"`
@@ -267,6 +349,7 @@ type Config struct {
 	Log     *LogConfig     `json:"log"`
 	Monitor *MonitorConfig `json:"monitor"`
 	Scatter *ScatterConfig `json:"scatter"`
+	Spill   *SpillConfig   `json:"spill"`
 }
 
 func checkConfig(conf *Config) {
@@ -297,6 +380,10 @@ func checkConfig(conf *Config) {
 	if conf.Scatter == nil {
 		conf.Scatter = DefaultScatterConfig()
 	}
+
+	if conf.Spill == nil {
+		conf.Spill = DefaultSpillConfig()
+	}
 }
 
 // LoadConfig used to load the config from file.
@@ -322,6 +409,15 @@ func ReadTableConfig(data string) (*TableConfig, error) {
 	return conf, nil
 }
 
+// ReadSequencesConfig used to read the sequences config from the data.
+func ReadSequencesConfig(data string) ([]*SequenceSchemaConfig, error) {
+	conf := []*SequenceSchemaConfig{}
+	if err := json.Unmarshal([]byte(data), &conf); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return conf, nil
+}
+
 // ReadBackendsConfig used to read the backend config from the data.
 func ReadBackendsConfig(data string) (*BackendsConfig, error) {
 	conf := &BackendsConfig{}
@@ -36,6 +36,7 @@ func TestWriteConfig(t *testing.T) {
 		Router:  DefaultRouterConfig(),
 		Monitor: DefaultMonitorConfig(),
 		Scatter: DefaultScatterConfig(),
+		Spill:   DefaultSpillConfig(),
 	}
 
 	path := path.Join(tmpDir, radonTestJSON)
@@ -75,6 +76,7 @@ func TestLoadConfig(t *testing.T) {
 			Monitor: DefaultMonitorConfig(),
 			Log:     MockLogConfig,
 			Scatter: DefaultScatterConfig(),
+			Spill:   DefaultSpillConfig(),
 		}
 
 		err := WriteConfig(path, conf)
@@ -108,6 +110,7 @@ func TestLoadConfig(t *testing.T) {
 				Router:  DefaultRouterConfig(),
 				Monitor: DefaultMonitorConfig(),
 				Scatter: DefaultScatterConfig(),
+				Spill:   DefaultSpillConfig(),
 			}
 			got, err := LoadConfig(path)
 			assert.Nil(t, err)
@@ -124,6 +127,7 @@ func TestLoadConfig(t *testing.T) {
 			Binlog:  DefaultBinlogConfig(),
 			Monitor: DefaultMonitorConfig(),
 			Scatter: DefaultScatterConfig(),
+			Spill:   DefaultSpillConfig(),
 		}
 
 		err := WriteConfig(path, want)
@@ -160,6 +164,7 @@ func TestWriteLoadConfig(t *testing.T) {
 			Binlog:  DefaultBinlogConfig(),
 			Monitor: DefaultMonitorConfig(),
 			Scatter: DefaultScatterConfig(),
+			Spill:   DefaultSpillConfig(),
 		}
 		got := conf
 		assert.Equal(t, want, got)
@@ -295,6 +300,7 @@ func TestRouterConfigUnmarshalJSON(t *testing.T) {
 			Log:     DefaultLogConfig(),
 			Monitor: DefaultMonitorConfig(),
 			Scatter: DefaultScatterConfig(),
+			Spill:   DefaultSpillConfig(),
 		}
 		assert.Equal(t, want, got)
 	}
@@ -324,6 +330,9 @@ func TestRouterConfigUnmarshalJSON(t *testing.T) {
 	"xacheck": {
 		"xa-check-interval": 1,
 		"xa-check-dir":      "/tmp/xacheck"
+	},
+	"spill": {
+		"enable": true
 	}
 }`
 		err := ioutil.WriteFile(path, []byte(data), 0644)
@@ -333,6 +342,8 @@ func TestRouterConfigUnmarshalJSON(t *testing.T) {
 
 		proxy := DefaultProxyConfig()
 		proxy.Endpoint = ":5566"
+		spill := DefaultSpillConfig()
+		spill.Enable = true
 		want := &Config{
 			Proxy:   proxy,
 			Router:  DefaultRouterConfig(),
@@ -341,6 +352,7 @@ func TestRouterConfigUnmarshalJSON(t *testing.T) {
 			Log:     DefaultLogConfig(),
 			Monitor: DefaultMonitorConfig(),
 			Scatter: DefaultScatterConfig(),
+			Spill:   spill,
 		}
 		assert.Equal(t, want, got)
 	}
@@ -45,11 +45,13 @@ func (admin *Admin) NewRouter() (rest.App, error) {
 		rest.Get("/v1/shard/balanceadvice", v1.ShardBalanceAdviceHandler(log, proxy)),
 		rest.Post("/v1/shard/shift", v1.ShardRuleShiftHandler(log, proxy)),
 		rest.Post("/v1/shard/reload", v1.ShardReLoadHandler(log, proxy)),
+		rest.Post("/v1/shard/listvalues", v1.ShardListValuesHandler(log, proxy)),
 
 		// meta
 		rest.Get("/v1/meta/versions", v1.VersionzHandler(log, proxy)),
 		rest.Get("/v1/meta/versioncheck", v1.VersionCheckHandler(log, proxy)),
 		rest.Get("/v1/meta/metas", v1.MetazHandler(log, proxy)),
+		rest.Post("/v1/meta/sequence/reserve", v1.SequenceReserveHandler(log, proxy)),
 
 		// peer
 		rest.Get("/v1/peer/peerz", v1.PeerzHandler(log, proxy)),
@@ -69,6 +71,7 @@ func (admin *Admin) NewRouter() (rest.App, error) {
 		rest.Get("/v1/debug/processlist", v1.ProcesslistHandler(log, proxy)),
 		rest.Get("/v1/debug/queryz/:limit", v1.QueryzHandler(log, proxy)),
 		rest.Get("/v1/debug/txnz/:limit", v1.TxnzHandler(log, proxy)),
+		rest.Get("/v1/debug/xarecoverz", v1.XaRecoverzHandler(log, proxy)),
 		rest.Get("/v1/debug/configz", v1.ConfigzHandler(log, proxy)),
 		rest.Get("/v1/debug/backendz", v1.BackendzHandler(log, proxy)),
 		rest.Get("/v1/debug/schemaz", v1.SchemazHandler(log, proxy)),
@@ -9,10 +9,12 @@
 package v1
 
 import (
+	"fmt"
 	"net/http"
 
 	"config"
 	"proxy"
+	"syncer"
 
 	"github.com/ant0ine/go-json-rest/rest"
 	"github.com/xelabs/go-mysqlstack/xlog"
@@ -74,3 +76,37 @@ func metazHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *r
 	}
 	w.WriteJson(meta)
 }
+
+// SequenceReserveHandler impl.
+func SequenceReserveHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		sequenceReserveHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+func sequenceReserveHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	p := syncer.SequenceReserve{}
+	err := r.DecodeJsonPayload(&p)
+	if err != nil {
+		log.Error("api.v1.meta.sequence.reserve.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Only the owner reserves the segments, or else the peers may get the same one.
+	sync := proxy.Syncer()
+	if owner := sync.SequenceOwner(); owner != proxy.PeerAddress() {
+		log.Error("api.v1.meta.sequence.reserve[%+v].not.owner[%s]", p, owner)
+		rest.Error(w, fmt.Sprintf("sequence.owner.is[%s]", owner), http.StatusInternalServerError)
+		return
+	}
+
+	start, max, err := sync.ReserveSequence(p.DB, p.Name, p.AutoIncrement)
+	if err != nil {
+		log.Error("api.v1.meta.sequence.reserve[%+v].error:%+v", p, err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteJson(&syncer.SequenceSegment{Start: start, Max: max})
+}
@@ -13,6 +13,7 @@ import (
 	"testing"
 
 	"proxy"
+	"syncer"
 
 	"github.com/ant0ine/go-json-rest/rest"
 	"github.com/ant0ine/go-json-rest/rest/test"
@@ -131,3 +132,48 @@ func TestCtlV1Metaz(t *testing.T) {
 		assert.True(t, got)
 	}
 }
+
+func TestCtlV1SequenceReserve(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	_, proxy, cleanup := proxy.MockProxy(log)
+	defer cleanup()
+
+	err := proxy.Router().CreateSequence("test", "s1", 1, 1, 10)
+	assert.Nil(t, err)
+
+	api := rest.NewApi()
+	router, _ := rest.MakeRouter(
+		rest.Post("/v1/meta/sequence/reserve", SequenceReserveHandler(log, proxy)),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	// 200.
+	{
+		p := &syncer.SequenceReserve{DB: "test", Name: "s1"}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/meta/sequence/reserve", p))
+		recorded.CodeIs(200)
+		recorded.BodyIs(`{"start":1,"max":11}`)
+
+		recorded = test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/meta/sequence/reserve", p))
+		recorded.CodeIs(200)
+		recorded.BodyIs(`{"start":11,"max":21}`)
+	}
+
+	// 500.
+	{
+		p := &syncer.SequenceReserve{DB: "test", Name: "s2"}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/meta/sequence/reserve", p))
+		recorded.CodeIs(500)
+	}
+
+	// Not the owner.
+	{
+		err := proxy.Syncer().AddPeer("127.0.0.1:1")
+		assert.Nil(t, err)
+		p := &syncer.SequenceReserve{DB: "test", Name: "s1"}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/meta/sequence/reserve", p))
+		recorded.CodeIs(500)
+		recorded.BodyIs(`{"Error":"sequence.owner.is[127.0.0.1:1]"}`)
+	}
+}
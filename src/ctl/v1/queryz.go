@@ -34,6 +34,10 @@ func queryzHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *
 		Duration time.Duration `json:"duration"`
 		Color    string        `json:"color"`
 		Query    string        `json:"query"`
+
+		SpillRuns  int64 `json:"spillRuns,omitempty"`
+		SpillRows  int64 `json:"spillRows,omitempty"`
+		SpillBytes int64 `json:"spillBytes,omitempty"`
 	}
 
 	limit := 100
@@ -55,6 +59,10 @@ func queryzHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *
 			Duration: row.Duration,
 			Color:    row.Color,
 			Query:    row.Query,
+
+			SpillRuns:  row.SpillRuns,
+			SpillRows:  row.SpillRows,
+			SpillBytes: row.SpillBytes,
 		}
 		rsp = append(rsp, r)
 	}
@@ -52,12 +52,14 @@ func ShardBalanceAdviceHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFu
 //
 // 3. find the best table(advice-table) to tansfer:
 //    2.1 max.datasize - advice-table-size > min.datasize + advice-table-size
+//    2.2 the co-located partitions in the table group are transferred together as the group-tables
 //
 // Returns:
 // 1. Status:200, Body:null
 // 2. Status:503
 // 3. Status:200, Body:JSON
 func shardBalanceAdviceHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	router := proxy.Router()
 	scatter := proxy.Scatter()
 	spanner := proxy.Spanner()
 	backends := scatter.Backends()
@@ -166,8 +168,9 @@ func shardBalanceAdviceHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.Respons
 		return
 	}
 
-	var tableSize float64
-	var database, table string
+	// The co-located partitions in the table group must be transferred together,
+	// so the size of a partition is the total size of the group partitions.
+	sizes := make(map[string]float64, len(qr.Rows))
 	for _, row := range qr.Rows {
 		db := string(row[0].Raw())
 		tbl := string(row[1].Raw())
@@ -178,6 +181,20 @@ func shardBalanceAdviceHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.Respons
 			rest.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		sizes[db+"."+tbl] = tblSize
+	}
+
+	var tableSize float64
+	var database, table string
+	var groupTables []string
+	for _, row := range qr.Rows {
+		db := string(row[0].Raw())
+		tbl := string(row[1].Raw())
+		partitions := router.GroupPartitions(db, tbl)
+		tblSize := float64(0)
+		for _, partition := range partitions {
+			tblSize += sizes[db+"."+partition]
+		}
 
 		// Make sure the table is small enough.
 		if (min.size + tblSize) < (max.size - tblSize) {
@@ -185,6 +202,9 @@ func shardBalanceAdviceHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.Respons
 			database = db
 			table = tbl
 			tableSize = tblSize
+			if len(partitions) > 1 {
+				groupTables = partitions
+			}
 			break
 		}
 	}
@@ -197,17 +217,18 @@ func shardBalanceAdviceHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.Respons
 	}
 
 	type balanceAdvice struct {
-		From         string  `json:"from-address"`
-		FromDataSize float64 `json:"from-datasize"`
-		FromUser     string  `json:"from-user"`
-		FromPasswd   string  `json:"from-password"`
-		To           string  `json:"to-address"`
-		ToDataSize   float64 `json:"to-datasize"`
-		ToUser       string  `json:"to-user"`
-		ToPasswd     string  `json:"to-password"`
-		Database     string  `json:"database"`
-		Table        string  `json:"table"`
-		TableSize    float64 `json:"tablesize"`
+		From         string   `json:"from-address"`
+		FromDataSize float64  `json:"from-datasize"`
+		FromUser     string   `json:"from-user"`
+		FromPasswd   string   `json:"from-password"`
+		To           string   `json:"to-address"`
+		ToDataSize   float64  `json:"to-datasize"`
+		ToUser       string   `json:"to-user"`
+		ToPasswd     string   `json:"to-password"`
+		Database     string   `json:"database"`
+		Table        string   `json:"table"`
+		TableSize    float64  `json:"tablesize"`
+		GroupTables  []string `json:"group-tables,omitempty"`
 	}
 
 	advice := balanceAdvice{
@@ -222,6 +243,7 @@ func shardBalanceAdviceHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.Respons
 		Database:     database,
 		Table:        table,
 		TableSize:    tableSize,
+		GroupTables:  groupTables,
 	}
 	log.Warning("api.v1.balance.advice.return:%+v", advice)
 	w.WriteJson(advice)
@@ -310,3 +332,41 @@ func shardReLoadHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter
 	}
 	log.Warning("api.shard.reload.done...")
 }
+
+type listValuesParams struct {
+	Database  string   `json:"database"`
+	Table     string   `json:"table"`
+	Partition string   `json:"partition"`
+	Values    []string `json:"values"`
+}
+
+// ShardListValuesHandler used to add values to a partition of the LIST table.
+func ShardListValuesHandler(log *xlog.Log, proxy *proxy.Proxy) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		shardListValuesHandler(log, proxy, w, r)
+	}
+	return f
+}
+
+func shardListValuesHandler(log *xlog.Log, proxy *proxy.Proxy, w rest.ResponseWriter, r *rest.Request) {
+	router := proxy.Router()
+	p := listValuesParams{}
+	err := r.DecodeJsonPayload(&p)
+	if err != nil {
+		log.Error("api.v1.shard.list.values.parse.json.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Warning("api.v1.shard.list.values[from:%v].request:%+v", r.RemoteAddr, p)
+
+	if p.Database == "" || p.Table == "" || p.Partition == "" {
+		rest.Error(w, "api.v1.shard.list.values.request.database.or.table.or.partition.is.null", http.StatusInternalServerError)
+		return
+	}
+
+	if err := router.AddListValues(p.Database, p.Table, p.Partition, p.Values); err != nil {
+		log.Error("api.v1.shard.list.values.AddListValues.error:%+v", err)
+		rest.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
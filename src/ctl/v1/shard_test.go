@@ -18,6 +18,7 @@ import (
 	"github.com/ant0ine/go-json-rest/rest/test"
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
 	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
@@ -54,7 +55,7 @@ func TestCtlV1Shardz(t *testing.T) {
 		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("GET", "http://localhost/v1/shard/shardz", nil))
 		recorded.CodeIs(200)
 
-		want := "{\"Schemas\":[{\"DB\":\"test\",\"Tables\":[{\"Name\":\"t1\",\"ShardKey\":\"id\",\"Partition\":{\"Segments\":[{\"Table\":\"t1_0000\",\"Backend\":\"backend0\",\"Range\":{\"Start\":0,\"End\":128}},{\"Table\":\"t1_0001\",\"Backend\":\"backend0\",\"Range\":{\"Start\":128,\"End\":256}},{\"Table\":\"t1_0002\",\"Backend\":\"backend0\",\"Range\":{\"Start\":256,\"End\":384}},{\"Table\":\"t1_0003\",\"Backend\":\"backend0\",\"Range\":{\"Start\":384,\"End\":512}},{\"Table\":\"t1_0004\",\"Backend\":\"backend0\",\"Range\":{\"Start\":512,\"End\":640}},{\"Table\":\"t1_0005\",\"Backend\":\"backend0\",\"Range\":{\"Start\":640,\"End\":819}},{\"Table\":\"t1_0006\",\"Backend\":\"backend1\",\"Range\":{\"Start\":819,\"End\":947}},{\"Table\":\"t1_0007\",\"Backend\":\"backend1\",\"Range\":{\"Start\":947,\"End\":1075}},{\"Table\":\"t1_0008\",\"Backend\":\"backend1\",\"Range\":{\"Start\":1075,\"End\":1203}},{\"Table\":\"t1_0009\",\"Backend\":\"backend1\",\"Range\":{\"Start\":1203,\"End\":1331}},{\"Table\":\"t1_0010\",\"Backend\":\"backend1\",\"Range\":{\"Start\":1331,\"End\":1459}},{\"Table\":\"t1_0011\",\"Backend\":\"backend1\",\"Range\":{\"Start\":1459,\"End\":1638}},{\"Table\":\"t1_0012\",\"Backend\":\"backend2\",\"Range\":{\"Start\":1638,\"End\":1766}},{\"Table\":\"t1_0013\",\"Backend\":\"backend2\",\"Range\":{\"Start\":1766,\"End\":1894}},{\"Table\":\"t1_0014\",\"Backend\":\"backend2\",\"Range\":{\"Start\":1894,\"End\":2022}},{\"Table\":\"t1_0015\",\"Backend\":\"backend2\",\"Range\":{\"Start\":2022,\"End\":2150}},{\"Table\":\"t1_0016\",\"Backend\":\"backend2\",\"Range\":{\"Start\":2150,\"End\":2278}},{\"Table\":\"t1_0017\",\"Backend\":\"backend2\",\"Range\":{\"Start\":2278,\"End\":2457}},{\"Table\":\"t1_0018\",\"Backend\":\"backend3\",\"Range\":{\"Start\":2457,\"End\":2585}},{\"Table\":\"t1_0019\",\"Backend\":\"backend3\",\"Range\":{\"Start\":2585,\"End\":2713}},{\"Table\":\"t1_0020\",\"Backend\":\"backend3\",\"Range\":{\"Start\":2713,\"End\":2841}},{\"Table\":\"t1_0021\",\"Backend\":\"backend3\",\"Range\":{\"Start\":2841,\"End\":2969}},{\"Table\":\"t1_0022\",\"Backend\":\"backend3\",\"Range\":{\"Start\":2969,\"End\":3097}},{\"Table\":\"t1_0023\",\"Backend\":\"backend3\",\"Range\":{\"Start\":3097,\"End\":3276}},{\"Table\":\"t1_0024\",\"Backend\":\"backend4\",\"Range\":{\"Start\":3276,\"End\":3404}},{\"Table\":\"t1_0025\",\"Backend\":\"backend4\",\"Range\":{\"Start\":3404,\"End\":3532}},{\"Table\":\"t1_0026\",\"Backend\":\"backend4\",\"Range\":{\"Start\":3532,\"End\":3660}},{\"Table\":\"t1_0027\",\"Backend\":\"backend4\",\"Range\":{\"Start\":3660,\"End\":3788}},{\"Table\":\"t1_0028\",\"Backend\":\"backend4\",\"Range\":{\"Start\":3788,\"End\":3916}},{\"Table\":\"t1_0029\",\"Backend\":\"backend4\",\"Range\":{\"Start\":3916,\"End\":4096}}]}}]}]}"
+		want := "{\"Schemas\":[{\"DB\":\"test\",\"Tables\":[{\"Name\":\"t1\",\"ShardKey\":\"id\",\"ShardType\":\"HASH\",\"Partition\":{\"Segments\":[{\"Table\":\"t1_0000\",\"Backend\":\"backend0\",\"Range\":{\"Start\":0,\"End\":128}},{\"Table\":\"t1_0001\",\"Backend\":\"backend0\",\"Range\":{\"Start\":128,\"End\":256}},{\"Table\":\"t1_0002\",\"Backend\":\"backend0\",\"Range\":{\"Start\":256,\"End\":384}},{\"Table\":\"t1_0003\",\"Backend\":\"backend0\",\"Range\":{\"Start\":384,\"End\":512}},{\"Table\":\"t1_0004\",\"Backend\":\"backend0\",\"Range\":{\"Start\":512,\"End\":640}},{\"Table\":\"t1_0005\",\"Backend\":\"backend0\",\"Range\":{\"Start\":640,\"End\":819}},{\"Table\":\"t1_0006\",\"Backend\":\"backend1\",\"Range\":{\"Start\":819,\"End\":947}},{\"Table\":\"t1_0007\",\"Backend\":\"backend1\",\"Range\":{\"Start\":947,\"End\":1075}},{\"Table\":\"t1_0008\",\"Backend\":\"backend1\",\"Range\":{\"Start\":1075,\"End\":1203}},{\"Table\":\"t1_0009\",\"Backend\":\"backend1\",\"Range\":{\"Start\":1203,\"End\":1331}},{\"Table\":\"t1_0010\",\"Backend\":\"backend1\",\"Range\":{\"Start\":1331,\"End\":1459}},{\"Table\":\"t1_0011\",\"Backend\":\"backend1\",\"Range\":{\"Start\":1459,\"End\":1638}},{\"Table\":\"t1_0012\",\"Backend\":\"backend2\",\"Range\":{\"Start\":1638,\"End\":1766}},{\"Table\":\"t1_0013\",\"Backend\":\"backend2\",\"Range\":{\"Start\":1766,\"End\":1894}},{\"Table\":\"t1_0014\",\"Backend\":\"backend2\",\"Range\":{\"Start\":1894,\"End\":2022}},{\"Table\":\"t1_0015\",\"Backend\":\"backend2\",\"Range\":{\"Start\":2022,\"End\":2150}},{\"Table\":\"t1_0016\",\"Backend\":\"backend2\",\"Range\":{\"Start\":2150,\"End\":2278}},{\"Table\":\"t1_0017\",\"Backend\":\"backend2\",\"Range\":{\"Start\":2278,\"End\":2457}},{\"Table\":\"t1_0018\",\"Backend\":\"backend3\",\"Range\":{\"Start\":2457,\"End\":2585}},{\"Table\":\"t1_0019\",\"Backend\":\"backend3\",\"Range\":{\"Start\":2585,\"End\":2713}},{\"Table\":\"t1_0020\",\"Backend\":\"backend3\",\"Range\":{\"Start\":2713,\"End\":2841}},{\"Table\":\"t1_0021\",\"Backend\":\"backend3\",\"Range\":{\"Start\":2841,\"End\":2969}},{\"Table\":\"t1_0022\",\"Backend\":\"backend3\",\"Range\":{\"Start\":2969,\"End\":3097}},{\"Table\":\"t1_0023\",\"Backend\":\"backend3\",\"Range\":{\"Start\":3097,\"End\":3276}},{\"Table\":\"t1_0024\",\"Backend\":\"backend4\",\"Range\":{\"Start\":3276,\"End\":3404}},{\"Table\":\"t1_0025\",\"Backend\":\"backend4\",\"Range\":{\"Start\":3404,\"End\":3532}},{\"Table\":\"t1_0026\",\"Backend\":\"backend4\",\"Range\":{\"Start\":3532,\"End\":3660}},{\"Table\":\"t1_0027\",\"Backend\":\"backend4\",\"Range\":{\"Start\":3660,\"End\":3788}},{\"Table\":\"t1_0028\",\"Backend\":\"backend4\",\"Range\":{\"Start\":3788,\"End\":3916}},{\"Table\":\"t1_0029\",\"Backend\":\"backend4\",\"Range\":{\"Start\":3916,\"End\":4096}}]}}]}]}"
 		got := recorded.Recorder.Body.String()
 		log.Debug(got)
 		assert.Equal(t, want, got)
@@ -165,6 +166,116 @@ func TestCtlV1ShardBalanceAdvice1(t *testing.T) {
 	}
 }
 
+func TestCtlV1ShardBalanceAdviceGroup(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := proxy.MockProxy(log)
+	defer cleanup()
+
+	rdbs := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{
+				Name: "Databases",
+				Type: querypb.Type_VARCHAR,
+			},
+		},
+		Rows: [][]sqltypes.Value{
+			{
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("test")),
+			},
+		},
+	}
+
+	r10 := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{
+				Name: "SizeInMB",
+				Type: querypb.Type_DECIMAL,
+			},
+		},
+		Rows: [][]sqltypes.Value{
+			{
+				sqltypes.MakeTrusted(querypb.Type_DECIMAL, []byte("8192")),
+			},
+		},
+	}
+
+	r11 := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{
+				Name: "SizeInMB",
+				Type: querypb.Type_DECIMAL,
+			},
+		},
+		Rows: [][]sqltypes.Value{
+			{
+				sqltypes.MakeTrusted(querypb.Type_DECIMAL, []byte("3072")),
+			},
+		},
+	}
+
+	r2 := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{
+				Name: "table_schema",
+				Type: querypb.Type_VARCHAR,
+			},
+			{
+				Name: "table_name",
+				Type: querypb.Type_VARCHAR,
+			},
+			{
+				Name: "sizeMB",
+				Type: querypb.Type_DECIMAL,
+			},
+		},
+		Rows: [][]sqltypes.Value{
+			{
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("test")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("orders_0001")),
+				sqltypes.MakeTrusted(querypb.Type_DECIMAL, []byte("1024")),
+			},
+			{
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("test")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("order_items_0001")),
+				sqltypes.MakeTrusted(querypb.Type_DECIMAL, []byte("512")),
+			},
+		},
+	}
+
+	// fakedbs.
+	{
+		fakedbs.AddQuery("show databases", rdbs)
+		fakedbs.AddQuery("create database if not exists `test`", &sqltypes.Result{})
+		fakedbs.AddQuerys("select round((sum(data_length) + sum(index_length)) / 1024/ 1024, 0)  as sizeinmb from information_schema.tables", r10, r11)
+		fakedbs.AddQuery("SELECT table_schema, table_name, ROUND((SUM(data_length+index_length)) / 1024/ 1024, 0) AS sizeMB FROM information_schema.TABLES GROUP BY table_name HAVING SUM(data_length + index_length)>10485760 ORDER BY (data_length + index_length) DESC", r2)
+	}
+
+	// The table group.
+	{
+		backends := proxy.Scatter().Backends()
+		err := proxy.Router().CreateGroupTable("test", "orders", "id", "g1", backends)
+		assert.Nil(t, err)
+		err = proxy.Router().CreateGroupTable("test", "order_items", "order_id", "g1", backends)
+		assert.Nil(t, err)
+	}
+
+	{
+		api := rest.NewApi()
+		router, _ := rest.MakeRouter(
+			rest.Get("/v1/shard/balanceadvice", ShardBalanceAdviceHandler(log, proxy)),
+		)
+		api.SetApp(router)
+		handler := api.MakeHandler()
+
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("GET", "http://localhost/v1/shard/balanceadvice", nil))
+		recorded.CodeIs(200)
+
+		got := recorded.Recorder.Body.String()
+		log.Debug(got)
+		assert.True(t, strings.Contains(got, `"database":"test","table":"orders_0001","tablesize":1536,"group-tables":["order_items_0001","orders_0001"]`))
+	}
+}
+
 func TestCtlV1ShardBalanceAdviceNoBestDifferTooSmall(t *testing.T) {
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
 	fakedbs, proxy, cleanup := proxy.MockProxy(log)
@@ -397,6 +508,7 @@ func TestCtlV1ShardRuleShift(t *testing.T) {
 				"t1": {
 					"Name": "t1",
 					"ShardKey": "id",
+					"ShardType": "HASH",
 					"Partition": {
 						"Segments": [
 							{
@@ -872,3 +984,95 @@ func TestCtlV1ShardReLoadError(t *testing.T) {
 		recorded.CodeIs(405)
 	}
 }
+
+func TestCtlV1ShardListValues(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := proxy.MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+	routei := proxy.Router()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create table .*", &sqltypes.Result{})
+	}
+
+	// create test table.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		query := "create table test.t1(id int, region varchar(8)) partition by list(region) (partition backend0 values in ('bj'), partition backend1 values in ('sz'))"
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+		query = "create table test.t2(id int, region varchar(8)) partition by list(region) (partition backend0 values in ('bj'), partition backend1 default)"
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+
+	api := rest.NewApi()
+	router, _ := rest.MakeRouter(
+		rest.Post("/v1/shard/listvalues", ShardListValuesHandler(log, proxy)),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	// OK.
+	{
+		p := &listValuesParams{
+			Database:  "test",
+			Table:     "t1",
+			Partition: "t1_0000",
+			Values:    []string{"sh", "gz"},
+		}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/shard/listvalues", p))
+		recorded.CodeIs(200)
+
+		conf, err := routei.TableConfig("test", "t1")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"bj", "sh", "gz"}, conf.Partitions[0].ListValues)
+
+		key := sqlparser.NewStrVal([]byte("gz"))
+		segments, err := routei.Lookup("test", "t1", key, key)
+		assert.Nil(t, err)
+		assert.Equal(t, "t1_0000", segments[0].Table)
+	}
+
+	// OK, the values are moved out of the DEFAULT partition.
+	{
+		p := &listValuesParams{
+			Database:  "test",
+			Table:     "t2",
+			Partition: "t2_0000",
+			Values:    []string{"sh"},
+		}
+		recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/shard/listvalues", p))
+		recorded.CodeIs(200)
+
+		key := sqlparser.NewStrVal([]byte("sh"))
+		segments, err := routei.Lookup("test", "t2", key, key)
+		assert.Nil(t, err)
+		assert.Equal(t, "t2_0000", segments[0].Table)
+	}
+
+	// Errors.
+	{
+		params := []*listValuesParams{
+			{Database: "test", Table: "t1"},
+			{Database: "test", Table: "t1", Partition: "t1_0000"},
+			{Database: "test", Table: "t1", Partition: "t1_0000", Values: []string{"bj"}},
+			{Database: "test", Table: "t1", Partition: "t1_000x", Values: []string{"cd"}},
+		}
+		wants := []string{
+			"{\"Error\":\"api.v1.shard.list.values.request.database.or.table.or.partition.is.null\"}",
+			"{\"Error\":\"router.list.values.can.not.be.empty\"}",
+			"{\"Error\":\"list.partition[t1_0000].value[bj].duplicate.with.partition[t1_0000]\"}",
+			"{\"Error\":\"router.list.cant.found.partition[t1_000x].of.table[test.t1]\"}",
+		}
+		for i, p := range params {
+			recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("POST", "http://localhost/v1/shard/listvalues", p))
+			recorded.CodeIs(500)
+			got := recorded.Recorder.Body.String()
+			assert.Equal(t, wants[i], got)
+		}
+	}
+}
@@ -86,3 +86,22 @@ func TestCtlV1Txnz(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+func TestCtlV1XaRecoverz(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	_, proxy, cleanup := proxy.MockProxy(log)
+	defer cleanup()
+
+	api := rest.NewApi()
+	router, _ := rest.MakeRouter(
+		rest.Get("/v1/debug/xarecoverz", XaRecoverzHandler(log, proxy)),
+	)
+	api.SetApp(router)
+	handler := api.MakeHandler()
+
+	// The XA RECOVER isn't mocked, the backends fail to recover.
+	recorded := test.RunRequest(t, handler, test.MakeSimpleRequest("GET", "http://localhost/v1/debug/xarecoverz", nil))
+	recorded.CodeIs(200)
+	got := recorded.Recorder.Body.String()
+	assert.True(t, strings.Contains(got, `"action":"recover"`))
+}
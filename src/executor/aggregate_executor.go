@@ -9,12 +9,25 @@
 package executor
 
 import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"backend"
 	"planner"
 	"xcontext"
 
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/hack"
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
+
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
 )
 
 var (
@@ -22,46 +35,193 @@ var (
 )
 
 // AggregateExecutor represents aggregate executor.
-// Including: COUNT/MAX/MIN/SUM/AVG/GROUPBY.
+// Including: COUNT/MAX/MIN/SUM/AVG/GROUPBY/COUNT(DISTINCT)/SUM(DISTINCT)/HAVING,
+// STDDEV/VARIANCE/BIT_AND/BIT_OR/BIT_XOR/ANY_VALUE/GROUP_CONCAT
+// and the expressions over the aggregators.
 type AggregateExecutor struct {
 	log  *xlog.Log
 	plan planner.Plan
+	txn  backend.Transaction
 }
 
 // NewAggregateExecutor creates new AggregateExecutor.
-func NewAggregateExecutor(log *xlog.Log, plan planner.Plan) *AggregateExecutor {
+func NewAggregateExecutor(log *xlog.Log, plan planner.Plan, txn backend.Transaction) *AggregateExecutor {
 	return &AggregateExecutor{
 		log:  log,
 		plan: plan,
+		txn:  txn,
 	}
 }
 
 // Execute used to execute the executor.
 func (executor *AggregateExecutor) Execute(ctx *xcontext.ResultContext) error {
 	rs := ctx.Results
-	executor.aggregate(rs)
-	return nil
+	return executor.aggregate(rs)
+}
+
+// distinctSet tuple, the distinct values of the aggregator in one group.
+type distinctSet struct {
+	values map[string]sqltypes.Value
+	hll    *hyperLogLog
+
+	// sorted is true if the values come in order, the duplicates are adjacent,
+	// only the last value is kept.
+	sorted bool
+	last   string
+	count  int64
+	sum    sqltypes.Value
+}
+
+// add adds the value to the set, returns the memory size added.
+func (set *distinctSet) add(vkey string, v sqltypes.Value) int {
+	switch {
+	case set.hll != nil:
+		set.hll.add(vkey)
+	case set.sorted:
+		if set.count > 0 && set.last == vkey {
+			return 0
+		}
+		set.last = vkey
+		set.count++
+		if set.sum.IsNull() {
+			set.sum = v
+		} else {
+			set.sum = sqltypes.Operator(set.sum, v, sqltypes.SumFn)
+		}
+	default:
+		if _, ok := set.values[vkey]; ok {
+			return 0
+		}
+		set.values[vkey] = v
+		return len(vkey) + v.Len()
+	}
+	return 0
 }
 
 // Aggregate used to do rows-aggregator(COUNT/SUM/MIN/MAX/AVG) and grouped them into group-by fields.
-func (executor *AggregateExecutor) aggregate(result *sqltypes.Result) {
-	var deIdxs []int
+// The distinct values of COUNT(DISTINCT)/SUM(DISTINCT) are deduplicated in the group, the memory
+// usage is limited by the max result size, unless the HyperLogLog is used.
+func (executor *AggregateExecutor) aggregate(result *sqltypes.Result) error {
 	plan := executor.plan.(*planner.AggregatePlan)
 	if plan.Empty() {
-		return
+		return nil
 	}
+
+	// Without the aggregators and group by, such as 'select a from t having a > 1', the rows are filtered only.
+	if len(plan.NormalAggregators()) == 0 && len(plan.GroupAggregators()) == 0 {
+		if err := executor.evaluate(plan, result); err != nil {
+			return err
+		}
+		result.RemoveColumns(plan.HiddenColumns()...)
+		return nil
+	}
+
+	rows := result.Rows
+	return executor.aggregateRows(result, func() ([]sqltypes.Value, error) {
+		if len(rows) == 0 {
+			return nil, nil
+		}
+		row := rows[0]
+		rows = rows[1:]
+		return row, nil
+	}, false)
+}
+
+// aggregateRows aggregates the rows read from the next function until it returns nil,
+// the result rows are replaced by the aggregated rows.
+// If sorted is true, the rows are sorted by aggregateSortLess, every group is finished
+// once the next group starts, so only one group is held in memory.
+func (executor *AggregateExecutor) aggregateRows(result *sqltypes.Result, next func() ([]sqltypes.Value, error), sorted bool) error {
+	var deIdxs []int
+	plan := executor.plan.(*planner.AggregatePlan)
 	aggrs := plan.NormalAggregators()
 	aggrLen := len(aggrs)
 	groupAggrs := plan.GroupAggregators()
 
+	var distinctAggrs []planner.Aggregator
+	for _, aggr := range aggrs {
+		switch aggr.Type {
+		case planner.AggrTypeCountDistinct, planner.AggrTypeSumDistinct:
+			distinctAggrs = append(distinctAggrs, aggr)
+		case planner.AggrTypeAvg:
+			deIdxs = append(deIdxs, aggr.Index+1, aggr.Index+2)
+		case planner.AggrTypeStddevPop, planner.AggrTypeStddevSamp, planner.AggrTypeVarPop, planner.AggrTypeVarSamp:
+			deIdxs = append(deIdxs, aggr.Index+1, aggr.Index+2, aggr.Index+3)
+		}
+	}
+	maxResult := 0
+	if executor.txn != nil {
+		maxResult = executor.txn.MaxResult()
+	}
+	size, outSize := 0, 0
+	var out [][]sqltypes.Value
 	groups := make(map[string][]sqltypes.Value)
-	for _, row1 := range result.Rows {
+	distincts := make(map[string][]*distinctSet)
+
+	// flush evaluates the distinct aggregators and the avg/variance/group_concat operators,
+	// then moves the groups to the output.
+	flush := func() error {
+		for key, row := range groups {
+			for i, aggr := range distinctAggrs {
+				var set *distinctSet
+				if sets, ok := distincts[key]; ok {
+					set = sets[i]
+				}
+				row[aggr.Index] = distinctValue(aggr, set)
+			}
+			for _, aggr := range aggrs {
+				switch aggr.Type {
+				case planner.AggrTypeAvg:
+					v1, v2 := row[aggr.Index+1], row[aggr.Index+2]
+					row[aggr.Index] = sqltypes.Operator(v1, v2, sqltypes.DivFn)
+				case planner.AggrTypeStddevPop, planner.AggrTypeStddevSamp, planner.AggrTypeVarPop, planner.AggrTypeVarSamp:
+					row[aggr.Index] = variance(aggr.Type, row[aggr.Index+1], row[aggr.Index+2], row[aggr.Index+3])
+				case planner.AggrTypeGroupConcat:
+					val, err := groupConcat(aggr.GroupConcat, row[aggr.Index])
+					if err != nil {
+						return err
+					}
+					row[aggr.Index] = val
+				}
+			}
+			out = append(out, row)
+			// The groups of the sorted rows are flushed one by one, the output is limited by the max result.
+			if sorted {
+				outSize += sqltypes.Values(row).Len()
+				if maxResult > 0 && outSize > maxResult {
+					return fmt.Errorf("Query execution was interrupted, max memory usage[%d bytes] exceeded", maxResult)
+				}
+			}
+		}
+		groups = make(map[string][]sqltypes.Value)
+		distincts = make(map[string][]*distinctSet)
+		size = 0
+		return nil
+	}
+
+	lastKey := ""
+	for {
+		row1, err := next()
+		if err != nil {
+			return err
+		}
+		if row1 == nil {
+			break
+		}
+
 		keySlice := []byte{0x01}
 		for _, v := range groupAggrs {
 			keySlice = append(keySlice, row1[v.Index].Raw()...)
 			keySlice = append(keySlice, 0x02)
 		}
 		key := hack.String(keySlice)
+		if sorted && len(groups) > 0 && key != lastKey {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		lastKey = key
+
 		if row2, ok := groups[key]; !ok {
 			groups[key] = row1
 		} else {
@@ -69,35 +229,307 @@ func (executor *AggregateExecutor) aggregate(result *sqltypes.Result) {
 				groups[key] = operator(aggrs, row1)(row2)
 			}
 		}
+
+		if len(distinctAggrs) == 0 {
+			continue
+		}
+		sets, ok := distincts[key]
+		if !ok {
+			sets = make([]*distinctSet, len(distinctAggrs))
+			for i, aggr := range distinctAggrs {
+				sets[i] = &distinctSet{values: make(map[string]sqltypes.Value)}
+				switch {
+				case aggr.Approximate:
+					sets[i].hll = newHyperLogLog()
+				case sorted && i == 0:
+					// The sorted rows are also ordered by the first distinct aggregator in the group.
+					sets[i].sorted = true
+				}
+			}
+			distincts[key] = sets
+		}
+		for i, aggr := range distinctAggrs {
+			v := row1[aggr.Index]
+			if v.IsNull() {
+				continue
+			}
+			size += sets[i].add(hashKey(v, fieldCollation(result.Fields[aggr.Index])), v)
+			if maxResult > 0 && size > maxResult {
+				return fmt.Errorf("Query execution was interrupted, max memory usage[%d bytes] exceeded", maxResult)
+			}
+		}
 	}
 
-	// Handle the avg operator and rebuild the results.
-	i := 0
-	result.Rows = make([][]sqltypes.Value, len(groups))
-	for _, v := range groups {
+	// The shards return nothing, but the aggregators without group by always return one row.
+	if len(groups) == 0 && len(out) == 0 && len(groupAggrs) == 0 && len(distinctAggrs) > 0 {
+		row := make([]sqltypes.Value, len(result.Fields))
 		for _, aggr := range aggrs {
 			switch aggr.Type {
-			case planner.AggrTypeAvg:
-				v1, v2 := v[aggr.Index+1], v[aggr.Index+2]
-				v[aggr.Index] = sqltypes.Operator(v1, v2, sqltypes.DivFn)
-				deIdxs = append(deIdxs, aggr.Index+1, aggr.Index+2)
+			case planner.AggrTypeCount, planner.AggrTypeCountDistinct:
+				row[aggr.Index] = sqltypes.NewInt64(0)
 			}
 		}
-		result.Rows[i] = v
-		i++
+		groups[""] = row
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	for _, aggr := range distinctAggrs {
+		if aggr.Type == planner.AggrTypeCountDistinct {
+			field := *result.Fields[aggr.Index]
+			field.Type = querypb.Type_INT64
+			result.Fields[aggr.Index] = &field
+		}
+	}
+	result.Rows = out
+
+	// Evaluate the expressions and filter the rows by the having clause.
+	if err := executor.evaluate(plan, result); err != nil {
+		return err
 	}
 
 	// sort by the first field.
-	if len(groups) > 0 {
+	if len(result.Rows) > 0 {
 		result.OrderedByAsc(result.Fields[0].Name)
 		result.Sort()
 	}
 
-	// Remove avg decompose columns.
-	result.RemoveColumns(deIdxs...)
+	// Remove avg decompose columns and the hidden columns.
+	result.RemoveColumns(append(deIdxs, plan.HiddenColumns()...)...)
+	return nil
+}
+
+// aggregateSortLess returns the less function to sort the rows for the sorted aggregation,
+// the rows are ordered by the raw bytes of the group by fields, so the rows of one group are
+// adjacent, then by the value of the first distinct aggregator.
+func aggregateSortLess(plan *planner.AggregatePlan) backend.MergeLessFunc {
+	return func(fields []*querypb.Field) (func(a, b []sqltypes.Value) bool, error) {
+		groupAggrs := plan.GroupAggregators()
+		distinctIdx := -1
+		for _, aggr := range plan.NormalAggregators() {
+			if aggr.Type == planner.AggrTypeCountDistinct || aggr.Type == planner.AggrTypeSumDistinct {
+				if !aggr.Approximate {
+					distinctIdx = aggr.Index
+				}
+				break
+			}
+		}
+		return func(a, b []sqltypes.Value) bool {
+			for _, aggr := range groupAggrs {
+				if cmp := bytes.Compare(a[aggr.Index].Raw(), b[aggr.Index].Raw()); cmp != 0 {
+					return cmp < 0
+				}
+			}
+			if distinctIdx >= 0 {
+				x, y := a[distinctIdx], b[distinctIdx]
+				if x.IsNull() || y.IsNull() {
+					return x.IsNull() && !y.IsNull()
+				}
+				coll := fieldCollation(fields[distinctIdx])
+				return hashKey(x, coll) < hashKey(y, coll)
+			}
+			return false
+		}, nil
+	}
+}
+
+// evaluate evaluates the expressions over the aggregators and filters the rows by the having clause.
+func (executor *AggregateExecutor) evaluate(plan *planner.AggregatePlan, result *sqltypes.Result) error {
+	evaluations := plan.Evaluations()
+	having := plan.Having()
+	if len(evaluations) == 0 && having == nil {
+		return nil
+	}
+
+	r := &aggregateResolver{columns: plan.Columns(), fields: result.Fields}
+	rows := result.Rows[:0]
+	for _, row := range result.Rows {
+		for _, eval := range evaluations {
+			v, err := evalValue(eval.Expr, row, r)
+			if err != nil {
+				return err
+			}
+			row[eval.Index] = v
+		}
+		if having != nil {
+			res, err := evalCond(having, row, r)
+			if err != nil {
+				return err
+			}
+			if res != condTrue {
+				continue
+			}
+		}
+		rows = append(rows, row)
+	}
+	result.Rows = rows
+	return nil
+}
+
+// aggregateResolver resolves the aggregators, columns and aliases to the indexes of the merged row.
+type aggregateResolver struct {
+	columns map[string]int
+	fields  []*querypb.Field
+}
+
+func (r *aggregateResolver) resolve(expr sqlparser.Expr) (int, bool, error) {
+	switch expr.(type) {
+	case *sqlparser.ColName, *sqlparser.FuncExpr:
+		key := sqlparser.String(expr)
+		if idx, ok := r.columns[key]; ok {
+			return idx, true, nil
+		}
+		if _, ok := expr.(*sqlparser.ColName); ok {
+			return -1, false, errors.Errorf("unknown.column[%s].in.aggregate", key)
+		}
+	}
+	return -1, false, nil
+}
+
+func (r *aggregateResolver) collation(idx int) collation {
+	if idx < len(r.fields) {
+		return fieldCollation(r.fields[idx])
+	}
+	return collationCI
+}
+
+func (r *aggregateResolver) scope() string {
+	return "aggregate"
+}
+
+// distinctValue returns the value of the COUNT(DISTINCT)/SUM(DISTINCT) on the distinct values.
+func distinctValue(aggr planner.Aggregator, set *distinctSet) sqltypes.Value {
+	switch aggr.Type {
+	case planner.AggrTypeCountDistinct:
+		switch {
+		case set == nil:
+			return sqltypes.NewInt64(0)
+		case set.hll != nil:
+			return sqltypes.NewInt64(int64(set.hll.count()))
+		case set.sorted:
+			return sqltypes.NewInt64(set.count)
+		}
+		return sqltypes.NewInt64(int64(len(set.values)))
+	default:
+		sum := sqltypes.NULL
+		if set == nil {
+			return sum
+		}
+		if set.sorted {
+			return set.sum
+		}
+		for _, v := range set.values {
+			if sum.IsNull() {
+				sum = v
+				continue
+			}
+			sum = sqltypes.Operator(sum, v, sqltypes.SumFn)
+		}
+		return sum
+	}
+}
+
+// variance returns the variance or the standard deviation by the sum(x), sum(x*x) and count(x).
+func variance(typ planner.AggrType, sum, sumSquare, count sqltypes.Value) sqltypes.Value {
+	n := 0.0
+	if !count.IsNull() {
+		n = toFloat64(count)
+	}
+	if n == 0 || ((typ == planner.AggrTypeStddevSamp || typ == planner.AggrTypeVarSamp) && n < 2) {
+		return sqltypes.NULL
+	}
+	s, ss := toFloat64(sum), toFloat64(sumSquare)
+	v := (ss - s*s/n) / n
+	if typ == planner.AggrTypeStddevSamp || typ == planner.AggrTypeVarSamp {
+		v = (ss - s*s/n) / (n - 1)
+	}
+	// The rounding errors.
+	if v < 0 {
+		v = 0
+	}
+	if typ == planner.AggrTypeStddevPop || typ == planner.AggrTypeStddevSamp {
+		v = math.Sqrt(v)
+	}
+	return sqltypes.NewFloat64(v)
+}
+
+// groupConcatItem tuple, the value and the order by keys of the GROUP_CONCAT.
+type groupConcatItem struct {
+	value []byte
+	keys  []sqltypes.Value
 }
 
-// aggregate supported type: SUM/COUNT/MIN/MAX/AVG.
+// groupConcat decodes the hex encoded values and the order by keys returned by the shards,
+// sorts and deduplicates the values, then joins them with the separator.
+// The encoded item is: hex(value)[:v<hex(key)>|n]...
+func groupConcat(concat *planner.GroupConcat, encoded sqltypes.Value) (sqltypes.Value, error) {
+	if encoded.IsNull() || concat == nil {
+		return encoded, nil
+	}
+
+	var items []groupConcatItem
+	for _, raw := range strings.Split(string(encoded.Raw()), ",") {
+		parts := strings.Split(raw, ":")
+		if len(parts) != len(concat.Directions)+1 {
+			return sqltypes.NULL, errors.Errorf("group_concat.invalid.value[%s]", raw)
+		}
+		value, err := hex.DecodeString(parts[0])
+		if err != nil {
+			return sqltypes.NULL, errors.Errorf("group_concat.invalid.value[%s]", raw)
+		}
+		item := groupConcatItem{value: value}
+		for _, part := range parts[1:] {
+			key := sqltypes.NULL
+			if strings.HasPrefix(part, "v") {
+				b, err := hex.DecodeString(part[1:])
+				if err != nil {
+					return sqltypes.NULL, errors.Errorf("group_concat.invalid.value[%s]", raw)
+				}
+				key = sqltypes.MakeTrusted(querypb.Type_VARCHAR, b)
+				// The numbers are compared numerically.
+				if _, err := strconv.ParseFloat(string(b), 64); err == nil {
+					key = sqltypes.MakeTrusted(querypb.Type_FLOAT64, b)
+				}
+			}
+			item.keys = append(item.keys, key)
+		}
+		items = append(items, item)
+	}
+
+	if len(concat.Directions) > 0 {
+		sort.SliceStable(items, func(i, j int) bool {
+			for k, direction := range concat.Directions {
+				cmp := compareNullable(items[i].keys[k], items[j].keys[k])
+				if cmp == 0 {
+					continue
+				}
+				if direction == planner.DESC {
+					return cmp > 0
+				}
+				return cmp < 0
+			}
+			return false
+		})
+	}
+
+	var buf bytes.Buffer
+	seen := make(map[string]bool)
+	for i, item := range items {
+		if concat.Distinct {
+			if seen[string(item.value)] {
+				continue
+			}
+			seen[string(item.value)] = true
+		}
+		if i > 0 {
+			buf.WriteString(concat.Separator)
+		}
+		buf.Write(item.value)
+	}
+	return sqltypes.NewVarChar(buf.String()), nil
+}
+
+// aggregate supported type: SUM/COUNT/MIN/MAX/AVG/BIT_AND/BIT_OR/BIT_XOR/ANY_VALUE/GROUP_CONCAT.
 func operator(aggrs []planner.Aggregator, x []sqltypes.Value) func([]sqltypes.Value) []sqltypes.Value {
 	return func(y []sqltypes.Value) []sqltypes.Value {
 		ret := sqltypes.Row(x).Copy()
@@ -130,6 +562,35 @@ func operator(aggrs []planner.Aggregator, x []sqltypes.Value) func([]sqltypes.Va
 				} else {
 					ret[aggr.Index] = sqltypes.Operator(v1, v2, sqltypes.MaxFn)
 				}
+			case planner.AggrTypeBitAnd, planner.AggrTypeBitOr, planner.AggrTypeBitXor:
+				v1, v2 := x[aggr.Index], y[aggr.Index]
+				if v1.Type() == sqltypes.Null {
+					ret[aggr.Index] = v2
+				} else if v2.Type() == sqltypes.Null {
+					ret[aggr.Index] = v1
+				} else {
+					a, b := toUint64(v1), toUint64(v2)
+					switch aggr.Type {
+					case planner.AggrTypeBitAnd:
+						ret[aggr.Index] = sqltypes.NewUint64(a & b)
+					case planner.AggrTypeBitOr:
+						ret[aggr.Index] = sqltypes.NewUint64(a | b)
+					default:
+						ret[aggr.Index] = sqltypes.NewUint64(a ^ b)
+					}
+				}
+			case planner.AggrTypeAnyValue:
+				if x[aggr.Index].Type() == sqltypes.Null {
+					ret[aggr.Index] = y[aggr.Index]
+				}
+			case planner.AggrTypeGroupConcat:
+				// The hex encoded values of the shards are joined, they are decoded after the merge.
+				v1, v2 := x[aggr.Index], y[aggr.Index]
+				if v1.Type() == sqltypes.Null {
+					ret[aggr.Index] = v2
+				} else if v2.Type() != sqltypes.Null {
+					ret[aggr.Index] = sqltypes.MakeTrusted(v1.Type(), append(append(append([]byte{}, v1.Raw()...), ','), v2.Raw()...))
+				}
 			case planner.AggrTypeAvg:
 				// nop
 			}
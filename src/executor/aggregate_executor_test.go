@@ -324,3 +324,265 @@ func TestAggregateGroup(t *testing.T) {
 		}
 	}
 }
+
+func TestAggregateDistinctExecutor(t *testing.T) {
+	int32Field := func(name string) *querypb.Field {
+		return &querypb.Field{Name: name, Type: querypb.Type_INT32}
+	}
+	int32Value := func(v int) sqltypes.Value {
+		return sqltypes.MakeTrusted(querypb.Type_INT32, []byte(fmt.Sprintf("%d", v)))
+	}
+	r1 := &sqltypes.Result{
+		Fields: []*querypb.Field{int32Field("a"), int32Field("cnt"), int32Field("s"), int32Field("c")},
+		Rows: [][]sqltypes.Value{
+			{int32Value(1), int32Value(1), int32Value(1), int32Value(2)},
+			{int32Value(1), int32Value(2), int32Value(2), int32Value(1)},
+			{int32Value(2), sqltypes.NULL, sqltypes.NULL, int32Value(3)},
+		},
+	}
+	r2 := &sqltypes.Result{
+		Fields: []*querypb.Field{int32Field("cnt")},
+	}
+	for i := 0; i < 100; i++ {
+		r2.Rows = append(r2.Rows, []sqltypes.Value{int32Value(i)})
+	}
+	r3 := &sqltypes.Result{
+		Fields: []*querypb.Field{int32Field("cnt")},
+	}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableAConfig())
+	assert.Nil(t, err)
+
+	// Create scatter and query handler.
+	scatter, fakedbs, cleanup := backend.MockScatter(log, 10)
+	defer cleanup()
+	fakedbs.AddQueryPattern("select a, b as cnt, b as s, count\\(\\*\\) as c from sbtest.A.* group by a, b", r1)
+	fakedbs.AddQueryPattern("select /\\*\\+ approx_count_distinct \\*/ b as cnt from sbtest.A.* group by b", r2)
+	fakedbs.AddQueryPattern("select b as cnt from sbtest.A[0-9]+ as A group by b", r2)
+	fakedbs.AddQueryPattern("select b as cnt from sbtest.A.* where b > 100 group by b", r3)
+
+	// Exact.
+	{
+		querys := []string{
+			"select a, count(distinct b) as cnt, sum(distinct b) as s, count(*) as c from A group by a",
+			"select count(distinct b) as cnt from A where b > 100",
+		}
+		results := []string{
+			"[[1 2 3 12] [2 0  12]]",
+			"[[0]]",
+		}
+		// The index of the COUNT(DISTINCT) field.
+		idxs := []int{1, 0}
+		for i, query := range querys {
+			node, err := sqlparser.Parse(query)
+			assert.Nil(t, err)
+			plan := planner.NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+			err = plan.Build()
+			assert.Nil(t, err)
+
+			txn, err := scatter.CreateTransaction()
+			assert.Nil(t, err)
+			defer txn.Finish()
+			ctx := xcontext.NewResultContext()
+			err = NewSelectExecutor(log, plan, txn).Execute(ctx)
+			assert.Nil(t, err)
+			assert.Equal(t, results[i], fmt.Sprintf("%v", ctx.Results.Rows))
+			assert.Equal(t, querypb.Type_INT64, ctx.Results.Fields[idxs[i]].Type)
+		}
+	}
+
+	// Approximate.
+	{
+		query := "select /*+ approx_count_distinct */ count(distinct b) as cnt from A"
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := planner.NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+
+		txn, err := scatter.CreateTransaction()
+		assert.Nil(t, err)
+		defer txn.Finish()
+		ctx := xcontext.NewResultContext()
+		err = NewSelectExecutor(log, plan, txn).Execute(ctx)
+		assert.Nil(t, err)
+		cnt, err := ctx.Results.Rows[0][0].ParseInt64()
+		assert.Nil(t, err)
+		assert.InDelta(t, 100, cnt, 3)
+	}
+
+	// Memory limit.
+	{
+		query := "select count(distinct b) as cnt from A"
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := planner.NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+
+		txn, err := scatter.CreateTransaction()
+		assert.Nil(t, err)
+		defer txn.Finish()
+		txn.SetMaxResult(256)
+		err = NewSelectExecutor(log, plan, txn).Execute(xcontext.NewResultContext())
+		want := "Query execution was interrupted, max memory usage[256 bytes] exceeded"
+		assert.Equal(t, want, err.Error())
+	}
+}
+
+func TestAggregateEvaluateExecutor(t *testing.T) {
+	int32Field := func(name string) *querypb.Field {
+		return &querypb.Field{Name: name, Type: querypb.Type_INT32}
+	}
+	int32Value := func(v int) sqltypes.Value {
+		return sqltypes.MakeTrusted(querypb.Type_INT32, []byte(fmt.Sprintf("%d", v)))
+	}
+	r1 := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			int32Field("a"), int32Field("r"), int32Field("m"),
+			int32Field("sum(b)"), int32Field("count(c)"), int32Field("max(d)"), int32Field("min(d)"),
+		},
+		Rows: [][]sqltypes.Value{
+			{int32Value(1), int32Value(0), int32Value(0), int32Value(10), int32Value(4), int32Value(5), int32Value(2)},
+			{int32Value(2), int32Value(0), int32Value(0), int32Value(1), int32Value(1), sqltypes.NULL, sqltypes.NULL},
+			{int32Value(3), int32Value(0), int32Value(0), int32Value(3), int32Value(3), int32Value(1), int32Value(1)},
+		},
+	}
+	r2 := &sqltypes.Result{
+		Fields: []*querypb.Field{int32Field("a")},
+		Rows: [][]sqltypes.Value{
+			{int32Value(1)},
+			{int32Value(3)},
+		},
+	}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableAConfig())
+	assert.Nil(t, err)
+
+	// Create scatter and query handler.
+	scatter, fakedbs, cleanup := backend.MockScatter(log, 10)
+	defer cleanup()
+	fakedbs.AddQueryPattern("select a, sum\\(b\\) / count\\(c\\) as r, ifnull\\(max\\(d\\), 0\\) as m, sum\\(b\\), count\\(c\\), max\\(d\\), min\\(d\\) from sbtest.A[0-9]+ as A group by a", r1)
+	fakedbs.AddQueryPattern("select a from sbtest.A[0-9]+ as A", r2)
+
+	querys := []string{
+		"select a, sum(b)/count(c) as r, ifnull(max(d), 0) as m from A group by a having min(d) > 1 or a = 2",
+		"select a, sum(b)/count(c) as r, ifnull(max(d), 0) as m from A group by a having r > 1 and min(d) > 0",
+		"select a from A having a > 1",
+	}
+	results := []string{
+		"[[1 2.5000 5] [2 1.0000 0]]",
+		"[[1 2.5000 5]]",
+		"[[3] [3] [3] [3]]",
+	}
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := planner.NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+
+		txn, err := scatter.CreateTransaction()
+		assert.Nil(t, err)
+		defer txn.Finish()
+		ctx := xcontext.NewResultContext()
+		err = NewSelectExecutor(log, plan, txn).Execute(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, results[i], fmt.Sprintf("%v", ctx.Results.Rows), query)
+		assert.Equal(t, len(ctx.Results.Fields), len(ctx.Results.Rows[0]))
+	}
+}
+
+func TestAggregateFunctionsExecutor(t *testing.T) {
+	varcharValue := func(v string) sqltypes.Value {
+		return sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(v))
+	}
+	r1 := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "a", Type: querypb.Type_INT32},
+			{Name: "g", Type: querypb.Type_VARCHAR},
+			{Name: "stddev(x)", Type: querypb.Type_FLOAT64},
+			{Name: "sum(x)", Type: querypb.Type_DECIMAL},
+			{Name: "sum(x * x)", Type: querypb.Type_DECIMAL},
+			{Name: "count(x)", Type: querypb.Type_INT64},
+			{Name: "bit_xor(z)", Type: querypb.Type_UINT64},
+			{Name: "any_value(w)", Type: querypb.Type_VARCHAR},
+		},
+		Rows: [][]sqltypes.Value{
+			{
+				sqltypes.NewInt64(1), varcharValue("70:v32,71:v3130"), sqltypes.NewFloat64(0.5),
+				sqltypes.MakeTrusted(querypb.Type_DECIMAL, []byte("3")), sqltypes.MakeTrusted(querypb.Type_DECIMAL, []byte("5")),
+				sqltypes.NewInt64(2), sqltypes.NewUint64(5), varcharValue("w1"),
+			},
+		},
+	}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableAConfig())
+	assert.Nil(t, err)
+
+	// Create scatter and query handler.
+	scatter, fakedbs, cleanup := backend.MockScatter(log, 10)
+	defer cleanup()
+	fakedbs.AddQueryPattern("select a, group_concat\\(concat\\(hex\\(concat\\(b\\)\\), .* from sbtest.A[0-9]+ as A group by a", r1)
+
+	query := "select a, group_concat(b order by c desc separator ';') as g, stddev(x), bit_xor(z), any_value(w) from A group by a"
+	node, err := sqlparser.Parse(query)
+	assert.Nil(t, err)
+	plan := planner.NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+	err = plan.Build()
+	assert.Nil(t, err)
+
+	txn, err := scatter.CreateTransaction()
+	assert.Nil(t, err)
+	defer txn.Finish()
+	ctx := xcontext.NewResultContext()
+	err = NewSelectExecutor(log, plan, txn).Execute(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "[[1 q;q;q;q;p;p;p;p 0.5 0 w1]]", fmt.Sprintf("%v", ctx.Results.Rows))
+	assert.Equal(t, 5, len(ctx.Results.Fields))
+}
+
+func TestAggregateGroupConcat(t *testing.T) {
+	tests := []struct {
+		concat  *planner.GroupConcat
+		encoded string
+		want    string
+	}{
+		// No order by.
+		{&planner.GroupConcat{Separator: ","}, "61,62,61", "a,b,a"},
+		// Distinct.
+		{&planner.GroupConcat{Separator: "", Distinct: true}, "61,62,61", "ab"},
+		// Order by the keys, NULL is the smallest.
+		{&planner.GroupConcat{Separator: "-", Directions: []planner.Direction{planner.ASC, planner.DESC}}, "61:v39:v61,62:n:v61,63:v3130:v62,64:v39:v62", "b-d-a-c"},
+	}
+	for _, test := range tests {
+		got, err := groupConcat(test.concat, sqltypes.NewVarChar(test.encoded))
+		assert.Nil(t, err)
+		assert.Equal(t, test.want, got.String())
+	}
+
+	_, err := groupConcat(&planner.GroupConcat{Separator: ","}, sqltypes.NewVarChar("6x"))
+	assert.Equal(t, "group_concat.invalid.value[6x]", err.Error())
+
+	assert.Equal(t, "0.5", variance(planner.AggrTypeVarSamp, sqltypes.NewInt64(3), sqltypes.NewInt64(5), sqltypes.NewInt64(2)).String())
+	assert.True(t, variance(planner.AggrTypeStddevSamp, sqltypes.NewInt64(3), sqltypes.NewInt64(9), sqltypes.NewInt64(1)).IsNull())
+	assert.True(t, variance(planner.AggrTypeVarPop, sqltypes.NULL, sqltypes.NULL, sqltypes.NewInt64(0)).IsNull())
+}
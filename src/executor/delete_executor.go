@@ -39,6 +39,15 @@ func NewDeleteExecutor(log *xlog.Log, plan planner.Plan, txn backend.Transaction
 // Execute used to execute the executor.
 func (executor *DeleteExecutor) Execute(ctx *xcontext.ResultContext) error {
 	plan := executor.plan.(*planner.DeletePlan)
+	if len(plan.Lookups) > 0 {
+		rs, err := executeLookups(executor.log, plan.Lookups, plan.ReqMode, plan.RawQuery, executor.txn)
+		if err != nil {
+			return err
+		}
+		ctx.Results = rs
+		return nil
+	}
+
 	reqCtx := xcontext.NewRequestContext()
 	reqCtx.Mode = plan.ReqMode
 	reqCtx.TxnMode = xcontext.TxnWrite
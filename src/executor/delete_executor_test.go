@@ -18,6 +18,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
 
@@ -64,3 +65,47 @@ func TestDeleteExecutor(t *testing.T) {
 		}
 	}
 }
+
+func TestDeleteExecutorMultiTable(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	// Create scatter and query handler.
+	scatter, fakedbs, cleanup := backend.MockScatter(log, 10)
+	defer cleanup()
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	A := router.MockTableAConfig()
+	A.UniqueKey = "id"
+	err := route.AddForTest(database, A, router.MockTableSConfig())
+	assert.Nil(t, err)
+
+	// A isn't co-located with S, the keys of A are looked up.
+	fakedbs.AddQuery("select A.id from sbtest.A0 as A", mockJoinResult([]string{"id"}, []string{"1"}, []string{"2"}))
+	fakedbs.AddQuery("select A.id from sbtest.A2 as A", mockJoinResult([]string{"id"}, []string{"3"}))
+	fakedbs.AddQuery("select A.id from sbtest.A4 as A", mockJoinResult([]string{"id"}))
+	fakedbs.AddQuery("select A.id from sbtest.A8 as A", mockJoinResult([]string{"id"}, []string{"4"}))
+	fakedbs.AddQuery("select S.id from sbtest.S as S", mockJoinResult([]string{"id"}, []string{"1"}, []string{"3"}, []string{"3"}, []string{"5"}))
+	// The keys are in the order of the joined rows.
+	fakedbs.AddQueryPattern("delete from sbtest.A8 where id in \\(.*\\)", &sqltypes.Result{RowsAffected: 2})
+
+	query := "delete A from A join S on A.id = S.id"
+	node, err := sqlparser.Parse(query)
+	assert.Nil(t, err)
+	plan := planner.NewDeletePlan(log, database, query, node.(*sqlparser.Delete), route)
+	err = plan.Build()
+	assert.Nil(t, err)
+
+	txn, err := scatter.CreateTransaction()
+	assert.Nil(t, err)
+	defer txn.Finish()
+	executor := NewDeleteExecutor(log, plan, txn)
+	{
+		ctx := xcontext.NewResultContext()
+		err := executor.Execute(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(2), ctx.Results.RowsAffected)
+	}
+}
@@ -9,11 +9,15 @@
 package executor
 
 import (
+	"fmt"
+
 	"backend"
 	"planner"
+	"xbase"
 	"xcontext"
 
 	"github.com/pkg/errors"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
@@ -29,6 +33,8 @@ type Tree struct {
 	children []Executor
 	txn      backend.Transaction
 	planTree *planner.PlanTree
+	events   []xcontext.BinlogEvent
+	stream   func(*sqltypes.Result) error
 }
 
 // NewTree creates the new execute tree.
@@ -47,6 +53,11 @@ func (et *Tree) Add(executor Executor) error {
 	return nil
 }
 
+// SetStream sets the callback to stream the large result to the client, see xcontext.ResultContext.
+func (et *Tree) SetStream(stream func(*sqltypes.Result) error) {
+	et.stream = stream
+}
+
 // Execute executes all Executor.Execute
 func (et *Tree) Execute() (*sqltypes.Result, error) {
 	// build tree
@@ -77,6 +88,16 @@ func (et *Tree) Execute() (*sqltypes.Result, error) {
 			if err := et.Add(executor); err != nil {
 				return nil, err
 			}
+		case planner.PlanTypeJoin:
+			executor := NewJoinExecutor(et.log, plan, et.txn)
+			if err := et.Add(executor); err != nil {
+				return nil, err
+			}
+		case planner.PlanTypeUnion:
+			executor := NewUnionExecutor(et.log, plan, et.txn)
+			if err := et.Add(executor); err != nil {
+				return nil, err
+			}
 		default:
 			return nil, errors.Errorf("unsupported.execute.type:%v", plan.Type())
 		}
@@ -84,10 +105,202 @@ func (et *Tree) Execute() (*sqltypes.Result, error) {
 
 	// execute all
 	rsCtx := xcontext.NewResultContext()
+	rsCtx.Stream = et.stream
 	for _, executor := range et.children {
 		if err := executor.Execute(rsCtx); err != nil {
 			return nil, err
 		}
 	}
+	et.events = rsCtx.Events
+	return rsCtx.Results, nil
+}
+
+// ErrRowsExceeded is returned by the ExecuteLimited once the rows exceed the limit.
+var ErrRowsExceeded = errors.New("result.rows.exceeds.the.limit")
+
+// ExecuteLimited executes the plan tree of the select and returns the ErrRowsExceeded once the rows
+// exceed the maxRows. If the select needs nothing done in the proxy, the shard rows are streamed and
+// counted while they're fetched. Otherwise the shard rows are limited by the max result while fetched,
+// and the merged rows are counted.
+func (et *Tree) ExecuteLimited(maxRows int) (*sqltypes.Result, error) {
+	plans := et.planTree.Plans()
+	if maxRows > 0 && len(plans) == 1 {
+		if plan, ok := plans[0].(*planner.SelectPlan); ok && streamable(plan) {
+			return executeStreamLimited(plan, et.txn, maxRows)
+		}
+	}
+	qr, err := et.Execute()
+	if err != nil {
+		return nil, err
+	}
+	if maxRows > 0 && len(qr.Rows) > maxRows {
+		return nil, ErrRowsExceeded
+	}
+	return qr, nil
+}
+
+// executeStreamLimited streams the shard rows of the select plan into the result, it stops once
+// the rows exceed the maxRows or the max result of the txn.
+func executeStreamLimited(plan *planner.SelectPlan, txn backend.Transaction, maxRows int) (*sqltypes.Result, error) {
+	reqCtx := xcontext.NewRequestContext()
+	reqCtx.Mode = plan.ReqMode
+	reqCtx.TxnMode = xcontext.TxnRead
+	if plan.Locking() {
+		reqCtx.TxnMode = xcontext.TxnWrite
+	}
+	reqCtx.Querys = plan.Querys
+	reqCtx.RawQuery = plan.RawQuery
+
+	size := 0
+	maxResult := txn.MaxResult()
+	qr := &sqltypes.Result{}
+	add := func(fields []*querypb.Field, rows [][]sqltypes.Value) error {
+		qr.Fields = fields
+		if len(qr.Rows)+len(rows) > maxRows {
+			return ErrRowsExceeded
+		}
+		for _, row := range rows {
+			size += sqltypes.Values(row).Len()
+		}
+		if maxResult > 0 && size > maxResult {
+			return fmt.Errorf("Query execution was interrupted, max memory usage[%d bytes] exceeded", maxResult)
+		}
+		qr.Rows = append(qr.Rows, rows...)
+		return nil
+	}
+	if err := txn.ExecuteRowStream(reqCtx, add, spillBatchRows); err != nil {
+		return nil, err
+	}
+	qr.RowsAffected = uint64(len(qr.Rows))
+	return qr, nil
+}
+
+// BinlogEvents returns the binlog events of the executed statement, nil if the statement
+// itself should be logged.
+func (et *Tree) BinlogEvents() []xcontext.BinlogEvent {
+	return et.events
+}
+
+// executeSelectPlan executes the plan of the select statement, the SelectPlan, JoinPlan or UnionPlan,
+// returns the result.
+func executeSelectPlan(log *xlog.Log, plan planner.Plan, txn backend.Transaction) (*sqltypes.Result, error) {
+	var executor Executor
+	switch plan.Type() {
+	case planner.PlanTypeSelect:
+		executor = NewSelectExecutor(log, plan, txn)
+	case planner.PlanTypeJoin:
+		executor = NewJoinExecutor(log, plan, txn)
+	case planner.PlanTypeUnion:
+		executor = NewUnionExecutor(log, plan, txn)
+	default:
+		return nil, errors.Errorf("unsupported.execute.type:%v", plan.Type())
+	}
+	rsCtx := xcontext.NewResultContext()
+	if err := executor.Execute(rsCtx); err != nil {
+		return nil, err
+	}
 	return rsCtx.Results, nil
 }
+
+// executeLookups executes the lookups of the multiple-table UPDATE or DELETE.
+// The rows of all the targets are selected before any change, so the changes of a target
+// don't affect the rows matched by the others.
+func executeLookups(log *xlog.Log, lookups []*planner.DMLLookup, mode xcontext.RequestMode, rawQuery string, txn backend.Transaction) (*sqltypes.Result, error) {
+	var querys []xcontext.QueryTuple
+	for _, lookup := range lookups {
+		rs, err := executeSelectPlan(log, lookup.Select, txn)
+		if err != nil {
+			return nil, err
+		}
+		tuples, err := lookup.Querys(rs.Rows)
+		if err != nil {
+			return nil, err
+		}
+		querys = append(querys, tuples...)
+	}
+	if len(querys) == 0 {
+		return &sqltypes.Result{}, nil
+	}
+
+	reqCtx := xcontext.NewRequestContext()
+	reqCtx.Mode = mode
+	reqCtx.TxnMode = xcontext.TxnWrite
+	reqCtx.Querys = querys
+	reqCtx.RawQuery = rawQuery
+	return txn.Execute(reqCtx)
+}
+
+// executeMove executes the shard key move in the XA of the twopc txn.
+// The rows of every step are selected for update with the new values, deleted and inserted
+// into their new partitions. The moves are recorded as the binlog events on the logical table.
+func executeMove(move *planner.ShardKeyMove, mode xcontext.RequestMode, rawQuery string, txn backend.Transaction, ctx *xcontext.ResultContext) error {
+	if !txn.TwoPC() {
+		return errors.New("unsupported: shard.key.update.requires.twopc")
+	}
+	txn.SetMultiWrite()
+
+	write := func(querys []xcontext.QueryTuple) (*sqltypes.Result, error) {
+		reqCtx := xcontext.NewRequestContext()
+		reqCtx.Mode = mode
+		reqCtx.TxnMode = xcontext.TxnWrite
+		reqCtx.Querys = querys
+		reqCtx.RawQuery = rawQuery
+		return txn.Execute(reqCtx)
+	}
+
+	qr := &sqltypes.Result{}
+	for _, step := range move.Steps {
+		rs, err := write(step.Selects)
+		if err != nil {
+			return err
+		}
+
+		// Nothing is duplicate, insert the row of INSERT ... ON DUPLICATE KEY UPDATE.
+		if len(rs.Rows) == 0 {
+			if step.Row == nil {
+				continue
+			}
+			querys, query, err := move.RowQuerys(step)
+			if err != nil {
+				return err
+			}
+			if _, err := write(querys); err != nil {
+				return err
+			}
+			qr.RowsAffected++
+			ctx.Events = append(ctx.Events, xcontext.BinlogEvent{Typ: xbase.INSERT, Query: query})
+			continue
+		}
+
+		fields, rows, changed, err := move.NewRows(rs.Fields, rs.Rows)
+		if err != nil {
+			return err
+		}
+		if changed == 0 {
+			continue
+		}
+		querys, query, err := move.InsertQuerys(fields, rows)
+		if err != nil {
+			return err
+		}
+		if rs, err = write(step.Deletes); err != nil {
+			return err
+		}
+		if int(rs.RowsAffected) != len(rows) {
+			return errors.Errorf("shard.key.move.deleted.rows[%d].mismatch.the.selected[%d]", rs.RowsAffected, len(rows))
+		}
+		if _, err := write(querys); err != nil {
+			return err
+		}
+		// The duplicate row updated by INSERT ... ON DUPLICATE KEY UPDATE counts as two rows.
+		if step.Row != nil {
+			changed *= 2
+		}
+		qr.RowsAffected += uint64(changed)
+		ctx.Events = append(ctx.Events,
+			xcontext.BinlogEvent{Typ: xbase.DELETE, Query: move.DeleteQuery(step)},
+			xcontext.BinlogEvent{Typ: xbase.INSERT, Query: query})
+	}
+	ctx.Results = qr
+	return nil
+}
@@ -103,3 +103,54 @@ func TestExecutor1(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, fakedb.Result3, qr)
 }
+
+func TestExecutorExecuteLimited(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+
+	// Create scatter and query handler.
+	scatter, fakedbs, cleanup := backend.MockScatter(log, 10)
+	defer cleanup()
+	fakedbs.AddQueryPattern("select id from sbtest.A[0-9]+ as A", mockJoinResult([]string{"id"}, []string{"1"}, []string{"2"}, []string{"3"}))
+	fakedbs.AddQueryPattern("select id from sbtest.A[0-9]+ as A group by id", mockJoinResult([]string{"id"}, []string{"1"}, []string{"2"}, []string{"3"}))
+
+	database := "sbtest"
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableAConfig())
+	assert.Nil(t, err)
+
+	tests := []struct {
+		query   string
+		maxRows int
+		rows    int
+		err     error
+	}{
+		// Streamed, 4 shards with 3 rows each.
+		{"select id from A", 12, 12, nil},
+		{"select id from A", 11, 0, ErrRowsExceeded},
+		{"select id from A", 0, 12, nil},
+		// Merged in the proxy, the merged rows are counted.
+		{"select id from A group by id", 3, 3, nil},
+		{"select id from A group by id", 2, 0, ErrRowsExceeded},
+	}
+	for _, test := range tests {
+		node, err := sqlparser.Parse(test.query)
+		assert.Nil(t, err)
+		plan := planner.NewSelectPlan(log, database, test.query, node.(*sqlparser.Select), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+		planTree := planner.NewPlanTree()
+		err = planTree.Add(plan)
+		assert.Nil(t, err)
+
+		txn, err := scatter.CreateTransaction()
+		assert.Nil(t, err)
+		defer txn.Finish()
+		qr, err := NewTree(log, planTree, txn).ExecuteLimited(test.maxRows)
+		assert.Equal(t, test.err, err, test.query)
+		if err == nil {
+			assert.Equal(t, test.rows, len(qr.Rows), test.query)
+		}
+	}
+}
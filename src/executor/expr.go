@@ -0,0 +1,942 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package executor
+
+import (
+	"bytes"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/common"
+	"github.com/xelabs/go-mysqlstack/sqldb"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+// rowSchema used to resolve the columns of the joined row,
+// the joined row is the concatenation of the rows of the tables.
+type rowSchema struct {
+	names   []string
+	fields  [][]*querypb.Field
+	offsets []int
+}
+
+// newRowSchema creates the row schema.
+func newRowSchema(names []string, fields [][]*querypb.Field) *rowSchema {
+	offsets := make([]int, len(fields))
+	offset := 0
+	for i, f := range fields {
+		offsets[i] = offset
+		offset += len(f)
+	}
+	return &rowSchema{
+		names:   names,
+		fields:  fields,
+		offsets: offsets,
+	}
+}
+
+// index returns the offset of the column in the joined row of the first n tables.
+func (s *rowSchema) index(col *sqlparser.ColName, n int) (int, error) {
+	idx := -1
+	qualifier := col.Qualifier.Name.String()
+	for i := 0; i < n; i++ {
+		if qualifier != "" && qualifier != s.names[i] {
+			continue
+		}
+		for j, field := range s.fields[i] {
+			if !strings.EqualFold(field.Name, col.Name.String()) {
+				continue
+			}
+			if idx != -1 {
+				return -1, errors.Errorf("column[%s].in.cross-shard.join.is.ambiguous", sqlparser.String(col))
+			}
+			idx = s.offsets[i] + j
+		}
+	}
+	if idx == -1 {
+		return -1, errors.Errorf("unknown.column[%s].in.cross-shard.join", sqlparser.String(col))
+	}
+	return idx, nil
+}
+
+// resolver used to resolve the expressions to the offsets of the row.
+type resolver interface {
+	// resolve returns the offset of the expression in the row,
+	// ok is false if the expression should be evaluated by its operands.
+	resolve(expr sqlparser.Expr) (idx int, ok bool, err error)
+	// collation returns the collation of the value at the offset of the row.
+	collation(idx int) collation
+	// scope returns the scope used in the error messages, such as 'cross-shard.join'.
+	scope() string
+}
+
+// joinResolver resolves the columns of the joined row of the first n tables.
+type joinResolver struct {
+	schema *rowSchema
+	n      int
+}
+
+// resolver returns the resolver of the joined row of the first n tables.
+func (s *rowSchema) resolver(n int) resolver {
+	return &joinResolver{schema: s, n: n}
+}
+
+func (r *joinResolver) resolve(expr sqlparser.Expr) (int, bool, error) {
+	col, ok := expr.(*sqlparser.ColName)
+	if !ok {
+		return -1, false, nil
+	}
+	idx, err := r.schema.index(col, r.n)
+	if err != nil {
+		return -1, false, err
+	}
+	return idx, true, nil
+}
+
+func (r *joinResolver) collation(idx int) collation {
+	for i, offset := range r.schema.offsets {
+		if idx < offset+len(r.schema.fields[i]) {
+			return fieldCollation(r.schema.fields[i][idx-offset])
+		}
+	}
+	return collationCI
+}
+
+func (r *joinResolver) scope() string {
+	return "cross-shard.join"
+}
+
+// condResult is the three-valued logic result.
+type condResult int
+
+const (
+	condFalse condResult = iota
+	condTrue
+	condNull
+)
+
+// evalCond evaluates the condition on the row.
+func evalCond(expr sqlparser.Expr, row []sqltypes.Value, r resolver) (condResult, error) {
+	switch expr := expr.(type) {
+	case *sqlparser.AndExpr:
+		left, err := evalCond(expr.Left, row, r)
+		if err != nil || left == condFalse {
+			return left, err
+		}
+		right, err := evalCond(expr.Right, row, r)
+		if err != nil || right == condFalse {
+			return right, err
+		}
+		if left == condNull || right == condNull {
+			return condNull, nil
+		}
+		return condTrue, nil
+	case *sqlparser.OrExpr:
+		left, err := evalCond(expr.Left, row, r)
+		if err != nil || left == condTrue {
+			return left, err
+		}
+		right, err := evalCond(expr.Right, row, r)
+		if err != nil || right == condTrue {
+			return right, err
+		}
+		if left == condNull || right == condNull {
+			return condNull, nil
+		}
+		return condFalse, nil
+	case *sqlparser.NotExpr:
+		res, err := evalCond(expr.Expr, row, r)
+		if err != nil || res == condNull {
+			return res, err
+		}
+		if res == condTrue {
+			return condFalse, nil
+		}
+		return condTrue, nil
+	case *sqlparser.ParenExpr:
+		return evalCond(expr.Expr, row, r)
+	case *sqlparser.IsExpr:
+		val, err := evalValue(expr.Expr, row, r)
+		if err != nil {
+			return condFalse, err
+		}
+		switch expr.Operator {
+		case sqlparser.IsNullStr:
+			return condOf(val.IsNull()), nil
+		case sqlparser.IsNotNullStr:
+			return condOf(!val.IsNull()), nil
+		}
+		res, err := truth(val)
+		if err != nil {
+			return condFalse, err
+		}
+		if res == condNull {
+			res = condFalse
+		}
+		switch expr.Operator {
+		case sqlparser.IsTrueStr:
+			return condOf(res == condTrue), nil
+		case sqlparser.IsNotTrueStr:
+			return condOf(res != condTrue), nil
+		case sqlparser.IsFalseStr:
+			return condOf(res == condFalse && !val.IsNull()), nil
+		case sqlparser.IsNotFalseStr:
+			return condOf(res != condFalse || val.IsNull()), nil
+		}
+		return condFalse, errors.Errorf("unsupported: operator[%s].in.%s", expr.Operator, r.scope())
+	case *sqlparser.RangeCond:
+		val, err := evalValue(expr.Left, row, r)
+		if err != nil {
+			return condFalse, err
+		}
+		from, err := evalValue(expr.From, row, r)
+		if err != nil {
+			return condFalse, err
+		}
+		to, err := evalValue(expr.To, row, r)
+		if err != nil {
+			return condFalse, err
+		}
+		if val.IsNull() || from.IsNull() || to.IsNull() {
+			return condNull, nil
+		}
+		coll := exprCollation(r, expr.Left, expr.From, expr.To)
+		in := compareCollated(val, from, coll) >= 0 && compareCollated(val, to, coll) <= 0
+		if expr.Operator == sqlparser.NotBetweenStr {
+			in = !in
+		}
+		return condOf(in), nil
+	case *sqlparser.ComparisonExpr:
+		return evalComparison(expr, row, r)
+	}
+	val, err := evalValue(expr, row, r)
+	if err != nil {
+		return condFalse, err
+	}
+	return truth(val)
+}
+
+// exprCollation returns the collation to compare the values of the expressions, the columns have
+// the collations of their fields, the others have the default one.
+func exprCollation(r resolver, exprs ...sqlparser.Expr) collation {
+	coll := collationCI
+	for _, expr := range exprs {
+		if idx, ok, err := r.resolve(expr); err == nil && ok {
+			coll = mergeCollation(coll, r.collation(idx))
+		}
+	}
+	return coll
+}
+
+// evalComparison evaluates the comparison on the row.
+func evalComparison(expr *sqlparser.ComparisonExpr, row []sqltypes.Value, r resolver) (condResult, error) {
+	left, err := evalValue(expr.Left, row, r)
+	if err != nil {
+		return condFalse, err
+	}
+
+	switch expr.Operator {
+	case sqlparser.InStr, sqlparser.NotInStr:
+		tuple, ok := expr.Right.(sqlparser.ValTuple)
+		if !ok {
+			return condFalse, errors.Errorf("unsupported: expression[%s].in.%s", sqlparser.String(expr), r.scope())
+		}
+		if left.IsNull() {
+			return condNull, nil
+		}
+		res := condFalse
+		for _, e := range tuple {
+			v, err := evalValue(e, row, r)
+			if err != nil {
+				return condFalse, err
+			}
+			if v.IsNull() {
+				res = condNull
+				continue
+			}
+			if compareCollated(left, v, exprCollation(r, expr.Left, e)) == 0 {
+				res = condTrue
+				break
+			}
+		}
+		if expr.Operator == sqlparser.NotInStr && res != condNull {
+			return condOf(res == condFalse), nil
+		}
+		return res, nil
+	}
+
+	right, err := evalValue(expr.Right, row, r)
+	if err != nil {
+		return condFalse, err
+	}
+	coll := exprCollation(r, expr.Left, expr.Right)
+	if expr.Operator == sqlparser.NullSafeEqualStr {
+		if left.IsNull() || right.IsNull() {
+			return condOf(left.IsNull() && right.IsNull()), nil
+		}
+		return condOf(compareCollated(left, right, coll) == 0), nil
+	}
+	if left.IsNull() || right.IsNull() {
+		return condNull, nil
+	}
+
+	cmp := compareCollated(left, right, coll)
+	switch expr.Operator {
+	case sqlparser.EqualStr:
+		return condOf(cmp == 0), nil
+	case sqlparser.NotEqualStr:
+		return condOf(cmp != 0), nil
+	case sqlparser.LessThanStr:
+		return condOf(cmp < 0), nil
+	case sqlparser.LessEqualStr:
+		return condOf(cmp <= 0), nil
+	case sqlparser.GreaterThanStr:
+		return condOf(cmp > 0), nil
+	case sqlparser.GreaterEqualStr:
+		return condOf(cmp >= 0), nil
+	}
+	return condFalse, errors.Errorf("unsupported: operator[%s].in.%s", expr.Operator, r.scope())
+}
+
+// evalValue evaluates the value of the expression on the row.
+func evalValue(expr sqlparser.Expr, row []sqltypes.Value, r resolver) (sqltypes.Value, error) {
+	idx, ok, err := r.resolve(expr)
+	if err != nil {
+		return sqltypes.NULL, err
+	}
+	if ok {
+		return row[idx], nil
+	}
+
+	switch expr := expr.(type) {
+	case *sqlparser.SQLVal:
+		switch expr.Type {
+		case sqlparser.IntVal:
+			return sqltypes.MakeTrusted(querypb.Type_INT64, expr.Val), nil
+		case sqlparser.FloatVal:
+			return sqltypes.MakeTrusted(querypb.Type_FLOAT64, expr.Val), nil
+		case sqlparser.StrVal:
+			return sqltypes.MakeTrusted(querypb.Type_VARCHAR, expr.Val), nil
+		}
+		return sqltypes.NULL, errors.Errorf("unsupported: value[%s].in.%s", sqlparser.String(expr), r.scope())
+	case *sqlparser.NullVal:
+		return sqltypes.NULL, nil
+	case sqlparser.BoolVal:
+		if expr {
+			return sqltypes.NewInt64(1), nil
+		}
+		return sqltypes.NewInt64(0), nil
+	case *sqlparser.ParenExpr:
+		return evalValue(expr.Expr, row, r)
+	case *sqlparser.AndExpr, *sqlparser.OrExpr, *sqlparser.NotExpr, *sqlparser.IsExpr, *sqlparser.RangeCond, *sqlparser.ComparisonExpr:
+		res, err := evalCond(expr, row, r)
+		if err != nil {
+			return sqltypes.NULL, err
+		}
+		switch res {
+		case condTrue:
+			return sqltypes.NewInt64(1), nil
+		case condFalse:
+			return sqltypes.NewInt64(0), nil
+		}
+		return sqltypes.NULL, nil
+	case *sqlparser.BinaryExpr:
+		left, err := evalValue(expr.Left, row, r)
+		if err != nil {
+			return sqltypes.NULL, err
+		}
+		right, err := evalValue(expr.Right, row, r)
+		if err != nil {
+			return sqltypes.NULL, err
+		}
+		return evalArithmetic(expr.Operator, left, right)
+	case *sqlparser.UnaryExpr:
+		val, err := evalValue(expr.Expr, row, r)
+		if err != nil || val.IsNull() {
+			return val, err
+		}
+		switch expr.Operator {
+		case sqlparser.UPlusStr:
+			return val, nil
+		case sqlparser.UMinusStr:
+			return evalArithmetic(sqlparser.MinusStr, sqltypes.NewInt64(0), val)
+		case sqlparser.TildaStr:
+			return sqltypes.NewUint64(^toUint64(val)), nil
+		case sqlparser.BangStr:
+			return sqltypes.NewInt64(boolInt(toFloat64(val) == 0)), nil
+		}
+	case *sqlparser.CaseExpr:
+		return evalCase(expr, row, r)
+	case *sqlparser.FuncExpr:
+		return evalFunc(expr, row, r)
+	}
+	return sqltypes.NULL, errors.Errorf("unsupported: expression[%s].in.%s", sqlparser.String(expr), r.scope())
+}
+
+// divPrecisionIncrement is the scale added to the dividend by '/' same as the MySQL default.
+const divPrecisionIncrement = 4
+
+// errOutOfRange returns the ER_DATA_OUT_OF_RANGE error of the arithmetic on the BIGINT values.
+func errOutOfRange(op string, left, right sqltypes.Value) error {
+	return sqldb.NewSQLError1(1690, "22003", "BIGINT value is out of range in '(%s %s %s)'", left.Raw(), op, right.Raw())
+}
+
+// evalArithmetic evaluates the arithmetic operator on the two values, the result is NULL if
+// any operand is NULL or the divisor is zero.
+// The integers are computed as int64 for '+-*%' and 'DIV', the overflow is ER_DATA_OUT_OF_RANGE.
+// The '/' of the integers and decimals is the DECIMAL, the others are computed as float64.
+func evalArithmetic(op string, left, right sqltypes.Value) (sqltypes.Value, error) {
+	if left.IsNull() || right.IsNull() {
+		return sqltypes.NULL, nil
+	}
+
+	switch op {
+	case sqlparser.BitAndStr:
+		return sqltypes.NewUint64(toUint64(left) & toUint64(right)), nil
+	case sqlparser.BitOrStr:
+		return sqltypes.NewUint64(toUint64(left) | toUint64(right)), nil
+	case sqlparser.BitXorStr:
+		return sqltypes.NewUint64(toUint64(left) ^ toUint64(right)), nil
+	case sqlparser.ShiftLeftStr:
+		return sqltypes.NewUint64(toUint64(left) << toUint64(right)), nil
+	case sqlparser.ShiftRightStr:
+		return sqltypes.NewUint64(toUint64(left) >> toUint64(right)), nil
+	}
+
+	if left.IsIntegral() && right.IsIntegral() {
+		x, err1 := left.ParseInt64()
+		y, err2 := right.ParseInt64()
+		if err1 == nil && err2 == nil {
+			switch op {
+			case sqlparser.PlusStr:
+				if (y > 0 && x > math.MaxInt64-y) || (y < 0 && x < math.MinInt64-y) {
+					return sqltypes.NULL, errOutOfRange(op, left, right)
+				}
+				return sqltypes.NewInt64(x + y), nil
+			case sqlparser.MinusStr:
+				if (y < 0 && x > math.MaxInt64+y) || (y > 0 && x < math.MinInt64+y) {
+					return sqltypes.NULL, errOutOfRange(op, left, right)
+				}
+				return sqltypes.NewInt64(x - y), nil
+			case sqlparser.MultStr:
+				z := x * y
+				if x != 0 && (z/x != y || (x == -1 && y == math.MinInt64) || (y == -1 && x == math.MinInt64)) {
+					return sqltypes.NULL, errOutOfRange(op, left, right)
+				}
+				return sqltypes.NewInt64(z), nil
+			case sqlparser.IntDivStr:
+				if y == 0 {
+					return sqltypes.NULL, nil
+				}
+				if x == math.MinInt64 && y == -1 {
+					return sqltypes.NULL, errOutOfRange(op, left, right)
+				}
+				return sqltypes.NewInt64(x / y), nil
+			case sqlparser.ModStr:
+				if y == 0 {
+					return sqltypes.NULL, nil
+				}
+				return sqltypes.NewInt64(x % y), nil
+			}
+		}
+	}
+
+	if op == sqlparser.DivStr && isExact(left) && isExact(right) {
+		return divDecimal(left, right), nil
+	}
+
+	x, y := toFloat64(left), toFloat64(right)
+	switch op {
+	case sqlparser.PlusStr:
+		return sqltypes.NewFloat64(x + y), nil
+	case sqlparser.MinusStr:
+		return sqltypes.NewFloat64(x - y), nil
+	case sqlparser.MultStr:
+		return sqltypes.NewFloat64(x * y), nil
+	case sqlparser.DivStr:
+		if y == 0 {
+			return sqltypes.NULL, nil
+		}
+		return sqltypes.NewFloat64(x / y), nil
+	case sqlparser.IntDivStr:
+		if y == 0 {
+			return sqltypes.NULL, nil
+		}
+		z := math.Trunc(x / y)
+		if z < math.MinInt64 || z >= math.MaxInt64 {
+			return sqltypes.NULL, errOutOfRange(op, left, right)
+		}
+		return sqltypes.NewInt64(int64(z)), nil
+	case sqlparser.ModStr:
+		if y == 0 {
+			return sqltypes.NULL, nil
+		}
+		return sqltypes.NewFloat64(math.Mod(x, y)), nil
+	}
+	return sqltypes.NULL, errors.Errorf("unsupported: operator[%s]", op)
+}
+
+// divDecimal returns the quotient of the integers or decimals as the DECIMAL, its scale is the scale
+// of the dividend plus divPrecisionIncrement, NULL if the divisor is zero.
+func divDecimal(left, right sqltypes.Value) sqltypes.Value {
+	x, ok1 := new(big.Rat).SetString(strings.TrimSpace(string(left.Raw())))
+	y, ok2 := new(big.Rat).SetString(strings.TrimSpace(string(right.Raw())))
+	if !ok1 || !ok2 || y.Sign() == 0 {
+		return sqltypes.NULL
+	}
+	scale := 0
+	if raw := string(left.Raw()); left.Type() == querypb.Type_DECIMAL {
+		if i := strings.IndexByte(raw, '.'); i >= 0 {
+			scale = len(strings.TrimSpace(raw)) - i - 1
+		}
+	}
+	// FloatString rounds the halves away from zero same as MySQL.
+	return sqltypes.MakeTrusted(querypb.Type_DECIMAL, []byte(new(big.Rat).Quo(x, y).FloatString(scale+divPrecisionIncrement)))
+}
+
+// evalCase evaluates the CASE expression.
+func evalCase(expr *sqlparser.CaseExpr, row []sqltypes.Value, r resolver) (sqltypes.Value, error) {
+	var base sqltypes.Value
+	if expr.Expr != nil {
+		val, err := evalValue(expr.Expr, row, r)
+		if err != nil {
+			return sqltypes.NULL, err
+		}
+		base = val
+	}
+	for _, when := range expr.Whens {
+		matched := false
+		if expr.Expr != nil {
+			val, err := evalValue(when.Cond, row, r)
+			if err != nil {
+				return sqltypes.NULL, err
+			}
+			matched = !base.IsNull() && !val.IsNull() && compareValues(base, val) == 0
+		} else {
+			res, err := evalCond(when.Cond, row, r)
+			if err != nil {
+				return sqltypes.NULL, err
+			}
+			matched = res == condTrue
+		}
+		if matched {
+			return evalValue(when.Val, row, r)
+		}
+	}
+	if expr.Else != nil {
+		return evalValue(expr.Else, row, r)
+	}
+	return sqltypes.NULL, nil
+}
+
+// evalFunc evaluates the scalar function.
+func evalFunc(expr *sqlparser.FuncExpr, row []sqltypes.Value, r resolver) (sqltypes.Value, error) {
+	args := make([]sqltypes.Value, 0, len(expr.Exprs))
+	for _, e := range expr.Exprs {
+		aliased, ok := e.(*sqlparser.AliasedExpr)
+		if !ok {
+			return sqltypes.NULL, errors.Errorf("unsupported: expression[%s].in.%s", sqlparser.String(expr), r.scope())
+		}
+		val, err := evalValue(aliased.Expr, row, r)
+		if err != nil {
+			return sqltypes.NULL, err
+		}
+		args = append(args, val)
+	}
+
+	name := expr.Name.Lowered()
+	argc := -1
+	switch name {
+	case "ifnull", "nullif":
+		argc = 2
+	case "if":
+		argc = 3
+	case "abs", "ceil", "ceiling", "floor", "lower", "lcase", "upper", "ucase", "length", "char_length", "character_length":
+		argc = 1
+	}
+	if argc != -1 && len(args) != argc {
+		return sqltypes.NULL, errors.Errorf("Incorrect parameter count in the call to native function '%s'", expr.Name.String())
+	}
+
+	switch name {
+	case "ifnull":
+		if args[0].IsNull() {
+			return args[1], nil
+		}
+		return args[0], nil
+	case "coalesce":
+		for _, arg := range args {
+			if !arg.IsNull() {
+				return arg, nil
+			}
+		}
+		return sqltypes.NULL, nil
+	case "if":
+		res, err := truth(args[0])
+		if err != nil {
+			return sqltypes.NULL, err
+		}
+		if res == condTrue {
+			return args[1], nil
+		}
+		return args[2], nil
+	case "nullif":
+		if !args[0].IsNull() && !args[1].IsNull() && compareValues(args[0], args[1]) == 0 {
+			return sqltypes.NULL, nil
+		}
+		return args[0], nil
+	case "abs":
+		if args[0].IsNull() {
+			return sqltypes.NULL, nil
+		}
+		if compareValues(args[0], sqltypes.NewInt64(0)) < 0 {
+			return evalArithmetic(sqlparser.MinusStr, sqltypes.NewInt64(0), args[0])
+		}
+		return args[0], nil
+	case "ceil", "ceiling", "floor":
+		if args[0].IsNull() || args[0].IsIntegral() {
+			return args[0], nil
+		}
+		f := math.Floor(toFloat64(args[0]))
+		if name != "floor" {
+			f = math.Ceil(toFloat64(args[0]))
+		}
+		return sqltypes.NewInt64(int64(f)), nil
+	case "round":
+		if len(args) != 1 && len(args) != 2 {
+			return sqltypes.NULL, errors.Errorf("Incorrect parameter count in the call to native function '%s'", expr.Name.String())
+		}
+		for _, arg := range args {
+			if arg.IsNull() {
+				return sqltypes.NULL, nil
+			}
+		}
+		d := 0
+		if len(args) == 2 {
+			d = int(toFloat64(args[1]))
+		}
+		if args[0].IsIntegral() && d >= 0 {
+			return args[0], nil
+		}
+		scale := math.Pow(10, float64(d))
+		f := toFloat64(args[0]) * scale
+		// Rounds half away from zero.
+		if f < 0 {
+			f = -math.Floor(-f + 0.5)
+		} else {
+			f = math.Floor(f + 0.5)
+		}
+		if d <= 0 {
+			return sqltypes.NewInt64(int64(f / scale)), nil
+		}
+		return sqltypes.NewFloat64(f / scale), nil
+	case "greatest", "least":
+		if len(args) < 2 {
+			return sqltypes.NULL, errors.Errorf("Incorrect parameter count in the call to native function '%s'", expr.Name.String())
+		}
+		res := args[0]
+		for _, arg := range args {
+			if arg.IsNull() {
+				return sqltypes.NULL, nil
+			}
+			cmp := compareValues(arg, res)
+			if (name == "greatest" && cmp > 0) || (name == "least" && cmp < 0) {
+				res = arg
+			}
+		}
+		return res, nil
+	case "concat":
+		var buf bytes.Buffer
+		for _, arg := range args {
+			if arg.IsNull() {
+				return sqltypes.NULL, nil
+			}
+			buf.Write(arg.Raw())
+		}
+		return sqltypes.NewVarChar(buf.String()), nil
+	case "lower", "lcase", "upper", "ucase":
+		if args[0].IsNull() {
+			return sqltypes.NULL, nil
+		}
+		if name == "lower" || name == "lcase" {
+			return sqltypes.NewVarChar(strings.ToLower(string(args[0].Raw()))), nil
+		}
+		return sqltypes.NewVarChar(strings.ToUpper(string(args[0].Raw()))), nil
+	case "length":
+		if args[0].IsNull() {
+			return sqltypes.NULL, nil
+		}
+		return sqltypes.NewInt64(int64(len(args[0].Raw()))), nil
+	case "char_length", "character_length":
+		if args[0].IsNull() {
+			return sqltypes.NULL, nil
+		}
+		return sqltypes.NewInt64(int64(utf8.RuneCount(args[0].Raw()))), nil
+	}
+	return sqltypes.NULL, errors.Errorf("unsupported: function[%s].in.%s", expr.Name.String(), r.scope())
+}
+
+// condOf converts the bool to condResult.
+func condOf(b bool) condResult {
+	if b {
+		return condTrue
+	}
+	return condFalse
+}
+
+// truth returns the truth value of the value, the non-zero number is true.
+func truth(v sqltypes.Value) (condResult, error) {
+	if v.IsNull() {
+		return condNull, nil
+	}
+	return condOf(toFloat64(v) != 0), nil
+}
+
+// boolInt converts the bool to 1 or 0.
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// isNumber returns true if the value is a number.
+func isNumber(v sqltypes.Value) bool {
+	return v.IsIntegral() || v.IsFloat() || v.Type() == querypb.Type_DECIMAL
+}
+
+// toFloat64 converts the value to float64 as MySQL does, the invalid number is 0.
+func toFloat64(v sqltypes.Value) float64 {
+	s := strings.TrimSpace(common.BytesToString(v.Raw()))
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	// The longest numeric prefix, such as '12abc' is 12.
+	for i := len(s); i > 0; i-- {
+		if f, err := strconv.ParseFloat(s[:i], 64); err == nil {
+			return f
+		}
+	}
+	return 0
+}
+
+// toUint64 converts the value to uint64 for the bit operators.
+func toUint64(v sqltypes.Value) uint64 {
+	if v.IsUnsigned() {
+		if u, err := v.ParseUint64(); err == nil {
+			return u
+		}
+	}
+	f := toFloat64(v)
+	if f < 0 {
+		return uint64(int64(f))
+	}
+	return uint64(f + 0.5)
+}
+
+// compareValues compares the two non-NULL values.
+// The numbers are compared numerically, the others are compared as bytes.
+func compareValues(a, b sqltypes.Value) int {
+	return compareCollated(a, b, collationBinary)
+}
+
+// compareCollated compares the two non-NULL values, the strings are compared by the collation.
+// The decimals are compared exactly with the integers and the decimals.
+func compareCollated(a, b sqltypes.Value, coll collation) int {
+	switch {
+	case a.IsSigned() && b.IsSigned():
+		x, err1 := a.ParseInt64()
+		y, err2 := b.ParseInt64()
+		if err1 == nil && err2 == nil {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	case a.IsUnsigned() && b.IsUnsigned():
+		x, err1 := a.ParseUint64()
+		y, err2 := b.ParseUint64()
+		if err1 == nil && err2 == nil {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	if isExact(a) && isExact(b) && (a.Type() == querypb.Type_DECIMAL || b.Type() == querypb.Type_DECIMAL) {
+		x, ok1 := new(big.Rat).SetString(string(a.Raw()))
+		y, ok2 := new(big.Rat).SetString(string(b.Raw()))
+		if ok1 && ok2 {
+			return x.Cmp(y)
+		}
+	}
+	if isNumber(a) || isNumber(b) {
+		x, y := toFloat64(a), toFloat64(b)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	if coll != collationBinary && a.IsText() && b.IsText() {
+		return strings.Compare(collationKey(a.Raw(), coll), collationKey(b.Raw(), coll))
+	}
+	return bytes.Compare(a.Raw(), b.Raw())
+}
+
+// isExact returns true if the value is an integer or a decimal.
+func isExact(v sqltypes.Value) bool {
+	return v.IsIntegral() || v.Type() == querypb.Type_DECIMAL
+}
+
+// compareNullable compares the two values, NULL is less than any other value.
+func compareNullable(a, b sqltypes.Value) int {
+	switch {
+	case a.IsNull() && b.IsNull():
+		return 0
+	case a.IsNull():
+		return -1
+	case b.IsNull():
+		return 1
+	}
+	return compareValues(a, b)
+}
+
+// collation is the rule to compare the strings.
+type collation int
+
+const (
+	// collationCI compares the strings case-insensitively and ignores the trailing spaces,
+	// such as utf8mb4_general_ci.
+	collationCI collation = iota
+	// collationNoPadCI compares the strings case-insensitively, such as utf8mb4_0900_ai_ci.
+	collationNoPadCI
+	// collationBinary compares the bytes, such as binary and utf8mb4_bin.
+	collationBinary
+)
+
+const (
+	// binaryCollationID is the id of the binary collation.
+	binaryCollationID = 63
+	// noPadCollationID is the first id of the utf8mb4_0900 collations, they are NO PAD.
+	noPadCollationID = 255
+)
+
+// caseSensitiveCollations are the case-sensitive collations not flagged binary.
+var caseSensitiveCollations = map[uint32]bool{
+	42:  true, // latin7_general_cs
+	49:  true, // latin1_general_cs
+	278: true, // utf8mb4_0900_as_cs
+}
+
+// fieldCollation returns the collation of the field, the _bin collations are flagged binary by MySQL.
+func fieldCollation(field *querypb.Field) collation {
+	switch {
+	case field == nil:
+		return collationCI
+	case field.Charset == binaryCollationID, field.Flags&uint32(querypb.MySqlFlag_BINARY_FLAG) != 0, caseSensitiveCollations[field.Charset]:
+		return collationBinary
+	case field.Charset >= noPadCollationID:
+		return collationNoPadCI
+	}
+	return collationCI
+}
+
+// mergeCollation returns the collation to compare the values of the two collations, the binary one wins.
+func mergeCollation(a, b collation) collation {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// collationKey returns the key of the string, the strings equal by the collation have the same key.
+func collationKey(raw []byte, coll collation) string {
+	s := string(raw)
+	switch coll {
+	case collationCI:
+		return strings.ToLower(strings.TrimRight(s, " "))
+	case collationNoPadCI:
+		return strings.ToLower(s)
+	}
+	return s
+}
+
+// decimalKey returns the shortest form of the decimal, such as '1.50' is '1.5', false if it's invalid.
+func decimalKey(raw []byte) (string, bool) {
+	s := strings.TrimSpace(string(raw))
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimLeft(s, "+-")
+	intPart, fracPart := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+	}
+	for _, part := range []string{intPart, fracPart} {
+		for _, c := range part {
+			if c < '0' || c > '9' {
+				return "", false
+			}
+		}
+	}
+	intPart = strings.TrimLeft(intPart, "0")
+	fracPart = strings.TrimRight(fracPart, "0")
+	if intPart == "" {
+		intPart = "0"
+	}
+	key := intPart
+	if fracPart != "" {
+		key += "." + fracPart
+	}
+	if neg && key != "0" {
+		key = "-" + key
+	}
+	return key, true
+}
+
+// hashKey returns the key of the value used by the hash join, COUNT(DISTINCT) and UNION,
+// the numbers equal to each other have the same key, so do the strings equal by the collation.
+func hashKey(v sqltypes.Value, coll collation) string {
+	if isNumber(v) {
+		if v.IsSigned() {
+			if i, err := v.ParseInt64(); err == nil {
+				return strconv.FormatInt(i, 10)
+			}
+		}
+		if v.IsUnsigned() {
+			if u, err := v.ParseUint64(); err == nil {
+				return strconv.FormatUint(u, 10)
+			}
+		}
+		if v.Type() == querypb.Type_DECIMAL {
+			if key, ok := decimalKey(v.Raw()); ok {
+				return key
+			}
+		}
+		return strconv.FormatFloat(toFloat64(v), 'f', -1, 64)
+	}
+	if v.IsText() {
+		return collationKey(v.Raw(), coll)
+	}
+	return string(v.Raw())
+}
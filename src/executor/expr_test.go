@@ -0,0 +1,207 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package executor
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+func TestExprEvalCond(t *testing.T) {
+	schema := newRowSchema([]string{"a", "b"}, [][]*querypb.Field{
+		{{Name: "id", Type: querypb.Type_INT64}, {Name: "name", Type: querypb.Type_VARCHAR}},
+		{{Name: "id", Type: querypb.Type_INT64}, {Name: "score", Type: querypb.Type_FLOAT64}},
+	})
+	row := []sqltypes.Value{
+		sqltypes.NewInt64(3),
+		sqltypes.NewVarChar("x"),
+		sqltypes.NULL,
+		sqltypes.NewFloat64(1.5),
+	}
+
+	tests := []struct {
+		expr string
+		want condResult
+	}{
+		{"a.id = 3", condTrue},
+		{"a.id = '3'", condTrue},
+		{"a.id < b.score", condFalse},
+		{"a.id > b.score and name = 'x'", condTrue},
+		{"a.id = b.id", condNull},
+		{"a.id = b.id or a.id = 3", condTrue},
+		{"a.id = b.id and a.id = 4", condFalse},
+		{"not (a.id = b.id)", condNull},
+		{"b.id is null and b.score is not null", condTrue},
+		{"a.id <=> b.id", condFalse},
+		{"b.id <=> null", condTrue},
+		{"a.id in (1, 2, 3)", condTrue},
+		{"a.id not in (1, null)", condNull},
+		{"a.id between 1 and 3", condTrue},
+		{"b.score not between 1 and 2", condFalse},
+		{"a.id != 3", condFalse},
+		{"(a.id >= 3) is true", condTrue},
+		{"a.id + 1 = 4", condTrue},
+		{"a.id * b.score - 0.5 = 4", condTrue},
+		{"a.id / 2 = 1.5 and a.id div 2 = 1 and a.id % 2 = 1", condTrue},
+		{"a.id / 0", condNull},
+		{"-a.id = -3", condTrue},
+		{"ifnull(b.id, a.id) = 3", condTrue},
+		{"coalesce(b.id, null, 5) = 5", condTrue},
+		{"if(b.id is null, 1, 0)", condTrue},
+		{"case when a.id > 5 then 0 when a.id > 2 then 1 end", condTrue},
+		{"case name when 'y' then 0 else 1 end", condTrue},
+		{"concat(name, a.id) = 'x3' and upper(name) = 'X' and length(name) = 1", condTrue},
+		{"greatest(a.id, b.score, 2) = 3 and least(a.id, b.score) = 1.5", condTrue},
+		{"round(b.score) = 2 and floor(b.score) = 1 and ceil(b.score) = 2 and abs(-b.score) = 1.5", condTrue},
+	}
+	for _, test := range tests {
+		node, err := sqlparser.Parse("select * from t where " + test.expr)
+		assert.Nil(t, err)
+		expr := node.(*sqlparser.Select).Where.Expr
+		got, err := evalCond(expr, row, schema.resolver(2))
+		assert.Nil(t, err, test.expr)
+		assert.Equal(t, test.want, got, test.expr)
+	}
+
+	// Errors.
+	{
+		errs := []struct {
+			expr string
+			want string
+		}{
+			{"id = 3", "column[id].in.cross-shard.join.is.ambiguous"},
+			{"c.id = 3", "unknown.column[c.id].in.cross-shard.join"},
+			{"a.id like 'x%'", "unsupported: operator[like].in.cross-shard.join"},
+			{"rand(a.id) > 1", "unsupported: function[rand].in.cross-shard.join"},
+		}
+		for _, e := range errs {
+			node, err := sqlparser.Parse("select * from t where " + e.expr)
+			assert.Nil(t, err)
+			_, err = evalCond(node.(*sqlparser.Select).Where.Expr, row, schema.resolver(2))
+			assert.Equal(t, e.want, err.Error())
+		}
+	}
+}
+
+func TestExprCompareValues(t *testing.T) {
+	tests := []struct {
+		a    sqltypes.Value
+		b    sqltypes.Value
+		want int
+	}{
+		{sqltypes.NewInt64(9), sqltypes.NewInt64(10), -1},
+		{sqltypes.NewUint64(10), sqltypes.NewUint64(10), 0},
+		{sqltypes.NewFloat64(1.5), sqltypes.NewInt64(1), 1},
+		{sqltypes.NewVarChar("10"), sqltypes.NewInt64(9), 1},
+		{sqltypes.NewVarChar("b"), sqltypes.NewVarChar("a"), 1},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, compareValues(test.a, test.b))
+	}
+
+	assert.Equal(t, -1, compareNullable(sqltypes.NULL, sqltypes.NewInt64(1)))
+	assert.Equal(t, 0, compareNullable(sqltypes.NULL, sqltypes.NULL))
+	assert.Equal(t, hashKey(sqltypes.NewInt64(1), collationCI), hashKey(sqltypes.NewFloat64(1), collationCI))
+	assert.Equal(t, hashKey(sqltypes.NewInt64(1), collationCI), hashKey(sqltypes.NewVarChar("1"), collationCI))
+}
+
+func TestExprArithmetic(t *testing.T) {
+	decimal := func(s string) sqltypes.Value {
+		return sqltypes.MakeTrusted(querypb.Type_DECIMAL, []byte(s))
+	}
+	tests := []struct {
+		op    string
+		left  sqltypes.Value
+		right sqltypes.Value
+		want  string
+	}{
+		{"+", sqltypes.NewInt64(math.MaxInt64 - 1), sqltypes.NewInt64(1), "INT64 9223372036854775807"},
+		{"-", sqltypes.NewInt64(math.MinInt64 + 1), sqltypes.NewInt64(1), "INT64 -9223372036854775808"},
+		{"*", sqltypes.NewInt64(-1), sqltypes.NewInt64(math.MaxInt64), "INT64 -9223372036854775807"},
+		{"/", sqltypes.NewInt64(1), sqltypes.NewInt64(3), "DECIMAL 0.3333"},
+		{"/", sqltypes.NewInt64(2), sqltypes.NewInt64(3), "DECIMAL 0.6667"},
+		{"/", sqltypes.NewInt64(-5), sqltypes.NewInt64(2), "DECIMAL -2.5000"},
+		{"/", decimal("1.50"), sqltypes.NewInt64(4), "DECIMAL 0.375000"},
+		{"/", sqltypes.NewInt64(1), decimal("0.00"), "NULL_TYPE "},
+		{"/", sqltypes.NewFloat64(1), sqltypes.NewInt64(4), "FLOAT64 0.25"},
+		{"div", sqltypes.NewInt64(7), sqltypes.NewInt64(2), "INT64 3"},
+	}
+	for _, test := range tests {
+		got, err := evalArithmetic(test.op, test.left, test.right)
+		assert.Nil(t, err)
+		assert.Equal(t, test.want, fmt.Sprintf("%v %s", got.Type(), got.Raw()), test.op)
+	}
+
+	// Errors.
+	{
+		tests := []struct {
+			op    string
+			left  sqltypes.Value
+			right sqltypes.Value
+			want  string
+		}{
+			{"+", sqltypes.NewInt64(math.MaxInt64), sqltypes.NewInt64(1), "BIGINT value is out of range in '(9223372036854775807 + 1)' (errno 1690) (sqlstate 22003)"},
+			{"-", sqltypes.NewInt64(math.MinInt64), sqltypes.NewInt64(1), "BIGINT value is out of range in '(-9223372036854775808 - 1)' (errno 1690) (sqlstate 22003)"},
+			{"-", sqltypes.NewInt64(0), sqltypes.NewInt64(math.MinInt64), "BIGINT value is out of range in '(0 - -9223372036854775808)' (errno 1690) (sqlstate 22003)"},
+			{"*", sqltypes.NewInt64(math.MaxInt64), sqltypes.NewInt64(2), "BIGINT value is out of range in '(9223372036854775807 * 2)' (errno 1690) (sqlstate 22003)"},
+			{"*", sqltypes.NewInt64(math.MinInt64), sqltypes.NewInt64(-1), "BIGINT value is out of range in '(-9223372036854775808 * -1)' (errno 1690) (sqlstate 22003)"},
+			{"div", sqltypes.NewInt64(math.MinInt64), sqltypes.NewInt64(-1), "BIGINT value is out of range in '(-9223372036854775808 div -1)' (errno 1690) (sqlstate 22003)"},
+			{"div", sqltypes.NewFloat64(1e30), sqltypes.NewInt64(1), "BIGINT value is out of range in '(1e+30 div 1)' (errno 1690) (sqlstate 22003)"},
+		}
+		for _, test := range tests {
+			_, err := evalArithmetic(test.op, test.left, test.right)
+			assert.Equal(t, test.want, err.Error())
+		}
+	}
+}
+
+func TestExprCollation(t *testing.T) {
+	decimal := func(s string) sqltypes.Value {
+		return sqltypes.MakeTrusted(querypb.Type_DECIMAL, []byte(s))
+	}
+	abc, ABC := sqltypes.NewVarChar("abc"), sqltypes.NewVarChar("ABC ")
+
+	// The keys.
+	assert.Equal(t, hashKey(abc, collationCI), hashKey(ABC, collationCI))
+	assert.NotEqual(t, hashKey(abc, collationNoPadCI), hashKey(ABC, collationNoPadCI))
+	assert.NotEqual(t, hashKey(abc, collationBinary), hashKey(ABC, collationBinary))
+	assert.Equal(t, hashKey(decimal("1.50"), collationCI), hashKey(sqltypes.NewFloat64(1.5), collationCI))
+	assert.Equal(t, hashKey(decimal("-001.000"), collationCI), hashKey(sqltypes.NewInt64(-1), collationCI))
+	assert.Equal(t, "0", hashKey(decimal("-0.00"), collationCI))
+	assert.NotEqual(t, hashKey(decimal("12345678901234567890.1"), collationCI), hashKey(decimal("12345678901234567890.2"), collationCI))
+
+	// The comparisons.
+	assert.Equal(t, 0, compareCollated(abc, ABC, collationCI))
+	assert.Equal(t, 1, compareCollated(abc, ABC, collationBinary))
+	assert.Equal(t, -1, compareValues(decimal("12345678901234567890.1"), decimal("12345678901234567890.2")))
+	assert.Equal(t, 1, compareValues(decimal("9223372036854775807.5"), sqltypes.NewInt64(math.MaxInt64)))
+
+	// The collations of the fields.
+	tests := []struct {
+		field *querypb.Field
+		want  collation
+	}{
+		{&querypb.Field{Type: querypb.Type_VARCHAR, Charset: 33}, collationCI},
+		{&querypb.Field{Type: querypb.Type_VARCHAR, Charset: 255}, collationNoPadCI},
+		{&querypb.Field{Type: querypb.Type_VARCHAR, Charset: 83, Flags: uint32(querypb.MySqlFlag_BINARY_FLAG)}, collationBinary},
+		{&querypb.Field{Type: querypb.Type_VARBINARY, Charset: 63}, collationBinary},
+		{&querypb.Field{Type: querypb.Type_VARCHAR, Charset: 278}, collationBinary},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, fieldCollation(test.field))
+	}
+	assert.Equal(t, collationBinary, mergeCollation(collationCI, collationBinary))
+}
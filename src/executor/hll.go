@@ -0,0 +1,75 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package executor
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+const (
+	// hllPrecision is the number of the index bits, the standard error is 1.04/sqrt(2^precision), about 1.6%.
+	hllPrecision = 12
+	hllRegisters = 1 << hllPrecision
+)
+
+// hyperLogLog is the HyperLogLog sketch to estimate the number of the distinct values
+// in the fixed memory(4KB).
+type hyperLogLog struct {
+	registers [hllRegisters]uint8
+}
+
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{}
+}
+
+// add adds the value to the sketch.
+func (h *hyperLogLog) add(value string) {
+	hasher := fnv.New64a()
+	hasher.Write([]byte(value))
+	x := mix64(hasher.Sum64())
+
+	idx := x >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+}
+
+// count returns the estimated number of the distinct values.
+func (h *hyperLogLog) count() uint64 {
+	m := float64(hllRegisters)
+	sum := 0.0
+	zeros := 0
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+
+	// Small range correction by the linear counting.
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// mix64 is the finalizer of the MurmurHash3 to spread the bits of the hash.
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
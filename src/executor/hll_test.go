@@ -0,0 +1,29 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package executor
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	tests := []int{0, 1, 1000, 100000}
+	for _, n := range tests {
+		hll := newHyperLogLog()
+		for i := 0; i < n; i++ {
+			hll.add(fmt.Sprintf("%d", i))
+			// Duplicates don't change the estimate.
+			hll.add(fmt.Sprintf("%d", i))
+		}
+		assert.InEpsilon(t, float64(n)+1, float64(hll.count())+1, 0.05, "n=%d", n)
+	}
+}
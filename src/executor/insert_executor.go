@@ -9,13 +9,23 @@
 package executor
 
 import (
+	"fmt"
+
 	"backend"
 	"planner"
 	"xcontext"
 
+	"github.com/pkg/errors"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
 
+const (
+	// insertSelectBatchRows is the default rows of one batch inserted by INSERT ... SELECT.
+	insertSelectBatchRows = 1000
+)
+
 var (
 	_ Executor = &InsertExecutor{}
 )
@@ -39,6 +49,12 @@ func NewInsertExecutor(log *xlog.Log, plan planner.Plan, txn backend.Transaction
 // Execute used to execute the executor.
 func (executor *InsertExecutor) Execute(ctx *xcontext.ResultContext) error {
 	plan := executor.plan.(*planner.InsertPlan)
+	if plan.Select != nil {
+		return executor.executeSelect(ctx, plan)
+	}
+	if plan.Move != nil {
+		return executeMove(plan.Move, plan.ReqMode, plan.RawQuery, executor.txn, ctx)
+	}
 	reqCtx := xcontext.NewRequestContext()
 	reqCtx.Mode = plan.ReqMode
 	reqCtx.TxnMode = xcontext.TxnWrite
@@ -52,3 +68,126 @@ func (executor *InsertExecutor) Execute(ctx *xcontext.ResultContext) error {
 	ctx.Results = rs
 	return nil
 }
+
+// executeSelect executes the INSERT ... SELECT, the selected rows are routed by the shard key of
+// the target table and inserted in batches.
+// The rows are streamed from the shards if the select needs nothing done in the proxy, unless the
+// txn is in twopc mode, which shares the connection to every backend between the reads and writes.
+// Otherwise the select is executed first.
+func (executor *InsertExecutor) executeSelect(ctx *xcontext.ResultContext, plan *planner.InsertPlan) error {
+	txn := executor.txn
+	batchRows, maxRows := txn.InsertSelectLimits()
+	if batchRows <= 0 {
+		batchRows = insertSelectBatchRows
+	}
+
+	// The shard key fields of the target table, the selected values are converted to their types.
+	var keyFields []*querypb.Field
+	if tuple, ok, err := plan.ShardKeyQuery(); err != nil {
+		return err
+	} else if ok {
+		reqCtx := xcontext.NewRequestContext()
+		reqCtx.Mode = plan.ReqMode
+		reqCtx.TxnMode = xcontext.TxnRead
+		reqCtx.Querys = []xcontext.QueryTuple{tuple}
+		reqCtx.RawQuery = plan.RawQuery
+		rs, err := txn.Execute(reqCtx)
+		if err != nil {
+			return err
+		}
+		keyFields = rs.Fields
+	}
+
+	qr := &sqltypes.Result{}
+	total := 0
+	batch := make([][]sqltypes.Value, 0, batchRows)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		querys, err := plan.RowsQuerys(batch, keyFields)
+		if err != nil {
+			return err
+		}
+		reqCtx := xcontext.NewRequestContext()
+		reqCtx.Mode = plan.ReqMode
+		reqCtx.TxnMode = xcontext.TxnWrite
+		reqCtx.Querys = querys
+		reqCtx.RawQuery = plan.RawQuery
+		rs, err := txn.Execute(reqCtx)
+		if err != nil {
+			return err
+		}
+		qr.RowsAffected += rs.RowsAffected
+		batch = batch[:0]
+		return nil
+	}
+	insert := func(fields []*querypb.Field, rows [][]sqltypes.Value) error {
+		if n := plan.Columns(); n > 0 && n != len(fields) {
+			return errors.New("Column count doesn't match value count at row 1")
+		}
+		for _, row := range rows {
+			total++
+			if maxRows > 0 && total > maxRows {
+				return fmt.Errorf("insert.select.rows.exceeds.the.limit[%d]", maxRows)
+			}
+			batch = append(batch, row)
+			if len(batch) >= batchRows {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	if sel, ok := plan.Select.(*planner.SelectPlan); ok && !txn.TwoPC() && streamable(sel) {
+		reqCtx := xcontext.NewRequestContext()
+		reqCtx.Mode = sel.ReqMode
+		reqCtx.TxnMode = xcontext.TxnRead
+		reqCtx.Querys = sel.Querys
+		reqCtx.RawQuery = sel.RawQuery
+		if err := txn.ExecuteRowStream(reqCtx, insert, batchRows); err != nil {
+			return err
+		}
+	} else {
+		rs, err := executeSelectPlan(executor.log, plan.Select, txn)
+		if err != nil {
+			return err
+		}
+		if err := insert(rs.Fields, rs.Rows); err != nil {
+			return err
+		}
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	ctx.Results = qr
+	return nil
+}
+
+// streamable returns true if the shard rows of the select plan are the result rows,
+// there's no aggregation, order by or limit done in the proxy.
+func streamable(plan *planner.SelectPlan) bool {
+	if plan.ReqMode != xcontext.ReqNormal {
+		return false
+	}
+	if plan.Children() == nil {
+		return true
+	}
+	for _, subPlan := range plan.Children().Plans() {
+		switch subPlan := subPlan.(type) {
+		case *planner.AggregatePlan:
+			if !subPlan.Empty() {
+				return false
+			}
+		case *planner.OrderByPlan:
+			if len(subPlan.OrderBys) > 0 {
+				return false
+			}
+		case *planner.LimitPlan:
+			return false
+		}
+	}
+	return true
+}
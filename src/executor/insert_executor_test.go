@@ -19,6 +19,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
 
@@ -63,3 +64,157 @@ func TestInsertExecutor(t *testing.T) {
 		}
 	}
 }
+
+func TestInsertExecutorSelect(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	// Create scatter and query handler.
+	scatter, fakedbs, cleanup := backend.MockScatter(log, 10)
+	defer cleanup()
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableAConfig(), router.MockTableSConfig())
+	assert.Nil(t, err)
+
+	fakedbs.AddQuery("select id, b from sbtest.A0 as A", mockJoinResult([]string{"id", "b"}, []string{"1", "2"}, []string{"2", "3"}))
+	fakedbs.AddQuery("select id, b from sbtest.A2 as A", mockJoinResult([]string{"id", "b"}, []string{"3", "4"}, []string{"4", "5"}))
+	fakedbs.AddQuery("select id, b from sbtest.A4 as A", mockJoinResult([]string{"id", "b"}, []string{"5", "6"}))
+	fakedbs.AddQuery("select id, b from sbtest.A8 as A", mockJoinResult([]string{"id", "b"}))
+	fakedbs.AddQueryPattern("select id, count\\(\\*\\) as b from sbtest.A.*", mockJoinResult([]string{"id", "b"}, []string{"1", "1"}))
+	fakedbs.AddQuery("select id, b from sbtest.S as S", mockJoinResult([]string{"id", "b"}, []string{"1", "2"}, []string{"770", "3"}))
+	fakedbs.AddQuery("select name, b from sbtest.S as S where b < 4", mockJoinResult([]string{"name", "b"}, []string{"1", "2"}, []string{" 770", "3"}))
+	fakedbs.AddQuery("select name, b from sbtest.S as S", mockJoinResult([]string{"name", "b"}, []string{"1", "2"}, []string{" 770", "3"}, []string{"abc", "4"}))
+	fakedbs.AddQuery("select id from sbtest.A0 limit 0", mockJoinResult([]string{"id"}))
+	fakedbs.AddQueryPattern("insert into sbtest.*", &sqltypes.Result{RowsAffected: 1})
+
+	querys := []string{
+		// Streamed, 5 rows in 3 batches.
+		"insert into S(id, b) select id, b from A",
+		// Aggregated in the proxy, 1 row.
+		"insert into S(id, b) select id, count(*) as b from A group by id",
+		// Routed by the shard key to A8 and A4.
+		"insert into A(id, b) select id, b from S",
+		// The strings are converted to the int shard key, routed to A8 and A4 too.
+		"insert into A(id, b) select name, b from S where b < 4",
+	}
+	affected := []uint64{3, 1, 2, 2}
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+
+		plan := planner.NewInsertPlan(log, database, query, node.(*sqlparser.Insert), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+
+		txn, err := scatter.CreateTransaction()
+		assert.Nil(t, err)
+		defer txn.Finish()
+		txn.SetInsertSelectLimits(2, 10)
+		executor := NewInsertExecutor(log, plan, txn)
+		{
+			ctx := xcontext.NewResultContext()
+			err := executor.Execute(ctx)
+			assert.Nil(t, err)
+			assert.Equal(t, affected[i], ctx.Results.RowsAffected, query)
+		}
+	}
+	assert.Equal(t, 1, fakedbs.GetQueryCalledNum("insert into sbtest.S(id, b) values (5, 6)"))
+	assert.Equal(t, 2, fakedbs.GetQueryCalledNum("insert into sbtest.A8(id, b) values (1, 2)"))
+	assert.Equal(t, 2, fakedbs.GetQueryCalledNum("insert into sbtest.A4(id, b) values (770, 3)"))
+
+	// Errors.
+	{
+		querys := []string{
+			"insert into S(id, b) select id, b from A",
+			"insert into S(id) select id, b from A",
+			"insert into A(id, b) select name, b from S",
+		}
+		results := []string{
+			"insert.select.rows.exceeds.the.limit[3]",
+			"Column count doesn't match value count at row 1",
+			"Incorrect integer value: 'abc' for column 'id' (errno 1366) (sqlstate HY000)",
+		}
+		for i, query := range querys {
+			node, err := sqlparser.Parse(query)
+			assert.Nil(t, err)
+
+			plan := planner.NewInsertPlan(log, database, query, node.(*sqlparser.Insert), route)
+			err = plan.Build()
+			assert.Nil(t, err)
+
+			txn, err := scatter.CreateTransaction()
+			assert.Nil(t, err)
+			defer txn.Finish()
+			txn.SetInsertSelectLimits(2, 3)
+			err = NewInsertExecutor(log, plan, txn).Execute(xcontext.NewResultContext())
+			assert.Equal(t, results[i], err.Error())
+		}
+	}
+}
+
+func TestInsertExecutorOnDupShardKey(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	// Create scatter and query handler.
+	scatter, fakedbs, cleanup := backend.MockScatter(log, 10)
+	defer cleanup()
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableAConfig())
+	assert.Nil(t, err)
+	err = route.SetUniqueKey(database, "A", "PRIMARY", "id")
+	assert.Nil(t, err)
+
+	fakedbs.AddQueryPattern("XA .*", &sqltypes.Result{})
+	fakedbs.AddQuery("select *, 770 from sbtest.A8 where id = 1 for update", mockJoinResult([]string{"id", "b", "770"}, []string{"1", "2", "770"}))
+	fakedbs.AddQuery("select *, 770 from sbtest.A8 where id = 2 for update", mockJoinResult([]string{"id", "b", "770"}))
+	fakedbs.AddQuery("delete from sbtest.A8 where id = 1", &sqltypes.Result{RowsAffected: 1})
+	fakedbs.AddQueryPattern("insert into sbtest.*", &sqltypes.Result{RowsAffected: 1})
+
+	querys := []string{
+		// The duplicate row is moved from A8 to A4.
+		"insert into A(id, b) values(1, 3) on duplicate key update id = 770",
+		// No duplicate row, the row is inserted.
+		"insert into A(id, b) values(2, 3) on duplicate key update id = 770",
+	}
+	affected := []uint64{2, 1}
+	events := [][]xcontext.BinlogEvent{
+		{
+			{Typ: "DELETE", Query: "delete from sbtest.A where id = 1"},
+			{Typ: "INSERT", Query: "insert into sbtest.A(id, b) values (770, 2)"},
+		},
+		{
+			{Typ: "INSERT", Query: "insert into sbtest.A(id, b) values (2, 3)"},
+		},
+	}
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+
+		plan := planner.NewInsertPlan(log, database, query, node.(*sqlparser.Insert), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+
+		txn, err := scatter.CreateTransaction()
+		assert.Nil(t, err)
+		defer txn.Finish()
+		err = txn.Begin()
+		assert.Nil(t, err)
+		executor := NewInsertExecutor(log, plan, txn)
+		{
+			ctx := xcontext.NewResultContext()
+			err := executor.Execute(ctx)
+			assert.Nil(t, err)
+			assert.Equal(t, affected[i], ctx.Results.RowsAffected, query)
+			assert.Equal(t, events[i], ctx.Events)
+		}
+	}
+	assert.Equal(t, 1, fakedbs.GetQueryCalledNum("insert into sbtest.A4(id, b) values (770, 2)"))
+	assert.Equal(t, 1, fakedbs.GetQueryCalledNum("insert into sbtest.A8(id, b) values (2, 3)"))
+}
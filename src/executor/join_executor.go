@@ -9,31 +9,333 @@
 package executor
 
 import (
+	"fmt"
+	"sort"
+
+	"backend"
 	"planner"
 	"xcontext"
 
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
 	"github.com/xelabs/go-mysqlstack/xlog"
+
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 )
 
 var (
 	_ Executor = &JoinExecutor{}
 )
 
-// JoinExecutor tuple.
+// JoinExecutor represents the cross-shard join executor.
 type JoinExecutor struct {
 	log  *xlog.Log
 	plan planner.Plan
+	txn  backend.Transaction
 }
 
 // NewJoinExecutor creates new join executor.
-func NewJoinExecutor(log *xlog.Log, plan planner.Plan) *JoinExecutor {
+func NewJoinExecutor(log *xlog.Log, plan planner.Plan, txn backend.Transaction) *JoinExecutor {
 	return &JoinExecutor{
 		log:  log,
 		plan: plan,
+		txn:  txn,
 	}
 }
 
+// joinState tuple, the joined rows and the memory usage of the current join.
+type joinState struct {
+	schema    *rowSchema
+	rows      [][]sqltypes.Value
+	size      int
+	maxResult int
+}
+
+// add adds the joined row, returns error if the max result size is exceeded.
+func (s *joinState) add(rows [][]sqltypes.Value, row []sqltypes.Value) ([][]sqltypes.Value, error) {
+	for _, v := range row {
+		s.size += v.Len()
+	}
+	if s.maxResult > 0 && s.size > s.maxResult {
+		return nil, fmt.Errorf("Query execution was interrupted, max memory usage[%d bytes] exceeded", s.maxResult)
+	}
+	return append(rows, row), nil
+}
+
 // Execute used to execute the executor.
+// The rows of every table are fetched by the select executor, then joined one table by one table,
+// at last the joined rows are sorted, limited and projected to the select list.
 func (executor *JoinExecutor) Execute(ctx *xcontext.ResultContext) error {
+	log := executor.log
+	plan := executor.plan.(*planner.JoinPlan)
+
+	names := make([]string, len(plan.Tables))
+	fields := make([][]*querypb.Field, len(plan.Tables))
+	results := make([]*sqltypes.Result, len(plan.Tables))
+	for i, table := range plan.Tables {
+		rsCtx := xcontext.NewResultContext()
+		if err := NewSelectExecutor(log, table.Plan, executor.txn).Execute(rsCtx); err != nil {
+			return err
+		}
+		names[i] = table.Name
+		fields[i] = rsCtx.Results.Fields
+		results[i] = rsCtx.Results
+	}
+
+	state := &joinState{
+		schema:    newRowSchema(names, fields),
+		rows:      results[0].Rows,
+		maxResult: executor.txn.MaxResult(),
+	}
+	for _, join := range plan.Joins {
+		if err := state.join(join, results[join.Right]); err != nil {
+			return err
+		}
+	}
+
+	if err := state.orderBy(plan.OrderBy); err != nil {
+		return err
+	}
+	if plan.Limit != nil {
+		state.limit(plan.Limit.Offset, plan.Limit.Limit)
+	}
+	qr, err := state.project(plan.Project)
+	if err != nil {
+		return err
+	}
+	ctx.Results = qr
+	return nil
+}
+
+// join joins the rows with the rows of the right table.
+func (s *joinState) join(join *planner.Join, right *sqltypes.Result) error {
+	var err error
+	var rows [][]sqltypes.Value
+	n := join.Right + 1
+	s.size = 0
+	nulls := make([]sqltypes.Value, len(right.Fields))
+
+	// match checks the joined row satisfies the join conditions.
+	match := func(row []sqltypes.Value) (bool, error) {
+		for _, expr := range join.On {
+			res, err := evalCond(expr, row, s.schema.resolver(n))
+			if err != nil || res != condTrue {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+
+	// emit applies the filters to the joined row.
+	emit := func(row []sqltypes.Value) error {
+		for _, expr := range join.Filters {
+			res, err := evalCond(expr, row, s.schema.resolver(n))
+			if err != nil || res != condTrue {
+				return err
+			}
+		}
+		rows, err = s.add(rows, row)
+		return err
+	}
+
+	// probe joins the left row with the candidates of the right rows.
+	probe := func(left []sqltypes.Value, candidates [][]sqltypes.Value) error {
+		matched := false
+		for _, r := range candidates {
+			row := make([]sqltypes.Value, 0, len(left)+len(r))
+			row = append(append(row, left...), r...)
+			ok, err := match(row)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			matched = true
+			if err := emit(row); err != nil {
+				return err
+			}
+		}
+		if !matched && join.Type == planner.LeftJoin {
+			row := make([]sqltypes.Value, 0, len(left)+len(nulls))
+			return emit(append(append(row, left...), nulls...))
+		}
+		return nil
+	}
+
+	switch join.Strategy {
+	case planner.HashJoin:
+		// Build the hash table on the right rows.
+		rightSchema := newRowSchema(s.schema.names[join.Right:n], s.schema.fields[join.Right:n])
+		colls, err := s.keyCollations(join, rightSchema)
+		if err != nil {
+			return err
+		}
+		table := make(map[string][][]sqltypes.Value)
+		for _, r := range right.Rows {
+			key, ok, err := joinKey(join.RightKeys, r, rightSchema, 1, colls)
+			if err != nil {
+				return err
+			}
+			if ok {
+				table[key] = append(table[key], r)
+			}
+		}
+		for _, left := range s.rows {
+			key, ok, err := joinKey(join.LeftKeys, left, s.schema, join.Right, colls)
+			if err != nil {
+				return err
+			}
+			var candidates [][]sqltypes.Value
+			if ok {
+				candidates = table[key]
+			}
+			if err := probe(left, candidates); err != nil {
+				return err
+			}
+		}
+	default:
+		for _, left := range s.rows {
+			if err := probe(left, right.Rows); err != nil {
+				return err
+			}
+		}
+	}
+	s.rows = rows
+	return nil
+}
+
+// keyCollations returns the collations to compare the left keys with the right keys.
+func (s *joinState) keyCollations(join *planner.Join, rightSchema *rowSchema) ([]collation, error) {
+	left, right := s.schema.resolver(join.Right), rightSchema.resolver(1)
+	colls := make([]collation, len(join.LeftKeys))
+	for i := range join.LeftKeys {
+		l, _, err := left.resolve(join.LeftKeys[i])
+		if err != nil {
+			return nil, err
+		}
+		r, _, err := right.resolve(join.RightKeys[i])
+		if err != nil {
+			return nil, err
+		}
+		colls[i] = mergeCollation(left.collation(l), right.collation(r))
+	}
+	return colls, nil
+}
+
+// joinKey returns the hash key of the row, false if any key is NULL.
+func joinKey(keys []*sqlparser.ColName, row []sqltypes.Value, schema *rowSchema, n int, colls []collation) (string, bool, error) {
+	var key []byte
+	for i, col := range keys {
+		idx, err := schema.index(col, n)
+		if err != nil {
+			return "", false, err
+		}
+		if row[idx].IsNull() {
+			return "", false, nil
+		}
+		k := hashKey(row[idx], colls[i])
+		key = append(key, fmt.Sprintf("%d:%s", len(k), k)...)
+	}
+	return string(key), true, nil
+}
+
+// orderBy sorts the joined rows, NULLs are the smallest.
+func (s *joinState) orderBy(orderBy sqlparser.OrderBy) error {
+	if len(orderBy) == 0 {
+		return nil
+	}
+	n := len(s.schema.names)
+	idxs := make([]int, len(orderBy))
+	for i, order := range orderBy {
+		idx, err := s.schema.index(order.Expr.(*sqlparser.ColName), n)
+		if err != nil {
+			return err
+		}
+		idxs[i] = idx
+	}
+	sort.SliceStable(s.rows, func(i, j int) bool {
+		for k, order := range orderBy {
+			cmp := compareNullable(s.rows[i][idxs[k]], s.rows[j][idxs[k]])
+			if cmp == 0 {
+				continue
+			}
+			if order.Direction == sqlparser.DescScr {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return false
+	})
+	return nil
+}
+
+// limit limits the joined rows.
+func (s *joinState) limit(offset, limit int) {
+	if offset >= len(s.rows) {
+		s.rows = nil
+		return
+	}
+	end := offset + limit
+	if end > len(s.rows) {
+		end = len(s.rows)
+	}
+	s.rows = s.rows[offset:end]
+}
+
+// project projects the joined rows to the select list.
+func (s *joinState) project(exprs sqlparser.SelectExprs) (*sqltypes.Result, error) {
+	var idxs []int
+	var fields []*querypb.Field
+	n := len(s.schema.names)
+	for _, expr := range exprs {
+		switch expr := expr.(type) {
+		case *sqlparser.StarExpr:
+			for i, name := range s.schema.names {
+				if !expr.TableName.IsEmpty() && expr.TableName.Name.String() != name {
+					continue
+				}
+				for j, field := range s.schema.fields[i] {
+					idxs = append(idxs, s.schema.offsets[i]+j)
+					fields = append(fields, field)
+				}
+			}
+		case *sqlparser.AliasedExpr:
+			col := expr.Expr.(*sqlparser.ColName)
+			idx, err := s.schema.index(col, n)
+			if err != nil {
+				return nil, err
+			}
+			field := *s.field(idx)
+			if !expr.As.IsEmpty() {
+				field.Name = expr.As.String()
+			}
+			idxs = append(idxs, idx)
+			fields = append(fields, &field)
+		default:
+			return nil, errors.Errorf("unsupported: select.expression[%s].in.cross-shard.join", sqlparser.String(expr))
+		}
+	}
+
+	qr := &sqltypes.Result{Fields: fields}
+	for _, row := range s.rows {
+		newRow := make([]sqltypes.Value, len(idxs))
+		for i, idx := range idxs {
+			newRow[i] = row[idx]
+		}
+		qr.Rows = append(qr.Rows, newRow)
+	}
+	qr.RowsAffected = uint64(len(qr.Rows))
+	return qr, nil
+}
+
+// field returns the field of the column in the joined row.
+func (s *joinState) field(idx int) *querypb.Field {
+	for i, offset := range s.schema.offsets {
+		if idx < offset+len(s.schema.fields[i]) {
+			return s.schema.fields[i][idx-offset]
+		}
+	}
 	return nil
 }
@@ -9,8 +9,220 @@
 package executor
 
 import (
+	"fmt"
 	"testing"
+
+	"backend"
+	"planner"
+	"router"
+	"xcontext"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/xlog"
+
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 )
 
-func TestSelecdtExecutor(t *testing.T) {
+func mockJoinResult(names []string, rows ...[]string) *sqltypes.Result {
+	qr := &sqltypes.Result{}
+	for _, name := range names {
+		typ := querypb.Type_INT32
+		if name == "name" {
+			typ = querypb.Type_VARCHAR
+		}
+		qr.Fields = append(qr.Fields, &querypb.Field{Name: name, Type: typ})
+	}
+	for _, row := range rows {
+		var values []sqltypes.Value
+		for i, v := range row {
+			values = append(values, sqltypes.MakeTrusted(qr.Fields[i].Type, []byte(v)))
+		}
+		qr.Rows = append(qr.Rows, values)
+	}
+	return qr
+}
+
+func TestJoinExecutor(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableAConfig(), router.MockTableSConfig())
+	assert.Nil(t, err)
+
+	// Create scatter and query handler.
+	scatter, fakedbs, cleanup := backend.MockScatter(log, 10)
+	defer cleanup()
+	fakedbs.AddQuery("select A.id from sbtest.A0 as A", mockJoinResult([]string{"id"}, []string{"1"}, []string{"2"}))
+	fakedbs.AddQuery("select A.id from sbtest.A2 as A", mockJoinResult([]string{"id"}, []string{"3"}))
+	fakedbs.AddQuery("select A.id from sbtest.A4 as A", mockJoinResult([]string{"id"}))
+	fakedbs.AddQuery("select A.id from sbtest.A8 as A", mockJoinResult([]string{"id"}, []string{"4"}))
+	fakedbs.AddQuery("select S.name, S.id from sbtest.S as S", mockJoinResult([]string{"name", "id"}, []string{"x", "1"}, []string{"y", "3"}, []string{"z", "3"}, []string{"w", "5"}))
+	fakedbs.AddQuery("select S.id from sbtest.S as S", mockJoinResult([]string{"id"}, []string{"1"}, []string{"3"}, []string{"3"}, []string{"5"}))
+	fakedbs.AddQuery("select S.name, S.id from sbtest.S as S where S.name != 'x'", mockJoinResult([]string{"name", "id"}, []string{"y", "3"}, []string{"z", "3"}, []string{"w", "5"}))
+
+	querys := []string{
+		"select A.id, S.name from A join S on A.id = S.id order by A.id desc",
+		"select A.id, S.name as sname from A left join S on A.id = S.id where S.name is null order by A.id",
+		"select A.id, S.id as sid from A, S where A.id > S.id order by A.id, sid limit 1, 3",
+		"select A.id, S.name from S right join A on A.id = S.id and S.name != 'x' order by A.id",
+	}
+	results := []string{
+		"[[3 y] [3 z] [1 x]]",
+		"[[2 ] [4 ]]",
+		"[[3 1] [4 1] [4 3]]",
+		"[[1 ] [2 ] [3 y] [3 z] [4 ]]",
+	}
+	fields := [][]string{
+		{"id", "name"},
+		{"id", "sname"},
+		{"id", "sid"},
+		{"id", "name"},
+	}
+
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+
+		plan := planner.NewJoinPlan(log, database, query, node.(*sqlparser.Select), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+		log.Debug("plan:%+v", plan.JSON())
+
+		txn, err := scatter.CreateTransaction()
+		assert.Nil(t, err)
+		defer txn.Finish()
+		executor := NewJoinExecutor(log, plan, txn)
+		{
+			ctx := xcontext.NewResultContext()
+			err := executor.Execute(ctx)
+			assert.Nil(t, err)
+			assert.Equal(t, results[i], fmt.Sprintf("%v", ctx.Results.Rows))
+			var got []string
+			for _, field := range ctx.Results.Fields {
+				got = append(got, field.Name)
+			}
+			assert.Equal(t, fields[i], got)
+		}
+	}
+}
+
+func TestJoinExecutorRightJoinStar(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableAConfig(), router.MockTableSConfig())
+	assert.Nil(t, err)
+
+	scatter, fakedbs, cleanup := backend.MockScatter(log, 10)
+	defer cleanup()
+	fakedbs.AddQuery("select * from sbtest.A0 as A", mockJoinResult([]string{"id", "a"}, []string{"1", "10"}, []string{"2", "20"}))
+	fakedbs.AddQueryPattern("select \\* from sbtest.A[248] as A", mockJoinResult([]string{"id", "a"}))
+	fakedbs.AddQuery("select * from sbtest.S as S", mockJoinResult([]string{"name", "id"}, []string{"x", "1"}))
+
+	// The columns of S are before the columns of A though A is the left side of the join.
+	query := "select * from S right join A on A.id = S.id order by A.id"
+	node, err := sqlparser.Parse(query)
+	assert.Nil(t, err)
+	plan := planner.NewJoinPlan(log, database, query, node.(*sqlparser.Select), route)
+	err = plan.Build()
+	assert.Nil(t, err)
+
+	txn, err := scatter.CreateTransaction()
+	assert.Nil(t, err)
+	defer txn.Finish()
+	ctx := xcontext.NewResultContext()
+	err = NewJoinExecutor(log, plan, txn).Execute(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "[[x 1 1 10] [  2 20]]", fmt.Sprintf("%v", ctx.Results.Rows))
+	var got []string
+	for _, field := range ctx.Results.Fields {
+		got = append(got, field.Name)
+	}
+	assert.Equal(t, []string{"name", "id", "id", "a"}, got)
+}
+
+func TestJoinExecutorMaxResult(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableAConfig(), router.MockTableSConfig())
+	assert.Nil(t, err)
+
+	scatter, fakedbs, cleanup := backend.MockScatter(log, 10)
+	defer cleanup()
+	fakedbs.AddQueryPattern("select A.id from .*", mockJoinResult([]string{"id"}, []string{"1"}, []string{"2"}))
+	fakedbs.AddQuery("select S.id from sbtest.S as S", mockJoinResult([]string{"id"}, []string{"1"}, []string{"3"}))
+
+	query := "select A.id, S.id from A, S"
+	node, err := sqlparser.Parse(query)
+	assert.Nil(t, err)
+	plan := planner.NewJoinPlan(log, database, query, node.(*sqlparser.Select), route)
+	err = plan.Build()
+	assert.Nil(t, err)
+
+	txn, err := scatter.CreateTransaction()
+	assert.Nil(t, err)
+	defer txn.Finish()
+	txn.SetMaxResult(8)
+
+	executor := NewJoinExecutor(log, plan, txn)
+	err = executor.Execute(xcontext.NewResultContext())
+	want := "Query execution was interrupted, max memory usage[8 bytes] exceeded"
+	assert.Equal(t, want, err.Error())
+}
+
+func TestJoinExecutorCollation(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableAConfig(), router.MockTableSConfig())
+	assert.Nil(t, err)
+
+	scatter, fakedbs, cleanup := backend.MockScatter(log, 10)
+	defer cleanup()
+	fakedbs.AddQueryPattern("select A.id, A.name from .*", mockJoinResult([]string{"id", "name"}, []string{"1", "abc"}))
+	// The names of S are case-insensitive.
+	fakedbs.AddQuery("select S.id, S.name from sbtest.S as S", mockJoinResult([]string{"id", "name"}, []string{"7", "ABC"}, []string{"8", "abd"}))
+
+	query := "select A.id, S.id as sid from A join S on A.name = S.name"
+	node, err := sqlparser.Parse(query)
+	assert.Nil(t, err)
+	plan := planner.NewJoinPlan(log, database, query, node.(*sqlparser.Select), route)
+	err = plan.Build()
+	assert.Nil(t, err)
+
+	txn, err := scatter.CreateTransaction()
+	assert.Nil(t, err)
+	defer txn.Finish()
+	{
+		ctx := xcontext.NewResultContext()
+		err := NewJoinExecutor(log, plan, txn).Execute(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, "[[1 7] [1 7] [1 7] [1 7]]", fmt.Sprintf("%v", ctx.Results.Rows))
+	}
+
+	// The names of S are binary.
+	{
+		sResult := mockJoinResult([]string{"id", "name"}, []string{"7", "ABC"}, []string{"8", "abd"})
+		sResult.Fields[1].Flags = uint32(querypb.MySqlFlag_BINARY_FLAG)
+		fakedbs.AddQuery("select S.id, S.name from sbtest.S as S", sResult)
+		ctx := xcontext.NewResultContext()
+		err := NewJoinExecutor(log, plan, txn).Execute(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(ctx.Results.Rows))
+	}
 }
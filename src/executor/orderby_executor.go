@@ -13,6 +13,7 @@ import (
 	"xcontext"
 
 	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
 
@@ -52,5 +53,17 @@ func (executor *OrderByExecutor) Execute(ctx *xcontext.ResultContext) error {
 		}
 	}
 	rs.Sort()
+	removeHiddenColumns(rs, plan.Hidden)
 	return nil
 }
+
+// removeHiddenColumns removes the hidden columns at the end.
+func removeHiddenColumns(rs *sqltypes.Result, hidden int) {
+	if hidden > 0 {
+		var idxs []int
+		for i := len(rs.Fields) - hidden; i < len(rs.Fields); i++ {
+			idxs = append(idxs, i)
+		}
+		rs.RemoveColumns(idxs...)
+	}
+}
@@ -125,3 +125,67 @@ func TestOrderByExecutor(t *testing.T) {
 		}
 	}
 }
+
+func TestOrderByExecutorHidden(t *testing.T) {
+	r1 := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "id", Type: querypb.Type_INT32},
+			{Name: "name", Type: querypb.Type_VARCHAR},
+		},
+		Rows: [][]sqltypes.Value{
+			{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("3")), sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("z"))},
+			{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("1")), sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("x"))},
+			{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("5")), sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("g"))},
+		},
+	}
+	r2 := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "c", Type: querypb.Type_INT64},
+			{Name: "name", Type: querypb.Type_VARCHAR},
+		},
+		Rows: [][]sqltypes.Value{
+			{sqltypes.MakeTrusted(querypb.Type_INT64, []byte("2")), sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("x"))},
+			{sqltypes.MakeTrusted(querypb.Type_INT64, []byte("1")), sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("g"))},
+		},
+	}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableAConfig())
+	assert.Nil(t, err)
+
+	// Create scatter and query handler.
+	scatter, fakedbs, cleanup := backend.MockScatter(log, 10)
+	defer cleanup()
+	fakedbs.AddQueryPattern("select id, name from sbtest.A[0-9]+ as A order by name desc limit 3", r1)
+	fakedbs.AddQueryPattern("select count\\(\\*\\) as c, A.name from sbtest.A[0-9]+ as A group by A.name order by name asc", r2)
+
+	querys := []string{
+		"select id from A order by name desc limit 3",
+		"select count(*) as c from A group by A.name order by name",
+	}
+	results := []string{
+		"[[3] [3] [3]]",
+		"[[4] [8]]",
+	}
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := planner.NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+
+		txn, err := scatter.CreateTransaction()
+		assert.Nil(t, err)
+		defer txn.Finish()
+		ctx := xcontext.NewResultContext()
+		err = NewSelectExecutor(log, plan, txn).Execute(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, results[i], fmt.Sprintf("%v", ctx.Results.Rows))
+		assert.Equal(t, 1, len(ctx.Results.Fields))
+	}
+}
@@ -10,10 +10,14 @@ package executor
 
 import (
 	"backend"
+	"fmt"
 	"planner"
+	"strings"
 	"xcontext"
 
 	"github.com/pkg/errors"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
 
@@ -40,31 +44,56 @@ func NewSelectExecutor(log *xlog.Log, plan planner.Plan, txn backend.Transaction
 // Execute used to execute the executor.
 func (executor *SelectExecutor) Execute(ctx *xcontext.ResultContext) error {
 	var err error
-	log := executor.log
 	plan := executor.plan.(*planner.SelectPlan)
 	subPlanTree := plan.Children()
 	reqCtx := xcontext.NewRequestContext()
 	reqCtx.Mode = plan.ReqMode
 	reqCtx.TxnMode = xcontext.TxnRead
+	// The locking read joins the XA, so the locks are held until the txn ends.
+	if plan.Locking() {
+		reqCtx.TxnMode = xcontext.TxnWrite
+	}
 	reqCtx.Querys = plan.Querys
 	reqCtx.RawQuery = plan.RawQuery
 
 	// Execute the parent plan.
-	if ctx.Results, err = executor.txn.Execute(reqCtx); err != nil {
-		return err
+	// The ordered shard results are merged by streaming if only the first rows are needed.
+	// The done plan is executed while the shard results are fetched.
+	var done planner.Plan
+	orderPlan, limitPlan := orderedMergePlans(plan)
+	switch {
+	case orderPlan != nil:
+		if ctx.Results, err = executor.txn.ExecuteOrderedMerge(reqCtx, orderByLess(orderPlan), limitPlan.Offset+limitPlan.Limit); err != nil {
+			return err
+		}
+		done = orderPlan
+	case spillEnabled(executor.txn, plan):
+		if done, err = executor.executeSpill(ctx, reqCtx, plan); err != nil {
+			return err
+		}
+		// The rows are streamed to the client already, only the fields are kept in the result.
+		if ctx.Results.State == sqltypes.RStateFinished {
+			return nil
+		}
+	default:
+		if ctx.Results, err = executor.txn.Execute(reqCtx); err != nil {
+			return err
+		}
 	}
 
 	// Execute all the children plan.
 	if subPlanTree != nil {
 		for _, subPlan := range subPlanTree.Plans() {
-			switch subPlan.Type() {
-			case planner.PlanTypeJoin:
-				joinExecutor := NewJoinExecutor(log, subPlan)
-				if err := joinExecutor.Execute(ctx); err != nil {
-					return err
+			if subPlan == done {
+				// The rows are in order already, only the hidden columns are removed.
+				if orderPlan, ok := subPlan.(*planner.OrderByPlan); ok {
+					removeHiddenColumns(ctx.Results, orderPlan.Hidden)
 				}
+				continue
+			}
+			switch subPlan.Type() {
 			case planner.PlanTypeAggregate:
-				aggrExecutor := NewAggregateExecutor(executor.log, subPlan)
+				aggrExecutor := NewAggregateExecutor(executor.log, subPlan, executor.txn)
 				if err := aggrExecutor.Execute(ctx); err != nil {
 					return err
 				}
@@ -86,3 +115,214 @@ func (executor *SelectExecutor) Execute(ctx *xcontext.ResultContext) error {
 	}
 	return nil
 }
+
+// spillEnabled returns true if the spill is enabled and the shard results are merged in the proxy.
+func spillEnabled(txn backend.Transaction, plan *planner.SelectPlan) bool {
+	conf := txn.SpillConfig()
+	return conf != nil && conf.Enable && plan.Children() != nil && len(plan.Children().Plans()) > 0
+}
+
+// executeSpill streams the shard rows into the spill sorter, which spills the rows to disk once the
+// memory budget is exceeded. If nothing is spilled, the rows are the results as the normal execution.
+// Otherwise the aggregate or the orderby plan is executed while the sorted rows are merged back,
+// the plan is returned as done. The merged rows of the orderby plan are streamed to the client
+// if the context has the stream, otherwise they are held in the results within the MaxResult.
+func (executor *SelectExecutor) executeSpill(ctx *xcontext.ResultContext, reqCtx *xcontext.RequestContext, plan *planner.SelectPlan) (planner.Plan, error) {
+	var err error
+	var spillPlan planner.Plan
+	var lessFn backend.MergeLessFunc
+
+	txn := executor.txn
+	for _, subPlan := range plan.Children().Plans() {
+		switch subPlan := subPlan.(type) {
+		case *planner.AggregatePlan:
+			if len(subPlan.NormalAggregators()) > 0 || len(subPlan.GroupAggregators()) > 0 {
+				spillPlan, lessFn = subPlan, aggregateSortLess(subPlan)
+			}
+		case *planner.OrderByPlan:
+			if spillPlan == nil && len(subPlan.OrderBys) > 0 {
+				spillPlan, lessFn = subPlan, orderByLess(subPlan)
+			}
+		}
+	}
+	if spillPlan == nil {
+		ctx.Results, err = txn.Execute(reqCtx)
+		return nil, err
+	}
+
+	sorter := newSpillSorter(executor.log, txn.SpillConfig(), plan.RawQuery, lessFn)
+	defer sorter.close()
+	if err := txn.ExecuteRowStream(reqCtx, sorter.add, spillBatchRows); err != nil {
+		return nil, err
+	}
+	qr := &sqltypes.Result{Fields: sorter.fields}
+	ctx.Results = qr
+	if !sorter.spilled() {
+		qr.Rows = sorter.rows
+		qr.RowsAffected = uint64(len(qr.Rows))
+		return nil, nil
+	}
+
+	next, err := sorter.iterator()
+	if err != nil {
+		return nil, err
+	}
+	switch spillPlan := spillPlan.(type) {
+	case *planner.AggregatePlan:
+		if err := NewAggregateExecutor(executor.log, spillPlan, txn).aggregateRows(qr, next, true); err != nil {
+			return nil, err
+		}
+	case *planner.OrderByPlan:
+		if limitPlan, ok := spillStreamable(plan, spillPlan); ok && ctx.Stream != nil {
+			return spillPlan, streamSpilled(ctx, next, spillPlan, limitPlan)
+		}
+		size := 0
+		maxResult := txn.MaxResult()
+		for {
+			row, err := next()
+			if err != nil {
+				return nil, err
+			}
+			if row == nil {
+				break
+			}
+			qr.Rows = append(qr.Rows, row)
+			size += sqltypes.Values(row).Len()
+			if maxResult > 0 && size > maxResult {
+				return nil, fmt.Errorf("Query execution was interrupted, max memory usage[%d bytes] exceeded", maxResult)
+			}
+		}
+	}
+	qr.RowsAffected = uint64(len(qr.Rows))
+	return spillPlan, nil
+}
+
+// spillStreamable returns true if the merged rows of the orderby plan are the final rows once the limit
+// plan is applied, so they can be streamed to the client without holding them.
+func spillStreamable(plan *planner.SelectPlan, orderPlan *planner.OrderByPlan) (*planner.LimitPlan, bool) {
+	var limitPlan *planner.LimitPlan
+	for _, subPlan := range plan.Children().Plans() {
+		switch subPlan := subPlan.(type) {
+		case *planner.AggregatePlan:
+			if !subPlan.Empty() {
+				return nil, false
+			}
+		case *planner.OrderByPlan:
+			if subPlan != orderPlan {
+				return nil, false
+			}
+		case *planner.LimitPlan:
+			limitPlan = subPlan
+		}
+	}
+	return limitPlan, true
+}
+
+// streamSpilled sends the merged rows to the client in batches by the stream of the context,
+// the hidden columns are removed and the limit is applied while the rows are merged.
+// The result keeps the fields and the affected rows only, its state is RStateFinished.
+func streamSpilled(ctx *xcontext.ResultContext, next func() ([]sqltypes.Value, error), orderPlan *planner.OrderByPlan, limitPlan *planner.LimitPlan) error {
+	qr := ctx.Results
+	removeHiddenColumns(qr, orderPlan.Hidden)
+	if err := ctx.Stream(&sqltypes.Result{Fields: qr.Fields, State: sqltypes.RStateFields}); err != nil {
+		return err
+	}
+
+	offset, limit := 0, -1
+	if limitPlan != nil {
+		offset, limit = limitPlan.Offset, limitPlan.Limit
+	}
+	width := len(qr.Fields)
+	batch := &sqltypes.Result{Fields: qr.Fields, State: sqltypes.RStateRows}
+	for limit != 0 {
+		row, err := next()
+		if err != nil {
+			return err
+		}
+		if row == nil {
+			break
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		batch.Rows = append(batch.Rows, row[:width])
+		qr.RowsAffected++
+		if limit > 0 {
+			limit--
+		}
+		if len(batch.Rows) == spillBatchRows {
+			if err := ctx.Stream(batch); err != nil {
+				return err
+			}
+			batch = &sqltypes.Result{Fields: qr.Fields, State: sqltypes.RStateRows}
+		}
+	}
+	if len(batch.Rows) > 0 {
+		if err := ctx.Stream(batch); err != nil {
+			return err
+		}
+	}
+	qr.State = sqltypes.RStateFinished
+	return nil
+}
+
+// orderedMergePlans returns the orderby and limit plans if the query is a plain cross-shard
+// 'ORDER BY ... LIMIT', whose shard results can be merged by streaming. Otherwise returns nil.
+func orderedMergePlans(plan *planner.SelectPlan) (*planner.OrderByPlan, *planner.LimitPlan) {
+	var orderPlan *planner.OrderByPlan
+	var limitPlan *planner.LimitPlan
+
+	if plan.ReqMode != xcontext.ReqNormal || len(plan.Querys) < 2 || plan.Children() == nil {
+		return nil, nil
+	}
+	for _, subPlan := range plan.Children().Plans() {
+		switch subPlan := subPlan.(type) {
+		case *planner.AggregatePlan:
+			if !subPlan.Empty() {
+				return nil, nil
+			}
+		case *planner.OrderByPlan:
+			orderPlan = subPlan
+		case *planner.LimitPlan:
+			limitPlan = subPlan
+		}
+	}
+	if orderPlan == nil || len(orderPlan.OrderBys) == 0 || limitPlan == nil {
+		return nil, nil
+	}
+	return orderPlan, limitPlan
+}
+
+// orderByLess returns the merge less function by the orderby plan,
+// NULL is less than any other value same as MySQL.
+func orderByLess(plan *planner.OrderByPlan) backend.MergeLessFunc {
+	return func(fields []*querypb.Field) (func(a, b []sqltypes.Value) bool, error) {
+		idxs := make([]int, len(plan.OrderBys))
+		for i, orderby := range plan.OrderBys {
+			idxs[i] = -1
+			for k, field := range fields {
+				if field.Name == orderby.Field {
+					idxs[i] = k
+					break
+				}
+			}
+			if idxs[i] == -1 {
+				return nil, errors.Errorf("can.not.find.the.orderby.field[%s].direction.%s", orderby.Field, strings.ToLower(string(orderby.Direction)))
+			}
+		}
+		return func(a, b []sqltypes.Value) bool {
+			for i, orderby := range plan.OrderBys {
+				cmp := compareNullable(a[idxs[i]], b[idxs[i]])
+				if cmp == 0 {
+					continue
+				}
+				if orderby.Direction == planner.DESC {
+					return cmp > 0
+				}
+				return cmp < 0
+			}
+			return false
+		}, nil
+	}
+}
@@ -125,3 +125,85 @@ func TestSelectExecutor(t *testing.T) {
 		}
 	}
 }
+
+func TestSelectExecutorOrderedMerge(t *testing.T) {
+	fields := []*querypb.Field{
+		{Name: "id", Type: querypb.Type_INT32},
+		{Name: "name", Type: querypb.Type_VARCHAR},
+	}
+	mockResult := func(rows ...[]string) *sqltypes.Result {
+		qr := &sqltypes.Result{Fields: fields}
+		for _, row := range rows {
+			id := sqltypes.NULL
+			if row[0] != "" {
+				id = sqltypes.MakeTrusted(querypb.Type_INT32, []byte(row[0]))
+			}
+			qr.Rows = append(qr.Rows, []sqltypes.Value{id, sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(row[1]))})
+		}
+		return qr
+	}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableAConfig())
+	assert.Nil(t, err)
+
+	// Create scatter and query handler.
+	scatter, fakedbs, cleanup := backend.MockScatter(log, 10)
+	defer cleanup()
+	// desc, the NULLs are the last.
+	fakedbs.AddQuery("select id, name from sbtest.A0 as A order by id desc, name asc limit 5", mockResult([]string{"7", "a"}, []string{"3", "z"}, []string{"", "b"}))
+	fakedbs.AddQuery("select id, name from sbtest.A2 as A order by id desc, name asc limit 5", mockResult([]string{"9", "x"}, []string{"3", "b"}, []string{"2", "y"}))
+	fakedbs.AddQuery("select id, name from sbtest.A4 as A order by id desc, name asc limit 5", mockResult([]string{"7", "c"}))
+	fakedbs.AddQuery("select id, name from sbtest.A8 as A order by id desc, name asc limit 5", mockResult())
+	// asc, the NULLs are the first.
+	fakedbs.AddQuery("select id, name from sbtest.A0 as A order by id asc, name asc limit 3", mockResult([]string{"", "b"}, []string{"3", "z"}, []string{"7", "a"}))
+	fakedbs.AddQuery("select id, name from sbtest.A2 as A order by id asc, name asc limit 3", mockResult([]string{"2", "y"}, []string{"3", "b"}, []string{"9", "x"}))
+	fakedbs.AddQuery("select id, name from sbtest.A4 as A order by id asc, name asc limit 3", mockResult([]string{"7", "c"}))
+	fakedbs.AddQuery("select id, name from sbtest.A8 as A order by id asc, name asc limit 3", mockResult())
+	// hidden column.
+	hiddenResult := func(rows ...[]string) *sqltypes.Result {
+		qr := mockResult(rows...)
+		qr.Fields = []*querypb.Field{fields[1], fields[0]}
+		for _, row := range qr.Rows {
+			row[0], row[1] = row[1], row[0]
+		}
+		return qr
+	}
+	fakedbs.AddQuery("select name, id from sbtest.A0 as A order by id desc limit 2", hiddenResult([]string{"7", "a"}, []string{"3", "z"}))
+	fakedbs.AddQuery("select name, id from sbtest.A2 as A order by id desc limit 2", hiddenResult([]string{"9", "x"}, []string{"3", "b"}))
+	fakedbs.AddQuery("select name, id from sbtest.A4 as A order by id desc limit 2", hiddenResult([]string{"7", "c"}))
+	fakedbs.AddQuery("select name, id from sbtest.A8 as A order by id desc limit 2", hiddenResult())
+
+	querys := []string{
+		"select id, name from A order by id desc, name asc limit 1, 4",
+		"select id, name from A order by id asc, name asc limit 3",
+		"select name from A order by id desc limit 2",
+	}
+	results := []string{
+		"[[7 a] [7 c] [3 b] [3 z]]",
+		"[[ b] [2 y] [3 b]]",
+		"[[x] [a]]",
+	}
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+
+		plan := planner.NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+
+		txn, err := scatter.CreateTransaction()
+		assert.Nil(t, err)
+		defer txn.Finish()
+
+		ctx := xcontext.NewResultContext()
+		err = NewSelectExecutor(log, plan, txn).Execute(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, results[i], fmt.Sprintf("%v", ctx.Results.Rows))
+	}
+}
@@ -0,0 +1,321 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package executor
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"backend"
+	"config"
+	"xbase/sync2"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/xlog"
+
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+const (
+	// spillBatchRows is the rows of one batch read from the shards.
+	spillBatchRows = 256
+
+	// spillBufferSize is the buffer size of the spilled run file.
+	spillBufferSize = 64 * 1024
+)
+
+var (
+	// spillDiskUsage is the disk usage of all the spilled runs.
+	spillDiskUsage = sync2.NewAtomicInt64(0)
+)
+
+// SpillDiskUsage returns the disk usage(in bytes) of the spilled runs.
+func SpillDiskUsage() int64 {
+	return spillDiskUsage.Get()
+}
+
+// spillRun is the sorted rows spilled to a temp file.
+// Every value is encoded as uvarint(len+1) followed by the bytes, 0 is NULL.
+type spillRun struct {
+	file *os.File
+	size int64
+}
+
+// spillSorter sorts the rows by the less function.
+// The rows are held in memory until the memory budget is exceeded, then they're sorted and spilled
+// to a run file under the spill dir. The runs and the rows in memory are merged back when reading.
+type spillSorter struct {
+	log    *xlog.Log
+	conf   *config.SpillConfig
+	query  string
+	lessFn backend.MergeLessFunc
+	less   func(a, b []sqltypes.Value) bool
+	fields []*querypb.Field
+	rows   [][]sqltypes.Value
+	size   int
+	runs   []*spillRun
+	qd     *backend.QueryDetail
+}
+
+// newSpillSorter creates the new spillSorter, the less function is built once the fields are known.
+func newSpillSorter(log *xlog.Log, conf *config.SpillConfig, query string, lessFn backend.MergeLessFunc) *spillSorter {
+	return &spillSorter{
+		log:    log,
+		conf:   conf,
+		query:  query,
+		lessFn: lessFn,
+	}
+}
+
+// add adds the rows, the rows in memory are spilled once the memory budget is exceeded.
+func (s *spillSorter) add(fields []*querypb.Field, rows [][]sqltypes.Value) error {
+	if s.fields == nil {
+		less, err := s.lessFn(fields)
+		if err != nil {
+			return err
+		}
+		s.fields, s.less = fields, less
+	}
+	for _, row := range rows {
+		s.rows = append(s.rows, row)
+		s.size += sqltypes.Values(row).Len()
+		if s.size > s.conf.MemoryBudget {
+			if err := s.spill(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// spilled returns true if any run is spilled.
+func (s *spillSorter) spilled() bool {
+	return len(s.runs) > 0
+}
+
+// sort sorts the rows in memory, the rows keep their order if they're equal.
+func (s *spillSorter) sort() {
+	sort.SliceStable(s.rows, func(i, j int) bool {
+		return s.less(s.rows[i], s.rows[j])
+	})
+}
+
+// spill sorts the rows in memory and writes them to a new run file.
+func (s *spillSorter) spill() error {
+	log := s.log
+	dir := s.conf.Dir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	if err := os.MkdirAll(dir, 0744); err != nil {
+		return errors.WithStack(err)
+	}
+	file, err := ioutil.TempFile(dir, "spill-")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	// Add the run first, it's removed by the close even if the spill fails.
+	run := &spillRun{file: file}
+	s.runs = append(s.runs, run)
+
+	s.sort()
+	w := bufio.NewWriterSize(file, spillBufferSize)
+	buf := make([]byte, binary.MaxVarintLen64)
+	for _, row := range s.rows {
+		size := 0
+		for _, v := range row {
+			n := uint64(0)
+			if !v.IsNull() {
+				n = uint64(len(v.Raw())) + 1
+			}
+			k := binary.PutUvarint(buf, n)
+			if _, err := w.Write(buf[:k]); err != nil {
+				return errors.WithStack(err)
+			}
+			if _, err := w.Write(v.Raw()); err != nil {
+				return errors.WithStack(err)
+			}
+			size += k + len(v.Raw())
+		}
+		run.size += int64(size)
+		usage := spillDiskUsage.Add(int64(size))
+		if s.conf.MaxDiskSize > 0 && usage > int64(s.conf.MaxDiskSize) {
+			return fmt.Errorf("Query execution was interrupted, max spill disk usage[%d bytes] exceeded", s.conf.MaxDiskSize)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if s.qd == nil {
+		s.qd = backend.NewSpillQueryDetail(s.query)
+		backend.AddQueryDetail(s.qd)
+	}
+	s.qd.AddSpill(len(s.rows), int(run.size))
+	log.Warning("spill.sorter.spill.run[%s].rows[%d].bytes[%d].query[%s]", file.Name(), len(s.rows), run.size, s.query)
+
+	s.rows = nil
+	s.size = 0
+	return nil
+}
+
+// iterator returns the function to read the rows in order, it returns nil if all the rows are read.
+func (s *spillSorter) iterator() (func() ([]sqltypes.Value, error), error) {
+	if s.less == nil {
+		return func() ([]sqltypes.Value, error) { return nil, nil }, nil
+	}
+	s.sort()
+
+	// The spilled runs, they're added earlier than the rows in memory.
+	var sources []func() ([]sqltypes.Value, error)
+	for _, run := range s.runs {
+		if _, err := run.file.Seek(0, io.SeekStart); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		sources = append(sources, runReader(s.fields, bufio.NewReaderSize(run.file, spillBufferSize)))
+	}
+	// The rows in memory.
+	rows := s.rows
+	sources = append(sources, func() ([]sqltypes.Value, error) {
+		if len(rows) == 0 {
+			return nil, nil
+		}
+		row := rows[0]
+		rows = rows[1:]
+		return row, nil
+	})
+
+	h := &spillHeap{less: s.less}
+	for i, source := range sources {
+		row, err := source()
+		if err != nil {
+			return nil, err
+		}
+		if row != nil {
+			h.items = append(h.items, &spillItem{idx: i, row: row, next: source})
+		}
+	}
+	heap.Init(h)
+
+	return func() ([]sqltypes.Value, error) {
+		if h.Len() == 0 {
+			return nil, nil
+		}
+		item := h.items[0]
+		row := item.row
+		next, err := item.next()
+		if err != nil {
+			return nil, err
+		}
+		if next != nil {
+			item.row = next
+			heap.Fix(h, 0)
+		} else {
+			heap.Pop(h)
+		}
+		return row, nil
+	}, nil
+}
+
+// close removes the spilled runs.
+func (s *spillSorter) close() {
+	log := s.log
+	for _, run := range s.runs {
+		run.file.Close()
+		if err := os.Remove(run.file.Name()); err != nil {
+			log.Error("spill.sorter.remove.run[%s].error:%+v", run.file.Name(), err)
+		}
+		spillDiskUsage.Add(-run.size)
+	}
+	s.runs = nil
+	if s.qd != nil {
+		backend.RemoveQueryDetail(s.qd)
+	}
+}
+
+// runReader returns the function to read the rows of the run one by one.
+func runReader(fields []*querypb.Field, r *bufio.Reader) func() ([]sqltypes.Value, error) {
+	return func() ([]sqltypes.Value, error) {
+		row := make([]sqltypes.Value, len(fields))
+		for i := range fields {
+			n, err := binary.ReadUvarint(r)
+			if err != nil {
+				if err == io.EOF && i == 0 {
+					return nil, nil
+				}
+				return nil, errors.WithStack(err)
+			}
+			if n == 0 {
+				row[i] = sqltypes.NULL
+				continue
+			}
+			buf := make([]byte, n-1)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return nil, errors.WithStack(err)
+			}
+			row[i] = sqltypes.MakeTrusted(fields[i].Type, buf)
+		}
+		return row, nil
+	}
+}
+
+// spillItem is the current row of one sorted source.
+type spillItem struct {
+	idx  int
+	row  []sqltypes.Value
+	next func() ([]sqltypes.Value, error)
+}
+
+// spillHeap is a min-heap of the sorted sources, the equal rows are ordered by the source index.
+type spillHeap struct {
+	items []*spillItem
+	less  func(a, b []sqltypes.Value) bool
+}
+
+// Len is part of heap.Interface.
+func (h *spillHeap) Len() int {
+	return len(h.items)
+}
+
+// Less is part of heap.Interface.
+func (h *spillHeap) Less(i, j int) bool {
+	a, b := h.items[i], h.items[j]
+	if h.less(a.row, b.row) {
+		return true
+	}
+	if h.less(b.row, a.row) {
+		return false
+	}
+	return a.idx < b.idx
+}
+
+// Swap is part of heap.Interface.
+func (h *spillHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+}
+
+// Push is part of heap.Interface.
+func (h *spillHeap) Push(x interface{}) {
+	h.items = append(h.items, x.(*spillItem))
+}
+
+// Pop is part of heap.Interface.
+func (h *spillHeap) Pop() interface{} {
+	n := len(h.items)
+	item := h.items[n-1]
+	h.items = h.items[:n-1]
+	return item
+}
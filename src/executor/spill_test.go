@@ -0,0 +1,284 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package executor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"backend"
+	"config"
+	"planner"
+	"router"
+	"xcontext"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestSpillSorter(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	dir, err := ioutil.TempDir("", "spill")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	fields := []*querypb.Field{
+		{Name: "id", Type: querypb.Type_INT32},
+		{Name: "name", Type: querypb.Type_VARCHAR},
+	}
+	makeRow := func(id string, name string) []sqltypes.Value {
+		row := []sqltypes.Value{sqltypes.NULL, sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(name))}
+		if id != "" {
+			row[0] = sqltypes.MakeTrusted(querypb.Type_INT32, []byte(id))
+		}
+		return row
+	}
+	lessFn := func(fields []*querypb.Field) (func(a, b []sqltypes.Value) bool, error) {
+		return func(a, b []sqltypes.Value) bool {
+			return compareNullable(a[0], b[0]) < 0
+		}, nil
+	}
+
+	scatter, _, cleanup := backend.MockScatter(log, 1)
+	defer cleanup()
+
+	conf := &config.SpillConfig{Enable: true, MemoryBudget: 8, Dir: dir}
+	sorter := newSpillSorter(log, conf, "select id, name from A order by id", lessFn)
+	err = sorter.add(fields, [][]sqltypes.Value{makeRow("3", "c"), makeRow("1", "a")})
+	assert.Nil(t, err)
+	err = sorter.add(fields, [][]sqltypes.Value{makeRow("", "n"), makeRow("2", ""), makeRow("1", "b"), makeRow("5", "e")})
+	assert.Nil(t, err)
+	err = sorter.add(fields, [][]sqltypes.Value{makeRow("4", "d")})
+	assert.Nil(t, err)
+	assert.True(t, sorter.spilled())
+	assert.True(t, SpillDiskUsage() > 0)
+
+	// The spill usage is shown in the queryz.
+	var found bool
+	for _, row := range scatter.Queryz().GetQueryzRows() {
+		if row.Query == "select id, name from A order by id" {
+			found = true
+			assert.Equal(t, "proxy", row.Address)
+			assert.Equal(t, int64(len(sorter.runs)), row.SpillRuns)
+			assert.True(t, row.SpillBytes > 0)
+		}
+	}
+	assert.True(t, found)
+
+	next, err := sorter.iterator()
+	assert.Nil(t, err)
+	var got [][]sqltypes.Value
+	for {
+		row, err := next()
+		assert.Nil(t, err)
+		if row == nil {
+			break
+		}
+		got = append(got, row)
+	}
+	assert.Equal(t, "[[ n] [1 a] [1 b] [2 ] [3 c] [4 d] [5 e]]", fmt.Sprintf("%v", got))
+	assert.True(t, got[0][0].IsNull())
+	assert.False(t, got[3][1].IsNull())
+
+	sorter.close()
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(files))
+	assert.Equal(t, int64(0), SpillDiskUsage())
+	assert.Equal(t, 0, len(scatter.Queryz().GetQueryzRows()))
+
+	// Max disk size exceeded.
+	{
+		conf := &config.SpillConfig{Enable: true, MemoryBudget: 1, MaxDiskSize: 4, Dir: dir}
+		sorter := newSpillSorter(log, conf, "select id, name from A order by id", lessFn)
+		err = sorter.add(fields, [][]sqltypes.Value{makeRow("3", "c"), makeRow("1", "a"), makeRow("2", "b")})
+		assert.Equal(t, "Query execution was interrupted, max spill disk usage[4 bytes] exceeded", err.Error())
+		sorter.close()
+		assert.Equal(t, int64(0), SpillDiskUsage())
+	}
+}
+
+func TestSelectExecutorSpill(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+	dir, err := ioutil.TempDir("", "spill")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err = route.AddForTest(database, router.MockTableAConfig())
+	assert.Nil(t, err)
+
+	// Create scatter and query handler.
+	scatter, fakedbs, cleanup := backend.MockScatter(log, 10)
+	defer cleanup()
+
+	names := []string{"a", "b", "c", "d"}
+	for s, table := range []string{"A0", "A2", "A4", "A8"} {
+		group := &sqltypes.Result{
+			Fields: []*querypb.Field{
+				{Name: "name", Type: querypb.Type_VARCHAR},
+				{Name: "count(*)", Type: querypb.Type_INT64},
+				{Name: "sum(id)", Type: querypb.Type_DECIMAL},
+			},
+		}
+		distinct := &sqltypes.Result{
+			Fields: []*querypb.Field{
+				{Name: "count(distinct id)", Type: querypb.Type_INT32},
+				{Name: "sum(distinct id)", Type: querypb.Type_INT32},
+			},
+		}
+		order := &sqltypes.Result{
+			Fields: []*querypb.Field{
+				{Name: "id", Type: querypb.Type_INT32},
+				{Name: "name", Type: querypb.Type_VARCHAR},
+			},
+		}
+		for i := 0; i < 10; i++ {
+			id := sqltypes.MakeTrusted(querypb.Type_INT32, []byte(fmt.Sprintf("%d", i+s)))
+			name := sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(names[(i+s)%len(names)]))
+			if i < len(names) {
+				group.Rows = append(group.Rows, []sqltypes.Value{
+					name,
+					sqltypes.MakeTrusted(querypb.Type_INT64, []byte(fmt.Sprintf("%d", i+1))),
+					sqltypes.MakeTrusted(querypb.Type_DECIMAL, []byte(fmt.Sprintf("%d", i*s))),
+				})
+			}
+			distinct.Rows = append(distinct.Rows, []sqltypes.Value{id, id})
+			order.Rows = append(order.Rows, []sqltypes.Value{id, name})
+		}
+		fakedbs.AddQuery(fmt.Sprintf("select name, count(*), sum(id) from sbtest.%s as A group by name", table), group)
+		fakedbs.AddQuery(fmt.Sprintf("select id as `count(distinct id)`, id as `sum(distinct id)` from sbtest.%s as A group by id", table), distinct)
+		fakedbs.AddQuery(fmt.Sprintf("select id, name from sbtest.%s as A order by name desc, id asc", table), order)
+	}
+
+	querys := []string{
+		"select name, count(*), sum(id) from A group by name",
+		"select count(distinct id), sum(distinct id) from A",
+		"select id, name from A order by name desc, id",
+	}
+	for _, query := range querys {
+		var results []string
+		for _, spill := range []*config.SpillConfig{nil, {Enable: true, MemoryBudget: 16, Dir: dir}} {
+			node, err := sqlparser.Parse(query)
+			assert.Nil(t, err)
+
+			plan := planner.NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+			err = plan.Build()
+			assert.Nil(t, err)
+
+			txn, err := scatter.CreateTransaction()
+			assert.Nil(t, err)
+			defer txn.Finish()
+			txn.SetSpillConfig(spill)
+
+			ctx := xcontext.NewResultContext()
+			err = NewSelectExecutor(log, plan, txn).Execute(ctx)
+			assert.Nil(t, err)
+			results = append(results, fmt.Sprintf("%v", ctx.Results.Rows))
+		}
+		assert.Equal(t, results[0], results[1], query)
+	}
+
+	// The spilled runs are removed.
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(files))
+	assert.Equal(t, int64(0), SpillDiskUsage())
+}
+
+func TestSelectExecutorSpillStream(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+	dir, err := ioutil.TempDir("", "spill")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err = route.AddForTest(database, router.MockTableAConfig())
+	assert.Nil(t, err)
+
+	// Create scatter and query handler.
+	scatter, fakedbs, cleanup := backend.MockScatter(log, 10)
+	defer cleanup()
+
+	var want [][]sqltypes.Value
+	for s, table := range []string{"A0", "A2", "A4", "A8"} {
+		rs := &sqltypes.Result{
+			Fields: []*querypb.Field{
+				{Name: "name", Type: querypb.Type_VARCHAR},
+				{Name: "id", Type: querypb.Type_INT32},
+			},
+		}
+		for i := 600 - s; i > 0; i -= 4 {
+			name := sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(fmt.Sprintf("n%d", i)))
+			rs.Rows = append(rs.Rows, []sqltypes.Value{name, sqltypes.MakeTrusted(querypb.Type_INT32, []byte(fmt.Sprintf("%d", i)))})
+		}
+		fakedbs.AddQuery(fmt.Sprintf("select name, id from sbtest.%s as A order by id desc", table), rs)
+	}
+	for i := 600; i > 580; i-- {
+		want = append(want, []sqltypes.Value{sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(fmt.Sprintf("n%d", i)))})
+	}
+
+	query := "select name from A order by id desc"
+	node, err := sqlparser.Parse(query)
+	assert.Nil(t, err)
+	plan := planner.NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+	err = plan.Build()
+	assert.Nil(t, err)
+
+	txn, err := scatter.CreateTransaction()
+	assert.Nil(t, err)
+	defer txn.Finish()
+	txn.SetMaxResult(1024)
+	txn.SetSpillConfig(&config.SpillConfig{Enable: true, MemoryBudget: 1024, Dir: dir})
+
+	// The merged rows are held in the results within the MaxResult.
+	{
+		ctx := xcontext.NewResultContext()
+		err = NewSelectExecutor(log, plan, txn).Execute(ctx)
+		assert.NotNil(t, err)
+	}
+
+	// The merged rows are streamed without the MaxResult.
+	{
+		var states []sqltypes.ResultState
+		var rows [][]sqltypes.Value
+		ctx := xcontext.NewResultContext()
+		ctx.Stream = func(qr *sqltypes.Result) error {
+			states = append(states, qr.State)
+			assert.Equal(t, 1, len(qr.Fields))
+			rows = append(rows, qr.Rows...)
+			return nil
+		}
+		err = NewSelectExecutor(log, plan, txn).Execute(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, sqltypes.RStateFinished, ctx.Results.State)
+		assert.Equal(t, 1, len(ctx.Results.Fields))
+		assert.Equal(t, 0, len(ctx.Results.Rows))
+		assert.Equal(t, uint64(600), ctx.Results.RowsAffected)
+		assert.Equal(t, 600, len(rows))
+		assert.Equal(t, fmt.Sprintf("%v", want), fmt.Sprintf("%v", rows[:len(want)]))
+		assert.Equal(t, []sqltypes.ResultState{sqltypes.RStateFields, sqltypes.RStateRows, sqltypes.RStateRows, sqltypes.RStateRows}, states)
+	}
+
+	// The spilled runs are removed.
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(files))
+}
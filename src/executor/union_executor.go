@@ -0,0 +1,162 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package executor
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"backend"
+	"planner"
+	"xcontext"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/hack"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+var (
+	_ Executor = &UnionExecutor{}
+)
+
+// UnionExecutor represents the union executor.
+type UnionExecutor struct {
+	log  *xlog.Log
+	plan planner.Plan
+	txn  backend.Transaction
+}
+
+// NewUnionExecutor creates new union executor.
+func NewUnionExecutor(log *xlog.Log, plan planner.Plan, txn backend.Transaction) *UnionExecutor {
+	return &UnionExecutor{
+		log:  log,
+		plan: plan,
+		txn:  txn,
+	}
+}
+
+// Execute used to execute the executor.
+// The arms are executed one by one, the rows are concatenated and deduplicated if it's DISTINCT,
+// the fields are the fields of the first arm. At last the rows are sorted and limited.
+func (executor *UnionExecutor) Execute(ctx *xcontext.ResultContext) error {
+	plan := executor.plan.(*planner.UnionPlan)
+
+	left, err := executeSelectPlan(executor.log, plan.Left, executor.txn)
+	if err != nil {
+		return err
+	}
+	right, err := executeSelectPlan(executor.log, plan.Right, executor.txn)
+	if err != nil {
+		return err
+	}
+	if len(left.Fields) != len(right.Fields) {
+		return errors.New("The used SELECT statements have a different number of columns")
+	}
+
+	qr := &sqltypes.Result{Fields: left.Fields}
+	size := 0
+	maxResult := executor.txn.MaxResult()
+	var seen map[string]struct{}
+	var colls []collation
+	if plan.Distinct {
+		seen = make(map[string]struct{})
+		colls = make([]collation, len(left.Fields))
+		for i := range colls {
+			colls[i] = mergeCollation(fieldCollation(left.Fields[i]), fieldCollation(right.Fields[i]))
+		}
+	}
+	for _, rows := range [][][]sqltypes.Value{left.Rows, right.Rows} {
+		for _, row := range rows {
+			if seen != nil {
+				key := rowKey(row, colls)
+				if _, ok := seen[key]; ok {
+					continue
+				}
+				seen[key] = struct{}{}
+				size += len(key)
+			}
+			qr.Rows = append(qr.Rows, row)
+			size += sqltypes.Values(row).Len()
+			if maxResult > 0 && size > maxResult {
+				return fmt.Errorf("Query execution was interrupted, max memory usage[%d bytes] exceeded", maxResult)
+			}
+		}
+	}
+
+	if err := unionOrderBy(qr, plan.OrderBy); err != nil {
+		return err
+	}
+	if plan.Limit != nil {
+		qr.Limit(plan.Limit.Offset, plan.Limit.Limit)
+	}
+	qr.RowsAffected = uint64(len(qr.Rows))
+	ctx.Results = qr
+	return nil
+}
+
+// rowKey returns the hash key of the row, the equal values of the different numeric types have the same key,
+// so do the strings equal by the collations of the columns.
+func rowKey(row []sqltypes.Value, colls []collation) string {
+	var key []byte
+	for i, v := range row {
+		if v.IsNull() {
+			key = append(key, 'N')
+			continue
+		}
+		k := hashKey(v, colls[i])
+		key = append(key, fmt.Sprintf("%d:%s", len(k), k)...)
+	}
+	return hack.String(key)
+}
+
+// unionOrderBy sorts the rows by the column names or the positions, NULLs are the smallest.
+func unionOrderBy(qr *sqltypes.Result, orderBy sqlparser.OrderBy) error {
+	if len(orderBy) == 0 {
+		return nil
+	}
+	idxs := make([]int, len(orderBy))
+	for i, order := range orderBy {
+		idx := -1
+		switch expr := order.Expr.(type) {
+		case *sqlparser.ColName:
+			for j, field := range qr.Fields {
+				if strings.EqualFold(field.Name, expr.Name.String()) {
+					idx = j
+					break
+				}
+			}
+		case *sqlparser.SQLVal:
+			if pos, err := strconv.Atoi(hack.String(expr.Val)); err == nil && pos > 0 && pos <= len(qr.Fields) {
+				idx = pos - 1
+			}
+		}
+		if idx == -1 {
+			return errors.Errorf("Unknown column '%s' in 'order clause'", sqlparser.String(order.Expr))
+		}
+		idxs[i] = idx
+	}
+	sort.SliceStable(qr.Rows, func(i, j int) bool {
+		for k, order := range orderBy {
+			cmp := compareNullable(qr.Rows[i][idxs[k]], qr.Rows[j][idxs[k]])
+			if cmp == 0 {
+				continue
+			}
+			if order.Direction == sqlparser.DescScr {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return false
+	})
+	return nil
+}
@@ -0,0 +1,181 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package executor
+
+import (
+	"fmt"
+	"testing"
+
+	"backend"
+	"planner"
+	"router"
+	"xcontext"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/xlog"
+
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+func TestUnionExecutor(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableAConfig(), router.MockTableSConfig())
+	assert.Nil(t, err)
+
+	// Create scatter and query handler.
+	scatter, fakedbs, cleanup := backend.MockScatter(log, 10)
+	defer cleanup()
+	fakedbs.AddQuery("select id, name from sbtest.A0 as A", mockJoinResult([]string{"id", "name"}, []string{"1", "x"}, []string{"2", "y"}))
+	fakedbs.AddQuery("select id, name from sbtest.A2 as A", mockJoinResult([]string{"id", "name"}, []string{"3", "z"}))
+	fakedbs.AddQuery("select id, name from sbtest.A4 as A", mockJoinResult([]string{"id", "name"}))
+	fakedbs.AddQuery("select id, name from sbtest.A8 as A", mockJoinResult([]string{"id", "name"}, []string{"1", "x"}))
+	sResult := mockJoinResult([]string{"id", "name"}, []string{"3", "z"}, []string{"5", "w"})
+	sResult.Fields[1].Name = "sname"
+	fakedbs.AddQuery("select id, name as sname from sbtest.S as S", sResult)
+	fakedbs.AddQuery("select id from sbtest.S as S", mockJoinResult([]string{"id"}, []string{"3"}, []string{"5"}))
+
+	querys := []string{
+		"select id, name from A union all select id, name as sname from S order by id, name",
+		"select id, name from A union select id, name as sname from S order by 1 desc",
+		"select id, name from A union distinct select id, name as sname from S union all select id, name as sname from S order by name limit 1, 3",
+		"select id, name from A union all (select id, name as sname from S union select id, name as sname from S) order by id desc limit 2",
+	}
+	results := []string{
+		"[[1 x] [1 x] [2 y] [3 z] [3 z] [5 w]]",
+		"[[5 w] [3 z] [2 y] [1 x]]",
+		"[[5 w] [1 x] [2 y]]",
+		"[[5 w] [3 z]]",
+	}
+
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+
+		plan := planner.NewUnionPlan(log, database, query, node.(*sqlparser.Union), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+
+		txn, err := scatter.CreateTransaction()
+		assert.Nil(t, err)
+		defer txn.Finish()
+		executor := NewUnionExecutor(log, plan, txn)
+		{
+			ctx := xcontext.NewResultContext()
+			err := executor.Execute(ctx)
+			assert.Nil(t, err)
+			assert.Equal(t, results[i], fmt.Sprintf("%v", ctx.Results.Rows))
+			assert.Equal(t, "name", ctx.Results.Fields[1].Name)
+		}
+	}
+
+	// The different number of columns.
+	{
+		query := "select id, name from A union select id from S"
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+
+		plan := planner.NewUnionPlan(log, database, query, node.(*sqlparser.Union), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+
+		txn, err := scatter.CreateTransaction()
+		assert.Nil(t, err)
+		defer txn.Finish()
+		err = NewUnionExecutor(log, plan, txn).Execute(xcontext.NewResultContext())
+		assert.Equal(t, "The used SELECT statements have a different number of columns", err.Error())
+	}
+
+	// The unknown order by column.
+	{
+		query := "select id, name from A union select id, name as sname from S order by sname"
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+
+		plan := planner.NewUnionPlan(log, database, query, node.(*sqlparser.Union), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+
+		txn, err := scatter.CreateTransaction()
+		assert.Nil(t, err)
+		defer txn.Finish()
+		err = NewUnionExecutor(log, plan, txn).Execute(xcontext.NewResultContext())
+		assert.Equal(t, "Unknown column 'sname' in 'order clause'", err.Error())
+	}
+
+	// Max result size exceeded.
+	{
+		query := "select id, name from A union all select id, name as sname from S"
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+
+		plan := planner.NewUnionPlan(log, database, query, node.(*sqlparser.Union), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+
+		txn, err := scatter.CreateTransaction()
+		assert.Nil(t, err)
+		defer txn.Finish()
+		txn.SetMaxResult(8)
+		err = NewUnionExecutor(log, plan, txn).Execute(xcontext.NewResultContext())
+		assert.Equal(t, "Query execution was interrupted, max memory usage[8 bytes] exceeded", err.Error())
+	}
+}
+
+func TestUnionExecutorCollation(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableSConfig())
+	assert.Nil(t, err)
+
+	scatter, fakedbs, cleanup := backend.MockScatter(log, 10)
+	defer cleanup()
+	decimal := &sqltypes.Result{
+		Fields: []*querypb.Field{{Name: "name", Type: querypb.Type_VARCHAR}, {Name: "id", Type: querypb.Type_DECIMAL}},
+		Rows: [][]sqltypes.Value{
+			{sqltypes.NewVarChar("X "), sqltypes.MakeTrusted(querypb.Type_DECIMAL, []byte("1.00"))},
+			{sqltypes.NewVarChar("y"), sqltypes.MakeTrusted(querypb.Type_DECIMAL, []byte("12345678901234567890.1"))},
+		},
+	}
+	fakedbs.AddQuery("select name, id from sbtest.S as S", decimal)
+	integer := mockJoinResult([]string{"name", "id"}, []string{"x", "1"})
+	integer.Fields[1].Type = querypb.Type_INT64
+	integer.Rows[0][1] = sqltypes.NewInt64(1)
+	fakedbs.AddQuery("select name, id from sbtest.S as S where id = 1", integer)
+	fakedbs.AddQuery("select name, id from sbtest.S as S where id > 1", &sqltypes.Result{
+		Fields: decimal.Fields,
+		Rows:   [][]sqltypes.Value{{sqltypes.NewVarChar("y"), sqltypes.MakeTrusted(querypb.Type_DECIMAL, []byte("12345678901234567890.2"))}},
+	})
+
+	query := "select name, id from S union select name, id from S where id = 1 union select name, id from S where id > 1"
+	node, err := sqlparser.Parse(query)
+	assert.Nil(t, err)
+	plan := planner.NewUnionPlan(log, database, query, node.(*sqlparser.Union), route)
+	err = plan.Build()
+	assert.Nil(t, err)
+
+	txn, err := scatter.CreateTransaction()
+	assert.Nil(t, err)
+	defer txn.Finish()
+	ctx := xcontext.NewResultContext()
+	err = NewUnionExecutor(log, plan, txn).Execute(ctx)
+	assert.Nil(t, err)
+	// 'X ' equals 'x', the decimals differ beyond the float precision.
+	assert.Equal(t, "[[X  1.00] [y 12345678901234567890.1] [y 12345678901234567890.2]]", fmt.Sprintf("%v", ctx.Results.Rows))
+}
@@ -19,6 +19,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
 
@@ -64,3 +65,121 @@ func TestUpdateExecutor(t *testing.T) {
 		}
 	}
 }
+
+func TestUpdateExecutorMultiTable(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	// Create scatter and query handler.
+	scatter, fakedbs, cleanup := backend.MockScatter(log, 10)
+	defer cleanup()
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	// The rows of A are identified by the unique key uid.
+	A := router.MockTableAConfig()
+	A.UniqueKey = "uid"
+	err := route.AddForTest(database, A, router.MockTableSConfig())
+	assert.Nil(t, err)
+
+	// A isn't co-located with S, the keys of A are looked up.
+	fakedbs.AddQuery("select A.id, A.uid from sbtest.A0 as A", mockJoinResult([]string{"id", "uid"}, []string{"1", "11"}, []string{"2", "12"}))
+	fakedbs.AddQuery("select A.id, A.uid from sbtest.A2 as A", mockJoinResult([]string{"id", "uid"}, []string{"3", "13"}, []string{"3", "23"}))
+	fakedbs.AddQuery("select A.id, A.uid from sbtest.A4 as A", mockJoinResult([]string{"id", "uid"}))
+	fakedbs.AddQuery("select A.id, A.uid from sbtest.A8 as A", mockJoinResult([]string{"id", "uid"}, []string{"4", "14"}))
+	fakedbs.AddQuery("select S.id from sbtest.S as S", mockJoinResult([]string{"id"}, []string{"1"}, []string{"3"}, []string{"5"}))
+	// Only the joined rows are changed by the unique key, not all the rows sharing the sharding key.
+	// The keys are in the order the shards return the rows.
+	fakedbs.AddQueryPattern(`update sbtest.A8 set b = 1 where uid in \((11|13|23), (11|13|23), (11|13|23)\)`, &sqltypes.Result{RowsAffected: 3})
+
+	query := "update A join S on A.id = S.id set A.b = 1"
+	node, err := sqlparser.Parse(query)
+	assert.Nil(t, err)
+	plan := planner.NewUpdatePlan(log, database, query, node.(*sqlparser.Update), route)
+	err = plan.Build()
+	assert.Nil(t, err)
+
+	txn, err := scatter.CreateTransaction()
+	assert.Nil(t, err)
+	defer txn.Finish()
+	executor := NewUpdateExecutor(log, plan, txn)
+	{
+		ctx := xcontext.NewResultContext()
+		err := executor.Execute(ctx)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(3), ctx.Results.RowsAffected)
+	}
+}
+
+func TestUpdateExecutorShardKey(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	// Create scatter and query handler.
+	scatter, fakedbs, cleanup := backend.MockScatter(log, 10)
+	defer cleanup()
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableAConfig())
+	assert.Nil(t, err)
+
+	fakedbs.AddQueryPattern("XA .*", &sqltypes.Result{})
+	fakedbs.AddQuery("select *, 770 from sbtest.A8 where id = 1 for update", mockJoinResult([]string{"id", "b", "770"}, []string{"1", "2", "770"}))
+	fakedbs.AddQuery("select *, 1 from sbtest.A8 where id = 1 for update", mockJoinResult([]string{"id", "b", "1"}, []string{"1", "2", "1"}))
+	fakedbs.AddQuery("select *, 770 from sbtest.A8 where id = 2 for update", mockJoinResult([]string{"id", "b", "770"}, []string{"2", "2", "770"}))
+	fakedbs.AddQuery("delete from sbtest.A8 where id = 1", &sqltypes.Result{RowsAffected: 1})
+	fakedbs.AddQuery("delete from sbtest.A8 where id = 2", &sqltypes.Result{})
+	fakedbs.AddQuery("insert into sbtest.A4(id, b) values (770, 2)", &sqltypes.Result{RowsAffected: 1})
+
+	execute := func(query string, twopc bool) (*xcontext.ResultContext, error) {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := planner.NewUpdatePlan(log, database, query, node.(*sqlparser.Update), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+
+		txn, err := scatter.CreateTransaction()
+		assert.Nil(t, err)
+		defer txn.Finish()
+		if twopc {
+			err = txn.Begin()
+			assert.Nil(t, err)
+		}
+		ctx := xcontext.NewResultContext()
+		err = NewUpdateExecutor(log, plan, txn).Execute(ctx)
+		return ctx, err
+	}
+
+	// The row is moved from A8 to A4.
+	{
+		ctx, err := execute("update sbtest.A set id = 770 where id = 1", true)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(1), ctx.Results.RowsAffected)
+		want := []xcontext.BinlogEvent{
+			{Typ: "DELETE", Query: "delete from sbtest.A where id = 1"},
+			{Typ: "INSERT", Query: "insert into sbtest.A(id, b) values (770, 2)"},
+		}
+		assert.Equal(t, want, ctx.Events)
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum("insert into sbtest.A4(id, b) values (770, 2)"))
+	}
+
+	// Nothing changed.
+	{
+		ctx, err := execute("update sbtest.A set id = 1 where id = 1", true)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(0), ctx.Results.RowsAffected)
+		assert.Nil(t, ctx.Events)
+	}
+
+	// Errors.
+	{
+		_, err := execute("update sbtest.A set id = 770 where id = 1", false)
+		assert.Equal(t, "unsupported: shard.key.update.requires.twopc", err.Error())
+
+		_, err = execute("update sbtest.A set id = 770 where id = 2", true)
+		assert.Equal(t, "shard.key.move.deleted.rows[0].mismatch.the.selected[1]", err.Error())
+	}
+}
@@ -66,7 +66,15 @@ func (so *SimpleOptimizer) BuildPlanTree() (*planner.PlanTree, error) {
 	case *sqlparser.Select:
 		nod := node.(*sqlparser.Select)
 		selectNode := planner.NewSelectPlan(log, database, query, nod, router)
-		plans.Add(selectNode)
+		if selectNode.CrossShardJoin() {
+			joinNode := planner.NewJoinPlan(log, database, query, nod, router)
+			plans.Add(joinNode)
+		} else {
+			plans.Add(selectNode)
+		}
+	case *sqlparser.Union:
+		node := planner.NewUnionPlan(log, database, query, node.(*sqlparser.Union), router)
+		plans.Add(node)
 	default:
 		return nil, errors.Errorf("optimizer.unsupported.query.type[%+v]", node)
 	}
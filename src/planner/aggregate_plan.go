@@ -44,15 +44,73 @@ const (
 	// AggrTypeAvg enum.
 	AggrTypeAvg AggrType = "AVG"
 
+	// AggrTypeCountDistinct enum.
+	AggrTypeCountDistinct AggrType = "COUNT DISTINCT"
+
+	// AggrTypeSumDistinct enum.
+	AggrTypeSumDistinct AggrType = "SUM DISTINCT"
+
+	// AggrTypeGroupConcat enum.
+	AggrTypeGroupConcat AggrType = "GROUP_CONCAT"
+
+	// AggrTypeStddevPop enum.
+	AggrTypeStddevPop AggrType = "STDDEV_POP"
+
+	// AggrTypeStddevSamp enum.
+	AggrTypeStddevSamp AggrType = "STDDEV_SAMP"
+
+	// AggrTypeVarPop enum.
+	AggrTypeVarPop AggrType = "VAR_POP"
+
+	// AggrTypeVarSamp enum.
+	AggrTypeVarSamp AggrType = "VAR_SAMP"
+
+	// AggrTypeBitAnd enum.
+	AggrTypeBitAnd AggrType = "BIT_AND"
+
+	// AggrTypeBitOr enum.
+	AggrTypeBitOr AggrType = "BIT_OR"
+
+	// AggrTypeBitXor enum.
+	AggrTypeBitXor AggrType = "BIT_XOR"
+
+	// AggrTypeAnyValue enum.
+	AggrTypeAnyValue AggrType = "ANY_VALUE"
+
 	// AggrTypeGroupBy enum.
 	AggrTypeGroupBy AggrType = "GROUP BY"
 )
 
+const (
+	// approxCountDistinctHint is the comment hint to evaluate the COUNT(DISTINCT) approximately by the HyperLogLog,
+	// such as: select /*+ approx_count_distinct */ count(distinct a) from t.
+	approxCountDistinctHint = "approx_count_distinct"
+)
+
 // Aggregator tuple.
 type Aggregator struct {
 	Field string
 	Index int
 	Type  AggrType
+	// Approximate is true if the COUNT(DISTINCT) is estimated by the HyperLogLog.
+	Approximate bool `json:",omitempty"`
+	// GroupConcat is the options of the GROUP_CONCAT.
+	GroupConcat *GroupConcat `json:",omitempty"`
+}
+
+// GroupConcat tuple.
+type GroupConcat struct {
+	Separator string
+	Distinct  bool `json:",omitempty"`
+	// Directions are the directions of the order by keys.
+	Directions []Direction `json:",omitempty"`
+}
+
+// Evaluation tuple, the expression over the aggregators which is evaluated after the merge.
+type Evaluation struct {
+	Field string
+	Index int
+	Expr  sqlparser.Expr `json:"-"`
 }
 
 // AggregatePlan represents order-by plan.
@@ -61,10 +119,25 @@ type AggregatePlan struct {
 	node      *sqlparser.Select
 	tuples    []selectTuple
 	rewritten sqlparser.SelectExprs
+	// rewrittenGroupBy is the group by clause of the shard querys, the arguments of the distinct aggregators are appended.
+	rewrittenGroupBy sqlparser.GroupBy
 
 	normalAggrs []Aggregator
 	groupAggrs  []Aggregator
 
+	// evaluations are the select expressions over the aggregators, such as 'sum(a)/count(b)'.
+	evaluations []Evaluation
+	// having is the having clause evaluated after the merge.
+	having sqlparser.Expr
+	// columns maps the aggregators, columns and aliases referenced by the evaluations and having to the indexes.
+	columns map[string]int
+	// hidden are the indexes of the hidden columns, they are removed after the evaluation.
+	hidden []int
+	// hiddenTuples are the hidden group by fields, they are removed after the order by.
+	hiddenTuples []selectTuple
+	// indexes are the indexes of the select tuples in the rewritten select list.
+	indexes []int
+
 	// type
 	typ PlanType
 }
@@ -72,109 +145,482 @@ type AggregatePlan struct {
 // NewAggregatePlan used to create AggregatePlan.
 func NewAggregatePlan(log *xlog.Log, node *sqlparser.Select, tuples []selectTuple) *AggregatePlan {
 	return &AggregatePlan{
-		log:       log,
-		node:      node,
-		tuples:    tuples,
-		rewritten: node.SelectExprs,
-		typ:       PlanTypeAggregate,
+		log:              log,
+		node:             node,
+		tuples:           tuples,
+		rewritten:        node.SelectExprs,
+		rewrittenGroupBy: node.GroupBy,
+		columns:          make(map[string]int),
+		typ:              PlanTypeAggregate,
 	}
 }
 
 // analyze used to check the aggregator is at the support level.
 // Supports:
 // SUM/COUNT/MIN/MAX/AVG/GROUPBY
-// Notes:
-// group by fields must be in the select list, for example:
-// select count(a), a from t group by a --[OK]
-// select count(a) from t group by a    --[ER]
+// STD/STDDEV/STDDEV_POP/STDDEV_SAMP/VARIANCE/VAR_POP/VAR_SAMP: decomposed to sum(x), sum(x*x) and count(x)
+// BIT_AND/BIT_OR/BIT_XOR/ANY_VALUE/GROUP_CONCAT
+// COUNT(DISTINCT)/SUM(DISTINCT): the shards return the distinct values per group, which are
+// deduplicated across the shards before aggregating, for example:
+// select a, count(distinct b) from t group by a
+// the shard query is rewritten to:
+// select a, b as `count(distinct b)` from t group by a, b
+// The group by fields not in the select list are appended as the hidden columns, for example:
+// select count(a) from t group by t.b
+// the shard query is rewritten to:
+// select count(a), t.b from t group by t.b
+// The expressions over the aggregators and the having clause are evaluated after the merge,
+// the aggregators and the columns they reference are appended to the select list as the hidden columns:
+// select a, sum(b)/count(c) from t group by a having max(d) > 1
+// the shard query is rewritten to:
+// select a, sum(b)/count(c), sum(b), count(c), max(d) from t group by a
 func (p *AggregatePlan) analyze() error {
 	var nullAggrs []Aggregator
+	var nullTuples []selectTuple
 	node := p.node
 	tuples := p.tuples
 
-	// Check the having has expr value.
-	exprInHaving := false
-	exprInHavingStr := ""
-	if node.Having != nil {
-		_ = sqlparser.Walk(func(n sqlparser.SQLNode) (kontinue bool, err error) {
-			switch n.(type) {
-			case *sqlparser.FuncExpr:
-				exprInHaving = true
-				buf := sqlparser.NewTrackedBuffer(nil)
-				n.Format(buf)
-				exprInHavingStr = buf.String()
-				return false, nil
+	// aggregators.
+	k := 0
+	for _, tuple := range tuples {
+		p.indexes = append(p.indexes, k)
+		if tuple.fn == "" {
+			if tuple.expr != nil && containsAggregate(tuple.expr) {
+				p.evaluations = append(p.evaluations, Evaluation{Field: tuple.field, Index: k, Expr: tuple.expr})
+			} else {
+				// non-func
+				nullAggrs = append(nullAggrs, Aggregator{Field: tuple.field, Index: k, Type: AggrTypeNull})
+				nullTuples = append(nullTuples, tuple)
 			}
-			return true, nil
-		}, node.Having)
+			k++
+			continue
+		}
+		width, err := p.aggregate(tuple, k)
+		if err != nil {
+			return err
+		}
+		k += width
 	}
 
-	if exprInHaving {
-		return errors.Errorf("unsupported: expr[%s].in.having.clause", exprInHavingStr)
+	if err := p.analyzeEvaluations(); err != nil {
+		return err
 	}
 
-	// aggregators.
-	k := 0
-	for _, tuple := range tuples {
-		if tuple.distinct {
-			return errors.Errorf("unsupported: distinct.in.function:%+v", tuple.fn)
+	// Groupbys, the fields not in the select list are appended as the hidden columns.
+	for _, by := range node.GroupBy {
+		idx := -1
+		field := sqlparser.String(by)
+		switch by := by.(type) {
+		case *sqlparser.ColName:
+			field = by.Name.String()
+			qualifier := by.Qualifier.Name.String()
+			for i, null := range nullAggrs {
+				if null.Field != field {
+					continue
+				}
+				// check: select t.a from t group by x.a
+				if col, ok := nullTuples[i].expr.(*sqlparser.ColName); ok && qualifier != "" &&
+					!col.Qualifier.IsEmpty() && col.Qualifier.Name.String() != qualifier {
+					continue
+				}
+				idx = null.Index
+				break
+			}
+		default:
+			if containsAggregate(by) {
+				return errors.Errorf("Can't group on '%s'", field)
+			}
+			for i, null := range nullTuples {
+				if null.expr != nil && sqlparser.String(null.expr) == field {
+					idx = nullAggrs[i].Index
+					break
+				}
+			}
+		}
+		if idx == -1 {
+			idx = p.hideGroupBy(by, field)
 		}
+		p.groupAggrs = append(p.groupAggrs, Aggregator{Field: field, Index: idx, Type: AggrTypeGroupBy})
+	}
+	return nil
+}
 
-		aggrType := strings.ToLower(tuple.fn)
+// aggregate adds the aggregators of the aggregate function tuple at the kth of the rewritten select list,
+// the decomposed columns are inserted after it. Returns the number of the columns of the aggregator.
+func (p *AggregatePlan) aggregate(tuple selectTuple, k int) (int, error) {
+	aggrType := strings.ToLower(tuple.fn)
+	if tuple.distinct {
 		switch aggrType {
-		case "":
-			// non-func
-			nullAggrs = append(nullAggrs, Aggregator{Field: tuple.field, Index: k, Type: AggrTypeNull})
-		case "sum":
-			p.normalAggrs = append(p.normalAggrs, Aggregator{Field: tuple.field, Index: k, Type: AggrTypeSum})
-		case "count":
-			p.normalAggrs = append(p.normalAggrs, Aggregator{Field: tuple.field, Index: k, Type: AggrTypeCount})
-		case "min":
-			p.normalAggrs = append(p.normalAggrs, Aggregator{Field: tuple.field, Index: k, Type: AggrTypeMin})
-		case "max":
-			p.normalAggrs = append(p.normalAggrs, Aggregator{Field: tuple.field, Index: k, Type: AggrTypeMax})
-		case "avg":
-			p.normalAggrs = append(p.normalAggrs, Aggregator{Field: tuple.field, Index: k, Type: AggrTypeAvg})
-			p.normalAggrs = append(p.normalAggrs, Aggregator{Field: fmt.Sprintf("sum(%s)", tuple.column), Index: k + 1, Type: AggrTypeSum})
-			p.normalAggrs = append(p.normalAggrs, Aggregator{Field: fmt.Sprintf("count(%s)", tuple.column), Index: k + 2, Type: AggrTypeCount})
-
-			avgs := decomposeAvg(&tuple)
-			p.rewritten = append(p.rewritten, &sqlparser.AliasedExpr{}, &sqlparser.AliasedExpr{})
-			copy(p.rewritten[(k+1)+2:], p.rewritten[(k+1):])
-			p.rewritten[(k + 1)] = avgs[0]
-			p.rewritten[(k+1)+1] = avgs[1]
-			k += 2
+		case "count", "sum":
+			if err := p.rewriteDistinct(k, tuple); err != nil {
+				return 0, err
+			}
+			return 1, nil
+		case "min", "max", "group_concat":
+			// MIN/MAX(DISTINCT) is the same as MIN/MAX.
 		default:
-			return errors.Errorf("unsupported: function:%+v", tuple.fn)
+			return 0, errors.Errorf("unsupported: distinct.in.function:%+v", tuple.fn)
 		}
-		k++
 	}
 
-	// Groupbys.
-	groupbys := node.GroupBy
-	for _, by := range groupbys {
-		by1 := by.(*sqlparser.ColName)
-		// check: select ... from t groupby t.a
-		if !by1.Qualifier.IsEmpty() {
-			return errors.Errorf("unsupported: group.by.field[%s].have.table.name[%s].please.use.AS.keyword", by1.Name, by1.Qualifier.Name)
+	aggr := Aggregator{Field: tuple.field, Index: k}
+	switch aggrType {
+	case "sum":
+		aggr.Type = AggrTypeSum
+	case "count":
+		aggr.Type = AggrTypeCount
+	case "min":
+		aggr.Type = AggrTypeMin
+	case "max":
+		aggr.Type = AggrTypeMax
+	case "bit_and":
+		aggr.Type = AggrTypeBitAnd
+	case "bit_or":
+		aggr.Type = AggrTypeBitOr
+	case "bit_xor":
+		aggr.Type = AggrTypeBitXor
+	case "any_value":
+		aggr.Type = AggrTypeAnyValue
+	case "group_concat":
+		concat, err := p.rewriteGroupConcat(k, tuple)
+		if err != nil {
+			return 0, err
 		}
-		field := by1.Name.String()
-		// check: groupby field in select list
-		idx := -1
-		for _, null := range nullAggrs {
-			if null.Field == field {
-				idx = null.Index
-				break
+		aggr.Type = AggrTypeGroupConcat
+		aggr.GroupConcat = concat
+	case "avg":
+		p.normalAggrs = append(p.normalAggrs, Aggregator{Field: tuple.field, Index: k, Type: AggrTypeAvg})
+		p.normalAggrs = append(p.normalAggrs, Aggregator{Field: fmt.Sprintf("sum(%s)", tuple.column), Index: k + 1, Type: AggrTypeSum})
+		p.normalAggrs = append(p.normalAggrs, Aggregator{Field: fmt.Sprintf("count(%s)", tuple.column), Index: k + 2, Type: AggrTypeCount})
+		avgs := decomposeAvg(&tuple)
+		p.insertRewritten(k+1, avgs[0], avgs[1])
+		return 3, nil
+	case "std", "stddev", "stddev_pop", "stddev_samp", "variance", "var_pop", "var_samp":
+		decomposed, err := decomposeVariance(tuple.expr)
+		if err != nil {
+			return 0, err
+		}
+		p.normalAggrs = append(p.normalAggrs, Aggregator{Field: tuple.field, Index: k, Type: varianceTypes[aggrType]})
+		for i, expr := range decomposed {
+			aggrType := AggrTypeSum
+			if i == len(decomposed)-1 {
+				aggrType = AggrTypeCount
 			}
+			p.normalAggrs = append(p.normalAggrs, Aggregator{Field: sqlparser.String(expr.Expr), Index: k + 1 + i, Type: aggrType})
 		}
-		if idx == -1 {
-			return errors.Errorf("unsupported: group.by.field[%s].should.be.in.select.list", field)
+		p.insertRewritten(k+1, decomposed...)
+		return 1 + len(decomposed), nil
+	default:
+		return 0, errors.Errorf("unsupported: function:%+v", tuple.fn)
+	}
+	p.normalAggrs = append(p.normalAggrs, aggr)
+	return 1, nil
+}
+
+// insertRewritten inserts the expressions at the kth of the rewritten select list.
+func (p *AggregatePlan) insertRewritten(k int, exprs ...*sqlparser.AliasedExpr) {
+	rewritten := make(sqlparser.SelectExprs, 0, len(p.rewritten)+len(exprs))
+	rewritten = append(rewritten, p.rewritten[:k]...)
+	for _, expr := range exprs {
+		rewritten = append(rewritten, expr)
+	}
+	p.rewritten = append(rewritten, p.rewritten[k:]...)
+}
+
+// rewriteGroupConcat rewrites the GROUP_CONCAT at the kth of the rewritten select list, the shards return the values
+// and the order by keys hex encoded, so that they can be merged, sorted and deduplicated after the merge:
+// group_concat(a, b order by c separator ';')
+// is rewritten to:
+// group_concat(concat(hex(concat(a, b)), ':', ifnull(concat('v', hex(c)), 'n')) order by c asc separator ',')
+// The values are limited by the group_concat_max_len of the backends.
+func (p *AggregatePlan) rewriteGroupConcat(k int, tuple selectTuple) (*GroupConcat, error) {
+	expr, ok := p.rewritten[k].(*sqlparser.AliasedExpr)
+	if !ok {
+		return nil, errors.Errorf("unsupported: function:%+v", tuple.fn)
+	}
+	node := expr.Expr.(*sqlparser.GroupConcatExpr)
+
+	concat := &GroupConcat{Separator: ",", Distinct: node.Distinct != ""}
+	if node.Separator != "" {
+		concat.Separator = strings.TrimSuffix(strings.TrimPrefix(node.Separator, " separator '"), "'")
+	}
+	value := newFuncExpr("hex", newFuncExpr("concat", selectExprsToExprs(node.Exprs)...))
+	parts := []sqlparser.Expr{value}
+	for _, order := range node.OrderBy {
+		direction := ASC
+		if order.Direction == sqlparser.DescScr {
+			direction = DESC
+		}
+		concat.Directions = append(concat.Directions, direction)
+		key := newFuncExpr("ifnull",
+			newFuncExpr("concat", sqlparser.NewStrVal([]byte("v")), newFuncExpr("hex", order.Expr)),
+			sqlparser.NewStrVal([]byte("n")))
+		parts = append(parts, sqlparser.NewStrVal([]byte(":")), key)
+	}
+
+	encoded := &sqlparser.GroupConcatExpr{
+		Distinct:  node.Distinct,
+		Exprs:     sqlparser.SelectExprs{&sqlparser.AliasedExpr{Expr: newFuncExpr("concat", parts...)}},
+		OrderBy:   node.OrderBy,
+		Separator: " separator ','",
+	}
+	rewritten := make(sqlparser.SelectExprs, len(p.rewritten))
+	copy(rewritten, p.rewritten)
+	rewritten[k] = &sqlparser.AliasedExpr{Expr: encoded, As: sqlparser.NewColIdent(tuple.field)}
+	p.rewritten = rewritten
+	return concat, nil
+}
+
+// hideGroupBy appends the group by field to the rewritten select list, returns its index.
+// The hidden group by fields are kept after the aggregation, so that they are also can be ordered by.
+func (p *AggregatePlan) hideGroupBy(by sqlparser.Expr, field string) int {
+	for _, tuple := range p.hiddenTuples {
+		if sqlparser.String(tuple.expr) == sqlparser.String(by) {
+			return p.columns[sqlparser.String(by)]
 		}
-		p.groupAggrs = append(p.groupAggrs, Aggregator{Field: field, Index: idx, Type: AggrTypeGroupBy})
+	}
+	idx := len(p.rewritten)
+	p.appendRewritten(&sqlparser.AliasedExpr{Expr: by})
+	p.hiddenTuples = append(p.hiddenTuples, selectTuple{field: field, expr: by, hidden: true})
+	p.columns[sqlparser.String(by)] = idx
+	return idx
+}
+
+// analyzeEvaluations resolves the aggregators and columns referenced by the evaluations and having clause,
+// the ones not in the select list are appended as the hidden columns.
+func (p *AggregatePlan) analyzeEvaluations() error {
+	if p.node.Having != nil {
+		p.having = p.node.Having.Expr
+	}
+	if len(p.evaluations) == 0 && p.having == nil {
+		return nil
+	}
+
+	// The select list, the aliases take precedence.
+	for i, tuple := range p.tuples {
+		if tuple.expr != nil {
+			if _, ok := tuple.expr.(*sqlparser.ColName); ok || tuple.fn != "" {
+				p.columns[sqlparser.String(tuple.expr)] = p.indexes[i]
+			}
+		}
+	}
+	for i, tuple := range p.tuples {
+		// The expressions without alias are not referenced by the name.
+		if tuple.field != "" && tuple.field != "*" && (tuple.expr == nil || tuple.field != sqlparser.String(tuple.expr)) {
+			p.columns[tuple.field] = p.indexes[i]
+		}
+	}
+
+	start := len(p.rewritten)
+	for _, eval := range p.evaluations {
+		if err := p.hide(eval.Expr); err != nil {
+			return err
+		}
+	}
+	if p.having != nil {
+		if err := p.hide(p.having); err != nil {
+			return err
+		}
+	}
+	for i := start; i < len(p.rewritten); i++ {
+		p.hidden = append(p.hidden, i)
 	}
 	return nil
 }
 
+// hide appends the aggregators and columns of the expression which are not in the select list to the rewritten
+// select list.
+func (p *AggregatePlan) hide(expr sqlparser.Expr) error {
+	return sqlparser.Walk(func(n sqlparser.SQLNode) (kontinue bool, err error) {
+		switch n := n.(type) {
+		case *sqlparser.Subquery:
+			return false, errors.Errorf("unsupported: subquery[%s].in.aggregate.expression", sqlparser.String(n))
+		case *sqlparser.ColName:
+			key := sqlparser.String(n)
+			if _, ok := p.columns[key]; !ok {
+				p.columns[key] = len(p.rewritten)
+				p.appendRewritten(&sqlparser.AliasedExpr{Expr: n})
+			}
+			return false, nil
+		case *sqlparser.FuncExpr, *sqlparser.GroupConcatExpr:
+			if fn, ok := n.(*sqlparser.FuncExpr); ok && !isAggregateFunc(fn) {
+				return true, nil
+			}
+			key := sqlparser.String(n)
+			if _, ok := p.columns[key]; ok {
+				return false, nil
+			}
+			k := len(p.rewritten)
+			if err := p.hideAggregator(n.(sqlparser.Expr)); err != nil {
+				return false, err
+			}
+			p.columns[key] = k
+			return false, nil
+		}
+		return true, nil
+	}, expr)
+}
+
+// hideAggregator appends the aggregator to the rewritten select list.
+func (p *AggregatePlan) hideAggregator(fn sqlparser.Expr) error {
+	k := len(p.rewritten)
+	expr := &sqlparser.AliasedExpr{Expr: fn}
+	tuple, err := parserSelectExpr(expr)
+	if err != nil {
+		return err
+	}
+	tuple.field = sqlparser.String(fn)
+	p.appendRewritten(expr)
+	_, err = p.aggregate(*tuple, k)
+	return err
+}
+
+// appendRewritten appends the expression to the rewritten select list, the select list of the node is kept.
+func (p *AggregatePlan) appendRewritten(expr sqlparser.SelectExpr) {
+	rewritten := make(sqlparser.SelectExprs, len(p.rewritten), len(p.rewritten)+1)
+	copy(rewritten, p.rewritten)
+	p.rewritten = append(rewritten, expr)
+}
+
+// isAggregateFunc returns true if the function is an aggregate function.
+func isAggregateFunc(fn *sqlparser.FuncExpr) bool {
+	switch fn.Name.Lowered() {
+	case "sum", "count", "min", "max", "avg",
+		"std", "stddev", "stddev_pop", "stddev_samp", "variance", "var_pop", "var_samp",
+		"bit_and", "bit_or", "bit_xor", "any_value":
+		return true
+	}
+	return false
+}
+
+// varianceTypes maps the variance functions to the aggregator types.
+var varianceTypes = map[string]AggrType{
+	"std":         AggrTypeStddevPop,
+	"stddev":      AggrTypeStddevPop,
+	"stddev_pop":  AggrTypeStddevPop,
+	"stddev_samp": AggrTypeStddevSamp,
+	"variance":    AggrTypeVarPop,
+	"var_pop":     AggrTypeVarPop,
+	"var_samp":    AggrTypeVarSamp,
+}
+
+// decomposeVariance decomposes the variance function of x to sum(x), sum(x*x) and count(x).
+func decomposeVariance(expr sqlparser.Expr) ([]*sqlparser.AliasedExpr, error) {
+	fn := expr.(*sqlparser.FuncExpr)
+	args := selectExprsToExprs(fn.Exprs)
+	if len(args) != 1 {
+		return nil, errors.Errorf("Incorrect parameter count in the call to native function '%s'", fn.Name.String())
+	}
+	arg, factor := args[0], args[0]
+	switch factor.(type) {
+	case *sqlparser.ColName, *sqlparser.SQLVal, *sqlparser.ParenExpr, *sqlparser.FuncExpr:
+	default:
+		factor = &sqlparser.ParenExpr{Expr: factor}
+	}
+	return []*sqlparser.AliasedExpr{
+		{Expr: newFuncExpr("sum", arg)},
+		{Expr: newFuncExpr("sum", &sqlparser.BinaryExpr{Operator: sqlparser.MultStr, Left: factor, Right: factor})},
+		{Expr: newFuncExpr("count", arg)},
+	}, nil
+}
+
+// newFuncExpr creates the function expression.
+func newFuncExpr(name string, args ...sqlparser.Expr) *sqlparser.FuncExpr {
+	fn := &sqlparser.FuncExpr{Name: sqlparser.NewColIdent(name)}
+	for _, arg := range args {
+		fn.Exprs = append(fn.Exprs, &sqlparser.AliasedExpr{Expr: arg})
+	}
+	return fn
+}
+
+// selectExprsToExprs returns the expressions of the aliased select expressions.
+func selectExprsToExprs(exprs sqlparser.SelectExprs) []sqlparser.Expr {
+	var ret []sqlparser.Expr
+	for _, expr := range exprs {
+		if expr, ok := expr.(*sqlparser.AliasedExpr); ok {
+			ret = append(ret, expr.Expr)
+		}
+	}
+	return ret
+}
+
+// containsAggregate returns true if the expression contains the aggregate functions.
+func containsAggregate(expr sqlparser.Expr) bool {
+	found := false
+	_ = sqlparser.Walk(func(n sqlparser.SQLNode) (kontinue bool, err error) {
+		switch n := n.(type) {
+		case *sqlparser.Subquery:
+			return false, nil
+		case *sqlparser.FuncExpr:
+			if isAggregateFunc(n) {
+				found = true
+				return false, nil
+			}
+		case *sqlparser.GroupConcatExpr:
+			found = true
+			return false, nil
+		}
+		return true, nil
+	}, expr)
+	return found
+}
+
+// rewriteDistinct rewrites the distinct aggregator at the kth of the rewritten select list to its argument,
+// and appends the argument to the group by clause of the shard querys.
+func (p *AggregatePlan) rewriteDistinct(k int, tuple selectTuple) error {
+	expr, ok := p.rewritten[k].(*sqlparser.AliasedExpr)
+	if !ok {
+		return errors.Errorf("unsupported: distinct.in.function:%+v", tuple.fn)
+	}
+	fn := expr.Expr.(*sqlparser.FuncExpr)
+	if len(fn.Exprs) != 1 {
+		return errors.Errorf("unsupported: distinct.in.function:%+v.with.multiple.arguments", tuple.fn)
+	}
+	arg, ok := fn.Exprs[0].(*sqlparser.AliasedExpr)
+	if !ok {
+		return errors.Errorf("unsupported: distinct.in.function:%+v", tuple.fn)
+	}
+
+	aggr := Aggregator{Field: tuple.field, Index: k, Type: AggrTypeSumDistinct}
+	if strings.ToLower(tuple.fn) == "count" {
+		aggr.Type = AggrTypeCountDistinct
+		aggr.Approximate = HasCommentHint(p.node.Comments, approxCountDistinctHint)
+	}
+	p.normalAggrs = append(p.normalAggrs, aggr)
+
+	rewritten := make(sqlparser.SelectExprs, len(p.rewritten))
+	copy(rewritten, p.rewritten)
+	rewritten[k] = &sqlparser.AliasedExpr{Expr: arg.Expr, As: sqlparser.NewColIdent(tuple.field)}
+	p.rewritten = rewritten
+
+	argStr := sqlparser.String(arg.Expr)
+	for _, by := range p.rewrittenGroupBy {
+		if sqlparser.String(by) == argStr {
+			return nil
+		}
+	}
+	groupBy := make(sqlparser.GroupBy, len(p.rewrittenGroupBy), len(p.rewrittenGroupBy)+1)
+	copy(groupBy, p.rewrittenGroupBy)
+	p.rewrittenGroupBy = append(groupBy, arg.Expr)
+	return nil
+}
+
+// HasCommentHint returns true if the hint is in the comments like '/*+ hint */', case-insensitive.
+func HasCommentHint(comments sqlparser.Comments, hint string) bool {
+	for _, comment := range comments {
+		text := strings.TrimSpace(string(comment))
+		if !strings.HasPrefix(text, "/*+") || !strings.HasSuffix(text, "*/") {
+			continue
+		}
+		for _, word := range strings.Fields(text[3 : len(text)-2]) {
+			if strings.EqualFold(word, hint) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // Build used to build distributed querys.
 func (p *AggregatePlan) Build() error {
 	return p.analyze()
@@ -187,13 +633,28 @@ func (p *AggregatePlan) Type() PlanType {
 
 // JSON returns the plan info.
 func (p *AggregatePlan) JSON() string {
+	type evaluation struct {
+		Field string
+		Index int
+		Expr  string
+	}
 	type aggrs struct {
-		Aggrs     []Aggregator
-		ReWritten string
+		Aggrs       []Aggregator
+		Evaluations []evaluation `json:",omitempty"`
+		Having      string       `json:",omitempty"`
+		Hidden      []int        `json:",omitempty"`
+		ReWritten   string
 	}
 	a := &aggrs{}
 	a.Aggrs = append(a.Aggrs, p.normalAggrs...)
 	a.Aggrs = append(a.Aggrs, p.groupAggrs...)
+	for _, eval := range p.evaluations {
+		a.Evaluations = append(a.Evaluations, evaluation{Field: eval.Field, Index: eval.Index, Expr: sqlparser.String(eval.Expr)})
+	}
+	if p.having != nil {
+		a.Having = sqlparser.String(p.having)
+	}
+	a.Hidden = p.hidden
 
 	buf := sqlparser.NewTrackedBuffer(nil)
 	buf.Myprintf("%v", p.rewritten)
@@ -226,9 +687,44 @@ func (p *AggregatePlan) ReWritten() sqlparser.SelectExprs {
 	return p.rewritten
 }
 
+// ReWrittenGroupBy used to re-write the GroupBy clause.
+func (p *AggregatePlan) ReWrittenGroupBy() sqlparser.GroupBy {
+	return p.rewrittenGroupBy
+}
+
+// Evaluations returns the expressions over the aggregators.
+func (p *AggregatePlan) Evaluations() []Evaluation {
+	return p.evaluations
+}
+
+// Having returns the having clause evaluated after the merge.
+func (p *AggregatePlan) Having() sqlparser.Expr {
+	return p.having
+}
+
+// Columns returns the indexes of the aggregators, columns and aliases referenced by the evaluations and having.
+func (p *AggregatePlan) Columns() map[string]int {
+	return p.columns
+}
+
+// HiddenColumns returns the indexes of the hidden columns.
+func (p *AggregatePlan) HiddenColumns() []int {
+	return p.hidden
+}
+
+// HasDistinct returns true if there are distinct aggregators.
+func (p *AggregatePlan) HasDistinct() bool {
+	for _, aggr := range p.normalAggrs {
+		if aggr.Type == AggrTypeCountDistinct || aggr.Type == AggrTypeSumDistinct {
+			return true
+		}
+	}
+	return false
+}
+
 // Empty returns the aggregator number more than zero.
 func (p *AggregatePlan) Empty() bool {
-	return (len(p.normalAggrs) == 0 && len(p.groupAggrs) == 0)
+	return (len(p.normalAggrs) == 0 && len(p.groupAggrs) == 0 && len(p.evaluations) == 0 && p.having == nil)
 }
 
 // Size returns the memory size.
@@ -269,7 +269,11 @@ func TestAggregatePlanHaving(t *testing.T) {
 			"Type": "GROUP BY"
 		}
 	],
-	"ReWritten": "age, count(*)"
+	"Having": "a \u003e= 2",
+	"Hidden": [
+		2
+	],
+	"ReWritten": "age, count(*), a"
 }`,
 	}
 
@@ -298,20 +302,251 @@ func TestAggregatePlanHaving(t *testing.T) {
 	}
 }
 
+func TestAggregatePlanEvaluations(t *testing.T) {
+	querys := []string{
+		"select a, sum(b)/count(c) as r, ifnull(max(d), 0) as m from A group by a having min(d) > 1 or a = 2",
+		"select a, max(x)-min(x), avg(y)*2 from A group by a having avg(y) > count(distinct z)",
+	}
+	results := []string{
+		`{
+	"Aggrs": [
+		{
+			"Field": "sum(b)",
+			"Index": 3,
+			"Type": "SUM"
+		},
+		{
+			"Field": "count(c)",
+			"Index": 4,
+			"Type": "COUNT"
+		},
+		{
+			"Field": "max(d)",
+			"Index": 5,
+			"Type": "MAX"
+		},
+		{
+			"Field": "min(d)",
+			"Index": 6,
+			"Type": "MIN"
+		},
+		{
+			"Field": "a",
+			"Index": 0,
+			"Type": "GROUP BY"
+		}
+	],
+	"Evaluations": [
+		{
+			"Field": "r",
+			"Index": 1,
+			"Expr": "sum(b) / count(c)"
+		},
+		{
+			"Field": "m",
+			"Index": 2,
+			"Expr": "ifnull(max(d), 0)"
+		}
+	],
+	"Having": "min(d) \u003e 1 or a = 2",
+	"Hidden": [
+		3,
+		4,
+		5,
+		6
+	],
+	"ReWritten": "a, sum(b) / count(c) as r, ifnull(max(d), 0) as m, sum(b), count(c), max(d), min(d)"
+}`,
+		`{
+	"Aggrs": [
+		{
+			"Field": "max(x)",
+			"Index": 3,
+			"Type": "MAX"
+		},
+		{
+			"Field": "min(x)",
+			"Index": 4,
+			"Type": "MIN"
+		},
+		{
+			"Field": "avg(y)",
+			"Index": 5,
+			"Type": "AVG"
+		},
+		{
+			"Field": "sum(y)",
+			"Index": 6,
+			"Type": "SUM"
+		},
+		{
+			"Field": "count(y)",
+			"Index": 7,
+			"Type": "COUNT"
+		},
+		{
+			"Field": "count(distinct z)",
+			"Index": 8,
+			"Type": "COUNT DISTINCT"
+		},
+		{
+			"Field": "a",
+			"Index": 0,
+			"Type": "GROUP BY"
+		}
+	],
+	"Evaluations": [
+		{
+			"Field": "max(x) - min(x)",
+			"Index": 1,
+			"Expr": "max(x) - min(x)"
+		},
+		{
+			"Field": "avg(y) * 2",
+			"Index": 2,
+			"Expr": "avg(y) * 2"
+		}
+	],
+	"Having": "avg(y) \u003e count(distinct z)",
+	"Hidden": [
+		3,
+		4,
+		5,
+		6,
+		7,
+		8
+	],
+	"ReWritten": "a, max(x) - min(x), avg(y) * 2, max(x), min(x), avg(y), sum(y), count(y), z as ` + "`count(distinct z)`" + `"
+}`,
+	}
+	columns := []map[string]int{
+		{"a": 0, "r": 1, "m": 2, "sum(b)": 3, "count(c)": 4, "max(d)": 5, "min(d)": 6},
+		{"a": 0, "max(x)": 3, "min(x)": 4, "avg(y)": 5, "count(distinct z)": 8},
+	}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	for i, query := range querys {
+		tree, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		node := tree.(*sqlparser.Select)
+		tuples, err := parserSelectExprs(node.SelectExprs)
+		assert.Nil(t, err)
+		plan := NewAggregatePlan(log, node, tuples)
+		err = plan.Build()
+		assert.Nil(t, err)
+		assert.Equal(t, results[i], plan.JSON())
+		assert.Equal(t, columns[i], plan.Columns())
+		assert.Equal(t, 2, len(plan.Evaluations()))
+		assert.NotNil(t, plan.Having())
+		assert.False(t, plan.Empty())
+	}
+}
+
+func TestAggregatePlanFunctions(t *testing.T) {
+	query := "select a, group_concat(distinct b order by c desc separator ';') as g, stddev(x+1), var_samp(y), bit_xor(z), any_value(w) from A group by a"
+	want := `{
+	"Aggrs": [
+		{
+			"Field": "g",
+			"Index": 1,
+			"Type": "GROUP_CONCAT",
+			"GroupConcat": {
+				"Separator": ";",
+				"Distinct": true,
+				"Directions": [
+					"DESC"
+				]
+			}
+		},
+		{
+			"Field": "stddev(x + 1)",
+			"Index": 2,
+			"Type": "STDDEV_POP"
+		},
+		{
+			"Field": "sum(x + 1)",
+			"Index": 3,
+			"Type": "SUM"
+		},
+		{
+			"Field": "sum((x + 1) * (x + 1))",
+			"Index": 4,
+			"Type": "SUM"
+		},
+		{
+			"Field": "count(x + 1)",
+			"Index": 5,
+			"Type": "COUNT"
+		},
+		{
+			"Field": "var_samp(y)",
+			"Index": 6,
+			"Type": "VAR_SAMP"
+		},
+		{
+			"Field": "sum(y)",
+			"Index": 7,
+			"Type": "SUM"
+		},
+		{
+			"Field": "sum(y * y)",
+			"Index": 8,
+			"Type": "SUM"
+		},
+		{
+			"Field": "count(y)",
+			"Index": 9,
+			"Type": "COUNT"
+		},
+		{
+			"Field": "bit_xor(z)",
+			"Index": 10,
+			"Type": "BIT_XOR"
+		},
+		{
+			"Field": "any_value(w)",
+			"Index": 11,
+			"Type": "ANY_VALUE"
+		},
+		{
+			"Field": "a",
+			"Index": 0,
+			"Type": "GROUP BY"
+		}
+	],
+	"ReWritten": "a, group_concat(distinct concat(hex(concat(b)), ':', ifnull(concat('v', hex(c)), 'n')) order by c desc separator ',') as g, stddev(x + 1), sum(x + 1), sum((x + 1) * (x + 1)), count(x + 1), var_samp(y), sum(y), sum(y * y), count(y), bit_xor(z), any_value(w)"
+}`
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	tree, err := sqlparser.Parse(query)
+	assert.Nil(t, err)
+	node := tree.(*sqlparser.Select)
+	tuples, err := parserSelectExprs(node.SelectExprs)
+	assert.Nil(t, err)
+	plan := NewAggregatePlan(log, node, tuples)
+	err = plan.Build()
+	assert.Nil(t, err)
+	assert.Equal(t, want, plan.JSON())
+}
+
 func TestAggregatePlanUnsupported(t *testing.T) {
 	querys := []string{
-		"select sum(a)  from t group by d",
-		"select sum(a),d  from t group by db.t.d",
+		"select sum(a)  from t group by sum(b)",
+		"select sum(a),d  from t group by d having (select 1) > 0",
 		"select rand(a),d  from t group by a",
-		"select count(distinct b) from t",
-		"select age,count(*) from A group by age having count(*) >=2",
+		"select avg(distinct b) from t",
+		"select age,count(*) from A group by age having count(distinct a, b) >=2",
+		"select bit_and(distinct a) from t",
+		"select stddev(a, b) from t",
 	}
 	results := []string{
-		"unsupported: group.by.field[d].should.be.in.select.list",
-		"unsupported: group.by.field[d].have.table.name[t].please.use.AS.keyword",
+		"Can't group on 'sum(b)'",
+		"unsupported: subquery[(select 1 from dual)].in.aggregate.expression",
 		"unsupported: function:rand",
-		"unsupported: distinct.in.function:count",
-		"unsupported: expr[count(*)].in.having.clause",
+		"unsupported: distinct.in.function:avg",
+		"unsupported: distinct.in.function:count.with.multiple.arguments",
+		"unsupported: distinct.in.function:bit_and",
+		"Incorrect parameter count in the call to native function 'stddev'",
 	}
 
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
@@ -332,3 +567,49 @@ func TestAggregatePlanUnsupported(t *testing.T) {
 		}
 	}
 }
+
+func TestAggregatePlanDistinct(t *testing.T) {
+	querys := []string{
+		"select a, count(distinct b), sum(distinct c) as sc, avg(d), count(*) from t group by a",
+		"select /*+ approx_count_distinct */ count(distinct b), sum(distinct b), max(distinct c) from t",
+	}
+	rewrittens := []string{
+		"a, b as `count(distinct b)`, c as sc, avg(d), sum(d), count(d), count(*)",
+		"b as `count(distinct b)`, b as `sum(distinct b)`, max(distinct c)",
+	}
+	groupbys := []string{
+		" group by a, b, c",
+		" group by b",
+	}
+	aggrs := [][]Aggregator{
+		{
+			{Field: "count(distinct b)", Index: 1, Type: AggrTypeCountDistinct},
+			{Field: "sc", Index: 2, Type: AggrTypeSumDistinct},
+			{Field: "avg(d)", Index: 3, Type: AggrTypeAvg},
+			{Field: "sum(d)", Index: 4, Type: AggrTypeSum},
+			{Field: "count(d)", Index: 5, Type: AggrTypeCount},
+			{Field: "count(*)", Index: 6, Type: AggrTypeCount},
+		},
+		{
+			{Field: "count(distinct b)", Index: 0, Type: AggrTypeCountDistinct, Approximate: true},
+			{Field: "sum(distinct b)", Index: 1, Type: AggrTypeSumDistinct},
+			{Field: "max(distinct c)", Index: 2, Type: AggrTypeMax},
+		},
+	}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	for i, query := range querys {
+		tree, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		node := tree.(*sqlparser.Select)
+		tuples, err := parserSelectExprs(node.SelectExprs)
+		assert.Nil(t, err)
+		plan := NewAggregatePlan(log, node, tuples)
+		err = plan.Build()
+		assert.Nil(t, err)
+		assert.True(t, plan.HasDistinct())
+		assert.Equal(t, aggrs[i], plan.NormalAggregators())
+		assert.Equal(t, rewrittens[i], sqlparser.String(plan.ReWritten()))
+		assert.Equal(t, groupbys[i], sqlparser.String(plan.ReWrittenGroupBy()))
+	}
+}
@@ -84,17 +84,17 @@ func (p *DDLPlan) Build() error {
 		}
 
 		// Get the shard key.
-		shardKey, err := p.router.ShardKey(database, table)
+		shardKeys, err := p.router.ShardKeys(database, table)
 		if err != nil {
 			return err
 		}
 		switch node.Action {
 		case sqlparser.AlterDropColumnStr:
-			if shardKey == node.DropColumnName {
+			if isShardKey(node.DropColumnName, shardKeys) {
 				return errors.New("unsupported: cannot.drop.the.column.on.shard.key")
 			}
 		case sqlparser.AlterModifyColumnStr:
-			if shardKey == node.ModifyColumnDef.Name.String() {
+			if isShardKey(node.ModifyColumnDef.Name.String(), shardKeys) {
 				return errors.New("unsupported: cannot.modify.the.column.on.shard.key")
 			}
 		}
@@ -48,6 +48,12 @@ type DeletePlan struct {
 
 	// query and backend tuple
 	Querys []xcontext.QueryTuple
+
+	// Lookups are the target tables of the multiple-table delete which can't be pushed down.
+	Lookups []*DMLLookup
+
+	// children are the select plans of the lookups.
+	children *PlanTree
 }
 
 // NewDeletePlan used to create DeletePlan
@@ -70,6 +76,13 @@ func (p *DeletePlan) analyze() error {
 	if hasSubquery(node) {
 		return errors.New("unsupported: subqueries.in.delete")
 	}
+	if node.TableExprs != nil {
+		// The tables joined by the ON condition don't need the where clause.
+		if node.Where == nil && !hasJoinCondition(node.TableExprs) {
+			return errors.New("unsupported: missing.where.clause.in.DML")
+		}
+		return nil
+	}
 	if node.Where == nil {
 		return errors.New("unsupported: missing.where.clause.in.DML")
 	}
@@ -83,6 +96,10 @@ func (p *DeletePlan) Build() error {
 	}
 
 	node := p.node
+	if node.TableExprs != nil {
+		return p.buildMultiTable()
+	}
+
 	// Database.
 	database := p.database
 	if !node.Table.Qualifier.IsEmpty() {
@@ -91,21 +108,21 @@ func (p *DeletePlan) Build() error {
 	table := node.Table.Name.String()
 
 	// Sharding key.
-	shardkey, err := p.router.ShardKey(database, table)
+	shardkeys, err := p.router.ShardKeys(database, table)
 	if err != nil {
 		return err
 	}
 
 	// Get the routing segments info.
-	segments, err := getDMLRouting(database, table, shardkey, node.Where, p.router)
+	routing, err := getRouting(database, table, shardkeys, node.Where, p.router)
 	if err != nil {
 		return err
 	}
 
 	// Rewritten the query.
-	for _, segment := range segments {
+	for _, segment := range routing.segments {
 		buf := sqlparser.NewTrackedBuffer(nil)
-		buf.Myprintf("delete %vfrom %s.%s%v%v%v", node.Comments, database, segment.Table, node.Where, node.OrderBy, node.Limit)
+		buf.Myprintf("delete %vfrom %s.%s%v%v%v", node.Comments, database, segment.Table, routing.rewriteWhere(node.Where, segment), node.OrderBy, node.Limit)
 		tuple := xcontext.QueryTuple{
 			Query:   buf.String(),
 			Backend: segment.Backend,
@@ -116,6 +133,55 @@ func (p *DeletePlan) Build() error {
 	return nil
 }
 
+// buildMultiTable used to build the multiple-table delete.
+// The statement is pushed down to the segments if the tables can be joined on the shards,
+// otherwise the rows of every target table are looked up and deleted by the sharding keys.
+func (p *DeletePlan) buildMultiTable() error {
+	node := p.node
+	m, err := newMultiTableDML(p.log, p.database, node.Comments, node.TableExprs, node.Where, p.router)
+	if err != nil {
+		return err
+	}
+
+	var targets []*tableInfo
+	var names sqlparser.TableNames
+	for _, target := range node.Targets {
+		t := m.lookupTable(target)
+		if t == nil {
+			return errors.Errorf("Unknown table '%s' in MULTI DELETE", target.Name.String())
+		}
+		if err := m.checkTarget(t); err != nil {
+			return err
+		}
+		duplicate := false
+		for _, other := range targets {
+			duplicate = duplicate || other == t
+		}
+		if !duplicate {
+			targets = append(targets, t)
+			names = append(names, m.targetName(t))
+		}
+	}
+
+	if m.pushdown {
+		p.Querys, err = m.pushdownQuerys(func(buf *sqlparser.TrackedBuffer, from sqlparser.TableExprs, where *sqlparser.Where) {
+			buf.Myprintf("delete %v%v from %v%v", node.Comments, names, from, where)
+		})
+		return err
+	}
+
+	p.children = NewPlanTree()
+	for _, t := range targets {
+		lookup, err := m.buildLookup(t, nil)
+		if err != nil {
+			return err
+		}
+		p.Lookups = append(p.Lookups, lookup)
+		p.children.Add(lookup.Select)
+	}
+	return nil
+}
+
 // Type returns the type of the plan.
 func (p *DeletePlan) Type() PlanType {
 	return p.typ
@@ -126,6 +192,7 @@ func (p *DeletePlan) JSON() string {
 	type explain struct {
 		RawQuery   string                `json:",omitempty"`
 		Partitions []xcontext.QueryTuple `json:",omitempty"`
+		Lookups    []json.RawMessage     `json:",omitempty"`
 	}
 
 	// Partitions.
@@ -135,6 +202,9 @@ func (p *DeletePlan) JSON() string {
 		RawQuery:   p.RawQuery,
 		Partitions: parts,
 	}
+	for _, lookup := range p.Lookups {
+		exp.Lookups = append(exp.Lookups, lookup.JSON())
+	}
 	bout, err := json.MarshalIndent(exp, "", "\t")
 	if err != nil {
 		return err.Error()
@@ -142,9 +212,9 @@ func (p *DeletePlan) JSON() string {
 	return hack.String(bout)
 }
 
-// Children returns the children of the plan.
+// Children returns the select plans of the lookups, nil if none.
 func (p *DeletePlan) Children() *PlanTree {
-	return nil
+	return p.children
 }
 
 // Size returns the memory size.
@@ -153,5 +223,8 @@ func (p *DeletePlan) Size() int {
 	for _, q := range p.Querys {
 		size += len(q.Query)
 	}
+	for _, lookup := range p.Lookups {
+		size += lookup.Select.Size()
+	}
 	return size
 }
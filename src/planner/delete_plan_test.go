@@ -9,12 +9,15 @@
 package planner
 
 import (
+	"fmt"
 	"testing"
 
 	"router"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/sqlparser"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
 
@@ -79,32 +82,22 @@ func TestDeletePlan(t *testing.T) {
 	"RawQuery": "delete from sbtest.A where id in (1, 2,3)",
 	"Partitions": [
 		{
-			"Query": "delete from sbtest.A1 where id in (1, 2, 3)",
+			"Query": "delete from sbtest.A6 where id in (1, 2, 3)",
+			"Backend": "backend6",
+			"Range": "[512-4096)"
+		}
+	]
+}`,
+		`{
+	"RawQuery": "delete from sbtest.A where (id=0 or id=1 or id=39) and name='xx'",
+	"Partitions": [
+		{
+			"Query": "delete from sbtest.A1 where (id = 0 or id = 39) and name = 'xx'",
 			"Backend": "backend1",
 			"Range": "[0-32)"
 		},
 		{
-			"Query": "delete from sbtest.A2 where id in (1, 2, 3)",
-			"Backend": "backend2",
-			"Range": "[32-64)"
-		},
-		{
-			"Query": "delete from sbtest.A3 where id in (1, 2, 3)",
-			"Backend": "backend3",
-			"Range": "[64-96)"
-		},
-		{
-			"Query": "delete from sbtest.A4 where id in (1, 2, 3)",
-			"Backend": "backend4",
-			"Range": "[96-256)"
-		},
-		{
-			"Query": "delete from sbtest.A5 where id in (1, 2, 3)",
-			"Backend": "backend5",
-			"Range": "[256-512)"
-		},
-		{
-			"Query": "delete from sbtest.A6 where id in (1, 2, 3)",
+			"Query": "delete from sbtest.A6 where (id = 1) and name = 'xx'",
 			"Backend": "backend6",
 			"Range": "[512-4096)"
 		}
@@ -116,6 +109,7 @@ func TestDeletePlan(t *testing.T) {
 		"delete from sbtest.A where id=1 order by xx",
 		"delete from sbtest.A where name='xx'",
 		"delete from sbtest.A where id in (1, 2,3)",
+		"delete from sbtest.A where (id=0 or id=1 or id=39) and name='xx'",
 	}
 
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
@@ -214,3 +208,108 @@ func TestDeleteErrorPlan(t *testing.T) {
 		}
 	}
 }
+
+func TestDeleteMultiTablePlan(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	// M is partitioned identically to A.
+	M := router.MockTableMConfig()
+	M.Name = "M"
+	M.ShardKey = "uid"
+	for i, part := range M.Partitions {
+		part.Table = fmt.Sprintf("M%d", i+1)
+	}
+	A := router.MockTableMConfig()
+	A.UniqueKey = "id"
+	B := router.MockTableBConfig()
+	B.UniqueKey = "id"
+	err := route.AddForTest(database, A, B, router.MockTableGConfig(), M)
+	assert.Nil(t, err)
+
+	// Pushdown to the segments.
+	{
+		querys := []string{
+			"delete A, M from A join M on A.id = M.uid where A.id = 1",
+		}
+		wants := []string{
+			"delete A, M from sbtest.A6 as A join sbtest.M6 as M on A.id = M.uid where A.id = 1",
+		}
+		sizes := []int{1}
+		for i, query := range querys {
+			node, err := sqlparser.Parse(query)
+			assert.Nil(t, err)
+			plan := NewDeletePlan(log, database, query, node.(*sqlparser.Delete), route)
+			err = plan.Build()
+			assert.Nil(t, err)
+			assert.Nil(t, plan.Children())
+			assert.Equal(t, sizes[i], len(plan.Querys))
+			assert.Equal(t, wants[i], plan.Querys[0].Query)
+		}
+	}
+
+	// Lookup the keys of the targets.
+	{
+		query := "delete A, B from A join B on A.id = B.id where B.c = 1"
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := NewDeletePlan(log, database, query, node.(*sqlparser.Delete), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(plan.Querys))
+		assert.Equal(t, 2, len(plan.Lookups))
+		assert.Equal(t, 2, len(plan.Children().Plans()))
+		assert.Equal(t, "B", plan.Lookups[1].Table)
+
+		intVal := func(v string) sqltypes.Value {
+			return sqltypes.MakeTrusted(querypb.Type_INT32, []byte(v))
+		}
+		querys, err := plan.Lookups[0].Querys([][]sqltypes.Value{{intVal("1")}, {intVal("2")}, {intVal("1")}})
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(querys))
+		assert.Equal(t, "delete from sbtest.A6 where id in (1, 2)", querys[0].Query)
+	}
+
+	// The global table isn't on all the backends of the shards, lookup the keys.
+	{
+		query := "delete from a using sbtest.A as a join G on a.id = G.id where a.b = 1"
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := NewDeletePlan(log, database, query, node.(*sqlparser.Delete), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(plan.Querys))
+		assert.Equal(t, 1, len(plan.Lookups))
+	}
+
+	// Unsupported.
+	{
+		querys := []string{
+			"delete C from A join B on A.id = B.id",
+			"delete G from A join G on A.id = G.id",
+			"delete A from A, B",
+			"delete A from A join B on A.id = B.id where A.id in (select id from B)",
+			"delete M from M join B on M.uid = B.id",
+		}
+		results := []string{
+			"Unknown table 'C' in MULTI DELETE",
+			"unsupported: global.table[G].joined.with.non-global.tables.can.not.be.changed",
+			"unsupported: missing.where.clause.in.DML",
+			"unsupported: subqueries.in.delete",
+			"unsupported: table[M].without.primary.or.unique.key.can.not.be.changed.across.shards",
+		}
+		for i, query := range querys {
+			node, err := sqlparser.Parse(query)
+			assert.Nil(t, err)
+			plan := NewDeletePlan(log, database, query, node.(*sqlparser.Delete), route)
+			err = plan.Build()
+			assert.NotNil(t, err, query)
+			if err != nil {
+				assert.Equal(t, results[i], err.Error())
+			}
+		}
+	}
+}
@@ -17,29 +17,263 @@ import (
 	"github.com/xelabs/go-mysqlstack/sqlparser"
 )
 
+// dmlRouting tuple.
+// The segments which the DML routes to, the values of the IN/OR filter on the
+// shard key are distributed to the segments which own them.
+type dmlRouting struct {
+	segments []router.Segment
+
+	// filter is the IN/OR filter on the shard key in the where clause, nil if none.
+	filter sqlparser.Expr
+
+	// column is the shard key column of the filter.
+	column *sqlparser.ColName
+
+	// owns maps the segment table to the values it owns.
+	owns map[string]sqlparser.ValTuple
+}
+
+// rewriteWhere returns the where clause for the segment, the IN/OR filter on the
+// shard key is replaced by the one with the values the segment owns.
+func (r *dmlRouting) rewriteWhere(where *sqlparser.Where, segment router.Segment) *sqlparser.Where {
+	if r.filter == nil {
+		return where
+	}
+	values := r.owns[segment.Table]
+
+	var expr sqlparser.Expr
+	switch filter := r.filter.(type) {
+	case *sqlparser.ComparisonExpr:
+		expr = &sqlparser.ComparisonExpr{Operator: sqlparser.InStr, Left: r.column, Right: values}
+	default:
+		for _, value := range values {
+			equal := &sqlparser.ComparisonExpr{Operator: sqlparser.EqualStr, Left: r.column, Right: value}
+			if expr == nil {
+				expr = equal
+			} else {
+				expr = &sqlparser.OrExpr{Left: expr, Right: equal}
+			}
+		}
+		if _, ok := filter.(*sqlparser.ParenExpr); ok {
+			expr = &sqlparser.ParenExpr{Expr: expr}
+		}
+	}
+	return &sqlparser.Where{Type: where.Type, Expr: replaceExpr(where.Expr, r.filter, expr)}
+}
+
+// replaceExpr returns the copy of the AND-ed expression with the filter replaced.
+func replaceExpr(expr sqlparser.Expr, filter sqlparser.Expr, with sqlparser.Expr) sqlparser.Expr {
+	if expr == filter {
+		return with
+	}
+	if and, ok := expr.(*sqlparser.AndExpr); ok {
+		return &sqlparser.AndExpr{
+			Left:  replaceExpr(and.Left, filter, with),
+			Right: replaceExpr(and.Right, filter, with),
+		}
+	}
+	return expr
+}
+
 // getDMLRouting used to get the routing from the where clause.
-func getDMLRouting(database, table, shardkey string, where *sqlparser.Where, router *router.Router) ([]router.Segment, error) {
-	if shardkey != "" && where != nil {
+func getDMLRouting(database, table string, shardkeys []string, where *sqlparser.Where, router *router.Router) ([]router.Segment, error) {
+	routing, err := getRouting(database, table, shardkeys, where, router)
+	if err != nil {
+		return nil, err
+	}
+	return routing.segments, nil
+}
+
+// getRouting used to get the routing from the where clause.
+// The equality on the shard key routes to the exact partition, the IN list or
+// OR-ed equalities route to the union of the matching partitions, and the
+// comparisons(>, >=, <, <=, BETWEEN) narrow the lookup to an interval.
+// The composite shard key is pruned only when all the key columns are bound by equality.
+func getRouting(database, table string, shardkeys []string, where *sqlparser.Where, router *router.Router) (*dmlRouting, error) {
+	var err error
+	routing := &dmlRouting{}
+
+	if len(shardkeys) > 1 && where != nil {
+		routing.segments, err = getCompositeRouting(database, table, shardkeys, where, router)
+		return routing, err
+	}
+	if len(shardkeys) == 1 && where != nil {
+		var start, end *sqlparser.SQLVal
+		var filter sqlparser.Expr
+		var values sqlparser.ValTuple
+
+		shardkey := shardkeys[0]
 		filters := splitAndExpression(nil, where.Expr)
-		for _, filter := range filters {
-			comparison, ok := filter.(*sqlparser.ComparisonExpr)
+		for _, f := range filters {
+			switch f := f.(type) {
+			case *sqlparser.ComparisonExpr:
+				if !nameMatch(f.Left, table, shardkey) {
+					continue
+				}
+				if f.Operator == sqlparser.InStr {
+					if vals, ok := inValues(f); ok && filter == nil {
+						filter, values = f, vals
+						routing.column = f.Left.(*sqlparser.ColName)
+					}
+					continue
+				}
+				sqlval, ok := f.Right.(*sqlparser.SQLVal)
+				if !ok {
+					continue
+				}
+				switch f.Operator {
+				case sqlparser.EqualStr:
+					routing.segments, err = router.Lookup(database, table, sqlval, sqlval)
+					return &dmlRouting{segments: routing.segments}, err
+				case sqlparser.GreaterThanStr, sqlparser.GreaterEqualStr:
+					start = sqlval
+				case sqlparser.LessThanStr, sqlparser.LessEqualStr:
+					end = sqlval
+				}
+			case *sqlparser.RangeCond:
+				if f.Operator != sqlparser.BetweenStr || !nameMatch(f.Left, table, shardkey) {
+					continue
+				}
+				from, ok := f.From.(*sqlparser.SQLVal)
+				if !ok {
+					continue
+				}
+				to, ok := f.To.(*sqlparser.SQLVal)
+				if !ok {
+					continue
+				}
+				start, end = from, to
+			case *sqlparser.OrExpr, *sqlparser.ParenExpr:
+				if filter != nil {
+					continue
+				}
+				if column, vals, ok := orValues(f, table, shardkey); ok {
+					filter, values = f, vals
+					routing.column = column
+				}
+			}
+		}
+
+		// The IN/OR filter routes to the partitions which own the values.
+		if filter != nil {
+			return getValuesRouting(database, table, routing, filter, values, router)
+		}
+
+		// The bounds with different types can't be compared, we lookup all the partitions.
+		if start != nil && end != nil && start.Type != end.Type {
+			start, end = nil, nil
+		}
+		routing.segments, err = router.Lookup(database, table, start, end)
+		return routing, err
+	}
+	routing.segments, err = router.Lookup(database, table, nil, nil)
+	return routing, err
+}
+
+// getValuesRouting used to distribute the values of the IN/OR filter to the partitions,
+// the segments are in the order of the partitions.
+func getValuesRouting(database, table string, routing *dmlRouting, filter sqlparser.Expr, values sqlparser.ValTuple, router *router.Router) (*dmlRouting, error) {
+	owns := make(map[string]sqlparser.ValTuple)
+	for _, value := range values {
+		sqlval := value.(*sqlparser.SQLVal)
+		segments, err := router.Lookup(database, table, sqlval, sqlval)
+		if err != nil {
+			return nil, err
+		}
+		for _, segment := range segments {
+			owns[segment.Table] = append(owns[segment.Table], value)
+		}
+	}
+
+	all, err := router.Lookup(database, table, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, segment := range all {
+		if _, ok := owns[segment.Table]; ok {
+			routing.segments = append(routing.segments, segment)
+		}
+	}
+	routing.filter = filter
+	routing.owns = owns
+	return routing, nil
+}
+
+// inValues returns the values of the 'shardkey IN (...)' filter, all the values must be constant.
+func inValues(filter *sqlparser.ComparisonExpr) (sqlparser.ValTuple, bool) {
+	tuple, ok := filter.Right.(sqlparser.ValTuple)
+	if !ok || len(tuple) == 0 {
+		return nil, false
+	}
+	for _, value := range tuple {
+		if _, ok := value.(*sqlparser.SQLVal); !ok {
+			return nil, false
+		}
+	}
+	return tuple, true
+}
+
+// orValues returns the values of the OR-ed equalities(or IN lists) on the shard key,
+// such as 'id = 1 or id = 7 or id in (8, 9)'.
+func orValues(expr sqlparser.Expr, table, shardkey string) (*sqlparser.ColName, sqlparser.ValTuple, bool) {
+	var column *sqlparser.ColName
+	var values sqlparser.ValTuple
+
+	for _, leaf := range splitOrExpression(nil, expr) {
+		comparison, ok := leaf.(*sqlparser.ComparisonExpr)
+		if !ok || !nameMatch(comparison.Left, table, shardkey) {
+			return nil, nil, false
+		}
+		switch comparison.Operator {
+		case sqlparser.EqualStr:
+			sqlval, ok := comparison.Right.(*sqlparser.SQLVal)
+			if !ok {
+				return nil, nil, false
+			}
+			values = append(values, sqlval)
+		case sqlparser.InStr:
+			vals, ok := inValues(comparison)
 			if !ok {
-				continue
+				return nil, nil, false
 			}
+			values = append(values, vals...)
+		default:
+			return nil, nil, false
+		}
+		if column == nil {
+			column = comparison.Left.(*sqlparser.ColName)
+		}
+	}
+	return column, values, column != nil
+}
 
-			// Only deal with Equal statement.
-			switch comparison.Operator {
-			case sqlparser.EqualStr:
-				if nameMatch(comparison.Left, table, shardkey) {
-					sqlval, ok := comparison.Right.(*sqlparser.SQLVal)
-					if ok {
-						return router.Lookup(database, table, sqlval, sqlval)
-					}
-				}
+// getCompositeRouting used to get the routing of the composite shard key from the where clause,
+// returns all the partitions if any of the key columns isn't bound by equality.
+func getCompositeRouting(database, table string, shardkeys []string, where *sqlparser.Where, router *router.Router) ([]router.Segment, error) {
+	keys := make([]*sqlparser.SQLVal, len(shardkeys))
+	filters := splitAndExpression(nil, where.Expr)
+	for _, filter := range filters {
+		comparison, ok := filter.(*sqlparser.ComparisonExpr)
+		if !ok || comparison.Operator != sqlparser.EqualStr {
+			continue
+		}
+		sqlval, ok := comparison.Right.(*sqlparser.SQLVal)
+		if !ok {
+			continue
+		}
+		for i, shardkey := range shardkeys {
+			if nameMatch(comparison.Left, table, shardkey) {
+				keys[i] = sqlval
 			}
 		}
 	}
-	return router.Lookup(database, table, nil, nil)
+
+	for _, key := range keys {
+		if key == nil {
+			return router.Lookup(database, table, nil, nil)
+		}
+	}
+	return router.LookupTuple(database, table, keys)
 }
 
 func hasSubquery(node sqlparser.SQLNode) bool {
@@ -61,9 +295,19 @@ func nameMatch(node sqlparser.Expr, table, shardkey string) bool {
 
 // isShardKeyChanging returns true if any of the update
 // expressions modify a shardkey column.
-func isShardKeyChanging(exprs sqlparser.UpdateExprs, shardkey string) bool {
+func isShardKeyChanging(exprs sqlparser.UpdateExprs, shardkeys []string) bool {
 	for _, assignment := range exprs {
-		if shardkey == assignment.Name.Name.String() {
+		if isShardKey(assignment.Name.Name.String(), shardkeys) {
+			return true
+		}
+	}
+	return false
+}
+
+// isShardKey returns true if the column is one of the shardkey columns.
+func isShardKey(column string, shardkeys []string) bool {
+	for _, shardkey := range shardkeys {
+		if shardkey == column {
 			return true
 		}
 	}
@@ -84,6 +328,19 @@ func splitAndExpression(filters []sqlparser.Expr, node sqlparser.Expr) []sqlpars
 	return append(filters, node)
 }
 
+// splitOrExpression breaks up the Expr into OR-separated conditions,
+// the parentheses are removed.
+func splitOrExpression(filters []sqlparser.Expr, node sqlparser.Expr) []sqlparser.Expr {
+	switch node := node.(type) {
+	case *sqlparser.OrExpr:
+		filters = splitOrExpression(filters, node.Left)
+		return splitOrExpression(filters, node.Right)
+	case *sqlparser.ParenExpr:
+		return splitOrExpression(filters, node.Expr)
+	}
+	return append(filters, node)
+}
+
 // checkComparison checks the WHERE or JOIN-ON clause contains non-sqlval comparison(t1.id=t2.id).
 func checkComparison(expr sqlparser.Expr) error {
 	filters := splitAndExpression(nil, expr)
@@ -106,6 +363,9 @@ type selectTuple struct {
 	column   string
 	fn       string
 	distinct bool
+	expr     sqlparser.Expr
+	// hidden is true if the field is appended to the select list by the planner.
+	hidden bool
 }
 
 // parserSelectExpr parses the AliasedExpr to {as, column, func} tuple.
@@ -136,8 +396,16 @@ func parserSelectExpr(expr *sqlparser.AliasedExpr) (*selectTuple, error) {
 		}
 	case *sqlparser.FuncExpr:
 		ex := expr.Expr.(*sqlparser.FuncExpr)
+		if !isAggregateFunc(ex) && containsAggregate(ex) {
+			// The expression over the aggregators, such as 'ifnull(sum(a), 0)'.
+			colName1 = sqlparser.String(ex)
+			break
+		}
 		distinct = ex.Distinct
 		funcName = ex.Name.String()
+		if len(ex.Exprs) == 0 {
+			break
+		}
 		switch ex.Exprs[0].(type) {
 		case *sqlparser.AliasedExpr:
 			exx := ex.Exprs[0].(*sqlparser.AliasedExpr)
@@ -146,18 +414,32 @@ func parserSelectExpr(expr *sqlparser.AliasedExpr) (*selectTuple, error) {
 				return nil, err
 			}
 			colName = tuple.column
+			if colName == "" {
+				colName = sqlparser.String(exx.Expr)
+			}
 		case *sqlparser.StarExpr:
 			colName = "*"
 		}
+	case *sqlparser.GroupConcatExpr:
+		ex := expr.Expr.(*sqlparser.GroupConcatExpr)
+		distinct = ex.Distinct != ""
+		funcName = "group_concat"
+		colName1 = sqlparser.String(ex)
+	default:
+		colName1 = sqlparser.String(expr.Expr)
 	}
 	if field == "" {
-		if funcName != "" {
+		if funcName == "group_concat" {
+			field = colName1
+		} else if funcName != "" && distinct {
+			field = fmt.Sprintf("%s(distinct %s)", funcName, colName)
+		} else if funcName != "" {
 			field = fmt.Sprintf("%s(%s)", funcName, colName)
 		} else {
 			field = colName1
 		}
 	}
-	return &selectTuple{field, colName, funcName, distinct}, nil
+	return &selectTuple{field, colName, funcName, distinct, expr.Expr, false}, nil
 }
 
 func parserSelectExprs(exprs sqlparser.SelectExprs) ([]selectTuple, error) {
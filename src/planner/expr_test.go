@@ -42,7 +42,173 @@ func TestGetDMLRouting(t *testing.T) {
 		node, err := sqlparser.Parse(query)
 		n := node.(*sqlparser.Select)
 		assert.Nil(t, err)
-		got, err := getDMLRouting(database, "B", "id", n.Where, route)
+		got, err := getDMLRouting(database, "B", []string{"id"}, n.Where, route)
 		assert.Equal(t, want[i], len(got))
 	}
 }
+
+func TestGetDMLRoutingRange(t *testing.T) {
+	querys := []string{
+		"select * from R where id = 10",
+		"select * from R where id >= 100 and id < 150",
+		"select * from R where id between 150 and 250",
+		"select * from R where id > 50",
+		"select * from R where id <= 100",
+		"select * from R where name = 'x'",
+	}
+	want := []int{
+		1,
+		1,
+		2,
+		3,
+		2,
+		3,
+	}
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableRConfig())
+	assert.Nil(t, err)
+
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		n := node.(*sqlparser.Select)
+		got, err := getDMLRouting(database, "R", []string{"id"}, n.Where, route)
+		assert.Nil(t, err)
+		assert.Equal(t, want[i], len(got))
+	}
+}
+
+func TestGetDMLRoutingList(t *testing.T) {
+	querys := []string{
+		"select * from L where id = 3",
+		"select * from L where id = 100",
+		"select * from L where id > 3",
+		"select * from L where id between 2 and 2",
+	}
+	want := []int{
+		1,
+		1,
+		3,
+		1,
+	}
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableLConfig())
+	assert.Nil(t, err)
+
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		n := node.(*sqlparser.Select)
+		got, err := getDMLRouting(database, "L", []string{"id"}, n.Where, route)
+		assert.Nil(t, err)
+		assert.Equal(t, want[i], len(got))
+	}
+}
+
+func TestGetDMLRoutingInOr(t *testing.T) {
+	querys := []string{
+		"select * from A where id in (0, 1, 39)",
+		"select * from A where id = 0 or id = 1 or A.id in (39)",
+		"select * from A where b > 1 and (id = 39 or id = 0) and c = 2",
+		"select * from A where id in (1, 2, 3)",
+		"select * from A where id = 0 and id in (1, 2)",
+		"select * from A where id in (1, b)",
+		"select * from A where id = 1 or b = 2",
+		"select * from A where id not in (0, 1)",
+	}
+	wants := [][]string{
+		{"select * from A where id in (0, 39)", "select * from A where id in (1)"},
+		{"select * from A where id = 0 or id = 39", "select * from A where id = 1"},
+		{"select * from A where b > 1 and (id = 39 or id = 0) and c = 2"},
+		{"select * from A where id in (1, 2, 3)"},
+		{"select * from A where id = 0 and id in (1, 2)"},
+		nil,
+		nil,
+		nil,
+	}
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableMConfig())
+	assert.Nil(t, err)
+
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		n := node.(*sqlparser.Select)
+		routing, err := getRouting(database, "A", []string{"id"}, n.Where, route)
+		assert.Nil(t, err)
+
+		// Not pruned.
+		if wants[i] == nil {
+			assert.Equal(t, 6, len(routing.segments))
+			continue
+		}
+		assert.Equal(t, len(wants[i]), len(routing.segments))
+		for j, segment := range routing.segments {
+			got := &sqlparser.Select{SelectExprs: n.SelectExprs, From: n.From, Where: routing.rewriteWhere(n.Where, segment)}
+			assert.Equal(t, wants[i][j], sqlparser.String(got))
+		}
+	}
+}
+
+func TestGetDMLRoutingComposite(t *testing.T) {
+	querys := []string{
+		"select * from C where tenant_id = 1 and order_id = 2",
+		"select * from C where C.order_id = 2 and C.tenant_id = 1 and b > 10",
+		"select * from C where tenant_id = 1",
+		"select * from C where tenant_id = 1 and order_id > 2",
+		"select * from C where tenant_id = 1 or order_id = 2",
+		"select * from C",
+	}
+	want := []int{
+		1,
+		1,
+		2,
+		2,
+		2,
+		2,
+	}
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableCConfig())
+	assert.Nil(t, err)
+
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		n := node.(*sqlparser.Select)
+		got, err := getDMLRouting(database, "C", []string{"tenant_id", "order_id"}, n.Where, route)
+		assert.Nil(t, err)
+		assert.Equal(t, want[i], len(got))
+	}
+
+	// The routing is same as the insert.
+	{
+		keys := []*sqlparser.SQLVal{sqlparser.NewIntVal([]byte("1")), sqlparser.NewIntVal([]byte("2"))}
+		want, err := route.LookupTuple(database, "C", keys)
+		assert.Nil(t, err)
+		node, err := sqlparser.Parse("select * from C where order_id = 2 and tenant_id = 1")
+		assert.Nil(t, err)
+		got, err := getDMLRouting(database, "C", []string{"tenant_id", "order_id"}, node.(*sqlparser.Select).Where, route)
+		assert.Nil(t, err)
+		assert.Equal(t, want, got)
+	}
+}
@@ -10,14 +10,20 @@ package planner
 
 import (
 	"encoding/json"
+	"math"
 	"sort"
+	"strconv"
+	"strings"
 
 	"router"
 	"xcontext"
 
 	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqldb"
 	"github.com/xelabs/go-mysqlstack/sqlparser"
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/hack"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
 
@@ -49,6 +55,21 @@ type InsertPlan struct {
 
 	// query and backend tuple
 	Querys []xcontext.QueryTuple
+
+	// Select is the plan of the rows of INSERT ... SELECT, nil if the rows are VALUES.
+	Select Plan
+
+	// Move is the move of the rows if the ON DUPLICATE KEY UPDATE changes the shard key, nil if not.
+	Move *ShardKeyMove
+
+	// The target table and the index of every shard key column in the columns,
+	// shardIdxs is nil if the table is global or single.
+	schema    string
+	table     string
+	shardIdxs []int
+
+	// children is the select plan.
+	children *PlanTree
 }
 
 // NewInsertPlan used to create InsertPlan
@@ -65,6 +86,7 @@ func NewInsertPlan(log *xlog.Log, database string, query string, node *sqlparser
 }
 
 // Build used to build distributed querys.
+// The rows of INSERT ... SELECT are routed at execution time, only the select plan is built.
 func (p *InsertPlan) Build() error {
 	node := p.node
 
@@ -75,30 +97,255 @@ func (p *InsertPlan) Build() error {
 	}
 	table := node.Table.Name.String()
 
-	// Get the shard key.
-	shardKey, err := p.router.ShardKey(database, table)
+	// Get the shard key columns.
+	shardKeys, err := p.router.ShardKeys(database, table)
 	if err != nil {
 		return err
 	}
 
-	// Check the OnDup.
-	if len(node.OnDup) > 0 {
-		// analyze shardkey changing.
-		if isShardKeyChanging(sqlparser.UpdateExprs(node.OnDup), shardKey) {
+	// Check the OnDup, the rows are moved if the shardkey is changing.
+	moving := len(node.OnDup) > 0 && isShardKeyChanging(sqlparser.UpdateExprs(node.OnDup), shardKeys)
+	p.schema, p.table = database, table
+
+	// The global table writes all the rows to every backend, the single table writes to its backend.
+	_, single := p.router.SingleBackend(database, table)
+	if !single && !p.router.IsGlobal(database, table) {
+		// Find the index of every shard key column.
+		p.shardIdxs = make([]int, 0, len(shardKeys))
+		for _, shardKey := range shardKeys {
+			idx := -1
+			for i, column := range node.Columns {
+				if column.String() == shardKey {
+					idx = i
+					break
+				}
+			}
+			if idx == -1 {
+				return errors.Errorf("unsupported: shardkey.column[%v].missing", shardKey)
+			}
+			p.shardIdxs = append(p.shardIdxs, idx)
+		}
+	}
+
+	switch rows := node.Rows.(type) {
+	case sqlparser.Values:
+		if moving {
+			return p.buildMove(rows, shardKeys)
+		}
+		querys, err := p.rowsQuerys(rows)
+		if err != nil {
+			return err
+		}
+		p.Querys = append(p.Querys, querys...)
+	case sqlparser.SelectStatement:
+		if moving {
 			return errors.New("unsupported: cannot.update.shard.key")
 		}
+		if p.Select, err = selectStatementPlan(p.log, p.database, rows, p.router); err != nil {
+			return err
+		}
+		if err := p.Select.Build(); err != nil {
+			return err
+		}
+		p.children = NewPlanTree()
+		p.children.Add(p.Select)
+	default:
+		return errors.Errorf("unsupported: rows.can.not.be.subquery[%T]", node.Rows)
 	}
+	return nil
+}
+
+// buildMove builds the move of the rows whose ON DUPLICATE KEY UPDATE changes the shard key.
+// Every row is a step which looks up the duplicate row by the primary or unique key of the table,
+// which may be on any partition if the unique key doesn't contain the shard key.
+// The VALUES(col) in the assignments are resolved to the values of the row.
+func (p *InsertPlan) buildMove(rows sqlparser.Values, shardKeys []string) error {
+	node := p.node
+	exprs := sqlparser.UpdateExprs(node.OnDup)
 
-	// Find the shard key index.
-	idx := -1
-	for i, column := range node.Columns {
-		if column.String() == shardKey {
-			idx = i
-			break
+	// The rows sharing the shard key can't be told apart without the unique key.
+	_, uniqueKeys := p.router.UniqueKey(p.schema, p.table)
+	if len(uniqueKeys) == 0 {
+		return errors.Errorf("unsupported: table[%s].without.primary.or.unique.key.can.not.update.shard.key", p.table)
+	}
+	uniqueIdxs := make([]int, 0, len(uniqueKeys))
+	for _, uniqueKey := range uniqueKeys {
+		idx := -1
+		for i, column := range node.Columns {
+			if strings.EqualFold(column.String(), uniqueKey) {
+				idx = i
+				break
+			}
+		}
+		if idx == -1 {
+			return errors.Errorf("unsupported: unique.key.column[%v].missing", uniqueKey)
 		}
+		uniqueIdxs = append(uniqueIdxs, idx)
 	}
-	if idx == -1 {
-		return errors.Errorf("unsupported: shardkey.column[%v].missing", shardKey)
+
+	var values []*sqlparser.ValuesFuncExpr
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+		if v, ok := node.(*sqlparser.ValuesFuncExpr); ok {
+			values = append(values, v)
+		}
+		return true, nil
+	}, exprs)
+	idxs := make([]int, 0, len(values))
+	for _, v := range values {
+		idx := -1
+		for i, column := range node.Columns {
+			if column.Equal(v.Name) {
+				idx = i
+				break
+			}
+		}
+		if idx == -1 {
+			return errors.Errorf("unsupported: values(%s).column.not.inserted", v.Name.String())
+		}
+		idxs = append(idxs, idx)
+	}
+	defer func() {
+		for _, v := range values {
+			v.Resolved = nil
+		}
+	}()
+
+	p.Move = newShardKeyMove(p.log, p.router, node.Comments, p.schema, p.table, shardKeys, exprs)
+	p.Move.Columns = node.Columns
+	for _, row := range rows {
+		if len(row) != len(node.Columns) {
+			return errors.New("Column count doesn't match value count at row 1")
+		}
+		for _, idx := range p.shardIdxs {
+			if _, ok := row[idx].(*sqlparser.SQLVal); !ok {
+				return errors.Errorf("unsupported: shardkey[%v].type.canot.be[%T]", node.Columns[idx].String(), row[idx])
+			}
+		}
+		var cond sqlparser.Expr
+		for _, idx := range uniqueIdxs {
+			uniqueVal, ok := row[idx].(*sqlparser.SQLVal)
+			if !ok {
+				return errors.Errorf("unsupported: unique.key[%v].type.canot.be[%T]", node.Columns[idx].String(), row[idx])
+			}
+			expr := &sqlparser.ComparisonExpr{Operator: sqlparser.EqualStr, Left: &sqlparser.ColName{Name: node.Columns[idx]}, Right: uniqueVal}
+			if cond == nil {
+				cond = expr
+			} else {
+				cond = &sqlparser.AndExpr{Left: cond, Right: expr}
+			}
+		}
+		for i, v := range values {
+			v.Resolved = row[idxs[i]]
+		}
+		if err := p.Move.addStep(sqlparser.NewWhere(sqlparser.WhereStr, cond), row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ShardKeyQuery returns the query to fetch the fields of the shard key columns of the target table,
+// false if the rows aren't routed by the shard key.
+func (p *InsertPlan) ShardKeyQuery() (xcontext.QueryTuple, bool, error) {
+	if p.shardIdxs == nil {
+		return xcontext.QueryTuple{}, false, nil
+	}
+	segments, err := p.router.Lookup(p.schema, p.table, nil, nil)
+	if err != nil {
+		return xcontext.QueryTuple{}, false, err
+	}
+	buf := sqlparser.NewTrackedBuffer(nil)
+	buf.WriteString("select ")
+	for i, idx := range p.shardIdxs {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.Myprintf("%v", p.node.Columns[idx])
+	}
+	buf.Myprintf(" from %s.%s limit 0", p.schema, segments[0].Table)
+	return xcontext.QueryTuple{
+		Query:   buf.String(),
+		Backend: segments[0].Backend,
+		Range:   segments[0].Range.String(),
+	}, true, nil
+}
+
+// RowsQuerys returns the insert querys of the selected rows, one query per segment.
+// The shard key values are converted to the types of the shard key fields fetched by the ShardKeyQuery,
+// so the rows are routed by the values stored in the target table.
+func (p *InsertPlan) RowsQuerys(rows [][]sqltypes.Value, keyFields []*querypb.Field) ([]xcontext.QueryTuple, error) {
+	if p.shardIdxs != nil && len(keyFields) != len(p.shardIdxs) {
+		return nil, errors.Errorf("unsupported: shardkey.fields.count[%d].mismatch", len(keyFields))
+	}
+	values := make(sqlparser.Values, 0, len(rows))
+	for _, row := range rows {
+		tuple := make(sqlparser.ValTuple, 0, len(row))
+		for _, v := range row {
+			tuple = append(tuple, valueExpr(v))
+		}
+		for i, idx := range p.shardIdxs {
+			if idx >= len(row) {
+				break
+			}
+			expr, err := castValueExpr(row[idx], keyFields[i], p.node.Columns[idx].String())
+			if err != nil {
+				return nil, err
+			}
+			tuple[idx] = expr
+		}
+		values = append(values, tuple)
+	}
+	return p.rowsQuerys(values)
+}
+
+// castValueExpr returns the literal of the value converted to the type of the field same as MySQL
+// stores it, the string is rounded to the integer or checked as the number.
+func castValueExpr(v sqltypes.Value, field *querypb.Field, column string) (sqlparser.Expr, error) {
+	typ := field.Type
+	switch {
+	case v.IsNull():
+		return &sqlparser.NullVal{}, nil
+	case sqltypes.IsIntegral(typ):
+		if v.IsIntegral() {
+			return sqlparser.NewIntVal(v.Raw()), nil
+		}
+		str := strings.TrimSpace(string(v.Raw()))
+		if i, err := strconv.ParseInt(str, 10, 64); err == nil {
+			return sqlparser.NewIntVal([]byte(strconv.FormatInt(i, 10))), nil
+		}
+		f, err := strconv.ParseFloat(str, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, sqldb.NewSQLError1(1366, "HY000", "Incorrect integer value: '%s' for column '%s'", string(v.Raw()), column)
+		}
+		f = math.Round(f)
+		if f < math.MinInt64 || f >= math.MaxInt64 {
+			return nil, sqldb.NewSQLError1(1264, "22003", "Out of range value for column '%s'", column)
+		}
+		return sqlparser.NewIntVal([]byte(strconv.FormatInt(int64(f), 10))), nil
+	case sqltypes.IsFloat(typ) || typ == querypb.Type_DECIMAL:
+		if v.IsIntegral() || v.IsFloat() || v.Type() == querypb.Type_DECIMAL {
+			return sqlparser.NewFloatVal(v.Raw()), nil
+		}
+		str := strings.TrimSpace(string(v.Raw()))
+		if _, err := strconv.ParseFloat(str, 64); err != nil {
+			return nil, sqldb.NewSQLError1(1366, "HY000", "Incorrect decimal value: '%s' for column '%s'", string(v.Raw()), column)
+		}
+		return sqlparser.NewFloatVal([]byte(str)), nil
+	}
+	return sqlparser.NewStrVal(v.Raw()), nil
+}
+
+// Columns returns the number of the insert columns, 0 if the columns aren't specified.
+func (p *InsertPlan) Columns() int {
+	return len(p.node.Columns)
+}
+
+// rowsQuerys routes the rows by the shard key, returns the insert querys.
+func (p *InsertPlan) rowsQuerys(rows sqlparser.Values) ([]xcontext.QueryTuple, error) {
+	node := p.node
+	database, table := p.schema, p.table
+	if p.shardIdxs == nil {
+		return p.unshardedQuerys(rows)
 	}
 
 	// Rebuild distributed querys.
@@ -109,23 +356,22 @@ func (p *InsertPlan) Build() error {
 		vals    sqlparser.Values
 	}
 	vals := make(map[string]*valTuple)
-	rows, ok := node.Rows.(sqlparser.Values)
-	if !ok {
-		return errors.Errorf("unsupported: rows.can.not.be.subquery[%T]", node.Rows)
-	}
-
 	for _, row := range rows {
-		if idx >= len(row) {
-			return errors.Errorf("unsupported: shardkey[%v].out.of.index:[%v]", shardKey, idx)
-		}
-		shardVal, ok := row[idx].(*sqlparser.SQLVal)
-		if !ok {
-			return errors.Errorf("unsupported: shardkey[%v].type.canot.be[%T]", shardKey, row[idx])
+		shardVals := make([]*sqlparser.SQLVal, 0, len(p.shardIdxs))
+		for _, idx := range p.shardIdxs {
+			if idx >= len(row) {
+				return nil, errors.Errorf("unsupported: shardkey[%v].out.of.index:[%v]", node.Columns[idx].String(), idx)
+			}
+			shardVal, ok := row[idx].(*sqlparser.SQLVal)
+			if !ok {
+				return nil, errors.Errorf("unsupported: shardkey[%v].type.canot.be[%T]", node.Columns[idx].String(), row[idx])
+			}
+			shardVals = append(shardVals, shardVal)
 		}
 
-		segments, err := p.router.Lookup(database, table, shardVal, shardVal)
+		segments, err := p.router.LookupTuple(database, table, shardVals)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		rewrittenTable := segments[0].Table
 		backend := segments[0].Backend
@@ -144,6 +390,7 @@ func (p *InsertPlan) Build() error {
 	}
 
 	// Rebuild querys with router info.
+	querys := make([]xcontext.QueryTuple, 0, len(vals))
 	for rewritten, v := range vals {
 		buf := sqlparser.NewTrackedBuffer(nil)
 		buf.Myprintf("%s %v%sinto %s.%s%v %v%v", node.Action, node.Comments, node.Ignore, database, rewritten, node.Columns, v.vals, node.OnDup)
@@ -152,9 +399,32 @@ func (p *InsertPlan) Build() error {
 			Backend: v.backend,
 			Range:   v.rangi,
 		}
-		p.Querys = append(p.Querys, tuple)
+		querys = append(querys, tuple)
 	}
-	return nil
+	return querys, nil
+}
+
+// unshardedQuerys used to build the querys for the global or single table, one query per segment.
+func (p *InsertPlan) unshardedQuerys(rows sqlparser.Values) ([]xcontext.QueryTuple, error) {
+	node := p.node
+	database, table := p.schema, p.table
+
+	segments, err := p.router.Lookup(database, table, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	querys := make([]xcontext.QueryTuple, 0, len(segments))
+	for _, segment := range segments {
+		buf := sqlparser.NewTrackedBuffer(nil)
+		buf.Myprintf("%s %v%sinto %s.%s%v %v%v", node.Action, node.Comments, node.Ignore, database, segment.Table, node.Columns, rows, node.OnDup)
+		tuple := xcontext.QueryTuple{
+			Query:   buf.String(),
+			Backend: segment.Backend,
+			Range:   segment.Range.String(),
+		}
+		querys = append(querys, tuple)
+	}
+	return querys, nil
 }
 
 // Type returns the type of the plan.
@@ -167,6 +437,8 @@ func (p *InsertPlan) JSON() string {
 	type explain struct {
 		RawQuery   string                `json:",omitempty"`
 		Partitions []xcontext.QueryTuple `json:",omitempty"`
+		Select     json.RawMessage       `json:",omitempty"`
+		Move       json.RawMessage       `json:",omitempty"`
 	}
 
 	var parts []xcontext.QueryTuple
@@ -177,6 +449,12 @@ func (p *InsertPlan) JSON() string {
 		RawQuery:   p.RawQuery,
 		Partitions: parts,
 	}
+	if p.Select != nil {
+		exp.Select = json.RawMessage(p.Select.JSON())
+	}
+	if p.Move != nil {
+		exp.Move = p.Move.JSON()
+	}
 	bout, err := json.MarshalIndent(exp, "", "\t")
 	if err != nil {
 		return err.Error()
@@ -184,9 +462,9 @@ func (p *InsertPlan) JSON() string {
 	return hack.String(bout)
 }
 
-// Children returns the children of the plan.
+// Children returns the select plan of INSERT ... SELECT, nil if the rows are VALUES.
 func (p *InsertPlan) Children() *PlanTree {
-	return nil
+	return p.children
 }
 
 // Size returns the memory size.
@@ -195,5 +473,11 @@ func (p *InsertPlan) Size() int {
 	for _, q := range p.Querys {
 		size += len(q.Query)
 	}
+	if p.Select != nil {
+		size += p.Select.Size()
+	}
+	if p.Move != nil {
+		size += p.Move.Size()
+	}
 	return size
 }
@@ -17,6 +17,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/sqlparser"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
 
@@ -101,9 +103,14 @@ func TestInsertUnsupportedPlan(t *testing.T) {
 		"insert into sbtest.A(b, c, id) values(1,2)",
 		"insert into sbtest.A(b, c, d) values(1,2, 3)",
 		"insert into sbtest.A select * from sbtest.B",
-		"insert into sbtest.A(b, c, id) values(1,2,3) on duplicate key update id=1",
+		"insert into sbtest.A(b, c, id) select b, c, id from sbtest.A on duplicate key update id=1",
 		"insert into sbtest.A(b, c, id) values(1, floor(3), floor(3))",
-		"insert into sbtest.A(b,c,id) select id,b,c from sbtest.A",
+		"insert into sbtest.A(b,c,id) select id,b,c from sbtest.C",
+		"insert into sbtest.A(b, c, id) values(1,2,3) on duplicate key update id=values(d)",
+		"insert into sbtest.A(b, c, id) values(1,2,now()) on duplicate key update id=1",
+		"insert into sbtest.A(b, id) values(1,2) on duplicate key update id=1",
+		"insert into sbtest.A(c, id) values(now(),2) on duplicate key update id=1",
+		"insert into sbtest.B(b, id) values(1,2) on duplicate key update id=1",
 	}
 
 	results := []string{
@@ -112,7 +119,12 @@ func TestInsertUnsupportedPlan(t *testing.T) {
 		"unsupported: shardkey.column[id].missing",
 		"unsupported: cannot.update.shard.key",
 		"unsupported: shardkey[id].type.canot.be[*sqlparser.FuncExpr]",
-		"unsupported: rows.can.not.be.subquery[*sqlparser.Select]",
+		"Table 'C' doesn't exist (errno 1146) (sqlstate 42S02)",
+		"unsupported: values(d).column.not.inserted",
+		"unsupported: shardkey[id].type.canot.be[*sqlparser.FuncExpr]",
+		"unsupported: unique.key.column[c].missing",
+		"unsupported: unique.key[c].type.canot.be[*sqlparser.FuncExpr]",
+		"unsupported: table[B].without.primary.or.unique.key.can.not.update.shard.key",
 	}
 
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
@@ -121,7 +133,9 @@ func TestInsertUnsupportedPlan(t *testing.T) {
 	route, cleanup := router.MockNewRouter(log)
 	defer cleanup()
 
-	err := route.AddForTest(database, router.MockTableMConfig())
+	err := route.AddForTest(database, router.MockTableMConfig(), router.MockTableBConfig())
+	assert.Nil(t, err)
+	err = route.SetUniqueKey(database, "A", "PRIMARY", "c")
 	assert.Nil(t, err)
 	for i, query := range querys {
 		node, err := sqlparser.Parse(query)
@@ -315,3 +329,237 @@ func TestInsertPlanError(t *testing.T) {
 		assert.NotNil(t, err)
 	}
 }
+
+func TestInsertGlobalPlan(t *testing.T) {
+	results := []string{
+		`{
+	"RawQuery": "insert into G(id, b) values(1,2),(3,4)",
+	"Partitions": [
+		{
+			"Query": "insert into sbtest.G(id, b) values (1, 2), (3, 4)",
+			"Backend": "backend1",
+			"Range": ""
+		},
+		{
+			"Query": "insert into sbtest.G(id, b) values (1, 2), (3, 4)",
+			"Backend": "backend2",
+			"Range": ""
+		}
+	]
+}`,
+	}
+	querys := []string{
+		"insert into G(id, b) values(1,2),(3,4)",
+	}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableGConfig())
+	assert.Nil(t, err)
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := NewInsertPlan(log, database, query, node.(*sqlparser.Insert), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+		want := results[i]
+		got := plan.JSON()
+		assert.Equal(t, want, got)
+	}
+}
+
+func TestInsertSinglePlan(t *testing.T) {
+	results := []string{
+		`{
+	"RawQuery": "insert into S(id, b) values(1,2),(3,4)",
+	"Partitions": [
+		{
+			"Query": "insert into sbtest.S(id, b) values (1, 2), (3, 4)",
+			"Backend": "backend1",
+			"Range": ""
+		}
+	]
+}`,
+	}
+	querys := []string{
+		"insert into S(id, b) values(1,2),(3,4)",
+	}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableSConfig())
+	assert.Nil(t, err)
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := NewInsertPlan(log, database, query, node.(*sqlparser.Insert), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+		want := results[i]
+		got := plan.JSON()
+		assert.Equal(t, want, got)
+	}
+}
+
+func TestInsertCompositeShardKeyPlan(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableCConfig())
+	assert.Nil(t, err)
+
+	// Every row goes to the segment of its (tenant_id, order_id).
+	{
+		query := "insert into C(b, order_id, tenant_id) values(1, 2, 1), (2, 2, 1)"
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := NewInsertPlan(log, database, query, node.(*sqlparser.Insert), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(plan.Querys))
+
+		keys := []*sqlparser.SQLVal{sqlparser.NewIntVal([]byte("1")), sqlparser.NewIntVal([]byte("2"))}
+		segments, err := route.LookupTuple(database, "C", keys)
+		assert.Nil(t, err)
+		want := "insert into sbtest." + segments[0].Table + "(b, order_id, tenant_id) values (1, 2, 1), (2, 2, 1)"
+		assert.Equal(t, want, plan.Querys[0].Query)
+	}
+
+	// Errors.
+	{
+		querys := []string{
+			"insert into C(b, tenant_id) values(1, 1)",
+			"insert into C(tenant_id, order_id) select tenant_id, order_id from C on duplicate key update order_id=3",
+			"insert into C(tenant_id, order_id) values(1, now())",
+		}
+		results := []string{
+			"unsupported: shardkey.column[order_id].missing",
+			"unsupported: cannot.update.shard.key",
+			"unsupported: shardkey[order_id].type.canot.be[*sqlparser.FuncExpr]",
+		}
+		for i, query := range querys {
+			node, err := sqlparser.Parse(query)
+			assert.Nil(t, err)
+			plan := NewInsertPlan(log, database, query, node.(*sqlparser.Insert), route)
+			err = plan.Build()
+			assert.Equal(t, results[i], err.Error())
+		}
+	}
+
+	// The duplicate row is looked up by all the primary key columns.
+	{
+		err := route.SetUniqueKey(database, "C", "PRIMARY", "tenant_id,order_id")
+		assert.Nil(t, err)
+		query := "insert into C(tenant_id, order_id) values(1, 2) on duplicate key update order_id=3"
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := NewInsertPlan(log, database, query, node.(*sqlparser.Insert), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(plan.Move.Steps))
+		assert.Equal(t, "delete from sbtest.C where tenant_id = 1 and order_id = 2", plan.Move.DeleteQuery(plan.Move.Steps[0]))
+	}
+}
+
+func TestInsertOnDupShardKeyPlan(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableMConfig())
+	assert.Nil(t, err)
+	err = route.SetUniqueKey(database, "A", "PRIMARY", "id")
+	assert.Nil(t, err)
+
+	query := "insert into A(id, b) values(1, 2), (1, 3) on duplicate key update id = values(id) + 10, b = b + values(b)"
+	node, err := sqlparser.Parse(query)
+	assert.Nil(t, err)
+	plan := NewInsertPlan(log, database, query, node.(*sqlparser.Insert), route)
+	err = plan.Build()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(plan.Querys))
+
+	// Every row is a step.
+	var got []string
+	for _, step := range plan.Move.Steps {
+		got = append(got, step.Selects[0].Query, step.Deletes[0].Query)
+	}
+	want := []string{
+		"select *, 1 + 10, b + 2 from sbtest.A6 where id = 1 for update",
+		"delete from sbtest.A6 where id = 1",
+		"select *, 1 + 10, b + 3 from sbtest.A6 where id = 1 for update",
+		"delete from sbtest.A6 where id = 1",
+	}
+	assert.Equal(t, want, got)
+
+	// The row is inserted if there's no duplicate.
+	querys, event, err := plan.Move.RowQuerys(plan.Move.Steps[1])
+	assert.Nil(t, err)
+	assert.Equal(t, "insert into sbtest.A6(id, b) values (1, 3)", querys[0].Query)
+	assert.Equal(t, "insert into sbtest.A(id, b) values (1, 3)", event)
+
+	// The VALUES() are restored.
+	assert.Equal(t, " on duplicate key update id = values(id) + 10, b = b + values(b)", sqlparser.String(node.(*sqlparser.Insert).OnDup))
+
+	// The primary key isn't the shard key, the duplicate row is looked up by the primary key on all the partitions.
+	{
+		err := route.SetUniqueKey(database, "A", "PRIMARY", "b")
+		assert.Nil(t, err)
+		query := "insert into A(id, b) values(1, 2) on duplicate key update id = 3"
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := NewInsertPlan(log, database, query, node.(*sqlparser.Insert), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(plan.Move.Steps))
+		step := plan.Move.Steps[0]
+		assert.Equal(t, 6, len(step.Selects))
+		assert.Equal(t, "select *, 3 from sbtest.A1 where b = 2 for update", step.Selects[0].Query)
+		assert.Equal(t, "delete from sbtest.A1 where b = 2", step.Deletes[0].Query)
+		assert.Equal(t, "delete from sbtest.A where b = 2", plan.Move.DeleteQuery(step))
+	}
+}
+
+func TestInsertPlanCastValueExpr(t *testing.T) {
+	tests := []struct {
+		v    sqltypes.Value
+		typ  querypb.Type
+		want string
+	}{
+		{sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(" 10")), querypb.Type_INT32, "10"},
+		{sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("10.5")), querypb.Type_INT64, "11"},
+		{sqltypes.MakeTrusted(querypb.Type_DECIMAL, []byte("-2.5")), querypb.Type_INT64, "-3"},
+		{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("10")), querypb.Type_VARCHAR, "'10'"},
+		{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("10")), querypb.Type_DECIMAL, "10"},
+		{sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("1.50")), querypb.Type_DECIMAL, "1.50"},
+		{sqltypes.NULL, querypb.Type_INT32, "null"},
+	}
+	for _, test := range tests {
+		expr, err := castValueExpr(test.v, &querypb.Field{Name: "id", Type: test.typ}, "id")
+		assert.Nil(t, err)
+		assert.Equal(t, test.want, sqlparser.String(expr))
+	}
+
+	// Errors.
+	{
+		_, err := castValueExpr(sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("abc")), &querypb.Field{Type: querypb.Type_INT32}, "id")
+		assert.Equal(t, "Incorrect integer value: 'abc' for column 'id' (errno 1366) (sqlstate HY000)", err.Error())
+		_, err = castValueExpr(sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("1e30")), &querypb.Field{Type: querypb.Type_INT64}, "id")
+		assert.Equal(t, "Out of range value for column 'id' (errno 1264) (sqlstate 22003)", err.Error())
+		_, err = castValueExpr(sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("x")), &querypb.Field{Type: querypb.Type_DECIMAL}, "id")
+		assert.Equal(t, "Incorrect decimal value: 'x' for column 'id' (errno 1366) (sqlstate HY000)", err.Error())
+	}
+}
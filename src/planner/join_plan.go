@@ -9,9 +9,15 @@
 package planner
 
 import (
-	"errors"
+	"encoding/json"
+	"strings"
 
+	"router"
+	"xcontext"
+
+	"github.com/pkg/errors"
 	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/hack"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
 
@@ -19,46 +25,593 @@ var (
 	_ Plan = &JoinPlan{}
 )
 
-// JoinPlan represents join plan.
+// JoinType type.
+type JoinType string
+
+const (
+	// InnerJoin enum.
+	InnerJoin JoinType = "INNER JOIN"
+
+	// LeftJoin enum.
+	LeftJoin JoinType = "LEFT JOIN"
+)
+
+// JoinStrategy type.
+type JoinStrategy string
+
+const (
+	// HashJoin enum, used when the join has equi-join keys.
+	HashJoin JoinStrategy = "HashJoin"
+
+	// NestedLoopJoin enum, used when the join has no equi-join keys.
+	NestedLoopJoin JoinStrategy = "NestedLoopJoin"
+)
+
+// JoinTable tuple.
+// The table whose rows are fetched from the shards and joined in the proxy.
+type JoinTable struct {
+	// Name is the alias(or the table name) which qualifies the columns.
+	Name string
+
+	// Plan fetches the rows of the table.
+	Plan *SelectPlan
+}
+
+// Join tuple.
+// Joins the rows of the tables before Right(the left side) with the rows of the table Right.
+type Join struct {
+	Type     JoinType
+	Strategy JoinStrategy
+
+	// Right is the index of the right table in the JoinPlan.Tables.
+	Right int
+
+	// LeftKeys and RightKeys are the equi-join keys, LeftKeys[i] = RightKeys[i].
+	LeftKeys  []*sqlparser.ColName
+	RightKeys []*sqlparser.ColName
+
+	// On are the other join conditions, the left rows without any match
+	// are padded with NULLs if it's LEFT JOIN.
+	On []sqlparser.Expr
+
+	// Filters are applied to the joined rows.
+	Filters []sqlparser.Expr
+}
+
+// JoinPlan represents the cross-shard join plan.
+// The filters which only reference one table are pushed down to the shards,
+// the rows of every table are fetched by its select plan and joined in the proxy.
 type JoinPlan struct {
 	log *xlog.Log
 
+	// router
+	router *router.Router
+
+	// select ast
 	node *sqlparser.Select
 
+	// database
+	database string
+
+	// raw query
+	RawQuery string
+
 	// type
 	typ PlanType
+
+	// Tables in the join order.
+	Tables []*JoinTable
+
+	// Joins in the join order, Joins[i] joins the table Tables[i+1].
+	Joins []*Join
+
+	// Project is the select list evaluated on the joined rows.
+	Project sqlparser.SelectExprs
+
+	// OrderBy is the order by clause, the aliases of the select list are resolved.
+	OrderBy sqlparser.OrderBy
+
+	// Limit is the limit clause, nil if none.
+	Limit *LimitPlan
+
+	// children are the select plans of the tables.
+	children *PlanTree
 }
 
 // NewJoinPlan used to create JoinPlan.
-func NewJoinPlan(log *xlog.Log, node *sqlparser.Select) *JoinPlan {
+func NewJoinPlan(log *xlog.Log, database string, query string, node *sqlparser.Select, router *router.Router) *JoinPlan {
 	return &JoinPlan{
-		log:  log,
-		node: node,
-		typ:  PlanTypeJoin,
+		log:      log,
+		node:     node,
+		router:   router,
+		database: database,
+		RawQuery: query,
+		typ:      PlanTypeJoin,
+		children: NewPlanTree(),
 	}
 }
 
-// analyze used to check the join is at the support level.
-// unsupported join.
-func (p *JoinPlan) analyze() error {
+// joinSpec is the join which the table is joined by.
+type joinSpec struct {
+	typ JoinType
+	on  sqlparser.Expr
+}
+
+// exprInfo is the tables referenced by the expression.
+type exprInfo struct {
+	tables map[int]bool
+	// max is the max index of the referenced tables, -1 if none.
+	max int
+	// unresolved is true if there are columns without qualifier.
+	unresolved bool
+}
+
+// analyze used to check the join is at the support level, and collect the tables.
+// Unsupports:
+// 1. subquery
+// 2. aggregation, group by, having and distinct
+// 3. the expressions in the select list
+// 4. NATURAL JOIN and the nested join on the right side
+func (p *JoinPlan) analyze() ([]*sqlparser.AliasedTableExpr, []joinSpec, error) {
+	var exprs []*sqlparser.AliasedTableExpr
+	var specs []joinSpec
 	node := p.node
-	for _, tab := range node.From {
-		switch tab.(type) {
+
+	if hasSubquery(node) {
+		return nil, nil, errors.New("unsupported: subqueries.in.select")
+	}
+	if node.Distinct != "" {
+		return nil, nil, errors.New("unsupported: distinct.in.cross-shard.join")
+	}
+	if len(node.GroupBy) > 0 || node.Having != nil {
+		return nil, nil, errors.New("unsupported: group.by.or.having.in.cross-shard.join")
+	}
+	for _, expr := range node.SelectExprs {
+		switch expr := expr.(type) {
+		case *sqlparser.StarExpr:
+		case *sqlparser.AliasedExpr:
+			if _, ok := expr.Expr.(*sqlparser.ColName); !ok {
+				return nil, nil, errors.Errorf("unsupported: select.expression[%s].in.cross-shard.join", sqlparser.String(expr))
+			}
+		default:
+			return nil, nil, errors.Errorf("unsupported: select.expression[%s].in.cross-shard.join", sqlparser.String(expr))
+		}
+	}
+
+	var collect func(expr sqlparser.TableExpr, spec joinSpec) error
+	collect = func(expr sqlparser.TableExpr, spec joinSpec) error {
+		switch expr := expr.(type) {
 		case *sqlparser.AliasedTableExpr:
-			// select * from a,b where a.id=b.id
-			if len(node.From) > 1 && node.Where != nil {
-				return errors.New("unsupported: JOIN.expression")
+			if _, ok := expr.Expr.(sqlparser.TableName); !ok {
+				return errors.New("unsupported: derived.table.in.cross-shard.join")
+			}
+			exprs = append(exprs, expr)
+			specs = append(specs, spec)
+		case *sqlparser.ParenTableExpr:
+			if len(expr.Exprs) != 1 {
+				return errors.New("unsupported: nested.join.in.cross-shard.join")
 			}
+			return collect(expr.Exprs[0], spec)
 		case *sqlparser.JoinTableExpr:
-			return errors.New("unsupported: JOIN.expression")
+			left, right, typ := expr.LeftExpr, expr.RightExpr, InnerJoin
+			switch expr.Join {
+			case sqlparser.JoinStr, sqlparser.StraightJoinStr:
+			case sqlparser.LeftJoinStr:
+				typ = LeftJoin
+			case sqlparser.RightJoinStr:
+				left, right, typ = right, left, LeftJoin
+			default:
+				return errors.Errorf("unsupported: %s.in.cross-shard.join", expr.Join)
+			}
+			if err := collect(left, spec); err != nil {
+				return err
+			}
+			if paren, ok := right.(*sqlparser.ParenTableExpr); ok && len(paren.Exprs) == 1 {
+				right = paren.Exprs[0]
+			}
+			if _, ok := right.(*sqlparser.AliasedTableExpr); !ok {
+				return errors.New("unsupported: nested.join.in.cross-shard.join")
+			}
+			return collect(right, joinSpec{typ: typ, on: expr.On})
+		}
+		return nil
+	}
+	for _, expr := range node.From {
+		if err := collect(expr, joinSpec{typ: InnerJoin}); err != nil {
+			return nil, nil, err
+		}
+	}
+	return exprs, specs, nil
+}
+
+// resolve returns the tables referenced by the expression.
+func (p *JoinPlan) resolve(expr sqlparser.Expr) (*exprInfo, error) {
+	info := &exprInfo{tables: make(map[int]bool), max: -1}
+	err := sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		col, ok := node.(*sqlparser.ColName)
+		if !ok {
+			return true, nil
+		}
+		if col.Qualifier.IsEmpty() {
+			info.unresolved = true
+			return false, nil
+		}
+		idx := p.tableIndex(col.Qualifier.Name.String())
+		if idx == -1 {
+			return false, errors.Errorf("unknown.column[%s].in.cross-shard.join", sqlparser.String(col))
+		}
+		info.tables[idx] = true
+		if idx > info.max {
+			info.max = idx
+		}
+		return false, nil
+	}, expr)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// tableIndex returns the index of the table by the name, -1 if not found.
+func (p *JoinPlan) tableIndex(name string) int {
+	for i, t := range p.Tables {
+		if t.Name == name {
+			return i
 		}
 	}
+	return -1
+}
+
+// checkJoinExpr checks the expression can be evaluated in the proxy.
+func checkJoinExpr(expr sqlparser.Expr) error {
+	supported := true
+	sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		switch node := node.(type) {
+		case *sqlparser.AndExpr, *sqlparser.OrExpr, *sqlparser.NotExpr, *sqlparser.ParenExpr,
+			*sqlparser.IsExpr, *sqlparser.RangeCond, *sqlparser.ColName, *sqlparser.SQLVal,
+			*sqlparser.NullVal, sqlparser.BoolVal, sqlparser.ValTuple:
+		case *sqlparser.ComparisonExpr:
+			switch node.Operator {
+			case sqlparser.LikeStr, sqlparser.NotLikeStr, sqlparser.RegexpStr, sqlparser.NotRegexpStr:
+				supported = false
+			}
+		case sqlparser.Exprs:
+		default:
+			if _, ok := node.(sqlparser.Expr); ok {
+				supported = false
+			}
+		}
+		return supported, nil
+	}, expr)
+	if !supported {
+		return errors.Errorf("unsupported: expression[%s].in.cross-shard.join", sqlparser.String(expr))
+	}
 	return nil
 }
 
-// Build used to build distributed querys.
+// Build used to build the join plan.
+// The WHERE conditions and the ON conditions of the INNER JOIN are pushed down to the table if they only
+// reference the table and the table is not on the right side of the LEFT JOIN, the ON conditions of the
+// LEFT JOIN are pushed down to the right table if they only reference the right one. The others are
+// evaluated in the proxy at the first join which all their tables are available, the equalities between
+// the left side and the right table are the keys of the hash join.
 func (p *JoinPlan) Build() error {
-	return p.analyze()
+	node := p.node
+	exprs, specs, err := p.analyze()
+	if err != nil {
+		return err
+	}
+
+	for _, expr := range exprs {
+		name := expr.As.String()
+		if name == "" {
+			name = expr.Expr.(sqlparser.TableName).Name.String()
+		}
+		if p.tableIndex(name) != -1 {
+			return errors.Errorf("Not unique table/alias: '%s'", name)
+		}
+		p.Tables = append(p.Tables, &JoinTable{Name: name})
+	}
+	for i := 1; i < len(p.Tables); i++ {
+		p.Joins = append(p.Joins, &Join{Type: specs[i].typ, Right: i})
+	}
+	last := len(p.Tables) - 1
+	nullable := make([]bool, len(p.Tables))
+	for i, spec := range specs {
+		nullable[i] = (spec.typ == LeftJoin)
+	}
+
+	pushed := make([][]sqlparser.Expr, len(p.Tables))
+	conds := make([][]sqlparser.Expr, len(p.Tables))
+	var filters []sqlparser.Expr
+
+	// place used to place the WHERE condition and the ON condition of the INNER JOIN.
+	place := func(expr sqlparser.Expr) error {
+		info, err := p.resolve(expr)
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.unresolved && last > 0:
+			filters = append(filters, expr)
+		case info.unresolved || info.max == -1:
+			pushed[0] = append(pushed[0], expr)
+		case len(info.tables) == 1 && !nullable[info.max]:
+			pushed[info.max] = append(pushed[info.max], expr)
+		case p.Joins[info.max-1].Type == InnerJoin:
+			conds[info.max] = append(conds[info.max], expr)
+		default:
+			p.Joins[info.max-1].Filters = append(p.Joins[info.max-1].Filters, expr)
+		}
+		return nil
+	}
+
+	if node.Where != nil {
+		for _, expr := range splitAndExpression(nil, node.Where.Expr) {
+			if err := place(expr); err != nil {
+				return err
+			}
+		}
+	}
+	for i, spec := range specs {
+		if spec.on == nil {
+			continue
+		}
+		for _, expr := range splitAndExpression(nil, spec.on) {
+			if spec.typ == InnerJoin {
+				if err := place(expr); err != nil {
+					return err
+				}
+				continue
+			}
+			info, err := p.resolve(expr)
+			if err != nil {
+				return err
+			}
+			switch {
+			case info.max > i:
+				return errors.Errorf("unsupported: on.clause[%s].references.the.tables.joined.later", sqlparser.String(expr))
+			case info.unresolved:
+				p.Joins[i-1].On = append(p.Joins[i-1].On, expr)
+			case info.max == -1 || (len(info.tables) == 1 && info.max == i):
+				pushed[i] = append(pushed[i], expr)
+			default:
+				conds[i] = append(conds[i], expr)
+			}
+		}
+	}
+	if len(filters) > 0 {
+		p.Joins[last-1].Filters = append(p.Joins[last-1].Filters, filters...)
+	}
+
+	// Split the join keys from the join conditions.
+	for i, exprs := range conds {
+		if i == 0 {
+			continue
+		}
+		join := p.Joins[i-1]
+		for _, expr := range exprs {
+			if left, right, ok := p.joinKeys(expr, i); ok {
+				join.LeftKeys = append(join.LeftKeys, left)
+				join.RightKeys = append(join.RightKeys, right)
+				continue
+			}
+			join.On = append(join.On, expr)
+		}
+		join.Strategy = NestedLoopJoin
+		if len(join.LeftKeys) > 0 {
+			join.Strategy = HashJoin
+		}
+	}
+
+	// The expressions evaluated in the proxy.
+	for _, join := range p.Joins {
+		for _, expr := range append(join.On, join.Filters...) {
+			if err := checkJoinExpr(expr); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Project, order by and limit.
+	p.Project = p.expandStar(node.SelectExprs)
+	for _, order := range node.OrderBy {
+		col, ok := order.Expr.(*sqlparser.ColName)
+		if !ok {
+			return errors.Errorf("unsupported: orderby[%s].in.cross-shard.join", sqlparser.String(order.Expr))
+		}
+		newOrder := *order
+		if col.Qualifier.IsEmpty() {
+			for _, expr := range node.SelectExprs {
+				if expr, ok := expr.(*sqlparser.AliasedExpr); ok && expr.As.Equal(col.Name) {
+					newOrder.Expr = expr.Expr
+				}
+			}
+		}
+		p.OrderBy = append(p.OrderBy, &newOrder)
+	}
+	if node.Limit != nil {
+		p.Limit = NewLimitPlan(p.log, node)
+		if err := p.Limit.Build(); err != nil {
+			return err
+		}
+	}
+
+	// The select plans of the tables.
+	columns, err := p.columns()
+	if err != nil {
+		return err
+	}
+	for i, table := range p.Tables {
+		sel := &sqlparser.Select{
+			Comments:    node.Comments,
+			SelectExprs: columns[i],
+			From:        sqlparser.TableExprs{exprs[i]},
+			Lock:        node.Lock,
+		}
+		var where sqlparser.Expr
+		for _, expr := range pushed[i] {
+			if where == nil {
+				where = expr
+			} else {
+				where = &sqlparser.AndExpr{Left: where, Right: expr}
+			}
+		}
+		sel.Where = sqlparser.NewWhere(sqlparser.WhereStr, where)
+
+		table.Plan = NewSelectPlan(p.log, p.database, sqlparser.String(sel), sel, p.router)
+		if err := table.Plan.Build(); err != nil {
+			return err
+		}
+		p.children.Add(table.Plan)
+	}
+	return nil
+}
+
+// expandStar returns the select list whose '*' is expanded to the star expressions of the tables
+// in the order of the from clause, if the tables are reordered by the RIGHT JOIN.
+func (p *JoinPlan) expandStar(exprs sqlparser.SelectExprs) sqlparser.SelectExprs {
+	var names []string
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+		if expr, ok := node.(*sqlparser.AliasedTableExpr); ok {
+			name := expr.As.String()
+			if name == "" {
+				name = expr.Expr.(sqlparser.TableName).Name.String()
+			}
+			names = append(names, name)
+			return false, nil
+		}
+		return true, nil
+	}, p.node.From)
+
+	reordered := false
+	for i, name := range names {
+		if p.Tables[i].Name != name {
+			reordered = true
+		}
+	}
+	if !reordered {
+		return exprs
+	}
+
+	project := make(sqlparser.SelectExprs, 0, len(exprs))
+	for _, expr := range exprs {
+		if star, ok := expr.(*sqlparser.StarExpr); ok && star.TableName.IsEmpty() {
+			for _, name := range names {
+				project = append(project, &sqlparser.StarExpr{TableName: sqlparser.TableName{Name: sqlparser.NewTableIdent(name)}})
+			}
+			continue
+		}
+		project = append(project, expr)
+	}
+	return project
+}
+
+// joinKeys returns the keys if the expression is an equality between the column of
+// the left side and the column of the right table.
+func (p *JoinPlan) joinKeys(expr sqlparser.Expr, right int) (*sqlparser.ColName, *sqlparser.ColName, bool) {
+	cmp, ok := expr.(*sqlparser.ComparisonExpr)
+	if !ok || cmp.Operator != sqlparser.EqualStr {
+		return nil, nil, false
+	}
+	lcol, ok := cmp.Left.(*sqlparser.ColName)
+	if !ok {
+		return nil, nil, false
+	}
+	rcol, ok := cmp.Right.(*sqlparser.ColName)
+	if !ok {
+		return nil, nil, false
+	}
+	lidx := p.tableIndex(lcol.Qualifier.Name.String())
+	ridx := p.tableIndex(rcol.Qualifier.Name.String())
+	switch {
+	case lidx != -1 && lidx < right && ridx == right:
+		return lcol, rcol, true
+	case ridx != -1 && ridx < right && lidx == right:
+		return rcol, lcol, true
+	}
+	return nil, nil, false
+}
+
+// columns returns the select list of every table.
+// The table fetches all the columns if it's referenced by the star expression,
+// or there are columns which can't be resolved without the schema.
+func (p *JoinPlan) columns() ([]sqlparser.SelectExprs, error) {
+	stars := make([]bool, len(p.Tables))
+	columns := make([]sqlparser.SelectExprs, len(p.Tables))
+	seen := make([]map[string]bool, len(p.Tables))
+	for i := range p.Tables {
+		seen[i] = make(map[string]bool)
+	}
+
+	var nodes []sqlparser.SQLNode
+	for _, expr := range p.Project {
+		if star, ok := expr.(*sqlparser.StarExpr); ok {
+			if star.TableName.IsEmpty() {
+				for i := range stars {
+					stars[i] = true
+				}
+				continue
+			}
+			idx := p.tableIndex(star.TableName.Name.String())
+			if idx == -1 {
+				return nil, errors.Errorf("unknown.table[%s].in.cross-shard.join", star.TableName.Name.String())
+			}
+			stars[idx] = true
+			continue
+		}
+		nodes = append(nodes, expr)
+	}
+	for _, order := range p.OrderBy {
+		nodes = append(nodes, order.Expr)
+	}
+	for _, join := range p.Joins {
+		for _, col := range append(join.LeftKeys, join.RightKeys...) {
+			nodes = append(nodes, col)
+		}
+		for _, expr := range append(join.On, join.Filters...) {
+			nodes = append(nodes, expr)
+		}
+	}
+
+	err := sqlparser.Walk(func(node sqlparser.SQLNode) (bool, error) {
+		col, ok := node.(*sqlparser.ColName)
+		if !ok {
+			return true, nil
+		}
+		if col.Qualifier.IsEmpty() {
+			for i := range stars {
+				stars[i] = true
+			}
+			return false, nil
+		}
+		idx := p.tableIndex(col.Qualifier.Name.String())
+		if idx == -1 {
+			return false, errors.Errorf("unknown.column[%s].in.cross-shard.join", sqlparser.String(col))
+		}
+		name := col.Name.Lowered()
+		if !seen[idx][name] {
+			seen[idx][name] = true
+			columns[idx] = append(columns[idx], &sqlparser.AliasedExpr{
+				Expr: &sqlparser.ColName{Name: col.Name, Qualifier: sqlparser.TableName{Name: sqlparser.NewTableIdent(p.Tables[idx].Name)}},
+			})
+		}
+		return false, nil
+	}, nodes...)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range p.Tables {
+		switch {
+		case stars[i]:
+			columns[i] = sqlparser.SelectExprs{&sqlparser.StarExpr{}}
+		case len(columns[i]) == 0:
+			// The table is only used to produce the rows.
+			columns[i] = sqlparser.SelectExprs{&sqlparser.AliasedExpr{Expr: sqlparser.NewIntVal([]byte("1"))}}
+		}
+	}
+	return columns, nil
 }
 
 // Type returns the type of the plan.
@@ -68,15 +621,84 @@ func (p *JoinPlan) Type() PlanType {
 
 // JSON returns the plan info.
 func (p *JoinPlan) JSON() string {
-	return ""
+	type limit struct {
+		Offset int
+		Limit  int
+	}
+
+	type join struct {
+		Type     JoinType
+		Strategy JoinStrategy
+		Table    string
+		Keys     []string `json:",omitempty"`
+		On       []string `json:",omitempty"`
+		Filters  []string `json:",omitempty"`
+	}
+
+	type table struct {
+		Name       string
+		Partitions []xcontext.QueryTuple `json:",omitempty"`
+	}
+
+	type explain struct {
+		RawQuery string  `json:",omitempty"`
+		Project  string  `json:",omitempty"`
+		Tables   []table `json:",omitempty"`
+		Joins    []join  `json:",omitempty"`
+		OrderBy  string  `json:",omitempty"`
+		Limit    *limit  `json:",omitempty"`
+	}
+
+	exprsString := func(exprs []sqlparser.Expr) []string {
+		var strs []string
+		for _, expr := range exprs {
+			strs = append(strs, sqlparser.String(expr))
+		}
+		return strs
+	}
+
+	exp := &explain{
+		RawQuery: p.RawQuery,
+		Project:  sqlparser.String(p.Project),
+		OrderBy:  strings.TrimSpace(sqlparser.String(p.OrderBy)),
+	}
+	for _, t := range p.Tables {
+		exp.Tables = append(exp.Tables, table{Name: t.Name, Partitions: t.Plan.Querys})
+	}
+	for _, j := range p.Joins {
+		var keys []string
+		for i := range j.LeftKeys {
+			keys = append(keys, sqlparser.String(j.LeftKeys[i])+" = "+sqlparser.String(j.RightKeys[i]))
+		}
+		exp.Joins = append(exp.Joins, join{
+			Type:     j.Type,
+			Strategy: j.Strategy,
+			Table:    p.Tables[j.Right].Name,
+			Keys:     keys,
+			On:       exprsString(j.On),
+			Filters:  exprsString(j.Filters),
+		})
+	}
+	if p.Limit != nil {
+		exp.Limit = &limit{Offset: p.Limit.Offset, Limit: p.Limit.Limit}
+	}
+	bout, err := json.MarshalIndent(exp, "", "\t")
+	if err != nil {
+		return err.Error()
+	}
+	return hack.String(bout)
 }
 
-// Children returns the children of the plan.
+// Children returns the select plans of the tables.
 func (p *JoinPlan) Children() *PlanTree {
-	return nil
+	return p.children
 }
 
 // Size returns the memory size.
 func (p *JoinPlan) Size() int {
-	return 0
+	size := len(p.RawQuery)
+	for _, plan := range p.children.Plans() {
+		size += plan.Size()
+	}
+	return size
 }
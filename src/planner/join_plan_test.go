@@ -9,6 +9,8 @@
 package planner
 
 import (
+	"router"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -18,47 +20,271 @@ import (
 
 func TestJoinPlan(t *testing.T) {
 	querys := []string{
-		"select * from t where t.a=t.b",
+		"select A.id, B.name from A join B on A.id = B.id where A.id = 1 and B.age > 10 order by B.name desc limit 1, 10",
+		"select a.id, b.name as bname from A as a left join B as b on a.id = b.id and b.age > 10 and a.age < 5 where b.name is null order by bname",
+		"select * from A, B where A.id < B.id",
+		"select A.id from A right join B on A.id = B.id and A.x = 1",
+		"select A.id from A join B on A.id = B.id where id = 3",
+		"select A.id from A, B",
 	}
+	type want struct {
+		tables   []string
+		strategy JoinStrategy
+		typ      JoinType
+		keys     int
+		on       int
+		filters  int
+	}
+	wants := []want{
+		{[]string{"select A.id from sbtest.A6 as A where A.id = 1", "select B.name, B.id from sbtest.B0 as B where B.age > 10"}, HashJoin, InnerJoin, 1, 0, 0},
+		{[]string{"select a.id, a.age from sbtest.A1 as a", "select b.name, b.id from sbtest.B0 as b where b.age > 10"}, HashJoin, LeftJoin, 1, 1, 1},
+		{[]string{"select * from sbtest.A1 as A", "select * from sbtest.B0 as B"}, NestedLoopJoin, InnerJoin, 0, 1, 0},
+		{[]string{"select B.id from sbtest.B0 as B", "select A.id from sbtest.A1 as A where A.x = 1"}, HashJoin, LeftJoin, 1, 0, 0},
+		{[]string{"select * from sbtest.A1 as A", "select * from sbtest.B0 as B"}, HashJoin, InnerJoin, 1, 0, 1},
+		{[]string{"select A.id from sbtest.A1 as A", "select 1 from sbtest.B0 as B"}, NestedLoopJoin, InnerJoin, 0, 0, 0},
+	}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableMConfig(), router.MockTableBConfig())
+	assert.Nil(t, err)
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := NewJoinPlan(log, database, query, node.(*sqlparser.Select), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+
+		want := wants[i]
+		assert.Equal(t, PlanTypeJoin, plan.Type())
+		assert.Equal(t, 2, len(plan.Children().Plans()))
+		for j, table := range plan.Tables {
+			assert.Equal(t, want.tables[j], table.Plan.Querys[0].Query)
+		}
+		join := plan.Joins[0]
+		assert.Equal(t, 1, join.Right)
+		assert.Equal(t, want.strategy, join.Strategy)
+		assert.Equal(t, want.typ, join.Type)
+		assert.Equal(t, want.keys, len(join.LeftKeys))
+		assert.Equal(t, want.on, len(join.On))
+		assert.Equal(t, want.filters, len(join.Filters))
+		assert.True(t, plan.Size() > 0)
+	}
+}
+
+func TestJoinPlanRightJoinStar(t *testing.T) {
+	querys := []string{
+		"select * from A right join B on A.id = B.id",
+		"select B.id, * from A right join B on A.id = B.id",
+		"select A.*, B.* from A right join B on A.id = B.id",
+		"select * from A left join B on A.id = B.id",
+	}
+	wants := []string{
+		"A.*, B.*",
+		"B.id, A.*, B.*",
+		"A.*, B.*",
+		"*",
+	}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableMConfig(), router.MockTableBConfig())
+	assert.Nil(t, err)
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := NewJoinPlan(log, database, query, node.(*sqlparser.Select), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+		assert.Equal(t, wants[i], sqlparser.String(plan.Project))
+	}
+}
+
+func TestJoinPlanLocking(t *testing.T) {
+	querys := []string{
+		"select A.id, B.name from A join B on A.id = B.id where A.id = 1 for update",
+		"select A.id, B.name from A join B on A.id = B.id where A.id = 1 lock in share mode",
+	}
+	wants := [][]string{
+		{"select A.id from sbtest.A6 as A where A.id = 1 for update", "select B.name, B.id from sbtest.B0 as B for update"},
+		{"select A.id from sbtest.A6 as A where A.id = 1 lock in share mode", "select B.name, B.id from sbtest.B0 as B lock in share mode"},
+	}
+	locks := []string{" for update", " lock in share mode"}
 
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
-	for _, query := range querys {
-		tree, err := sqlparser.Parse(query)
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableMConfig(), router.MockTableBConfig())
+	assert.Nil(t, err)
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
 		assert.Nil(t, err)
-		node := tree.(*sqlparser.Select)
+		plan := NewJoinPlan(log, database, query, node.(*sqlparser.Select), route)
+		err = plan.Build()
 		assert.Nil(t, err)
-		plan := NewJoinPlan(log, node)
+		for j, table := range plan.Tables {
+			assert.True(t, table.Plan.Locking())
+			assert.Equal(t, wants[i][j], table.Plan.Querys[0].Query)
+			// The lock reaches all the shards.
+			for _, tuple := range table.Plan.Querys {
+				assert.True(t, strings.HasSuffix(tuple.Query, locks[i]), tuple.Query)
+			}
+		}
+	}
+}
+
+func TestJoinPlanJSON(t *testing.T) {
+	query := "select A.id, B.name from A join B on A.id = B.id where A.id = 1 order by B.name desc limit 1, 10"
+	want := `{
+	"RawQuery": "select A.id, B.name from A join B on A.id = B.id where A.id = 1 order by B.name desc limit 1, 10",
+	"Project": "A.id, B.name",
+	"Tables": [
+		{
+			"Name": "A",
+			"Partitions": [
+				{
+					"Query": "select A.id from sbtest.A6 as A where A.id = 1",
+					"Backend": "backend6",
+					"Range": "[512-4096)"
+				}
+			]
+		},
 		{
-			err := plan.Build()
-			assert.Nil(t, err)
-			assert.Nil(t, plan.Children())
-			assert.Equal(t, "", plan.JSON())
+			"Name": "B",
+			"Partitions": [
+				{
+					"Query": "select B.name, B.id from sbtest.B0 as B",
+					"Backend": "backend0",
+					"Range": "[0-512)"
+				},
+				{
+					"Query": "select B.name, B.id from sbtest.B1 as B",
+					"Backend": "backend512",
+					"Range": "[512-4096)"
+				}
+			]
 		}
+	],
+	"Joins": [
+		{
+			"Type": "INNER JOIN",
+			"Strategy": "HashJoin",
+			"Table": "B",
+			"Keys": [
+				"A.id = B.id"
+			]
+		}
+	],
+	"OrderBy": "order by B.name desc",
+	"Limit": {
+		"Offset": 1,
+		"Limit": 10
 	}
+}`
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableMConfig(), router.MockTableBConfig())
+	assert.Nil(t, err)
+	node, err := sqlparser.Parse(query)
+	assert.Nil(t, err)
+	plan := NewJoinPlan(log, database, query, node.(*sqlparser.Select), route)
+	err = plan.Build()
+	assert.Nil(t, err)
+	assert.Equal(t, want, plan.JSON())
 }
 
 func TestJoinUnsupportedPlan(t *testing.T) {
 	querys := []string{
-		"select x.id, y.id from x,y where x.id=y.id",
-		"select x.id, y.id from x join y on x.id=y.id where x.id=1",
+		"select A.id from A join B on A.id = B.id where A.id in (select id from B)",
+		"select distinct A.id from A join B on A.id = B.id",
+		"select count(*) from A join B on A.id = B.id",
+		"select A.id from A join B on A.id = B.id group by A.id",
+		"select A.id from A natural join B",
+		"select A.id from A join (B join A as C on B.id = C.id) on A.id = B.id",
+		"select A.id from A join B as A on A.id = B.id",
+		"select A.id from A join B on A.id = C.id",
+		"select A.id from A left join B on A.id = B.id and A.name like 'x%'",
+		"select A.id from A, B where A.id = B.id order by A.id + 1",
+		"select A.id from A left join B on A.id = C.id join C on C.id = A.id",
 	}
 	results := []string{
-		"unsupported: JOIN.expression",
-		"unsupported: JOIN.expression",
+		"unsupported: subqueries.in.select",
+		"unsupported: distinct.in.cross-shard.join",
+		"unsupported: select.expression[count(*)].in.cross-shard.join",
+		"unsupported: group.by.or.having.in.cross-shard.join",
+		"unsupported: natural join.in.cross-shard.join",
+		"unsupported: nested.join.in.cross-shard.join",
+		"Not unique table/alias: 'A'",
+		"unknown.column[C.id].in.cross-shard.join",
+		"unsupported: expression[A.name like 'x%'].in.cross-shard.join",
+		"unsupported: orderby[A.id + 1].in.cross-shard.join",
+		"unsupported: on.clause[A.id = C.id].references.the.tables.joined.later",
 	}
 
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableMConfig(), router.MockTableBConfig())
+	assert.Nil(t, err)
 	for i, query := range querys {
-		tree, err := sqlparser.Parse(query)
-		assert.Nil(t, err)
-		node := tree.(*sqlparser.Select)
+		node, err := sqlparser.Parse(query)
 		assert.Nil(t, err)
-		plan := NewJoinPlan(log, node)
-		{
-			err := plan.Build()
-			got := err.Error()
-			want := results[i]
-			assert.Equal(t, want, got)
+		plan := NewJoinPlan(log, database, query, node.(*sqlparser.Select), route)
+		err = plan.Build()
+		assert.NotNil(t, err, query)
+		if err != nil {
+			assert.Equal(t, results[i], err.Error())
 		}
 	}
 }
+
+func TestSelectPlanCrossShardJoin(t *testing.T) {
+	querys := []string{
+		"select A.id from A join B on A.id = B.id",
+		"select A.id from A, B",
+		"select A.id from A join G on A.id = G.id",
+		"select A.id from A join G on A.id = G.id where A.id = 0",
+		"select A.id from A",
+	}
+	wants := []bool{
+		true,
+		true,
+		true,
+		false,
+		false,
+	}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableMConfig(), router.MockTableBConfig(), router.MockTableGConfig())
+	assert.Nil(t, err)
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+		assert.Equal(t, wants[i], plan.CrossShardJoin())
+	}
+}
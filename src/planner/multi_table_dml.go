@@ -0,0 +1,406 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"router"
+	"xcontext"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+const (
+	// lookupBatchKeys is the max number of the keys in one query of the DMLLookup.
+	lookupBatchKeys = 1000
+)
+
+// DMLLookup represents the target table of the multiple-table UPDATE or DELETE which
+// can't be pushed down to the segments.
+// The Select selects the sharding keys and the unique key of the matching rows of the target,
+// followed by the values of the assignments if it's UPDATE, then the rows are routed by the
+// sharding keys and changed by the unique key on their segments. The target without the
+// primary or unique key is not supported.
+type DMLLookup struct {
+	log    *xlog.Log
+	router *router.Router
+
+	comments sqlparser.Comments
+
+	// Database and Table are the target table.
+	Database string
+	Table    string
+
+	// ShardKeys are the sharding key columns of the target table.
+	ShardKeys []string
+
+	// UniqueKeys are the primary or unique key columns of the target table.
+	UniqueKeys []string
+
+	// uniqueIndexes are the positions of the UniqueKeys in the selected row, the columns
+	// not in the ShardKeys are selected after them.
+	uniqueIndexes []int
+
+	// Exprs are the assignments of the target table with the unqualified columns, nil if it's DELETE.
+	// The values referencing the columns are selected, the others are kept in the statement.
+	Exprs sqlparser.UpdateExprs
+
+	// Select is the plan of the keys and the values.
+	Select Plan
+}
+
+// JSON returns the lookup info.
+func (l *DMLLookup) JSON() json.RawMessage {
+	type explain struct {
+		Table  string          `json:",omitempty"`
+		Select json.RawMessage `json:",omitempty"`
+	}
+	bout, err := json.Marshal(&explain{Table: l.Table, Select: json.RawMessage(l.Select.JSON())})
+	if err != nil {
+		return json.RawMessage(fmt.Sprintf("%q", err.Error()))
+	}
+	return json.RawMessage(bout)
+}
+
+// Querys returns the querys which change the selected rows, the rows are grouped by the
+// segments and the assigned values. A row matched more than once is changed by the first match.
+func (l *DMLLookup) Querys(rows [][]sqltypes.Value) ([]xcontext.QueryTuple, error) {
+	type group struct {
+		segment router.Segment
+		values  []sqltypes.Value
+		keys    sqlparser.ValTuple
+	}
+	var groups []*group
+	index := make(map[string]*group)
+	seen := make(map[string]struct{})
+
+	n := len(l.ShardKeys)
+	width := n
+	for _, idx := range l.uniqueIndexes {
+		if idx >= width {
+			width = idx + 1
+		}
+	}
+	selected := 0
+	for _, expr := range l.Exprs {
+		if hasColumn(expr.Expr) {
+			selected++
+		}
+	}
+	for _, row := range rows {
+		if len(row) != width+selected {
+			return nil, errors.Errorf("multiple-table.DML.lookup[%s].columns.mismatch", l.Table)
+		}
+		sqlvals := make([]*sqlparser.SQLVal, 0, n)
+		for i, v := range row[:n] {
+			if v.IsNull() {
+				return nil, errors.Errorf("unsupported: shardkey[%s].of.table[%s].is.NULL", l.ShardKeys[i], l.Table)
+			}
+			sqlvals = append(sqlvals, valueExpr(v).(*sqlparser.SQLVal))
+		}
+		segments, err := l.router.LookupTuple(l.Database, l.Table, sqlvals)
+		if err != nil {
+			return nil, err
+		}
+		segment := segments[0]
+
+		keys := make([]sqltypes.Value, 0, len(l.uniqueIndexes))
+		tuple := make(sqlparser.ValTuple, 0, len(l.uniqueIndexes))
+		for i, idx := range l.uniqueIndexes {
+			v := row[idx]
+			if v.IsNull() {
+				return nil, errors.Errorf("unsupported: unique.key[%s].of.table[%s].is.NULL", l.UniqueKeys[i], l.Table)
+			}
+			keys = append(keys, v)
+			tuple = append(tuple, valueExpr(v))
+		}
+		// The unique key is unique on the segment.
+		key := segment.Table + lookupKey(keys)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+
+		values := row[width:]
+		gkey := segment.Table + lookupKey(values)
+		g, ok := index[gkey]
+		if !ok || len(g.keys) >= lookupBatchKeys {
+			g = &group{segment: segment, values: values}
+			index[gkey] = g
+			groups = append(groups, g)
+		}
+		if len(tuple) == 1 {
+			g.keys = append(g.keys, tuple[0])
+		} else {
+			g.keys = append(g.keys, tuple)
+		}
+	}
+
+	var left sqlparser.Expr
+	if len(l.UniqueKeys) == 1 {
+		left = &sqlparser.ColName{Name: sqlparser.NewColIdent(l.UniqueKeys[0])}
+	} else {
+		columns := make(sqlparser.ValTuple, 0, len(l.UniqueKeys))
+		for _, uniqueKey := range l.UniqueKeys {
+			columns = append(columns, &sqlparser.ColName{Name: sqlparser.NewColIdent(uniqueKey)})
+		}
+		left = columns
+	}
+
+	querys := make([]xcontext.QueryTuple, 0, len(groups))
+	for _, g := range groups {
+		where := sqlparser.NewWhere(sqlparser.WhereStr, &sqlparser.ComparisonExpr{Operator: sqlparser.InStr, Left: left, Right: g.keys})
+		buf := sqlparser.NewTrackedBuffer(nil)
+		if l.Exprs == nil {
+			buf.Myprintf("delete %vfrom %s.%s%v", l.comments, l.Database, g.segment.Table, where)
+		} else {
+			exprs := make(sqlparser.UpdateExprs, 0, len(l.Exprs))
+			values := g.values
+			for _, expr := range l.Exprs {
+				if !hasColumn(expr.Expr) {
+					exprs = append(exprs, expr)
+					continue
+				}
+				exprs = append(exprs, &sqlparser.UpdateExpr{Name: expr.Name, Expr: valueExpr(values[0])})
+				values = values[1:]
+			}
+			buf.Myprintf("update %v%s.%s set %v%v", l.comments, l.Database, g.segment.Table, exprs, where)
+		}
+		querys = append(querys, xcontext.QueryTuple{
+			Query:   buf.String(),
+			Backend: g.segment.Backend,
+			Range:   g.segment.Range.String(),
+		})
+	}
+	return querys, nil
+}
+
+// hasColumn returns true if the expression references any column.
+func hasColumn(expr sqlparser.Expr) bool {
+	has := false
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+		if _, ok := node.(*sqlparser.ColName); ok {
+			has = true
+			return false, errors.New("dummy")
+		}
+		return true, nil
+	}, expr)
+	return has
+}
+
+// lookupKey returns the key of the values, NULL is different from the empty string.
+func lookupKey(values []sqltypes.Value) string {
+	key := make([]byte, 0, 16)
+	for _, v := range values {
+		if v.IsNull() {
+			key = append(key, 'N')
+			continue
+		}
+		key = append(key, fmt.Sprintf("%d:%s", len(v.Raw()), v.Raw())...)
+	}
+	return string(key)
+}
+
+// multiTableDML used to plan the multiple-table UPDATE or DELETE.
+// If the tables can be joined on the shards(see SelectPlan.pushdownShard), the statement is
+// pushed down to the segments of the shard table. Otherwise every target table is looked up
+// by a distributed select.
+type multiTableDML struct {
+	log      *xlog.Log
+	router   *router.Router
+	database string
+	comments sqlparser.Comments
+	from     sqlparser.TableExprs
+	where    *sqlparser.Where
+
+	tables   []*tableInfo
+	shard    *tableInfo
+	pushdown bool
+}
+
+func newMultiTableDML(log *xlog.Log, database string, comments sqlparser.Comments, from sqlparser.TableExprs, where *sqlparser.Where, router *router.Router) (*multiTableDML, error) {
+	m := &multiTableDML{
+		log:      log,
+		router:   router,
+		database: database,
+		comments: comments,
+		from:     from,
+		where:    where,
+	}
+	sel := NewSelectPlan(log, database, "", &sqlparser.Select{From: from, Where: where}, router)
+	tables, err := sel.analyze()
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tables {
+		if _, err := router.ShardKeys(t.database, t.table); err != nil {
+			return nil, err
+		}
+	}
+	m.tables = tables
+	m.shard, m.pushdown = sel.pushdownShard(tables)
+	return m, nil
+}
+
+// hasJoinCondition returns true if any of the tables is joined with the ON condition.
+func hasJoinCondition(from sqlparser.TableExprs) bool {
+	has := false
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+		if join, ok := node.(*sqlparser.JoinTableExpr); ok && join.On != nil {
+			has = true
+			return false, errors.New("dummy")
+		}
+		return true, nil
+	}, from)
+	return has
+}
+
+// refName returns the name the table referenced by in the statement, the alias if it has.
+func refName(t *tableInfo) string {
+	if !t.expr.As.IsEmpty() {
+		return t.expr.As.String()
+	}
+	return t.table
+}
+
+// lookupTable returns the table referenced by the qualifier, nil if not found.
+func (m *multiTableDML) lookupTable(qualifier sqlparser.TableName) *tableInfo {
+	for _, t := range m.tables {
+		if !t.expr.As.IsEmpty() {
+			if qualifier.Qualifier.IsEmpty() && qualifier.Name.String() == t.expr.As.String() {
+				return t
+			}
+			continue
+		}
+		if qualifier.Name.String() == t.table && (qualifier.Qualifier.IsEmpty() || qualifier.Qualifier.String() == t.database) {
+			return t
+		}
+	}
+	return nil
+}
+
+// checkTarget checks the table can be changed by the statement.
+// The global table joined with the non-global tables is only joined with the rows on every
+// backend, so its copies would diverge.
+func (m *multiTableDML) checkTarget(t *tableInfo) error {
+	if t.global && !m.shard.global {
+		return errors.Errorf("unsupported: global.table[%s].joined.with.non-global.tables.can.not.be.changed", t.table)
+	}
+	return nil
+}
+
+// targetName returns the name of the target table in the rewritten statement, the shard table and the
+// co-located tables are aliased by their original names, the others are qualified by the database.
+func (m *multiTableDML) targetName(t *tableInfo) sqlparser.TableName {
+	if !t.expr.As.IsEmpty() || t == m.shard || len(t.segments) > 0 {
+		return sqlparser.TableName{Name: sqlparser.NewTableIdent(refName(t))}
+	}
+	return sqlparser.TableName{Name: sqlparser.NewTableIdent(t.table), Qualifier: sqlparser.NewTableIdent(t.database)}
+}
+
+// pushdownQuerys returns the querys on the segments of the shard table, the format writes the
+// statement with the rewritten from and where clauses.
+func (m *multiTableDML) pushdownQuerys(format func(buf *sqlparser.TrackedBuffer, from sqlparser.TableExprs, where *sqlparser.Where)) ([]xcontext.QueryTuple, error) {
+	shard := m.shard
+	shardkeys, err := m.router.ShardKeys(shard.database, shard.table)
+	if err != nil {
+		return nil, err
+	}
+	routing, err := getRouting(shard.database, shard.table, shardkeys, m.where, m.router)
+	if err != nil {
+		return nil, err
+	}
+
+	querys := make([]xcontext.QueryTuple, 0, len(routing.segments))
+	for _, segment := range routing.segments {
+		where := m.where
+		if where != nil {
+			where = routing.rewriteWhere(where, segment)
+		}
+		buf := sqlparser.NewTrackedBuffer(nil)
+		format(buf, rewriteTableExprs(m.from, m.tables, shard, segment), where)
+		querys = append(querys, xcontext.QueryTuple{
+			Query:   buf.String(),
+			Backend: segment.Backend,
+			Range:   segment.Range.String(),
+		})
+	}
+	return querys, nil
+}
+
+// buildLookup returns the lookup of the target table, exprs are the assignments of the target if it's UPDATE.
+func (m *multiTableDML) buildLookup(t *tableInfo, exprs sqlparser.UpdateExprs) (*DMLLookup, error) {
+	shardKeys, err := m.router.ShardKeys(t.database, t.table)
+	if err != nil {
+		return nil, err
+	}
+	if len(shardKeys) == 0 {
+		return nil, errors.Errorf("unsupported: table[%s].without.shardkey.can.not.be.changed.across.shards", t.table)
+	}
+	// The rows sharing the sharding key can't be told apart without the unique key.
+	_, uniqueKeys := m.router.UniqueKey(t.database, t.table)
+	if len(uniqueKeys) == 0 {
+		return nil, errors.Errorf("unsupported: table[%s].without.primary.or.unique.key.can.not.be.changed.across.shards", t.table)
+	}
+
+	qualifier := sqlparser.TableName{Name: sqlparser.NewTableIdent(refName(t))}
+	selectExprs := make(sqlparser.SelectExprs, 0, len(shardKeys)+len(uniqueKeys)+len(exprs))
+	for _, shardKey := range shardKeys {
+		selectExprs = append(selectExprs, &sqlparser.AliasedExpr{Expr: &sqlparser.ColName{Name: sqlparser.NewColIdent(shardKey), Qualifier: qualifier}})
+	}
+	uniqueIndexes := make([]int, 0, len(uniqueKeys))
+	for _, uniqueKey := range uniqueKeys {
+		idx := -1
+		for i, shardKey := range shardKeys {
+			if strings.EqualFold(shardKey, uniqueKey) {
+				idx = i
+			}
+		}
+		if idx < 0 {
+			idx = len(selectExprs)
+			selectExprs = append(selectExprs, &sqlparser.AliasedExpr{Expr: &sqlparser.ColName{Name: sqlparser.NewColIdent(uniqueKey), Qualifier: qualifier}})
+		}
+		uniqueIndexes = append(uniqueIndexes, idx)
+	}
+	for _, expr := range exprs {
+		if hasColumn(expr.Expr) {
+			selectExprs = append(selectExprs, &sqlparser.AliasedExpr{Expr: expr.Expr})
+		}
+	}
+	node := &sqlparser.Select{SelectExprs: selectExprs, From: m.from, Where: m.where}
+	sel, err := selectStatementPlan(m.log, m.database, node, m.router)
+	if err != nil {
+		return nil, err
+	}
+	if err := sel.Build(); err != nil {
+		return nil, err
+	}
+
+	lookup := &DMLLookup{
+		log:           m.log,
+		router:        m.router,
+		comments:      m.comments,
+		Database:      t.database,
+		Table:         t.table,
+		ShardKeys:     shardKeys,
+		UniqueKeys:    uniqueKeys,
+		uniqueIndexes: uniqueIndexes,
+		Select:        sel,
+	}
+	for _, expr := range exprs {
+		lookup.Exprs = append(lookup.Exprs, &sqlparser.UpdateExpr{Name: &sqlparser.ColName{Name: expr.Name.Name}, Expr: expr.Expr})
+	}
+	return lookup, nil
+}
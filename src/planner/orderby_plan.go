@@ -39,30 +39,39 @@ type OrderBy struct {
 
 // OrderByPlan represents order-by plan.
 type OrderByPlan struct {
-	log      *xlog.Log
-	node     *sqlparser.Select
-	tuples   []selectTuple
-	OrderBys []OrderBy `json:"OrderBy(s)"`
-	typ      PlanType
+	log       *xlog.Log
+	node      *sqlparser.Select
+	tuples    []selectTuple
+	rewritten sqlparser.SelectExprs
+	OrderBys  []OrderBy `json:"OrderBy(s)"`
+	// Hidden is the number of the hidden columns at the end of the select list, they are removed after sorting.
+	Hidden int `json:",omitempty"`
+	typ    PlanType
 }
 
 // NewOrderByPlan used to create OrderByPlan.
 func NewOrderByPlan(log *xlog.Log, node *sqlparser.Select, tuples []selectTuple) *OrderByPlan {
 	return &OrderByPlan{
-		log:    log,
-		node:   node,
-		tuples: tuples,
-		typ:    PlanTypeOrderby,
+		log:       log,
+		node:      node,
+		tuples:    tuples,
+		rewritten: node.SelectExprs,
+		typ:       PlanTypeOrderby,
 	}
 }
 
 // analyze used to check the 'order by' is at the support level.
 // Supports:
 // 1. sqlparser.ColName: 'select a from t order by a'
-//
-// Unsupported(orderby field must be in select list):
-// 1. 'select a from t order by b'
+// 2. the field not in the select list is appended as the hidden column:
+// 'select a from t order by b' is rewritten to 'select a, b from t order by b'
 func (p *OrderByPlan) analyze() error {
+	for _, tuple := range p.tuples {
+		if tuple.hidden {
+			p.Hidden++
+		}
+	}
+
 	order := p.node.OrderBy
 	for _, o := range order {
 		switch o.Expr.(type) {
@@ -77,7 +86,11 @@ func (p *OrderByPlan) analyze() error {
 			e := o.Expr.(*sqlparser.ColName)
 			order.Field = e.Name.String()
 			if !checkInTuple(order.Field, p.tuples) {
-				return errors.Errorf("unsupported: orderby[%+v].should.in.select.list", order.Field)
+				rewritten := make(sqlparser.SelectExprs, len(p.rewritten), len(p.rewritten)+1)
+				copy(rewritten, p.rewritten)
+				p.rewritten = append(rewritten, &sqlparser.AliasedExpr{Expr: e})
+				p.tuples = append(p.tuples, selectTuple{field: order.Field, expr: e, hidden: true})
+				p.Hidden++
 			}
 			p.OrderBys = append(p.OrderBys, order)
 		default:
@@ -92,6 +105,11 @@ func (p *OrderByPlan) Build() error {
 	return p.analyze()
 }
 
+// ReWritten used to re-write the SelectExprs clause.
+func (p *OrderByPlan) ReWritten() sqlparser.SelectExprs {
+	return p.rewritten
+}
+
 // Type returns the type of the plan.
 func (p *OrderByPlan) Type() PlanType {
 	return p.typ
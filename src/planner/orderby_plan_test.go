@@ -44,11 +44,9 @@ func TestOrderByPlan(t *testing.T) {
 
 func TestOrderByPlanError(t *testing.T) {
 	querys := []string{
-		"select a,b from t order by c",
 		"select a,b from t order by rand()",
 	}
 	results := []string{
-		"unsupported: orderby[c].should.in.select.list",
 		"unsupported: orderby:&{Qualifier: Name:rand Distinct:false Exprs:[]}",
 	}
 
@@ -69,3 +67,32 @@ func TestOrderByPlanError(t *testing.T) {
 		}
 	}
 }
+
+func TestOrderByPlanHidden(t *testing.T) {
+	querys := []string{
+		"select a,b from t order by c, t.d desc, a",
+		"select a as x from t order by a, c, c",
+		"select a from t order by a",
+	}
+	rewrittens := []string{
+		"a, b, c, t.d",
+		"a as x, a, c",
+		"a",
+	}
+	hiddens := []int{2, 2, 0}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	for i, query := range querys {
+		tree, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		node := tree.(*sqlparser.Select)
+		tuples, err := parserSelectExprs(node.SelectExprs)
+		assert.Nil(t, err)
+		plan := NewOrderByPlan(log, node, tuples)
+		err = plan.Build()
+		assert.Nil(t, err)
+		assert.Equal(t, rewrittens[i], sqlparser.String(plan.ReWritten()))
+		assert.Equal(t, hiddens[i], plan.Hidden)
+		assert.Equal(t, len(node.OrderBy), len(plan.OrderBys))
+	}
+}
@@ -41,4 +41,7 @@ const (
 
 	// PlanTypeDistinct enum.
 	PlanTypeDistinct PlanType = "PlanTypeDistinct"
+
+	// PlanTypeUnion enum.
+	PlanTypeUnion PlanType = "PlanTypeUnion"
 )
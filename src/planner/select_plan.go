@@ -10,7 +10,7 @@ package planner
 
 import (
 	"encoding/json"
-	"fmt"
+	"math/rand"
 
 	"router"
 	"xcontext"
@@ -68,75 +68,387 @@ func NewSelectPlan(log *xlog.Log, database string, query string, node *sqlparser
 	}
 }
 
-// analyze used to check the 'select' is at the support level, and get the db, table, etc..
+// tableInfo represents the table referenced in the from clause.
+type tableInfo struct {
+	database string
+	table    string
+	global   bool
+	// backend is the backend of the single table, empty if not.
+	backend string
+	// segments are all the segments of the table co-located with the shard table.
+	segments []router.Segment
+	// backends are the backends hosting the global table.
+	backends []string
+	expr     *sqlparser.AliasedTableExpr
+}
+
+// analyze used to check the 'select' is at the support level, and get the tables in the from clause.
 // Unsupports:
 // 1. subquery
-func (p *SelectPlan) analyze() (string, string, string, error) {
-	var shardDatabase string
-	var shardTable string
-	var aliasTable string
-	var tableExpr *sqlparser.AliasedTableExpr
+func (p *SelectPlan) analyze() ([]*tableInfo, error) {
+	var tables []*tableInfo
 	node := p.node
 
 	// Check subquery.
-	if hasSubquery(node) || len(node.From) > 1 {
-		return shardDatabase, shardTable, aliasTable, errors.New("unsupported: subqueries.in.select")
+	if hasSubquery(node) {
+		return nil, errors.New("unsupported: subqueries.in.select")
 	}
 
-	// Find the first table in the node.From.
+	// Collect the tables in the node.From.
 	// Currently only support AliasedTableExpr, JoinTableExpr select.
-	switch expr := (node.From[0]).(type) {
-	case *sqlparser.AliasedTableExpr:
-		tableExpr = expr
-	case *sqlparser.JoinTableExpr:
-		if v, ok := (expr.LeftExpr).(*sqlparser.AliasedTableExpr); ok {
-			tableExpr = v
+	var collect func(expr sqlparser.TableExpr)
+	collect = func(expr sqlparser.TableExpr) {
+		switch expr := expr.(type) {
+		case *sqlparser.AliasedTableExpr:
+			if tn, ok := expr.Expr.(sqlparser.TableName); ok {
+				database := p.database
+				if !tn.Qualifier.IsEmpty() {
+					database = tn.Qualifier.String()
+				}
+				table := tn.Name.String()
+				backend, _ := p.router.SingleBackend(database, table)
+				t := &tableInfo{
+					database: database,
+					table:    table,
+					global:   p.router.IsGlobal(database, table),
+					backend:  backend,
+					expr:     expr,
+				}
+				if t.global {
+					segments, _ := p.router.Lookup(database, table, nil, nil)
+					for _, segment := range segments {
+						t.backends = append(t.backends, segment.Backend)
+					}
+				}
+				tables = append(tables, t)
+			}
+		case *sqlparser.JoinTableExpr:
+			collect(expr.LeftExpr)
+			collect(expr.RightExpr)
+		case *sqlparser.ParenTableExpr:
+			for _, e := range expr.Exprs {
+				collect(e)
+			}
+		}
+	}
+	for _, expr := range node.From {
+		collect(expr)
+	}
+	if len(tables) == 0 {
+		tables = append(tables, &tableInfo{database: p.database})
+	}
+	return tables, nil
+}
+
+// pushdownShard returns the shard table which the query routed by, and whether
+// the other tables can be joined on the shards of it.
+// The hash table which is partitioned identically to the shard table and joined
+// with it on the sharding keys is co-located, the matching rows are on the same
+// segment, so the join is pushed down to every segment too.
+func (p *SelectPlan) pushdownShard(tables []*tableInfo) (*tableInfo, bool) {
+	shard := tables[0]
+	for _, t := range tables {
+		if !t.global {
+			shard = t
+			break
 		}
 	}
 
-	if tableExpr != nil {
-		aliasTable = tableExpr.As.String()
+	var others []*tableInfo
+	for _, t := range tables {
+		if t != shard && !t.global && (t.backend == "" || t.backend != shard.backend) {
+			others = append(others, t)
+		}
+	}
+	if len(others) == 0 {
+		return shard, p.pushdownGlobals(tables, shard)
+	}
+	if shard.backend != "" {
+		return shard, false
+	}
+	for _, t := range others {
+		if t.backend != "" || t.database != shard.database || !p.router.Colocated(t.database, shard.table, t.table) {
+			return shard, false
+		}
+	}
 
-		switch expr := tableExpr.Expr.(type) {
-		case sqlparser.TableName:
-			if !expr.Qualifier.IsEmpty() {
-				shardDatabase = expr.Qualifier.String()
+	// The co-located tables must be connected to the shard table by the equalities of the sharding keys.
+	joined := p.shardKeyJoins(tables)
+	connected := map[*tableInfo]bool{shard: true}
+	for changed := true; changed; {
+		changed = false
+		for _, pair := range joined {
+			if connected[pair[0]] != connected[pair[1]] {
+				connected[pair[0]], connected[pair[1]] = true, true
+				changed = true
 			}
-			shardTable = expr.Name.String()
 		}
 	}
-	return shardDatabase, shardTable, aliasTable, nil
+	for _, t := range others {
+		if !connected[t] {
+			return shard, false
+		}
+		segments, err := p.router.Lookup(t.database, t.table, nil, nil)
+		if err != nil {
+			return shard, false
+		}
+		t.segments = segments
+	}
+	return shard, p.pushdownGlobals(tables, shard)
+}
+
+// globalTables returns the global tables in the from clause.
+func globalTables(tables []*tableInfo) []*tableInfo {
+	var globals []*tableInfo
+	for _, t := range tables {
+		if t.global {
+			globals = append(globals, t)
+		}
+	}
+	return globals
+}
+
+// globalBackends returns the backends hosting all the global tables.
+func globalBackends(globals []*tableInfo) map[string]bool {
+	hosted := make(map[string]bool)
+	for i, t := range globals {
+		current := make(map[string]bool)
+		for _, backend := range t.backends {
+			if i == 0 || hosted[backend] {
+				current[backend] = true
+			}
+		}
+		hosted = current
+	}
+	return hosted
+}
+
+// pushdownGlobals returns true if the global tables can be joined on the segments the query routed to.
+// The backends of the segments must host all the global tables, and the global table on the preserved
+// side of an outer join can't be joined on more than one segment, or else every segment returns its
+// unmatched rows.
+func (p *SelectPlan) pushdownGlobals(tables []*tableInfo, shard *tableInfo) bool {
+	globals := globalTables(tables)
+	if len(globals) == 0 {
+		return true
+	}
+	hosted := globalBackends(globals)
+	if shard.global {
+		return len(hosted) > 0
+	}
+
+	backends := []string{shard.backend}
+	if shard.backend == "" {
+		// The routing errors are returned by the Build.
+		shardkeys, err := p.router.ShardKeys(shard.database, shard.table)
+		if err != nil {
+			return true
+		}
+		routing, err := getRouting(shard.database, shard.table, shardkeys, p.node.Where, p.router)
+		if err != nil {
+			return true
+		}
+		if len(routing.segments) > 1 && p.globalPreserved(globals) {
+			return false
+		}
+		backends = backends[:0]
+		for _, segment := range routing.segments {
+			backends = append(backends, segment.Backend)
+		}
+	}
+	for _, backend := range backends {
+		if !hosted[backend] {
+			return false
+		}
+	}
+	return true
+}
+
+// globalPreserved returns true if a global table is on the preserved side of an outer join
+// whose other side has the non-global tables.
+func (p *SelectPlan) globalPreserved(globals []*tableInfo) bool {
+	isGlobal := make(map[*sqlparser.AliasedTableExpr]bool)
+	for _, t := range globals {
+		isGlobal[t.expr] = true
+	}
+	// hasTable returns true if the table expr has the global(or non-global) tables.
+	hasTable := func(expr sqlparser.SQLNode, global bool) bool {
+		found := false
+		_ = sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+			if t, ok := node.(*sqlparser.AliasedTableExpr); ok && isGlobal[t] == global {
+				found = true
+				return false, nil
+			}
+			return true, nil
+		}, expr)
+		return found
+	}
+
+	preserved := false
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+		join, ok := node.(*sqlparser.JoinTableExpr)
+		if !ok {
+			return true, nil
+		}
+		kept, nullable := join.LeftExpr, join.RightExpr
+		switch join.Join {
+		case sqlparser.LeftJoinStr, sqlparser.NaturalLeftJoinStr:
+		case sqlparser.RightJoinStr, sqlparser.NaturalRightJoinStr:
+			kept, nullable = nullable, kept
+		default:
+			return true, nil
+		}
+		if hasTable(kept, true) && hasTable(nullable, false) {
+			preserved = true
+			return false, nil
+		}
+		return true, nil
+	}, p.node.From)
+	return preserved
+}
+
+// shardKeyJoins returns the pairs of the hash tables which are joined on all the sharding key columns
+// by the equalities in the where clause or the join conditions, such as 'a.uid = b.uid'.
+func (p *SelectPlan) shardKeyJoins(tables []*tableInfo) [][2]*tableInfo {
+	var filters []sqlparser.Expr
+	if p.node.Where != nil {
+		filters = splitAndExpression(filters, p.node.Where.Expr)
+	}
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+		if join, ok := node.(*sqlparser.JoinTableExpr); ok && join.On != nil {
+			filters = splitAndExpression(filters, join.On)
+		}
+		return true, nil
+	}, p.node.From)
+
+	// lookup returns the table which the column qualified by, and its position in the from clause.
+	lookup := func(expr sqlparser.Expr) (*tableInfo, int, string) {
+		col, ok := expr.(*sqlparser.ColName)
+		if !ok || col.Qualifier.IsEmpty() {
+			return nil, 0, ""
+		}
+		for i, t := range tables {
+			if t.backend != "" || t.global || t.expr == nil {
+				continue
+			}
+			name := t.table
+			if !t.expr.As.IsEmpty() {
+				name = t.expr.As.String()
+			}
+			if col.Qualifier.Name.String() == name {
+				return t, i, col.Name.String()
+			}
+		}
+		return nil, 0, ""
+	}
+
+	// The equal columns of every two tables.
+	type pair struct{ a, b *tableInfo }
+	equals := make(map[pair]map[string]string)
+	var pairs []pair
+	for _, f := range filters {
+		cmp, ok := f.(*sqlparser.ComparisonExpr)
+		if !ok || cmp.Operator != sqlparser.EqualStr {
+			continue
+		}
+		ta, ia, ca := lookup(cmp.Left)
+		tb, ib, cb := lookup(cmp.Right)
+		if ta == nil || tb == nil || ta == tb {
+			continue
+		}
+		if ia > ib {
+			ta, tb, ca, cb = tb, ta, cb, ca
+		}
+		key := pair{ta, tb}
+		if _, ok := equals[key]; !ok {
+			equals[key] = make(map[string]string)
+			pairs = append(pairs, key)
+		}
+		equals[key][ca] = cb
+	}
+
+	var joined [][2]*tableInfo
+	for _, key := range pairs {
+		keysA, err := p.router.ShardKeys(key.a.database, key.a.table)
+		if err != nil {
+			continue
+		}
+		keysB, err := p.router.ShardKeys(key.b.database, key.b.table)
+		if err != nil || len(keysA) != len(keysB) {
+			continue
+		}
+		ok := true
+		for i, k := range keysA {
+			if equals[key][k] != keysB[i] {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			joined = append(joined, [2]*tableInfo{key.a, key.b})
+		}
+	}
+	return joined
+}
+
+// CrossShardJoin returns true if the tables in the from clause can't be joined
+// on the shards, the rows should be joined in the proxy by the JoinPlan.
+func (p *SelectPlan) CrossShardJoin() bool {
+	tables, err := p.analyze()
+	if err != nil {
+		return false
+	}
+	_, pushdown := p.pushdownShard(tables)
+	return !pushdown
 }
 
 // Build used to build distributed querys.
+// The first non-global table is the shard table which the query routed by,
+// the joins with the global tables are pushed down to the shards, so are the
+// joins among the single tables placed on the same backend, and the joins with
+// the co-located hash tables on the sharding keys.
 // For now, we don't support subquery in select.
 func (p *SelectPlan) Build() error {
-	var err error
-	var shardTable string
-	var aliasTable string
-	var shardDatabase string
-
 	log := p.log
 	node := p.node
-	if shardDatabase, shardTable, aliasTable, err = p.analyze(); err != nil {
+	tables, err := p.analyze()
+	if err != nil {
 		return err
 	}
-	if shardDatabase == "" {
-		shardDatabase = p.database
+
+	shard, pushdown := p.pushdownShard(tables)
+	if shard.backend != "" && !pushdown {
+		return errors.Errorf("unsupported: single.table[%s].join.with.the.tables.on.other.backends", shard.table)
 	}
-	if aliasTable == "" {
-		aliasTable = shardTable
+	// The cross-shard join is planned by the JoinPlan.
+	if !pushdown {
+		return errors.New("unsupported: JOIN.expression")
 	}
 
 	// Get the routing segments info.
-	shardkey, err := p.router.ShardKey(shardDatabase, shardTable)
+	shardkeys, err := p.router.ShardKeys(shard.database, shard.table)
 	if err != nil {
 		return err
 	}
-	segments, err := getDMLRouting(shardDatabase, shardTable, shardkey, node.Where, p.router)
+	routing, err := getRouting(shard.database, shard.table, shardkeys, node.Where, p.router)
 	if err != nil {
 		return err
 	}
+	segments := routing.segments
+	// All the tables are global, read from one of the backends hosting all of them.
+	if shard.global {
+		hosted := globalBackends(globalTables(tables))
+		var candidates []router.Segment
+		for _, segment := range segments {
+			if hosted[segment.Backend] {
+				candidates = append(candidates, segment)
+			}
+		}
+		segments = candidates
+		if len(segments) > 1 {
+			segments = segments[rand.Intn(len(segments)):][:1]
+		}
+	}
 
 	// Add sub-plans.
 	children := p.children
@@ -152,13 +464,6 @@ func (p *SelectPlan) Build() error {
 		}
 		children.Add(distinctPlan)
 
-		// Join SubPlan.
-		joinPlan := NewJoinPlan(log, node)
-		if err := joinPlan.Build(); err != nil {
-			return err
-		}
-		children.Add(joinPlan)
-
 		// Aggregate SubPlan.
 		aggrPlan := NewAggregatePlan(log, node, tuples)
 		if err := aggrPlan.Build(); err != nil {
@@ -166,13 +471,19 @@ func (p *SelectPlan) Build() error {
 		}
 		children.Add(aggrPlan)
 		node.SelectExprs = aggrPlan.ReWritten()
+		node.GroupBy = aggrPlan.ReWrittenGroupBy()
+		// The having clause is evaluated after the merge.
+		if aggrPlan.Having() != nil {
+			node.Having = nil
+		}
 
 		// Orderby SubPlan.
-		orderPlan := NewOrderByPlan(log, node, tuples)
+		orderPlan := NewOrderByPlan(log, node, append(tuples, aggrPlan.hiddenTuples...))
 		if err := orderPlan.Build(); err != nil {
 			return err
 		}
 		children.Add(orderPlan)
+		node.SelectExprs = orderPlan.ReWritten()
 
 		// Limit SubPlan.
 		if node.Limit != nil {
@@ -183,23 +494,24 @@ func (p *SelectPlan) Build() error {
 			children.Add(limitPlan)
 			// Rewrite the limit clause.
 			node.Limit = limitPlan.ReWritten()
+			// The shards return the distinct values per group or the rows before the having filter,
+			// the limit can't be pushed down.
+			if aggrPlan.HasDistinct() || aggrPlan.Having() != nil {
+				node.Limit = nil
+			}
 		}
 	}
 
 	// Rewritten the query.
 	for _, segment := range segments {
-		tn := sqlparser.TableName{
-			Name:      sqlparser.NewTableIdent(segment.Table),
-			Qualifier: sqlparser.NewTableIdent(shardDatabase),
-		}
-		as := fmt.Sprintf(" as %s", aliasTable)
+		from := rewriteTableExprs(node.From, tables, shard, segment)
 		buf := sqlparser.NewTrackedBuffer(nil)
-		buf.Myprintf("select %v%s%v from %v%s%v%v%v%v%v",
+		buf.Myprintf("select %v%s%v from %v%v%v%v%v%v%s",
 			node.Comments, node.Hints, node.SelectExprs,
-			tn, as,
-			node.Where,
+			from,
+			routing.rewriteWhere(node.Where, segment),
 			node.GroupBy, node.Having, node.OrderBy,
-			node.Limit)
+			node.Limit, node.Lock)
 		rewritten := buf.String()
 
 		tuple := xcontext.QueryTuple{
@@ -212,6 +524,74 @@ func (p *SelectPlan) Build() error {
 	return nil
 }
 
+// segmentTable returns the partition table of the shard table or the co-located table on the segment.
+func segmentTable(t *tableInfo, shard *tableInfo, segment router.Segment) (string, bool) {
+	if t == shard {
+		return segment.Table, true
+	}
+	for _, seg := range t.segments {
+		if seg.Range.String() == segment.Range.String() {
+			return seg.Table, true
+		}
+	}
+	return "", false
+}
+
+// rewriteTableExprs returns the copy of the from clause, the shard table and the co-located tables are
+// replaced by the partition tables on the segment and aliased by the original name, others(global or
+// single tables) are qualified by the database.
+func rewriteTableExprs(exprs sqlparser.TableExprs, tables []*tableInfo, shard *tableInfo, segment router.Segment) sqlparser.TableExprs {
+	var rewrite func(expr sqlparser.TableExpr) sqlparser.TableExpr
+	rewrite = func(expr sqlparser.TableExpr) sqlparser.TableExpr {
+		switch expr := expr.(type) {
+		case *sqlparser.AliasedTableExpr:
+			for _, t := range tables {
+				if t.expr != expr {
+					continue
+				}
+				newExpr := *expr
+				if table, ok := segmentTable(t, shard, segment); ok {
+					newExpr.Expr = sqlparser.TableName{
+						Name:      sqlparser.NewTableIdent(table),
+						Qualifier: sqlparser.NewTableIdent(t.database),
+					}
+					if newExpr.As.IsEmpty() {
+						newExpr.As = sqlparser.NewTableIdent(t.table)
+					}
+				} else {
+					newExpr.Expr = sqlparser.TableName{
+						Name:      sqlparser.NewTableIdent(t.table),
+						Qualifier: sqlparser.NewTableIdent(t.database),
+					}
+				}
+				return &newExpr
+			}
+			return expr
+		case *sqlparser.JoinTableExpr:
+			newExpr := *expr
+			newExpr.LeftExpr = rewrite(expr.LeftExpr)
+			newExpr.RightExpr = rewrite(expr.RightExpr)
+			return &newExpr
+		case *sqlparser.ParenTableExpr:
+			newExpr := *expr
+			newExpr.Exprs = rewriteTableExprs(expr.Exprs, tables, shard, segment)
+			return &newExpr
+		}
+		return expr
+	}
+
+	from := make(sqlparser.TableExprs, 0, len(exprs))
+	for _, expr := range exprs {
+		from = append(from, rewrite(expr))
+	}
+	return from
+}
+
+// Locking returns true if the select locks the rows, such as FOR UPDATE.
+func (p *SelectPlan) Locking() bool {
+	return p.node.Lock != ""
+}
+
 // Type returns the type of the plan.
 func (p *SelectPlan) Type() PlanType {
 	return p.typ
@@ -231,6 +611,7 @@ func (p *SelectPlan) JSON() string {
 		Aggregate   []string              `json:",omitempty"`
 		GatherMerge []string              `json:",omitempty"`
 		HashGroupBy []string              `json:",omitempty"`
+		Having      string                `json:",omitempty"`
 		Limit       *limit                `json:",omitempty"`
 	}
 
@@ -243,6 +624,7 @@ func (p *SelectPlan) JSON() string {
 	var aggregate []string
 	var hashGroup []string
 	var gatherMerge []string
+	var having string
 	var lim *limit
 	for _, sub := range p.children.Plans() {
 		switch sub.Type() {
@@ -254,6 +636,9 @@ func (p *SelectPlan) JSON() string {
 			for _, aggr := range plan.groupAggrs {
 				hashGroup = append(hashGroup, aggr.Field)
 			}
+			if plan.having != nil {
+				having = sqlparser.String(plan.having)
+			}
 		case PlanTypeOrderby:
 			plan := sub.(*OrderByPlan)
 			for _, order := range plan.OrderBys {
@@ -271,6 +656,7 @@ func (p *SelectPlan) JSON() string {
 		Aggregate:   aggregate,
 		GatherMerge: gatherMerge,
 		HashGroupBy: hashGroup,
+		Having:      having,
 		Limit:       lim,
 	}
 	bout, err := json.MarshalIndent(exp, "", "\t")
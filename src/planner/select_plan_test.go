@@ -9,8 +9,10 @@
 package planner
 
 import (
+	"fmt"
 	"testing"
 
+	"config"
 	"router"
 
 	"github.com/stretchr/testify/assert"
@@ -78,32 +80,32 @@ func TestSelectPlan(t *testing.T) {
 	"Project": "id, sum(a) as A",
 	"Partitions": [
 		{
-			"Query": "select id, sum(a) as A from sbtest.A1 as A group by id having A \u003e 1000",
+			"Query": "select id, sum(a) as A from sbtest.A1 as A group by id",
 			"Backend": "backend1",
 			"Range": "[0-32)"
 		},
 		{
-			"Query": "select id, sum(a) as A from sbtest.A2 as A group by id having A \u003e 1000",
+			"Query": "select id, sum(a) as A from sbtest.A2 as A group by id",
 			"Backend": "backend2",
 			"Range": "[32-64)"
 		},
 		{
-			"Query": "select id, sum(a) as A from sbtest.A3 as A group by id having A \u003e 1000",
+			"Query": "select id, sum(a) as A from sbtest.A3 as A group by id",
 			"Backend": "backend3",
 			"Range": "[64-96)"
 		},
 		{
-			"Query": "select id, sum(a) as A from sbtest.A4 as A group by id having A \u003e 1000",
+			"Query": "select id, sum(a) as A from sbtest.A4 as A group by id",
 			"Backend": "backend4",
 			"Range": "[96-256)"
 		},
 		{
-			"Query": "select id, sum(a) as A from sbtest.A5 as A group by id having A \u003e 1000",
+			"Query": "select id, sum(a) as A from sbtest.A5 as A group by id",
 			"Backend": "backend5",
 			"Range": "[256-512)"
 		},
 		{
-			"Query": "select id, sum(a) as A from sbtest.A6 as A group by id having A \u003e 1000",
+			"Query": "select id, sum(a) as A from sbtest.A6 as A group by id",
 			"Backend": "backend6",
 			"Range": "[512-4096)"
 		}
@@ -113,7 +115,8 @@ func TestSelectPlan(t *testing.T) {
 	],
 	"HashGroupBy": [
 		"id"
-	]
+	],
+	"Having": "A \u003e 1000"
 }`,
 	}
 	querys := []string{
@@ -211,32 +214,32 @@ func TestSelectPlanDatabaseIsNull(t *testing.T) {
 	"Project": "id, sum(a) as A",
 	"Partitions": [
 		{
-			"Query": "select id, sum(a) as A from sbtest.A1 as A group by id having A \u003e 1000",
+			"Query": "select id, sum(a) as A from sbtest.A1 as A group by id",
 			"Backend": "backend1",
 			"Range": "[0-32)"
 		},
 		{
-			"Query": "select id, sum(a) as A from sbtest.A2 as A group by id having A \u003e 1000",
+			"Query": "select id, sum(a) as A from sbtest.A2 as A group by id",
 			"Backend": "backend2",
 			"Range": "[32-64)"
 		},
 		{
-			"Query": "select id, sum(a) as A from sbtest.A3 as A group by id having A \u003e 1000",
+			"Query": "select id, sum(a) as A from sbtest.A3 as A group by id",
 			"Backend": "backend3",
 			"Range": "[64-96)"
 		},
 		{
-			"Query": "select id, sum(a) as A from sbtest.A4 as A group by id having A \u003e 1000",
+			"Query": "select id, sum(a) as A from sbtest.A4 as A group by id",
 			"Backend": "backend4",
 			"Range": "[96-256)"
 		},
 		{
-			"Query": "select id, sum(a) as A from sbtest.A5 as A group by id having A \u003e 1000",
+			"Query": "select id, sum(a) as A from sbtest.A5 as A group by id",
 			"Backend": "backend5",
 			"Range": "[256-512)"
 		},
 		{
-			"Query": "select id, sum(a) as A from sbtest.A6 as A group by id having A \u003e 1000",
+			"Query": "select id, sum(a) as A from sbtest.A6 as A group by id",
 			"Backend": "backend6",
 			"Range": "[512-4096)"
 		}
@@ -246,7 +249,8 @@ func TestSelectPlanDatabaseIsNull(t *testing.T) {
 	],
 	"HashGroupBy": [
 		"id"
-	]
+	],
+	"Having": "A \u003e 1000"
 }`,
 	}
 	querys := []string{
@@ -289,9 +293,9 @@ func TestSelectUnsupportedPlan(t *testing.T) {
 		"select distinct(b) from A",
 		"select A.id from A join B on B.id=A.id",
 		"select id, rand(id) from A",
-		"select id from A order by b",
+		"select id from A order by rand()",
 		"select id from A limit x",
-		"select age,count(*) from A group by age having count(*) >=2",
+		"select age,count(*) from A group by age having count(distinct a, b) >=2",
 		"select id from A,b limit x",
 	}
 	results := []string{
@@ -299,10 +303,10 @@ func TestSelectUnsupportedPlan(t *testing.T) {
 		"unsupported: distinct",
 		"unsupported: JOIN.expression",
 		"unsupported: function:rand",
-		"unsupported: orderby[b].should.in.select.list",
+		"unsupported: orderby:&{Qualifier: Name:rand Distinct:false Exprs:[]}",
 		"unsupported: limit.offset.or.counts.must.be.IntVal",
-		"unsupported: expr[count(*)].in.having.clause",
-		"unsupported: subqueries.in.select",
+		"unsupported: distinct.in.function:count.with.multiple.arguments",
+		"unsupported: JOIN.expression",
 	}
 
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
@@ -471,3 +475,384 @@ func TestSelectPlanDatabaseNotFound(t *testing.T) {
 		}
 	}
 }
+
+func TestSelectGlobalPlan(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	// GA is the global table on all the backends of A.
+	GA := router.MockTableGConfig()
+	GA.Name = "GA"
+	GA.Partitions = nil
+	for _, part := range router.MockTableMConfig().Partitions {
+		GA.Partitions = append(GA.Partitions, &config.PartitionConfig{Table: "GA", Backend: part.Backend})
+	}
+	err := route.AddForTest(database, router.MockTableMConfig(), router.MockTableGConfig(), GA)
+	assert.Nil(t, err)
+
+	// Read from one backend.
+	{
+		query := "select * from G where G.id > 10"
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(plan.Querys))
+		assert.Equal(t, "select * from sbtest.G as G where G.id > 10", plan.Querys[0].Query)
+	}
+
+	// Read from the backend hosting all the global tables.
+	{
+		query := "select G.id from G join GA on G.id = GA.id"
+		for i := 0; i < 10; i++ {
+			node, err := sqlparser.Parse(query)
+			assert.Nil(t, err)
+			plan := NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+			err = plan.Build()
+			assert.Nil(t, err)
+			assert.Equal(t, 1, len(plan.Querys))
+			assert.Contains(t, []string{"backend1", "backend2"}, plan.Querys[0].Backend)
+		}
+	}
+
+	// Join pushdown.
+	{
+		querys := []string{
+			"select A.id, g.name from A join GA as g on A.b = g.id where A.id = 1",
+			"select A.id, GA.name from A, GA where A.b = GA.id and A.id = 1",
+			"select GA.name, A.id from GA left join A on A.b = GA.id where A.id = 1",
+			"select A.id, G.name from A join G on A.b = G.id where A.id = 0",
+		}
+		wants := []string{
+			"select A.id, g.name from sbtest.A6 as A join sbtest.GA as g on A.b = g.id where A.id = 1",
+			"select A.id, GA.name from sbtest.A6 as A, sbtest.GA where A.b = GA.id and A.id = 1",
+			"select GA.name, A.id from sbtest.GA left join sbtest.A6 as A on A.b = GA.id where A.id = 1",
+			"select A.id, G.name from sbtest.A1 as A join sbtest.G on A.b = G.id where A.id = 0",
+		}
+		for i, query := range querys {
+			node, err := sqlparser.Parse(query)
+			assert.Nil(t, err)
+			plan := NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+			err = plan.Build()
+			assert.Nil(t, err)
+			assert.Equal(t, 1, len(plan.Querys))
+			assert.Equal(t, wants[i], plan.Querys[0].Query)
+		}
+	}
+
+	// Join pushdown to all the shards.
+	{
+		querys := []string{
+			"select A.id, GA.name from A join GA on A.b = GA.id order by A.id limit 10",
+			"select A.id, GA.name from A left join GA on A.b = GA.id order by A.id limit 10",
+		}
+		wants := []string{
+			"select A.id, GA.name from sbtest.A1 as A join sbtest.GA on A.b = GA.id order by A.id asc limit 10",
+			"select A.id, GA.name from sbtest.A1 as A left join sbtest.GA on A.b = GA.id order by A.id asc limit 10",
+		}
+		for i, query := range querys {
+			node, err := sqlparser.Parse(query)
+			assert.Nil(t, err)
+			plan := NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+			err = plan.Build()
+			assert.Nil(t, err)
+			assert.Equal(t, 6, len(plan.Querys))
+			assert.Equal(t, wants[i], plan.Querys[0].Query)
+		}
+	}
+
+	// The joins are planned by the JoinPlan: the global table on the preserved side of the outer join
+	// with the shards, or the global table not on all the backends of the shards.
+	{
+		querys := []string{
+			"select GA.name, A.id from GA left join A on A.b = GA.id",
+			"select GA.name, A.id from A right join GA on A.b = GA.id",
+			"select A.id, G.name from A join G on A.b = G.id",
+			"select A.id, G.name from A join G on A.b = G.id where A.id = 1",
+		}
+		for _, query := range querys {
+			node, err := sqlparser.Parse(query)
+			assert.Nil(t, err)
+			plan := NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+			assert.True(t, plan.CrossShardJoin(), query)
+		}
+	}
+}
+
+func TestSelectPlanInOr(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableMConfig())
+	assert.Nil(t, err)
+
+	querys := []string{
+		"select id from A where id in (0, 1, 39) order by id",
+		"select id from A where A.id = 39 or A.id = 2",
+	}
+	wants := [][]string{
+		{
+			"select id from sbtest.A1 as A where id in (0, 39) order by id asc",
+			"select id from sbtest.A6 as A where id in (1) order by id asc",
+		},
+		{
+			"select id from sbtest.A1 as A where A.id = 39",
+			"select id from sbtest.A6 as A where A.id = 2",
+		},
+	}
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+		assert.Equal(t, len(wants[i]), len(plan.Querys))
+		for j, want := range wants[i] {
+			assert.Equal(t, want, plan.Querys[j].Query)
+		}
+	}
+}
+
+func TestSelectPlanLocking(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableMConfig())
+	assert.Nil(t, err)
+
+	querys := []string{
+		"select id from A where id = 1",
+		"select id from A where id = 1 for update",
+		"select id from A where id = 1 lock in share mode",
+	}
+	type want struct {
+		locking bool
+		query   string
+	}
+	wants := []want{
+		{false, "select id from sbtest.A6 as A where id = 1"},
+		{true, "select id from sbtest.A6 as A where id = 1 for update"},
+		{true, "select id from sbtest.A6 as A where id = 1 lock in share mode"},
+	}
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+		assert.Equal(t, wants[i].locking, plan.Locking(), query)
+		// The lock reaches the shards.
+		assert.Equal(t, 1, len(plan.Querys))
+		assert.Equal(t, wants[i].query, plan.Querys[0].Query)
+	}
+}
+
+func TestSelectSinglePlan(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	S1 := &config.TableConfig{
+		Name:       "S1",
+		ShardType:  "SINGLE",
+		Partitions: []*config.PartitionConfig{{Table: "S1", Backend: "backend1"}},
+	}
+	S2 := &config.TableConfig{
+		Name:       "S2",
+		ShardType:  "SINGLE",
+		Partitions: []*config.PartitionConfig{{Table: "S2", Backend: "backend2"}},
+	}
+	err := route.AddForTest(database, router.MockTableMConfig(), router.MockTableGConfig(), router.MockTableSConfig(), S1, S2)
+	assert.Nil(t, err)
+
+	// Passthrough to the backend.
+	{
+		querys := []string{
+			"select * from S where S.id > 10",
+			"select S.id, S1.name from S join S1 on S.id = S1.id",
+			"select S.id, G.name from S, G where S.id = G.id order by S.id limit 10",
+		}
+		wants := []string{
+			"select * from sbtest.S as S where S.id > 10",
+			"select S.id, S1.name from sbtest.S as S join sbtest.S1 on S.id = S1.id",
+			"select S.id, G.name from sbtest.S as S, sbtest.G where S.id = G.id order by S.id asc limit 10",
+		}
+		for i, query := range querys {
+			node, err := sqlparser.Parse(query)
+			assert.Nil(t, err)
+			plan := NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+			err = plan.Build()
+			assert.Nil(t, err)
+			assert.Equal(t, 1, len(plan.Querys))
+			assert.Equal(t, "backend1", plan.Querys[0].Backend)
+			assert.Equal(t, wants[i], plan.Querys[0].Query)
+			assert.Equal(t, 0, len(plan.Children().Plans()))
+		}
+	}
+
+	// Join the tables on different backends.
+	{
+		querys := []string{
+			"select * from S, S2 where S.id = S2.id",
+			"select * from S join A on S.id = A.id",
+		}
+		for _, query := range querys {
+			node, err := sqlparser.Parse(query)
+			assert.Nil(t, err)
+			plan := NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+			err = plan.Build()
+			assert.NotNil(t, err)
+		}
+	}
+}
+
+func TestSelectColocatedPlan(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	// M is partitioned identically to A.
+	M := router.MockTableMConfig()
+	M.Name = "M"
+	M.ShardKey = "uid"
+	for i, part := range M.Partitions {
+		part.Table = fmt.Sprintf("M%d", i+1)
+	}
+	err := route.AddForTest(database, router.MockTableMConfig(), router.MockTableBConfig(), router.MockTableGConfig(), M)
+	assert.Nil(t, err)
+
+	// Pushdown to the segments.
+	{
+		querys := []string{
+			"select A.id, M.name from A join M on A.id = M.uid",
+			"select * from A, M, G where A.id = M.uid and A.id = 0 and M.uid = G.id",
+			"select A.id, m.name from A left join M as m on m.uid = A.id and m.x > 1 order by A.id",
+		}
+		wants := [][]string{
+			{
+				"select A.id, M.name from sbtest.A1 as A join sbtest.M1 as M on A.id = M.uid",
+				"select A.id, M.name from sbtest.A2 as A join sbtest.M2 as M on A.id = M.uid",
+				"select A.id, M.name from sbtest.A3 as A join sbtest.M3 as M on A.id = M.uid",
+				"select A.id, M.name from sbtest.A4 as A join sbtest.M4 as M on A.id = M.uid",
+				"select A.id, M.name from sbtest.A5 as A join sbtest.M5 as M on A.id = M.uid",
+				"select A.id, M.name from sbtest.A6 as A join sbtest.M6 as M on A.id = M.uid",
+			},
+			{
+				"select * from sbtest.A1 as A, sbtest.M1 as M, sbtest.G where A.id = M.uid and A.id = 0 and M.uid = G.id",
+			},
+			{
+				"select A.id, m.name from sbtest.A1 as A left join sbtest.M1 as m on m.uid = A.id and m.x > 1 order by A.id asc",
+				"select A.id, m.name from sbtest.A2 as A left join sbtest.M2 as m on m.uid = A.id and m.x > 1 order by A.id asc",
+				"select A.id, m.name from sbtest.A3 as A left join sbtest.M3 as m on m.uid = A.id and m.x > 1 order by A.id asc",
+				"select A.id, m.name from sbtest.A4 as A left join sbtest.M4 as m on m.uid = A.id and m.x > 1 order by A.id asc",
+				"select A.id, m.name from sbtest.A5 as A left join sbtest.M5 as m on m.uid = A.id and m.x > 1 order by A.id asc",
+				"select A.id, m.name from sbtest.A6 as A left join sbtest.M6 as m on m.uid = A.id and m.x > 1 order by A.id asc",
+			},
+		}
+		for i, query := range querys {
+			node, err := sqlparser.Parse(query)
+			assert.Nil(t, err)
+			plan := NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+			assert.False(t, plan.CrossShardJoin())
+			err = plan.Build()
+			assert.Nil(t, err)
+			var got []string
+			for _, q := range plan.Querys {
+				got = append(got, q.Query)
+			}
+			assert.Equal(t, wants[i], got)
+		}
+	}
+
+	// Not joined on the sharding keys, or not co-located.
+	{
+		querys := []string{
+			"select A.id from A join M on A.id = M.id",
+			"select A.id from A join M on A.id = M.uid or A.x = 1",
+			"select A.id from A, M where A.id = uid",
+			"select A.id from A join B on A.id = B.id",
+		}
+		for _, query := range querys {
+			node, err := sqlparser.Parse(query)
+			assert.Nil(t, err)
+			plan := NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+			assert.True(t, plan.CrossShardJoin(), query)
+		}
+	}
+}
+
+func TestSelectPlanDistinctAggregate(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+	err := route.AddForTest(database, router.MockTableMConfig())
+	assert.Nil(t, err)
+
+	querys := []string{
+		"select a, count(distinct b) as cnt from A where id > 8 group by a order by a limit 10",
+		"select count(distinct b) from A where id = 1",
+	}
+	wants := []string{
+		"select a, b as cnt from sbtest.A1 as A where id > 8 group by a, b order by a asc",
+		"select count(distinct b) from sbtest.A6 as A where id = 1",
+	}
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+		assert.Equal(t, wants[i], plan.Querys[0].Query)
+	}
+}
+
+func TestSelectPlanHiddenColumns(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+	err := route.AddForTest(database, router.MockTableMConfig())
+	assert.Nil(t, err)
+
+	querys := []string{
+		"select count(*) from A group by A.a order by a desc limit 1",
+		"select id from A order by b, c",
+		"select a, sum(b) from A group by a, c order by d",
+	}
+	wants := []string{
+		"select count(*), A.a from sbtest.A1 as A group by A.a order by a desc limit 1",
+		"select id, b, c from sbtest.A1 as A order by b asc, c asc",
+		"select a, sum(b), c, d from sbtest.A1 as A group by a, c order by d asc",
+	}
+	hiddens := []int{1, 2, 2}
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := NewSelectPlan(log, database, query, node.(*sqlparser.Select), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+		assert.Equal(t, wants[i], plan.Querys[0].Query)
+		for _, sub := range plan.Children().Plans() {
+			if sub.Type() == PlanTypeOrderby {
+				assert.Equal(t, hiddens[i], sub.(*OrderByPlan).Hidden)
+			}
+		}
+	}
+}
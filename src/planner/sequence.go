@@ -0,0 +1,368 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"strconv"
+
+	"router"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+)
+
+// sequenceRewriter tuple.
+type sequenceRewriter struct {
+	database     string
+	router       *router.Router
+	lastInsertID uint64
+
+	// nextval is true if NEXTVAL() is allowed in the current clause.
+	nextval bool
+	// replaced is the number of the functions replaced.
+	replaced int
+	// insertID is the first AUTO_INCREMENT value generated.
+	insertID uint64
+}
+
+// RewriteSequences used to substitute the values for the sequence functions in the statement,
+// and fill the AUTO_INCREMENT column which is generated by the table sequence.
+// Supports:
+// 1. NEXTVAL(seq): the next value of the sequence, only in the INSERT values and the SELECT without tables
+// 2. LAST_INSERT_ID(): the lastInsertID of the session
+// 3. LAST_INSERT_ID(N): N, which becomes the lastInsertID of the session
+// 4. The missing, NULL, DEFAULT or 0 AUTO_INCREMENT column of INSERT ... VALUES is filled by the table sequence
+// Returns true if the node is rewritten, the first AUTO_INCREMENT value generated(0 if none),
+// and the lastInsertID of the session after the statement.
+func RewriteSequences(database string, node sqlparser.Statement, router *router.Router, lastInsertID uint64) (bool, uint64, uint64, error) {
+	r := &sequenceRewriter{
+		database:     database,
+		router:       router,
+		lastInsertID: lastInsertID,
+	}
+	var err error
+	switch node := node.(type) {
+	case *sqlparser.Select:
+		err = r.rewriteSelect(node)
+	case *sqlparser.Insert:
+		err = r.rewriteInsert(node)
+	case *sqlparser.Update:
+		for _, update := range node.Exprs {
+			if update.Expr, err = r.rewriteExpr(update.Expr); err != nil {
+				return false, 0, 0, err
+			}
+		}
+		err = r.rewriteWhere(node.Where)
+	case *sqlparser.Delete:
+		err = r.rewriteWhere(node.Where)
+	}
+	if err != nil {
+		return false, 0, 0, err
+	}
+	return r.replaced > 0, r.insertID, r.lastInsertID, nil
+}
+
+func (r *sequenceRewriter) rewriteSelect(node *sqlparser.Select) error {
+	r.nextval = !hasTables(node)
+	for _, expr := range node.SelectExprs {
+		if expr, ok := expr.(*sqlparser.AliasedExpr); ok {
+			// Keep the column name as the function.
+			name := sqlparser.String(expr.Expr)
+			replaced := r.replaced
+			e, err := r.rewriteExpr(expr.Expr)
+			if err != nil {
+				return err
+			}
+			if r.replaced > replaced && expr.As.IsEmpty() {
+				expr.As = sqlparser.NewColIdent(name)
+			}
+			expr.Expr = e
+		}
+	}
+	r.nextval = false
+
+	if err := r.rewriteWhere(node.Where); err != nil {
+		return err
+	}
+	return r.rewriteWhere(node.Having)
+}
+
+// hasTables returns false if the select is from dual.
+func hasTables(node *sqlparser.Select) bool {
+	if len(node.From) != 1 {
+		return true
+	}
+	if expr, ok := node.From[0].(*sqlparser.AliasedTableExpr); ok {
+		if table, ok := expr.Expr.(sqlparser.TableName); ok {
+			return table.Name.String() != "dual"
+		}
+	}
+	return true
+}
+
+func (r *sequenceRewriter) rewriteInsert(node *sqlparser.Insert) error {
+	database := r.database
+	if !node.Table.Qualifier.IsEmpty() {
+		database = node.Table.Qualifier.String()
+	}
+	table := node.Table.Name.String()
+	if column := r.router.AutoIncrement(database, table); column != "" {
+		if err := r.fillAutoIncrement(database, table, column, node); err != nil {
+			return err
+		}
+	}
+
+	if values, ok := node.Rows.(sqlparser.Values); ok {
+		r.nextval = true
+		for _, row := range values {
+			if err := r.rewriteExprs(row); err != nil {
+				return err
+			}
+		}
+		r.nextval = false
+	}
+
+	var err error
+	for _, expr := range node.OnDup {
+		if expr.Expr, err = r.rewriteExpr(expr.Expr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fillAutoIncrement fills the AUTO_INCREMENT column by the next values of the table sequence,
+// the column is appended if it's missing.
+// The values without the column list are in the table order, the list is filled by the recorded
+// columns. They are kept as they are if the order isn't recorded(the tables created by the old version).
+func (r *sequenceRewriter) fillAutoIncrement(database, table, column string, node *sqlparser.Insert) error {
+	if len(node.Columns) == 0 {
+		columns := r.router.Columns(database, table)
+		if len(columns) == 0 {
+			return nil
+		}
+		for _, col := range columns {
+			node.Columns = append(node.Columns, sqlparser.NewColIdent(col))
+		}
+		r.replaced++
+	}
+
+	idx := -1
+	for i, col := range node.Columns {
+		if col.EqualString(column) {
+			idx = i
+			break
+		}
+	}
+
+	rows, ok := node.Rows.(sqlparser.Values)
+	if !ok {
+		if idx == -1 {
+			return errors.Errorf("unsupported: auto.increment.column[%s].missing.in.insert.select", column)
+		}
+		return nil
+	}
+
+	var fills []int
+	for i, row := range rows {
+		if idx == -1 || (idx < len(row) && isAutoIncrementValue(row[idx])) {
+			fills = append(fills, i)
+		}
+	}
+	if len(fills) == 0 {
+		return nil
+	}
+	values, err := r.router.NextAutoIncrement(database, table, len(fills))
+	if err != nil {
+		return err
+	}
+
+	if idx == -1 {
+		node.Columns = append(node.Columns, sqlparser.NewColIdent(column))
+		for i := range rows {
+			rows[i] = append(rows[i], nil)
+		}
+		idx = len(node.Columns) - 1
+	}
+	for k, i := range fills {
+		rows[i][idx] = intValue(values[k])
+	}
+	r.insertID = uint64(values[0])
+	r.replaced++
+	return nil
+}
+
+// isAutoIncrementValue returns true if the value asks for the generated value.
+func isAutoIncrementValue(expr sqlparser.Expr) bool {
+	switch expr := expr.(type) {
+	case *sqlparser.NullVal, *sqlparser.Default:
+		return true
+	case *sqlparser.SQLVal:
+		return expr.Type == sqlparser.IntVal && string(expr.Val) == "0"
+	}
+	return false
+}
+
+func intValue(v int64) *sqlparser.SQLVal {
+	return sqlparser.NewIntVal([]byte(strconv.FormatInt(v, 10)))
+}
+
+// lastInsertIDArg returns the value of the argument of LAST_INSERT_ID(expr), false if it's not an unsigned integer.
+func lastInsertIDArg(expr sqlparser.SelectExpr) (uint64, bool) {
+	arg, ok := expr.(*sqlparser.AliasedExpr)
+	if !ok {
+		return 0, false
+	}
+	val, ok := arg.Expr.(*sqlparser.SQLVal)
+	if !ok || val.Type != sqlparser.IntVal {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(string(val.Val), 10, 64)
+	return id, err == nil
+}
+
+func (r *sequenceRewriter) rewriteWhere(where *sqlparser.Where) error {
+	var err error
+	if where != nil {
+		where.Expr, err = r.rewriteExpr(where.Expr)
+	}
+	return err
+}
+
+func (r *sequenceRewriter) rewriteExprs(exprs []sqlparser.Expr) error {
+	var err error
+	for i := range exprs {
+		if exprs[i], err = r.rewriteExpr(exprs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *sequenceRewriter) rewritePair(left, right sqlparser.Expr) (sqlparser.Expr, sqlparser.Expr, error) {
+	left, err := r.rewriteExpr(left)
+	if err != nil {
+		return nil, nil, err
+	}
+	right, err = r.rewriteExpr(right)
+	if err != nil {
+		return nil, nil, err
+	}
+	return left, right, nil
+}
+
+// rewriteExpr returns the expr with the sequence functions replaced by the values.
+func (r *sequenceRewriter) rewriteExpr(expr sqlparser.Expr) (sqlparser.Expr, error) {
+	var err error
+	switch expr := expr.(type) {
+	case *sqlparser.AndExpr:
+		expr.Left, expr.Right, err = r.rewritePair(expr.Left, expr.Right)
+	case *sqlparser.OrExpr:
+		expr.Left, expr.Right, err = r.rewritePair(expr.Left, expr.Right)
+	case *sqlparser.NotExpr:
+		expr.Expr, err = r.rewriteExpr(expr.Expr)
+	case *sqlparser.ParenExpr:
+		expr.Expr, err = r.rewriteExpr(expr.Expr)
+	case *sqlparser.IsExpr:
+		expr.Expr, err = r.rewriteExpr(expr.Expr)
+	case *sqlparser.UnaryExpr:
+		expr.Expr, err = r.rewriteExpr(expr.Expr)
+	case *sqlparser.CollateExpr:
+		expr.Expr, err = r.rewriteExpr(expr.Expr)
+	case *sqlparser.ConvertExpr:
+		expr.Expr, err = r.rewriteExpr(expr.Expr)
+	case *sqlparser.BinaryExpr:
+		expr.Left, expr.Right, err = r.rewritePair(expr.Left, expr.Right)
+	case *sqlparser.ComparisonExpr:
+		expr.Left, expr.Right, err = r.rewritePair(expr.Left, expr.Right)
+	case *sqlparser.RangeCond:
+		if expr.Left, err = r.rewriteExpr(expr.Left); err == nil {
+			expr.From, expr.To, err = r.rewritePair(expr.From, expr.To)
+		}
+	case *sqlparser.CaseExpr:
+		if expr.Expr != nil {
+			if expr.Expr, err = r.rewriteExpr(expr.Expr); err != nil {
+				return nil, err
+			}
+		}
+		for _, when := range expr.Whens {
+			if when.Cond, when.Val, err = r.rewritePair(when.Cond, when.Val); err != nil {
+				return nil, err
+			}
+		}
+		if expr.Else != nil {
+			expr.Else, err = r.rewriteExpr(expr.Else)
+		}
+	case sqlparser.ValTuple:
+		err = r.rewriteExprs(expr)
+	case *sqlparser.FuncExpr:
+		return r.rewriteFunc(expr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return expr, nil
+}
+
+// rewriteFunc replaces NEXTVAL(seq), LAST_INSERT_ID() and LAST_INSERT_ID(N) by the values.
+func (r *sequenceRewriter) rewriteFunc(expr *sqlparser.FuncExpr) (sqlparser.Expr, error) {
+	switch {
+	case expr.Name.EqualString("nextval"):
+		if !r.nextval {
+			return nil, errors.New("unsupported: nextval.only.in.insert.values.or.select.without.tables")
+		}
+		if len(expr.Exprs) != 1 {
+			return nil, errors.New("Incorrect parameter count in the call to native function 'nextval'")
+		}
+		arg, ok := expr.Exprs[0].(*sqlparser.AliasedExpr)
+		if !ok {
+			return nil, errors.Errorf("unsupported: nextval.argument[%s].must.be.the.sequence.name", sqlparser.String(expr.Exprs[0]))
+		}
+		col, ok := arg.Expr.(*sqlparser.ColName)
+		if !ok {
+			return nil, errors.Errorf("unsupported: nextval.argument[%s].must.be.the.sequence.name", sqlparser.String(arg.Expr))
+		}
+		database := r.database
+		if !col.Qualifier.Name.IsEmpty() {
+			database = col.Qualifier.Name.String()
+		}
+		values, err := r.router.NextVal(database, col.Name.String(), 1)
+		if err != nil {
+			return nil, err
+		}
+		r.replaced++
+		return intValue(values[0]), nil
+	case expr.Name.EqualString("last_insert_id") && len(expr.Exprs) == 0:
+		r.replaced++
+		return sqlparser.NewIntVal([]byte(strconv.FormatUint(r.lastInsertID, 10))), nil
+	case expr.Name.EqualString("last_insert_id"):
+		// LAST_INSERT_ID(expr) returns the value and keeps it as the LAST_INSERT_ID() of the session,
+		// the value must be known here since the backend connections are not the session's.
+		if len(expr.Exprs) != 1 {
+			return nil, errors.New("Incorrect parameter count in the call to native function 'last_insert_id'")
+		}
+		id, ok := lastInsertIDArg(expr.Exprs[0])
+		if !ok {
+			return nil, errors.Errorf("unsupported: last_insert_id.argument[%s].must.be.an.unsigned.integer", sqlparser.String(expr.Exprs[0]))
+		}
+		r.lastInsertID = id
+		r.replaced++
+		return sqlparser.NewIntVal([]byte(strconv.FormatUint(id, 10))), nil
+	}
+
+	for _, e := range expr.Exprs {
+		if e, ok := e.(*sqlparser.AliasedExpr); ok {
+			var err error
+			if e.Expr, err = r.rewriteExpr(e.Expr); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return expr, nil
+}
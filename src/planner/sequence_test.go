@@ -0,0 +1,170 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"testing"
+
+	"router"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestRewriteSequences(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+	err := route.AddForTest(database, router.MockTableAConfig(), router.MockTableBConfig())
+	assert.Nil(t, err)
+	err = route.SetAutoIncrement(database, "A", "id", 1)
+	assert.Nil(t, err)
+	err = route.SetColumns(database, "A", []string{"b", "id"})
+	assert.Nil(t, err)
+	err = route.CreateSequence(database, "s1", 100, 1, 10)
+	assert.Nil(t, err)
+
+	tests := []struct {
+		query        string
+		out          string
+		insertID     uint64
+		lastInsertID uint64
+		unchanged    bool
+	}{
+		{
+			query:    "insert into A(b) values(1), (2)",
+			out:      "insert into A(b, id) values (1, 1), (2, 2)",
+			insertID: 1,
+		},
+		{
+			query:    "insert into sbtest.A(id, b) values(null, 1), (10, 2), (0, 3), (default, 4)",
+			out:      "insert into sbtest.A(id, b) values (3, 1), (10, 2), (4, 3), (5, 4)",
+			insertID: 3,
+		},
+		{
+			query:    "insert into A values(1, null), (2, 10), (3, default)",
+			out:      "insert into A(b, id) values (1, 6), (2, 10), (3, 7)",
+			insertID: 6,
+		},
+		{
+			query:     "insert into A(id, b) values(10, 1)",
+			out:       "insert into A(id, b) values (10, 1)",
+			unchanged: true,
+		},
+		{
+			query: "insert into B(id, b) values(nextval(s1), nextval(sbtest.s1) + 1) on duplicate key update b = last_insert_id()",
+			out:   "insert into B(id, b) values (100, 101 + 1) on duplicate key update b = 7",
+		},
+		{
+			query: "select nextval(s1), nextval(s1) as x, last_insert_id() from dual",
+			out:   "select 102 as `nextval(s1)`, 103 as x, 7 as `last_insert_id()` from dual",
+		},
+		{
+			query: "select * from B where id = last_insert_id()",
+			out:   "select * from B where id = 7",
+		},
+		{
+			query: "update B set b = last_insert_id() + 1 where id in (last_insert_id())",
+			out:   "update B set b = 7 + 1 where id in (7)",
+		},
+		{
+			query: "delete from B where id = last_insert_id()",
+			out:   "delete from B where id = 7",
+		},
+		{
+			query:        "select last_insert_id(3), last_insert_id(), b from B",
+			out:          "select 3 as `last_insert_id(3)`, 3 as `last_insert_id()`, b from B",
+			lastInsertID: 3,
+		},
+		{
+			query:        "update B set b = last_insert_id(10) where id = 1",
+			out:          "update B set b = 10 where id = 1",
+			lastInsertID: 10,
+		},
+	}
+	for _, test := range tests {
+		node, err := sqlparser.Parse(test.query)
+		assert.Nil(t, err)
+		rewritten, insertID, lastInsertID, err := RewriteSequences(database, node, route, 7)
+		assert.Nil(t, err)
+		assert.Equal(t, !test.unchanged, rewritten, test.query)
+		assert.Equal(t, test.out, sqlparser.String(node))
+		assert.Equal(t, test.insertID, insertID)
+		if test.lastInsertID == 0 {
+			test.lastInsertID = 7
+		}
+		assert.Equal(t, test.lastInsertID, lastInsertID, test.query)
+	}
+}
+
+func TestRewriteSequencesError(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+	err := route.AddForTest(database, router.MockTableAConfig(), router.MockTableBConfig())
+	assert.Nil(t, err)
+	err = route.SetAutoIncrement(database, "A", "id", 1)
+	assert.Nil(t, err)
+	err = route.CreateSequence(database, "s1", 1, 1, 10)
+	assert.Nil(t, err)
+
+	tests := []struct {
+		query string
+		err   string
+	}{
+		{
+			query: "select nextval(s1) from B",
+			err:   "unsupported: nextval.only.in.insert.values.or.select.without.tables",
+		},
+		{
+			query: "update B set b = nextval(s1)",
+			err:   "unsupported: nextval.only.in.insert.values.or.select.without.tables",
+		},
+		{
+			query: "select nextval(s2)",
+			err:   "Unknown SEQUENCE: 'sbtest.s2'",
+		},
+		{
+			query: "select nextval(s1, 1)",
+			err:   "Incorrect parameter count in the call to native function 'nextval'",
+		},
+		{
+			query: "select nextval(1)",
+			err:   "unsupported: nextval.argument[1].must.be.the.sequence.name",
+		},
+		{
+			query: "insert into A(b) select b from B",
+			err:   "unsupported: auto.increment.column[id].missing.in.insert.select",
+		},
+		{
+			query: "update B set b = last_insert_id(b + 1)",
+			err:   "unsupported: last_insert_id.argument[b + 1].must.be.an.unsigned.integer",
+		},
+		{
+			query: "select last_insert_id(-1)",
+			err:   "unsupported: last_insert_id.argument[-1].must.be.an.unsigned.integer",
+		},
+		{
+			query: "select last_insert_id(1, 2)",
+			err:   "Incorrect parameter count in the call to native function 'last_insert_id'",
+		},
+	}
+	for _, test := range tests {
+		node, err := sqlparser.Parse(test.query)
+		assert.Nil(t, err)
+		_, _, _, err = RewriteSequences(database, node, route, 0)
+		assert.NotNil(t, err, test.query)
+		assert.Equal(t, test.err, err.Error())
+	}
+}
@@ -0,0 +1,267 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"router"
+	"xcontext"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// ShardKeyMove represents the change of the shard key, the rows can't be updated in place
+// since they may belong to other partitions. The rows of every step are selected for update
+// with the new values, deleted and inserted with the new values into their partitions, all in
+// one XA transaction.
+type ShardKeyMove struct {
+	log    *xlog.Log
+	router *router.Router
+
+	comments sqlparser.Comments
+
+	// Database and Table are the target table.
+	Database string
+	Table    string
+
+	// ShardKeys are the sharding key columns of the target table.
+	ShardKeys []string
+
+	// Exprs are the assignments, the new values are selected after the columns of the rows.
+	Exprs sqlparser.UpdateExprs
+
+	// Columns are the columns of the rows of INSERT ... ON DUPLICATE KEY UPDATE.
+	Columns sqlparser.Columns
+
+	// Steps are executed in order.
+	Steps []*MoveStep
+}
+
+// MoveStep is the move of the rows matched by the Where.
+type MoveStep struct {
+	// Where is the condition of the rows on the logical table.
+	Where *sqlparser.Where
+
+	// Selects and Deletes are the querys on the segments.
+	Selects []xcontext.QueryTuple
+	Deletes []xcontext.QueryTuple
+
+	// Row is the row of INSERT ... ON DUPLICATE KEY UPDATE which is inserted if nothing
+	// is selected, nil if it's UPDATE.
+	Row sqlparser.ValTuple
+}
+
+// newShardKeyMove creates the move of the table.
+func newShardKeyMove(log *xlog.Log, r *router.Router, comments sqlparser.Comments, database, table string, shardKeys []string, exprs sqlparser.UpdateExprs) *ShardKeyMove {
+	return &ShardKeyMove{
+		log:       log,
+		router:    r,
+		comments:  comments,
+		Database:  database,
+		Table:     table,
+		ShardKeys: shardKeys,
+		Exprs:     exprs,
+	}
+}
+
+// addStep adds the step of the rows matched by the where, the querys are built with
+// the assignments as they are formatted now.
+func (m *ShardKeyMove) addStep(where *sqlparser.Where, row sqlparser.ValTuple) error {
+	routing, err := getRouting(m.Database, m.Table, m.ShardKeys, where, m.router)
+	if err != nil {
+		return err
+	}
+
+	values := m.newValues()
+	step := &MoveStep{Where: where, Row: row}
+	for _, segment := range routing.segments {
+		segmentWhere := routing.rewriteWhere(where, segment)
+		buf := sqlparser.NewTrackedBuffer(nil)
+		buf.Myprintf("select %v*, %s from %s.%s%v for update", m.comments, strings.Join(values, ", "), m.Database, segment.Table, segmentWhere)
+		step.Selects = append(step.Selects, xcontext.QueryTuple{
+			Query:   buf.String(),
+			Backend: segment.Backend,
+			Range:   segment.Range.String(),
+		})
+
+		buf = sqlparser.NewTrackedBuffer(nil)
+		buf.Myprintf("delete %vfrom %s.%s%v", m.comments, m.Database, segment.Table, segmentWhere)
+		step.Deletes = append(step.Deletes, xcontext.QueryTuple{
+			Query:   buf.String(),
+			Backend: segment.Backend,
+			Range:   segment.Range.String(),
+		})
+	}
+	m.Steps = append(m.Steps, step)
+	return nil
+}
+
+// newValues returns the new values of the assignments, which are applied from left to right
+// as MySQL does, so the columns assigned before are replaced by their new values.
+func (m *ShardKeyMove) newValues() []string {
+	values := make([]string, 0, len(m.Exprs))
+	assigned := make(map[string]string, len(m.Exprs))
+	for _, expr := range m.Exprs {
+		buf := sqlparser.NewTrackedBuffer(func(buf *sqlparser.TrackedBuffer, node sqlparser.SQLNode) {
+			if col, ok := node.(*sqlparser.ColName); ok {
+				if value, ok := assigned[col.Name.Lowered()]; ok {
+					buf.Myprintf("(%s)", value)
+					return
+				}
+			}
+			node.Format(buf)
+		})
+		buf.Myprintf("%v", expr.Expr)
+		value := buf.String()
+		values = append(values, value)
+		assigned[expr.Name.Name.Lowered()] = value
+	}
+	return values
+}
+
+// NewRows returns the fields of the table columns and the rows with the new values,
+// the selected rows are the columns followed by the new values. Also returns the number
+// of the rows whose values are changed.
+func (m *ShardKeyMove) NewRows(fields []*querypb.Field, rows [][]sqltypes.Value) ([]*querypb.Field, [][]sqltypes.Value, int, error) {
+	n := len(fields) - len(m.Exprs)
+	if n <= 0 {
+		return nil, nil, 0, errors.Errorf("shard.key.move[%s].columns.mismatch", m.Table)
+	}
+	idxs := make([]int, 0, len(m.Exprs))
+	for _, expr := range m.Exprs {
+		idx := -1
+		for i, field := range fields[:n] {
+			if strings.EqualFold(field.Name, expr.Name.Name.String()) {
+				idx = i
+				break
+			}
+		}
+		if idx == -1 {
+			return nil, nil, 0, errors.Errorf("Unknown column '%s' in 'field list'", expr.Name.Name.String())
+		}
+		idxs = append(idxs, idx)
+	}
+
+	changed := 0
+	newRows := make([][]sqltypes.Value, 0, len(rows))
+	for _, row := range rows {
+		if len(row) != len(fields) {
+			return nil, nil, 0, errors.Errorf("shard.key.move[%s].columns.mismatch", m.Table)
+		}
+		newRow := make([]sqltypes.Value, n)
+		copy(newRow, row[:n])
+		change := false
+		for i, idx := range idxs {
+			v := row[n+i]
+			if v.IsNull() != newRow[idx].IsNull() || string(v.Raw()) != string(newRow[idx].Raw()) {
+				change = true
+			}
+			newRow[idx] = v
+		}
+		if change {
+			changed++
+		}
+		newRows = append(newRows, newRow)
+	}
+	return fields[:n], newRows, changed, nil
+}
+
+// InsertQuerys returns the querys which insert the rows into their partitions,
+// and the insert on the logical table for the binlog.
+func (m *ShardKeyMove) InsertQuerys(fields []*querypb.Field, rows [][]sqltypes.Value) ([]xcontext.QueryTuple, string, error) {
+	columns := make(sqlparser.Columns, 0, len(fields))
+	for _, field := range fields {
+		columns = append(columns, sqlparser.NewColIdent(field.Name))
+	}
+	values := make(sqlparser.Values, 0, len(rows))
+	for _, row := range rows {
+		tuple := make(sqlparser.ValTuple, 0, len(row))
+		for _, v := range row {
+			tuple = append(tuple, valueExpr(v))
+		}
+		values = append(values, tuple)
+	}
+	return m.insertQuerys(columns, values)
+}
+
+// RowQuerys returns the querys which insert the row of the step,
+// and the insert on the logical table for the binlog.
+func (m *ShardKeyMove) RowQuerys(step *MoveStep) ([]xcontext.QueryTuple, string, error) {
+	return m.insertQuerys(m.Columns, sqlparser.Values{step.Row})
+}
+
+func (m *ShardKeyMove) insertQuerys(columns sqlparser.Columns, values sqlparser.Values) ([]xcontext.QueryTuple, string, error) {
+	node := &sqlparser.Insert{
+		Action:   sqlparser.InsertStr,
+		Comments: m.comments,
+		Table:    sqlparser.TableName{Name: sqlparser.NewTableIdent(m.Table), Qualifier: sqlparser.NewTableIdent(m.Database)},
+		Columns:  columns,
+		Rows:     values,
+	}
+	query := sqlparser.String(node)
+	plan := NewInsertPlan(m.log, m.Database, query, node, m.router)
+	if err := plan.Build(); err != nil {
+		return nil, "", err
+	}
+	return plan.Querys, query, nil
+}
+
+// DeleteQuery returns the delete of the step on the logical table for the binlog.
+func (m *ShardKeyMove) DeleteQuery(step *MoveStep) string {
+	buf := sqlparser.NewTrackedBuffer(nil)
+	buf.Myprintf("delete %vfrom %s.%s%v", m.comments, m.Database, m.Table, step.Where)
+	return buf.String()
+}
+
+// JSON returns the move info.
+func (m *ShardKeyMove) JSON() json.RawMessage {
+	type step struct {
+		Selects []xcontext.QueryTuple `json:",omitempty"`
+		Deletes []xcontext.QueryTuple `json:",omitempty"`
+		Row     string                `json:",omitempty"`
+	}
+	type explain struct {
+		Table string `json:",omitempty"`
+		Steps []step `json:",omitempty"`
+	}
+	exp := &explain{Table: m.Table}
+	for _, s := range m.Steps {
+		st := step{Selects: s.Selects, Deletes: s.Deletes}
+		if s.Row != nil {
+			st.Row = sqlparser.String(s.Row)
+		}
+		exp.Steps = append(exp.Steps, st)
+	}
+	bout, err := json.Marshal(exp)
+	if err != nil {
+		return json.RawMessage(fmt.Sprintf("%q", err.Error()))
+	}
+	return json.RawMessage(bout)
+}
+
+// Size returns the memory size.
+func (m *ShardKeyMove) Size() int {
+	size := 0
+	for _, step := range m.Steps {
+		for _, q := range step.Selects {
+			size += len(q.Query)
+		}
+		for _, q := range step.Deletes {
+			size += len(q.Query)
+		}
+	}
+	return size
+}
@@ -0,0 +1,350 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+// SubqueryEvaluator used to evaluate the uncorrelated subquery and returns the result.
+type SubqueryEvaluator func(node *sqlparser.Select) (*sqltypes.Result, error)
+
+// subqueryRewriter tuple.
+type subqueryRewriter struct {
+	eval      SubqueryEvaluator
+	rewritten bool
+}
+
+// RewriteSubqueries used to evaluate the uncorrelated subqueries in the statement, and substitutes
+// the results as the literals, the nested subqueries are evaluated first.
+// Supports:
+// 1. IN/NOT IN subquery: 'a in (select ...)' rewritten to 'a in (v1, v2 ...)'
+// 2. EXISTS subquery: rewritten to true or false
+// 3. Scalar subquery: rewritten to the value, or NULL if the subquery returns no rows
+// The subqueries in the from clause(derived tables) are kept as they are.
+// Returns true if any subquery is rewritten.
+func RewriteSubqueries(node sqlparser.Statement, eval SubqueryEvaluator) (bool, error) {
+	r := &subqueryRewriter{eval: eval}
+	var err error
+	switch node := node.(type) {
+	case *sqlparser.Select:
+		err = r.rewriteSelect(node)
+	case *sqlparser.Union:
+		err = r.rewriteUnion(node)
+	case *sqlparser.Update:
+		for _, update := range node.Exprs {
+			if update.Expr, err = r.rewriteExpr(update.Expr); err != nil {
+				return false, err
+			}
+		}
+		err = r.rewriteWhere(node.Where)
+	case *sqlparser.Delete:
+		err = r.rewriteWhere(node.Where)
+	}
+	if err != nil {
+		return false, err
+	}
+	return r.rewritten, nil
+}
+
+func (r *subqueryRewriter) rewriteSelect(node *sqlparser.Select) error {
+	var err error
+	for _, expr := range node.SelectExprs {
+		if expr, ok := expr.(*sqlparser.AliasedExpr); ok {
+			if expr.Expr, err = r.rewriteExpr(expr.Expr); err != nil {
+				return err
+			}
+		}
+	}
+	if err := r.rewriteTableExprs(node.From); err != nil {
+		return err
+	}
+	if err := r.rewriteWhere(node.Where); err != nil {
+		return err
+	}
+	return r.rewriteWhere(node.Having)
+}
+
+// rewriteUnion rewrites the subqueries in the arms of the union.
+func (r *subqueryRewriter) rewriteUnion(node sqlparser.SelectStatement) error {
+	switch node := node.(type) {
+	case *sqlparser.Select:
+		return r.rewriteSelect(node)
+	case *sqlparser.ParenSelect:
+		return r.rewriteUnion(node.Select)
+	case *sqlparser.Union:
+		if err := r.rewriteUnion(node.Left); err != nil {
+			return err
+		}
+		return r.rewriteUnion(node.Right)
+	}
+	return nil
+}
+
+func (r *subqueryRewriter) rewriteWhere(where *sqlparser.Where) error {
+	var err error
+	if where != nil {
+		where.Expr, err = r.rewriteExpr(where.Expr)
+	}
+	return err
+}
+
+// rewriteTableExprs rewrites the subqueries in the join conditions.
+func (r *subqueryRewriter) rewriteTableExprs(exprs sqlparser.TableExprs) error {
+	var err error
+	for _, expr := range exprs {
+		switch expr := expr.(type) {
+		case *sqlparser.JoinTableExpr:
+			if err = r.rewriteTableExprs(sqlparser.TableExprs{expr.LeftExpr, expr.RightExpr}); err != nil {
+				return err
+			}
+			if expr.On != nil {
+				if expr.On, err = r.rewriteExpr(expr.On); err != nil {
+					return err
+				}
+			}
+		case *sqlparser.ParenTableExpr:
+			if err = r.rewriteTableExprs(expr.Exprs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *subqueryRewriter) rewriteExprs(exprs []sqlparser.Expr) error {
+	var err error
+	for i := range exprs {
+		if exprs[i], err = r.rewriteExpr(exprs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewriteExpr returns the expr with the subqueries replaced by the literals.
+func (r *subqueryRewriter) rewriteExpr(expr sqlparser.Expr) (sqlparser.Expr, error) {
+	var err error
+	switch expr := expr.(type) {
+	case *sqlparser.AndExpr:
+		expr.Left, expr.Right, err = r.rewritePair(expr.Left, expr.Right)
+	case *sqlparser.OrExpr:
+		expr.Left, expr.Right, err = r.rewritePair(expr.Left, expr.Right)
+	case *sqlparser.NotExpr:
+		expr.Expr, err = r.rewriteExpr(expr.Expr)
+	case *sqlparser.ParenExpr:
+		expr.Expr, err = r.rewriteExpr(expr.Expr)
+	case *sqlparser.IsExpr:
+		expr.Expr, err = r.rewriteExpr(expr.Expr)
+	case *sqlparser.UnaryExpr:
+		expr.Expr, err = r.rewriteExpr(expr.Expr)
+	case *sqlparser.IntervalExpr:
+		expr.Expr, err = r.rewriteExpr(expr.Expr)
+	case *sqlparser.CollateExpr:
+		expr.Expr, err = r.rewriteExpr(expr.Expr)
+	case *sqlparser.ConvertExpr:
+		expr.Expr, err = r.rewriteExpr(expr.Expr)
+	case *sqlparser.ConvertUsingExpr:
+		expr.Expr, err = r.rewriteExpr(expr.Expr)
+	case *sqlparser.BinaryExpr:
+		expr.Left, expr.Right, err = r.rewritePair(expr.Left, expr.Right)
+	case *sqlparser.RangeCond:
+		if expr.Left, err = r.rewriteExpr(expr.Left); err == nil {
+			expr.From, expr.To, err = r.rewritePair(expr.From, expr.To)
+		}
+	case *sqlparser.ComparisonExpr:
+		return r.rewriteComparison(expr)
+	case *sqlparser.FuncExpr:
+		for _, e := range expr.Exprs {
+			if e, ok := e.(*sqlparser.AliasedExpr); ok {
+				if e.Expr, err = r.rewriteExpr(e.Expr); err != nil {
+					return nil, err
+				}
+			}
+		}
+	case *sqlparser.CaseExpr:
+		if expr.Expr != nil {
+			if expr.Expr, err = r.rewriteExpr(expr.Expr); err != nil {
+				return nil, err
+			}
+		}
+		for _, when := range expr.Whens {
+			if when.Cond, when.Val, err = r.rewritePair(when.Cond, when.Val); err != nil {
+				return nil, err
+			}
+		}
+		if expr.Else != nil {
+			expr.Else, err = r.rewriteExpr(expr.Else)
+		}
+	case sqlparser.ValTuple:
+		err = r.rewriteExprs(expr)
+	case *sqlparser.ExistsExpr:
+		qr, err := r.evaluate(expr.Subquery)
+		if err != nil {
+			return nil, err
+		}
+		return sqlparser.BoolVal(len(qr.Rows) > 0), nil
+	case *sqlparser.Subquery:
+		return r.scalar(expr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return expr, nil
+}
+
+func (r *subqueryRewriter) rewritePair(left, right sqlparser.Expr) (sqlparser.Expr, sqlparser.Expr, error) {
+	left, err := r.rewriteExpr(left)
+	if err != nil {
+		return nil, nil, err
+	}
+	right, err = r.rewriteExpr(right)
+	if err != nil {
+		return nil, nil, err
+	}
+	return left, right, nil
+}
+
+// rewriteComparison rewrites the IN/NOT IN subquery to the value list, the others are treated as scalar.
+func (r *subqueryRewriter) rewriteComparison(expr *sqlparser.ComparisonExpr) (sqlparser.Expr, error) {
+	var err error
+	if expr.Left, err = r.rewriteExpr(expr.Left); err != nil {
+		return nil, err
+	}
+	sub, ok := expr.Right.(*sqlparser.Subquery)
+	if !ok || (expr.Operator != sqlparser.InStr && expr.Operator != sqlparser.NotInStr) {
+		if expr.Right, err = r.rewriteExpr(expr.Right); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	}
+
+	qr, err := r.evaluate(sub)
+	if err != nil {
+		return nil, err
+	}
+	columns := 1
+	if tuple, ok := expr.Left.(sqlparser.ValTuple); ok {
+		columns = len(tuple)
+	}
+	if len(qr.Fields) != columns {
+		return nil, errors.Errorf("Operand should contain %d column(s)", columns)
+	}
+	// 'a in (empty)' is always false, even if 'a' is NULL.
+	if len(qr.Rows) == 0 {
+		return sqlparser.BoolVal(expr.Operator == sqlparser.NotInStr), nil
+	}
+
+	values := make(sqlparser.ValTuple, 0, len(qr.Rows))
+	for _, row := range qr.Rows {
+		if columns == 1 {
+			values = append(values, valueExpr(row[0]))
+			continue
+		}
+		tuple := make(sqlparser.ValTuple, 0, columns)
+		for _, v := range row {
+			tuple = append(tuple, valueExpr(v))
+		}
+		values = append(values, tuple)
+	}
+	expr.Right = values
+	return expr, nil
+}
+
+// scalar returns the only value of the scalar subquery.
+func (r *subqueryRewriter) scalar(sub *sqlparser.Subquery) (sqlparser.Expr, error) {
+	qr, err := r.evaluate(sub)
+	if err != nil {
+		return nil, err
+	}
+	if len(qr.Fields) != 1 {
+		return nil, errors.New("Operand should contain 1 column(s)")
+	}
+	switch len(qr.Rows) {
+	case 0:
+		return &sqlparser.NullVal{}, nil
+	case 1:
+		return valueExpr(qr.Rows[0][0]), nil
+	}
+	return nil, errors.New("Subquery returns more than 1 row")
+}
+
+// evaluate checks the subquery is uncorrelated and evaluates it.
+func (r *subqueryRewriter) evaluate(sub *sqlparser.Subquery) (*sqltypes.Result, error) {
+	node, ok := sub.Select.(*sqlparser.Select)
+	if !ok {
+		return nil, errors.Errorf("unsupported: subquery[%s]", sqlparser.String(sub))
+	}
+	// Nested subqueries first.
+	if err := r.rewriteSelect(node); err != nil {
+		return nil, err
+	}
+	if correlated(node) {
+		return nil, errors.Errorf("unsupported: correlated.subquery[%s]", sqlparser.String(sub))
+	}
+	r.rewritten = true
+	return r.eval(node)
+}
+
+// correlated returns true if the subquery references the columns qualified by the tables outside.
+// The unqualified columns are treated as the columns of the subquery tables.
+func correlated(node *sqlparser.Select) bool {
+	names := make(map[string]bool)
+	var collect func(exprs sqlparser.TableExprs)
+	collect = func(exprs sqlparser.TableExprs) {
+		for _, expr := range exprs {
+			switch expr := expr.(type) {
+			case *sqlparser.AliasedTableExpr:
+				if !expr.As.IsEmpty() {
+					names[expr.As.String()] = true
+				} else if tn, ok := expr.Expr.(sqlparser.TableName); ok {
+					names[tn.Name.String()] = true
+				}
+			case *sqlparser.JoinTableExpr:
+				collect(sqlparser.TableExprs{expr.LeftExpr, expr.RightExpr})
+			case *sqlparser.ParenTableExpr:
+				collect(expr.Exprs)
+			}
+		}
+	}
+	collect(node.From)
+
+	found := false
+	_ = sqlparser.Walk(func(n sqlparser.SQLNode) (kontinue bool, err error) {
+		switch n := n.(type) {
+		case *sqlparser.Subquery:
+			// The derived tables are checked by themselves.
+			return false, nil
+		case *sqlparser.ColName:
+			if !n.Qualifier.IsEmpty() && !names[n.Qualifier.Name.String()] {
+				found = true
+				return false, nil
+			}
+		}
+		return true, nil
+	}, node)
+	return found
+}
+
+// valueExpr returns the literal of the value.
+func valueExpr(v sqltypes.Value) sqlparser.Expr {
+	switch {
+	case v.IsNull():
+		return &sqlparser.NullVal{}
+	case v.IsIntegral():
+		return sqlparser.NewIntVal(v.Raw())
+	case v.IsFloat() || v.Type() == querypb.Type_DECIMAL:
+		return sqlparser.NewFloatVal(v.Raw())
+	}
+	return sqlparser.NewStrVal(v.Raw())
+}
@@ -0,0 +1,126 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+func mockSubqueryEvaluator(results map[string]*sqltypes.Result) SubqueryEvaluator {
+	return func(node *sqlparser.Select) (*sqltypes.Result, error) {
+		query := sqlparser.String(node)
+		qr, ok := results[query]
+		if !ok {
+			return nil, errors.Errorf("mock.subquery[%s].not.found", query)
+		}
+		return qr, nil
+	}
+}
+
+func TestRewriteSubqueries(t *testing.T) {
+	ints := &sqltypes.Result{
+		Fields: []*querypb.Field{{Name: "uid", Type: querypb.Type_INT64}},
+		Rows: [][]sqltypes.Value{
+			{sqltypes.NewInt64(1)},
+			{sqltypes.NewInt64(3)},
+		},
+	}
+	one := &sqltypes.Result{
+		Fields: []*querypb.Field{{Name: "name", Type: querypb.Type_VARCHAR}},
+		Rows:   [][]sqltypes.Value{{sqltypes.NewVarChar("x'y")}},
+	}
+	pairs := &sqltypes.Result{
+		Fields: []*querypb.Field{{Name: "a", Type: querypb.Type_INT64}, {Name: "b", Type: querypb.Type_FLOAT64}},
+		Rows:   [][]sqltypes.Value{{sqltypes.NewInt64(1), sqltypes.NULL}},
+	}
+	empty := &sqltypes.Result{
+		Fields: []*querypb.Field{{Name: "uid", Type: querypb.Type_INT64}},
+	}
+	eval := mockSubqueryEvaluator(map[string]*sqltypes.Result{
+		"select uid from vip":                            ints,
+		"select name from vip where uid = 1":             one,
+		"select a, b from vip":                           pairs,
+		"select uid from vip where uid > 10":             empty,
+		"select uid from vip as v where v.uid in (1, 3)": empty,
+	})
+
+	querys := []string{
+		"select * from A where id in (select uid from vip)",
+		"select id, (select name from vip where uid = 1) as name from A",
+		"select * from A where (a, b) in (select a, b from vip) and id not in (select uid from vip where uid > 10)",
+		"select * from A where exists (select uid from vip where uid > 10) or id = (select name from vip where uid = 1)",
+		"update A set name = (select name from vip where uid = 1) where id in (select uid from vip)",
+		"delete from A where id in (select uid from vip where uid > 10)",
+		"select * from A join B on A.id = B.id and B.id in (select uid from vip) where A.id > 1",
+		"select * from A where id in (select uid from vip as v where v.uid in (select uid from vip))",
+		"select id from A where id in (select uid from vip) union (select id from B where id in (select uid from vip where uid > 10))",
+		"select * from A where id in (1, 2)",
+	}
+	wants := []string{
+		"select * from A where id in (1, 3)",
+		"select id, 'x\\'y' as name from A",
+		"select * from A where (a, b) in ((1, null)) and true",
+		"select * from A where false or id = 'x\\'y'",
+		"update A set name = 'x\\'y' where id in (1, 3)",
+		"delete from A where false",
+		"select * from A join B on A.id = B.id and B.id in (1, 3) where A.id > 1",
+		"select * from A where false",
+		"select id from A where id in (1, 3) union (select id from B where false)",
+		"select * from A where id in (1, 2)",
+	}
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		rewritten, err := RewriteSubqueries(node, eval)
+		assert.Nil(t, err, query)
+		assert.Equal(t, i != len(querys)-1, rewritten)
+		assert.Equal(t, wants[i], sqlparser.String(node))
+	}
+}
+
+func TestRewriteSubqueriesError(t *testing.T) {
+	ints := &sqltypes.Result{
+		Fields: []*querypb.Field{{Name: "uid", Type: querypb.Type_INT64}},
+		Rows: [][]sqltypes.Value{
+			{sqltypes.NewInt64(1)},
+			{sqltypes.NewInt64(3)},
+		},
+	}
+	eval := mockSubqueryEvaluator(map[string]*sqltypes.Result{
+		"select uid from vip": ints,
+	})
+
+	querys := []string{
+		"select * from A where id = (select uid from vip)",
+		"select * from A where (a, b) in (select uid from vip)",
+		"select * from A where id in (select uid from vip where vip.uid = A.id)",
+		"select * from A where id in (select uid from vip union select uid from vip)",
+		"select * from A where id in (select uid from xx)",
+	}
+	wants := []string{
+		"Subquery returns more than 1 row",
+		"Operand should contain 2 column(s)",
+		"unsupported: correlated.subquery[(select uid from vip where vip.uid = A.id)]",
+		"unsupported: subquery[(select uid from vip union select uid from vip)]",
+		"mock.subquery[select uid from xx].not.found",
+	}
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		_, err = RewriteSubqueries(node, eval)
+		assert.Equal(t, wants[i], err.Error())
+	}
+}
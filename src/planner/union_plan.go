@@ -0,0 +1,196 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"encoding/json"
+	"strings"
+
+	"router"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/hack"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+var (
+	_ Plan = &UnionPlan{}
+)
+
+// UnionPlan represents the UNION [ALL|DISTINCT] plan.
+// Every arm is planned independently, the rows of the arms are combined in the proxy,
+// then the ORDER BY and LIMIT of the union are applied.
+// The unions are left-associative, so 'a UNION ALL b UNION c' is planned as '(a UNION ALL b) UNION c',
+// the DISTINCT union removes the duplicates of all the arms on its left.
+type UnionPlan struct {
+	log *xlog.Log
+
+	// router
+	router *router.Router
+
+	// union ast
+	node *sqlparser.Union
+
+	// database
+	database string
+
+	// raw query
+	RawQuery string
+
+	// type
+	typ PlanType
+
+	// Left and Right are the arms, the SelectPlan, JoinPlan or the nested UnionPlan.
+	Left  Plan
+	Right Plan
+
+	// Distinct is true if the duplicate rows are removed.
+	Distinct bool
+
+	// OrderBy is the order by clause over the union, by the column names of the first arm or the positions.
+	OrderBy sqlparser.OrderBy
+
+	// Limit is the limit clause over the union, nil if none.
+	Limit *LimitPlan
+
+	// children are the plans of the arms.
+	children *PlanTree
+}
+
+// NewUnionPlan used to create UnionPlan.
+func NewUnionPlan(log *xlog.Log, database string, query string, node *sqlparser.Union, router *router.Router) *UnionPlan {
+	return &UnionPlan{
+		log:      log,
+		node:     node,
+		router:   router,
+		database: database,
+		RawQuery: query,
+		typ:      PlanTypeUnion,
+		children: NewPlanTree(),
+	}
+}
+
+// selectStatementPlan returns the plan of the select statement, the SelectPlan, the JoinPlan
+// if it's a cross-shard join, or the UnionPlan. The plan isn't built.
+func selectStatementPlan(log *xlog.Log, database string, node sqlparser.SelectStatement, router *router.Router) (Plan, error) {
+	switch node := node.(type) {
+	case *sqlparser.Select:
+		query := sqlparser.String(node)
+		plan := NewSelectPlan(log, database, query, node, router)
+		if plan.CrossShardJoin() {
+			return NewJoinPlan(log, database, query, node, router), nil
+		}
+		return plan, nil
+	case *sqlparser.ParenSelect:
+		return selectStatementPlan(log, database, node.Select, router)
+	case *sqlparser.Union:
+		return NewUnionPlan(log, database, sqlparser.String(node), node, router), nil
+	}
+	return nil, errors.Errorf("unsupported: select.statement[%s]", sqlparser.String(node))
+}
+
+// Build used to build the plans of the arms.
+func (p *UnionPlan) Build() error {
+	var err error
+	node := p.node
+
+	if node.Lock != "" {
+		return errors.Errorf("unsupported: lock.in.union[%s]", strings.TrimSpace(node.Lock))
+	}
+	if p.Left, err = selectStatementPlan(p.log, p.database, node.Left, p.router); err != nil {
+		return err
+	}
+	if p.Right, err = selectStatementPlan(p.log, p.database, node.Right, p.router); err != nil {
+		return err
+	}
+	for _, plan := range []Plan{p.Left, p.Right} {
+		if err := plan.Build(); err != nil {
+			return err
+		}
+		p.children.Add(plan)
+	}
+	p.Distinct = (node.Type != sqlparser.UnionAllStr)
+
+	// The order by is resolved by the column names of the union result.
+	for _, order := range node.OrderBy {
+		switch expr := order.Expr.(type) {
+		case *sqlparser.ColName:
+			if !expr.Qualifier.IsEmpty() {
+				return errors.Errorf("Table '%s' from one of the SELECTs cannot be used in global ORDER clause", expr.Qualifier.Name.String())
+			}
+		case *sqlparser.SQLVal:
+			if expr.Type != sqlparser.IntVal {
+				return errors.Errorf("unsupported: orderby[%s].in.union", sqlparser.String(expr))
+			}
+		default:
+			return errors.Errorf("unsupported: orderby[%s].in.union", sqlparser.String(expr))
+		}
+		p.OrderBy = append(p.OrderBy, order)
+	}
+	if node.Limit != nil {
+		p.Limit = NewLimitPlan(p.log, &sqlparser.Select{Limit: node.Limit})
+		if err := p.Limit.Build(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Type returns the type of the plan.
+func (p *UnionPlan) Type() PlanType {
+	return p.typ
+}
+
+// JSON returns the plan info.
+func (p *UnionPlan) JSON() string {
+	type limit struct {
+		Offset int
+		Limit  int
+	}
+
+	type explain struct {
+		RawQuery string          `json:",omitempty"`
+		Union    string          `json:",omitempty"`
+		Left     json.RawMessage `json:",omitempty"`
+		Right    json.RawMessage `json:",omitempty"`
+		OrderBy  string          `json:",omitempty"`
+		Limit    *limit          `json:",omitempty"`
+	}
+
+	exp := &explain{
+		RawQuery: p.RawQuery,
+		Union:    strings.ToUpper(p.node.Type),
+		Left:     json.RawMessage(p.Left.JSON()),
+		Right:    json.RawMessage(p.Right.JSON()),
+		OrderBy:  strings.TrimSpace(sqlparser.String(p.OrderBy)),
+	}
+	if p.Limit != nil {
+		exp.Limit = &limit{Offset: p.Limit.Offset, Limit: p.Limit.Limit}
+	}
+	bout, err := json.MarshalIndent(exp, "", "\t")
+	if err != nil {
+		return err.Error()
+	}
+	return hack.String(bout)
+}
+
+// Children returns the plans of the arms.
+func (p *UnionPlan) Children() *PlanTree {
+	return p.children
+}
+
+// Size returns the memory size.
+func (p *UnionPlan) Size() int {
+	size := len(p.RawQuery)
+	for _, plan := range p.children.Plans() {
+		size += plan.Size()
+	}
+	return size
+}
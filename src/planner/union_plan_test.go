@@ -0,0 +1,175 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package planner
+
+import (
+	"router"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestUnionPlan(t *testing.T) {
+	querys := []string{
+		"select id from A where id = 1 union all select id from B",
+		"select id, name from A union select id, name from B order by name desc, 1 limit 1, 2",
+		"(select id from A where id = 1 order by id limit 1) union distinct (select A.id from A join B on A.id = B.id)",
+		"select id from A where id = 1 union all select id from B union select id from B",
+	}
+	type want struct {
+		distinct bool
+		left     PlanType
+		right    PlanType
+		orderBy  int
+		limit    *LimitPlan
+	}
+	wants := []want{
+		{false, PlanTypeSelect, PlanTypeSelect, 0, nil},
+		{true, PlanTypeSelect, PlanTypeSelect, 2, &LimitPlan{Offset: 1, Limit: 2}},
+		{true, PlanTypeSelect, PlanTypeJoin, 0, nil},
+		{true, PlanTypeUnion, PlanTypeSelect, 0, nil},
+	}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableMConfig(), router.MockTableBConfig())
+	assert.Nil(t, err)
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := NewUnionPlan(log, database, query, node.(*sqlparser.Union), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+
+		want := wants[i]
+		assert.Equal(t, PlanTypeUnion, plan.Type())
+		assert.Equal(t, 2, len(plan.Children().Plans()))
+		assert.Equal(t, want.distinct, plan.Distinct)
+		assert.Equal(t, want.left, plan.Left.Type())
+		assert.Equal(t, want.right, plan.Right.Type())
+		assert.Equal(t, want.orderBy, len(plan.OrderBy))
+		if want.limit == nil {
+			assert.Nil(t, plan.Limit)
+		} else {
+			assert.Equal(t, want.limit.Offset, plan.Limit.Offset)
+			assert.Equal(t, want.limit.Limit, plan.Limit.Limit)
+		}
+		assert.True(t, plan.Size() > 0)
+	}
+
+	// The nested union.
+	{
+		query := querys[3]
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := NewUnionPlan(log, database, query, node.(*sqlparser.Union), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+		assert.False(t, plan.Left.(*UnionPlan).Distinct)
+		assert.Equal(t, "select id from sbtest.A6 as A where id = 1", plan.Left.(*UnionPlan).Left.(*SelectPlan).Querys[0].Query)
+	}
+}
+
+func TestUnionPlanJSON(t *testing.T) {
+	query := "select id from A where id = 1 union all select id from B order by id desc limit 1"
+	want := `{
+	"RawQuery": "select id from A where id = 1 union all select id from B order by id desc limit 1",
+	"Union": "UNION ALL",
+	"Left": {
+		"RawQuery": "select id from A where id = 1",
+		"Project": "id",
+		"Partitions": [
+			{
+				"Query": "select id from sbtest.A6 as A where id = 1",
+				"Backend": "backend6",
+				"Range": "[512-4096)"
+			}
+		]
+	},
+	"Right": {
+		"RawQuery": "select id from B",
+		"Project": "id",
+		"Partitions": [
+			{
+				"Query": "select id from sbtest.B0 as B",
+				"Backend": "backend0",
+				"Range": "[0-512)"
+			},
+			{
+				"Query": "select id from sbtest.B1 as B",
+				"Backend": "backend512",
+				"Range": "[512-4096)"
+			}
+		]
+	},
+	"OrderBy": "order by id desc",
+	"Limit": {
+		"Offset": 0,
+		"Limit": 1
+	}
+}`
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableMConfig(), router.MockTableBConfig())
+	assert.Nil(t, err)
+
+	node, err := sqlparser.Parse(query)
+	assert.Nil(t, err)
+	plan := NewUnionPlan(log, database, query, node.(*sqlparser.Union), route)
+	err = plan.Build()
+	assert.Nil(t, err)
+	assert.Equal(t, want, plan.JSON())
+}
+
+func TestUnionUnsupportedPlan(t *testing.T) {
+	querys := []string{
+		"select id from A union select id from B order by A.id",
+		"select id from A union select id from B order by id + 1",
+		"select id from A union select id from B limit x",
+		"select id from A union select id from B for update",
+		"select id from A union select id from C",
+	}
+	results := []string{
+		"Table 'A' from one of the SELECTs cannot be used in global ORDER clause",
+		"unsupported: orderby[id + 1].in.union",
+		"unsupported: limit.offset.or.counts.must.be.IntVal",
+		"unsupported: lock.in.union[for update]",
+		"Table 'C' doesn't exist (errno 1146) (sqlstate 42S02)",
+	}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	err := route.AddForTest(database, router.MockTableMConfig(), router.MockTableBConfig())
+	assert.Nil(t, err)
+	for i, query := range querys {
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := NewUnionPlan(log, database, query, node.(*sqlparser.Union), route)
+		err = plan.Build()
+		assert.NotNil(t, err)
+		if err != nil {
+			assert.Equal(t, results[i], err.Error())
+		}
+	}
+}
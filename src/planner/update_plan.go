@@ -48,6 +48,15 @@ type UpdatePlan struct {
 
 	// query and backend tuple
 	Querys []xcontext.QueryTuple
+
+	// Lookups are the target tables of the multiple-table update which can't be pushed down.
+	Lookups []*DMLLookup
+
+	// Move is the move of the rows if the shard key is changed, nil if not.
+	Move *ShardKeyMove
+
+	// children are the select plans of the lookups.
+	children *PlanTree
 }
 
 // NewUpdatePlan used to create UpdatePlan
@@ -70,6 +79,19 @@ func (p *UpdatePlan) analyze() error {
 	if hasSubquery(p.node) {
 		return errors.New("unsupported: subqueries.in.update")
 	}
+	if node.TableExprs != nil {
+		if len(node.OrderBy) > 0 {
+			return errors.New("Incorrect usage of UPDATE and ORDER BY")
+		}
+		if node.Limit != nil {
+			return errors.New("Incorrect usage of UPDATE and LIMIT")
+		}
+		// The tables joined by the ON condition don't need the where clause.
+		if node.Where == nil && !hasJoinCondition(node.TableExprs) {
+			return errors.New("unsupported: missing.where.clause.in.DML")
+		}
+		return nil
+	}
 	if node.Where == nil {
 		return errors.New("unsupported: missing.where.clause.in.DML")
 	}
@@ -83,6 +105,10 @@ func (p *UpdatePlan) Build() error {
 	}
 
 	node := p.node
+	if node.TableExprs != nil {
+		return p.buildMultiTable()
+	}
+
 	// Database.
 	database := p.database
 	if !node.Table.Qualifier.IsEmpty() {
@@ -91,26 +117,30 @@ func (p *UpdatePlan) Build() error {
 	table := node.Table.Name.String()
 
 	// Sharding key.
-	shardkey, err := p.router.ShardKey(database, table)
+	shardkeys, err := p.router.ShardKeys(database, table)
 	if err != nil {
 		return err
 	}
 
-	// analyze shardkey changing.
-	if isShardKeyChanging(node.Exprs, shardkey) {
-		return errors.New("unsupported: cannot.update.shard.key")
+	// The rows are moved if the shardkey is changing.
+	if isShardKeyChanging(node.Exprs, shardkeys) {
+		if len(node.OrderBy) > 0 || node.Limit != nil {
+			return errors.New("unsupported: order.by.or.limit.in.shard.key.update")
+		}
+		p.Move = newShardKeyMove(p.log, p.router, node.Comments, database, table, shardkeys, node.Exprs)
+		return p.Move.addStep(node.Where, nil)
 	}
 
 	// Get the routing segments info.
-	segments, err := getDMLRouting(database, table, shardkey, node.Where, p.router)
+	routing, err := getRouting(database, table, shardkeys, node.Where, p.router)
 	if err != nil {
 		return err
 	}
 
 	// Rewrite the query.
-	for _, segment := range segments {
+	for _, segment := range routing.segments {
 		buf := sqlparser.NewTrackedBuffer(nil)
-		buf.Myprintf("update %v%s.%s set %v%v%v%v", node.Comments, database, segment.Table, node.Exprs, node.Where, node.OrderBy, node.Limit)
+		buf.Myprintf("update %v%s.%s set %v%v%v%v", node.Comments, database, segment.Table, node.Exprs, routing.rewriteWhere(node.Where, segment), node.OrderBy, node.Limit)
 		tuple := xcontext.QueryTuple{
 			Query:   buf.String(),
 			Backend: segment.Backend,
@@ -121,6 +151,64 @@ func (p *UpdatePlan) Build() error {
 	return nil
 }
 
+// buildMultiTable used to build the multiple-table update.
+// The statement is pushed down to the segments if the tables can be joined on the shards,
+// otherwise the rows of every target table are looked up and updated by the sharding keys.
+// The columns to be updated must be qualified by the tables.
+func (p *UpdatePlan) buildMultiTable() error {
+	node := p.node
+	m, err := newMultiTableDML(p.log, p.database, node.Comments, node.TableExprs, node.Where, p.router)
+	if err != nil {
+		return err
+	}
+
+	var targets []*tableInfo
+	assignments := make(map[*tableInfo]sqlparser.UpdateExprs)
+	exprs := make(sqlparser.UpdateExprs, 0, len(node.Exprs))
+	for _, expr := range node.Exprs {
+		if expr.Name.Qualifier.IsEmpty() {
+			return errors.Errorf("unsupported: unqualified.column[%s].in.multiple-table.update", expr.Name.Name.String())
+		}
+		t := m.lookupTable(expr.Name.Qualifier)
+		if t == nil {
+			return errors.Errorf("Unknown column '%s' in 'field list'", sqlparser.String(expr.Name))
+		}
+		shardkeys, err := p.router.ShardKeys(t.database, t.table)
+		if err != nil {
+			return err
+		}
+		if isShardKeyChanging(sqlparser.UpdateExprs{expr}, shardkeys) {
+			return errors.New("unsupported: cannot.update.shard.key")
+		}
+		if err := m.checkTarget(t); err != nil {
+			return err
+		}
+		if _, ok := assignments[t]; !ok {
+			targets = append(targets, t)
+		}
+		assignments[t] = append(assignments[t], expr)
+		exprs = append(exprs, &sqlparser.UpdateExpr{Name: &sqlparser.ColName{Name: expr.Name.Name, Qualifier: m.targetName(t)}, Expr: expr.Expr})
+	}
+
+	if m.pushdown {
+		p.Querys, err = m.pushdownQuerys(func(buf *sqlparser.TrackedBuffer, from sqlparser.TableExprs, where *sqlparser.Where) {
+			buf.Myprintf("update %v%v set %v%v", node.Comments, from, exprs, where)
+		})
+		return err
+	}
+
+	p.children = NewPlanTree()
+	for _, t := range targets {
+		lookup, err := m.buildLookup(t, assignments[t])
+		if err != nil {
+			return err
+		}
+		p.Lookups = append(p.Lookups, lookup)
+		p.children.Add(lookup.Select)
+	}
+	return nil
+}
+
 // Type returns the type of the plan.
 func (p *UpdatePlan) Type() PlanType {
 	return p.typ
@@ -131,6 +219,8 @@ func (p *UpdatePlan) JSON() string {
 	type explain struct {
 		RawQuery   string                `json:",omitempty"`
 		Partitions []xcontext.QueryTuple `json:",omitempty"`
+		Lookups    []json.RawMessage     `json:",omitempty"`
+		Move       json.RawMessage       `json:",omitempty"`
 	}
 
 	// Partitions.
@@ -140,6 +230,12 @@ func (p *UpdatePlan) JSON() string {
 		RawQuery:   p.RawQuery,
 		Partitions: parts,
 	}
+	for _, lookup := range p.Lookups {
+		exp.Lookups = append(exp.Lookups, lookup.JSON())
+	}
+	if p.Move != nil {
+		exp.Move = p.Move.JSON()
+	}
 	bout, err := json.MarshalIndent(exp, "", "\t")
 	if err != nil {
 		return err.Error()
@@ -147,9 +243,9 @@ func (p *UpdatePlan) JSON() string {
 	return hack.String(bout)
 }
 
-// Children returns the children of the plan.
+// Children returns the select plans of the lookups, nil if none.
 func (p *UpdatePlan) Children() *PlanTree {
-	return nil
+	return p.children
 }
 
 // Size returns the memory size.
@@ -158,5 +254,11 @@ func (p *UpdatePlan) Size() int {
 	for _, q := range p.Querys {
 		size += len(q.Query)
 	}
+	for _, lookup := range p.Lookups {
+		size += lookup.Select.Size()
+	}
+	if p.Move != nil {
+		size += p.Move.Size()
+	}
 	return size
 }
@@ -9,11 +9,14 @@
 package planner
 
 import (
+	"fmt"
 	"router"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/sqlparser"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
 
@@ -43,32 +46,22 @@ func TestUpdatePlan(t *testing.T) {
 	"RawQuery": "update sbtest.A set val = 1 where id in (1, 2)",
 	"Partitions": [
 		{
-			"Query": "update sbtest.A1 set val = 1 where id in (1, 2)",
+			"Query": "update sbtest.A6 set val = 1 where id in (1, 2)",
+			"Backend": "backend6",
+			"Range": "[512-4096)"
+		}
+	]
+}`,
+		`{
+	"RawQuery": "update sbtest.A set val = 1 where id in (0, 1, 39)",
+	"Partitions": [
+		{
+			"Query": "update sbtest.A1 set val = 1 where id in (0, 39)",
 			"Backend": "backend1",
 			"Range": "[0-32)"
 		},
 		{
-			"Query": "update sbtest.A2 set val = 1 where id in (1, 2)",
-			"Backend": "backend2",
-			"Range": "[32-64)"
-		},
-		{
-			"Query": "update sbtest.A3 set val = 1 where id in (1, 2)",
-			"Backend": "backend3",
-			"Range": "[64-96)"
-		},
-		{
-			"Query": "update sbtest.A4 set val = 1 where id in (1, 2)",
-			"Backend": "backend4",
-			"Range": "[96-256)"
-		},
-		{
-			"Query": "update sbtest.A5 set val = 1 where id in (1, 2)",
-			"Backend": "backend5",
-			"Range": "[256-512)"
-		},
-		{
-			"Query": "update sbtest.A6 set val = 1 where id in (1, 2)",
+			"Query": "update sbtest.A6 set val = 1 where id in (1)",
 			"Backend": "backend6",
 			"Range": "[512-4096)"
 		}
@@ -78,6 +71,7 @@ func TestUpdatePlan(t *testing.T) {
 		"update sbtest.A set val = 1 where id = 1",
 		"update sbtest.A set val = 1 where id = id2 and id = 1",
 		"update sbtest.A set val = 1 where id in (1, 2)",
+		"update sbtest.A set val = 1 where id in (0, 1, 39)",
 	}
 
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
@@ -113,13 +107,13 @@ func TestUpdatePlan(t *testing.T) {
 func TestUpdateUnsupportedPlan(t *testing.T) {
 	querys := []string{
 		"update sbtest.A set a=3",
-		"update sbtest.A set id=3 where id=1",
+		"update sbtest.A set id=3 where id=1 limit 1",
 		"update sbtest.A set b=3 where id in (select id from t1)",
 	}
 
 	results := []string{
 		"unsupported: missing.where.clause.in.DML",
-		"unsupported: cannot.update.shard.key",
+		"unsupported: order.by.or.limit.in.shard.key.update",
 		"unsupported: subqueries.in.update",
 	}
 
@@ -197,7 +191,7 @@ func TestUpdatePlanError(t *testing.T) {
 }
 
 func TestUpdateShardKey(t *testing.T) {
-	query := "update sbtest.A set id = 1 where id = 2"
+	query := "update sbtest.A set id = id + 1, b = 2 where id = 1"
 
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
 	database := "sbtest"
@@ -217,7 +211,64 @@ func TestUpdateShardKey(t *testing.T) {
 	// plan build
 	{
 		err := plan.Build()
-		assert.NotNil(t, err)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(plan.Querys))
+		assert.Equal(t, 1, len(plan.Move.Steps))
+
+		step := plan.Move.Steps[0]
+		assert.Equal(t, []string{"select *, id + 1, 2 from sbtest.A6 where id = 1 for update"}, []string{step.Selects[0].Query})
+		assert.Equal(t, []string{"delete from sbtest.A6 where id = 1"}, []string{step.Deletes[0].Query})
+		assert.Equal(t, "delete from sbtest.A where id = 1", plan.Move.DeleteQuery(step))
+	}
+
+	// new rows.
+	{
+		intVal := func(v string) sqltypes.Value {
+			return sqltypes.MakeTrusted(querypb.Type_INT32, []byte(v))
+		}
+		fields := []*querypb.Field{{Name: "id"}, {Name: "b"}, {Name: "id + 1"}, {Name: "2"}}
+		rows := [][]sqltypes.Value{
+			{intVal("1"), intVal("1"), intVal("2"), intVal("2")},
+			{intVal("2"), intVal("2"), intVal("2"), intVal("2")},
+		}
+		newFields, newRows, changed, err := plan.Move.NewRows(fields, rows)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, changed)
+		assert.Equal(t, fields[:2], newFields)
+		assert.Equal(t, "[[2 2] [2 2]]", fmt.Sprintf("%v", newRows))
+
+		querys, event, err := plan.Move.InsertQuerys(newFields, newRows)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(querys))
+		assert.Equal(t, "insert into sbtest.A(id, b) values (2, 2), (2, 2)", event)
+
+		// The assigned column isn't selected.
+		_, _, _, err = plan.Move.NewRows([]*querypb.Field{{Name: "c"}, {Name: "b"}, {Name: "id + 1"}, {Name: "2"}}, rows)
+		assert.Equal(t, "Unknown column 'id' in 'field list'", err.Error())
+	}
+
+	// The assignments are applied from left to right.
+	{
+		query := "update sbtest.A set id = id + 1, b = id * 2, c = B where id = 1"
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := NewUpdatePlan(log, database, query, node.(*sqlparser.Update), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+		want := "select *, id + 1, (id + 1) * 2, ((id + 1) * 2) from sbtest.A6 where id = 1 for update"
+		assert.Equal(t, want, plan.Move.Steps[0].Selects[0].Query)
+	}
+
+	// The rows on every segment.
+	{
+		query := "update sbtest.A set id = 5 where b = 1"
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := NewUpdatePlan(log, database, query, node.(*sqlparser.Update), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+		assert.Equal(t, 6, len(plan.Move.Steps[0].Selects))
+		assert.Equal(t, 6, len(plan.Move.Steps[0].Deletes))
 	}
 }
 
@@ -269,3 +320,145 @@ func TestUpdateDatabaseNotFound(t *testing.T) {
 		assert.NotNil(t, err)
 	}
 }
+
+func TestUpdateMultiTablePlan(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	database := "sbtest"
+
+	route, cleanup := router.MockNewRouter(log)
+	defer cleanup()
+
+	// M is partitioned identically to A.
+	M := router.MockTableMConfig()
+	M.Name = "M"
+	M.ShardKey = "uid"
+	for i, part := range M.Partitions {
+		part.Table = fmt.Sprintf("M%d", i+1)
+	}
+	A := router.MockTableMConfig()
+	A.UniqueKey = "id"
+	// The rows of B are identified by the unique key other than the sharding key.
+	B := router.MockTableBConfig()
+	B.UniqueKey = "uid"
+	err := route.AddForTest(database, A, B, router.MockTableGConfig(), M)
+	assert.Nil(t, err)
+
+	// Pushdown to the segments.
+	{
+		querys := []string{
+			"update A join M on A.id = M.uid set A.b = M.b where A.id = 1",
+			"update sbtest.A, G set A.b = G.b, A.c = 1 where A.id = G.id and A.id = 0",
+			"update G as x join G as y on x.id = y.id set x.b = y.b",
+		}
+		wants := [][]string{
+			{"update sbtest.A6 as A join sbtest.M6 as M on A.id = M.uid set A.b = M.b where A.id = 1"},
+			{"update sbtest.A1 as A, sbtest.G set A.b = G.b, A.c = 1 where A.id = G.id and A.id = 0"},
+			{
+				"update sbtest.G as x join sbtest.G as y on x.id = y.id set x.b = y.b",
+				"update sbtest.G as x join sbtest.G as y on x.id = y.id set x.b = y.b",
+			},
+		}
+		for i, query := range querys {
+			node, err := sqlparser.Parse(query)
+			assert.Nil(t, err)
+			plan := NewUpdatePlan(log, database, query, node.(*sqlparser.Update), route)
+			err = plan.Build()
+			assert.Nil(t, err)
+			assert.Nil(t, plan.Children())
+			var got []string
+			for _, q := range plan.Querys {
+				got = append(got, q.Query)
+			}
+			assert.Equal(t, wants[i], got)
+		}
+	}
+
+	// Lookup the keys of the targets.
+	{
+		query := "update A join B on A.id = B.id set A.b = B.b, B.c = 1 where B.d = 2"
+		node, err := sqlparser.Parse(query)
+		assert.Nil(t, err)
+		plan := NewUpdatePlan(log, database, query, node.(*sqlparser.Update), route)
+		err = plan.Build()
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(plan.Querys))
+		assert.Equal(t, 2, len(plan.Lookups))
+		assert.Equal(t, 2, len(plan.Children().Plans()))
+		assert.Equal(t, PlanTypeJoin, plan.Lookups[0].Select.Type())
+		assert.Equal(t, "A", plan.Lookups[0].Table)
+		assert.Equal(t, "B", plan.Lookups[1].Table)
+		assert.True(t, plan.Size() > len(query))
+
+		intVal := func(v string) sqltypes.Value {
+			return sqltypes.MakeTrusted(querypb.Type_INT32, []byte(v))
+		}
+		rows := [][]sqltypes.Value{
+			{intVal("1"), intVal("5")},
+			{intVal("1"), intVal("6")},
+			{intVal("2"), intVal("5")},
+			{intVal("3"), intVal("6")},
+		}
+		querys, err := plan.Lookups[0].Querys(rows)
+		assert.Nil(t, err)
+		var got []string
+		for _, q := range querys {
+			got = append(got, q.Query)
+		}
+		want := []string{
+			"update sbtest.A6 set b = 5 where id in (1, 2)",
+			"update sbtest.A6 set b = 6 where id in (3)",
+		}
+		assert.Equal(t, want, got)
+
+		// The constant is kept in the statement.
+		// The rows sharing the sharding key are changed by the unique key.
+		querys, err = plan.Lookups[1].Querys([][]sqltypes.Value{{intVal("1"), intVal("10")}, {intVal("1"), intVal("11")}, {intVal("2"), intVal("20")}, {intVal("1"), intVal("10")}})
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(querys))
+		assert.Equal(t, "update sbtest.B1 set c = 1 where uid in (10, 11, 20)", querys[0].Query)
+
+		// NULL key.
+		_, err = plan.Lookups[1].Querys([][]sqltypes.Value{{sqltypes.NULL, intVal("10")}})
+		assert.Equal(t, "unsupported: shardkey[id].of.table[B].is.NULL", err.Error())
+		_, err = plan.Lookups[1].Querys([][]sqltypes.Value{{intVal("1"), sqltypes.NULL}})
+		assert.Equal(t, "unsupported: unique.key[uid].of.table[B].is.NULL", err.Error())
+
+		// Columns mismatch.
+		_, err = plan.Lookups[1].Querys([][]sqltypes.Value{{intVal("1")}})
+		assert.Equal(t, "multiple-table.DML.lookup[B].columns.mismatch", err.Error())
+	}
+
+	// Unsupported.
+	{
+		querys := []string{
+			"update A join B on A.id = B.id set b = 1",
+			"update A join B on A.id = B.id set A.id = 1",
+			"update A join G on A.id = G.id set G.b = 1",
+			"update A join B on A.id = B.id set C.b = 1",
+			"update A join B on A.id = B.id set A.b = 1 limit 1",
+			"update A join B on A.id = B.id set A.b = 1 order by A.b",
+			"update A, B set A.b = 1",
+			"update A join B on A.id = B.id set A.b = 1 where A.id in (select id from B)",
+		}
+		results := []string{
+			"unsupported: unqualified.column[b].in.multiple-table.update",
+			"unsupported: cannot.update.shard.key",
+			"unsupported: global.table[G].joined.with.non-global.tables.can.not.be.changed",
+			"Unknown column 'C.b' in 'field list'",
+			"Incorrect usage of UPDATE and LIMIT",
+			"Incorrect usage of UPDATE and ORDER BY",
+			"unsupported: missing.where.clause.in.DML",
+			"unsupported: subqueries.in.update",
+		}
+		for i, query := range querys {
+			node, err := sqlparser.Parse(query)
+			assert.Nil(t, err)
+			plan := NewUpdatePlan(log, database, query, node.(*sqlparser.Update), route)
+			err = plan.Build()
+			assert.NotNil(t, err, query)
+			if err != nil {
+				assert.Equal(t, results[i], err.Error())
+			}
+		}
+	}
+}
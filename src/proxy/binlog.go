@@ -12,6 +12,8 @@ import (
 	"fmt"
 	"strconv"
 
+	"xcontext"
+
 	"github.com/xelabs/go-mysqlstack/driver"
 	"github.com/xelabs/go-mysqlstack/sqlparser"
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/hack"
@@ -20,8 +22,19 @@ import (
 )
 
 func (spanner *Spanner) logEvent(session *driver.Session, typ string, query string) error {
+	// The statement executed as other statements logs them instead, such as the shard key update.
+	events := spanner.sessions.takeBinlogEvents(session)
 	if spanner.conf.Binlog.EnableBinlog {
-		spanner.binlog.LogEvent(typ, session.Schema(), query)
+		if len(events) == 0 {
+			events = []xcontext.BinlogEvent{{Typ: typ, Query: query}}
+		}
+		// The events of the multi-statement transaction are logged when it commits.
+		if spanner.sessions.addTxnEvents(session, events) {
+			return nil
+		}
+		for _, event := range events {
+			spanner.binlog.LogEvent(event.Typ, session.Schema(), event.Query)
+		}
 	}
 	return nil
 }
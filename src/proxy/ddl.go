@@ -10,6 +10,7 @@ package proxy
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	"router"
@@ -27,12 +28,62 @@ var (
 	}
 )
 
+// dropUniqueKey used to clear the unique key of the table if the DDL drops its index or one of its columns.
+func (spanner *Spanner) dropUniqueKey(database string, table string, ddl *sqlparser.DDL) error {
+	router := spanner.router
+	name, columns := router.UniqueKey(database, table)
+	if len(columns) == 0 {
+		return nil
+	}
+
+	drop := false
+	switch ddl.Action {
+	case sqlparser.DropIndexStr:
+		drop = strings.EqualFold(ddl.IndexName, name)
+	case sqlparser.AlterDropColumnStr:
+		for _, column := range columns {
+			if strings.EqualFold(ddl.DropColumnName, column) {
+				drop = true
+			}
+		}
+	}
+	if !drop {
+		return nil
+	}
+	return router.SetUniqueKey(database, table, "", "")
+}
+
+// alterColumns used to keep the recorded columns in the table order, ADD COLUMN appends
+// the columns and DROP COLUMN removes the column.
+func (spanner *Spanner) alterColumns(database string, table string, ddl *sqlparser.DDL) error {
+	router := spanner.router
+	columns := router.Columns(database, table)
+	if len(columns) == 0 {
+		return nil
+	}
+
+	var altered []string
+	switch ddl.Action {
+	case sqlparser.AlterAddColumnStr:
+		altered = append(append(altered, columns...), tableColumns(ddl.TableSpec)...)
+	case sqlparser.AlterDropColumnStr:
+		for _, column := range columns {
+			if !strings.EqualFold(ddl.DropColumnName, column) {
+				altered = append(altered, column)
+			}
+		}
+	default:
+		return nil
+	}
+	return router.SetColumns(database, table, altered)
+}
+
 // CheckCreateTable used to check the CRERATE TABLE statement.
 func CheckCreateTable(ddl *sqlparser.DDL) error {
 	shardKey := ddl.PartitionName
 	table := ddl.Table.Name.String()
-	// Check the sharding key.
-	if shardKey == "" {
+	// Check the sharding key, the global and single tables have no sharding key.
+	if shardKey == "" && ddl.TableType != sqlparser.TableTypeGlobal && ddl.TableType != sqlparser.TableTypeSingle {
 		return fmt.Errorf("create table must end with 'PARTITION BY HASH(shard-key)'")
 	}
 
@@ -41,20 +92,40 @@ func CheckCreateTable(ddl *sqlparser.DDL) error {
 	}
 
 	// UNIQUE/PRIMARY constraint check.
-	shardKeyOK := false
-	for _, col := range ddl.TableSpec.Columns {
-		colName := col.Name.String()
-		if colName == shardKey {
-			shardKeyOK = true
-		} else {
+	if shardKey != "" {
+		shardKeys := router.ShardKeyColumns(shardKey)
+		if len(shardKeys) > 1 && ddl.PartitionType != sqlparser.PartitionTypeHash {
+			return fmt.Errorf("The composite sharding key only supports 'PARTITION BY HASH'")
+		}
+		found := make(map[string]bool, len(shardKeys))
+		for _, key := range shardKeys {
+			if _, ok := found[key]; ok {
+				return fmt.Errorf("Duplicate column '%s' in sharding key", key)
+			}
+			found[key] = false
+		}
+		for _, col := range ddl.TableSpec.Columns {
+			colName := col.Name.String()
+			_, isKey := found[colName]
+			if isKey {
+				found[colName] = true
+			}
 			switch col.Type.KeyOpt {
 			case sqlparser.ColKeyUnique, sqlparser.ColKeyUniqueKey, sqlparser.ColKeyPrimary:
-				return fmt.Errorf("The unique/primary constraint only be defined on the sharding key column[%s] not [%s]", shardKey, colName)
+				// The single column constraint can't be guaranteed across the shards by the composite sharding key.
+				if len(shardKeys) > 1 {
+					return fmt.Errorf("The unique/primary constraint can not be defined on the column[%s] of the composite sharding key table", colName)
+				}
+				if !isKey {
+					return fmt.Errorf("The unique/primary constraint only be defined on the sharding key column[%s] not [%s]", shardKey, colName)
+				}
+			}
+		}
+		for _, key := range shardKeys {
+			if !found[key] {
+				return fmt.Errorf("Sharding Key column '%s' doesn't exist in table", key)
 			}
 		}
-	}
-	if !shardKeyOK {
-		return fmt.Errorf("Sharding Key column '%s' doesn't exist in table", shardKey)
 	}
 
 	check := false
@@ -73,6 +144,173 @@ func CheckCreateTable(ddl *sqlparser.DDL) error {
 	return nil
 }
 
+// partitionDefinitions used to convert the PARTITION BY RANGE/LIST options to the router partition definitions.
+func partitionDefinitions(ddl *sqlparser.DDL, backends []string) ([]router.PartitionDefinition, error) {
+	definitions := make([]router.PartitionDefinition, 0, len(ddl.PartitionOptions))
+	for _, option := range ddl.PartitionOptions {
+		found := false
+		for _, backend := range backends {
+			if backend == option.Backend {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("Partition backend '%s' doesn't exist", option.Backend)
+		}
+
+		definition := router.PartitionDefinition{Backend: option.Backend, Default: option.IsDefault}
+		switch ddl.PartitionType {
+		case sqlparser.PartitionTypeRange:
+			if option.LessThan != nil {
+				bound, ok := constantValue(option.LessThan)
+				if !ok {
+					return nil, fmt.Errorf("The partition bound[%s] must be a constant value", sqlparser.String(option.LessThan))
+				}
+				definition.Bound = bound
+			}
+		case sqlparser.PartitionTypeList:
+			for _, expr := range option.InValues {
+				value, ok := constantValue(expr)
+				if !ok {
+					return nil, fmt.Errorf("The partition value[%s] must be a constant value", sqlparser.String(expr))
+				}
+				definition.Values = append(definition.Values, value)
+			}
+		}
+		definitions = append(definitions, definition)
+	}
+	return definitions, nil
+}
+
+// singleBackend returns the backend of the SINGLE [ON backend] table, the first backend is used if not specified.
+func singleBackend(ddl *sqlparser.DDL, backends []string) (string, error) {
+	if len(backends) == 0 {
+		return "", fmt.Errorf("The backends can not be empty")
+	}
+	if ddl.BackendName == "" {
+		return backends[0], nil
+	}
+	for _, backend := range backends {
+		if backend == ddl.BackendName {
+			return backend, nil
+		}
+	}
+	return "", fmt.Errorf("Single table backend '%s' doesn't exist", ddl.BackendName)
+}
+
+// constantValue returns the value of the int/float/string constant expression.
+func constantValue(expr sqlparser.Expr) (string, bool) {
+	val, ok := expr.(*sqlparser.SQLVal)
+	if !ok {
+		return "", false
+	}
+	switch val.Type {
+	case sqlparser.IntVal, sqlparser.FloatVal, sqlparser.StrVal:
+		return string(val.Val), true
+	}
+	return "", false
+}
+
+// columnType returns the type of the column of the CREATE TABLE such as int or varchar, empty if not found.
+func columnType(ddl *sqlparser.DDL, column string) string {
+	for _, col := range ddl.TableSpec.Columns {
+		if strings.EqualFold(col.Name.String(), column) {
+			return strings.ToLower(col.Type.Type)
+		}
+	}
+	return ""
+}
+
+// tableColumns returns the columns of the table spec in order.
+func tableColumns(spec *sqlparser.TableSpec) []string {
+	columns := make([]string, 0, len(spec.Columns))
+	for _, col := range spec.Columns {
+		columns = append(columns, col.Name.String())
+	}
+	return columns
+}
+
+// autoIncrementColumn returns the AUTO_INCREMENT column of the CREATE TABLE, empty if none.
+func autoIncrementColumn(ddl *sqlparser.DDL) string {
+	for _, col := range ddl.TableSpec.Columns {
+		if col.Type.Autoincrement {
+			return col.Name.String()
+		}
+	}
+	return ""
+}
+
+// autoIncrementStart returns the AUTO_INCREMENT table option of the CREATE TABLE, 1 if it's not set.
+// The value 0 is taken as 1 as MySQL does.
+func autoIncrementStart(ddl *sqlparser.DDL) (int64, error) {
+	option := ddl.TableSpec.Options.AutoIncrement
+	if option == "" {
+		return 1, nil
+	}
+	start, err := strconv.ParseInt(option, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Incorrect AUTO_INCREMENT value '%s' for table '%s'", option, ddl.Table.Name.String())
+	}
+	if start == 0 {
+		start = 1
+	}
+	return start, nil
+}
+
+// uniqueKey returns the index name and the columns joined by comma of the primary key of the
+// CREATE TABLE, or the first unique key if it has no primary key. Empty if none.
+func uniqueKey(ddl *sqlparser.DDL) (string, string) {
+	var name, columns string
+	for _, col := range ddl.TableSpec.Columns {
+		switch col.Type.KeyOpt {
+		case sqlparser.ColKeyPrimary:
+			return "PRIMARY", col.Name.String()
+		case sqlparser.ColKeyUnique, sqlparser.ColKeyUniqueKey:
+			if columns == "" {
+				name, columns = col.Name.String(), col.Name.String()
+			}
+		}
+	}
+	for _, idx := range ddl.TableSpec.Indexes {
+		if !idx.Info.Primary && !idx.Info.Unique {
+			continue
+		}
+		cols := make([]string, 0, len(idx.Columns))
+		for _, col := range idx.Columns {
+			cols = append(cols, col.Column.String())
+		}
+		if idx.Info.Primary {
+			return "PRIMARY", strings.Join(cols, ",")
+		}
+		if columns == "" {
+			name, columns = idx.Info.Name.String(), strings.Join(cols, ",")
+		}
+	}
+	return name, columns
+}
+
+// sequenceOptions returns the START, INCREMENT and CACHE of the CREATE SEQUENCE, the defaults
+// are 1, 1 and router.DefaultSequenceCache.
+func sequenceOptions(ddl *sqlparser.DDL) (int64, int64, int64, error) {
+	start, increment, cache := int64(1), int64(1), int64(router.DefaultSequenceCache)
+	for _, option := range ddl.SequenceOptions {
+		value, err := strconv.ParseInt(string(option.Value.Val), 10, 64)
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("Incorrect %s value '%s' for SEQUENCE '%s'", strings.ToUpper(option.Name), option.Value.Val, ddl.Table.Name.String())
+		}
+		switch option.Name {
+		case sqlparser.SequenceStartStr:
+			start = value
+		case sqlparser.SequenceIncrementStr:
+			increment = value
+		case sqlparser.SequenceCacheStr:
+			cache = value
+		}
+	}
+	return start, increment, cache, nil
+}
+
 func checkDatabaseAndTable(database string, table string, router *router.Router) error {
 	tblList := router.Tables()
 	tables, ok := tblList[database]
@@ -97,11 +335,17 @@ func checkDatabaseAndTable(database string, table string, router *router.Router)
 // Supports:
 // 1. CREATE/DROP DATABASE
 // 2. CREATE/DROP TABLE ... PARTITION BY HASH(shardkey)
+//    CREATE TABLE ... PARTITION BY RANGE(shardkey) (PARTITION backend VALUES LESS THAN (bound|MAXVALUE), ...)
+//    CREATE TABLE ... PARTITION BY LIST(shardkey) (PARTITION backend VALUES IN (values...)|DEFAULT, ...)
+//    CREATE TABLE ... GLOBAL
+//    The AUTO_INCREMENT column of the partitioned and global tables is generated by the table sequence
 // 3. CREATE/DROP INDEX ON TABLE(columns...)
 // 4. ALTER TABLE .. ENGINE=xx
 // 5. ALTER TABLE .. ADD COLUMN (column definition)
 // 6. ALTER TABLE .. MODIFY COLUMN column definition
 // 7. ALTER TABLE .. DROP COLUMN column
+// 8. CREATE SEQUENCE [IF NOT EXISTS] seq [START WITH n] [INCREMENT BY n] [CACHE n]
+//    DROP SEQUENCE [IF EXISTS] seq
 func (spanner *Spanner) handleDDL(session *driver.Session, query string, node sqlparser.Statement) (*sqltypes.Result, error) {
 	log := spanner.log
 	router := spanner.router
@@ -147,10 +391,74 @@ func (spanner *Spanner) handleDDL(session *driver.Session, query string, node sq
 			log.Error("spanner.ddl.check.create.table[%s].error:%+v", table, err)
 			return nil, err
 		}
+		start, err := autoIncrementStart(ddl)
+		if err != nil {
+			log.Error("spanner.ddl.create.table[%s].auto.increment.error:%+v", table, err)
+			return nil, err
+		}
 
 		// Create table.
-		if err := router.CreateTable(database, table, shardKey, backends); err != nil {
-			return nil, err
+		switch {
+		case ddl.TableType == sqlparser.TableTypeGlobal:
+			if err := router.CreateGlobalTable(database, table, backends); err != nil {
+				return nil, err
+			}
+		case ddl.TableType == sqlparser.TableTypeSingle:
+			backend, err := singleBackend(ddl, backends)
+			if err != nil {
+				log.Error("spanner.ddl.create.table[%s].single.backend.error:%+v", table, err)
+				return nil, err
+			}
+			if err := router.CreateSingleTable(database, table, backend); err != nil {
+				return nil, err
+			}
+		case ddl.PartitionType == sqlparser.PartitionTypeRange:
+			definitions, err := partitionDefinitions(ddl, backends)
+			if err != nil {
+				log.Error("spanner.ddl.create.table[%s].range.definitions.error:%+v", table, err)
+				return nil, err
+			}
+			if err := router.CreateRangeTable(database, table, shardKey, columnType(ddl, shardKey), definitions); err != nil {
+				return nil, err
+			}
+		case ddl.PartitionType == sqlparser.PartitionTypeList:
+			definitions, err := partitionDefinitions(ddl, backends)
+			if err != nil {
+				log.Error("spanner.ddl.create.table[%s].list.definitions.error:%+v", table, err)
+				return nil, err
+			}
+			if err := router.CreateListTable(database, table, shardKey, columnType(ddl, shardKey), definitions); err != nil {
+				return nil, err
+			}
+		case ddl.TableGroup != "":
+			if err := router.CreateGroupTable(database, table, shardKey, ddl.TableGroup, backends); err != nil {
+				return nil, err
+			}
+		default:
+			if err := router.CreateTable(database, table, shardKey, backends); err != nil {
+				return nil, err
+			}
+		}
+
+		// The AUTO_INCREMENT column is generated by the table sequence, since the counters
+		// of the backends give the duplicates. The single table keeps its own counter.
+		if column := autoIncrementColumn(ddl); column != "" && ddl.TableType != sqlparser.TableTypeSingle {
+			if err := router.SetAutoIncrement(database, table, column, start); err != nil {
+				router.DropTable(database, table)
+				return nil, err
+			}
+			// INSERT without the column list locates the column by the table order.
+			if err := router.SetColumns(database, table, tableColumns(ddl.TableSpec)); err != nil {
+				router.DropTable(database, table)
+				return nil, err
+			}
+		}
+		// The multiple-table DML identifies the rows of the sharded table by the unique key.
+		if name, columns := uniqueKey(ddl); columns != "" && shardKey != "" {
+			if err := router.SetUniqueKey(database, table, name, columns); err != nil {
+				router.DropTable(database, table)
+				return nil, err
+			}
 		}
 		r, err := spanner.ExecuteDDL(session, database, sqlparser.String(ddl), node)
 		if err != nil {
@@ -190,8 +498,46 @@ func (spanner *Spanner) handleDDL(session *driver.Session, query string, node sq
 		r, err := spanner.ExecuteDDL(session, database, query, node)
 		if err != nil {
 			log.Error("spanner.ddl[%v].error[%+v]", query, err)
+			return r, err
+		}
+		if x := spanner.dropUniqueKey(database, table, ddl); x != nil {
+			log.Error("spanner.ddl[%v].drop.unique.key.error[%+v]", query, x)
+		}
+		if x := spanner.alterColumns(database, table, ddl); x != nil {
+			log.Error("spanner.ddl[%v].alter.columns.error[%+v]", query, x)
 		}
 		return r, err
+	case sqlparser.CreateSequenceStr:
+		// The sequence lives in the router only.
+		name := ddl.Table.Name.String()
+		if database == "" {
+			return nil, sqldb.NewSQLError(sqldb.ER_NO_DB_ERROR, "")
+		}
+		if ddl.IfNotExists && router.SequenceExists(database, name) {
+			return &sqltypes.Result{}, nil
+		}
+		start, increment, cache, err := sequenceOptions(ddl)
+		if err != nil {
+			return nil, err
+		}
+		if err := router.CreateSequence(database, name, start, increment, cache); err != nil {
+			log.Error("spanner.ddl.router.create.sequence[%s].error[%+v]", name, err)
+			return nil, err
+		}
+		return &sqltypes.Result{}, nil
+	case sqlparser.DropSequenceStr:
+		name := ddl.Table.Name.String()
+		if database == "" {
+			return nil, sqldb.NewSQLError(sqldb.ER_NO_DB_ERROR, "")
+		}
+		if ddl.IfExists && !router.SequenceExists(database, name) {
+			return &sqltypes.Result{}, nil
+		}
+		if err := router.DropSequence(database, name); err != nil {
+			log.Error("spanner.ddl.router.drop.sequence[%s].error[%+v]", name, err)
+			return nil, err
+		}
+		return &sqltypes.Result{}, nil
 	default:
 		log.Error("spanner.ddl[%v, %+v].access.denied", query, node)
 		return nil, sqldb.NewSQLError(sqldb.ER_SPECIFIC_ACCESS_DENIED_ERROR, "Access denied; you don't have the privilege for %v operation", ddl.Action)
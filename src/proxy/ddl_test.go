@@ -470,6 +470,293 @@ func TestProxyDDLCreateTableError(t *testing.T) {
 	}
 }
 
+func TestProxyDDLCreateCompositeShardKeyTable(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create table .*", &sqltypes.Result{})
+	}
+
+	// Create.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		query := "create table order_items(tenant_id int, order_id int, b int) partition by hash(tenant_id, order_id)"
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+
+		shardKeys, err := proxy.Router().ShardKeys("test", "order_items")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"tenant_id", "order_id"}, shardKeys)
+	}
+
+	// Errors.
+	{
+		querys := []string{
+			"create table t1(tenant_id int, b int) partition by hash(tenant_id, order_id)",
+			"create table t2(tenant_id int, order_id int) partition by hash(tenant_id, tenant_id)",
+			"create table t3(tenant_id int, order_id int primary key) partition by hash(tenant_id, order_id)",
+			"create table t4(tenant_id int, order_id int, b int unique) partition by hash(tenant_id, order_id)",
+		}
+		results := []string{
+			"Sharding Key column 'order_id' doesn't exist in table (errno 1105) (sqlstate HY000)",
+			"Duplicate column 'tenant_id' in sharding key (errno 1105) (sqlstate HY000)",
+			"The unique/primary constraint can not be defined on the column[order_id] of the composite sharding key table (errno 1105) (sqlstate HY000)",
+			"The unique/primary constraint can not be defined on the column[b] of the composite sharding key table (errno 1105) (sqlstate HY000)",
+		}
+		for i, query := range querys {
+			client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+			assert.Nil(t, err)
+			_, err = client.FetchAll(query, -1)
+			want := results[i]
+			got := err.Error()
+			assert.Equal(t, want, got)
+			client.Close()
+		}
+	}
+}
+
+func TestProxyDDLCreateGroupTable(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create table .*", &sqltypes.Result{})
+	}
+
+	querys := []string{
+		"create table orders(id int, b int) partition by hash(id) tablegroup g1",
+		"create table order_items(order_id int, b int) partition by hash(order_id) tablegroup g1",
+	}
+	for _, query := range querys {
+		client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+		assert.Nil(t, err)
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+		client.Close()
+	}
+
+	route := proxy.Router()
+	assert.Equal(t, "g1", route.TableGroup("test", "orders"))
+	assert.Equal(t, "g1", route.TableGroup("test", "order_items"))
+	assert.Equal(t, []string{"order_items_0000", "orders_0000"}, route.GroupPartitions("test", "orders_0000"))
+
+	// The shard key columns mismatch.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		query := "create table t1(a int, b int) partition by hash(a, b) tablegroup g1"
+		_, err = client.FetchAll(query, -1)
+		want := "router.table.group[g1].shardkey[a,b].columns.mismatch.with[order_id] (errno 1105) (sqlstate HY000)"
+		assert.Equal(t, want, err.Error())
+	}
+}
+
+func TestProxyDDLCreateRangeTable(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create table .*", &sqltypes.Result{})
+	}
+
+	// OK.
+	{
+		query := "create table t1(a int, b int) partition by range(a) (partition backend0 values less than (100), partition backend1 values less than maxvalue)"
+		client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+
+		conf, err := proxy.Router().TableConfig("test", "t1")
+		assert.Nil(t, err)
+		assert.Equal(t, "RANGE", conf.ShardType)
+		assert.Equal(t, "int", conf.ShardKeyType)
+		assert.Equal(t, 2, len(conf.Partitions))
+	}
+
+	// The string column, the bounds are compared as strings.
+	{
+		query := "create table t5(a varchar(32), b int) partition by range(a) (partition backend0 values less than ('150'), partition backend1 values less than ('1000'))"
+		client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		_, err = client.FetchAll(query, -1)
+		want := "range.partition[t5_0001].bound[1000].must.be.greater.than[150] (errno 1105) (sqlstate HY000)"
+		assert.Equal(t, want, err.Error())
+
+		query = "create table t6(a VARCHAR(32), b int) partition by range(a) (partition backend0 values less than ('1000'), partition backend1 values less than ('150'))"
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+		conf, err := proxy.Router().TableConfig("test", "t6")
+		assert.Nil(t, err)
+		assert.Equal(t, "varchar", conf.ShardKeyType)
+	}
+
+	querys := []string{
+		"create table t2(a int, b int) partition by range(a) (partition backendx values less than (100))",
+		"create table t3(a int, b int) partition by range(a) (partition backend0 values less than (a+1))",
+		"create table t4(a int, b int) partition by range(a) (partition backend0 values less than maxvalue, partition backend1 values less than (100))",
+	}
+	results := []string{
+		"Partition backend 'backendx' doesn't exist (errno 1105) (sqlstate HY000)",
+		"The partition bound[a + 1] must be a constant value (errno 1105) (sqlstate HY000)",
+		"range.partition[t4_0000].maxvalue.must.be.the.last.one (errno 1105) (sqlstate HY000)",
+	}
+	for i, query := range querys {
+		client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+		assert.Nil(t, err)
+		_, err = client.FetchAll(query, -1)
+		want := results[i]
+		got := err.Error()
+		assert.Equal(t, want, got)
+		client.Close()
+	}
+}
+
+func TestProxyDDLCreateListTable(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create table .*", &sqltypes.Result{})
+	}
+
+	// OK.
+	{
+		query := "create table t1(a int, b varchar(8)) partition by list(b) (partition backend0 values in ('bj', 'sh'), partition backend1 default)"
+		client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+
+		conf, err := proxy.Router().TableConfig("test", "t1")
+		assert.Nil(t, err)
+		assert.Equal(t, "LIST", conf.ShardType)
+		assert.Equal(t, []string{"bj", "sh"}, conf.Partitions[0].ListValues)
+		assert.True(t, conf.Partitions[1].Default)
+	}
+
+	querys := []string{
+		"create table t2(a int, b int) partition by list(a) (partition backendx values in (1))",
+		"create table t3(a int, b int) partition by list(a) (partition backend0 values in (a+1))",
+		"create table t4(a int, b int) partition by list(a) (partition backend0 values in (1), partition backend1 values in (2, 1))",
+	}
+	results := []string{
+		"Partition backend 'backendx' doesn't exist (errno 1105) (sqlstate HY000)",
+		"The partition value[a + 1] must be a constant value (errno 1105) (sqlstate HY000)",
+		"list.partition[t4_0001].value[1].duplicate.with.partition[t4_0000] (errno 1105) (sqlstate HY000)",
+	}
+	for i, query := range querys {
+		client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+		assert.Nil(t, err)
+		_, err = client.FetchAll(query, -1)
+		want := results[i]
+		got := err.Error()
+		assert.Equal(t, want, got)
+		client.Close()
+	}
+}
+
+func TestProxyDDLCreateGlobalTable(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create table .*", &sqltypes.Result{})
+	}
+
+	querys := []string{
+		"create table g1(a int primary key, b int unique) global",
+		"create table g2(a int, b int) engine=tokudb default charset=utf8 GLOBAL",
+	}
+	for _, query := range querys {
+		client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+		assert.Nil(t, err)
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+		client.Close()
+	}
+
+	route := proxy.Router()
+	conf, err := route.TableConfig("test", "g1")
+	assert.Nil(t, err)
+	assert.Equal(t, "GLOBAL", conf.ShardType)
+	assert.Equal(t, len(proxy.Scatter().Backends()), len(conf.Partitions))
+	assert.True(t, route.IsGlobal("test", "g2"))
+}
+
+func TestProxyDDLCreateSingleTable(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create table .*", &sqltypes.Result{})
+	}
+
+	querys := []string{
+		"create table s1(a int primary key, b int unique) single",
+		"create table s2(a int, b int) engine=tokudb default charset=utf8 SINGLE ON backend1",
+	}
+	for _, query := range querys {
+		client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+		assert.Nil(t, err)
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+		client.Close()
+	}
+
+	route := proxy.Router()
+	conf, err := route.TableConfig("test", "s1")
+	assert.Nil(t, err)
+	assert.Equal(t, "SINGLE", conf.ShardType)
+	assert.Equal(t, 1, len(conf.Partitions))
+	assert.Equal(t, "backend0", conf.Partitions[0].Backend)
+	backend, ok := route.SingleBackend("test", "s2")
+	assert.True(t, ok)
+	assert.Equal(t, "backend1", backend)
+
+	// Backend doesn't exist.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		query := "create table s3(a int, b int) single on backendx"
+		_, err = client.FetchAll(query, -1)
+		want := "Single table backend 'backendx' doesn't exist (errno 1105) (sqlstate HY000)"
+		assert.Equal(t, want, err.Error())
+	}
+}
+
 func TestProxyMyLoaderImport(t *testing.T) {
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
 	fakedbs, proxy, cleanup := MockProxy(log)
@@ -538,6 +825,71 @@ func TestProxyDDLConstraint(t *testing.T) {
 	}
 }
 
+func TestProxyDDLUniqueKey(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+	route := proxy.Router()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create table .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("drop index .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("alter table .*", &sqltypes.Result{})
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+
+	querys := []string{
+		"create table t1(a int primary key, b int) partition by hash(a)",
+		"create table t2(a int, b int, c int, unique key uk_bc(b, c), primary key(a, b)) partition by hash(a)",
+		"create table t3(a int, b int, unique key uk_ba(b, a)) partition by hash(a)",
+		"create table t4(a int unique, b int) partition by hash(a)",
+		"create table t5(a int, b int, key idx_b(b)) partition by hash(a)",
+		"create table t6(a int, b int, primary key(a)) global",
+	}
+	type want struct {
+		name    string
+		columns []string
+	}
+	wants := []want{
+		{"PRIMARY", []string{"a"}},
+		{"PRIMARY", []string{"a", "b"}},
+		{"uk_ba", []string{"b", "a"}},
+		{"a", []string{"a"}},
+		{"", nil},
+		{"", nil},
+	}
+	for i, query := range querys {
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err, query)
+		name, columns := route.UniqueKey("test", fmt.Sprintf("t%d", i+1))
+		assert.Equal(t, wants[i].name, name, query)
+		assert.Equal(t, wants[i].columns, columns, query)
+	}
+
+	// The unique key is cleared by dropping its index or column.
+	{
+		_, err = client.FetchAll("drop index uk_bc on t2", -1)
+		assert.Nil(t, err)
+		_, columns := route.UniqueKey("test", "t2")
+		assert.Equal(t, []string{"a", "b"}, columns)
+		_, err = client.FetchAll("drop index `primary` on t2", -1)
+		assert.Nil(t, err)
+		_, columns = route.UniqueKey("test", "t2")
+		assert.Nil(t, columns)
+
+		_, err = client.FetchAll("alter table t3 drop column b", -1)
+		assert.Nil(t, err)
+		_, columns = route.UniqueKey("test", "t3")
+		assert.Nil(t, columns)
+	}
+}
+
 func TestProxyDDLShardKeyCheck(t *testing.T) {
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
 	fakedbs, proxy, cleanup := MockProxy(log)
@@ -604,3 +956,67 @@ func TestProxyDDLAlterCharset(t *testing.T) {
 		assert.Nil(t, err)
 	}
 }
+
+func TestProxyDDLSequence(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+	router := proxy.Router()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+	}
+
+	// No database.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		_, err = client.FetchAll("create sequence s1", -1)
+		want := "No database selected (errno 1046) (sqlstate 3D000)"
+		assert.Equal(t, want, err.Error())
+	}
+
+	querys := []struct {
+		query string
+		err   string
+	}{
+		{query: "create sequence s1 start with 100 increment by 2 cache 10"},
+		{query: "create sequence if not exists s1"},
+		{
+			query: "create sequence s1",
+			err:   "Sequence 'test.s1' already exists (errno 1105) (sqlstate HY000)",
+		},
+		{
+			query: "create sequence s2 increment by 0",
+			err:   "Incorrect INCREMENT value for SEQUENCE 'test.s2', it must be positive (errno 1105) (sqlstate HY000)",
+		},
+		{
+			query: "create sequence s2 start with 99999999999999999999",
+			err:   "Incorrect START value '99999999999999999999' for SEQUENCE 's2' (errno 1105) (sqlstate HY000)",
+		},
+		{query: "create sequence sbtest.s2"},
+		{query: "drop sequence if exists s3"},
+		{
+			query: "drop sequence s3",
+			err:   "Unknown SEQUENCE: 'test.s3' (errno 1105) (sqlstate HY000)",
+		},
+	}
+	client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+	assert.Nil(t, err)
+	for _, q := range querys {
+		_, err := client.FetchAll(q.query, -1)
+		if q.err == "" {
+			assert.Nil(t, err, q.query)
+		} else {
+			assert.Equal(t, q.err, err.Error())
+		}
+	}
+	assert.Equal(t, []string{"s1"}, router.Sequences("test"))
+	assert.Equal(t, []string{"s2"}, router.Sequences("sbtest"))
+
+	_, err = client.FetchAll("drop sequence s1", -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{}, router.Sequences("test"))
+}
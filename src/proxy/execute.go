@@ -10,6 +10,7 @@ package proxy
 
 import (
 	"errors"
+	"fmt"
 
 	"backend"
 	"executor"
@@ -23,6 +24,8 @@ import (
 )
 
 // ExecuteTwoPC allows multi-shards transactions with 2pc commit.
+// The statement runs in the multi-statement txn of the session if there is one, otherwise in its own txn
+// which is committed at the end of the statement.
 func (spanner *Spanner) ExecuteTwoPC(session *driver.Session, database string, query string, node sqlparser.Statement) (*sqltypes.Result, error) {
 	log := spanner.log
 	conf := spanner.conf
@@ -35,8 +38,7 @@ func (spanner *Spanner) ExecuteTwoPC(session *driver.Session, database string, q
 	singleStatement := false
 
 	// transaction.
-	mysession := sessions.getTxnSession(session)
-	txn = mysession.transaction
+	txn = sessions.getMultiStmtTxn(session)
 	if txn == nil {
 		txn, err = scatter.CreateTransaction()
 		if err != nil {
@@ -48,10 +50,8 @@ func (spanner *Spanner) ExecuteTwoPC(session *driver.Session, database string, q
 		// txn limits.
 		txn.SetTimeout(conf.Proxy.QueryTimeout)
 		txn.SetMaxResult(conf.Proxy.MaxResultSize)
-
-		// binding.
-		sessions.TxnBinding(session, txn, node, query)
-		defer sessions.TxnUnBinding(session)
+		txn.SetSpillConfig(conf.Spill)
+		txn.SetInsertSelectLimits(conf.Proxy.InsertSelectBatchRows, conf.Proxy.InsertSelectMaxRows)
 
 		// Transaction begin.
 		if err := txn.Begin(); err != nil {
@@ -61,18 +61,58 @@ func (spanner *Spanner) ExecuteTwoPC(session *driver.Session, database string, q
 		singleStatement = true
 	}
 
+	// binding.
+	sessions.TxnBinding(session, txn, node, query)
+	defer sessions.TxnUnBinding(session)
+
+	// The write of the multi-statement txn sets the statement savepoint first, the failed write
+	// is rollbacked to it as MySQL does and the txn goes on, the failed read changes nothing.
+	// The txn is aborted only if the savepoint fails, since the XA state of the backends is unknown,
+	// and the statements are rejected until ROLLBACK.
+	write := spanner.IsDMLWrite(node)
+	abort := func() {
+		if x := spanner.abortTxn(session); x != nil {
+			log.Error("spanner.execute.2pc.error.to.abort.multi.stmt.txn.still.error:[%v]", x)
+		}
+	}
+	if !singleStatement && write {
+		if err := txn.Savepoint(statementSavepoint); err != nil {
+			log.Error("spanner.execute.2pc.statement.savepoint.error:[%v]", err)
+			abort()
+			return nil, err
+		}
+	}
+	rollback := func() {
+		if singleStatement {
+			if x := txn.Rollback(); x != nil {
+				log.Error("spanner.execute.2pc.error.to.rollback.still.error:[%v]", x)
+			}
+			return
+		}
+		if !write {
+			return
+		}
+		if x := txn.RollbackToSavepoint(statementSavepoint); x != nil {
+			log.Error("spanner.execute.2pc.error.to.rollback.statement.still.error:[%v]", x)
+			abort()
+		}
+	}
+
 	// Transaction execute.
+	if query, err = spanner.rewriteSubqueries(txn, database, query, node); err != nil {
+		rollback()
+		return nil, err
+	}
 	plans, err := optimizer.NewSimpleOptimizer(log, database, query, node, router).BuildPlanTree()
 	if err != nil {
 		return nil, err
 	}
 
 	executors := executor.NewTree(log, plans, txn)
+	executors.SetStream(sessions.getResultStream(session))
 	qr, err := executors.Execute()
 	if err != nil {
-		if x := txn.Rollback(); x != nil {
-			log.Error("spanner.execute.2pc.error.to.rollback.still.error:[%v]", x)
-		}
+		rollback()
 		return nil, err
 	}
 
@@ -82,6 +122,7 @@ func (spanner *Spanner) ExecuteTwoPC(session *driver.Session, database string, q
 			return nil, err
 		}
 	}
+	sessions.setBinlogEvents(session, executors.BinlogEvents())
 	return qr, nil
 }
 
@@ -120,16 +161,22 @@ func (spanner *Spanner) executeWithTimeout(session *driver.Session, database str
 	// txn limits.
 	txn.SetTimeout(timeout)
 	txn.SetMaxResult(conf.Proxy.MaxResultSize)
+	txn.SetSpillConfig(conf.Spill)
+	txn.SetInsertSelectLimits(conf.Proxy.InsertSelectBatchRows, conf.Proxy.InsertSelectMaxRows)
 
 	// binding.
 	sessions.TxnBinding(session, txn, node, query)
 	defer sessions.TxnUnBinding(session)
 
+	if query, err = spanner.rewriteSubqueries(txn, database, query, node); err != nil {
+		return nil, err
+	}
 	plans, err := optimizer.NewSimpleOptimizer(log, database, query, node, router).BuildPlanTree()
 	if err != nil {
 		return nil, err
 	}
 	executors := executor.NewTree(log, plans, txn)
+	executors.SetStream(sessions.getResultStream(session))
 	qr, err := executors.Execute()
 	if err != nil {
 		return nil, err
@@ -137,6 +184,60 @@ func (spanner *Spanner) executeWithTimeout(session *driver.Session, database str
 	return qr, nil
 }
 
+// rewriteSubqueries used to evaluate the uncorrelated subqueries of the node in the transaction,
+// the results are substituted as the literals, returns the rewritten query.
+// The subquery result is limited by the SubqueryMaxRows while it's fetched.
+func (spanner *Spanner) rewriteSubqueries(txn backend.Transaction, database string, query string, node sqlparser.Statement) (string, error) {
+	log := spanner.log
+	router := spanner.router
+	maxRows := spanner.conf.Proxy.SubqueryMaxRows
+
+	eval := func(sub *sqlparser.Select) (*sqltypes.Result, error) {
+		plans, err := optimizer.NewSimpleOptimizer(log, database, sqlparser.String(sub), sub, router).BuildPlanTree()
+		if err != nil {
+			return nil, err
+		}
+		qr, err := executor.NewTree(log, plans, txn).ExecuteLimited(maxRows)
+		if err == executor.ErrRowsExceeded {
+			return nil, fmt.Errorf("subquery[%s].result.rows.exceeds.the.limit[%d]", sqlparser.String(sub), maxRows)
+		}
+		return qr, err
+	}
+	rewritten, err := planner.RewriteSubqueries(node, eval)
+	if err != nil {
+		return "", err
+	}
+	if rewritten {
+		query = sqlparser.String(node)
+		log.Debug("spanner.subqueries.rewritten.query:%s", query)
+	}
+	return query, nil
+}
+
+// rewriteSequences used to substitute the values for NEXTVAL() and LAST_INSERT_ID() of the session,
+// and fill the AUTO_INCREMENT column of the insert by the table sequence.
+// LAST_INSERT_ID(N) keeps N as the LAST_INSERT_ID() of the session.
+// Returns the rewritten query and the first AUTO_INCREMENT value generated.
+func (spanner *Spanner) rewriteSequences(session *driver.Session, query string, node sqlparser.Statement) (string, uint64, error) {
+	log := spanner.log
+	router := spanner.router
+	sessions := spanner.sessions
+
+	lastInsertID := sessions.getLastInsertID(session)
+	rewritten, insertID, newLastInsertID, err := planner.RewriteSequences(session.Schema(), node, router, lastInsertID)
+	if err != nil {
+		return "", 0, err
+	}
+	if newLastInsertID != lastInsertID {
+		sessions.setLastInsertID(session, newLastInsertID)
+	}
+	if rewritten {
+		query = sqlparser.String(node)
+		log.Debug("spanner.sequences.rewritten.query:%s", query)
+	}
+	return query, insertID, nil
+}
+
 // ExecuteStreamFetch used to execute a stream fetch query.
 func (spanner *Spanner) ExecuteStreamFetch(session *driver.Session, database string, query string, node sqlparser.Statement, callback func(qr *sqltypes.Result) error, streamBufferSize int) error {
 	log := spanner.log
@@ -160,6 +261,9 @@ func (spanner *Spanner) ExecuteStreamFetch(session *driver.Session, database str
 	if !ok {
 		return errors.New("ExecuteStreamFetch.only.support.select")
 	}
+	if query, err = spanner.rewriteSubqueries(txn, database, query, node); err != nil {
+		return err
+	}
 
 	plan := planner.NewSelectPlan(log, database, query, selectNode, router)
 	if err := plan.Build(); err != nil {
@@ -173,8 +277,27 @@ func (spanner *Spanner) ExecuteStreamFetch(session *driver.Session, database str
 }
 
 // Execute used to execute querys to shards.
+// The writes to the global tables always run in 2pc, since they fan out to all the backends.
+// The DMLs in the multi-statement transaction run in its XA.
+// The reads out of the transactions run in the consistent snapshot if the session or the hint asks.
 func (spanner *Spanner) Execute(session *driver.Session, database string, query string, node sqlparser.Statement) (*sqltypes.Result, error) {
+	if spanner.IsDML(node) {
+		txn, err := spanner.multiStmtTxn(session)
+		if err != nil {
+			return nil, err
+		}
+		if txn != nil {
+			return spanner.ExecuteTwoPC(session, database, query, node)
+		}
+	}
+	if spanner.isConsistentSnapshotRead(session, node) {
+		return spanner.ExecuteSnapshot(session, database, query, node)
+	}
+
 	// Execute.
+	if spanner.IsDMLWrite(node) && spanner.hasGlobalTable(database, node) {
+		return spanner.ExecuteTwoPC(session, database, query, node)
+	}
 	if spanner.isTwoPC() {
 		if spanner.IsDML(node) {
 			return spanner.ExecuteTwoPC(session, database, query, node)
@@ -10,6 +10,7 @@ package proxy
 
 import (
 	"errors"
+	"fmt"
 	"testing"
 
 	"fakedb"
@@ -17,8 +18,10 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/driver"
 	"github.com/xelabs/go-mysqlstack/sqldb"
-	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
+
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 )
 
 func TestProxyExecute(t *testing.T) {
@@ -225,6 +228,26 @@ func TestProxyExecuteBackup(t *testing.T) {
 		got := err.Error()
 		assert.Equal(t, want, got)
 	}
+
+	// The select in the transaction doesn't fall back to the backup.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		query := "select * from test.t1 join test.t2"
+		for _, begin := range []string{"begin", "set autocommit=0"} {
+			_, err = client.FetchAll(begin, -1)
+			assert.Nil(t, err)
+			_, err = client.FetchAll(query, -1)
+			assert.NotNil(t, err, begin)
+			_, err = client.FetchAll("rollback", -1)
+			assert.Nil(t, err)
+		}
+		_, err = client.FetchAll("set autocommit=1", -1)
+		assert.Nil(t, err)
+		qr, err := client.FetchAll(query, -1)
+		assert.Nil(t, err)
+		assert.Equal(t, fakedb.Result3, qr)
+	}
 }
 
 func TestProxyExecuteSelectError(t *testing.T) {
@@ -255,12 +278,333 @@ func TestProxyExecuteSelectError(t *testing.T) {
 		fakedbs.AddQuery(query, fakedb.Result3)
 		_, err = client.FetchAll(query, -1)
 
-		want := "unsupported: JOIN.expression (errno 1105) (sqlstate HY000)"
+		want := "Table 't2' doesn't exist (errno 1146) (sqlstate 42S02)"
 		got := err.Error()
 		assert.Equal(t, want, got)
 	}
 }
 
+func TestProxyExecuteCrossShardJoin(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	r1 := &sqltypes.Result{
+		Fields: []*querypb.Field{{Name: "id", Type: querypb.Type_INT32}},
+		Rows: [][]sqltypes.Value{
+			{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("1"))},
+			{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("2"))},
+		},
+	}
+	r2 := &sqltypes.Result{
+		Fields: []*querypb.Field{{Name: "name", Type: querypb.Type_VARCHAR}, {Name: "id", Type: querypb.Type_INT32}},
+		Rows: [][]sqltypes.Value{
+			{sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("a")), sqltypes.MakeTrusted(querypb.Type_INT32, []byte("1"))},
+		},
+	}
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create table .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select t1.id from test.t1_.*", r1)
+		fakedbs.AddQuery("select t2.name, t2.id from test.t2 as t2", r2)
+	}
+
+	// create test table.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		query := "create table test.t1(id int, b int) partition by hash(id)"
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+		query = "create table test.t2(id int, name varchar(10)) single"
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+
+	// join.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		query := "select t1.id, t2.name from test.t1 join test.t2 on t1.id = t2.id"
+		qr, err := client.FetchAll(query, -1)
+		assert.Nil(t, err)
+		assert.True(t, len(qr.Rows) > 0)
+		for _, row := range qr.Rows {
+			assert.Equal(t, "[1 a]", fmt.Sprintf("%v", row))
+		}
+	}
+}
+
+func TestProxyExecuteUnion(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	r1 := &sqltypes.Result{
+		Fields: []*querypb.Field{{Name: "id", Type: querypb.Type_INT32}},
+		Rows: [][]sqltypes.Value{
+			{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("1"))},
+			{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("2"))},
+		},
+	}
+	r2 := &sqltypes.Result{
+		Fields: []*querypb.Field{{Name: "id", Type: querypb.Type_INT32}},
+		Rows: [][]sqltypes.Value{
+			{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("3"))},
+			{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("1"))},
+		},
+	}
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create table .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select id from test.t1_.*", r1)
+		fakedbs.AddQuery("select id from test.t2 as t2", r2)
+	}
+
+	// create test table.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		query := "create table test.t1(id int, b int) partition by hash(id)"
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+		query = "create table test.t2(id int, name varchar(10)) single"
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+
+	// union.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		querys := []string{
+			"select id from test.t1 union select id from test.t2 order by id",
+			"select id from test.t1 union all select id from test.t2 order by id desc limit 2",
+		}
+		results := []string{
+			"[[1] [2] [3]]",
+			"[[3] [2]]",
+		}
+		for i, query := range querys {
+			qr, err := client.FetchAll(query, -1)
+			assert.Nil(t, err)
+			assert.Equal(t, results[i], fmt.Sprintf("%v", qr.Rows))
+		}
+	}
+}
+
+func TestProxyExecuteInsertSelect(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	r1 := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "id", Type: querypb.Type_INT32},
+			{Name: "b", Type: querypb.Type_INT32},
+		},
+		Rows: [][]sqltypes.Value{
+			{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("1")), sqltypes.MakeTrusted(querypb.Type_INT32, []byte("2"))},
+			{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("3")), sqltypes.MakeTrusted(querypb.Type_INT32, []byte("4"))},
+		},
+	}
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create table .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select id, b from test.t1_.*", r1)
+		fakedbs.AddQueryPattern("insert into test.t2.*", &sqltypes.Result{RowsAffected: 1})
+		fakedbs.AddQueryPattern("xa .*", &sqltypes.Result{})
+	}
+
+	// create test table.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		query := "create table test.t1(id int, b int) partition by hash(id)"
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+		query = "create table test.t2(id int, b int) single"
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+
+	// insert select, the rows are inserted into the single table by one batch.
+	{
+		proxy.conf.Proxy.InsertSelectBatchRows = 100000
+		for _, twopc := range []bool{false, true} {
+			proxy.conf.Proxy.TwopcEnable = twopc
+			client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+			assert.Nil(t, err)
+			qr, err := client.FetchAll("insert into test.t2(id, b) select id, b from test.t1", -1)
+			assert.Nil(t, err)
+			assert.Equal(t, uint64(1), qr.RowsAffected)
+			client.Close()
+		}
+	}
+
+	// insert select exceeds the max rows.
+	{
+		proxy.conf.Proxy.TwopcEnable = false
+		proxy.conf.Proxy.InsertSelectMaxRows = 3
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		_, err = client.FetchAll("insert into test.t2(id, b) select id, b from test.t1", -1)
+		want := "insert.select.rows.exceeds.the.limit[3] (errno 1105) (sqlstate HY000)"
+		assert.Equal(t, want, err.Error())
+	}
+}
+
+func TestProxyExecuteMultiTableDML(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	r1 := &sqltypes.Result{
+		Fields: []*querypb.Field{{Name: "id", Type: querypb.Type_INT32}},
+		Rows: [][]sqltypes.Value{
+			{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("1"))},
+		},
+	}
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create table .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select t1.id from test.t1_.*", r1)
+		fakedbs.AddQuery("select t2.id from test.t2 as t2", r1)
+		fakedbs.AddQueryPattern("update test.t1_.* set b = 2 where id in \\(1\\)", &sqltypes.Result{RowsAffected: 1})
+		fakedbs.AddQueryPattern("delete from test.t1_.* where id in \\(1\\)", &sqltypes.Result{RowsAffected: 1})
+		fakedbs.AddQueryPattern("xa .*", &sqltypes.Result{})
+	}
+
+	// create test table.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		query := "create table test.t1(id int primary key, b int) partition by hash(id)"
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+		query = "create table test.t2(id int, b int) single"
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+		query = "create table test.t3(id int, b int) partition by hash(id)"
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+
+	// The rows of t3 can't be identified without the unique key.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		_, err = client.FetchAll("delete t3 from test.t3 join test.t2 on t3.id = t2.id", -1)
+		want := "unsupported: table[t3].without.primary.or.unique.key.can.not.be.changed.across.shards (errno 1105) (sqlstate HY000)"
+		assert.Equal(t, want, err.Error())
+	}
+
+	// The rows of t1 are looked up, every partition matches the same key.
+	{
+		querys := []string{
+			"update test.t1 join test.t2 on t1.id = t2.id set t1.b = 2",
+			"delete t1 from test.t1 join test.t2 on t1.id = t2.id",
+		}
+		for _, twopc := range []bool{false, true} {
+			proxy.conf.Proxy.TwopcEnable = twopc
+			for _, query := range querys {
+				client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+				assert.Nil(t, err)
+				qr, err := client.FetchAll(query, -1)
+				assert.Nil(t, err)
+				assert.Equal(t, uint64(1), qr.RowsAffected)
+				client.Close()
+			}
+		}
+	}
+}
+
+func TestProxyExecuteSubquery(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	r1 := &sqltypes.Result{
+		Fields: []*querypb.Field{{Name: "uid", Type: querypb.Type_INT32}},
+		Rows: [][]sqltypes.Value{
+			{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("1"))},
+			{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("3"))},
+		},
+	}
+	r2 := &sqltypes.Result{
+		Fields: []*querypb.Field{{Name: "id", Type: querypb.Type_INT32}},
+		Rows: [][]sqltypes.Value{
+			{sqltypes.MakeTrusted(querypb.Type_INT32, []byte("3"))},
+		},
+	}
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create table .*", &sqltypes.Result{})
+		fakedbs.AddQuery("select uid from test.t2 as t2", r1)
+		fakedbs.AddQueryPattern("select (/\\*backup\\*/ )?id from test.t1_.* as t1 where id in .*", r2)
+	}
+
+	// create test table.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		query := "create table test.t1(id int, b int) partition by hash(id)"
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+		query = "create table test.t2(uid int) single"
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+
+	// select.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		query := "select id from test.t1 where id in (select uid from test.t2)"
+		qr, err := client.FetchAll(query, -1)
+		assert.Nil(t, err)
+		assert.True(t, len(qr.Rows) > 0)
+		for _, row := range qr.Rows {
+			assert.Equal(t, "[3]", fmt.Sprintf("%v", row))
+		}
+
+		// The stream fetch rewrites the subqueries too.
+		query = "select /*backup*/ id from test.t1 where id in (select uid from test.t2)"
+		qr, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+		assert.True(t, len(qr.Rows) > 0)
+		for _, row := range qr.Rows {
+			assert.Equal(t, "[3]", fmt.Sprintf("%v", row))
+		}
+	}
+
+	// subquery result exceeds the limit.
+	{
+		proxy.conf.Proxy.SubqueryMaxRows = 1
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		want := "subquery[select uid from test.t2].result.rows.exceeds.the.limit[1] (errno 1105) (sqlstate HY000)"
+		for _, query := range []string{
+			"select id from test.t1 where id in (select uid from test.t2)",
+			"select /*backup*/ id from test.t1 where id in (select uid from test.t2)",
+		} {
+			_, err = client.FetchAll(query, -1)
+			assert.Equal(t, want, err.Error())
+		}
+	}
+}
+
 func TestProxyExecuteReadonly(t *testing.T) {
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
 	fakedbs, proxy, cleanup := MockProxyWithBackup(log)
@@ -352,3 +696,86 @@ func TestProxyExecuteStreamFetch(t *testing.T) {
 		assert.Nil(t, err)
 	}
 }
+
+func TestProxyExecuteGlobalTable(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+	backends := len(proxy.Scatter().Backends())
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create table .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("xa .*", &sqltypes.Result{})
+	}
+
+	// create test table.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		query := "create table test.g1(id int, b int) global"
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+
+	// Insert fans out to all the backends.
+	{
+		proxy.conf.Proxy.TwopcEnable = false
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		query := "insert into test.g1 (id, b) values(1,2),(3,4)"
+		fakedbs.AddQuery("insert into test.g1(id, b) values (1, 2), (3, 4)", &sqltypes.Result{RowsAffected: 2})
+		qr, err := client.FetchAll(query, -1)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(2*backends), qr.RowsAffected)
+		assert.Equal(t, backends, fakedbs.GetQueryCalledNum("insert into test.g1(id, b) values (1, 2), (3, 4)"))
+	}
+
+	// Select reads from one backend.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		query := "select * from test.g1"
+		fakedbs.AddQuery("select * from test.g1 as g1", fakedb.Result3)
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum("select * from test.g1 as g1"))
+	}
+}
+
+func TestProxyExecuteGlobalTable2PCError(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create table .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("update .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("xa start .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("xa end .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("xa rollback .*", &sqltypes.Result{})
+		fakedbs.AddQueryErrorPattern("xa prepare.*", errors.New("mock.xa.prepare.error"))
+	}
+
+	// create test table.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		query := "create table test.g1(id int, b int) global"
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+
+	// The write runs in 2pc even if the twopc is disabled.
+	{
+		proxy.conf.Proxy.TwopcEnable = false
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		query := "update test.g1 set b=1 where id=1"
+		_, err = client.FetchAll(query, -1)
+		assert.NotNil(t, err)
+	}
+}
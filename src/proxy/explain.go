@@ -53,6 +53,7 @@ func (spanner *Spanner) handleExplain(session *driver.Session, query string, nod
 	// see https://dev.mysql.com/doc/refman/5.7/en/explain.html
 	switch subNode.(type) {
 	case *sqlparser.Select:
+	case *sqlparser.Union:
 	case *sqlparser.Delete:
 	case *sqlparser.Insert:
 	case *sqlparser.Update:
@@ -19,3 +19,14 @@ func (spanner *Spanner) handleInsert(session *driver.Session, query string, node
 	database := session.Schema()
 	return spanner.Execute(session, database, query, node)
 }
+
+// setInsertID used to set the insert id of the result to the first AUTO_INCREMENT value generated,
+// and keep it as the LAST_INSERT_ID() of the session.
+func (spanner *Spanner) setInsertID(session *driver.Session, qr *sqltypes.Result, insertID uint64) {
+	if insertID != 0 {
+		qr.InsertID = insertID
+	}
+	if qr.InsertID != 0 {
+		spanner.sessions.setLastInsertID(session, qr.InsertID)
+	}
+}
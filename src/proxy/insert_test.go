@@ -9,12 +9,16 @@
 package proxy
 
 import (
+	"fmt"
+	"os"
 	"testing"
+	"time"
 
 	"fakedb"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/driver"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
@@ -133,3 +137,158 @@ func TestProxyLongTimeQuerys(t *testing.T) {
 		assert.NotNil(t, err)
 	}
 }
+
+func TestProxyInsertAutoIncrement(t *testing.T) {
+	conf := MockDefaultConfig()
+	conf.Binlog.EnableBinlog = true
+	os.RemoveAll(conf.Binlog.LogDir)
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy1(log, conf)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create table .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("insert into test.t1_.*", &sqltypes.Result{RowsAffected: 1})
+	}
+
+	// create test table.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		query := "create table test.t1(id bigint auto_increment, b int) partition by hash(id)"
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+		assert.Equal(t, "id", proxy.Router().AutoIncrement("test", "t1"))
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+	assert.Nil(t, err)
+
+	// The shard key is filled by the table sequence.
+	{
+		qr, err := client.FetchAll("insert into t1(b) values(1), (2)", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(1), qr.InsertID)
+
+		qr, err = client.FetchAll("insert into t1(id, b) values(null, 3)", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(3), qr.InsertID)
+
+		// The explicit value keeps the LAST_INSERT_ID().
+		qr, err = client.FetchAll("insert into t1(id, b) values(100, 4)", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(0), qr.InsertID)
+	}
+
+	// LAST_INSERT_ID().
+	{
+		result := &sqltypes.Result{
+			Fields: []*querypb.Field{{Name: "last_insert_id()", Type: querypb.Type_UINT64}},
+			Rows:   [][]sqltypes.Value{{sqltypes.MakeTrusted(querypb.Type_UINT64, []byte("3"))}},
+		}
+		fakedbs.AddQuery("select 3 as `last_insert_id()` from dual", result)
+		qr, err := client.FetchAll("select last_insert_id()", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, "3", qr.Rows[0][0].String())
+
+		// The other sessions have their own.
+		client1, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+		assert.Nil(t, err)
+		fakedbs.AddQuery("select 0 as `last_insert_id()` from dual", result)
+		_, err = client1.FetchAll("select last_insert_id()", -1)
+		assert.Nil(t, err)
+	}
+
+	// NEXTVAL().
+	{
+		_, err := client.FetchAll("create sequence s1 start with 1000", -1)
+		assert.Nil(t, err)
+
+		result := &sqltypes.Result{
+			Fields: []*querypb.Field{{Name: "nextval(s1)", Type: querypb.Type_INT64}},
+			Rows:   [][]sqltypes.Value{{sqltypes.MakeTrusted(querypb.Type_INT64, []byte("1000"))}},
+		}
+		fakedbs.AddQuery("select 1000 as `nextval(s1)` from dual", result)
+		qr, err := client.FetchAll("select nextval(s1)", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, "1000", qr.Rows[0][0].String())
+
+		_, err = client.FetchAll("insert into t1(id, b) values(nextval(s1), 5)", -1)
+		assert.Nil(t, err)
+
+		_, err = client.FetchAll("update t1 set b = nextval(s1)", -1)
+		want := "unsupported: nextval.only.in.insert.values.or.select.without.tables (errno 1105) (sqlstate HY000)"
+		assert.Equal(t, want, err.Error())
+	}
+
+	// The binlog records the generated values.
+	{
+		time.Sleep(time.Millisecond * 100)
+		qr, err := client.FetchAll("show binlog events", -1)
+		assert.Nil(t, err)
+		var got []string
+		for _, row := range qr.Rows {
+			got = append(got, fmt.Sprintf("%s:%s", row[3].String(), row[6].String()))
+		}
+		want := []string{
+			"DDL:create table test.t1(id bigint auto_increment, b int) partition by hash(id)",
+			"INSERT:insert into t1(b, id) values (1, 1), (2, 2)",
+			"INSERT:insert into t1(id, b) values (3, 3)",
+			"INSERT:insert into t1(id, b) values(100, 4)",
+			"DDL:create sequence s1 start with 1000",
+			"INSERT:insert into t1(id, b) values (1001, 5)",
+		}
+		assert.Equal(t, want, got)
+	}
+	// The values without the column list are in the table order.
+	{
+		fakedbs.AddQueryPattern("alter table .*", &sqltypes.Result{})
+		assert.Equal(t, []string{"id", "b"}, proxy.Router().Columns("test", "t1"))
+		qr, err := client.FetchAll("insert into t1 values(null, 6)", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(4), qr.InsertID)
+
+		_, err = client.FetchAll("alter table t1 add column (c int)", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("alter table t1 drop column b", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"id", "c"}, proxy.Router().Columns("test", "t1"))
+		qr, err = client.FetchAll("insert into t1 values(0, 7)", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(5), qr.InsertID)
+	}
+
+	// LAST_INSERT_ID(N) keeps N.
+	{
+		result := &sqltypes.Result{
+			Fields: []*querypb.Field{{Name: "last_insert_id()", Type: querypb.Type_UINT64}},
+			Rows:   [][]sqltypes.Value{{sqltypes.MakeTrusted(querypb.Type_UINT64, []byte("100"))}},
+		}
+		fakedbs.AddQuery("select 100 as `last_insert_id(100)` from dual", result)
+		fakedbs.AddQuery("select 100 as `last_insert_id()` from dual", result)
+		_, err := client.FetchAll("select last_insert_id(100)", -1)
+		assert.Nil(t, err)
+		qr, err := client.FetchAll("select last_insert_id()", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, "100", qr.Rows[0][0].String())
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum("select 100 as `last_insert_id()` from dual"))
+	}
+
+	// The table sequence starts from the AUTO_INCREMENT option.
+	{
+		fakedbs.AddQueryPattern("insert into test.t2_.*", &sqltypes.Result{RowsAffected: 1})
+		_, err := client.FetchAll("create table t2(id bigint auto_increment, b int) auto_increment=1000 partition by hash(id)", -1)
+		assert.Nil(t, err)
+		qr, err := client.FetchAll("insert into t2(b) values(1)", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(1000), qr.InsertID)
+
+		_, err = client.FetchAll("create table t3(id bigint auto_increment, b int) auto_increment=99999999999999999999 partition by hash(id)", -1)
+		want := "Incorrect AUTO_INCREMENT value '99999999999999999999' for table 't3' (errno 1105) (sqlstate HY000)"
+		assert.Equal(t, want, err.Error())
+	}
+}
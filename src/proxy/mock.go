@@ -39,6 +39,7 @@ func MockDefaultConfig() *config.Config {
 		Binlog:  config.DefaultBinlogConfig(),
 		Log:     config.DefaultLogConfig(),
 		Scatter: config.DefaultScatterConfig(),
+		Spill:   config.DefaultSpillConfig(),
 	}
 	return conf
 }
@@ -92,6 +93,7 @@ func MockProxy1(log *xlog.Log, conf *config.Config) (*fakedb.DB, *Proxy, func())
 	timestamp := t.Format(fileFormat)
 	metaDir := tmpDir + "/test_radonmeta_" + timestamp
 	conf.Proxy.MetaDir = metaDir
+	conf.Scatter.XaCheckDir = tmpDir + "/xacheck"
 
 	if x := os.MkdirAll(metaDir, 0777); x != nil {
 		log.Panic("%+v", x)
@@ -125,6 +127,7 @@ func MockProxy2(log *xlog.Log, conf *config.Config) (*fakedb.DB, *Proxy, func())
 	conf.Proxy.Endpoint = addr
 	metaDir := tmpDir + "/test_radonmeta_"
 	conf.Proxy.MetaDir = metaDir
+	conf.Scatter.XaCheckDir = tmpDir + "/xacheck"
 
 	os.RemoveAll(metaDir)
 	if x := os.MkdirAll(metaDir, 0777); x != nil {
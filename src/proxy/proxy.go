@@ -9,6 +9,10 @@
 package proxy
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"sync"
 
 	"audit"
@@ -48,6 +52,9 @@ func NewProxy(log *xlog.Log, path string, conf *config.Config) *Proxy {
 	scatter := backend.NewScatter(log, conf.Proxy.MetaDir)
 	syncer := syncer.NewSyncer(log, conf.Proxy.MetaDir, conf.Proxy.PeerAddress, router, scatter)
 	binlog := binlog.NewBinlog(log, conf.Binlog)
+	if conf.Spill != nil {
+		conf.Spill.Dir = filepath.Join(conf.Proxy.MetaDir, config.SpillDirName)
+	}
 	return &Proxy{
 		log:      log,
 		conf:     conf,
@@ -99,6 +106,17 @@ func (p *Proxy) Start() {
 	if err := scatter.Init(p.conf.Scatter); err != nil {
 		log.Panic("proxy.scatter.init.panic:%+v", err)
 	}
+	// The runs are spilled into the directory of this process, which is removed at stop.
+	if conf.Spill != nil {
+		if err := os.MkdirAll(conf.Spill.Dir, 0744); err != nil {
+			log.Panic("proxy.spill.dir.create.panic:%+v", err)
+		}
+		dir, err := ioutil.TempDir(conf.Spill.Dir, fmt.Sprintf("radon-%d-", os.Getpid()))
+		if err != nil {
+			log.Panic("proxy.spill.dir.create.panic:%+v", err)
+		}
+		conf.Spill.Dir = dir
+	}
 
 	spanner := NewSpanner(log, conf, iptable, router, scatter, binlog, sessions, audit, throttle)
 	if err := spanner.Init(); err != nil {
@@ -126,6 +144,11 @@ func (p *Proxy) Stop() {
 	p.audit.Close()
 	p.syncer.Close()
 	p.binlog.Close()
+	if p.conf.Spill != nil {
+		if err := os.RemoveAll(p.conf.Spill.Dir); err != nil {
+			log.Error("proxy.spill.dir.remove.error:%+v", err)
+		}
+	}
 	log.Info("proxy.shutdown.complete...")
 }
 
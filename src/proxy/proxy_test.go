@@ -9,8 +9,12 @@
 package proxy
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
+	"config"
+
 	"github.com/fortytw2/leaktest"
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/xlog"
@@ -109,3 +113,16 @@ func TestProxy1(t *testing.T) {
 		assert.NotNil(t, addr)
 	}
 }
+
+func TestProxySpillDir(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	_, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+
+	// The runs are spilled into the directory of this process under the meta-dir.
+	conf := proxy.Config()
+	assert.Equal(t, filepath.Join(conf.Proxy.MetaDir, config.SpillDirName), filepath.Dir(conf.Spill.Dir))
+	info, err := os.Stat(conf.Spill.Dir)
+	assert.Nil(t, err)
+	assert.True(t, info.IsDir())
+}
@@ -35,12 +35,14 @@ func returnQuery(qr *sqltypes.Result, callback func(qr *sqltypes.Result) error,
 // 1. DDL
 // 2. DML
 // 3. USE DB
+// 4. BEGIN/START TRANSACTION, COMMIT, ROLLBACK and SET autocommit
 func (spanner *Spanner) ComQuery(session *driver.Session, query string, callback func(qr *sqltypes.Result) error) error {
 	var qr *sqltypes.Result
 	log := spanner.log
 	throttle := spanner.throttle
 	diskChecker := spanner.diskChecker
-	hasBackup := spanner.scatter.HasBackup()
+	// The reads in the transaction don't fall back to the backup node, which is out of the transaction.
+	hasBackup := spanner.scatter.HasBackup() && !spanner.inTxn(session)
 	timeStart := time.Now()
 	slowQueryTime := time.Duration(spanner.conf.Proxy.LongQueryTime) * time.Second
 
@@ -83,6 +85,20 @@ func (spanner *Spanner) ComQuery(session *driver.Session, query string, callback
 	defer func() {
 		queryStat(node, timeStart, slowQueryTime, err)
 	}()
+
+	// The aborted transaction.
+	if err = spanner.checkTxnAborted(session, node); err != nil {
+		log.Error("proxy.query[%s].from.session[%v].error:%+v", xbase.TruncateQuery(query, 256), session.ID(), err)
+		return err
+	}
+
+	// Sequences.
+	var insertID uint64
+	if query, insertID, err = spanner.rewriteSequences(session, query, node); err != nil {
+		log.Error("proxy.sequences[%s].from.session[%v].error:%+v", xbase.TruncateQuery(query, 256), session.ID(), err)
+		return err
+	}
+
 	switch node.(type) {
 	case *sqlparser.Use:
 		if qr, err = spanner.handleUseDB(session, query, node); err != nil {
@@ -91,7 +107,10 @@ func (spanner *Spanner) ComQuery(session *driver.Session, query string, callback
 		spanner.auditLog(session, R, xbase.USEDB, query, qr)
 		return returnQuery(qr, callback, err)
 	case *sqlparser.DDL:
-		if qr, err = spanner.handleDDL(session, query, node); err != nil {
+		// The DDL commits the open transaction implicitly as MySQL does.
+		if err = spanner.commitTxn(session); err != nil {
+			log.Error("proxy.DDL[%s].implicit.commit.from.session[%v].error:%+v", query, session.ID(), err)
+		} else if qr, err = spanner.handleDDL(session, query, node); err != nil {
 			log.Error("proxy.DDL[%s].from.session[%v].error:%+v", query, session.ID(), err)
 		} else {
 			// Binlog.
@@ -166,6 +185,7 @@ func (spanner *Spanner) ComQuery(session *driver.Session, query string, callback
 		if qr, err = spanner.handleInsert(session, query, node); err != nil {
 			log.Error("proxy.insert[%s].from.session[%v].error:%+v", xbase.TruncateQuery(query, 256), session.ID(), err)
 		} else {
+			spanner.setInsertID(session, qr, insertID)
 			// Binlog.
 			spanner.logEvent(session, xbase.INSERT, query)
 		}
@@ -216,6 +236,9 @@ func (spanner *Spanner) ComQuery(session *driver.Session, query string, callback
 			log.Warning("proxy.select.for.backup:[%s].done", query)
 			return nil
 		default:
+			// The large sorted result may be streamed to the client while it's merged.
+			spanner.sessions.setResultStream(session, callback)
+			defer spanner.sessions.setResultStream(session, nil)
 			switch snode.From[0].(type) {
 			case *sqlparser.AliasedTableExpr:
 				aliasTableExpr := snode.From[0].(*sqlparser.AliasedTableExpr)
@@ -234,8 +257,8 @@ func (spanner *Spanner) ComQuery(session *driver.Session, query string, callback
 				} else { // e.g.: select a from table [as] aliasTable;
 					if qr, err = spanner.handleSelect(session, query, node); err != nil {
 						log.Error("proxy.select[%s].from.session[%v].error:%+v", query, session.ID(), err)
-						// Send to AP node if we have.
-						if hasBackup {
+						// Send to AP node if we have and nothing is sent to the client.
+						if hasBackup && !spanner.sessions.resultStreamed(session) {
 							if qr, err = spanner.handleBackupQuery(session, query, node); err != nil {
 								log.Error("proxy.backup.select[%s].error:%+v", xbase.TruncateQuery(query, 256), err)
 							}
@@ -247,8 +270,8 @@ func (spanner *Spanner) ComQuery(session *driver.Session, query string, callback
 			default: // ParenTableExpr, JoinTableExpr
 				if qr, err = spanner.handleSelect(session, query, node); err != nil {
 					log.Error("proxy.select[%s].from.session[%v].error:%+v", query, session.ID(), err)
-					// Send to AP node if we have.
-					if hasBackup {
+					// Send to AP node if we have and nothing is sent to the client.
+					if hasBackup && !spanner.sessions.resultStreamed(session) {
 						if qr, err = spanner.handleBackupQuery(session, query, node); err != nil {
 							log.Error("proxy.backup.select[%s].error:%+v", xbase.TruncateQuery(query, 256), err)
 						}
@@ -258,6 +281,18 @@ func (spanner *Spanner) ComQuery(session *driver.Session, query string, callback
 				return returnQuery(qr, callback, err)
 			}
 		}
+	case *sqlparser.Union:
+		if qr, err = spanner.handleSelect(session, query, node); err != nil {
+			log.Error("proxy.union[%s].from.session[%v].error:%+v", query, session.ID(), err)
+			// Send to AP node if we have.
+			if hasBackup {
+				if qr, err = spanner.handleBackupQuery(session, query, node); err != nil {
+					log.Error("proxy.backup.union[%s].error:%+v", xbase.TruncateQuery(query, 256), err)
+				}
+			}
+		}
+		spanner.auditLog(session, R, xbase.SELECT, query, qr)
+		return returnQuery(qr, callback, err)
 	case *sqlparser.Kill:
 		if qr, err = spanner.handleKill(session, query, node); err != nil {
 			log.Error("proxy.kill[%s].from.session[%v].error:%+v", query, session.ID(), err)
@@ -271,17 +306,18 @@ func (spanner *Spanner) ComQuery(session *driver.Session, query string, callback
 		spanner.auditLog(session, R, xbase.EXPLAIN, query, qr)
 		return returnQuery(qr, callback, err)
 	case *sqlparser.Transaction:
-		// Support for myloader.
-		log.Warning("proxy.query.transaction.query:%s", query)
+		if qr, err = spanner.handleTransaction(session, query, node); err != nil {
+			log.Error("proxy.transaction[%s].from.session[%v].error:%+v", query, session.ID(), err)
+		}
 		spanner.auditLog(session, R, xbase.TRANSACTION, query, qr)
-		qr = &sqltypes.Result{Warnings: 1}
-		return returnQuery(qr, callback, nil)
+		return returnQuery(qr, callback, err)
 	case *sqlparser.Set:
-		// Support for JDBC/myloader.
 		log.Warning("proxy.query.set.query:%s", query)
-		qr = &sqltypes.Result{Warnings: 1}
+		if qr, err = spanner.handleSet(session, query, node); err != nil {
+			log.Error("proxy.set[%s].from.session[%v].error:%+v", query, session.ID(), err)
+		}
 		spanner.auditLog(session, R, xbase.SET, query, qr)
-		return returnQuery(qr, callback, nil)
+		return returnQuery(qr, callback, err)
 	default:
 		log.Error("proxy.unsupported[%s].from.session[%v]", query, session.ID())
 		spanner.auditLog(session, R, xbase.UNSUPPORT, query, qr)
@@ -293,7 +329,7 @@ func (spanner *Spanner) ComQuery(session *driver.Session, query string, callback
 // IsDML returns the DML query or not.
 func (spanner *Spanner) IsDML(node sqlparser.Statement) bool {
 	switch node.(type) {
-	case *sqlparser.Select, *sqlparser.Insert, *sqlparser.Delete, *sqlparser.Update:
+	case *sqlparser.Select, *sqlparser.Union, *sqlparser.Insert, *sqlparser.Delete, *sqlparser.Update:
 		return true
 	}
 	return false
@@ -308,6 +344,26 @@ func (spanner *Spanner) IsDMLWrite(node sqlparser.Statement) bool {
 	return false
 }
 
+// hasGlobalTable returns true if the statement refers to any global table.
+func (spanner *Spanner) hasGlobalTable(database string, node sqlparser.Statement) bool {
+	router := spanner.router
+	found := false
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+		if tn, ok := node.(sqlparser.TableName); ok {
+			db := database
+			if !tn.Qualifier.IsEmpty() {
+				db = tn.Qualifier.String()
+			}
+			if router.IsGlobal(db, tn.Name.String()) {
+				found = true
+				return false, nil
+			}
+		}
+		return true, nil
+	}, node)
+	return found
+}
+
 // IsDDL returns the DDL query or not.
 func (spanner *Spanner) IsDDL(node sqlparser.Statement) bool {
 	switch node.(type) {
@@ -332,7 +388,7 @@ func queryStat(node sqlparser.Statement, timeStart time.Time, slowQueryTime time
 		command = "Delete"
 	case *sqlparser.Update:
 		command = "Update"
-	case *sqlparser.Select:
+	case *sqlparser.Select, *sqlparser.Union:
 		command = "Select"
 	case *sqlparser.Kill:
 		command = "Kill"
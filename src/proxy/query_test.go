@@ -10,8 +10,11 @@ package proxy
 
 import (
 	"errors"
+	"fmt"
 	"testing"
 
+	"config"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/driver"
 	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
@@ -243,6 +246,59 @@ func TestProxyQueryStream(t *testing.T) {
 	}
 }
 
+func TestProxyQuerySpillStream(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	conf := MockDefaultConfig()
+	conf.Proxy.MaxResultSize = 1024
+	conf.Spill = &config.SpillConfig{Enable: true, MemoryBudget: 1024}
+	fakedbs, proxy, cleanup := MockProxy1(log, conf)
+	defer cleanup()
+	address := proxy.Address()
+
+	rs := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{Name: "name", Type: querypb.Type_VARCHAR},
+			{Name: "id", Type: querypb.Type_INT32},
+		},
+	}
+	for i := 100; i > 0; i-- {
+		rs.Rows = append(rs.Rows, []sqltypes.Value{
+			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(fmt.Sprintf("n%03d", i))),
+			sqltypes.MakeTrusted(querypb.Type_INT32, []byte(fmt.Sprintf("%d", i))),
+		})
+	}
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("create table .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select name, id from test.t1_.* order by id desc", rs)
+	}
+
+	// create test table.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		query := "create table test.t1(id int, name varchar(10)) partition by hash(id)"
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+
+	// The spilled sorted rows are streamed beyond the max-result-size.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		qr, err := client.FetchAll("select name from test.t1 order by id desc", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(qr.Fields))
+		assert.True(t, len(qr.Rows) > 100)
+		assert.Equal(t, 0, len(qr.Rows)%100)
+		assert.Equal(t, "n100", qr.Rows[0][0].String())
+		assert.Equal(t, "n001", qr.Rows[len(qr.Rows)-1][0].String())
+	}
+}
+
 // Proxy with backup
 func TestProxyQueryStreamWithBackup(t *testing.T) {
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
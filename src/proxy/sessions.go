@@ -10,12 +10,16 @@ package proxy
 
 import (
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"backend"
+	"xcontext"
+
 	"github.com/xelabs/go-mysqlstack/driver"
 	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
 
@@ -26,6 +30,52 @@ type session struct {
 	session     *driver.Session
 	timestamp   int64
 	transaction backend.Transaction
+
+	// events are the binlog events of the last statement, logged instead of the statement.
+	events []xcontext.BinlogEvent
+
+	// lastInsertID is the value of LAST_INSERT_ID().
+	lastInsertID uint64
+
+	// multiStmtTxn is the transaction started by BEGIN or by the statement with autocommit off,
+	// it's bound to the session across the statements until COMMIT or ROLLBACK.
+	multiStmtTxn backend.Transaction
+
+	// txnEvents are the binlog events of the multiStmtTxn, logged when it commits.
+	txnEvents []txnEvent
+
+	// txnSavepoints are the savepoints of the multiStmtTxn.
+	txnSavepoints []txnSavepoint
+
+	// txnAborted is true if the multiStmtTxn is rollbacked by the failed statement,
+	// the statements are rejected until ROLLBACK.
+	txnAborted bool
+
+	// autocommit is false if the session sets autocommit=0.
+	autocommit bool
+
+	// stream is the callback to send the result of the statement to the client in parts,
+	// streamed is true once a part is sent.
+	stream   func(*sqltypes.Result) error
+	streamed bool
+
+	// consistentSnapshot is true if the session sets radon_consistent_snapshot=1,
+	// the reads out of the transactions run in the consistent snapshot.
+	consistentSnapshot bool
+}
+
+// txnEvent is the binlog event of the statement in the multi-statement transaction.
+type txnEvent struct {
+	schema string
+	typ    string
+	query  string
+}
+
+// txnSavepoint tuple.
+// The events is the number of the txnEvents when the savepoint is set.
+type txnSavepoint struct {
+	name   string
+	events int
 }
 
 // Sessions tuple.
@@ -49,8 +99,9 @@ func (ss *Sessions) Add(s *driver.Session) {
 	ss.mu.Lock()
 	defer ss.mu.Unlock()
 	ss.sessions[s.ID()] = &session{
-		session:   s,
-		timestamp: time.Now().Unix()}
+		session:    s,
+		autocommit: true,
+		timestamp:  time.Now().Unix()}
 }
 
 func (ss *Sessions) txnAbort(txn backend.Transaction, node sqlparser.Statement) {
@@ -66,7 +117,7 @@ func (ss *Sessions) txnAbort(txn backend.Transaction, node sqlparser.Statement)
 	// If the client closed, txn will be abort by backend.
 	if txn != nil && node != nil {
 		switch node.(type) {
-		case *sqlparser.Select, *sqlparser.DDL:
+		case *sqlparser.Select, *sqlparser.Union, *sqlparser.DDL:
 			if err := txn.Abort(); err != nil {
 				log.Error("proxy.session.txn.abort.error:%+v", err)
 				return
@@ -75,6 +126,24 @@ func (ss *Sessions) txnAbort(txn backend.Transaction, node sqlparser.Statement)
 	}
 }
 
+// multiStmtTxnRollback used to rollback the multi-statement txn when the session exits without COMMIT.
+// The txn is aborted if the rollback fails.
+func (ss *Sessions) multiStmtTxnRollback(txn backend.Transaction) {
+	log := ss.log
+	if txn == nil {
+		return
+	}
+	log.Warning("proxy.session.multi.stmt.txn[%v].rollback.on.exit", txn.TxID())
+	if err := txn.Rollback(); err != nil {
+		log.Error("proxy.session.multi.stmt.txn.rollback.error:%+v", err)
+		if err := txn.Abort(); err != nil {
+			log.Error("proxy.session.multi.stmt.txn.abort.error:%+v", err)
+		}
+		return
+	}
+	txn.Finish()
+}
+
 // Remove used to remove the session from the map when session exit.
 func (ss *Sessions) Remove(s *driver.Session) {
 	ss.mu.Lock()
@@ -86,18 +155,26 @@ func (ss *Sessions) Remove(s *driver.Session) {
 	session.mu.Lock()
 	txn := session.transaction
 	node := session.node
+	multiStmtTxn := session.multiStmtTxn
+	session.multiStmtTxn = nil
+	session.txnEvents = nil
+	session.txnSavepoints = nil
 	session.mu.Unlock()
 	delete(ss.sessions, s.ID())
 	ss.mu.Unlock()
 
 	// txn abort.
 	ss.txnAbort(txn, node)
+
+	// The open transaction is rollbacked.
+	ss.multiStmtTxnRollback(multiStmtTxn)
 }
 
 // Kill used to kill a live session.
 // 1. remove from sessions list.
 // 2. close the session from the server side.
 // 3. abort the session's txn.
+// 4. abort the session's multi-statement txn.
 func (ss *Sessions) Kill(id uint32, reason string) {
 	log := ss.log
 	ss.mu.Lock()
@@ -111,6 +188,10 @@ func (ss *Sessions) Kill(id uint32, reason string) {
 	txn := session.transaction
 	node := session.node
 	sess := session.session
+	multiStmtTxn := session.multiStmtTxn
+	session.multiStmtTxn = nil
+	session.txnEvents = nil
+	session.txnSavepoints = nil
 	session.mu.Unlock()
 
 	delete(ss.sessions, id)
@@ -121,6 +202,13 @@ func (ss *Sessions) Kill(id uint32, reason string) {
 
 	// 2. abort the txn.
 	ss.txnAbort(txn, node)
+
+	// 3. abort the multi-statement txn, the statement running in it fails.
+	if multiStmtTxn != nil {
+		if err := multiStmtTxn.Abort(); err != nil {
+			log.Error("proxy.session.multi.stmt.txn.abort.error:%+v", err)
+		}
+	}
 }
 
 // Reaches used to check whether the sessions count reaches(>=) the quota.
@@ -130,13 +218,6 @@ func (ss *Sessions) Reaches(quota int) bool {
 	return (len(ss.sessions) >= quota)
 }
 
-// getTxnSession used to get current connection session.
-func (ss *Sessions) getTxnSession(session *driver.Session) *session {
-	ss.mu.RLock()
-	defer ss.mu.RUnlock()
-	return ss.sessions[session.ID()]
-}
-
 // TxnBinding used to bind txn to the session.
 func (ss *Sessions) TxnBinding(s *driver.Session, txn backend.Transaction, node sqlparser.Statement, query string) {
 	ss.mu.RLock()
@@ -177,6 +258,340 @@ func (ss *Sessions) TxnUnBinding(s *driver.Session) {
 	session.timestamp = time.Now().Unix()
 }
 
+// setBinlogEvents used to keep the binlog events of the statement executed by the session.
+func (ss *Sessions) setBinlogEvents(s *driver.Session, events []xcontext.BinlogEvent) {
+	ss.mu.RLock()
+	session, ok := ss.sessions[s.ID()]
+	ss.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	session.events = events
+}
+
+// takeBinlogEvents returns the binlog events kept by the session and clears them.
+func (ss *Sessions) takeBinlogEvents(s *driver.Session) []xcontext.BinlogEvent {
+	ss.mu.RLock()
+	session, ok := ss.sessions[s.ID()]
+	ss.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	events := session.events
+	session.events = nil
+	return events
+}
+
+// setResultStream used to keep the callback of the statement, which streams the large result
+// to the client. The nil stream clears it.
+func (ss *Sessions) setResultStream(s *driver.Session, stream func(*sqltypes.Result) error) {
+	ss.mu.RLock()
+	session, ok := ss.sessions[s.ID()]
+	ss.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	session.stream = stream
+	session.streamed = false
+}
+
+// getResultStream returns the callback to stream the result of the statement, nil if it's not set.
+func (ss *Sessions) getResultStream(s *driver.Session) func(*sqltypes.Result) error {
+	ss.mu.RLock()
+	session, ok := ss.sessions[s.ID()]
+	ss.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if session.stream == nil {
+		return nil
+	}
+	stream := session.stream
+	return func(qr *sqltypes.Result) error {
+		session.mu.Lock()
+		session.streamed = true
+		session.mu.Unlock()
+		return stream(qr)
+	}
+}
+
+// resultStreamed returns true if the result of the statement is sent to the client in part.
+func (ss *Sessions) resultStreamed(s *driver.Session) bool {
+	ss.mu.RLock()
+	session, ok := ss.sessions[s.ID()]
+	ss.mu.RUnlock()
+	if !ok {
+		return false
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	return session.streamed
+}
+
+// setLastInsertID used to keep the first AUTO_INCREMENT value of the last insert.
+func (ss *Sessions) setLastInsertID(s *driver.Session, id uint64) {
+	ss.mu.RLock()
+	session, ok := ss.sessions[s.ID()]
+	ss.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	session.lastInsertID = id
+}
+
+// getLastInsertID returns the value of LAST_INSERT_ID() of the session.
+func (ss *Sessions) getLastInsertID(s *driver.Session) uint64 {
+	ss.mu.RLock()
+	session, ok := ss.sessions[s.ID()]
+	ss.mu.RUnlock()
+	if !ok {
+		return 0
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	return session.lastInsertID
+}
+
+// bindMultiStmtTxn used to bind the multi-statement txn to the session.
+func (ss *Sessions) bindMultiStmtTxn(s *driver.Session, txn backend.Transaction) {
+	ss.mu.RLock()
+	session, ok := ss.sessions[s.ID()]
+	ss.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	session.multiStmtTxn = txn
+	session.txnEvents = nil
+	session.txnSavepoints = nil
+	session.txnAborted = false
+}
+
+// getMultiStmtTxn returns the multi-statement txn of the session, nil if there is none.
+func (ss *Sessions) getMultiStmtTxn(s *driver.Session) backend.Transaction {
+	ss.mu.RLock()
+	session, ok := ss.sessions[s.ID()]
+	ss.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	return session.multiStmtTxn
+}
+
+// unbindMultiStmtTxn used to unbind the multi-statement txn from the session,
+// returns the txn and its binlog events.
+func (ss *Sessions) unbindMultiStmtTxn(s *driver.Session) (backend.Transaction, []txnEvent) {
+	ss.mu.RLock()
+	session, ok := ss.sessions[s.ID()]
+	ss.mu.RUnlock()
+	if !ok {
+		return nil, nil
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	txn, events := session.multiStmtTxn, session.txnEvents
+	session.multiStmtTxn = nil
+	session.txnEvents = nil
+	session.txnSavepoints = nil
+	session.txnAborted = false
+	return txn, events
+}
+
+// abortMultiStmtTxn used to unbind the multi-statement txn from the session and mark
+// the session aborted, returns the txn.
+func (ss *Sessions) abortMultiStmtTxn(s *driver.Session) backend.Transaction {
+	ss.mu.RLock()
+	session, ok := ss.sessions[s.ID()]
+	ss.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	txn := session.multiStmtTxn
+	session.multiStmtTxn = nil
+	session.txnEvents = nil
+	session.txnSavepoints = nil
+	session.txnAborted = true
+	return txn
+}
+
+// getTxnAborted returns true if the multi-statement txn of the session is aborted.
+func (ss *Sessions) getTxnAborted(s *driver.Session) bool {
+	ss.mu.RLock()
+	session, ok := ss.sessions[s.ID()]
+	ss.mu.RUnlock()
+	if !ok {
+		return false
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	return session.txnAborted
+}
+
+// addTxnEvents used to keep the binlog events of the statement in the multi-statement txn,
+// returns false if the session has no such txn.
+func (ss *Sessions) addTxnEvents(s *driver.Session, events []xcontext.BinlogEvent) bool {
+	ss.mu.RLock()
+	session, ok := ss.sessions[s.ID()]
+	ss.mu.RUnlock()
+	if !ok {
+		return false
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if session.multiStmtTxn == nil {
+		return false
+	}
+	for _, event := range events {
+		session.txnEvents = append(session.txnEvents, txnEvent{schema: s.Schema(), typ: event.Typ, query: event.Query})
+	}
+	return true
+}
+
+// findTxnSavepoint returns the index of the savepoint in the session, -1 if not found.
+func findTxnSavepoint(session *session, name string) int {
+	for i, sp := range session.txnSavepoints {
+		if strings.EqualFold(sp.name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// setTxnSavepoint used to record the savepoint with the binlog events kept so far,
+// the savepoint with the same name is replaced.
+func (ss *Sessions) setTxnSavepoint(s *driver.Session, name string) {
+	ss.mu.RLock()
+	session, ok := ss.sessions[s.ID()]
+	ss.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if idx := findTxnSavepoint(session, name); idx >= 0 {
+		session.txnSavepoints = append(session.txnSavepoints[:idx], session.txnSavepoints[idx+1:]...)
+	}
+	session.txnSavepoints = append(session.txnSavepoints, txnSavepoint{name: name, events: len(session.txnEvents)})
+}
+
+// rollbackTxnSavepoint used to drop the binlog events and the savepoints after the savepoint.
+func (ss *Sessions) rollbackTxnSavepoint(s *driver.Session, name string) {
+	ss.mu.RLock()
+	session, ok := ss.sessions[s.ID()]
+	ss.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if idx := findTxnSavepoint(session, name); idx >= 0 {
+		session.txnEvents = session.txnEvents[:session.txnSavepoints[idx].events]
+		session.txnSavepoints = session.txnSavepoints[:idx+1]
+	}
+}
+
+// releaseTxnSavepoint used to remove the savepoint and the ones after it.
+func (ss *Sessions) releaseTxnSavepoint(s *driver.Session, name string) {
+	ss.mu.RLock()
+	session, ok := ss.sessions[s.ID()]
+	ss.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if idx := findTxnSavepoint(session, name); idx >= 0 {
+		session.txnSavepoints = session.txnSavepoints[:idx]
+	}
+}
+
+// setAutocommit used to set the autocommit of the session.
+func (ss *Sessions) setAutocommit(s *driver.Session, autocommit bool) {
+	ss.mu.RLock()
+	session, ok := ss.sessions[s.ID()]
+	ss.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	session.autocommit = autocommit
+}
+
+// getAutocommit returns the autocommit of the session.
+func (ss *Sessions) getAutocommit(s *driver.Session) bool {
+	ss.mu.RLock()
+	session, ok := ss.sessions[s.ID()]
+	ss.mu.RUnlock()
+	if !ok {
+		return true
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	return session.autocommit
+}
+
+// setConsistentSnapshot used to set the consistent snapshot reads of the session.
+func (ss *Sessions) setConsistentSnapshot(s *driver.Session, consistentSnapshot bool) {
+	ss.mu.RLock()
+	session, ok := ss.sessions[s.ID()]
+	ss.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	session.consistentSnapshot = consistentSnapshot
+}
+
+// getConsistentSnapshot returns true if the session reads in the consistent snapshot.
+func (ss *Sessions) getConsistentSnapshot(s *driver.Session) bool {
+	ss.mu.RLock()
+	session, ok := ss.sessions[s.ID()]
+	ss.mu.RUnlock()
+	if !ok {
+		return false
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	return session.consistentSnapshot
+}
+
 // Close used to close all sessions.
 func (ss *Sessions) Close() {
 	i := 0
@@ -187,10 +602,18 @@ func (ss *Sessions) Close() {
 			txn := v.transaction
 			sess := v.session
 			node := v.node
+			multiStmtTxn := v.multiStmtTxn
+			if txn == nil {
+				v.multiStmtTxn = nil
+				v.txnEvents = nil
+				v.txnSavepoints = nil
+			}
 			v.mu.Unlock()
 			if txn == nil {
 				delete(ss.sessions, k)
 				sess.Close()
+				// The idle transaction is rollbacked.
+				ss.multiStmtTxnRollback(multiStmtTxn)
 			} else {
 				// Try to abort READ-ONLY or DDL statement.
 				ss.txnAbort(txn, node)
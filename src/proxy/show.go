@@ -115,6 +115,12 @@ func (spanner *Spanner) handleShowCreateTable(session *driver.Session, query str
 	// Replace the partition table to raw table.
 	c1Val := strings.Replace(string(c1.Raw()), partTable, table, 1)
 	c2Val := strings.Replace(string(c2.Raw()), partTable, table, 1)
+	// Show the placement of the unsharded table.
+	if single, ok := router.SingleBackend(database, table); ok {
+		c2Val = fmt.Sprintf("%s\nSINGLE ON %s", c2Val, single)
+	} else if router.IsGlobal(database, table) {
+		c2Val = fmt.Sprintf("%s\nGLOBAL", c2Val)
+	}
 	qr.Rows[0][0] = sqltypes.MakeTrusted(c1.Type(), []byte(c1Val))
 	qr.Rows[0][1] = sqltypes.MakeTrusted(c2.Type(), []byte(c2Val))
 	return qr, nil
@@ -379,6 +385,9 @@ func (spanner *Spanner) handleShowQueryz(session *driver.Session, query string,
 		{Name: "Start", Type: querypb.Type_VARCHAR},
 		{Name: "Duration", Type: querypb.Type_INT32},
 		{Name: "Query", Type: querypb.Type_VARCHAR},
+		{Name: "SpillRuns", Type: querypb.Type_INT64},
+		{Name: "SpillRows", Type: querypb.Type_INT64},
+		{Name: "SpillBytes", Type: querypb.Type_INT64},
 	}
 	rows := spanner.scatter.Queryz().GetQueryzRows()
 	for _, row := range rows {
@@ -388,6 +397,9 @@ func (spanner *Spanner) handleShowQueryz(session *driver.Session, query string,
 			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(row.Start.Format("20060102150405.000"))),
 			sqltypes.MakeTrusted(querypb.Type_INT32, []byte(fmt.Sprintf("%v", row.Duration))),
 			sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte(row.Query)),
+			sqltypes.MakeTrusted(querypb.Type_INT64, []byte(fmt.Sprintf("%v", row.SpillRuns))),
+			sqltypes.MakeTrusted(querypb.Type_INT64, []byte(fmt.Sprintf("%v", row.SpillRows))),
+			sqltypes.MakeTrusted(querypb.Type_INT64, []byte(fmt.Sprintf("%v", row.SpillBytes))),
 		}
 		qr.Rows = append(qr.Rows, row)
 	}
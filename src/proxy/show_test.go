@@ -220,6 +220,62 @@ func TestProxyShowCreateTable(t *testing.T) {
 	}
 }
 
+func TestProxyShowCreateUnshardedTable(t *testing.T) {
+	r1 := &sqltypes.Result{
+		Fields: []*querypb.Field{
+			{
+				Name: "table",
+				Type: querypb.Type_VARCHAR,
+			},
+			{
+				Name: "create table",
+				Type: querypb.Type_VARCHAR,
+			},
+		},
+		Rows: [][]sqltypes.Value{
+			{
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("t1")),
+				sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("show create table t1")),
+			},
+		},
+	}
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("show create .*", r1)
+	}
+
+	tests := []struct {
+		create string
+		want   string
+	}{
+		{"create table t1(id int, b int) single on backend1", "[t1 show create table t1\nSINGLE ON backend1]"},
+		{"create table t1(id int, b int) global", "[t1 show create table t1\nGLOBAL]"},
+	}
+	for _, test := range tests {
+		client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+		assert.Nil(t, err)
+		defer client.Close()
+		_, err = client.FetchAll(test.create, -1)
+		assert.Nil(t, err)
+
+		qr, err := client.FetchAll("show create table test.t1", -1)
+		assert.Nil(t, err)
+		got := fmt.Sprintf("%+v", qr.Rows[0])
+		assert.Equal(t, test.want, got)
+
+		err = proxy.Router().DropTable("test", "t1")
+		assert.Nil(t, err)
+	}
+}
+
 func TestProxyShowColumns(t *testing.T) {
 	r1 := &sqltypes.Result{
 		Fields: []*querypb.Field{
@@ -0,0 +1,128 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"executor"
+	"optimizer"
+	"planner"
+
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+const (
+	// consistentSnapshotVariable is the session variable to run the reads in the consistent snapshot,
+	// such as: SET radon_consistent_snapshot=1.
+	consistentSnapshotVariable = "radon_consistent_snapshot"
+
+	// consistentSnapshotHint is the comment hint to run the SELECT in the consistent snapshot,
+	// such as: SELECT /*+ consistent_snapshot */ ...
+	consistentSnapshotHint = "consistent_snapshot"
+)
+
+// isConsistentSnapshotRead returns true if the read runs in the consistent snapshot,
+// the session sets radon_consistent_snapshot or the SELECT has the hint.
+// The locking reads are excluded, they write the XA.
+func (spanner *Spanner) isConsistentSnapshotRead(session *driver.Session, node sqlparser.Statement) bool {
+	switch node := node.(type) {
+	case *sqlparser.Select:
+		if node.Lock != "" {
+			return false
+		}
+		if planner.HasCommentHint(node.Comments, consistentSnapshotHint) {
+			return true
+		}
+	case *sqlparser.Union:
+		if node.Lock != "" {
+			return false
+		}
+	default:
+		return false
+	}
+	return spanner.sessions.getConsistentSnapshot(session)
+}
+
+// snapshotBackends returns the backends of the tables read by the statement, including the subqueries.
+func (spanner *Spanner) snapshotBackends(database string, node sqlparser.Statement) []string {
+	router := spanner.router
+	seen := make(map[string]bool)
+	var backends []string
+	_ = sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+		if tn, ok := node.(sqlparser.TableName); ok {
+			db := database
+			if !tn.Qualifier.IsEmpty() {
+				db = tn.Qualifier.String()
+			}
+			for _, backend := range router.TableBackends(db, tn.Name.String()) {
+				if !seen[backend] {
+					seen[backend] = true
+					backends = append(backends, backend)
+				}
+			}
+		}
+		return true, nil
+	}, node)
+	return backends
+}
+
+// ExecuteSnapshot used to execute the read in the consistent snapshot of the backends it reads,
+// the read sees either all or none of the writes of every distributed transaction.
+func (spanner *Spanner) ExecuteSnapshot(session *driver.Session, database string, query string, node sqlparser.Statement) (*sqltypes.Result, error) {
+	log := spanner.log
+	conf := spanner.conf
+	router := spanner.router
+	scatter := spanner.scatter
+	sessions := spanner.sessions
+
+	// transaction.
+	txn, err := scatter.CreateTransaction()
+	if err != nil {
+		log.Error("spanner.txn.create.error:[%v]", err)
+		return nil, err
+	}
+	defer txn.Finish()
+
+	// txn limits.
+	txn.SetTimeout(conf.Proxy.QueryTimeout)
+	txn.SetMaxResult(conf.Proxy.MaxResultSize)
+	txn.SetSpillConfig(conf.Spill)
+
+	// Snapshot begin.
+	if err := txn.Begin(); err != nil {
+		log.Error("spanner.execute.snapshot.txn.begin.error:[%v]", err)
+		return nil, err
+	}
+	if err := txn.BeginSnapshot(spanner.snapshotBackends(database, node)); err != nil {
+		log.Error("spanner.execute.snapshot.begin.error:[%v]", err)
+		return nil, err
+	}
+	// The snapshot is read-only, it's ended even if the read fails.
+	defer func() {
+		if x := txn.Commit(); x != nil {
+			log.Error("spanner.execute.snapshot.end.error:[%v]", x)
+		}
+	}()
+
+	// binding.
+	sessions.TxnBinding(session, txn, node, query)
+	defer sessions.TxnUnBinding(session)
+
+	if query, err = spanner.rewriteSubqueries(txn, database, query, node); err != nil {
+		return nil, err
+	}
+	plans, err := optimizer.NewSimpleOptimizer(log, database, query, node, router).BuildPlanTree()
+	if err != nil {
+		return nil, err
+	}
+	executors := executor.NewTree(log, plans, txn)
+	executors.SetStream(sessions.getResultStream(session))
+	return executors.Execute()
+}
@@ -0,0 +1,152 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestProxyConsistentSnapshot(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+	backends := len(proxy.Scatter().Backends())
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create table .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("xa .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("insert into test.t1_.*", &sqltypes.Result{RowsAffected: 1})
+		fakedbs.AddQuery("start transaction with consistent snapshot", &sqltypes.Result{})
+		fakedbs.AddQuery("commit", &sqltypes.Result{})
+		fakedbs.AddQuery("rollback", &sqltypes.Result{})
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	_, err = client.FetchAll("create table t1(id int, b int) partition by hash(id)", -1)
+	assert.Nil(t, err)
+
+	snapshots := func() int {
+		return fakedbs.GetQueryCalledNum("start transaction with consistent snapshot")
+	}
+
+	// Hint.
+	{
+		_, err = client.FetchAll("select /*+ consistent_snapshot */ count(*) from t1", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, backends, snapshots())
+		assert.Equal(t, backends, fakedbs.GetQueryCalledNum("commit"))
+
+		_, err = client.FetchAll("select count(*) from t1", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, backends, snapshots())
+
+		// The locking read isn't in the snapshot.
+		_, err = client.FetchAll("select /*+ consistent_snapshot */ * from t1 where id=1 for update", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, backends, snapshots())
+	}
+
+	// Session.
+	{
+		_, err = client.FetchAll("set radon_consistent_snapshot=1", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("select count(*) from t1", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 2*backends, snapshots())
+
+		_, err = client.FetchAll("set @@session.radon_consistent_snapshot=off", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("select count(*) from t1", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 2*backends, snapshots())
+	}
+
+	// The reads of the transaction reuse the snapshot.
+	{
+		_, err = client.FetchAll("start transaction with consistent snapshot", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 3*backends, snapshots())
+		_, err = client.FetchAll("select count(*) from t1", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("select * from t1 where id=1", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 3*backends, snapshots())
+
+		commits := fakedbs.GetQueryCalledNum("commit")
+		_, err = client.FetchAll("commit", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, "", multiStmtTxnXID(proxy))
+		assert.Equal(t, commits+backends, fakedbs.GetQueryCalledNum("commit"))
+	}
+
+	// The write is rejected, the snapshot transaction goes on.
+	{
+		_, err = client.FetchAll("start transaction with consistent snapshot", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("insert into t1(id, b) values(1, 1)", -1)
+		assert.NotNil(t, err)
+		assert.Equal(t, "unsupported: write.in.consistent.snapshot.transaction (errno 1105) (sqlstate HY000)", err.Error())
+		assert.Equal(t, 0, fakedbs.GetQueryCalledNum("rollback"))
+
+		// The read reuses the snapshot.
+		_, err = client.FetchAll("select count(*) from t1", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 4*backends, snapshots())
+
+		_, err = client.FetchAll("rollback", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, backends, fakedbs.GetQueryCalledNum("rollback"))
+	}
+
+	// The read starts the snapshot only on the backends it reads.
+	{
+		_, err = client.FetchAll("create table t2(id int, b int) single", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("select /*+ consistent_snapshot */ count(*) from t2", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 4*backends+1, snapshots())
+
+		// The subquery is read in the snapshot too.
+		fakedbs.AddQuery("select id from test.t2 as t2", &sqltypes.Result{Fields: []*querypb.Field{{Name: "id", Type: querypb.Type_INT32}}})
+		_, err = client.FetchAll("select /*+ consistent_snapshot */ * from t1 where id in (select id from t2)", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 5*backends+1, snapshots())
+	}
+}
+
+func TestParseConsistentSnapshot(t *testing.T) {
+	tests := []struct {
+		query string
+		value bool
+		ok    bool
+	}{
+		{query: "SET radon_consistent_snapshot=1", value: true, ok: true},
+		{query: "set session radon_consistent_snapshot = off", value: false, ok: true},
+		{query: "set autocommit=0, @@session.radon_consistent_snapshot=ON", value: true, ok: true},
+		{query: "set autocommit=0", ok: false},
+		{query: "set radon_consistent_snapshot='x'", ok: false},
+	}
+	for _, test := range tests {
+		value, ok := parseSetVariable(test.query, consistentSnapshotVariable)
+		assert.Equal(t, test.ok, ok, test.query)
+		assert.Equal(t, test.value, value, test.query)
+	}
+}
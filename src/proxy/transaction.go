@@ -0,0 +1,333 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"strings"
+
+	"backend"
+
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqldb"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+)
+
+// statementSavepoint is the savepoint set before every write of the multi-statement txn,
+// the failed write is rollbacked to it.
+const statementSavepoint = "radon_statement_savepoint"
+
+// handleTransaction used to handle the BEGIN/START TRANSACTION, COMMIT, ROLLBACK and the savepoints.
+// The multi-statement transaction runs in one XA on the backends written, the COMMIT
+// drives the XA PREPARE/COMMIT and the ROLLBACK drives the XA ROLLBACK.
+func (spanner *Spanner) handleTransaction(session *driver.Session, query string, node sqlparser.Statement) (*sqltypes.Result, error) {
+	txnNode := node.(*sqlparser.Transaction)
+	switch txnNode.Action {
+	case sqlparser.StartTxnStr, sqlparser.BeginTxnStr:
+		if _, err := spanner.beginTxn(session); err != nil {
+			return nil, err
+		}
+	case sqlparser.StartTxnSnapshotStr:
+		if err := spanner.beginSnapshotTxn(session); err != nil {
+			return nil, err
+		}
+	case sqlparser.CommitTxnStr:
+		if err := spanner.commitTxn(session); err != nil {
+			return nil, err
+		}
+	case sqlparser.RollbackTxnStr:
+		if err := spanner.rollbackTxn(session); err != nil {
+			return nil, err
+		}
+	case sqlparser.SavepointStr, sqlparser.RollbackToSavepointStr, sqlparser.ReleaseSavepointStr:
+		if err := spanner.handleSavepoint(session, txnNode.Action, txnNode.Name.String()); err != nil {
+			return nil, err
+		}
+	}
+	return &sqltypes.Result{}, nil
+}
+
+// beginTxn used to start a multi-statement txn and bind it to the session.
+// The txn opened already is committed first as MySQL does.
+func (spanner *Spanner) beginTxn(session *driver.Session) (backend.Transaction, error) {
+	log := spanner.log
+	conf := spanner.conf
+	scatter := spanner.scatter
+	sessions := spanner.sessions
+
+	if err := spanner.commitTxn(session); err != nil {
+		return nil, err
+	}
+
+	txn, err := scatter.CreateTransaction()
+	if err != nil {
+		log.Error("spanner.txn.create.error:[%v]", err)
+		return nil, err
+	}
+
+	// txn limits.
+	txn.SetTimeout(conf.Proxy.QueryTimeout)
+	txn.SetMaxResult(conf.Proxy.MaxResultSize)
+	txn.SetSpillConfig(conf.Spill)
+	txn.SetInsertSelectLimits(conf.Proxy.InsertSelectBatchRows, conf.Proxy.InsertSelectMaxRows)
+
+	if err := txn.Begin(); err != nil {
+		log.Error("spanner.multi.stmt.txn.begin.error:[%v]", err)
+		txn.Finish()
+		return nil, err
+	}
+	// Every backend written joins the XA, even if the statement writes only one backend.
+	txn.SetMultiWrite()
+	sessions.bindMultiStmtTxn(session, txn)
+	return txn, nil
+}
+
+// beginSnapshotTxn used to start a read-only multi-statement txn with the consistent snapshot
+// on the backends holding the tables, the reads of the txn reuse the snapshot until COMMIT or ROLLBACK.
+// The reads of the txn are unknown yet, so the backends without any table are the only ones left out.
+func (spanner *Spanner) beginSnapshotTxn(session *driver.Session) error {
+	log := spanner.log
+
+	txn, err := spanner.beginTxn(session)
+	if err != nil {
+		return err
+	}
+	if err := txn.BeginSnapshot(spanner.router.Backends()); err != nil {
+		log.Error("spanner.multi.stmt.txn.begin.snapshot.error:[%v]", err)
+		if x := spanner.rollbackTxn(session); x != nil {
+			log.Error("spanner.multi.stmt.txn.begin.snapshot.error.to.rollback.still.error:[%v]", x)
+		}
+		return err
+	}
+	return nil
+}
+
+// commitTxn used to commit the multi-statement txn of the session and log its binlog events,
+// nothing to do if the session has no txn.
+func (spanner *Spanner) commitTxn(session *driver.Session) error {
+	log := spanner.log
+	sessions := spanner.sessions
+
+	txn, events := sessions.unbindMultiStmtTxn(session)
+	if txn == nil {
+		return nil
+	}
+	defer txn.Finish()
+
+	if err := txn.Commit(); err != nil {
+		log.Error("spanner.multi.stmt.txn.commit.error:[%v]", err)
+		return err
+	}
+	if spanner.conf.Binlog.EnableBinlog {
+		for _, event := range events {
+			spanner.binlog.LogEvent(event.typ, event.schema, event.query)
+		}
+	}
+	return nil
+}
+
+// rollbackTxn used to rollback the multi-statement txn of the session and drop its binlog events,
+// nothing to do if the session has no txn.
+func (spanner *Spanner) rollbackTxn(session *driver.Session) error {
+	log := spanner.log
+	sessions := spanner.sessions
+
+	txn, _ := sessions.unbindMultiStmtTxn(session)
+	if txn == nil {
+		return nil
+	}
+	defer txn.Finish()
+
+	if err := txn.Rollback(); err != nil {
+		log.Error("spanner.multi.stmt.txn.rollback.error:[%v]", err)
+		return err
+	}
+	return nil
+}
+
+// abortTxn used to rollback the multi-statement txn of the session if the XA state of the backends
+// is unknown after the failed statement or savepoint, the session stays in the aborted txn and the statements are rejected until ROLLBACK.
+func (spanner *Spanner) abortTxn(session *driver.Session) error {
+	log := spanner.log
+	sessions := spanner.sessions
+
+	txn := sessions.abortMultiStmtTxn(session)
+	if txn == nil {
+		return nil
+	}
+	defer txn.Finish()
+
+	if err := txn.Rollback(); err != nil {
+		log.Error("spanner.multi.stmt.txn.abort.rollback.error:[%v]", err)
+		return err
+	}
+	return nil
+}
+
+// checkTxnAborted returns error if the txn of the session is aborted, only the ROLLBACK and
+// the SHOW statements are allowed.
+func (spanner *Spanner) checkTxnAborted(session *driver.Session, node sqlparser.Statement) error {
+	if !spanner.sessions.getTxnAborted(session) {
+		return nil
+	}
+	switch node := node.(type) {
+	case *sqlparser.Transaction:
+		if node.Action == sqlparser.RollbackTxnStr {
+			return nil
+		}
+	case *sqlparser.Show:
+		return nil
+	}
+	return sqldb.NewSQLError(sqldb.ER_UNKNOWN_ERROR, "%s", "Transaction was rolled back by the failed statement, ROLLBACK is required")
+}
+
+// handleSavepoint used to handle the SAVEPOINT, ROLLBACK TO SAVEPOINT and RELEASE SAVEPOINT.
+// The savepoint statements are replayed on the backends joined the XA, and the binlog events
+// after the savepoint are dropped by the ROLLBACK TO SAVEPOINT.
+// If the backends fail, the whole txn is aborted as the failed statement does.
+func (spanner *Spanner) handleSavepoint(session *driver.Session, action string, name string) error {
+	log := spanner.log
+	sessions := spanner.sessions
+
+	var txn backend.Transaction
+	if action == sqlparser.SavepointStr {
+		var err error
+		if txn, err = spanner.multiStmtTxn(session); err != nil {
+			return err
+		}
+		// SAVEPOINT is ignored out of the transaction as MySQL does.
+		if txn == nil {
+			return nil
+		}
+	} else {
+		if txn = sessions.getMultiStmtTxn(session); txn == nil {
+			return sqldb.NewSQLError(sqldb.ER_SP_DOES_NOT_EXIST, "", "SAVEPOINT", name)
+		}
+	}
+
+	var err error
+	switch action {
+	case sqlparser.SavepointStr:
+		if err = txn.Savepoint(name); err == nil {
+			sessions.setTxnSavepoint(session, name)
+		}
+	case sqlparser.RollbackToSavepointStr:
+		if err = txn.RollbackToSavepoint(name); err == nil {
+			sessions.rollbackTxnSavepoint(session, name)
+		}
+	case sqlparser.ReleaseSavepointStr:
+		if err = txn.ReleaseSavepoint(name); err == nil {
+			sessions.releaseTxnSavepoint(session, name)
+		}
+	}
+	if err != nil {
+		if sqlErr, ok := err.(*sqldb.SQLError); ok && sqlErr.Num == sqldb.ER_SP_DOES_NOT_EXIST {
+			return err
+		}
+		log.Error("spanner.multi.stmt.txn.savepoint[%s].error:[%v]", action, err)
+		if x := spanner.abortTxn(session); x != nil {
+			log.Error("spanner.multi.stmt.txn.savepoint[%s].error.to.rollback.still.error:[%v]", action, x)
+		}
+		return err
+	}
+	return nil
+}
+
+// multiStmtTxn returns the multi-statement txn of the session, a new one is started
+// if the session has autocommit off. Returns nil if the statement runs in its own txn.
+func (spanner *Spanner) multiStmtTxn(session *driver.Session) (backend.Transaction, error) {
+	sessions := spanner.sessions
+
+	if txn := sessions.getMultiStmtTxn(session); txn != nil {
+		return txn, nil
+	}
+	if !sessions.getAutocommit(session) {
+		return spanner.beginTxn(session)
+	}
+	return nil, nil
+}
+
+// inTxn returns true if the session has the open multi-statement txn or autocommit off.
+func (spanner *Spanner) inTxn(session *driver.Session) bool {
+	sessions := spanner.sessions
+	return sessions.getMultiStmtTxn(session) != nil || !sessions.getAutocommit(session)
+}
+
+// handleSet used to handle the SET command, only the autocommit and radon_consistent_snapshot are honoured.
+// Turning the autocommit on commits the open transaction as MySQL does.
+func (spanner *Spanner) handleSet(session *driver.Session, query string, node sqlparser.Statement) (*sqltypes.Result, error) {
+	autocommit, isAutocommit := parseAutocommit(query)
+	consistentSnapshot, isConsistentSnapshot := parseSetVariable(query, consistentSnapshotVariable)
+	if !isAutocommit && !isConsistentSnapshot {
+		// Support for JDBC/myloader.
+		return &sqltypes.Result{Warnings: 1}, nil
+	}
+	if isAutocommit {
+		if autocommit {
+			if err := spanner.commitTxn(session); err != nil {
+				return nil, err
+			}
+		}
+		spanner.sessions.setAutocommit(session, autocommit)
+	}
+	if isConsistentSnapshot {
+		spanner.sessions.setConsistentSnapshot(session, consistentSnapshot)
+	}
+	return &sqltypes.Result{}, nil
+}
+
+// parseAutocommit returns the autocommit value of the SET statement, such as:
+// SET autocommit=0, SET SESSION autocommit=ON or SET @@session.autocommit=1.
+// Returns false if the statement doesn't set the autocommit.
+func parseAutocommit(query string) (bool, bool) {
+	return parseSetVariable(query, "autocommit")
+}
+
+// parseSetVariable returns the boolean value of the session variable in the SET statement.
+// Returns false if the statement doesn't set the variable, or sets the global one such as
+// SET GLOBAL autocommit=0 or SET @@global.autocommit=0.
+func parseSetVariable(query string, variable string) (bool, bool) {
+	value, found := false, false
+	tokenizer := sqlparser.NewStringTokenizer(query)
+	prev := ""
+	for {
+		typ, val := tokenizer.Scan()
+		if typ == 0 || typ == sqlparser.LEX_ERROR {
+			break
+		}
+		if typ == sqlparser.COMMENT {
+			continue
+		}
+		name := strings.ToLower(string(val))
+		if typ == sqlparser.ID && (name == variable || name == "@@"+variable) && (prev == ".@@session" || prev == ".@@local" || prev == "set" || prev == "session" || prev == "local" || prev == ",") {
+			if typ, _ = tokenizer.Scan(); typ != '=' {
+				return false, false
+			}
+			typ, val = tokenizer.Scan()
+			switch strings.ToLower(string(val)) {
+			case "1", "on", "true":
+				value = true
+			case "0", "off", "false":
+				value = false
+			default:
+				return false, false
+			}
+			found = true
+		}
+		switch typ {
+		case '.':
+			prev = "." + prev
+		case ',':
+			prev = ","
+		default:
+			prev = name
+		}
+	}
+	return value, found
+}
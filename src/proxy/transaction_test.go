@@ -0,0 +1,479 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/driver"
+	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// multiStmtTxnXID returns the xid of the multi-statement txn bound to the sessions, empty if there is none.
+func multiStmtTxnXID(proxy *Proxy) string {
+	ss := proxy.Sessions()
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	for _, s := range ss.sessions {
+		s.mu.Lock()
+		txn := s.multiStmtTxn
+		s.mu.Unlock()
+		if txn != nil {
+			return txn.XID()
+		}
+	}
+	return ""
+}
+
+func binlogInserts(t *testing.T, client driver.Conn) []string {
+	time.Sleep(time.Millisecond * 100)
+	qr, err := client.FetchAll("show binlog events", -1)
+	assert.Nil(t, err)
+	var got []string
+	for _, row := range qr.Rows {
+		if row[3].String() == "INSERT" {
+			got = append(got, row[6].String())
+		}
+	}
+	return got
+}
+
+func mockTransactionProxy(t *testing.T) (*Proxy, func()) {
+	conf := MockDefaultConfig()
+	conf.Binlog.EnableBinlog = true
+	os.RemoveAll(conf.Binlog.LogDir)
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy1(log, conf)
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create table .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("xa .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("savepoint .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("rollback to savepoint .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("insert into test.t1_.*", &sqltypes.Result{RowsAffected: 1})
+	}
+
+	// create test table.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		query := "create table test.t1(id int, b int) partition by hash(id)"
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+		client.Close()
+	}
+	return proxy, cleanup
+}
+
+func TestProxyTransaction(t *testing.T) {
+	proxy, cleanup := mockTransactionProxy(t)
+	defer cleanup()
+	address := proxy.Address()
+
+	client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+
+	// BEGIN ... COMMIT.
+	{
+		_, err = client.FetchAll("begin", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("insert into t1(id, b) values(1, 1)", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("insert into t1(id, b) values(2, 2)", -1)
+		assert.Nil(t, err)
+
+		// The statements run in one XA, nothing is logged before the commit.
+		xid := multiStmtTxnXID(proxy)
+		assert.NotEqual(t, "", xid)
+		assert.Nil(t, binlogInserts(t, client))
+
+		_, err = client.FetchAll("commit", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, "", multiStmtTxnXID(proxy))
+		assert.Equal(t, []string{"insert into t1(id, b) values(1, 1)", "insert into t1(id, b) values(2, 2)"}, binlogInserts(t, client))
+	}
+
+	// START TRANSACTION ... ROLLBACK.
+	{
+		_, err = client.FetchAll("start transaction", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("insert into t1(id, b) values(3, 3)", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("rollback", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, "", multiStmtTxnXID(proxy))
+		assert.Equal(t, 2, len(binlogInserts(t, client)))
+	}
+
+	// COMMIT and ROLLBACK without transaction.
+	{
+		_, err = client.FetchAll("commit", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("rollback", -1)
+		assert.Nil(t, err)
+	}
+}
+
+func TestProxyTransactionXA(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create table .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("xa .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("savepoint .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("rollback to savepoint .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("insert into test.t1_.*", &sqltypes.Result{RowsAffected: 1})
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	_, err = client.FetchAll("create table t1(id int, b int) partition by hash(id)", -1)
+	assert.Nil(t, err)
+
+	// Commit drives the XA of the backends written.
+	{
+		_, err = client.FetchAll("begin", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("insert into t1(id, b) values(1, 1)", -1)
+		assert.Nil(t, err)
+		xid := strings.ToLower(multiStmtTxnXID(proxy))
+		_, err = client.FetchAll("insert into t1(id, b) values(2, 2)", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("commit", -1)
+		assert.Nil(t, err)
+
+		starts := fakedbs.GetQueryCalledNum(fmt.Sprintf("xa start '%s'", xid))
+		assert.True(t, starts > 0)
+		assert.Equal(t, starts, fakedbs.GetQueryCalledNum(fmt.Sprintf("xa end '%s'", xid)))
+		assert.Equal(t, starts, fakedbs.GetQueryCalledNum(fmt.Sprintf("xa prepare '%s'", xid)))
+		assert.Equal(t, starts, fakedbs.GetQueryCalledNum(fmt.Sprintf("xa commit '%s'", xid)))
+		assert.Equal(t, 0, fakedbs.GetQueryCalledNum(fmt.Sprintf("xa rollback '%s'", xid)))
+	}
+
+	// Rollback.
+	{
+		_, err = client.FetchAll("begin", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("insert into t1(id, b) values(1, 1)", -1)
+		assert.Nil(t, err)
+		xid := strings.ToLower(multiStmtTxnXID(proxy))
+		_, err = client.FetchAll("rollback", -1)
+		assert.Nil(t, err)
+
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum(fmt.Sprintf("xa start '%s'", xid)))
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum(fmt.Sprintf("xa rollback '%s'", xid)))
+		assert.Equal(t, 0, fakedbs.GetQueryCalledNum(fmt.Sprintf("xa commit '%s'", xid)))
+	}
+
+	// The failed statement is rollbacked to the statement savepoint, the transaction goes on.
+	{
+		fakedbs.AddQueryErrorPattern("insert into test.t1_.* values \\(100, 100\\)", errors.New("mock.insert.error"))
+		_, err = client.FetchAll("begin", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("insert into t1(id, b) values(1, 1)", -1)
+		assert.Nil(t, err)
+		xid := strings.ToLower(multiStmtTxnXID(proxy))
+		_, err = client.FetchAll("insert into t1(id, b) values(100, 100)", -1)
+		assert.NotNil(t, err)
+		assert.Equal(t, xid, strings.ToLower(multiStmtTxnXID(proxy)))
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum("rollback to savepoint `radon_statement_savepoint`"))
+		assert.Equal(t, 0, fakedbs.GetQueryCalledNum(fmt.Sprintf("xa rollback '%s'", xid)))
+
+		// The failed read changes nothing.
+		_, err = client.FetchAll("select * from t1 where id = 100", -1)
+		assert.NotNil(t, err)
+		assert.Equal(t, xid, strings.ToLower(multiStmtTxnXID(proxy)))
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum("rollback to savepoint `radon_statement_savepoint`"))
+
+		_, err = client.FetchAll("insert into t1(id, b) values(2, 2)", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("commit", -1)
+		assert.Nil(t, err)
+		assert.True(t, fakedbs.GetQueryCalledNum(fmt.Sprintf("xa commit '%s'", xid)) > 0)
+		assert.Equal(t, 0, fakedbs.GetQueryCalledNum(fmt.Sprintf("xa rollback '%s'", xid)))
+	}
+
+	// The failed rollback to the statement savepoint leaves the XA state unknown, the transaction
+	// is rollbacked and the statements are rejected until ROLLBACK.
+	{
+		fakedbs.AddQueryErrorPattern("rollback to savepoint .*", errors.New("mock.rollback.to.savepoint.error"))
+		_, err = client.FetchAll("begin", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("insert into t1(id, b) values(1, 1)", -1)
+		assert.Nil(t, err)
+		xid := strings.ToLower(multiStmtTxnXID(proxy))
+		_, err = client.FetchAll("insert into t1(id, b) values(100, 100)", -1)
+		assert.NotNil(t, err)
+		assert.Equal(t, "", multiStmtTxnXID(proxy))
+		assert.True(t, fakedbs.GetQueryCalledNum(fmt.Sprintf("xa rollback '%s'", xid)) > 0)
+		assert.Equal(t, 0, fakedbs.GetQueryCalledNum(fmt.Sprintf("xa commit '%s'", xid)))
+
+		want := "Transaction was rolled back by the failed statement, ROLLBACK is required (errno 1105) (sqlstate HY000)"
+		for _, query := range []string{"insert into t1(id, b) values(2, 2)", "commit", "begin", "set autocommit=1"} {
+			_, err = client.FetchAll(query, -1)
+			assert.NotNil(t, err, query)
+			assert.Equal(t, want, err.Error(), query)
+		}
+
+		_, err = client.FetchAll("rollback", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("insert into t1(id, b) values(2, 2)", -1)
+		assert.Nil(t, err)
+	}
+
+	// Prepare error fails the commit.
+	{
+		_, err = client.FetchAll("begin", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("insert into t1(id, b) values(1, 1)", -1)
+		assert.Nil(t, err)
+		fakedbs.AddQueryErrorPattern("xa prepare .*", errors.New("mock.xa.prepare.error"))
+		_, err = client.FetchAll("commit", -1)
+		assert.NotNil(t, err)
+		assert.Equal(t, "", multiStmtTxnXID(proxy))
+	}
+}
+
+func TestProxyTransactionSavepoint(t *testing.T) {
+	conf := MockDefaultConfig()
+	conf.Binlog.EnableBinlog = true
+	os.RemoveAll(conf.Binlog.LogDir)
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy1(log, conf)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create table .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("xa .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("savepoint .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("rollback to savepoint .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("release savepoint .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("insert into test.t1_.*", &sqltypes.Result{RowsAffected: 1})
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+	_, err = client.FetchAll("create table t1(id int, b int) partition by hash(id)", -1)
+	assert.Nil(t, err)
+
+	// Savepoint out of the transaction.
+	{
+		_, err = client.FetchAll("savepoint sp0", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, fakedbs.GetQueryCalledNum("savepoint `sp0`"))
+		_, err = client.FetchAll("rollback to savepoint sp0", -1)
+		assert.NotNil(t, err)
+		assert.Equal(t, "SAVEPOINT sp0 does not exist (errno 1305) (sqlstate 42000)", err.Error())
+		_, err = client.FetchAll("release savepoint sp0", -1)
+		assert.NotNil(t, err)
+	}
+
+	// The backends written after the savepoint are rollbacked and leave the XA.
+	{
+		_, err = client.FetchAll("begin", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("insert into t1(id, b) values(1, 1)", -1)
+		assert.Nil(t, err)
+		xid := strings.ToLower(multiStmtTxnXID(proxy))
+		_, err = client.FetchAll("savepoint sp1", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum("savepoint `sp1`"))
+
+		_, err = client.FetchAll("insert into t1(id, b) values(2, 2), (3, 3), (4, 4), (5, 5), (6, 6), (7, 7), (8, 8), (9, 9)", -1)
+		assert.Nil(t, err)
+		starts := fakedbs.GetQueryCalledNum(fmt.Sprintf("xa start '%s'", xid))
+		assert.True(t, starts > 1)
+
+		_, err = client.FetchAll("rollback work to sp1", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum("rollback to savepoint `sp1`"))
+		assert.Equal(t, starts-1, fakedbs.GetQueryCalledNum(fmt.Sprintf("xa rollback '%s'", xid)))
+
+		// The transaction goes on after the rollback to the savepoint.
+		_, err = client.FetchAll("release savepoint sp1", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum("release savepoint `sp1`"))
+		_, err = client.FetchAll("rollback to savepoint sp1", -1)
+		assert.NotNil(t, err)
+		assert.NotEqual(t, "", multiStmtTxnXID(proxy))
+
+		_, err = client.FetchAll("commit", -1)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum(fmt.Sprintf("xa commit '%s'", xid)))
+
+		// The events after the savepoint are dropped.
+		assert.Equal(t, []string{"insert into t1(id, b) values(1, 1)"}, binlogInserts(t, client))
+	}
+
+	// The failed savepoint rollbacks the transaction.
+	{
+		fakedbs.AddQueryErrorPattern("savepoint `sp2`", errors.New("mock.savepoint.error"))
+		_, err = client.FetchAll("begin", -1)
+		assert.Nil(t, err)
+		_, err = client.FetchAll("insert into t1(id, b) values(1, 1)", -1)
+		assert.Nil(t, err)
+		xid := strings.ToLower(multiStmtTxnXID(proxy))
+		_, err = client.FetchAll("savepoint sp2", -1)
+		assert.NotNil(t, err)
+		assert.Equal(t, "", multiStmtTxnXID(proxy))
+		assert.Equal(t, 1, fakedbs.GetQueryCalledNum(fmt.Sprintf("xa rollback '%s'", xid)))
+		_, err = client.FetchAll("commit", -1)
+		assert.NotNil(t, err)
+		_, err = client.FetchAll("rollback", -1)
+		assert.Nil(t, err)
+	}
+}
+
+func TestProxyTransactionAutocommit(t *testing.T) {
+	proxy, cleanup := mockTransactionProxy(t)
+	defer cleanup()
+	address := proxy.Address()
+
+	client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+	assert.Nil(t, err)
+	defer client.Close()
+
+	// The statement starts the transaction implicitly.
+	_, err = client.FetchAll("set autocommit=0", -1)
+	assert.Nil(t, err)
+	_, err = client.FetchAll("insert into t1(id, b) values(1, 1)", -1)
+	assert.Nil(t, err)
+	xid := multiStmtTxnXID(proxy)
+	assert.NotEqual(t, "", xid)
+	assert.Nil(t, binlogInserts(t, client))
+	_, err = client.FetchAll("commit", -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(binlogInserts(t, client)))
+
+	// The next transaction.
+	_, err = client.FetchAll("insert into t1(id, b) values(2, 2)", -1)
+	assert.Nil(t, err)
+	assert.NotEqual(t, "", multiStmtTxnXID(proxy))
+	assert.NotEqual(t, xid, multiStmtTxnXID(proxy))
+
+	// The DDL commits implicitly.
+	_, err = client.FetchAll("create table t2(id int, b int) partition by hash(id)", -1)
+	assert.Nil(t, err)
+	assert.Equal(t, "", multiStmtTxnXID(proxy))
+	assert.Equal(t, 2, len(binlogInserts(t, client)))
+
+	// Turning the autocommit on commits.
+	_, err = client.FetchAll("insert into t1(id, b) values(3, 3)", -1)
+	assert.Nil(t, err)
+	assert.NotEqual(t, "", multiStmtTxnXID(proxy))
+	_, err = client.FetchAll("set @@session.autocommit = ON", -1)
+	assert.Nil(t, err)
+	assert.Equal(t, "", multiStmtTxnXID(proxy))
+	assert.Equal(t, 3, len(binlogInserts(t, client)))
+
+	// Autocommit.
+	_, err = client.FetchAll("insert into t1(id, b) values(4, 4)", -1)
+	assert.Nil(t, err)
+	assert.Equal(t, "", multiStmtTxnXID(proxy))
+	assert.Equal(t, 4, len(binlogInserts(t, client)))
+
+	// BEGIN commits the open transaction.
+	_, err = client.FetchAll("begin", -1)
+	assert.Nil(t, err)
+	_, err = client.FetchAll("insert into t1(id, b) values(5, 5)", -1)
+	assert.Nil(t, err)
+	_, err = client.FetchAll("begin", -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(binlogInserts(t, client)))
+	_, err = client.FetchAll("rollback", -1)
+	assert.Nil(t, err)
+}
+
+func TestProxyTransactionDisconnect(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy(log)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		fakedbs.AddQueryPattern("use .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("create table .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("xa .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("savepoint .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("rollback to savepoint .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("insert into test.t1_.*", &sqltypes.Result{RowsAffected: 1})
+	}
+
+	client, err := driver.NewConn("mock", "mock", address, "test", "utf8")
+	assert.Nil(t, err)
+	_, err = client.FetchAll("create table t1(id int, b int) partition by hash(id)", -1)
+	assert.Nil(t, err)
+
+	_, err = client.FetchAll("begin", -1)
+	assert.Nil(t, err)
+	_, err = client.FetchAll("insert into t1(id, b) values(1, 1)", -1)
+	assert.Nil(t, err)
+	xid := strings.ToLower(multiStmtTxnXID(proxy))
+	client.Close()
+
+	// The open transaction is rollbacked.
+	rollback := fmt.Sprintf("xa rollback '%s'", xid)
+	for i := 0; i < 50 && fakedbs.GetQueryCalledNum(rollback) == 0; i++ {
+		time.Sleep(time.Millisecond * 100)
+	}
+	assert.Equal(t, 1, fakedbs.GetQueryCalledNum(rollback))
+	assert.Equal(t, 0, fakedbs.GetQueryCalledNum(fmt.Sprintf("xa commit '%s'", xid)))
+}
+
+func TestParseAutocommit(t *testing.T) {
+	tests := []struct {
+		query      string
+		autocommit bool
+		ok         bool
+	}{
+		{query: "SET autocommit=0", autocommit: false, ok: true},
+		{query: "set autocommit = 1", autocommit: true, ok: true},
+		{query: "set session autocommit=OFF", autocommit: false, ok: true},
+		{query: "SET /*x*/ @@autocommit=true", autocommit: true, ok: true},
+		{query: "set @@session.autocommit = ON, names utf8", autocommit: true, ok: true},
+		{query: "set names utf8, autocommit=0", autocommit: false, ok: true},
+		{query: "SET SESSION wait_timeout = 2147483", ok: false},
+		{query: "set @autocommit = 0", ok: false},
+		{query: "set autocommit = 2", ok: false},
+		{query: "set @@local.autocommit = 0", autocommit: false, ok: true},
+		{query: "set @@global.autocommit = 0", ok: false},
+		{query: "SET @@GLOBAL.autocommit = 1", ok: false},
+		{query: "set global autocommit = 0", ok: false},
+		{query: "set names utf8, @@global.autocommit = 0", ok: false},
+	}
+	for _, test := range tests {
+		autocommit, ok := parseAutocommit(test.query)
+		assert.Equal(t, test.ok, ok, test.query)
+		assert.Equal(t, test.autocommit, autocommit, test.query)
+	}
+}
@@ -9,12 +9,16 @@
 package proxy
 
 import (
+	"fmt"
+	"os"
 	"testing"
+	"time"
 
 	"fakedb"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/driver"
+	querypb "github.com/xelabs/go-mysqlstack/sqlparser/depends/query"
 	"github.com/xelabs/go-mysqlstack/sqlparser/depends/sqltypes"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
@@ -50,3 +54,86 @@ func TestProxyUpdate(t *testing.T) {
 		assert.Nil(t, err)
 	}
 }
+
+func TestProxyUpdateShardKey(t *testing.T) {
+	conf := MockDefaultConfig()
+	conf.Binlog.EnableBinlog = true
+	os.RemoveAll(conf.Binlog.LogDir)
+
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	fakedbs, proxy, cleanup := MockProxy1(log, conf)
+	defer cleanup()
+	address := proxy.Address()
+
+	// fakedbs.
+	{
+		row := &sqltypes.Result{
+			Fields: []*querypb.Field{
+				{Name: "id", Type: querypb.Type_INT32},
+				{Name: "name", Type: querypb.Type_VARCHAR},
+				{Name: "100", Type: querypb.Type_INT32},
+			},
+			Rows: [][]sqltypes.Value{
+				{
+					sqltypes.MakeTrusted(querypb.Type_INT32, []byte("1")),
+					sqltypes.MakeTrusted(querypb.Type_VARCHAR, []byte("nice name")),
+					sqltypes.MakeTrusted(querypb.Type_INT32, []byte("100")),
+				},
+			},
+		}
+		fakedbs.AddQueryPattern("create table .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("XA .*", &sqltypes.Result{})
+		fakedbs.AddQueryPattern("select \\*, 100 from test.t1_.* where id = 1 for update", row)
+		fakedbs.AddQueryPattern("delete from test.t1_.* where id = 1", &sqltypes.Result{RowsAffected: 1})
+		fakedbs.AddQueryPattern("insert into test.t1_.*", &sqltypes.Result{RowsAffected: 1})
+	}
+
+	// create test table.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		query := "create table test.t1(id int primary key, name varchar(20)) partition by hash(id)"
+		_, err = client.FetchAll(query, -1)
+		assert.Nil(t, err)
+	}
+
+	// The shard key update requires twopc.
+	{
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		query := "update test.t1 set id = 100 where id = 1"
+		_, err = client.FetchAll(query, -1)
+		want := "unsupported: shard.key.update.requires.twopc (errno 1105) (sqlstate HY000)"
+		assert.Equal(t, want, err.Error())
+	}
+
+	// The row is moved.
+	{
+		proxy.conf.Proxy.TwopcEnable = true
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		query := "update test.t1 set id = 100 where id = 1"
+		qr, err := client.FetchAll(query, -1)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(1), qr.RowsAffected)
+	}
+
+	// The binlog records the move.
+	{
+		time.Sleep(time.Millisecond * 100)
+		client, err := driver.NewConn("mock", "mock", address, "", "utf8")
+		assert.Nil(t, err)
+		qr, err := client.FetchAll("show binlog events", -1)
+		assert.Nil(t, err)
+		var got []string
+		for _, row := range qr.Rows {
+			got = append(got, fmt.Sprintf("%s:%s", row[3].String(), row[6].String()))
+		}
+		want := []string{
+			"DDL:create table test.t1(id int primary key, name varchar(20)) partition by hash(id)",
+			"DELETE:delete from test.t1 where id = 1",
+			"INSERT:insert into test.t1(id, name) values (100, 'nice name')",
+		}
+		assert.Equal(t, want, got)
+	}
+}
@@ -46,13 +46,14 @@ func (r *Router) Rules() *Rule {
 // 1. change the backend in memory.
 // 2. flush the table config to disk.
 // 3. reload the config to memory.
+// The partitions co-located in the table group are shifted together.
 // Note:
 // If the reload fails, panic it since the config is in chaos.
 func (r *Router) PartitionRuleShift(fromBackend string, toBackend string, database string, partitionTable string) error {
 	log := r.log
 
 	log.Warning("router.partition.rule.shift.from[%s].to[%s].database[%s].partitionTable[%s]", fromBackend, toBackend, database, partitionTable)
-	table, err := r.changeTheRuleBackend(fromBackend, toBackend, database, partitionTable)
+	tables, err := r.changeTheRuleBackend(fromBackend, toBackend, database, partitionTable)
 	if err != nil {
 		log.Error("router.partition.rule.shift.changeTheRuleBackend.error:%+v", err)
 		return err
@@ -60,9 +61,11 @@ func (r *Router) PartitionRuleShift(fromBackend string, toBackend string, databa
 	log.Warning("router.partition.rule.shift.change.the.rule.done")
 
 	log.Warning("router.partition.rule.shift.RefreshTable.prepare")
-	if err := r.RefreshTable(database, table); err != nil {
-		log.Panic("router.partition.rule.shift.RefreshTable.error:%+v", err)
-		return err
+	for _, table := range tables {
+		if err := r.RefreshTable(database, table); err != nil {
+			log.Panic("router.partition.rule.shift.RefreshTable.error:%+v", err)
+			return err
+		}
 	}
 	log.Warning("router.partition.rule.shift.RefreshTable.done")
 	return nil
@@ -70,10 +73,11 @@ func (r *Router) PartitionRuleShift(fromBackend string, toBackend string, databa
 
 //
 // 1. Find the table config and partition config.
-// 2. Change the backend.
-// 3. Write tableconfig to disk.
-func (r *Router) changeTheRuleBackend(fromBackend string, toBackend string, database string, partitionTable string) (string, error) {
-	var table string
+// 2. Find the co-located partitions if the table is in a group.
+// 3. Change the backends.
+// 4. Write tableconfigs to disk.
+func (r *Router) changeTheRuleBackend(fromBackend string, toBackend string, database string, partitionTable string) ([]string, error) {
+	var idx int
 	var tableConfig *config.TableConfig
 	var partitionConfig *config.PartitionConfig
 
@@ -82,12 +86,12 @@ func (r *Router) changeTheRuleBackend(fromBackend string, toBackend string, data
 	defer r.mu.RUnlock()
 
 	if fromBackend == toBackend {
-		return "", errors.Errorf("router.rule.change.from[%s].cant.equal.to[%s]", fromBackend, toBackend)
+		return nil, errors.Errorf("router.rule.change.from[%s].cant.equal.to[%s]", fromBackend, toBackend)
 	}
 
 	schema, ok := r.Schemas[database]
 	if !ok {
-		return "", errors.Errorf("router.rule.change.cant.found.database:%s", database)
+		return nil, errors.Errorf("router.rule.change.cant.found.database:%s", database)
 	}
 
 	// 1. Find the table config.
@@ -96,12 +100,12 @@ func (r *Router) changeTheRuleBackend(fromBackend string, toBackend string, data
 		if found {
 			break
 		}
-		for _, partition := range v.TableConfig.Partitions {
+		for i, partition := range v.TableConfig.Partitions {
 			if (partition.Backend == fromBackend) && (partition.Table == partitionTable) {
 				log.Warning("router.rule[%s:%s].change.from[%s].to[%s].found:%+v", database, partitionTable, fromBackend, toBackend, partition)
 
 				found = true
-				table = v.Name
+				idx = i
 				tableConfig = v.TableConfig
 				partitionConfig = partition
 				break
@@ -109,25 +113,52 @@ func (r *Router) changeTheRuleBackend(fromBackend string, toBackend string, data
 		}
 	}
 	if !found {
-		return "", errors.Errorf("router.rule.change.cant.found.backend[%s]+table:[%s]", fromBackend, partitionTable)
+		return nil, errors.Errorf("router.rule.change.cant.found.backend[%s]+table:[%s]", fromBackend, partitionTable)
 	}
 
-	// 2. Change the backend to to-backend.
-	partitionConfig.Backend = toBackend
+	// 2. Find the co-located partitions, all the group members must have the same layout.
+	tableConfigs := []*config.TableConfig{tableConfig}
+	partitionConfigs := []*config.PartitionConfig{partitionConfig}
+	for _, member := range r.groupMembers(database, tableConfig.Group) {
+		if member == tableConfig {
+			continue
+		}
+		if idx >= len(member.Partitions) || member.Partitions[idx].Segment != partitionConfig.Segment || member.Partitions[idx].Backend != fromBackend {
+			return nil, errors.Errorf("router.rule.change.table.group[%s].member[%s].layout.mismatch.with[%s]", tableConfig.Group, member.Name, tableConfig.Name)
+		}
+		tableConfigs = append(tableConfigs, member)
+		partitionConfigs = append(partitionConfigs, member.Partitions[idx])
+	}
 
-	// 3. Flush table config to disk.
-	if err := r.writeFrmData(database, table, tableConfig); err != nil {
-		// Memory config reset.
-		partitionConfig.Backend = fromBackend
-		return "", err
+	// 3. Change the backend to to-backend.
+	for _, partition := range partitionConfigs {
+		partition.Backend = toBackend
 	}
 
-	// 4. Update the version.
+	// 4. Flush table configs to disk.
+	tables := make([]string, 0, len(tableConfigs))
+	for i, conf := range tableConfigs {
+		if err := r.writeFrmData(database, conf.Name, conf); err != nil {
+			// Memory config reset, and rollback the flushed ones.
+			for _, partition := range partitionConfigs {
+				partition.Backend = fromBackend
+			}
+			for _, flushed := range tableConfigs[:i] {
+				if err := r.writeFrmData(database, flushed.Name, flushed); err != nil {
+					log.Panicf("change.the.rule.table[%s].rollback.error:%v", flushed.Name, err)
+				}
+			}
+			return nil, err
+		}
+		tables = append(tables, conf.Name)
+	}
+
+	// 5. Update the version.
 	if err := config.UpdateVersion(r.metadir); err != nil {
 		log.Panicf("change.the.rule.table.update.version.error:%v", err)
-		return "", err
+		return nil, err
 	}
-	return table, nil
+	return tables, nil
 }
 
 // ReLoad used to re-load the config files from disk to cache.
@@ -142,3 +173,93 @@ func (r *Router) ReLoad() error {
 	log.Warning("router.reload.load.meta.from.disk...")
 	return r.LoadConfig()
 }
+
+// AddListValues used to add values to a partition of the LIST table.
+// The processes as:
+// 1. add the values to the partition config in memory.
+// 2. flush the table config to disk.
+// 3. reload the table config to memory.
+// Note:
+// If the table has the DEFAULT partition, the rows of the values are served by it until the values are added,
+// they must be moved to the partition first (like the shift before the rule shift), otherwise they are
+// invisible by the new routing.
+func (r *Router) AddListValues(database string, table string, partitionTable string, values []string) error {
+	log := r.log
+
+	log.Warning("router.add.list.values[%+v].database[%s].table[%s].partitionTable[%s]", values, database, table, partitionTable)
+	if err := r.addTheListValues(database, table, partitionTable, values); err != nil {
+		log.Error("router.add.list.values.error:%+v", err)
+		return err
+	}
+	log.Warning("router.add.list.values.done")
+
+	if err := r.RefreshTable(database, table); err != nil {
+		log.Panic("router.add.list.values.RefreshTable.error:%+v", err)
+		return err
+	}
+	return nil
+}
+
+//
+// 1. Find the table config and partition config.
+// 2. Check the new values by building a new list.
+// 3. Write tableconfig to disk.
+func (r *Router) addTheListValues(database string, table string, partitionTable string, values []string) error {
+	var partitionConfig *config.PartitionConfig
+
+	log := r.log
+	if len(values) == 0 {
+		return errors.New("router.list.values.can.not.be.empty")
+	}
+
+	tbl, err := r.getTable(database, table)
+	if err != nil {
+		return err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tableConfig := tbl.TableConfig
+	if tableConfig.ShardType != methodTypeList {
+		return errors.Errorf("router.table[%s.%s].shardtype[%s].is.not.list", database, table, tableConfig.ShardType)
+	}
+
+	// 1. Find the partition config.
+	for _, partition := range tableConfig.Partitions {
+		if partition.Table == partitionTable {
+			partitionConfig = partition
+			break
+		}
+	}
+	if partitionConfig == nil {
+		return errors.Errorf("router.list.cant.found.partition[%s].of.table[%s.%s]", partitionTable, database, table)
+	}
+
+	// 2. Check the values.
+	for _, partition := range tableConfig.Partitions {
+		if partition.Default {
+			log.Warning("router.list.values%v.rows.in.the.default.partition[%s].must.be.moved.to[%s]", values, partition.Table, partitionTable)
+		}
+	}
+	old := partitionConfig.ListValues
+	partitionConfig.ListValues = append(append([]string{}, old...), values...)
+	if err := NewList(log, tableConfig).Build(); err != nil {
+		// Memory config reset.
+		partitionConfig.ListValues = old
+		return err
+	}
+
+	// 3. Flush table config to disk.
+	if err := r.writeFrmData(database, table, tableConfig); err != nil {
+		// Memory config reset.
+		partitionConfig.ListValues = old
+		return err
+	}
+
+	// 4. Update the version.
+	if err := config.UpdateVersion(r.metadir); err != nil {
+		log.Panicf("add.the.list.values.update.version.error:%v", err)
+		return err
+	}
+	return nil
+}
@@ -12,6 +12,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
 
@@ -66,6 +67,7 @@ func TestApiPartitionRuleShift(t *testing.T) {
 				"A": {
 					"Name": "A",
 					"ShardKey": "id",
+					"ShardType": "HASH",
 					"Partition": {
 						"Segments": [
 							{
@@ -170,6 +172,53 @@ func TestApiPartitionRuleShiftErrors(t *testing.T) {
 	}
 }
 
+func TestApiPartitionRuleShiftGroup(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	backends := []string{"backend1", "backend2"}
+	err := router.CreateGroupTable("sbtest", "orders", "id", "g1", backends)
+	assert.Nil(t, err)
+	err = router.CreateGroupTable("sbtest", "order_items", "order_id", "g1", backends)
+	assert.Nil(t, err)
+
+	// Shift the co-located partitions together.
+	{
+		err := router.PartitionRuleShift("backend1", "backend3", "sbtest", "order_items_0001")
+		assert.Nil(t, err)
+
+		for _, table := range []string{"orders", "order_items"} {
+			conf, err := router.TableConfig("sbtest", table)
+			assert.Nil(t, err)
+			assert.Equal(t, "backend3", conf.Partitions[1].Backend)
+			assert.Equal(t, "backend1", conf.Partitions[0].Backend)
+		}
+
+		// Reload from the frm files.
+		err = router.ReLoad()
+		assert.Nil(t, err)
+		conf, err := router.TableConfig("sbtest", "orders")
+		assert.Nil(t, err)
+		assert.Equal(t, "backend3", conf.Partitions[1].Backend)
+	}
+
+	// The layout of the member mismatch.
+	{
+		conf, err := router.TableConfig("sbtest", "orders")
+		assert.Nil(t, err)
+		conf.Partitions[2].Backend = "backend5"
+
+		err = router.PartitionRuleShift("backend1", "backend3", "sbtest", "order_items_0002")
+		want := "router.rule.change.table.group[g1].member[orders].layout.mismatch.with[order_items]"
+		assert.Equal(t, want, err.Error())
+
+		items, err := router.TableConfig("sbtest", "order_items")
+		assert.Nil(t, err)
+		assert.Equal(t, "backend1", items.Partitions[2].Backend)
+	}
+}
+
 func TestApiReLoad(t *testing.T) {
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
 	router, cleanup := MockNewRouter(log)
@@ -192,3 +241,116 @@ func TestApiReLoad(t *testing.T) {
 	got := rules.Schemas[0].DB
 	assert.Equal(t, want, got)
 }
+
+func TestApiAddListValues(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	// add router of sbtest.t1
+	{
+		definitions := []PartitionDefinition{
+			{Backend: "backend1", Values: []string{"1"}},
+			{Backend: "backend2", Values: []string{"4"}},
+		}
+		err := router.CreateListTable("sbtest", "t1", "id", "int", definitions)
+		assert.Nil(t, err)
+	}
+
+	// Add values 2,3 to t1_0000.
+	{
+		err := router.AddListValues("sbtest", "t1", "t1_0000", []string{"2", "3"})
+		assert.Nil(t, err)
+
+		key := sqlparser.NewIntVal([]byte("3"))
+		segments, err := router.Lookup("sbtest", "t1", key, key)
+		assert.Nil(t, err)
+		assert.Equal(t, "t1_0000", segments[0].Table)
+	}
+
+	// Reload from the disk.
+	{
+		err := router.ReLoad()
+		assert.Nil(t, err)
+		tConf, err := router.TableConfig("sbtest", "t1")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"1", "2", "3"}, tConf.Partitions[0].ListValues)
+	}
+}
+
+func TestApiAddListValuesErrors(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	// add router of sbtest.A and sbtest.t1
+	{
+		err := router.add("sbtest", MockTableAConfig())
+		assert.Nil(t, err)
+
+		definitions := []PartitionDefinition{
+			{Backend: "backend1", Values: []string{"1"}},
+			{Backend: "backend2", Values: []string{"2"}},
+		}
+		err = router.CreateListTable("sbtest", "t1", "id", "int", definitions)
+		assert.Nil(t, err)
+
+		definitions = []PartitionDefinition{
+			{Backend: "backend1", Values: []string{"1"}},
+			{Backend: "backend2", Default: true},
+		}
+		err = router.CreateListTable("sbtest", "t2", "id", "int", definitions)
+		assert.Nil(t, err)
+	}
+
+	// values is empty.
+	{
+		err := router.AddListValues("sbtest", "t1", "t1_0000", nil)
+		want := "router.list.values.can.not.be.empty"
+		assert.Equal(t, want, err.Error())
+	}
+
+	// not list table.
+	{
+		err := router.AddListValues("sbtest", "A", "A0", []string{"1"})
+		want := "router.table[sbtest.A].shardtype[HASH].is.not.list"
+		assert.Equal(t, want, err.Error())
+	}
+
+	// partition can't found.
+	{
+		err := router.AddListValues("sbtest", "t1", "t1_000x", []string{"3"})
+		want := "router.list.cant.found.partition[t1_000x].of.table[sbtest.t1]"
+		assert.Equal(t, want, err.Error())
+	}
+
+	// the values served by the DEFAULT partition are moved out of it.
+	{
+		key := sqlparser.NewIntVal([]byte("2"))
+		segments, err := router.Lookup("sbtest", "t2", key, key)
+		assert.Nil(t, err)
+		assert.Equal(t, "t2_0001", segments[0].Table)
+
+		err = router.AddListValues("sbtest", "t2", "t2_0000", []string{"2"})
+		assert.Nil(t, err)
+
+		tConf, err := router.TableConfig("sbtest", "t2")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"1", "2"}, tConf.Partitions[0].ListValues)
+
+		segments, err = router.Lookup("sbtest", "t2", key, key)
+		assert.Nil(t, err)
+		assert.Equal(t, "t2_0000", segments[0].Table)
+	}
+
+	// duplicate values, the config is not changed.
+	{
+		err := router.AddListValues("sbtest", "t1", "t1_0000", []string{"3", "2"})
+		want := "list.partition[t1_0001].value[2].duplicate.with.partition[t1_0000]"
+		assert.Equal(t, want, err.Error())
+
+		tConf, err := router.TableConfig("sbtest", "t1")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"1"}, tConf.Partitions[0].ListValues)
+	}
+}
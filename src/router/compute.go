@@ -11,12 +11,25 @@ package router
 import (
 	"fmt"
 	"sort"
+	"strings"
 
 	"config"
 
 	"github.com/pkg/errors"
 )
 
+// PartitionDefinition tuple.
+type PartitionDefinition struct {
+	// Backend which the partition placed on.
+	Backend string
+	// Bound is the upper bound(exclusive) of the range partition, empty means MAXVALUE.
+	Bound string
+	// Values are the values of the list partition.
+	Values []string
+	// Default is true if it's the default partition of list.
+	Default bool
+}
+
 // HashUniform used to uniform the hash slots to backends.
 func (r *Router) HashUniform(table, shardkey string, backends []string) (*config.TableConfig, error) {
 	if table == "" {
@@ -70,3 +83,96 @@ func (r *Router) HashUniform(table, shardkey string, backends []string) (*config
 	}
 	return tableConf, nil
 }
+
+// GlobalCompute used to compute the global table config, every backend has a full copy named as the table.
+func (r *Router) GlobalCompute(table string, backends []string) (*config.TableConfig, error) {
+	if table == "" {
+		return nil, errors.New("table.cant.be.null")
+	}
+	if len(backends) == 0 {
+		return nil, errors.New("router.compute.backends.is.null")
+	}
+
+	tableConf := &config.TableConfig{
+		Name:       table,
+		ShardType:  methodTypeGlobal,
+		Partitions: make([]*config.PartitionConfig, 0, len(backends)),
+	}
+	for _, backend := range backends {
+		partConf := &config.PartitionConfig{
+			Table:   table,
+			Backend: backend,
+		}
+		tableConf.Partitions = append(tableConf.Partitions, partConf)
+	}
+	return tableConf, nil
+}
+
+// SingleCompute used to compute the single table config, the table is placed on the backend without sharding.
+func (r *Router) SingleCompute(table string, backend string) (*config.TableConfig, error) {
+	if table == "" {
+		return nil, errors.New("table.cant.be.null")
+	}
+	if backend == "" {
+		return nil, errors.New("router.compute.backend.is.null")
+	}
+
+	tableConf := &config.TableConfig{
+		Name:      table,
+		ShardType: methodTypeSingle,
+		Partitions: []*config.PartitionConfig{
+			&config.PartitionConfig{
+				Table:   table,
+				Backend: backend,
+			},
+		},
+	}
+	return tableConf, nil
+}
+
+// RangeCompute used to compute the range partitions config from the definitions,
+// shardkeyType is the column type of the shardkey.
+func (r *Router) RangeCompute(table, shardkey, shardkeyType string, definitions []PartitionDefinition) (*config.TableConfig, error) {
+	return r.definitionsCompute(table, shardkey, shardkeyType, methodTypeRange, definitions)
+}
+
+// ListCompute used to compute the list partitions config from the definitions,
+// shardkeyType is the column type of the shardkey.
+func (r *Router) ListCompute(table, shardkey, shardkeyType string, definitions []PartitionDefinition) (*config.TableConfig, error) {
+	return r.definitionsCompute(table, shardkey, shardkeyType, methodTypeList, definitions)
+}
+
+// definitionsCompute used to compute the partitions config, one partition table per definition.
+func (r *Router) definitionsCompute(table, shardkey, shardkeyType, shardType string, definitions []PartitionDefinition) (*config.TableConfig, error) {
+	if table == "" {
+		return nil, errors.New("table.cant.be.null")
+	}
+	if shardkey == "" {
+		return nil, errors.New("shard.key.cant.be.null")
+	}
+	if len(definitions) == 0 {
+		return nil, errors.New("router.compute.partitions.is.null")
+	}
+
+	tableConf := &config.TableConfig{
+		Name:         table,
+		ShardType:    shardType,
+		ShardKey:     shardkey,
+		ShardKeyType: strings.ToLower(shardkeyType),
+		Partitions:   make([]*config.PartitionConfig, 0, 16),
+	}
+	for i, definition := range definitions {
+		if definition.Backend == "" {
+			return nil, errors.Errorf("router.compute.partition[%d].backend.is.null", i)
+		}
+		partConf := &config.PartitionConfig{
+			Table:      fmt.Sprintf("%s_%04d", table, i),
+			Backend:    definition.Backend,
+			Bound:      definition.Bound,
+			ListValues: definition.Values,
+			Default:    definition.Default,
+		}
+		tableConf.Partitions = append(tableConf.Partitions, partConf)
+	}
+	return tableConf, nil
+}
@@ -240,3 +240,122 @@ func TestRouterComputeHashError1(t *testing.T) {
 		assert.NotNil(t, err)
 	}
 }
+
+func TestRouterRangeCompute(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	definitions := []PartitionDefinition{
+		{Backend: "backend1", Bound: "100"},
+		{Backend: "backend2"},
+	}
+	got, err := router.RangeCompute("t1", "id", "int", definitions)
+	assert.Nil(t, err)
+	want := &config.TableConfig{
+		Name:         "t1",
+		ShardType:    "RANGE",
+		ShardKey:     "id",
+		ShardKeyType: "int",
+		Partitions: []*config.PartitionConfig{
+			{Table: "t1_0000", Backend: "backend1", Bound: "100"},
+			{Table: "t1_0001", Backend: "backend2"},
+		},
+	}
+	assert.Equal(t, want, got)
+}
+
+func TestRouterRangeComputeError(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	// Definitions is null.
+	{
+		_, err := router.RangeCompute("t1", "id", "int", nil)
+		assert.NotNil(t, err)
+	}
+
+	// Backend is null.
+	{
+		definitions := []PartitionDefinition{{Bound: "100"}}
+		_, err := router.RangeCompute("t1", "id", "int", definitions)
+		want := "router.compute.partition[0].backend.is.null"
+		assert.Equal(t, want, err.Error())
+	}
+}
+
+func TestRouterListCompute(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	definitions := []PartitionDefinition{
+		{Backend: "backend1", Values: []string{"bj", "sh"}},
+		{Backend: "backend2", Default: true},
+	}
+	got, err := router.ListCompute("t1", "region", "varchar", definitions)
+	assert.Nil(t, err)
+	want := &config.TableConfig{
+		Name:         "t1",
+		ShardType:    "LIST",
+		ShardKey:     "region",
+		ShardKeyType: "varchar",
+		Partitions: []*config.PartitionConfig{
+			{Table: "t1_0000", Backend: "backend1", ListValues: []string{"bj", "sh"}},
+			{Table: "t1_0001", Backend: "backend2", Default: true},
+		},
+	}
+	assert.Equal(t, want, got)
+}
+
+func TestRouterGlobalCompute(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	{
+		got, err := router.GlobalCompute("t1", []string{"backend1", "backend2"})
+		assert.Nil(t, err)
+		want := &config.TableConfig{
+			Name:      "t1",
+			ShardType: "GLOBAL",
+			Partitions: []*config.PartitionConfig{
+				{Table: "t1", Backend: "backend1"},
+				{Table: "t1", Backend: "backend2"},
+			},
+		}
+		assert.Equal(t, want, got)
+	}
+
+	// Backends is null.
+	{
+		_, err := router.GlobalCompute("t1", nil)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestRouterSingleCompute(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	{
+		got, err := router.SingleCompute("t1", "backend1")
+		assert.Nil(t, err)
+		want := &config.TableConfig{
+			Name:      "t1",
+			ShardType: "SINGLE",
+			Partitions: []*config.PartitionConfig{
+				{Table: "t1", Backend: "backend1"},
+			},
+		}
+		assert.Equal(t, want, got)
+	}
+
+	// Backend is null.
+	{
+		_, err := router.SingleCompute("t1", "")
+		assert.NotNil(t, err)
+	}
+}
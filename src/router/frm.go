@@ -13,6 +13,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"strings"
 
 	"config"
 )
@@ -94,12 +95,30 @@ func (r *Router) loadTable(db string, table string) error {
 // DropDatabase used to remove a database-schema from the schemas
 // and remove all the table-schema files who belongs to this database.
 func (r *Router) DropDatabase(db string) error {
+	r.seqMu.Lock()
+	for key := range r.segments {
+		if strings.HasPrefix(key, db+".") {
+			delete(r.segments, key)
+		}
+	}
+	r.seqMu.Unlock()
+
 	r.mu.Lock()
 	// remove
 	delete(r.Schemas, db)
+	_, hasSequences := r.sequences[db]
+	delete(r.sequences, db)
+	var err error
+	if hasSequences {
+		err = r.writeSequences()
+	}
 	r.mu.Unlock()
 
 	log := r.log
+	if err != nil {
+		log.Error("frm.drop.database[%v].sequences.error:%v", db, err)
+		return err
+	}
 	// Delete database dir.
 	dir := path.Join(r.metadir, db)
 	log.Info("frm.drop.database.file[%v]", dir)
@@ -128,6 +147,101 @@ func (r *Router) CreateTable(db, table, shardKey string, backends []string) erro
 		log.Error("frm.create.table[%s.%s].compute.error:%v", db, table, err)
 		return err
 	}
+	return r.createTable(db, table, tableConf)
+}
+
+// CreateGroupTable used to add a hash table to the table group and flush the schema to disk.
+// The table has the same partition layout as the group members, if the group doesn't exist
+// the table creates it with the uniform layout.
+// Lock.
+func (r *Router) CreateGroupTable(db, table, shardKey, group string, backends []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	log := r.log
+	// Compute the shards config.
+	var err error
+	var tableConf *config.TableConfig
+	if members := r.groupMembers(db, group); len(members) > 0 {
+		tableConf, err = r.GroupCompute(table, shardKey, group, members[0])
+	} else {
+		tableConf, err = r.HashUniform(table, shardKey, backends)
+	}
+	if err != nil {
+		log.Error("frm.create.group[%s].table[%s.%s].compute.error:%v", group, db, table, err)
+		return err
+	}
+	tableConf.Group = group
+	return r.createTable(db, table, tableConf)
+}
+
+// CreateGlobalTable used to add a global table to router and flush the schema to disk.
+// Lock.
+func (r *Router) CreateGlobalTable(db, table string, backends []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	log := r.log
+	// Compute the global config.
+	tableConf, err := r.GlobalCompute(table, backends)
+	if err != nil {
+		log.Error("frm.create.global.table[%s.%s].compute.error:%v", db, table, err)
+		return err
+	}
+	return r.createTable(db, table, tableConf)
+}
+
+// CreateSingleTable used to add a single table to router and flush the schema to disk.
+// Lock.
+func (r *Router) CreateSingleTable(db, table string, backend string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	log := r.log
+	// Compute the single config.
+	tableConf, err := r.SingleCompute(table, backend)
+	if err != nil {
+		log.Error("frm.create.single.table[%s.%s].compute.error:%v", db, table, err)
+		return err
+	}
+	return r.createTable(db, table, tableConf)
+}
+
+// CreateRangeTable used to add a range partitioned table to router and flush the schema to disk.
+// Lock.
+func (r *Router) CreateRangeTable(db, table, shardKey, shardKeyType string, definitions []PartitionDefinition) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	log := r.log
+	// Compute the partitions config.
+	tableConf, err := r.RangeCompute(table, shardKey, shardKeyType, definitions)
+	if err != nil {
+		log.Error("frm.create.range.table[%s.%s].compute.error:%v", db, table, err)
+		return err
+	}
+	return r.createTable(db, table, tableConf)
+}
+
+// CreateListTable used to add a list partitioned table to router and flush the schema to disk.
+// Lock.
+func (r *Router) CreateListTable(db, table, shardKey, shardKeyType string, definitions []PartitionDefinition) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	log := r.log
+	// Compute the partitions config.
+	tableConf, err := r.ListCompute(table, shardKey, shardKeyType, definitions)
+	if err != nil {
+		log.Error("frm.create.list.table[%s.%s].compute.error:%v", db, table, err)
+		return err
+	}
+	return r.createTable(db, table, tableConf)
+}
+
+// createTable used to add the table config to router and flush it to disk.
+func (r *Router) createTable(db, table string, tableConf *config.TableConfig) error {
+	log := r.log
 	// add config to router.
 	if err := r.add(db, tableConf); err != nil {
 		log.Error("frm.create.add.route.error:%v", err)
@@ -163,9 +277,13 @@ func (r *Router) AddForTest(db string, confs ...*config.TableConfig) error {
 
 // DropTable used to remove a table from router and remove the schema file from disk.
 func (r *Router) DropTable(db, table string) error {
+	r.seqMu.Lock()
+	defer r.seqMu.Unlock()
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	delete(r.segments, autoIncrementKey(db, table))
+
 	log := r.log
 	if err := r.remove(db, table); err != nil {
 		log.Error("frm.drop.table[%s.%s].remove.route.error:%v", db, table, err)
@@ -253,5 +371,10 @@ func (r *Router) LoadConfig() error {
 			}
 		}
 	}
+
+	if err := r.loadSequences(); err != nil {
+		log.Error("router.load.sequences.error:%+v", err)
+		return err
+	}
 	return nil
 }
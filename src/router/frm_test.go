@@ -268,3 +268,84 @@ func TestFrmAddTableForTest(t *testing.T) {
 	err := router.AddForTest("test", nil)
 	assert.NotNil(t, err)
 }
+
+func TestFrmRangeTable(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	definitions := []PartitionDefinition{
+		{Backend: "backend1", Bound: "100"},
+		{Backend: "backend2"},
+	}
+	err := router.CreateRangeTable("test", "r1", "id", "int", definitions)
+	assert.Nil(t, err)
+	assert.True(t, checkFileExistsForTest(router, "test", "r1"))
+
+	// Reload from the frm file.
+	{
+		err := router.ReLoad()
+		assert.Nil(t, err)
+		conf, err := router.TableConfig("test", "r1")
+		assert.Nil(t, err)
+		assert.Equal(t, "RANGE", conf.ShardType)
+		assert.Equal(t, "100", conf.Partitions[0].Bound)
+	}
+
+	// Bad bounds.
+	{
+		definitions := []PartitionDefinition{
+			{Backend: "backend1", Bound: "100"},
+			{Backend: "backend2", Bound: "10"},
+		}
+		err := router.CreateRangeTable("test", "r2", "id", "int", definitions)
+		assert.NotNil(t, err)
+		assert.False(t, checkFileExistsForTest(router, "test", "r2"))
+	}
+}
+
+func TestFrmSingleTable(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	err := router.CreateSingleTable("test", "s1", "backend1")
+	assert.Nil(t, err)
+	assert.True(t, checkFileExistsForTest(router, "test", "s1"))
+
+	// Reload from the frm file.
+	{
+		err := router.ReLoad()
+		assert.Nil(t, err)
+		backend, ok := router.SingleBackend("test", "s1")
+		assert.True(t, ok)
+		assert.Equal(t, "backend1", backend)
+	}
+
+	// Backend is null.
+	{
+		err := router.CreateSingleTable("test", "s2", "")
+		assert.NotNil(t, err)
+		assert.False(t, checkFileExistsForTest(router, "test", "s2"))
+	}
+}
+
+func TestFrmCompositeShardKeyTable(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	backends := []string{"backend1", "backend2"}
+	err := router.CreateTable("test", "c1", "tenant_id,order_id", backends)
+	assert.Nil(t, err)
+	assert.True(t, checkFileExistsForTest(router, "test", "c1"))
+
+	// Reload from the frm file.
+	{
+		err := router.ReLoad()
+		assert.Nil(t, err)
+		keys, err := router.ShardKeys("test", "c1")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"tenant_id", "order_id"}, keys)
+	}
+}
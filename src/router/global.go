@@ -0,0 +1,97 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package router
+
+import (
+	"config"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// GlobalRange tuple.
+// The global segment holds all the rows of the table.
+type GlobalRange struct {
+}
+
+// String returns the range info, all the rows.
+func (g *GlobalRange) String() string {
+	return ""
+}
+
+// Less impl, the global segments are equal.
+func (g *GlobalRange) Less(b KeyRange) bool {
+	return false
+}
+
+// Global tuple.
+// The global(broadcast) table has a full copy on every backend.
+type Global struct {
+	log *xlog.Log
+
+	// global method
+	typ MethodType
+
+	// table config
+	conf *config.TableConfig
+
+	// Segments, one per backend.
+	Segments []Segment `json:",omitempty"`
+}
+
+// NewGlobal creates new global.
+func NewGlobal(log *xlog.Log, conf *config.TableConfig) *Global {
+	return &Global{
+		log:      log,
+		conf:     conf,
+		typ:      methodTypeGlobal,
+		Segments: make([]Segment, 0, 16),
+	}
+}
+
+// Build used to build the global segments from schema config.
+func (g *Global) Build() error {
+	backends := make(map[string]struct{})
+	for _, part := range g.conf.Partitions {
+		if _, ok := backends[part.Backend]; ok {
+			return errors.Errorf("global.table[%v].backend[%v].duplicate", g.conf.Name, part.Backend)
+		}
+		backends[part.Backend] = struct{}{}
+
+		segment := Segment{
+			Table:   part.Table,
+			Backend: part.Backend,
+			Range:   &GlobalRange{},
+		}
+		g.Segments = append(g.Segments, segment)
+	}
+
+	if len(g.Segments) == 0 {
+		return errors.Errorf("global.backends.of.table[%v].can.not.be.empty", g.conf.Name)
+	}
+	return nil
+}
+
+// Clear used to clean global partitions.
+func (g *Global) Clear() error {
+	g.Segments = g.Segments[:0]
+	return nil
+}
+
+// Lookup returns all the segments, every segment has the full rows.
+// The reader should choose one of them.
+func (g *Global) Lookup(start *sqlparser.SQLVal, end *sqlparser.SQLVal) ([]Segment, error) {
+	return g.Segments, nil
+}
+
+// Type returns the global type.
+func (g *Global) Type() MethodType {
+	return g.typ
+}
@@ -0,0 +1,68 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package router
+
+import (
+	"testing"
+
+	"config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestGlobal(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	global := NewGlobal(log, MockTableGConfig())
+	{
+		err := global.Build()
+		assert.Nil(t, err)
+		assert.Equal(t, string(global.Type()), methodTypeGlobal)
+		assert.Equal(t, 2, len(global.Segments))
+		assert.Equal(t, "", global.Segments[0].Range.String())
+		assert.False(t, global.Segments[0].Range.Less(global.Segments[1].Range))
+	}
+
+	// Lookup always returns all the segments.
+	{
+		key := sqlparser.NewIntVal([]byte("1"))
+		segments, err := global.Lookup(key, key)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(segments))
+	}
+
+	{
+		err := global.Clear()
+		assert.Nil(t, err)
+		err = global.Build()
+		assert.Nil(t, err)
+	}
+}
+
+func TestGlobalBuildError(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+
+	// Empty backends.
+	{
+		conf := &config.TableConfig{Name: "G", ShardType: "GLOBAL"}
+		err := NewGlobal(log, conf).Build()
+		want := "global.backends.of.table[G].can.not.be.empty"
+		assert.Equal(t, want, err.Error())
+	}
+
+	// Duplicate backends.
+	{
+		conf := MockTableGConfig()
+		conf.Partitions[1].Backend = "backend1"
+		err := NewGlobal(log, conf).Build()
+		want := "global.table[G].backend[backend1].duplicate"
+		assert.Equal(t, want, err.Error())
+	}
+}
@@ -0,0 +1,163 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package router
+
+import (
+	"fmt"
+	"sort"
+
+	"config"
+
+	"github.com/pkg/errors"
+)
+
+// groupMembers returns the configs of the tables in the group ordered by the table name.
+// The table group is in the scope of the database.
+// Must be called with the lock held.
+func (r *Router) groupMembers(database string, group string) []*config.TableConfig {
+	var members []*config.TableConfig
+
+	schema, ok := r.Schemas[database]
+	if !ok || group == "" {
+		return nil
+	}
+	for _, table := range schema.Tables {
+		if table.TableConfig.Group == group {
+			members = append(members, table.TableConfig)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].Name < members[j].Name
+	})
+	return members
+}
+
+// GroupCompute used to compute the config of the table which joins the group,
+// the partitions have the same segments and backends as the member of the group.
+func (r *Router) GroupCompute(table, shardkey, group string, member *config.TableConfig) (*config.TableConfig, error) {
+	if table == "" {
+		return nil, errors.New("table.cant.be.null")
+	}
+	if shardkey == "" {
+		return nil, errors.New("shard.key.cant.be.null")
+	}
+	if member.ShardType != methodTypeHash {
+		return nil, errors.Errorf("router.table.group[%s].shardtype[%s].is.not.hash", group, member.ShardType)
+	}
+
+	// The same key value must be hashed to the same slot.
+	if len(ShardKeyColumns(shardkey)) != len(ShardKeyColumns(member.ShardKey)) {
+		return nil, errors.Errorf("router.table.group[%s].shardkey[%s].columns.mismatch.with[%s]", group, shardkey, member.ShardKey)
+	}
+
+	tableConf := &config.TableConfig{
+		Name:       table,
+		ShardType:  member.ShardType,
+		ShardKey:   shardkey,
+		Group:      group,
+		Partitions: make([]*config.PartitionConfig, 0, len(member.Partitions)),
+	}
+	for i, part := range member.Partitions {
+		partConf := &config.PartitionConfig{
+			Table:   fmt.Sprintf("%s_%04d", table, i),
+			Segment: part.Segment,
+			Backend: part.Backend,
+		}
+		tableConf.Partitions = append(tableConf.Partitions, partConf)
+	}
+	return tableConf, nil
+}
+
+// TableGroup returns the table group of the table, empty if the table isn't in any group.
+func (r *Router) TableGroup(database string, tableName string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	schema, ok := r.Schemas[database]
+	if !ok {
+		return ""
+	}
+	table, ok := schema.Tables[tableName]
+	if !ok {
+		return ""
+	}
+	return table.TableConfig.Group
+}
+
+// GroupPartitions returns the partition tables which co-located with the partition table in its table group,
+// include itself. The partition table not in any group returns itself only.
+func (r *Router) GroupPartitions(database string, partitionTable string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	schema, ok := r.Schemas[database]
+	if !ok {
+		return []string{partitionTable}
+	}
+	for _, table := range schema.Tables {
+		conf := table.TableConfig
+		for i, part := range conf.Partitions {
+			if part.Table != partitionTable {
+				continue
+			}
+			if conf.Group == "" {
+				return []string{partitionTable}
+			}
+
+			var partitions []string
+			for _, member := range r.groupMembers(database, conf.Group) {
+				if i < len(member.Partitions) {
+					partitions = append(partitions, member.Partitions[i].Table)
+				}
+			}
+			return partitions
+		}
+	}
+	return []string{partitionTable}
+}
+
+// Colocated returns true if the two hash tables are partitioned identically, the rows with
+// the same sharding key value are placed in the partitions at the same segment on the same backend.
+func (r *Router) Colocated(database string, a string, b string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	schema, ok := r.Schemas[database]
+	if !ok {
+		return false
+	}
+	ta, ok := schema.Tables[a]
+	if !ok {
+		return false
+	}
+	tb, ok := schema.Tables[b]
+	if !ok {
+		return false
+	}
+	ha, ok := ta.Partition.(*Hash)
+	if !ok {
+		return false
+	}
+	hb, ok := tb.Partition.(*Hash)
+	if !ok {
+		return false
+	}
+	if ha.slots != hb.slots || len(ShardKeyColumns(ta.ShardKey)) != len(ShardKeyColumns(tb.ShardKey)) {
+		return false
+	}
+	if len(ha.Segments) != len(hb.Segments) {
+		return false
+	}
+	for i, seg := range ha.Segments {
+		if seg.Backend != hb.Segments[i].Backend || seg.Range.String() != hb.Segments[i].Range.String() {
+			return false
+		}
+	}
+	return true
+}
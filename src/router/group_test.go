@@ -0,0 +1,102 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package router
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestRouterCreateGroupTable(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	// The first table creates the group.
+	err := router.CreateGroupTable("test", "orders", "id", "g1", []string{"backend1", "backend2"})
+	assert.Nil(t, err)
+	assert.Equal(t, "g1", router.TableGroup("test", "orders"))
+
+	// Join the group, the backends are ignored.
+	err = router.CreateGroupTable("test", "order_items", "order_id", "g1", []string{"backend3"})
+	assert.Nil(t, err)
+	assert.Equal(t, "g1", router.TableGroup("test", "order_items"))
+	assert.Equal(t, "", router.TableGroup("test", "xx"))
+
+	orders, err := router.TableConfig("test", "orders")
+	assert.Nil(t, err)
+	items, err := router.TableConfig("test", "order_items")
+	assert.Nil(t, err)
+	assert.Equal(t, len(orders.Partitions), len(items.Partitions))
+	for i := range orders.Partitions {
+		assert.Equal(t, orders.Partitions[i].Segment, items.Partitions[i].Segment)
+		assert.Equal(t, orders.Partitions[i].Backend, items.Partitions[i].Backend)
+	}
+
+	// Reload from the frm files.
+	{
+		err := router.ReLoad()
+		assert.Nil(t, err)
+		assert.Equal(t, "g1", router.TableGroup("test", "order_items"))
+	}
+
+	// The shard key columns mismatch.
+	{
+		err := router.CreateGroupTable("test", "t1", "a,b", "g1", []string{"backend1"})
+		want := "router.table.group[g1].shardkey[a,b].columns.mismatch.with[order_id]"
+		assert.Equal(t, want, err.Error())
+		assert.False(t, checkFileExistsForTest(router, "test", "t1"))
+	}
+}
+
+func TestRouterGroupPartitions(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	backends := []string{"backend1", "backend2"}
+	err := router.CreateGroupTable("test", "orders", "id", "g1", backends)
+	assert.Nil(t, err)
+	err = router.CreateGroupTable("test", "order_items", "order_id", "g1", backends)
+	assert.Nil(t, err)
+	err = router.CreateTable("test", "t1", "id", backends)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"order_items_0003", "orders_0003"}, router.GroupPartitions("test", "orders_0003"))
+	assert.Equal(t, []string{"t1_0003"}, router.GroupPartitions("test", "t1_0003"))
+	assert.Equal(t, []string{"xx"}, router.GroupPartitions("test", "xx"))
+	assert.Equal(t, []string{"orders_0003"}, router.GroupPartitions("xx", "orders_0003"))
+}
+
+func TestRouterColocated(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	backends := []string{"backend1", "backend2"}
+	err := router.CreateTable("test", "t1", "id", backends)
+	assert.Nil(t, err)
+	err = router.CreateTable("test", "t2", "uid", backends)
+	assert.Nil(t, err)
+	err = router.CreateTable("test", "t3", "id", []string{"backend1", "backend3"})
+	assert.Nil(t, err)
+	err = router.CreateTable("test", "t4", "id,uid", backends)
+	assert.Nil(t, err)
+	err = router.CreateGlobalTable("test", "g1", backends)
+	assert.Nil(t, err)
+
+	assert.True(t, router.Colocated("test", "t1", "t2"))
+	assert.False(t, router.Colocated("test", "t1", "t3"))
+	assert.False(t, router.Colocated("test", "t1", "t4"))
+	assert.False(t, router.Colocated("test", "t1", "g1"))
+	assert.False(t, router.Colocated("test", "t1", "xx"))
+	assert.False(t, router.Colocated("xx", "t1", "t2"))
+}
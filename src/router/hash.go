@@ -172,6 +172,43 @@ func (h *Hash) Lookup(start *sqlparser.SQLVal, end *sqlparser.SQLVal) ([]Segment
 	return h.Segments, nil
 }
 
+// LookupTuple used to lookup the partition through the values of the composite sharding key.
+// The values are normalized and combined to one key by the length-prefixed encoding, then hashed.
+// Hash.LookupTuple only supports the type int/float/string.
+func (h *Hash) LookupTuple(keys []*sqlparser.SQLVal) ([]Segment, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("hash.lookup.tuple.keys.can.not.be.empty")
+	}
+	if len(keys) == 1 {
+		return h.Lookup(keys[0], keys[0])
+	}
+
+	var buf bytes.Buffer
+	for _, key := range keys {
+		valStr := common.BytesToString(key.Val)
+		switch key.Type {
+		case sqlparser.IntVal:
+			i, err := strconv.ParseInt(valStr, 10, 64)
+			if err != nil {
+				return nil, errors.Errorf("hash.lookup.tuple.key.parser.int64.error:[%v]", err)
+			}
+			valStr = strconv.FormatInt(i, 10)
+		case sqlparser.FloatVal:
+			f, err := strconv.ParseFloat(valStr, 64)
+			if err != nil {
+				return nil, errors.Errorf("hash.lookup.tuple.key.parser.float.error:[%v]", err)
+			}
+			valStr = strconv.FormatFloat(f, 'g', -1, 64)
+		case sqlparser.StrVal:
+		default:
+			return nil, errors.Errorf("hash.unsupported.key.type:[%v]", key.Type)
+		}
+		fmt.Fprintf(&buf, "%d:%s", len(valStr), valStr)
+	}
+	idx := int(jump.HashString(buf.String(), int32(h.slots), jump.CRC64))
+	return []Segment{h.partitions[idx]}, nil
+}
+
 // Type returns the hash type.
 func (h *Hash) Type() MethodType {
 	return h.typ
@@ -223,6 +223,78 @@ func TestHashLookupError(t *testing.T) {
 	}
 }
 
+func TestHashLookupTuple(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	hash := NewHash(log, _mockHashSlots, MockTableCConfig())
+	{
+		err := hash.Build()
+		assert.Nil(t, err)
+	}
+
+	intVal := func(s string) *sqlparser.SQLVal {
+		return sqlparser.NewIntVal([]byte(s))
+	}
+	strVal := func(s string) *sqlparser.SQLVal {
+		return sqlparser.NewStrVal([]byte(s))
+	}
+
+	// Same tuple, same segment.
+	{
+		seg1, err := hash.LookupTuple([]*sqlparser.SQLVal{intVal("1"), intVal("100")})
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(seg1))
+		seg2, err := hash.LookupTuple([]*sqlparser.SQLVal{intVal("01"), intVal("100")})
+		assert.Nil(t, err)
+		assert.Equal(t, seg1, seg2)
+	}
+
+	// The int keys are decimal, 010 is 10 but not the octal 8.
+	{
+		for i := 0; i < 64; i++ {
+			seg1, err := hash.LookupTuple([]*sqlparser.SQLVal{intVal(fmt.Sprintf("0%d", i)), strVal("order")})
+			assert.Nil(t, err)
+			seg2, err := hash.LookupTuple([]*sqlparser.SQLVal{intVal(fmt.Sprintf("%d", i)), strVal("order")})
+			assert.Nil(t, err)
+			assert.Equal(t, seg1, seg2)
+		}
+
+		_, err := hash.LookupTuple([]*sqlparser.SQLVal{intVal("0x10"), intVal("1")})
+		assert.NotNil(t, err)
+	}
+
+	// The tuples are spread over the segments.
+	{
+		tables := make(map[string]bool)
+		for i := 0; i < 64; i++ {
+			segments, err := hash.LookupTuple([]*sqlparser.SQLVal{intVal(fmt.Sprintf("%d", i)), strVal("order")})
+			assert.Nil(t, err)
+			tables[segments[0].Table] = true
+		}
+		assert.Equal(t, 2, len(tables))
+	}
+
+	// One key equals to Lookup.
+	{
+		got, err := hash.LookupTuple([]*sqlparser.SQLVal{intVal("65536")})
+		assert.Nil(t, err)
+		want, err := hash.Lookup(intVal("65536"), intVal("65536"))
+		assert.Nil(t, err)
+		assert.Equal(t, want, got)
+	}
+
+	// Errors.
+	{
+		_, err := hash.LookupTuple(nil)
+		assert.Equal(t, "hash.lookup.tuple.keys.can.not.be.empty", err.Error())
+
+		_, err = hash.LookupTuple([]*sqlparser.SQLVal{intVal("1"), sqlparser.NewHexNum([]byte("0x1"))})
+		assert.Equal(t, "hash.unsupported.key.type:[3]", err.Error())
+
+		_, err = hash.LookupTuple([]*sqlparser.SQLVal{intVal("1x"), intVal("1")})
+		assert.NotNil(t, err)
+	}
+}
+
 func TestHashLookupBench(t *testing.T) {
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
 	hash := NewHash(log, _mockHashSlots, MockTableAConfig())
@@ -0,0 +1,203 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package router
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"config"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/common"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// ListValues tuple.
+// The values of a LIST segment, Default means the segment holds all the unlisted values.
+type ListValues struct {
+	Values  []string
+	Default bool
+
+	// numeric is true if the values are compared as numbers.
+	numeric bool
+}
+
+// String returns the values info.
+func (l *ListValues) String() string {
+	if l.Default {
+		return "DEFAULT"
+	}
+	return fmt.Sprintf("IN(%s)", strings.Join(l.Values, ","))
+}
+
+// Less impl, the DEFAULT segment is always the last one.
+func (l *ListValues) Less(b KeyRange) bool {
+	v := b.(*ListValues)
+	if l.Default || v.Default {
+		return !l.Default && v.Default
+	}
+	return compareValue(l.Values[0], v.Values[0], l.numeric) < 0
+}
+
+// key returns the value used as the key of the list map.
+// The values of the integer column are normalized, so that the values
+// such as 010 and 10 are located to the same segment.
+func (l *List) key(v string) string {
+	if l.integer {
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return strconv.FormatInt(i, 10)
+		}
+	}
+	return v
+}
+
+// List tuple.
+type List struct {
+	log *xlog.Log
+
+	// list method
+	typ MethodType
+
+	// table config
+	conf *config.TableConfig
+
+	// values maps the list value to the index of the segment.
+	values map[string]int
+
+	// deflt is the index of the DEFAULT segment, -1 if there is none.
+	deflt int
+
+	// integer is true if the partition column is integer.
+	integer bool
+
+	// numeric is true if the partition column is numeric.
+	numeric bool
+
+	// Segments in the partitions order.
+	Segments []Segment `json:",omitempty"`
+}
+
+// NewList creates new list.
+func NewList(log *xlog.Log, conf *config.TableConfig) *List {
+	return &List{
+		log:      log,
+		conf:     conf,
+		typ:      methodTypeList,
+		values:   make(map[string]int),
+		deflt:    -1,
+		Segments: make([]Segment, 0, 16),
+	}
+}
+
+// Build used to build the list segments from schema config.
+// Every value must be unique in the table and only one DEFAULT partition is allowed.
+// The tables created before the column type is recorded normalize the integer values,
+// and are numeric if all the values are numbers.
+func (l *List) Build() error {
+	l.integer = isIntegerType(l.conf.ShardKeyType)
+	l.numeric = isNumericType(l.conf.ShardKeyType)
+	if l.conf.ShardKeyType == "" {
+		l.integer = true
+		l.numeric = true
+		for _, part := range l.conf.Partitions {
+			for _, value := range part.ListValues {
+				if !isNumber(value) {
+					l.numeric = false
+				}
+			}
+		}
+	}
+
+	for _, part := range l.conf.Partitions {
+		idx := len(l.Segments)
+		switch {
+		case part.Default:
+			if len(part.ListValues) > 0 {
+				return errors.Errorf("list.default.partition[%v].can.not.have.values", part.Table)
+			}
+			if l.deflt != -1 {
+				return errors.Errorf("list.default.partition[%v].duplicate.with[%v]", part.Table, l.Segments[l.deflt].Table)
+			}
+			l.deflt = idx
+		case len(part.ListValues) == 0:
+			return errors.Errorf("list.partition[%v].values.can.not.be.empty", part.Table)
+		}
+
+		for _, value := range part.ListValues {
+			key := l.key(value)
+			if i, ok := l.values[key]; ok {
+				return errors.Errorf("list.partition[%v].value[%v].duplicate.with.partition[%v]", part.Table, value, l.conf.Partitions[i].Table)
+			}
+			l.values[key] = idx
+		}
+
+		segment := Segment{
+			Table:   part.Table,
+			Backend: part.Backend,
+			Range: &ListValues{
+				Values:  part.ListValues,
+				Default: part.Default,
+				numeric: l.numeric,
+			},
+		}
+		l.Segments = append(l.Segments, segment)
+	}
+
+	if len(l.Segments) == 0 {
+		return errors.Errorf("list.partitions.of.table[%v].can.not.be.empty", l.conf.Name)
+	}
+	return nil
+}
+
+// Clear used to clean list partitions.
+func (l *List) Clear() error {
+	l.Segments = l.Segments[:0]
+	l.values = make(map[string]int)
+	l.deflt = -1
+	return nil
+}
+
+// Lookup used to lookup the partition(s) through the list value.
+// Only the point lookup(start equals to end) can be located to one partition,
+// the values not listed go to the DEFAULT partition, others return all partitions.
+// List.Lookup only supports the type int/float/string.
+func (l *List) Lookup(start *sqlparser.SQLVal, end *sqlparser.SQLVal) ([]Segment, error) {
+	if start == nil || end == nil {
+		return l.Segments, nil
+	}
+
+	for _, key := range []*sqlparser.SQLVal{start, end} {
+		switch key.Type {
+		case sqlparser.IntVal, sqlparser.FloatVal, sqlparser.StrVal:
+		default:
+			return nil, errors.Errorf("list.unsupported.key.type:[%v]", key.Type)
+		}
+	}
+
+	key := l.key(common.BytesToString(start.Val))
+	if key != l.key(common.BytesToString(end.Val)) {
+		return l.Segments, nil
+	}
+
+	if idx, ok := l.values[key]; ok {
+		return []Segment{l.Segments[idx]}, nil
+	}
+	if l.deflt != -1 {
+		return []Segment{l.Segments[l.deflt]}, nil
+	}
+	return nil, errors.Errorf("list.lookup.key[%v].has.no.partition", key)
+}
+
+// Type returns the list type.
+func (l *List) Type() MethodType {
+	return l.typ
+}
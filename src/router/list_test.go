@@ -0,0 +1,203 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package router
+
+import (
+	"sort"
+	"testing"
+
+	"config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestList(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	list := NewList(log, MockTableLConfig())
+	{
+		err := list.Build()
+		assert.Nil(t, err)
+		assert.Equal(t, string(list.Type()), methodTypeList)
+		assert.Equal(t, 3, len(list.Segments))
+
+		want := []string{"IN(1,3,5)", "IN(2,4)", "DEFAULT"}
+		for i, segment := range list.Segments {
+			assert.Equal(t, want[i], segment.Range.String())
+		}
+
+		segments := Segments{list.Segments[2], list.Segments[1], list.Segments[0]}
+		sort.Sort(segments)
+		assert.Equal(t, "L_0000", segments[0].Table)
+		assert.Equal(t, "L_0002", segments[2].Table)
+	}
+
+	{
+		err := list.Clear()
+		assert.Nil(t, err)
+		err = list.Build()
+		assert.Nil(t, err)
+	}
+}
+
+func TestListBuildError(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+
+	// Empty partitions.
+	{
+		conf := &config.TableConfig{Name: "L", ShardType: "LIST", ShardKey: "id"}
+		err := NewList(log, conf).Build()
+		want := "list.partitions.of.table[L].can.not.be.empty"
+		assert.Equal(t, want, err.Error())
+	}
+
+	// Empty values.
+	{
+		conf := MockTableLConfig()
+		conf.Partitions[1].ListValues = nil
+		err := NewList(log, conf).Build()
+		want := "list.partition[L_0001].values.can.not.be.empty"
+		assert.Equal(t, want, err.Error())
+	}
+
+	// Duplicate values.
+	{
+		conf := MockTableLConfig()
+		conf.Partitions[1].ListValues = []string{"2", "03"}
+		err := NewList(log, conf).Build()
+		want := "list.partition[L_0001].value[03].duplicate.with.partition[L_0000]"
+		assert.Equal(t, want, err.Error())
+	}
+
+	// Duplicate default.
+	{
+		conf := MockTableLConfig()
+		conf.Partitions = append(conf.Partitions, &config.PartitionConfig{Table: "L_0003", Default: true, Backend: "backend1"})
+		err := NewList(log, conf).Build()
+		want := "list.default.partition[L_0003].duplicate.with[L_0002]"
+		assert.Equal(t, want, err.Error())
+	}
+
+	// Default with values.
+	{
+		conf := MockTableLConfig()
+		conf.Partitions[2].ListValues = []string{"6"}
+		err := NewList(log, conf).Build()
+		want := "list.default.partition[L_0002].can.not.have.values"
+		assert.Equal(t, want, err.Error())
+	}
+}
+
+func TestListLookup(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	list := NewList(log, MockTableLConfig())
+	err := list.Build()
+	assert.Nil(t, err)
+
+	intVal := func(s string) *sqlparser.SQLVal {
+		return sqlparser.NewIntVal([]byte(s))
+	}
+
+	tests := []struct {
+		start *sqlparser.SQLVal
+		end   *sqlparser.SQLVal
+		want  []string
+	}{
+		{nil, nil, []string{"L_0000", "L_0001", "L_0002"}},
+		{intVal("1"), nil, []string{"L_0000", "L_0001", "L_0002"}},
+		{intVal("1"), intVal("4"), []string{"L_0000", "L_0001", "L_0002"}},
+		{intVal("3"), intVal("3"), []string{"L_0000"}},
+		{intVal("4"), intVal("4"), []string{"L_0001"}},
+		{sqlparser.NewStrVal([]byte("4")), sqlparser.NewStrVal([]byte("4")), []string{"L_0001"}},
+		{intVal("100"), intVal("100"), []string{"L_0002"}},
+	}
+	for _, test := range tests {
+		segments, err := list.Lookup(test.start, test.end)
+		assert.Nil(t, err)
+		got := make([]string, 0, len(segments))
+		for _, segment := range segments {
+			got = append(got, segment.Table)
+		}
+		assert.Equal(t, test.want, got)
+	}
+}
+
+func TestListLookupError(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	conf := MockTableLConfig()
+	conf.Partitions = conf.Partitions[:2]
+	list := NewList(log, conf)
+	err := list.Build()
+	assert.Nil(t, err)
+
+	// No default.
+	{
+		key := sqlparser.NewIntVal([]byte("100"))
+		_, err := list.Lookup(key, key)
+		want := "list.lookup.key[100].has.no.partition"
+		assert.Equal(t, want, err.Error())
+	}
+
+	// Unsupported type.
+	{
+		key := sqlparser.NewHexVal([]byte("3f"))
+		_, err := list.Lookup(key, key)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestListLookupColumnType(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+
+	lookup := func(list *List, key *sqlparser.SQLVal) []string {
+		segments, err := list.Lookup(key, key)
+		assert.Nil(t, err)
+		got := make([]string, 0, len(segments))
+		for _, segment := range segments {
+			got = append(got, segment.Table)
+		}
+		return got
+	}
+
+	// The string column, '010' and '10' are different values.
+	{
+		conf := MockTableLConfig()
+		conf.ShardKeyType = "varchar"
+		conf.Partitions[0].ListValues = []string{"9", "010"}
+		conf.Partitions[1].ListValues = []string{"10"}
+		list := NewList(log, conf)
+		err := list.Build()
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"L_0000"}, lookup(list, sqlparser.NewStrVal([]byte("010"))))
+		assert.Equal(t, []string{"L_0001"}, lookup(list, sqlparser.NewStrVal([]byte("10"))))
+		assert.Equal(t, []string{"L_0002"}, lookup(list, sqlparser.NewStrVal([]byte("0010"))))
+
+		// '10' < '9' lexically.
+		assert.True(t, list.Segments[1].Range.Less(list.Segments[0].Range))
+	}
+
+	// The integer column, '010' and '10' are the same value.
+	{
+		conf := MockTableLConfig()
+		conf.ShardKeyType = "int"
+		conf.Partitions[0].ListValues = []string{"9"}
+		conf.Partitions[1].ListValues = []string{"10"}
+		list := NewList(log, conf)
+		err := list.Build()
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"L_0001"}, lookup(list, sqlparser.NewStrVal([]byte("010"))))
+		assert.Equal(t, []string{"L_0001"}, lookup(list, sqlparser.NewIntVal([]byte("10"))))
+		assert.False(t, list.Segments[1].Range.Less(list.Segments[0].Range))
+
+		conf.Partitions[0].ListValues = []string{"010"}
+		err = NewList(log, conf).Build()
+		assert.Equal(t, "list.partition[L_0001].value[10].duplicate.with.partition[L_0000]", err.Error())
+	}
+}
@@ -128,6 +128,29 @@ func MockTableBConfig() *config.TableConfig {
 	return mock
 }
 
+// MockTableCConfig config, composite sharding key.
+func MockTableCConfig() *config.TableConfig {
+	mock := &config.TableConfig{
+		Name:       "C",
+		ShardType:  "HASH",
+		ShardKey:   "tenant_id,order_id",
+		Partitions: make([]*config.PartitionConfig, 0, 16),
+	}
+	S02048 := &config.PartitionConfig{
+		Table:   "C0",
+		Segment: "0-2048",
+		Backend: "backend0",
+	}
+	S20484096 := &config.PartitionConfig{
+		Table:   "C1",
+		Segment: "2048-4096",
+		Backend: "backend1",
+	}
+
+	mock.Partitions = append(mock.Partitions, S02048, S20484096)
+	return mock
+}
+
 // MockTableNULLConfig config.
 func MockTableNULLConfig() *config.TableConfig {
 	mock := &config.TableConfig{
@@ -291,6 +314,93 @@ func MockTableE1Config() *config.TableConfig {
 	return mock
 }
 
+// MockTableRConfig config, range partition by id.
+func MockTableRConfig() *config.TableConfig {
+	mock := &config.TableConfig{
+		Name:      "R",
+		ShardType: "RANGE",
+		ShardKey:  "id",
+		Partitions: []*config.PartitionConfig{
+			&config.PartitionConfig{
+				Table:   "R_0000",
+				Bound:   "100",
+				Backend: "backend1",
+			},
+			&config.PartitionConfig{
+				Table:   "R_0001",
+				Bound:   "200",
+				Backend: "backend2",
+			},
+			&config.PartitionConfig{
+				Table:   "R_0002",
+				Backend: "backend3",
+			},
+		},
+	}
+	return mock
+}
+
+// MockTableLConfig config, list partition by id.
+func MockTableLConfig() *config.TableConfig {
+	mock := &config.TableConfig{
+		Name:      "L",
+		ShardType: "LIST",
+		ShardKey:  "id",
+		Partitions: []*config.PartitionConfig{
+			&config.PartitionConfig{
+				Table:      "L_0000",
+				ListValues: []string{"1", "3", "5"},
+				Backend:    "backend1",
+			},
+			&config.PartitionConfig{
+				Table:      "L_0001",
+				ListValues: []string{"2", "4"},
+				Backend:    "backend2",
+			},
+			&config.PartitionConfig{
+				Table:   "L_0002",
+				Default: true,
+				Backend: "backend3",
+			},
+		},
+	}
+	return mock
+}
+
+// MockTableGConfig config, global table.
+func MockTableGConfig() *config.TableConfig {
+	mock := &config.TableConfig{
+		Name:      "G",
+		ShardType: "GLOBAL",
+		Partitions: []*config.PartitionConfig{
+			&config.PartitionConfig{
+				Table:   "G",
+				Backend: "backend1",
+			},
+			&config.PartitionConfig{
+				Table:   "G",
+				Backend: "backend2",
+			},
+		},
+	}
+	return mock
+}
+
+// MockTableSConfig config, single table.
+func MockTableSConfig() *config.TableConfig {
+	mock := &config.TableConfig{
+		Name:      "S",
+		ShardType: "SINGLE",
+		Partitions: []*config.PartitionConfig{
+			&config.PartitionConfig{
+				Table:   "S",
+				Backend: "backend1",
+			},
+		},
+	}
+	return mock
+}
+
 // mockTmpDir is only used for MockNewRouter()
 var (
 	log        = xlog.NewStdLog(xlog.Level(xlog.PANIC))
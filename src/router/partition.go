@@ -46,4 +46,5 @@ type Segment struct {
 type Partition interface {
 	Build() error
 	Lookup(start *sqlparser.SQLVal, end *sqlparser.SQLVal) ([]Segment, error)
+	Type() MethodType
 }
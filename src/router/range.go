@@ -0,0 +1,216 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package router
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+
+	"config"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/common"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// RangeBound tuple.
+// [Lower, Upper), empty Lower means MINVALUE and empty Upper means MAXVALUE.
+type RangeBound struct {
+	Lower string
+	Upper string
+
+	// numeric is true if the bounds are compared as numbers.
+	numeric bool
+}
+
+// String returns lower-upper info.
+func (r *RangeBound) String() string {
+	lower := r.Lower
+	if lower == "" {
+		lower = "MINVALUE"
+	}
+	upper := r.Upper
+	if upper == "" {
+		upper = "MAXVALUE"
+	}
+	return fmt.Sprintf("[%v,%v)", lower, upper)
+}
+
+// Less impl.
+func (r *RangeBound) Less(b KeyRange) bool {
+	v := b.(*RangeBound)
+	if r.Lower == "" {
+		return v.Lower != ""
+	}
+	if v.Lower == "" {
+		return false
+	}
+	return compareValue(r.Lower, v.Lower, r.numeric) < 0
+}
+
+// numberPrefix matches the leading number of a value, as MySQL casts a string to a number.
+var numberPrefix = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?`)
+
+// isNumber returns true if the whole value is a number.
+func isNumber(v string) bool {
+	v = strings.TrimSpace(v)
+	return v != "" && numberPrefix.FindString(v) == v
+}
+
+// toNumber casts the value to a number, the value without the leading number is 0.
+func toNumber(v string) *big.Float {
+	f := new(big.Float).SetPrec(128)
+	if _, ok := f.SetString(numberPrefix.FindString(strings.TrimSpace(v))); !ok {
+		f.SetInt64(0)
+	}
+	return f
+}
+
+// compareValue compares two partition values by the type of the partition column.
+// If numeric both values are cast to numbers, otherwise(such as date and string) they are compared lexicographically.
+func compareValue(a, b string, numeric bool) int {
+	if numeric {
+		return toNumber(a).Cmp(toNumber(b))
+	}
+	return strings.Compare(a, b)
+}
+
+// Range tuple.
+type Range struct {
+	log *xlog.Log
+
+	// range method
+	typ MethodType
+
+	// table config
+	conf *config.TableConfig
+
+	// numeric is true if the partition column is numeric.
+	numeric bool
+
+	// Segments ordered by the bounds.
+	Segments []Segment `json:",omitempty"`
+}
+
+// NewRange creates new range.
+func NewRange(log *xlog.Log, conf *config.TableConfig) *Range {
+	return &Range{
+		log:      log,
+		conf:     conf,
+		typ:      methodTypeRange,
+		Segments: make([]Segment, 0, 16),
+	}
+}
+
+// Build used to build the range segments from schema config.
+// The partitions must be ordered by the strictly increasing upper bounds,
+// and only the last one can be MAXVALUE.
+// The bounds and the lookup keys of the numeric column are cast to numbers, so that the key '10'
+// and 10 are located to the same segment, others are compared as strings.
+// The tables created before the column type is recorded are numeric if all the bounds are numbers.
+func (r *Range) Build() error {
+	r.numeric = isNumericType(r.conf.ShardKeyType)
+	if r.conf.ShardKeyType == "" {
+		r.numeric = true
+		for _, part := range r.conf.Partitions {
+			if part.Bound != "" && !isNumber(part.Bound) {
+				r.numeric = false
+			}
+		}
+	}
+
+	lower := ""
+	for i, part := range r.conf.Partitions {
+		if i > 0 && lower == "" {
+			return errors.Errorf("range.partition[%v].maxvalue.must.be.the.last.one", r.conf.Partitions[i-1].Table)
+		}
+		if part.Bound != "" && lower != "" && compareValue(part.Bound, lower, r.numeric) <= 0 {
+			return errors.Errorf("range.partition[%v].bound[%v].must.be.greater.than[%v]", part.Table, part.Bound, lower)
+		}
+
+		segment := Segment{
+			Table:   part.Table,
+			Backend: part.Backend,
+			Range: &RangeBound{
+				Lower:   lower,
+				Upper:   part.Bound,
+				numeric: r.numeric,
+			},
+		}
+		r.Segments = append(r.Segments, segment)
+		lower = part.Bound
+	}
+
+	if len(r.Segments) == 0 {
+		return errors.Errorf("range.partitions.of.table[%v].can.not.be.empty", r.conf.Name)
+	}
+	return nil
+}
+
+// Clear used to clean range partitions.
+func (r *Range) Clear() error {
+	r.Segments = r.Segments[:0]
+	return nil
+}
+
+// Lookup used to lookup the partition(s) which overlap the closed interval [start, end].
+// The nil start or end means the interval is unbounded on that side.
+// Range.Lookup only supports the type int/float/string.
+func (r *Range) Lookup(start *sqlparser.SQLVal, end *sqlparser.SQLVal) ([]Segment, error) {
+	var startVal, endVal string
+
+	// if open interval we returns all partitions
+	if start == nil && end == nil {
+		return r.Segments, nil
+	}
+
+	for _, key := range []*sqlparser.SQLVal{start, end} {
+		if key == nil {
+			continue
+		}
+		switch key.Type {
+		case sqlparser.IntVal, sqlparser.FloatVal, sqlparser.StrVal:
+		default:
+			return nil, errors.Errorf("range.unsupported.key.type:[%v]", key.Type)
+		}
+	}
+	if start != nil {
+		startVal = common.BytesToString(start.Val)
+	}
+	if end != nil {
+		endVal = common.BytesToString(end.Val)
+	}
+
+	segments := make([]Segment, 0, 4)
+	for _, segment := range r.Segments {
+		bound := segment.Range.(*RangeBound)
+		// The segment is on the left of the interval.
+		if start != nil && bound.Upper != "" && compareValue(startVal, bound.Upper, r.numeric) >= 0 {
+			continue
+		}
+		// The segment is on the right of the interval.
+		if end != nil && bound.Lower != "" && compareValue(endVal, bound.Lower, r.numeric) < 0 {
+			continue
+		}
+		segments = append(segments, segment)
+	}
+
+	if len(segments) == 0 {
+		return nil, errors.Errorf("range.lookup.key[%v,%v].has.no.partition", startVal, endVal)
+	}
+	return segments, nil
+}
+
+// Type returns the range type.
+func (r *Range) Type() MethodType {
+	return r.typ
+}
@@ -0,0 +1,257 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package router
+
+import (
+	"testing"
+
+	"config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestRange(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	rng := NewRange(log, MockTableRConfig())
+	{
+		err := rng.Build()
+		assert.Nil(t, err)
+		assert.Equal(t, string(rng.Type()), methodTypeRange)
+		assert.Equal(t, 3, len(rng.Segments))
+
+		want := []string{"[MINVALUE,100)", "[100,200)", "[200,MAXVALUE)"}
+		for i, segment := range rng.Segments {
+			assert.Equal(t, want[i], segment.Range.String())
+		}
+		assert.True(t, rng.Segments[0].Range.Less(rng.Segments[1].Range))
+		assert.False(t, rng.Segments[2].Range.Less(rng.Segments[1].Range))
+	}
+
+	{
+		err := rng.Clear()
+		assert.Nil(t, err)
+		err = rng.Build()
+		assert.Nil(t, err)
+	}
+}
+
+func TestRangeBuildError(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+
+	// Empty partitions.
+	{
+		conf := &config.TableConfig{Name: "R", ShardType: "RANGE", ShardKey: "id"}
+		err := NewRange(log, conf).Build()
+		want := "range.partitions.of.table[R].can.not.be.empty"
+		assert.Equal(t, want, err.Error())
+	}
+
+	// Not increasing.
+	{
+		conf := MockTableRConfig()
+		conf.Partitions[1].Bound = "100"
+		err := NewRange(log, conf).Build()
+		want := "range.partition[R_0001].bound[100].must.be.greater.than[100]"
+		assert.Equal(t, want, err.Error())
+	}
+
+	// MAXVALUE is not the last one.
+	{
+		conf := MockTableRConfig()
+		conf.Partitions[0].Bound = ""
+		err := NewRange(log, conf).Build()
+		want := "range.partition[R_0000].maxvalue.must.be.the.last.one"
+		assert.Equal(t, want, err.Error())
+	}
+}
+
+func TestRangeLookup(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	rng := NewRange(log, MockTableRConfig())
+	err := rng.Build()
+	assert.Nil(t, err)
+
+	intVal := func(s string) *sqlparser.SQLVal {
+		return sqlparser.NewIntVal([]byte(s))
+	}
+
+	tests := []struct {
+		start *sqlparser.SQLVal
+		end   *sqlparser.SQLVal
+		want  []string
+	}{
+		{nil, nil, []string{"R_0000", "R_0001", "R_0002"}},
+		{intVal("-10"), intVal("-10"), []string{"R_0000"}},
+		{intVal("99"), intVal("99"), []string{"R_0000"}},
+		{intVal("100"), intVal("100"), []string{"R_0001"}},
+		{intVal("99"), intVal("100"), []string{"R_0000", "R_0001"}},
+		{intVal("200"), nil, []string{"R_0002"}},
+		{nil, intVal("150"), []string{"R_0000", "R_0001"}},
+		{intVal("150"), intVal("100000"), []string{"R_0001", "R_0002"}},
+	}
+	for _, test := range tests {
+		segments, err := rng.Lookup(test.start, test.end)
+		assert.Nil(t, err)
+		got := make([]string, 0, len(segments))
+		for _, segment := range segments {
+			got = append(got, segment.Table)
+		}
+		assert.Equal(t, test.want, got)
+	}
+}
+
+func TestRangeLookupError(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	conf := MockTableRConfig()
+	conf.Partitions = conf.Partitions[:2]
+	rng := NewRange(log, conf)
+	err := rng.Build()
+	assert.Nil(t, err)
+
+	// Out of range.
+	{
+		_, err := rng.Lookup(sqlparser.NewIntVal([]byte("200")), nil)
+		want := "range.lookup.key[200,].has.no.partition"
+		assert.Equal(t, want, err.Error())
+	}
+
+	// Unsupported type.
+	{
+		_, err := rng.Lookup(sqlparser.NewHexVal([]byte("3f")), nil)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestRangeLookupCast(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	rng := NewRange(log, MockTableRConfig())
+	err := rng.Build()
+	assert.Nil(t, err)
+
+	lookup := func(key *sqlparser.SQLVal) []string {
+		segments, err := rng.Lookup(key, key)
+		assert.Nil(t, err)
+		got := make([]string, 0, len(segments))
+		for _, segment := range segments {
+			got = append(got, segment.Table)
+		}
+		return got
+	}
+
+	// The numeric bounds, the keys are cast to numbers.
+	tests := []struct {
+		key  *sqlparser.SQLVal
+		want []string
+	}{
+		{sqlparser.NewIntVal([]byte("99")), []string{"R_0000"}},
+		{sqlparser.NewStrVal([]byte("99")), []string{"R_0000"}},
+		{sqlparser.NewStrVal([]byte("099")), []string{"R_0000"}},
+		{sqlparser.NewStrVal([]byte(" 150 ")), []string{"R_0001"}},
+		{sqlparser.NewFloatVal([]byte("150.0")), []string{"R_0001"}},
+		{sqlparser.NewStrVal([]byte("1e3")), []string{"R_0002"}},
+		{sqlparser.NewStrVal([]byte("abc")), []string{"R_0000"}},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, lookup(test.key))
+	}
+
+	// The date bounds, the keys are compared as strings.
+	{
+		conf := MockTableRConfig()
+		conf.Partitions[0].Bound = "2018-01-01"
+		conf.Partitions[1].Bound = "2019-01-01"
+		rng = NewRange(log, conf)
+		err := rng.Build()
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"R_0001"}, lookup(sqlparser.NewStrVal([]byte("2018-06-01"))))
+		assert.Equal(t, []string{"R_0000"}, lookup(sqlparser.NewIntVal([]byte("10"))))
+		assert.Equal(t, []string{"R_0000"}, lookup(sqlparser.NewStrVal([]byte("10"))))
+	}
+}
+
+func TestRangeLookupColumnType(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+
+	lookup := func(rng *Range, key *sqlparser.SQLVal) []string {
+		segments, err := rng.Lookup(key, key)
+		assert.Nil(t, err)
+		got := make([]string, 0, len(segments))
+		for _, segment := range segments {
+			got = append(got, segment.Table)
+		}
+		return got
+	}
+
+	// The string column with the numeric-looking bounds, '1000' < '150' lexically.
+	{
+		conf := MockTableRConfig()
+		conf.ShardKeyType = "varchar"
+		conf.Partitions[0].Bound = "150"
+		conf.Partitions[1].Bound = "300"
+		rng := NewRange(log, conf)
+		err := rng.Build()
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"R_0000"}, lookup(rng, sqlparser.NewStrVal([]byte("1000"))))
+		assert.Equal(t, []string{"R_0000"}, lookup(rng, sqlparser.NewIntVal([]byte("1000"))))
+		assert.Equal(t, []string{"R_0002"}, lookup(rng, sqlparser.NewStrVal([]byte("99"))))
+
+		// name < '150' keeps the partition holding '1000'.
+		segments, err := rng.Lookup(nil, sqlparser.NewStrVal([]byte("150")))
+		assert.Nil(t, err)
+		assert.Equal(t, "R_0000", segments[0].Table)
+
+		// The bounds are increasing lexically.
+		conf = MockTableRConfig()
+		conf.ShardKeyType = "varchar"
+		conf.Partitions[0].Bound = "150"
+		conf.Partitions[1].Bound = "1000"
+		err = NewRange(log, conf).Build()
+		assert.Equal(t, "range.partition[R_0001].bound[1000].must.be.greater.than[150]", err.Error())
+	}
+
+	// The numeric column.
+	{
+		conf := MockTableRConfig()
+		conf.ShardKeyType = "bigint"
+		conf.Partitions[0].Bound = "150"
+		conf.Partitions[1].Bound = "1000"
+		rng := NewRange(log, conf)
+		err := rng.Build()
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"R_0001"}, lookup(rng, sqlparser.NewStrVal([]byte("999"))))
+		assert.Equal(t, []string{"R_0001"}, lookup(rng, sqlparser.NewIntVal([]byte("999"))))
+		assert.Equal(t, []string{"R_0002"}, lookup(rng, sqlparser.NewStrVal([]byte("1000"))))
+	}
+}
+
+func TestRangeCompareValue(t *testing.T) {
+	tests := []struct {
+		a       string
+		b       string
+		numeric bool
+		want    int
+	}{
+		{"9", "10", true, -1},
+		{"10", "9", true, 1},
+		{"10", "010", true, 0},
+		{"1.5", "1.25", true, 1},
+		{" 10 ", "9", true, 1},
+		{"10abc", "9", true, 1},
+		{"abc", "0", true, 0},
+		{"9223372036854775808", "9223372036854775807", true, 1},
+		{"10", "9", false, -1},
+		{"2018-01-01", "2019-01-01", false, -1},
+		{"b", "a", false, 1},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, compareValue(test.a, test.b, test.numeric), "%s,%s", test.a, test.b)
+	}
+}
@@ -10,6 +10,8 @@ package router
 
 import (
 	"encoding/json"
+	"sort"
+	"strings"
 	"sync"
 
 	"config"
@@ -26,6 +28,10 @@ type Table struct {
 	Name string `json:",omitempty"`
 	// Shard key
 	ShardKey string `json:",omitempty"`
+	// Shard type
+	ShardType string `json:",omitempty"`
+	// Table group
+	Group string `json:",omitempty"`
 	// partition method
 	Partition Partition `json:",omitempty"`
 	// table config.
@@ -50,16 +56,26 @@ type Router struct {
 
 	// schemas map, key is database name
 	Schemas map[string]*Schema `json:",omitempty"`
+
+	// sequences map, key is database name
+	sequences map[string]map[string]*config.SequenceConfig
+
+	// seqMu protects the segments reserved by this proxy, the segments are kept when the config reloads.
+	seqMu      sync.Mutex
+	segments   map[string]*segment
+	seqReserve SequenceReserver
 }
 
 // NewRouter creates the new router.
 func NewRouter(log *xlog.Log, metadir string, conf *config.RouterConfig) *Router {
 	route := &Router{
-		log:     log,
-		metadir: metadir,
-		conf:    conf,
-		dbACL:   NewDatabaseACL(),
-		Schemas: make(map[string]*Schema),
+		log:       log,
+		metadir:   metadir,
+		conf:      conf,
+		dbACL:     NewDatabaseACL(),
+		Schemas:   make(map[string]*Schema),
+		sequences: make(map[string]map[string]*config.SequenceConfig),
+		segments:  make(map[string]*segment),
 	}
 	return route
 }
@@ -76,6 +92,10 @@ func (r *Router) add(db string, tbl *config.TableConfig) error {
 	if tbl == nil {
 		return errors.New("table.config..can't.be.nil")
 	}
+	// Only the hash method supports the composite sharding key.
+	if len(ShardKeyColumns(tbl.ShardKey)) > 1 && tbl.ShardType != methodTypeHash {
+		return errors.Errorf("router.table[%v].shardtype[%v].does.not.support.composite.shardkey", tbl.Name, tbl.ShardType)
+	}
 
 	// schema
 	if schema, ok = r.Schemas[db]; !ok {
@@ -88,6 +108,8 @@ func (r *Router) add(db string, tbl *config.TableConfig) error {
 		table = &Table{
 			Name:        tbl.Name,
 			ShardKey:    tbl.ShardKey,
+			ShardType:   tbl.ShardType,
+			Group:       tbl.Group,
 			TableConfig: tbl,
 		}
 		schema.Tables[tbl.Name] = table
@@ -103,6 +125,30 @@ func (r *Router) add(db string, tbl *config.TableConfig) error {
 			return err
 		}
 		table.Partition = hash
+	case methodTypeRange:
+		rng := NewRange(r.log, tbl)
+		if err := rng.Build(); err != nil {
+			return err
+		}
+		table.Partition = rng
+	case methodTypeList:
+		list := NewList(r.log, tbl)
+		if err := list.Build(); err != nil {
+			return err
+		}
+		table.Partition = list
+	case methodTypeGlobal:
+		global := NewGlobal(r.log, tbl)
+		if err := global.Build(); err != nil {
+			return err
+		}
+		table.Partition = global
+	case methodTypeSingle:
+		single := NewSingle(r.log, tbl)
+		if err := single.Build(); err != nil {
+			return err
+		}
+		table.Partition = single
 	default:
 		return errors.Errorf("router.unsupport.shardtype:[%v]", tbl.ShardType)
 	}
@@ -131,6 +177,7 @@ func (r *Router) remove(db string, table string) error {
 // clear used to reset Schemas to new.
 func (r *Router) clear() {
 	r.Schemas = make(map[string]*Schema)
+	r.sequences = make(map[string]map[string]*config.SequenceConfig)
 }
 
 // DatabaseACL used to check wheather the database is a system database.
@@ -181,6 +228,113 @@ func (r *Router) ShardKey(database string, tableName string) (string, error) {
 	return table.ShardKey, nil
 }
 
+// ShardKeys used to lookup the sharding key columns from given database and table name,
+// the composite sharding key has more than one column.
+func (r *Router) ShardKeys(database string, tableName string) ([]string, error) {
+	table, err := r.getTable(database, tableName)
+	if err != nil {
+		return nil, err
+	}
+	return ShardKeyColumns(table.ShardKey), nil
+}
+
+// ShardKeyColumns splits the sharding key to columns, the composite sharding key is
+// stored as the columns joined by comma, such as 'tenant_id,order_id'.
+func ShardKeyColumns(shardkey string) []string {
+	if shardkey == "" {
+		return nil
+	}
+	columns := strings.Split(shardkey, ",")
+	for i, column := range columns {
+		columns[i] = strings.TrimSpace(column)
+	}
+	return columns
+}
+
+// IsGlobal returns true if the table is a global table which has a full copy on every backend.
+func (r *Router) IsGlobal(database string, tableName string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	schema, ok := r.Schemas[database]
+	if !ok {
+		return false
+	}
+	table, ok := schema.Tables[tableName]
+	if !ok {
+		return false
+	}
+	return table.TableConfig.ShardType == methodTypeGlobal
+}
+
+// SingleBackend returns the backend which the single table placed on,
+// the bool is false if the table isn't a single table.
+func (r *Router) SingleBackend(database string, tableName string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	schema, ok := r.Schemas[database]
+	if !ok {
+		return "", false
+	}
+	table, ok := schema.Tables[tableName]
+	if !ok || table.TableConfig.ShardType != methodTypeSingle {
+		return "", false
+	}
+	return table.TableConfig.Partitions[0].Backend, true
+}
+
+// TableBackends returns the backends of the partitions of the table in order, nil if the table doesn't exist.
+func (r *Router) TableBackends(database string, tableName string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	schema, ok := r.Schemas[database]
+	if !ok {
+		return nil
+	}
+	table, ok := schema.Tables[tableName]
+	if !ok {
+		return nil
+	}
+	return partitionBackends(table.TableConfig)
+}
+
+// Backends returns the backends holding the partitions of all the tables in order.
+func (r *Router) Backends() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var backends []string
+	for _, schema := range r.Schemas {
+		for _, table := range schema.Tables {
+			backends = append(backends, partitionBackends(table.TableConfig)...)
+		}
+	}
+	return uniqueSorted(backends)
+}
+
+// partitionBackends returns the backends of the partitions of the table in order.
+func partitionBackends(conf *config.TableConfig) []string {
+	backends := make([]string, 0, len(conf.Partitions))
+	for _, part := range conf.Partitions {
+		backends = append(backends, part.Backend)
+	}
+	return uniqueSorted(backends)
+}
+
+// uniqueSorted returns the sorted strings without the duplicates.
+func uniqueSorted(list []string) []string {
+	sort.Strings(list)
+	unique := list[:0]
+	for _, s := range list {
+		if len(unique) == 0 || s != unique[len(unique)-1] {
+			unique = append(unique, s)
+		}
+	}
+	return unique
+}
+
 // TableConfig returns the config by database and tableName.
 func (r *Router) TableConfig(database string, tableName string) (*config.TableConfig, error) {
 	table, err := r.getTable(database, tableName)
@@ -229,6 +383,34 @@ func (r *Router) Lookup(database string, tableName string, startKey *sqlparser.S
 	return partInfos, nil
 }
 
+// LookupTuple used to lookup the partition through the values of all the sharding key columns,
+// the values must be in the order of the sharding key columns.
+func (r *Router) LookupTuple(database string, tableName string, keys []*sqlparser.SQLVal) ([]Segment, error) {
+	if len(keys) == 1 {
+		return r.Lookup(database, tableName, keys[0], keys[0])
+	}
+
+	table, err := r.getTable(database, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	// lock
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	hash, ok := table.Partition.(*Hash)
+	if !ok {
+		return nil, errors.Errorf("router.table[%s.%s].shardtype[%s].does.not.support.composite.shardkey", database, tableName, table.ShardType)
+	}
+	partInfos, err := hash.LookupTuple(keys)
+	if err != nil {
+		r.log.Error("router.partition.lookup.tuple.error:%+v", err)
+		return nil, err
+	}
+	return partInfos, nil
+}
+
 // Tables returns all the tables.
 func (r *Router) Tables() map[string][]string {
 	r.mu.RLock()
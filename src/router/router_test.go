@@ -32,6 +32,7 @@ func TestRouteradd(t *testing.T) {
 				"A": {
 					"Name": "A",
 					"ShardKey": "id",
+					"ShardType": "HASH",
 					"Partition": {
 						"Segments": [
 							{
@@ -223,6 +224,114 @@ func TestRouterShardKey(t *testing.T) {
 	}
 }
 
+func TestRouterIsGlobal(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+	assert.NotNil(t, router)
+
+	err := router.add("sbtest", MockTableAConfig())
+	assert.Nil(t, err)
+	err = router.add("sbtest", MockTableGConfig())
+	assert.Nil(t, err)
+
+	assert.True(t, router.IsGlobal("sbtest", "G"))
+	assert.False(t, router.IsGlobal("sbtest", "A"))
+	assert.False(t, router.IsGlobal("sbtest", "x"))
+	assert.False(t, router.IsGlobal("xx", "G"))
+}
+
+func TestRouterSingleBackend(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+	assert.NotNil(t, router)
+
+	err := router.add("sbtest", MockTableAConfig())
+	assert.Nil(t, err)
+	err = router.add("sbtest", MockTableSConfig())
+	assert.Nil(t, err)
+
+	backend, ok := router.SingleBackend("sbtest", "S")
+	assert.True(t, ok)
+	assert.Equal(t, "backend1", backend)
+	_, ok = router.SingleBackend("sbtest", "A")
+	assert.False(t, ok)
+	_, ok = router.SingleBackend("sbtest", "x")
+	assert.False(t, ok)
+	_, ok = router.SingleBackend("xx", "S")
+	assert.False(t, ok)
+}
+
+func TestRouterBackends(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+	assert.NotNil(t, router)
+	assert.Equal(t, 0, len(router.Backends()))
+
+	err := router.add("sbtest", MockTableBConfig())
+	assert.Nil(t, err)
+	err = router.add("sbtest1", MockTableSConfig())
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"backend0", "backend512"}, router.TableBackends("sbtest", "B"))
+	assert.Equal(t, []string{"backend1"}, router.TableBackends("sbtest1", "S"))
+	assert.Nil(t, router.TableBackends("sbtest", "x"))
+	assert.Nil(t, router.TableBackends("xx", "B"))
+	assert.Equal(t, []string{"backend0", "backend1", "backend512"}, router.Backends())
+}
+
+func TestRouterCompositeShardKey(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+	assert.NotNil(t, router)
+
+	err := router.add("sbtest", MockTableAConfig())
+	assert.Nil(t, err)
+	err = router.add("sbtest", MockTableCConfig())
+	assert.Nil(t, err)
+	err = router.add("sbtest", MockTableRConfig())
+	assert.Nil(t, err)
+
+	// ShardKeys.
+	{
+		keys, err := router.ShardKeys("sbtest", "C")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"tenant_id", "order_id"}, keys)
+
+		keys, err = router.ShardKeys("sbtest", "A")
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"id"}, keys)
+
+		_, err = router.ShardKeys("sbtest", "x")
+		assert.NotNil(t, err)
+	}
+
+	// LookupTuple.
+	{
+		keys := []*sqlparser.SQLVal{sqlparser.NewIntVal([]byte("1")), sqlparser.NewIntVal([]byte("2"))}
+		segments, err := router.LookupTuple("sbtest", "C", keys)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(segments))
+
+		_, err = router.LookupTuple("sbtest", "R", keys)
+		want := "router.table[sbtest.R].shardtype[RANGE].does.not.support.composite.shardkey"
+		assert.Equal(t, want, err.Error())
+	}
+
+	// Only hash supports the composite key.
+	{
+		conf := MockTableRConfig()
+		conf.Name = "R1"
+		conf.ShardKey = "a,b"
+		err := router.add("sbtest", conf)
+		want := "router.table[R1].shardtype[RANGE].does.not.support.composite.shardkey"
+		assert.Equal(t, want, err.Error())
+	}
+}
+
 func TestRouterShardKeyError(t *testing.T) {
 	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
 	router, cleanup := MockNewRouter(log)
@@ -0,0 +1,455 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package router
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+
+	"config"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// sequenceJSONFile is the file of the sequences under the metadir.
+	sequenceJSONFile = "sequence.json"
+
+	// DefaultSequenceCache is the default number of the values reserved by one proxy at a time.
+	DefaultSequenceCache = 1000
+)
+
+// segment is the values reserved by this proxy, the values in [next, max) are not allocated yet.
+type segment struct {
+	next      int64
+	max       int64
+	increment int64
+}
+
+func sequenceKey(db, name string) string {
+	return db + "." + name
+}
+
+func autoIncrementKey(db, table string) string {
+	return db + "." + table + ".auto_increment"
+}
+
+// SequenceReserver reserves the next segment of the sequence db.name, or of the AUTO_INCREMENT
+// of the table db.name if auto is true. Returns the first value and the end(exclusive) of the segment.
+type SequenceReserver func(db, name string, auto bool) (int64, int64, error)
+
+// SetSequenceReserver sets the reserver of the segments, the peers reserve the segments on
+// one owner so that the reservations are serialized. The router reserves by itself if it's nil.
+func (r *Router) SetSequenceReserver(fn SequenceReserver) {
+	r.seqMu.Lock()
+	defer r.seqMu.Unlock()
+	r.seqReserve = fn
+}
+
+// getSequence returns the sequence config, the caller must hold the lock.
+func (r *Router) getSequence(db, name string) (*config.SequenceConfig, error) {
+	if seqs, ok := r.sequences[db]; ok {
+		if seq, ok := seqs[name]; ok {
+			return seq, nil
+		}
+	}
+	return nil, errors.Errorf("Unknown SEQUENCE: '%s.%s'", db, name)
+}
+
+// SequenceExists returns true if the sequence exists.
+func (r *Router) SequenceExists(db, name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, err := r.getSequence(db, name)
+	return err == nil
+}
+
+// Sequences returns the sequence names of the database in order.
+func (r *Router) Sequences(db string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.sequences[db]))
+	for name := range r.sequences[db] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CreateSequence used to add a sequence and flush the sequences to disk.
+// Lock.
+func (r *Router) CreateSequence(db, name string, start, increment, cache int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	log := r.log
+	if db == "" {
+		return errors.New("db.can't.be.null")
+	}
+	if increment <= 0 {
+		return errors.Errorf("Incorrect INCREMENT value for SEQUENCE '%s.%s', it must be positive", db, name)
+	}
+	if cache <= 0 {
+		return errors.Errorf("Incorrect CACHE value for SEQUENCE '%s.%s', it must be positive", db, name)
+	}
+	if _, err := r.getSequence(db, name); err == nil {
+		return errors.Errorf("Sequence '%s.%s' already exists", db, name)
+	}
+
+	seqs, ok := r.sequences[db]
+	if !ok {
+		seqs = make(map[string]*config.SequenceConfig)
+		r.sequences[db] = seqs
+	}
+	seqs[name] = &config.SequenceConfig{
+		Name:      name,
+		Increment: increment,
+		Cache:     cache,
+		Next:      start,
+	}
+	if err := r.writeSequences(); err != nil {
+		log.Error("frm.create.sequence[%s.%s].file.error:%+v", db, name, err)
+		delete(seqs, name)
+		return err
+	}
+
+	if err := config.UpdateVersion(r.metadir); err != nil {
+		log.Panicf("frm.create.sequence.update.version.error:%v", err)
+		return err
+	}
+	return nil
+}
+
+// DropSequence used to remove the sequence and flush the sequences to disk.
+// Lock.
+func (r *Router) DropSequence(db, name string) error {
+	r.seqMu.Lock()
+	defer r.seqMu.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	log := r.log
+	if _, err := r.getSequence(db, name); err != nil {
+		return err
+	}
+	delete(r.sequences[db], name)
+	delete(r.segments, sequenceKey(db, name))
+	if err := r.writeSequences(); err != nil {
+		log.Error("frm.drop.sequence[%s.%s].file.error:%+v", db, name, err)
+		return err
+	}
+
+	if err := config.UpdateVersion(r.metadir); err != nil {
+		log.Panicf("frm.drop.sequence.update.version.error:%v", err)
+		return err
+	}
+	return nil
+}
+
+// NextVal returns the next n values of the sequence.
+func (r *Router) NextVal(db, name string, n int) ([]int64, error) {
+	return r.nextValues(db, name, false, n)
+}
+
+// SetAutoIncrement used to fill the AUTO_INCREMENT column of the table by the sequence starting
+// from start(the AUTO_INCREMENT table option) and flush the table config to disk.
+// Lock.
+func (r *Router) SetAutoIncrement(db, table, column string, start int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	log := r.log
+	if start <= 0 {
+		return errors.Errorf("Incorrect AUTO_INCREMENT value for table '%s.%s', it must be positive", db, table)
+	}
+	tbl, err := r.lookupTable(db, table)
+	if err != nil {
+		return err
+	}
+	tbl.TableConfig.AutoIncrement = &config.SequenceConfig{
+		Name:      column,
+		Increment: 1,
+		Cache:     DefaultSequenceCache,
+		Next:      start,
+	}
+	if err := r.writeFrmData(db, table, tbl.TableConfig); err != nil {
+		log.Error("frm.set.auto.increment[%s.%s].file.error:%+v", db, table, err)
+		tbl.TableConfig.AutoIncrement = nil
+		return err
+	}
+
+	if err := config.UpdateVersion(r.metadir); err != nil {
+		log.Panicf("frm.set.auto.increment.update.version.error:%v", err)
+		return err
+	}
+	return nil
+}
+
+// SetUniqueKey used to set the primary or unique key of the table and flush the table
+// config to disk, the empty columns clear the key.
+// Lock.
+func (r *Router) SetUniqueKey(db, table, name, columns string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	log := r.log
+	tbl, err := r.lookupTable(db, table)
+	if err != nil {
+		return err
+	}
+	oldName, oldColumns := tbl.TableConfig.UniqueKeyName, tbl.TableConfig.UniqueKey
+	tbl.TableConfig.UniqueKeyName, tbl.TableConfig.UniqueKey = name, columns
+	if err := r.writeFrmData(db, table, tbl.TableConfig); err != nil {
+		log.Error("frm.set.unique.key[%s.%s].file.error:%+v", db, table, err)
+		tbl.TableConfig.UniqueKeyName, tbl.TableConfig.UniqueKey = oldName, oldColumns
+		return err
+	}
+
+	if err := config.UpdateVersion(r.metadir); err != nil {
+		log.Panicf("frm.set.unique.key.update.version.error:%v", err)
+		return err
+	}
+	return nil
+}
+
+// SetColumns used to set the columns of the table in the table order and flush the table
+// config to disk.
+// Lock.
+func (r *Router) SetColumns(db, table string, columns []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	log := r.log
+	tbl, err := r.lookupTable(db, table)
+	if err != nil {
+		return err
+	}
+	old := tbl.TableConfig.Columns
+	tbl.TableConfig.Columns = columns
+	if err := r.writeFrmData(db, table, tbl.TableConfig); err != nil {
+		log.Error("frm.set.columns[%s.%s].file.error:%+v", db, table, err)
+		tbl.TableConfig.Columns = old
+		return err
+	}
+
+	if err := config.UpdateVersion(r.metadir); err != nil {
+		log.Panicf("frm.set.columns.update.version.error:%v", err)
+		return err
+	}
+	return nil
+}
+
+// Columns returns the columns of the table in the table order, nil if they are not recorded.
+func (r *Router) Columns(db, table string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tbl, err := r.lookupTable(db, table)
+	if err != nil {
+		return nil
+	}
+	return tbl.TableConfig.Columns
+}
+
+// UniqueKey returns the index name and the columns of the primary or unique key of the table,
+// nil columns if the table has none.
+func (r *Router) UniqueKey(db, table string) (string, []string) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tbl, err := r.lookupTable(db, table)
+	if err != nil {
+		return "", nil
+	}
+	return tbl.TableConfig.UniqueKeyName, ShardKeyColumns(tbl.TableConfig.UniqueKey)
+}
+
+// AutoIncrement returns the AUTO_INCREMENT column which is filled by the sequence,
+// empty if the table has no such column.
+func (r *Router) AutoIncrement(db, table string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tbl, err := r.lookupTable(db, table)
+	if err != nil || tbl.TableConfig.AutoIncrement == nil {
+		return ""
+	}
+	return tbl.TableConfig.AutoIncrement.Name
+}
+
+// NextAutoIncrement returns the next n values of the AUTO_INCREMENT column of the table.
+func (r *Router) NextAutoIncrement(db, table string, n int) ([]int64, error) {
+	return r.nextValues(db, table, true, n)
+}
+
+// lookupTable returns the table, the caller must hold the lock.
+func (r *Router) lookupTable(db, table string) (*Table, error) {
+	if schema, ok := r.Schemas[db]; ok {
+		if tbl, ok := schema.Tables[table]; ok {
+			return tbl, nil
+		}
+	}
+	return nil, errors.Errorf("router.can.not.find.table[%s.%s]", db, table)
+}
+
+// lookupSequence returns the config of the sequence, or of the AUTO_INCREMENT of the table if auto is true.
+// The caller must hold the lock.
+func (r *Router) lookupSequence(db, name string, auto bool) (*config.SequenceConfig, error) {
+	if !auto {
+		return r.getSequence(db, name)
+	}
+	tbl, err := r.lookupTable(db, name)
+	if err != nil {
+		return nil, err
+	}
+	if tbl.TableConfig.AutoIncrement == nil {
+		return nil, errors.Errorf("Table '%s.%s' has no AUTO_INCREMENT sequence", db, name)
+	}
+	return tbl.TableConfig.AutoIncrement, nil
+}
+
+// nextValues allocates n values from the segment reserved by this proxy, a new segment is
+// reserved once the segment is used up.
+func (r *Router) nextValues(db, name string, auto bool, n int) ([]int64, error) {
+	r.seqMu.Lock()
+	defer r.seqMu.Unlock()
+
+	log := r.log
+	key := sequenceKey(db, name)
+	if auto {
+		key = autoIncrementKey(db, name)
+	}
+
+	// The sequence may be dropped by the peers.
+	var increment int64
+	r.mu.RLock()
+	conf, err := r.lookupSequence(db, name, auto)
+	if err == nil {
+		increment = conf.Increment
+	}
+	r.mu.RUnlock()
+	if err != nil {
+		delete(r.segments, key)
+		return nil, err
+	}
+
+	reserve := r.ReserveSequence
+	if r.seqReserve != nil {
+		reserve = r.seqReserve
+	}
+	seg := r.segments[key]
+	values := make([]int64, 0, n)
+	for len(values) < n {
+		if seg == nil || seg.next >= seg.max {
+			start, max, err := reserve(db, name, auto)
+			if err != nil {
+				log.Error("frm.sequence[%s].reserve.error:%+v", key, err)
+				return nil, err
+			}
+			seg = &segment{next: start, max: max, increment: increment}
+			r.segments[key] = seg
+		}
+		values = append(values, seg.next)
+		seg.next += seg.increment
+	}
+	return values, nil
+}
+
+// ReserveSequence reserves the next segment of the sequence db.name, or of the AUTO_INCREMENT
+// of the table db.name if auto is true, and flushes the reservation to disk. Returns the first
+// value and the end(exclusive) of the segment.
+// The reservations of the peers are made by the owner of the sequences(see SetSequenceReserver),
+// they are serialized by the lock.
+// Lock.
+func (r *Router) ReserveSequence(db, name string, auto bool) (int64, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	log := r.log
+	conf, err := r.lookupSequence(db, name, auto)
+	if err != nil {
+		return 0, 0, err
+	}
+	start := conf.Next
+	conf.Next = start + conf.Cache*conf.Increment
+	if auto {
+		err = r.writeFrmData(db, name, r.Schemas[db].Tables[name].TableConfig)
+	} else {
+		err = r.writeSequences()
+	}
+	if err != nil {
+		log.Error("frm.sequence[%s.%s].reserve.error:%+v", db, name, err)
+		conf.Next = start
+		return 0, 0, err
+	}
+
+	if err := config.UpdateVersion(r.metadir); err != nil {
+		log.Panicf("frm.sequence.reserve.update.version.error:%v", err)
+		return 0, 0, err
+	}
+	return start, conf.Next, nil
+}
+
+// writeSequences used to write all the sequences to the file, the caller must hold the lock.
+func (r *Router) writeSequences() error {
+	dbs := make([]string, 0, len(r.sequences))
+	for db := range r.sequences {
+		dbs = append(dbs, db)
+	}
+	sort.Strings(dbs)
+
+	confs := make([]*config.SequenceSchemaConfig, 0, len(dbs))
+	for _, db := range dbs {
+		names := make([]string, 0, len(r.sequences[db]))
+		for name := range r.sequences[db] {
+			names = append(names, name)
+		}
+		if len(names) == 0 {
+			continue
+		}
+		sort.Strings(names)
+		schema := &config.SequenceSchemaConfig{DB: db}
+		for _, name := range names {
+			schema.Sequences = append(schema.Sequences, r.sequences[db][name])
+		}
+		confs = append(confs, schema)
+	}
+	if err := os.MkdirAll(r.metadir, os.ModePerm); err != nil {
+		return errors.WithStack(err)
+	}
+	file := path.Join(r.metadir, sequenceJSONFile)
+	return config.WriteConfig(file, confs)
+}
+
+// loadSequences used to load the sequences from the file, the caller must hold the lock.
+func (r *Router) loadSequences() error {
+	file := path.Join(r.metadir, sequenceJSONFile)
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	confs, err := config.ReadSequencesConfig(string(data))
+	if err != nil {
+		return err
+	}
+	for _, schema := range confs {
+		seqs := make(map[string]*config.SequenceConfig)
+		for _, seq := range schema.Sequences {
+			seqs[seq.Name] = seq
+		}
+		r.sequences[schema.DB] = seqs
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package router
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestSequence(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	err := router.CreateSequence("test", "s1", 100, 2, 3)
+	assert.Nil(t, err)
+	assert.True(t, router.SequenceExists("test", "s1"))
+	assert.False(t, router.SequenceExists("test", "s2"))
+	assert.Equal(t, []string{"s1"}, router.Sequences("test"))
+
+	// Allocate across the segments.
+	{
+		values, err := router.NextVal("test", "s1", 1)
+		assert.Nil(t, err)
+		assert.Equal(t, []int64{100}, values)
+
+		values, err = router.NextVal("test", "s1", 4)
+		assert.Nil(t, err)
+		assert.Equal(t, []int64{102, 104, 106, 108}, values)
+	}
+
+	// The reservation is persisted, the new router starts from the next segment.
+	{
+		router1 := NewRouter(log, router.metadir, router.conf)
+		err := router1.LoadConfig()
+		assert.Nil(t, err)
+		values, err := router1.NextVal("test", "s1", 2)
+		assert.Nil(t, err)
+		assert.Equal(t, []int64{112, 114}, values)
+
+		// The old router keeps its segment, then skips the segment reserved by router1.
+		err = router.LoadConfig()
+		assert.Nil(t, err)
+		values, err = router.NextVal("test", "s1", 2)
+		assert.Nil(t, err)
+		assert.Equal(t, []int64{110, 118}, values)
+	}
+
+	// Drop.
+	{
+		err := router.DropSequence("test", "s1")
+		assert.Nil(t, err)
+		assert.False(t, router.SequenceExists("test", "s1"))
+
+		router1 := NewRouter(log, router.metadir, router.conf)
+		err = router1.LoadConfig()
+		assert.Nil(t, err)
+		assert.False(t, router1.SequenceExists("test", "s1"))
+	}
+}
+
+func TestSequenceError(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	err := router.CreateSequence("test", "s1", 1, 1, DefaultSequenceCache)
+	assert.Nil(t, err)
+
+	tests := []struct {
+		f   func() error
+		err string
+	}{
+		{
+			f:   func() error { return router.CreateSequence("test", "s1", 1, 1, 1) },
+			err: "Sequence 'test.s1' already exists",
+		},
+		{
+			f:   func() error { return router.CreateSequence("test", "s2", 1, 0, 1) },
+			err: "Incorrect INCREMENT value for SEQUENCE 'test.s2', it must be positive",
+		},
+		{
+			f:   func() error { return router.CreateSequence("test", "s2", 1, 1, 0) },
+			err: "Incorrect CACHE value for SEQUENCE 'test.s2', it must be positive",
+		},
+		{
+			f:   func() error { return router.DropSequence("test", "s2") },
+			err: "Unknown SEQUENCE: 'test.s2'",
+		},
+		{
+			f: func() error {
+				_, err := router.NextVal("xx", "s1", 1)
+				return err
+			},
+			err: "Unknown SEQUENCE: 'xx.s1'",
+		},
+		{
+			f:   func() error { return router.SetAutoIncrement("test", "t1", "id", 1) },
+			err: "router.can.not.find.table[test.t1]",
+		},
+		{
+			f:   func() error { return router.SetAutoIncrement("test", "t1", "id", 0) },
+			err: "Incorrect AUTO_INCREMENT value for table 'test.t1', it must be positive",
+		},
+	}
+	for _, test := range tests {
+		err := test.f()
+		assert.NotNil(t, err)
+		assert.Equal(t, test.err, err.Error())
+	}
+
+	// Drop database removes the sequences.
+	err = router.DropDatabase("test")
+	assert.Nil(t, err)
+	assert.False(t, router.SequenceExists("test", "s1"))
+}
+
+func TestSequenceAutoIncrement(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	backends := []string{"backend1", "backend2"}
+	err := router.CreateTable("test", "t1", "id", backends)
+	assert.Nil(t, err)
+	assert.Equal(t, "", router.AutoIncrement("test", "t1"))
+	_, err = router.NextAutoIncrement("test", "t1", 1)
+	assert.Equal(t, "Table 'test.t1' has no AUTO_INCREMENT sequence", err.Error())
+
+	err = router.SetAutoIncrement("test", "t1", "id", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, "id", router.AutoIncrement("test", "t1"))
+	assert.Nil(t, router.Columns("test", "t1"))
+	err = router.SetColumns("test", "t1", []string{"b", "id"})
+	assert.Nil(t, err)
+
+	values, err := router.NextAutoIncrement("test", "t1", 3)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1, 2, 3}, values)
+
+	// The reservation is persisted in the table config.
+	{
+		router1 := NewRouter(log, router.metadir, router.conf)
+		err := router1.LoadConfig()
+		assert.Nil(t, err)
+		assert.Equal(t, "id", router1.AutoIncrement("test", "t1"))
+		assert.Equal(t, []string{"b", "id"}, router1.Columns("test", "t1"))
+		values, err := router1.NextAutoIncrement("test", "t1", 1)
+		assert.Nil(t, err)
+		assert.Equal(t, []int64{DefaultSequenceCache + 1}, values)
+	}
+
+	// Recreate the table, the numbering restarts from the AUTO_INCREMENT option.
+	err = router.DropTable("test", "t1")
+	assert.Nil(t, err)
+	err = router.CreateTable("test", "t1", "id", backends)
+	assert.Nil(t, err)
+	err = router.SetAutoIncrement("test", "t1", "id", 100)
+	assert.Nil(t, err)
+	values, err = router.NextAutoIncrement("test", "t1", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{100, 101}, values)
+}
+
+func TestSequenceReserver(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	router, cleanup := MockNewRouter(log)
+	defer cleanup()
+
+	// The owner reserves the segments.
+	owner, ownerCleanup := MockNewRouter(log)
+	defer ownerCleanup()
+	err := owner.CreateSequence("test", "s1", 1, 1, 2)
+	assert.Nil(t, err)
+
+	reserved := 0
+	router.SetSequenceReserver(func(db, name string, auto bool) (int64, int64, error) {
+		reserved++
+		return owner.ReserveSequence(db, name, auto)
+	})
+	err = router.CreateSequence("test", "s1", 1, 1, 2)
+	assert.Nil(t, err)
+
+	values, err := router.NextVal("test", "s1", 5)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1, 2, 3, 4, 5}, values)
+	// One reservation per segment.
+	assert.Equal(t, 3, reserved)
+
+	// The owner hands out the next segment.
+	values, err = owner.NextVal("test", "s1", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{7}, values)
+
+	// Reserve error.
+	{
+		router.SetSequenceReserver(func(db, name string, auto bool) (int64, int64, error) {
+			return 0, 0, errors.New("mock.reserve.error")
+		})
+		_, err := router.NextVal("test", "s1", 2)
+		assert.NotNil(t, err)
+	}
+
+	// No AUTO_INCREMENT.
+	{
+		_, _, err := owner.ReserveSequence("test", "t1", true)
+		assert.NotNil(t, err)
+	}
+}
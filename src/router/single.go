@@ -0,0 +1,89 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package router
+
+import (
+	"config"
+
+	"github.com/pkg/errors"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+// SingleRange tuple.
+// The single segment holds all the rows of the table.
+type SingleRange struct {
+}
+
+// String returns the range info, all the rows.
+func (s *SingleRange) String() string {
+	return ""
+}
+
+// Less impl.
+func (s *SingleRange) Less(b KeyRange) bool {
+	return false
+}
+
+// Single tuple.
+// The single table isn't sharded, it's placed on one backend.
+type Single struct {
+	log *xlog.Log
+
+	// single method
+	typ MethodType
+
+	// table config
+	conf *config.TableConfig
+
+	// Segments, only one.
+	Segments []Segment `json:",omitempty"`
+}
+
+// NewSingle creates new single.
+func NewSingle(log *xlog.Log, conf *config.TableConfig) *Single {
+	return &Single{
+		log:      log,
+		conf:     conf,
+		typ:      methodTypeSingle,
+		Segments: make([]Segment, 0, 1),
+	}
+}
+
+// Build used to build the single segment from schema config.
+func (s *Single) Build() error {
+	if len(s.conf.Partitions) != 1 {
+		return errors.Errorf("single.table[%v].must.have.one.partition.but.got[%d]", s.conf.Name, len(s.conf.Partitions))
+	}
+
+	part := s.conf.Partitions[0]
+	segment := Segment{
+		Table:   part.Table,
+		Backend: part.Backend,
+		Range:   &SingleRange{},
+	}
+	s.Segments = append(s.Segments, segment)
+	return nil
+}
+
+// Clear used to clean single partitions.
+func (s *Single) Clear() error {
+	s.Segments = s.Segments[:0]
+	return nil
+}
+
+// Lookup returns the only segment.
+func (s *Single) Lookup(start *sqlparser.SQLVal, end *sqlparser.SQLVal) ([]Segment, error) {
+	return s.Segments, nil
+}
+
+// Type returns the single type.
+func (s *Single) Type() MethodType {
+	return s.typ
+}
@@ -0,0 +1,54 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package router
+
+import (
+	"testing"
+
+	"config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xelabs/go-mysqlstack/sqlparser"
+	"github.com/xelabs/go-mysqlstack/xlog"
+)
+
+func TestSingle(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	single := NewSingle(log, MockTableSConfig())
+	{
+		err := single.Build()
+		assert.Nil(t, err)
+		assert.Equal(t, string(single.Type()), methodTypeSingle)
+		assert.Equal(t, 1, len(single.Segments))
+		assert.Equal(t, "backend1", single.Segments[0].Backend)
+		assert.Equal(t, "", single.Segments[0].Range.String())
+		assert.False(t, single.Segments[0].Range.Less(single.Segments[0].Range))
+	}
+
+	{
+		segments, err := single.Lookup(sqlparser.NewIntVal([]byte("1")), sqlparser.NewIntVal([]byte("1")))
+		assert.Nil(t, err)
+		assert.Equal(t, single.Segments, segments)
+	}
+
+	{
+		err := single.Clear()
+		assert.Nil(t, err)
+		err = single.Build()
+		assert.Nil(t, err)
+	}
+}
+
+func TestSingleBuildError(t *testing.T) {
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	conf := &config.TableConfig{Name: "S", ShardType: "SINGLE"}
+	err := NewSingle(log, conf).Build()
+	want := "single.table[S].must.have.one.partition.but.got[0]"
+	assert.Equal(t, want, err.Error())
+}
@@ -8,10 +8,44 @@
 
 package router
 
+import (
+	"strings"
+)
+
 // MethodType type.
 type MethodType string
 
 const (
 	// methodTypeHash type.
 	methodTypeHash = "HASH"
+
+	// methodTypeRange type.
+	methodTypeRange = "RANGE"
+
+	// methodTypeList type.
+	methodTypeList = "LIST"
+
+	// methodTypeGlobal type.
+	methodTypeGlobal = "GLOBAL"
+
+	// methodTypeSingle type.
+	methodTypeSingle = "SINGLE"
 )
+
+// isIntegerType returns true if the column type is an integer type.
+func isIntegerType(typ string) bool {
+	switch strings.ToLower(typ) {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint", "year":
+		return true
+	}
+	return false
+}
+
+// isNumericType returns true if the column type is an integer, fixed-point or floating-point type.
+func isNumericType(typ string) bool {
+	switch strings.ToLower(typ) {
+	case "decimal", "numeric", "float", "double", "real":
+		return true
+	}
+	return isIntegerType(typ)
+}
@@ -118,6 +118,10 @@ func (s *Syncer) MetaJSON() (*Meta, error) {
 			return err
 		}
 
+		// The spilled rows are not meta.
+		if info.IsDir() && path == filepath.Join(s.metadir, config.SpillDirName) {
+			return filepath.SkipDir
+		}
 		if !info.IsDir() {
 			file := strings.TrimPrefix(strings.TrimPrefix(path, s.metadir), "/")
 			data, err := readFile(log, path)
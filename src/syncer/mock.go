@@ -103,6 +103,7 @@ func mockHTTP(log *xlog.Log, syncer *Syncer, version mockHandler, metas mockHand
 	router, err := rest.MakeRouter(
 		rest.Get("/v1/meta/versions", version(log, syncer)),
 		rest.Get("/v1/meta/metas", metas(log, syncer)),
+		rest.Post("/v1/meta/sequence/reserve", mockSequenceReserve(log, syncer)),
 	)
 	if err != nil {
 		log.Panicf("mock.rest.make.router.error:%+v", err)
@@ -143,6 +144,23 @@ func mockMetas(log *xlog.Log, syncer *Syncer) rest.HandlerFunc {
 	return f
 }
 
+func mockSequenceReserve(log *xlog.Log, syncer *Syncer) rest.HandlerFunc {
+	f := func(w rest.ResponseWriter, r *rest.Request) {
+		p := SequenceReserve{}
+		if err := r.DecodeJsonPayload(&p); err != nil {
+			rest.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		start, max, err := syncer.ReserveSequence(p.DB, p.Name, p.AutoIncrement)
+		if err != nil {
+			rest.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteJson(&SequenceSegment{Start: start, Max: max})
+	}
+	return f
+}
+
 func mockSHA(log *xlog.Log, syncer *Syncer) [20]byte {
 	var datas []byte
 	if err := filepath.Walk(syncer.metadir, func(path string, info os.FileInfo, err error) error {
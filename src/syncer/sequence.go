@@ -0,0 +1,94 @@
+/*
+ * Radon
+ *
+ * Copyright 2018 The Radon Authors.
+ * Code is licensed under the GPLv3.
+ *
+ */
+
+package syncer
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"sort"
+
+	"xbase"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// sequenceReserveRestURL url.
+	sequenceReserveRestURL = "v1/meta/sequence/reserve"
+)
+
+// SequenceReserve tuple.
+// It's the request to reserve the next segment of the sequence, or of the AUTO_INCREMENT of the table.
+type SequenceReserve struct {
+	DB            string `json:"db"`
+	Name          string `json:"name"`
+	AutoIncrement bool   `json:"auto-increment"`
+}
+
+// SequenceSegment tuple.
+// The values in [Start, Max) are reserved.
+type SequenceSegment struct {
+	Start int64 `json:"start"`
+	Max   int64 `json:"max"`
+}
+
+// SequenceOwner returns the peer reserving the sequence segments for all the peers,
+// it's the smallest peer address.
+func (s *Syncer) SequenceOwner() string {
+	peers := s.peer.Clone()
+	if len(peers) == 0 {
+		return s.peer.self
+	}
+	sort.Strings(peers)
+	return peers[0]
+}
+
+// ReserveSequence used to reserve the next segment of the sequence on the owner, the reservations
+// of the peers are serialized by the owner so no segment is handed out twice.
+// The owner confirms its meta is of the max version of the cluster before every reservation, so the
+// new owner after a failover sees the reservations of the former owner. The reservation fails if
+// any peer can't report its version.
+func (s *Syncer) ReserveSequence(db, name string, auto bool) (int64, int64, error) {
+	log := s.log
+	owner := s.SequenceOwner()
+	if owner == s.peer.self {
+		s.seqMu.Lock()
+		defer s.seqMu.Unlock()
+		if err := s.syncMaxVersion(true); err != nil {
+			log.Error("syncer.sequence.reserve[%s.%s].sync.max.version.error:%+v", db, name, err)
+			return 0, 0, err
+		}
+		return s.router.ReserveSequence(db, name, auto)
+	}
+
+	req := &SequenceReserve{
+		DB:            db,
+		Name:          name,
+		AutoIncrement: auto,
+	}
+	reserveURL := "http://" + path.Join(owner, sequenceReserveRestURL)
+	resp, cleanup, err := xbase.HTTPPost(reserveURL, req)
+	if err != nil {
+		log.Error("syncer.sequence.reserve[%s.%s].on.owner[%s].error:%+v", db, name, owner, err)
+		return 0, 0, err
+	}
+	defer cleanup()
+	if resp.StatusCode != http.StatusOK {
+		body := xbase.HTTPReadBody(resp)
+		log.Error("syncer.sequence.reserve[%s.%s].on.owner[%s].error:%s", db, name, owner, body)
+		return 0, 0, errors.Errorf("sequence.reserve[%s.%s].on.owner[%s].error:%s", db, name, owner, body)
+	}
+
+	seg := &SequenceSegment{}
+	if err := json.Unmarshal([]byte(xbase.HTTPReadBody(resp)), seg); err != nil {
+		return 0, 0, errors.WithStack(err)
+	}
+	return seg.Start, seg.Max, nil
+}
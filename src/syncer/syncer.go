@@ -20,12 +20,15 @@ import (
 	"router"
 	"xbase"
 
+	"github.com/pkg/errors"
 	"github.com/xelabs/go-mysqlstack/xlog"
 )
 
 // Syncer tuple.
 type Syncer struct {
 	mu      sync.RWMutex
+	checkMu sync.Mutex
+	seqMu   sync.Mutex
 	wg      sync.WaitGroup
 	log     *xlog.Log
 	done    chan bool
@@ -64,6 +67,11 @@ func (s *Syncer) Init() error {
 	}
 	log.Info("syncer.init.peers:%v", s.peer.peers)
 
+	// The sequences reserve the segments on the owner.
+	if s.router != nil {
+		s.router.SetSequenceReserver(s.ReserveSequence)
+	}
+
 	s.wg.Add(1)
 	go func() {
 		defer s.wg.Done()
@@ -114,6 +122,16 @@ func (s *Syncer) RUnlock() {
 }
 
 func (s *Syncer) check() {
+	s.syncMaxVersion(false)
+}
+
+// syncMaxVersion used to sync the meta from the peer with the max version if it's larger than self's.
+// If strict, all the peers must report their versions, so that the meta is confirmed to be of the
+// max version of the cluster.
+func (s *Syncer) syncMaxVersion(strict bool) error {
+	s.checkMu.Lock()
+	defer s.checkMu.Unlock()
+
 	log := s.log
 	maxVer := int64(0)
 	maxPeer := ""
@@ -125,13 +143,16 @@ func (s *Syncer) check() {
 			peerVerStr, err := xbase.HTTPGet(versionURL)
 			if err != nil {
 				log.Error("syncer.check.version.get[%s].error:%+v", peerVerStr, err)
+				if strict {
+					return errors.Errorf("syncer.check.version.of.peer[%s].error:%v", peer, err)
+				}
 				continue
 			}
 
 			version := &config.Version{}
 			if err := json.Unmarshal([]byte(peerVerStr), version); err != nil {
 				log.Error("syncer.version.unmarshal[%s].error:%+v", peerVerStr, err)
-				return
+				return errors.WithStack(err)
 			}
 			peerVer := version.Ts
 			if peerVer > maxVer {
@@ -148,15 +169,16 @@ func (s *Syncer) check() {
 		metaStr, err := xbase.HTTPGet(metaURL)
 		if err != nil {
 			log.Error("syncer.check.meta.get[%s].error:%+v", metaStr, err)
-			return
+			return errors.Errorf("syncer.check.meta.of.peer[%s].error:%v", maxPeer, err)
 		}
 
 		meta := &Meta{}
 		if err := json.Unmarshal([]byte(metaStr), meta); err != nil {
 			log.Error("syncer.check.meta.unmarshal[%s].error:%+v", metaStr, err)
-			return
+			return errors.WithStack(err)
 		}
 		s.MetaRebuild(meta)
 		s.MetaReload()
 	}
+	return nil
 }
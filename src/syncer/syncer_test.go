@@ -9,9 +9,12 @@
 package syncer
 
 import (
+	"sync"
 	"testing"
 	"time"
 
+	"router"
+
 	"github.com/fortytw2/leaktest"
 	"github.com/stretchr/testify/assert"
 	"github.com/xelabs/go-mysqlstack/xlog"
@@ -75,3 +78,82 @@ func TestSyncerAddRemovePeers(t *testing.T) {
 		assert.Equal(t, want, got)
 	}
 }
+
+func TestSyncerSequence(t *testing.T) {
+	defer leaktest.Check(t)()
+	defer testRemoveMetadir()
+	log := xlog.NewStdLog(xlog.Level(xlog.PANIC))
+	syncers, cleanup := mockSyncer(log, 2)
+	assert.NotNil(t, syncers)
+	defer cleanup()
+
+	router0 := syncers[0].router
+	router1 := syncers[1].router
+	err := router0.CreateSequence("sbtest", "s1", 1, 1, 10)
+	assert.Nil(t, err)
+	time.Sleep(time.Second * 2)
+	assert.True(t, router1.SequenceExists("sbtest", "s1"))
+
+	// The first peer owns the sequences.
+	assert.Equal(t, syncers[0].peer.self, syncers[0].SequenceOwner())
+	assert.Equal(t, syncers[0].peer.self, syncers[1].SequenceOwner())
+
+	// The segments reserved by the peers concurrently are disjoint.
+	var wg sync.WaitGroup
+	values := make([][]int64, 2)
+	errs := make([]error, 2)
+	for i, r := range []*router.Router{router0, router1} {
+		wg.Add(1)
+		go func(i int, r *router.Router) {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				vals, err := r.NextVal("sbtest", "s1", 7)
+				if err != nil {
+					errs[i] = err
+					return
+				}
+				values[i] = append(values[i], vals...)
+			}
+		}(i, r)
+	}
+	wg.Wait()
+	assert.Nil(t, errs[0])
+	assert.Nil(t, errs[1])
+	seen := make(map[int64]bool)
+	for _, v := range append(values[0], values[1]...) {
+		assert.False(t, seen[v])
+		seen[v] = true
+	}
+	assert.Equal(t, 70, len(seen))
+
+	// Reserve error on the owner.
+	{
+		_, err := router1.NextVal("sbtest", "s2", 1)
+		assert.NotNil(t, err)
+		_, _, err = syncers[1].ReserveSequence("sbtest", "s2", false)
+		assert.NotNil(t, err)
+	}
+
+	// The owner syncs the reservation of the former owner before reserving.
+	{
+		time.Sleep(time.Second * 1)
+		_, max, err := router1.ReserveSequence("sbtest", "s1", false)
+		assert.Nil(t, err)
+		start, _, err := syncers[0].ReserveSequence("sbtest", "s1", false)
+		assert.Nil(t, err)
+		assert.Equal(t, max, start)
+	}
+
+	// The owner can't confirm the max version.
+	{
+		err := syncers[0].AddPeer("127.0.0.1:9999")
+		assert.Nil(t, err)
+		_, _, err = syncers[0].ReserveSequence("sbtest", "s1", false)
+		assert.NotNil(t, err)
+		err = syncers[0].RemovePeer("127.0.0.1:9999")
+		assert.Nil(t, err)
+		_, _, err = syncers[0].ReserveSequence("sbtest", "s1", false)
+		assert.Nil(t, err)
+	}
+	time.Sleep(time.Second * 2)
+}
@@ -39,9 +39,21 @@ const (
 	TxnWrite
 )
 
+// BinlogEvent tuple, the event logged instead of the query if the query is
+// executed as other statements.
+type BinlogEvent struct {
+	Typ   string
+	Query string
+}
+
 // ResultContext tuple.
 type ResultContext struct {
 	Results *sqltypes.Result
+	Events  []BinlogEvent
+
+	// Stream sends the result to the client in parts if it's set, the large result may be streamed
+	// instead of held in the Results, whose state is RStateFinished then.
+	Stream func(*sqltypes.Result) error
 }
 
 // NewResultContext returns the result context.